@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/audit"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+)
+
+// cliActor identifies command line changes in the audit log.
+const cliActor = "cli"
+
+// recordCLIAudit logs a change made from the command line. Failures are logged; the change
+// itself has already been made.
+func recordCLIAudit(ctx context.Context, db *sql.DB, action, targetType, targetID string, details map[string]any) {
+	entry := &audit.Entry{
+		ActorUsername: cliActor,
+		Action:        action,
+		TargetType:    targetType,
+		TargetID:      targetID,
+		Outcome:       audit.OutcomeSuccess,
+		Details:       details,
+		UserAgent:     "server cli",
+	}
+	if err := audit.NewRepository(db).Create(ctx, entry); err != nil {
+		log.Printf("Failed to record %s in the audit log: %v", action, err)
+	}
+}
+
+// newUserOptions are the flags shared by `user create` and `create-admin`.
+type newUserOptions struct {
+	username           string
+	password           string
+	email              string
+	role               string
+	mustChangePassword bool
+}
+
+// createUser stores the user and prints its ID. Without a password one is generated and
+// printed, and the user must change it on first login.
+func createUser(cmd *cobra.Command, opts newUserOptions) error {
+	if opts.username == "" {
+		return fmt.Errorf("--username is required")
+	}
+	generated := opts.password == ""
+	if generated {
+		var err error
+		if opts.password, err = auth.GeneratePassword(); err != nil {
+			return err
+		}
+		opts.mustChangePassword = true
+	}
+
+	db, err := database.InitDB()
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer database.Close(db)
+
+	user := auth.NewUser{
+		Username:           opts.username,
+		Password:           opts.password,
+		Role:               opts.role,
+		MustChangePassword: opts.mustChangePassword,
+	}
+	if opts.email != "" {
+		user.Email = &opts.email
+	}
+	ctx := cmd.Context()
+	userID, err := auth.NewUserRepository(db).Create(ctx, user)
+	if err != nil {
+		return err
+	}
+	recordCLIAudit(ctx, db, audit.ActionUserCreate, audit.TargetUser, strconv.Itoa(userID), map[string]any{"username": opts.username, "role": user.Role})
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Created user %q (id %d, role %s)\n", opts.username, userID, user.Role)
+	if generated {
+		fmt.Fprintf(out, "Initial password: %s\n", opts.password)
+	}
+	if opts.mustChangePassword {
+		fmt.Fprintln(out, "The password must be changed on first login.")
+	}
+	return nil
+}
+
+func newUserCommand() *cobra.Command {
+	user := &cobra.Command{
+		Use:   "user",
+		Short: "Manage user accounts",
+	}
+
+	var opts newUserOptions
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Create a password account",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return createUser(cmd, opts)
+		},
+	}
+	create.Flags().StringVar(&opts.username, "username", "", "username (required)")
+	create.Flags().StringVar(&opts.password, "password", "", "initial password; generated and printed when empty")
+	create.Flags().StringVar(&opts.email, "email", "", "email address")
+	create.Flags().StringVar(&opts.role, "role", auth.RoleUser, "role to assign")
+	create.Flags().BoolVar(&opts.mustChangePassword, "must-change-password", false, "require a password change on first login (always set for generated passwords)")
+
+	user.AddCommand(create, &cobra.Command{
+		Use:   "deactivate <username>",
+		Short: "Block a user from signing in and revoke their sessions and API keys",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := database.InitDB()
+			if err != nil {
+				return fmt.Errorf("open database: %w", err)
+			}
+			defer database.Close(db)
+
+			ctx := cmd.Context()
+			users := auth.NewUserRepository(db)
+			user, err := users.Lookup(ctx, args[0])
+			if err != nil {
+				return err
+			}
+			revoked, err := users.Deactivate(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+			recordCLIAudit(ctx, db, audit.ActionUserDeactivate, audit.TargetUser, strconv.Itoa(user.ID), map[string]any{"revoked_api_keys": revoked})
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Deactivated user %q (id %d) and revoked %d API keys\n", user.Username, user.ID, revoked)
+			return nil
+		},
+	})
+	return user
+}
+
+// newCreateAdminCommand is `user create --role admin --must-change-password`, with the
+// username and password defaulting to ADMIN_USERNAME and ADMIN_PASSWORD.
+func newCreateAdminCommand() *cobra.Command {
+	opts := newUserOptions{role: auth.RoleAdmin, mustChangePassword: true}
+	cmd := &cobra.Command{
+		Use:   "create-admin",
+		Short: "Create an admin who must change the password on first login",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return createUser(cmd, opts)
+		},
+	}
+	cmd.Flags().StringVar(&opts.username, "username", os.Getenv("ADMIN_USERNAME"), "username (default $ADMIN_USERNAME)")
+	cmd.Flags().StringVar(&opts.password, "password", os.Getenv("ADMIN_PASSWORD"), "initial password (default $ADMIN_PASSWORD); generated and printed when empty")
+	cmd.Flags().StringVar(&opts.email, "email", "", "email address")
+	return cmd
+}
+
+func newAPIKeyCommand() *cobra.Command {
+	apikey := &cobra.Command{
+		Use:   "apikey",
+		Short: "Manage API keys",
+	}
+
+	var username, name, expiresIn string
+	create := &cobra.Command{
+		Use:   "create",
+		Short: "Create an API key for a user and print it",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if username == "" {
+				return fmt.Errorf("--user is required")
+			}
+			expiresAt, err := auth.ResolveAPIKeyExpiry(expiresIn, nil, time.Now().UTC())
+			if err != nil {
+				return err
+			}
+
+			db, err := database.InitDB()
+			if err != nil {
+				return fmt.Errorf("open database: %w", err)
+			}
+			defer database.Close(db)
+
+			ctx := cmd.Context()
+			user, err := auth.NewUserRepository(db).Lookup(ctx, username)
+			if err != nil {
+				return err
+			}
+			if !user.IsActive {
+				return fmt.Errorf("user %q is deactivated", username)
+			}
+			key, err := auth.CreateAPIKey(db, user.ID, name, expiresAt)
+			if err != nil {
+				return err
+			}
+			recordCLIAudit(ctx, db, audit.ActionAPIKeyCreate, audit.TargetAPIKey, strconv.Itoa(key.ID), map[string]any{"user_id": user.ID})
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Created API key %d for %q\n", key.ID, username)
+			if key.ExpiresAt != nil {
+				fmt.Fprintf(out, "Expires at %s\n", key.ExpiresAt.Format(time.RFC3339))
+			}
+			fmt.Fprintf(out, "API key (shown once): %s\n", key.APIKey)
+			return nil
+		},
+	}
+	create.Flags().StringVar(&username, "user", "", "username of the key's owner (required)")
+	create.Flags().StringVar(&name, "name", "", "key name")
+	create.Flags().StringVar(&expiresIn, "expires-in", "", `lifetime as whole days ("90d") or a duration ("12h"); never expires when empty`)
+
+	apikey.AddCommand(create, &cobra.Command{
+		Use:   "revoke <key-id>",
+		Short: "Revoke any personal or organization API key",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keyID, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid key id %q", args[0])
+			}
+
+			db, err := database.InitDB()
+			if err != nil {
+				return fmt.Errorf("open database: %w", err)
+			}
+			defer database.Close(db)
+
+			if err := auth.AdminRevokeAPIKey(db, keyID, nil); err != nil {
+				return err
+			}
+			recordCLIAudit(cmd.Context(), db, audit.ActionAPIKeyRevoke, audit.TargetAPIKey, args[0], nil)
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Revoked API key %d\n", keyID)
+			return nil
+		},
+	})
+	return apikey
+}
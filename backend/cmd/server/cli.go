@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/ingestion"
+)
+
+// newRootCommand builds the server command line. Without a subcommand it starts the server,
+// as before subcommands existed; the others run one operation against DATABASE_PATH and exit.
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "server",
+		Short: "Stacks Builder backend",
+		Long: "Stacks Builder backend. Without a subcommand the API server starts.\n" +
+			"Configuration comes from the environment and .env, as for the server.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		Run:          func(*cobra.Command, []string) { serve() },
+	}
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "serve",
+			Short: "Start the API server",
+			Args:  cobra.NoArgs,
+			Run:   func(*cobra.Command, []string) { serve() },
+		},
+		newMigrateCommand(),
+		newIngestCommand(),
+		newUserCommand(),
+		newAPIKeyCommand(),
+		newCreateAdminCommand(),
+	)
+	return root
+}
+
+func newMigrateCommand() *cobra.Command {
+	migrate := &cobra.Command{
+		Use:   "migrate",
+		Short: "Inspect and apply database schema migrations",
+	}
+	migrate.AddCommand(
+		&cobra.Command{
+			Use:   "up",
+			Short: "Apply pending migrations",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				path := database.Path()
+				_, statErr := os.Stat(path)
+				exists := statErr == nil
+
+				var pending []string
+				if exists {
+					var err error
+					if pending, err = database.Pending(path); err != nil {
+						return fmt.Errorf("check migrations: %w", err)
+					}
+				}
+				db, err := database.InitDB()
+				if err != nil {
+					return fmt.Errorf("apply migrations: %w", err)
+				}
+				defer database.Close(db)
+
+				out := cmd.OutOrStdout()
+				switch {
+				case !exists:
+					fmt.Fprintf(out, "Created database %s\n", path)
+				case len(pending) == 0:
+					fmt.Fprintf(out, "Database %s is up to date\n", path)
+				default:
+					fmt.Fprintf(out, "Applied %d schema changes to %s:\n", len(pending), path)
+					for _, change := range pending {
+						fmt.Fprintf(out, "  %s\n", change)
+					}
+				}
+				return nil
+			},
+		},
+		&cobra.Command{
+			Use:   "down",
+			Short: "Roll back migrations (not supported; restore a backup instead)",
+			Args:  cobra.NoArgs,
+			RunE: func(*cobra.Command, []string) error {
+				return errors.New("migrations cannot be rolled back: they only add tables, columns and indexes, " +
+					"which older versions ignore. To return to an earlier database, stop the server and copy a " +
+					"snapshot from BACKUP_DIR over DATABASE_PATH")
+			},
+		},
+		&cobra.Command{
+			Use:   "status",
+			Short: "List the schema changes migrate up would apply",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				path := database.Path()
+				out := cmd.OutOrStdout()
+				if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+					fmt.Fprintf(out, "Database %s does not exist; migrate up creates it\n", path)
+					return nil
+				}
+
+				pending, err := database.Pending(path)
+				if err != nil {
+					return fmt.Errorf("check migrations: %w", err)
+				}
+				if len(pending) == 0 {
+					fmt.Fprintf(out, "Database %s is up to date\n", path)
+					return nil
+				}
+				fmt.Fprintf(out, "%d pending schema changes for %s:\n", len(pending), path)
+				for _, change := range pending {
+					fmt.Fprintf(out, "  %s\n", change)
+				}
+				return nil
+			},
+		},
+	)
+	return migrate
+}
+
+// cliIngestJobTypes are the pipelines `ingest run` accepts, in the order it runs them by default.
+var cliIngestJobTypes = []string{ingestion.JobTypeCloneRepos, ingestion.JobTypeIngestSamples, ingestion.JobTypeIngestDocs}
+
+func newIngestCommand() *cobra.Command {
+	ingest := &cobra.Command{
+		Use:   "ingest",
+		Short: "Clone and index the Clarity sources",
+	}
+	ingest.AddCommand(&cobra.Command{
+		Use:       "run [clone_repos|ingest_samples|ingest_docs]...",
+		Short:     "Run ingestion pipelines in the foreground",
+		Long:      "Run ingestion pipelines in the foreground, in the order given. Without arguments the\nsources are cloned and then both collections are indexed.",
+		ValidArgs: cliIngestJobTypes,
+		Args:      cobra.OnlyValidArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				args = cliIngestJobTypes
+			}
+			cfg, err := ingestionConfig()
+			if err != nil {
+				return fmt.Errorf("configure vector store: %w", err)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			// Write to the collections a reindex switched to, as the server does.
+			if cfg.Indexer != nil {
+				db, err := database.InitDB()
+				if err != nil {
+					return fmt.Errorf("open database: %w", err)
+				}
+				defer database.Close(db)
+				if err := ingestion.LoadCollectionAliases(ctx, db); err != nil {
+					return fmt.Errorf("load vector store aliases: %w", err)
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			for _, jobType := range args {
+				fmt.Fprintf(out, "Running %s\n", jobType)
+				lastProgress, lastMessage := -1, ""
+				err := ingestion.Run(ctx, cfg, jobType, func(progress, processed, total int, message string) {
+					if progress == lastProgress && message == lastMessage {
+						return
+					}
+					lastProgress, lastMessage = progress, message
+					fmt.Fprintf(out, "  %3d%% %s\n", progress, message)
+				})
+				if err != nil {
+					return fmt.Errorf("%s: %w", jobType, err)
+				}
+			}
+			return nil
+		},
+	})
+	return ingest
+}
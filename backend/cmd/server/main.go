@@ -1,16 +1,39 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
 
 	docs "github.com/Quantum3-Labs/stacks-builder/backend/docs"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/handlers"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/artifact"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/backup"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/batch"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cachewarm"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/compression"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/eval"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/ingestion"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/mail"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/models"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/requestlimit"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/spend"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/webhook"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 )
@@ -73,8 +96,27 @@ func runPythonScript(scriptPath string, args ...string) error {
 	return cmd.Run()
 }
 
+// ingestionConfig returns the ingestion settings, writing to the vector store selected by
+// RAG_BACKEND.
+func ingestionConfig() (ingestion.Config, error) {
+	cfg := ingestion.ConfigFromEnv()
+	indexer, err := rag.NewIndexerFromEnv()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Indexer = indexer
+	return cfg, nil
+}
+
+// needsDataInitialization reports whether the sources still have to be cloned and ingested.
+// The local ChromaDB directory only matters when the ingestion scripts write to it.
+func needsDataInitialization(ingestCfg ingestion.Config) bool {
+	dataDir, chromaDBDir := resolveDataDirectories()
+	return isDataDirEmpty(dataDir) || (ingestCfg.Indexer == nil && isDataDirEmpty(chromaDBDir))
+}
+
 // initializeDataIfNeeded checks if data directory is empty and runs initialization scripts
-func initializeDataIfNeeded() error {
+func initializeDataIfNeeded(ingestCfg ingestion.Config) error {
 	// Get directories from environment variables
 	dataDir, chromaDBDir := resolveDataDirectories()
 
@@ -102,7 +144,7 @@ func initializeDataIfNeeded() error {
 	log.Printf("Using ChromaDB directory: %s", chromaDBDir)
 
 	// Check if data directory is empty
-	if isDataDirEmpty(dataDir) || isDataDirEmpty(chromaDBDir) {
+	if needsDataInitialization(ingestCfg) {
 		log.Println("Data directory is empty. Initializing...")
 
 		// Run clone_repos.py
@@ -119,6 +161,23 @@ func initializeDataIfNeeded() error {
 		}
 		log.Println("Documentation cloned successfully")
 
+		// Other vector stores are written through the ingestion pipeline
+		if ingestCfg.Indexer != nil {
+			store := ingestCfg.Indexer.Store().Name()
+			log.Printf("Ingesting code samples into %s...", store)
+			if err := ingestion.Run(context.Background(), ingestCfg, ingestion.JobTypeIngestSamples, nil); err != nil {
+				return err
+			}
+			log.Println("Code samples ingestion completed successfully")
+
+			log.Printf("Ingesting documentation into %s...", store)
+			if err := ingestion.Run(context.Background(), ingestCfg, ingestion.JobTypeIngestDocs, nil); err != nil {
+				return err
+			}
+			log.Println("Documentation ingestion completed successfully")
+			return nil
+		}
+
 		// Run ingest_samples.py
 		log.Println("Ingesting code samples into ChromaDB...")
 		if err := runPythonScript(ingestSamplesScript); err != nil {
@@ -169,18 +228,28 @@ func main() {
 		log.Println("Info: .env file not found, using environment variables from system")
 	}
 
-	const initMessage = "Backend is initializing data. Please try again shortly."
-	dataDir, chromaDBDir := resolveDataDirectories()
-	needsInitialization := isDataDirEmpty(dataDir) || isDataDirEmpty(chromaDBDir)
+	if err := newRootCommand().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
 
-	if needsInitialization {
+// serve starts the API server and its background services, and blocks until SIGINT or
+// SIGTERM.
+func serve() {
+	ingestCfg, err := ingestionConfig()
+	if err != nil {
+		log.Fatalf("Failed to configure vector store: %v", err)
+	}
+
+	const initMessage = "Backend is initializing data. Please try again shortly."
+	if needsDataInitialization(ingestCfg) {
 		middleware.SetMaintenanceMode(true, initMessage)
 	} else {
 		middleware.SetMaintenanceMode(false)
 	}
 
 	go func() {
-		if err := initializeDataIfNeeded(); err != nil {
+		if err := initializeDataIfNeeded(ingestCfg); err != nil {
 			log.Printf("Failed to initialize data: %v", err)
 			middleware.SetMaintenanceMode(true, "Initialization failed. Please check server logs.")
 			return
@@ -191,16 +260,134 @@ func main() {
 	// Configure swagger host/scheme for the current environment
 	configureSwagger()
 
+	// Load deployment prompt configuration
+	promptCfg, err := codegen.PromptConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load prompt configuration: %v", err)
+	}
+	if err := codegen.SetPromptConfig(promptCfg); err != nil {
+		log.Fatalf("Invalid prompt configuration: %v", err)
+	}
+
+	// Load the model capability registry and watch its file for changes
+	registry, err := models.RegistryFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load model registry: %v", err)
+	}
+	models.SetDefault(registry)
+	registry.Watch(context.Background(), models.RefreshIntervalFromEnv())
+
+	// Prices from MODEL_PRICES override or extend the registry's for cost estimates
+	prices, err := models.PriceOverridesFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid model prices: %v", err)
+	}
+	models.SetPriceOverrides(prices)
+
+	// Configure storage compression for large text columns
+	compressionCfg, err := compression.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid storage compression configuration: %v", err)
+	}
+	compression.Configure(compressionCfg)
+
 	// Initialize database
 	db, err := database.InitDB()
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
-	defer db.Close()
+	defer database.Close(db)
+
+	// Create the first admin from ADMIN_USERNAME/ADMIN_PASSWORD on a deployment without one
+	if created, err := auth.BootstrapAdmin(context.Background(), auth.NewUserRepository(db), auth.BootstrapConfigFromEnv()); err != nil {
+		log.Printf("Failed to bootstrap admin: %v", err)
+	} else if created {
+		log.Printf("Created admin %q; the password must be changed on first login", os.Getenv("ADMIN_USERNAME"))
+	}
+
+	// Apply the runtime codegen provider override saved by admins, if any
+	if err := codegen.NewRuntimeConfigStore(db).Load(context.Background()); err != nil {
+		log.Printf("Failed to load codegen configuration, using environment: %v", err)
+	}
 
 	// Initialize query logging service
 	qr := querylog.NewRepository(db)
-	qs := querylog.NewService(qr)
+	qs := querylog.NewService(qr, querylog.ServiceConfigFromEnv())
+
+	// Optionally compress existing rows in the background
+	if compression.Enabled() && os.Getenv("STORAGE_COMPRESSION_BACKFILL") == "true" {
+		go func() {
+			convos, err := conversation.NewRepository(db).CompressHistories(context.Background(), 100)
+			if err != nil {
+				log.Printf("Compression backfill for conversations failed: %v", err)
+			}
+			logs, err := qr.CompressResponses(100)
+			if err != nil {
+				log.Printf("Compression backfill for query logs failed: %v", err)
+			}
+			log.Printf("Compression backfill complete: %d conversations, %d query logs", convos, logs)
+		}()
+	}
+
+	// Start the stale API key sweeper when configured, mailing owners when SMTP is set up
+	mailer := mail.NewSender(mail.ConfigFromEnv())
+	staleKeyCfg := auth.StaleKeyConfigFromEnv()
+	var staleKeyNotifier auth.Notifier = auth.LogNotifier{}
+	if mailer.Enabled() {
+		staleKeyNotifier = auth.EmailNotifier{Sender: mailer}
+	}
+	keySweeper := auth.NewStaleKeySweeper(db, staleKeyCfg, staleKeyNotifier)
+	if staleKeyCfg.Enabled() {
+		keySweeper.Start(context.Background())
+	}
+
+	// Anonymous trial tokens; expired trials are cleaned up even while trials are disabled
+	trials := auth.NewTrialService(db, auth.TrialConfigFromEnv())
+	trials.Start(context.Background())
+
+	// Deliver job completion and quota events to admin-registered webhooks
+	webhooks := webhook.NewDispatcher(webhook.NewRepository(db), webhook.ConfigFromEnv())
+	webhooks.Start(context.Background())
+
+	// Check LLM spend against the configured budgets and alert through webhooks and email
+	spendCfg := spend.ConfigFromEnv()
+	spendNotifiers := spend.Notifiers{spend.LogNotifier{}, spend.WebhookNotifier{Events: webhooks}}
+	if mailer.Enabled() && len(spendCfg.AlertEmails) > 0 {
+		spendNotifiers = append(spendNotifiers, spend.EmailNotifier{Sender: mailer, To: spendCfg.AlertEmails})
+	}
+	spendService := spend.NewService(db, spendCfg, spendNotifiers)
+	spendService.Start(context.Background())
+
+	// Online SQLite snapshots, on a schedule when BACKUP_INTERVAL is set and on demand
+	backups := backup.NewService(db, backup.ConfigFromEnv())
+	backups.Start(context.Background())
+
+	// Query logs older than QUERY_LOG_ARCHIVE_AFTER_DAYS moved to monthly compressed files
+	archiver := querylog.NewArchiver(db, querylog.ArchiveConfigFromEnv())
+	archiver.Start(context.Background())
+
+	// Zipped project bundles behind expiring download links; expired ones are deleted hourly
+	artifacts := artifact.NewStore(db, artifact.ConfigFromEnv())
+	artifacts.Start(context.Background())
+
+	// Start the ingestion job workers
+	ingestManager := ingestion.NewManager(db, ingestCfg, webhooks)
+	ingestManager.Start(context.Background())
+
+	// Batch generation jobs; batches interrupted by a restart cannot resume
+	batchManager := batch.NewManager(db, batch.ConfigFromEnv(), qs, webhooks)
+	batchManager.FailAbandoned(context.Background())
+
+	// Services shared by handlers and the cache warmer, created on first use
+	services := handlers.NewServiceRegistry()
+
+	// Precompute retrieval cache entries for popular queries when scheduled
+	cacheWarmer := handlers.NewCacheWarmer(services, qr, cachewarm.ConfigFromEnv())
+	cacheWarmer.Start(context.Background())
+
+	// Golden prompt evaluation against the active provider, nightly when scheduled
+	evals := handlers.NewEvalService(db, services, eval.ConfigFromEnv())
+	evals.Start(context.Background())
 
 	// Set Gin mode
 	if os.Getenv("GIN_MODE") == "" {
@@ -209,10 +396,22 @@ func main() {
 
 	// Create Gin router
 	router := gin.Default()
-	router.Use(middleware.MaintenanceModeMiddleware())
+	// Client IPs feed API key allowlists, rate limits, audit and query logs, so only honor
+	// forwarding headers from the configured proxies
+	if err := middleware.ConfigureClientIP(router); err != nil {
+		log.Fatalf("Invalid client IP configuration: %v", err)
+	}
+	if len(middleware.TrustedProxiesFromEnv()) == 0 {
+		log.Printf("No trusted proxies configured; client IPs are connection addresses and X-Forwarded-For is ignored")
+	}
+	// OpenAI-compatible routes answer with OpenAI error objects, including maintenance errors
+	router.Use(middleware.OpenAIErrorMiddleware([]string{"/v1/"}))
+	router.Use(middleware.MaintenanceModeMiddleware(middleware.MaintenanceConfigFromEnv()))
+	// Body size, message and n_results limits, checked before anything buffers the body
+	router.Use(middleware.RequestLimitsMiddleware(requestlimit.ConfigFromEnv()))
 
 	// Setup routes
-	api.SetupRoutes(router, db, qr, qs)
+	api.SetupRoutes(router, db, qr, qs, keySweeper, staleKeyCfg, ingestManager, batchManager, cacheWarmer, trials, services, webhooks, spendService, backups, artifacts, evals, archiver)
 
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
@@ -221,8 +420,26 @@ func main() {
 	}
 
 	// Start server
-	log.Printf("Starting server on port %s...", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{Addr: ":" + port, Handler: router}
+	go func() {
+		log.Printf("Starting server on port %s...", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// Stop on SIGINT/SIGTERM, finishing in-flight requests and writing queued query logs
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Println("Shutting down...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown failed: %v", err)
+	}
+	if err := qs.Close(shutdownCtx); err != nil {
+		log.Printf("Failed to write queued query logs: %v", err)
 	}
 }
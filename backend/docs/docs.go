@@ -324,6 +324,10 @@ const docTemplate = `{
                 "username"
             ],
             "properties": {
+                "create_api_key": {
+                    "description": "CreateAPIKey also issues a non-expiring API key, returned once in the response.",
+                    "type": "boolean"
+                },
                 "email": {
                     "type": "string"
                 },
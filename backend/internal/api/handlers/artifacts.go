@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/artifact"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+// DownloadArtifact serves a stored project bundle as a zip. The link's expires and
+// signature parameters stand in for authentication, so links can be shared or opened in a
+// browser until they expire.
+func DownloadArtifact(store *artifact.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if err := store.Verify(id, c.Query("expires"), c.Query("signature")); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		meta, content, err := store.Content(c.Request.Context(), id)
+		if err != nil {
+			respondArtifactError(c, err, "failed to read artifact")
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", meta.FileName))
+		c.Data(http.StatusOK, meta.ContentType, content)
+	}
+}
+
+// CreateArtifactLink issues a fresh download link for one of the caller's artifacts.
+func CreateArtifactLink(store *artifact.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		meta, err := store.Get(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			respondArtifactError(c, err, "failed to get artifact")
+			return
+		}
+		userID, ok := extractUserID(c)
+		if !ok || meta.UserID == nil || *meta.UserID != int64(userID) {
+			// Other users' artifacts are indistinguishable from missing ones.
+			c.JSON(http.StatusNotFound, gin.H{"error": artifact.ErrNotFound.Error()})
+			return
+		}
+		store.Link(meta)
+		c.JSON(http.StatusOK, meta)
+	}
+}
+
+// saveProjectArtifact zips the files into a stored artifact owned by the caller and returns
+// the archive along with it. A failure to store the bundle is logged and only drops the
+// artifact, since the generation has already been paid for.
+func saveProjectArtifact(c *gin.Context, store *artifact.Store, name string, files []codegen.ProjectFile) ([]byte, *artifact.Artifact, error) {
+	bundle := make([]artifact.File, 0, len(files))
+	for _, file := range files {
+		bundle = append(bundle, artifact.File{Path: file.Path, Content: file.Content})
+	}
+	content, err := artifact.Zip(name, bundle)
+	if err != nil {
+		return nil, nil, err
+	}
+	if store == nil {
+		return content, nil, nil
+	}
+
+	var owner *int64
+	if userID, ok := extractUserID(c); ok {
+		id := int64(userID)
+		owner = &id
+	}
+	saved, err := store.Save(c.Request.Context(), owner, name, len(bundle), content)
+	if err != nil {
+		log.Printf("Failed to store artifact %q: %v", name, err)
+		return content, nil, nil
+	}
+	c.Header("X-Artifact-ID", saved.ID)
+	return content, saved, nil
+}
+
+func respondArtifactError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, artifact.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Artifact request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/audit"
+)
+
+// ListAuditLogs returns paginated audit entries, newest first, with optional filters.
+func ListAuditLogs(repo *audit.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+		params := audit.ListParams{
+			Page:       page,
+			Limit:      limit,
+			Action:     c.Query("action"),
+			TargetType: c.Query("target_type"),
+			TargetID:   c.Query("target_id"),
+			Outcome:    c.Query("outcome"),
+		}
+		if actorID, ok := parseInt64Ptr(c.Query("actor_id")); ok {
+			params.ActorID = actorID
+		}
+		if start, ok := parseDate(c.Query("start_date")); ok {
+			params.StartDate = &start
+		}
+		if end, ok := parseDate(c.Query("end_date")); ok {
+			params.EndDate = &end
+		}
+
+		entries, total, err := repo.List(c.Request.Context(), params)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list audit logs"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"entries": entries,
+			"total":   total,
+			"page":    params.Page,
+			"limit":   params.Limit,
+		})
+	}
+}
+
+// GetAuditLog returns a single audit entry by ID.
+func GetAuditLog(repo *audit.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		entry, err := repo.Get(c.Request.Context(), id)
+		if err != nil {
+			if errors.Is(err, audit.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "audit entry not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch audit entry"})
+			return
+		}
+
+		c.JSON(http.StatusOK, entry)
+	}
+}
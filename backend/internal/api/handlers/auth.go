@@ -4,11 +4,15 @@ import (
 	"database/sql"
 	"errors"
 	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
 )
 
@@ -21,14 +25,16 @@ import (
 // @Param request body auth.RegisterRequest true "User registration details"
 // @Success 201 {object} map[string]interface{} "User created successfully"
 // @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 500 {object} map[string]interface{} "Failed to create user"
 // @Router /auth/register [post]
-func Register(db *sql.DB) gin.HandlerFunc {
+func Register(users auth.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req auth.RegisterRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		c.Set(middleware.AuditActorUsername, req.Username)
 
 		var email *string
 		if req.Email != "" {
@@ -36,24 +42,50 @@ func Register(db *sql.DB) gin.HandlerFunc {
 		}
 
 		// All new users are created with "user" role by default
-		userID, err := auth.CreateUser(db, req.Username, req.Password, email, auth.RoleUser)
-		if err != nil {
+		user := auth.NewUser{Username: req.Username, Password: req.Password, Email: email, Role: auth.RoleUser}
+		var (
+			userID int
+			key    *auth.APIKeyResponse
+			err    error
+		)
+		if req.CreateAPIKey {
+			userID, key, err = users.CreateWithAPIKey(c.Request.Context(), user, defaultAPIKeyName)
+		} else {
+			userID, err = users.Create(c.Request.Context(), user)
+		}
+		switch {
+		case errors.Is(err, auth.ErrUsernameTaken), errors.Is(err, auth.ErrUsernameTooShort),
+			errors.Is(err, auth.ErrPasswordTooShort), errors.Is(err, auth.ErrInvalidRole):
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
+		case err != nil:
+			log.Printf("Failed to register %q: %v", req.Username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			return
 		}
+		c.Set(middleware.AuditActorID, userID)
+		c.Set(middleware.AuditTargetID, userID)
 
-		c.JSON(http.StatusCreated, gin.H{
+		body := gin.H{
 			"success": true,
 			"message": "User created successfully",
 			"user_id": userID,
 			"role":    auth.RoleUser,
-		})
+		}
+		if key != nil {
+			c.Set(middleware.AuditDetails, map[string]any{"api_key_id": key.ID, "prefix": key.Prefix})
+			body["api_key"] = key
+		}
+		c.JSON(http.StatusCreated, body)
 	}
 }
 
+// defaultAPIKeyName names the key issued on registration when the client asks for one.
+const defaultAPIKeyName = "Default"
+
 // Login handles user login
 // @Summary Login user
-// @Description Authenticate user with username and password
+// @Description Authenticate user with username and password and issue session tokens
 // @Tags Authentication
 // @Accept json
 // @Produce json
@@ -61,26 +93,259 @@ func Register(db *sql.DB) gin.HandlerFunc {
 // @Success 200 {object} map[string]interface{} "Authentication successful"
 // @Failure 400 {object} map[string]interface{} "Invalid request"
 // @Failure 401 {object} map[string]interface{} "Invalid credentials"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts"
 // @Router /auth/login [post]
-func Login(db *sql.DB) gin.HandlerFunc {
+func Login(users auth.UserStore, tokens *auth.TokenService, guard *auth.LoginGuard) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req auth.LoginRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		c.Set(middleware.AuditActorUsername, req.Username)
 
-		user, err := auth.AuthenticateUser(db, req.Username, req.Password)
+		until, err := guard.Check(req.Username, middleware.ClientIP(c))
 		if err != nil {
+			log.Printf("Failed to check login attempts for %q: %v", req.Username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
+			return
+		}
+		if !until.IsZero() {
+			middleware.LoginBlocked(c, until)
+			return
+		}
+
+		user, err := users.Authenticate(c.Request.Context(), req.Username, req.Password)
+		if err != nil && !errors.Is(err, auth.ErrInvalidCredentials) {
+			log.Printf("Failed to authenticate %q: %v", req.Username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
+			return
+		}
+		if err != nil {
+			if _, recordErr := guard.RecordFailure(req.Username, middleware.ClientIP(c)); recordErr != nil {
+				log.Printf("Failed to record login failure for %q: %v", req.Username, recordErr)
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
+		c.Set(middleware.AuditActorID, user.ID)
+		c.Set(middleware.AuditTargetID, user.ID)
+		if err := guard.RecordSuccess(user.Username); err != nil {
+			log.Printf("Failed to clear login failures for %q: %v", user.Username, err)
+		}
+
+		pair, err := tokens.Issue(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue session tokens"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":            true,
+			"message":            "Authentication successful",
+			"user_id":            user.ID,
+			"username":           user.Username,
+			"role":               user.Role,
+			"access_token":       pair.AccessToken,
+			"token_type":         pair.TokenType,
+			"expires_in":         pair.ExpiresIn,
+			"refresh_token":      pair.RefreshToken,
+			"refresh_expires_in": pair.RefreshExpiresIn,
+			// Until the password is changed, the tokens only work for POST /auth/password.
+			"password_change_required": user.MustChangePassword,
+		})
+	}
+}
+
+// StartTrial issues an anonymous trial token
+// @Summary Start an anonymous trial
+// @Description Issue an ephemeral API key with the trial role's limits to an unregistered device
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body auth.StartTrialRequest true "Device identifier"
+// @Success 201 {object} auth.TrialToken "Trial started"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 403 {object} map[string]interface{} "Trial access disabled"
+// @Failure 409 {object} map[string]interface{} "Trial already active for this device"
+// @Failure 429 {object} map[string]interface{} "Too many trials from this address"
+// @Router /auth/trial [post]
+func StartTrial(trials *auth.TrialService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req auth.StartTrialRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		trial, err := trials.Issue(strings.TrimSpace(req.DeviceID), middleware.ClientIP(c))
+		var active *auth.TrialActiveError
+		switch {
+		case errors.Is(err, auth.ErrTrialDisabled):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		case errors.As(err, &active):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "expires_at": active.ExpiresAt})
+			return
+		case errors.Is(err, auth.ErrTrialLimit):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to start trial: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start trial"})
+			return
+		}
+		c.Set(middleware.AuditActorID, trial.UserID)
+		c.Set(middleware.AuditTargetID, trial.UserID)
+
+		c.JSON(http.StatusCreated, trial)
+	}
+}
+
+// RefreshToken exchanges a refresh token for a new token pair
+// @Summary Refresh session tokens
+// @Description Exchange a refresh token for a new access token and rotated refresh token
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body auth.RefreshTokenRequest true "Refresh token"
+// @Success 200 {object} auth.TokenPair "New session tokens"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Invalid, expired, or revoked refresh token"
+// @Router /auth/refresh [post]
+func RefreshToken(tokens *auth.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req auth.RefreshTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+			return
+		}
+
+		pair, err := tokens.Refresh(req.RefreshToken)
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+			return
+		}
+
+		c.JSON(http.StatusOK, pair)
+	}
+}
+
+// Logout revokes the session tokens
+// @Summary Logout
+// @Description Revoke the refresh token and, when sent as a bearer token, the current access token
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Param request body auth.RefreshTokenRequest false "Refresh token to revoke"
+// @Success 200 {object} map[string]interface{} "Logged out"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Router /auth/logout [post]
+func Logout(tokens *auth.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req auth.RefreshTokenRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var claims *auth.AccessClaims
+		if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			if parsed, err := tokens.ParseAccessToken(strings.TrimPrefix(header, "Bearer ")); err == nil {
+				claims = parsed
+			}
+		}
+
+		if req.RefreshToken == "" && claims == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token or bearer access token required"})
+			return
+		}
+
+		if err := tokens.Logout(req.RefreshToken, claims); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "Logged out",
+		})
+	}
+}
+
+// ChangePassword replaces the caller's password
+// @Summary Change password
+// @Description Replace the authenticated user's password. Accounts created with a temporary password can use no other route until they do. Every other session is signed out, and new session tokens are returned.
+// @Tags Authentication
+// @Accept json
+// @Produce json
+// @Security BasicAuth
+// @Param request body auth.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} map[string]interface{} "Password changed"
+// @Failure 400 {object} map[string]interface{} "Invalid request or new password"
+// @Failure 401 {object} map[string]interface{} "Wrong current password"
+// @Router /auth/password [post]
+func ChangePassword(users auth.UserStore, tokens *auth.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		c.Set(middleware.AuditTargetID, userID)
+
+		var req auth.ChangePasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := users.ChangePassword(c.Request.Context(), userID, req.CurrentPassword, req.NewPassword)
+		switch {
+		case errors.Is(err, auth.ErrPasswordTooShort), errors.Is(err, auth.ErrPasswordUnchanged):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, auth.ErrInvalidCredentials), errors.Is(err, auth.ErrUserNotFound):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+			return
+		case err != nil:
+			log.Printf("Failed to change password of user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+			return
+		}
+
+		// Sessions opened with the old password end; the caller gets a fresh one.
+		if err := tokens.RevokeUserSessions(userID); err != nil {
+			log.Printf("Failed to revoke sessions of user %d: %v", userID, err)
+		}
+		if claims, ok := c.Get("token_claims"); ok {
+			if err := tokens.Logout("", claims.(*auth.AccessClaims)); err != nil {
+				log.Printf("Failed to revoke access token of user %d: %v", userID, err)
+			}
+		}
+		pair, err := tokens.Issue(&auth.User{ID: userID, Username: c.GetString("username"), Role: c.GetString("user_role")})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Password changed, but failed to issue session tokens"})
+			return
+		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"success":  true,
-			"message":  "Authentication successful",
-			"user_id":  user.ID,
-			"username": user.Username,
+			"success":            true,
+			"message":            "Password changed",
+			"access_token":       pair.AccessToken,
+			"token_type":         pair.TokenType,
+			"expires_in":         pair.ExpiresIn,
+			"refresh_token":      pair.RefreshToken,
+			"refresh_expires_in": pair.RefreshExpiresIn,
 		})
 	}
 }
@@ -92,7 +357,7 @@ func Login(db *sql.DB) gin.HandlerFunc {
 // @Accept json
 // @Produce json
 // @Security BasicAuth
-// @Param request body auth.CreateAPIKeyRequest false "API key name (optional)"
+// @Param request body auth.CreateAPIKeyRequest false "API key name and expiry (optional)"
 // @Success 201 {object} map[string]interface{} "API key created successfully"
 // @Failure 400 {object} map[string]interface{} "Invalid request"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
@@ -118,33 +383,54 @@ func CreateAPIKey(db *sql.DB) gin.HandlerFunc {
 				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
-			req.Name = ""
+			req = auth.CreateAPIKeyRequest{}
 		}
 
-		apiKeyResp, err := auth.CreateAPIKey(db, userID, req.Name)
+		expiresAt, err := auth.ResolveAPIKeyExpiry(req.ExpiresIn, req.ExpiresAt, time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		apiKeyResp, err := auth.CreateAPIKey(db, userID, req.Name, expiresAt)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		c.Set(middleware.AuditTargetID, apiKeyResp.ID)
+		c.Set(middleware.AuditDetails, map[string]any{
+			"name":       apiKeyResp.Name,
+			"prefix":     apiKeyResp.Prefix,
+			"expires_at": apiKeyResp.ExpiresAt,
+		})
 
 		c.JSON(http.StatusCreated, gin.H{
-			"success": true,
-			"message": "API key created successfully",
-			"api_key": apiKeyResp.APIKey,
-			"name":    apiKeyResp.Name,
-			"prefix":  apiKeyResp.Prefix,
+			"success":    true,
+			"message":    "API key created successfully",
+			"id":         apiKeyResp.ID,
+			"api_key":    apiKeyResp.APIKey,
+			"name":       apiKeyResp.Name,
+			"prefix":     apiKeyResp.Prefix,
+			"expires_at": apiKeyResp.ExpiresAt,
 		})
 	}
 }
 
-// ListAPIKeys returns all API keys for the user
+// ListAPIKeys returns a page of the user's API keys
 // @Summary List API keys
-// @Description Get all API keys for the authenticated user
+// @Description Get a page of the authenticated user's API keys, optionally filtered by name
 // @Tags API Keys
 // @Accept json
 // @Produce json
 // @Security BasicAuth
-// @Success 200 {array} auth.APIKeyListItem "List of API keys"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Keys per page (max 100)" default(20)
+// @Param search query string false "Keep keys whose name contains this text"
+// @Param sort query string false "created_at, name, last_used_at or expires_at" default(created_at)
+// @Param order query string false "asc or desc" default(desc)
+// @Param include_revoked query bool false "Also list revoked keys with revoked_at and revoke_reason"
+// @Success 200 {object} map[string]interface{} "Keys with total, page and limit"
+// @Failure 400 {object} map[string]interface{} "Invalid sort or order"
 // @Failure 401 {object} map[string]interface{} "Unauthorized"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /auth/keys [get]
@@ -162,19 +448,46 @@ func ListAPIKeys(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		keys, err := auth.GetUserAPIKeys(db, userID)
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		params := auth.APIKeyListParams{
+			Page:   page,
+			Limit:  limit,
+			Search: c.Query("search"),
+			Sort:   c.Query("sort"),
+			Order:  c.Query("order"),
+		}
+		if raw := c.Query("include_revoked"); raw != "" {
+			include, err := strconv.ParseBool(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "include_revoked must be true or false"})
+				return
+			}
+			params.IncludeRevoked = include
+		}
+
+		keys, total, err := auth.GetUserAPIKeys(db, userID, params)
+		if errors.Is(err, auth.ErrInvalidListParams) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, keys)
+		c.JSON(http.StatusOK, gin.H{
+			"keys":  keys,
+			"total": total,
+			"page":  page,
+			"limit": limit,
+		})
 	}
 }
 
 // RevokeAPIKey revokes an API key
 // @Summary Revoke API key
-// @Description Permanently revoke/delete an API key
+// @Description Revoke an API key. The owner can restore it within API_KEY_RESTORE_WINDOW.
 // @Tags API Keys
 // @Accept json
 // @Produce json
@@ -216,3 +529,437 @@ func RevokeAPIKey(db *sql.DB) gin.HandlerFunc {
 		})
 	}
 }
+
+// RestoreAPIKey reactivates a revoked API key
+// @Summary Restore API key
+// @Description Reactivate one of your API keys revoked within API_KEY_RESTORE_WINDOW. Rotated keys cannot be restored.
+// @Tags API Keys
+// @Produce json
+// @Security BasicAuth
+// @Param id path int true "API Key ID"
+// @Success 200 {object} auth.APIKeyListItem "Restored API key"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 404 {object} map[string]interface{} "API key not found"
+// @Failure 409 {object} map[string]interface{} "Key is active or cannot be restored"
+// @Router /auth/keys/{id}/restore [post]
+func RestoreAPIKey(db *sql.DB, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		keyID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+			return
+		}
+
+		key, err := auth.RestoreAPIKey(db, keyID, userID, &userID, window)
+		if err != nil {
+			respondRestoreAPIKeyError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, key)
+	}
+}
+
+// AdminRestoreAPIKey reactivates any revoked API key except rotated ones, whenever it was revoked.
+func AdminRestoreAPIKey(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		keyID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+			return
+		}
+
+		key, err := auth.RestoreAPIKey(db, keyID, adminID, nil, 0)
+		if err != nil {
+			respondRestoreAPIKeyError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, key)
+	}
+}
+
+func respondRestoreAPIKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, auth.ErrAPIKeyNotOwned):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrAPIKeyNotRevoked), errors.Is(err, auth.ErrAPIKeyNotRestorable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Failed to restore API key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore API key"})
+	}
+}
+
+// GetAPIKeyHistory lists the revocations and restores of an API key
+// @Summary API key revocation history
+// @Description List every revocation and restore of one of your API keys, oldest first
+// @Tags API Keys
+// @Produce json
+// @Security BasicAuth
+// @Param id path int true "API Key ID"
+// @Success 200 {object} map[string]interface{} "Key events"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 404 {object} map[string]interface{} "API key not found"
+// @Router /auth/keys/{id}/history [get]
+func GetAPIKeyHistory(db *sql.DB) gin.HandlerFunc {
+	return apiKeyHistory(db, true)
+}
+
+// AdminGetAPIKeyHistory lists the revocations and restores of any API key.
+func AdminGetAPIKeyHistory(db *sql.DB) gin.HandlerFunc {
+	return apiKeyHistory(db, false)
+}
+
+func apiKeyHistory(db *sql.DB, ownedOnly bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		keyID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+			return
+		}
+
+		var ownerID *int
+		if ownedOnly {
+			ownerID = &userID
+		}
+		events, err := auth.GetAPIKeyHistory(db, keyID, ownerID)
+		if errors.Is(err, auth.ErrAPIKeyNotOwned) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to load history of API key %d: %v", keyID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load API key history"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"events": events})
+	}
+}
+
+// UpdateAPIKey changes the name, expiry or IP allowlist of an API key
+// @Summary Update API key
+// @Description Rename an API key, change when it expires or restrict the IP addresses it may be used from
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Security BasicAuth
+// @Param id path int true "API Key ID"
+// @Param request body auth.UpdateAPIKeyRequest true "Fields to change"
+// @Success 200 {object} auth.APIKeyListItem "Updated API key"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 404 {object} map[string]interface{} "API key not found"
+// @Router /auth/keys/{id} [patch]
+func UpdateAPIKey(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDValue, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		userID, ok := userIDValue.(int)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user context"})
+			return
+		}
+
+		keyID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+			return
+		}
+
+		var req auth.UpdateAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			if name == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "name cannot be empty"})
+				return
+			}
+			req.Name = &name
+		}
+
+		setExpiry := req.NeverExpires || req.ExpiresIn != "" || req.ExpiresAt != nil
+		if req.NeverExpires && (req.ExpiresIn != "" || req.ExpiresAt != nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "never_expires cannot be combined with expires_in or expires_at"})
+			return
+		}
+		if req.Name == nil && !setExpiry && req.AllowedCIDRs == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nothing to update"})
+			return
+		}
+		if req.AllowedCIDRs != nil {
+			cidrs, err := auth.NormalizeAllowedCIDRs(*req.AllowedCIDRs)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			req.AllowedCIDRs = &cidrs
+		}
+
+		expiresAt, err := auth.ResolveAPIKeyExpiry(req.ExpiresIn, req.ExpiresAt, time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		key, err := auth.UpdateAPIKey(db, userID, keyID, req.Name, setExpiry, expiresAt, req.AllowedCIDRs)
+		if errors.Is(err, auth.ErrAPIKeyNotOwned) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		details := map[string]any{}
+		if req.Name != nil {
+			details["name"] = key.Name
+		}
+		if setExpiry {
+			details["expires_at"] = key.ExpiresAt
+		}
+		if req.AllowedCIDRs != nil {
+			details["allowed_cidrs"] = key.AllowedCIDRs
+		}
+		c.Set(middleware.AuditDetails, details)
+
+		c.JSON(http.StatusOK, key)
+	}
+}
+
+// RotateAPIKey replaces an API key with a new one and revokes the old key
+// @Summary Rotate API key
+// @Description Atomically create a replacement API key with the same name and revoke the old one
+// @Tags API Keys
+// @Accept json
+// @Produce json
+// @Security BasicAuth
+// @Param id path int true "API Key ID"
+// @Param request body auth.RotateAPIKeyRequest false "Expiry of the replacement key (optional)"
+// @Success 201 {object} map[string]interface{} "Replacement API key"
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Failure 404 {object} map[string]interface{} "API key not found"
+// @Router /auth/keys/{id}/rotate [post]
+func RotateAPIKey(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userIDValue, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		userID, ok := userIDValue.(int)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user context"})
+			return
+		}
+
+		keyID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+			return
+		}
+
+		var req auth.RotateAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		expiresAt, err := auth.ResolveAPIKeyExpiry(req.ExpiresIn, req.ExpiresAt, time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		apiKeyResp, err := auth.RotateAPIKey(db, userID, keyID, expiresAt)
+		if errors.Is(err, auth.ErrAPIKeyNotOwned) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{
+			"new_key_id": apiKeyResp.ID,
+			"expires_at": apiKeyResp.ExpiresAt,
+		})
+
+		resp := gin.H{
+			"success":        true,
+			"message":        "API key rotated successfully",
+			"id":             apiKeyResp.ID,
+			"api_key":        apiKeyResp.APIKey,
+			"name":           apiKeyResp.Name,
+			"prefix":         apiKeyResp.Prefix,
+			"expires_at":     apiKeyResp.ExpiresAt,
+			"revoked_key_id": keyID,
+		}
+		if len(apiKeyResp.AllowedCIDRs) > 0 {
+			resp["allowed_cidrs"] = apiKeyResp.AllowedCIDRs
+		}
+		c.JSON(http.StatusCreated, resp)
+	}
+}
+
+// ListStaleAPIKeys returns active API keys that have gone unused past the stale threshold.
+func ListStaleAPIKeys(db *sql.DB, cfg auth.StaleKeyConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idle := cfg.After
+		if daysStr := c.Query("days"); daysStr != "" {
+			days, err := strconv.Atoi(daysStr)
+			if err != nil || days < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a non-negative integer"})
+				return
+			}
+			idle = time.Duration(days) * 24 * time.Hour
+		}
+		if idle <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days is required when API_KEY_STALE_DAYS is not configured"})
+			return
+		}
+
+		keys, err := auth.ListStaleAPIKeys(db, idle)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list stale API keys"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"keys":        keys,
+			"total":       len(keys),
+			"idle_days":   int(idle.Hours() / 24),
+			"auto_revoke": cfg.Revoke,
+		})
+	}
+}
+
+// SweepStaleAPIKeys runs the stale key sweeper immediately.
+func SweepStaleAPIKeys(sweeper *auth.StaleKeySweeper) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := sweeper.Sweep(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sweep stale API keys"})
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{
+			"notified": result.Notified,
+			"flagged":  result.Flagged,
+			"revoked":  result.Revoked,
+		})
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// UpdateUserRole assigns a built-in or defined role to a user. Callers cannot change their own
+// role, so the last admin cannot lock everyone out by accident.
+func UpdateUserRole(users auth.UserStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		var req auth.UpdateUserRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		if actorID, ok := c.Get("user_id"); ok && actorID == userID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot change your own role"})
+			return
+		}
+
+		previous, err := users.SetRole(c.Request.Context(), userID, req.Role)
+		if errors.Is(err, auth.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, auth.ErrInvalidRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown role " + strconv.Quote(req.Role)})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to update role for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update role"})
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{
+			"previous_role": previous,
+			"role":          req.Role,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"user_id":       userID,
+			"role":          req.Role,
+			"previous_role": previous,
+		})
+	}
+}
+
+// UnlockUser clears a user's failed login attempts and lockout, and optionally a client IP's.
+func UnlockUser(guard *auth.LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		var req auth.UnlockUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		username, unlocked, err := guard.UnlockUser(userID, req.IP)
+		if errors.Is(err, auth.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to unlock user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock user"})
+			return
+		}
+		details := map[string]any{"username": username, "unlocked": unlocked}
+		if req.IP != "" {
+			details["ip"] = req.IP
+		}
+		c.Set(middleware.AuditDetails, details)
+
+		c.JSON(http.StatusOK, gin.H{
+			"user_id":  userID,
+			"username": username,
+			"unlocked": unlocked,
+		})
+	}
+}
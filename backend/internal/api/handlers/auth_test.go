@@ -0,0 +1,137 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/handlers"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testutil"
+)
+
+// fakeUserStore is an auth.UserStore returning canned results and recording its calls.
+type fakeUserStore struct {
+	user *auth.User
+	key  *auth.APIKeyResponse
+	err  error
+
+	calls []string
+}
+
+var _ auth.UserStore = (*fakeUserStore)(nil)
+
+func (s *fakeUserStore) Create(_ context.Context, user auth.NewUser) (int, error) {
+	s.calls = append(s.calls, "Create "+user.Username)
+	if s.err != nil {
+		return 0, s.err
+	}
+	return s.user.ID, nil
+}
+
+func (s *fakeUserStore) CreateWithAPIKey(_ context.Context, user auth.NewUser, keyName string) (int, *auth.APIKeyResponse, error) {
+	s.calls = append(s.calls, "CreateWithAPIKey "+user.Username+" "+keyName)
+	if s.err != nil {
+		return 0, nil, s.err
+	}
+	return s.user.ID, s.key, nil
+}
+
+func (s *fakeUserStore) Authenticate(_ context.Context, username, _ string) (*auth.User, error) {
+	s.calls = append(s.calls, "Authenticate "+username)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.user, nil
+}
+
+func (s *fakeUserStore) SetRole(context.Context, int, string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (s *fakeUserStore) ChangePassword(context.Context, int, string, string) error {
+	return errors.New("not implemented")
+}
+
+// newAuthRouter routes registration and login to the store, with real tokens and lockouts.
+func newAuthRouter(t *testing.T, store auth.UserStore) *gin.Engine {
+	t.Helper()
+	db := testutil.NewSQLite(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/register", handlers.Register(store))
+	router.POST("/login", handlers.Login(store, auth.NewTokenService(db, auth.TokenConfig{Secret: []byte("test")}), auth.NewLoginGuard(db, auth.LoginGuardConfig{MaxAttempts: 5})))
+	return router
+}
+
+func postJSON(t *testing.T, router *gin.Engine, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("encode body: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRegisterWithStore(t *testing.T) {
+	for name, tc := range map[string]struct {
+		store     *fakeUserStore
+		createKey bool
+		want      int
+		wantCall  string
+	}{
+		"created":          {&fakeUserStore{user: &auth.User{ID: 7}}, false, http.StatusCreated, "Create alice"},
+		"created with key": {&fakeUserStore{user: &auth.User{ID: 7}, key: &auth.APIKeyResponse{ID: 3, APIKey: "sk-test"}}, true, http.StatusCreated, "CreateWithAPIKey alice Default"},
+		"taken":            {&fakeUserStore{err: auth.ErrUsernameTaken}, false, http.StatusBadRequest, "Create alice"},
+		"store failure":    {&fakeUserStore{err: errors.New("database is locked")}, false, http.StatusInternalServerError, "Create alice"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			router := newAuthRouter(t, tc.store)
+			rec := postJSON(t, router, "/register", map[string]any{"username": "alice", "password": "password123", "create_api_key": tc.createKey})
+			if rec.Code != tc.want {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+			if len(tc.store.calls) != 1 || tc.store.calls[0] != tc.wantCall {
+				t.Fatalf("store calls = %q, want %q", tc.store.calls, tc.wantCall)
+			}
+			if tc.store.key != nil && !bytes.Contains(rec.Body.Bytes(), []byte(`"api_key":"sk-test"`)) {
+				t.Fatalf("response does not return the new key: %s", rec.Body)
+			}
+		})
+	}
+}
+
+func TestLoginWithStore(t *testing.T) {
+	for name, tc := range map[string]struct {
+		store *fakeUserStore
+		want  int
+	}{
+		"authenticated":       {&fakeUserStore{user: &auth.User{ID: 7, Username: "alice", Role: auth.RoleUser, IsActive: true}}, http.StatusOK},
+		"invalid credentials": {&fakeUserStore{err: auth.ErrInvalidCredentials}, http.StatusUnauthorized},
+		"store failure":       {&fakeUserStore{err: errors.New("database is locked")}, http.StatusInternalServerError},
+	} {
+		t.Run(name, func(t *testing.T) {
+			router := newAuthRouter(t, tc.store)
+			rec := postJSON(t, router, "/login", map[string]string{"username": "alice", "password": "password123"})
+			if rec.Code != tc.want {
+				t.Fatalf("got %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+			if len(tc.store.calls) != 1 || tc.store.calls[0] != "Authenticate alice" {
+				t.Fatalf("store calls = %q, want one Authenticate", tc.store.calls)
+			}
+			if tc.want == http.StatusOK && !bytes.Contains(rec.Body.Bytes(), []byte(`"access_token"`)) {
+				t.Fatalf("login did not issue tokens: %s", rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/backup"
+)
+
+// CreateBackup takes a database snapshot now and uploads it when S3 is configured.
+func CreateBackup(service *backup.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snapshot, err := service.Run(c.Request.Context())
+		switch {
+		case errors.Is(err, backup.ErrNotConfigured):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "backups are not configured; set BACKUP_DIR"})
+			return
+		case errors.Is(err, backup.ErrInProgress):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to back up database: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to back up database"})
+			return
+		}
+
+		c.Set(middleware.AuditTargetID, snapshot.Name)
+		c.Set(middleware.AuditDetails, map[string]any{
+			"size":   snapshot.Size,
+			"s3_key": snapshot.S3Key,
+		})
+		c.JSON(http.StatusCreated, snapshot)
+	}
+}
+
+// ListBackups returns the snapshots on disk, newest first, with the backup schedule.
+func ListBackups(service *backup.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		snapshots, err := service.List()
+		switch {
+		case errors.Is(err, backup.ErrNotConfigured):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "backups are not configured; set BACKUP_DIR"})
+			return
+		case err != nil:
+			log.Printf("Failed to list backups: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list backups"})
+			return
+		}
+
+		cfg := service.Config()
+		body := gin.H{
+			"snapshots":  snapshots,
+			"retain":     cfg.Retain,
+			"s3_enabled": cfg.S3.Enabled(),
+		}
+		if cfg.Interval > 0 {
+			body["interval"] = cfg.Interval.String()
+		}
+		c.JSON(http.StatusOK, body)
+	}
+}
+
+// DownloadBackup streams a snapshot as a SQLite database file.
+func DownloadBackup(service *backup.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		path, err := service.Path(name)
+		switch {
+		case errors.Is(err, backup.ErrNotConfigured):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": "backups are not configured; set BACKUP_DIR"})
+			return
+		case errors.Is(err, backup.ErrSnapshotNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "snapshot not found"})
+			return
+		case err != nil:
+			log.Printf("Failed to open backup %s: %v", name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open backup"})
+			return
+		}
+
+		c.Set(middleware.AuditTargetID, name)
+		c.FileAttachment(path, name)
+	}
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/batch"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cache"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// GenerateBatchRequest represents a request to generate code for several queries at once
+type GenerateBatchRequest struct {
+	Queries     []string `json:"queries" binding:"required"`
+	Temperature float64  `json:"temperature"`
+	MaxTokens   int      `json:"max_tokens"`
+	// Language applies to every query; it defaults to the saved response_language.
+	Language string `json:"language"`
+	// Async returns a queued job immediately; poll GET /api/v1/rag/generate/batch/:id for progress.
+	Async bool `json:"async"`
+}
+
+// GenerateBatch runs the generation pipeline for every query of the request on a bounded
+// worker pool. Synchronous batches return all results; async batches return a job to poll.
+func GenerateBatch(db *sql.DB, services *ServiceRegistry, manager *batch.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req GenerateBatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request: " + err.Error(),
+			})
+			return
+		}
+
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		selection, language, ok := applyUserSettings(c, db, "", req.Language, &req.Temperature, &req.MaxTokens)
+		if !ok {
+			return
+		}
+		provider := selection.Provider
+		if err := codegen.ValidateModelMaxTokens(selection.Model, req.MaxTokens); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		ragService, err := services.RAG()
+		if err != nil {
+			log.Printf("Failed to initialize RAG service: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to initialize RAG service: " + err.Error(),
+			})
+			return
+		}
+
+		codegenService, err := services.requestModel(c, selection)
+		if err != nil {
+			log.Printf("Failed to initialize %s service: %v", provider, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to initialize code generation service: " + err.Error(),
+			})
+			return
+		}
+
+		generate := func(ctx context.Context, query string) (*codegen.CodeGenerationResponse, error) {
+			ctx = codegen.WithResponseLanguage(ctx, language)
+			responseCache := services.ResponseCache()
+			ragResponse, ok := responseCache.GetRetrieval(ctx, query, 5, rag.Filter{})
+			if !ok {
+				var err error
+				ragResponse, err = ragService.RetrieveContext(ctx, query, 5, rag.Filter{})
+				if err != nil {
+					return nil, err
+				}
+				responseCache.SetRetrieval(ctx, query, 5, rag.Filter{}, ragResponse)
+			}
+
+			key := cache.GenerationKey{
+				Provider:         provider,
+				Model:            selection.Model,
+				Query:            query,
+				Temperature:      req.Temperature,
+				MaxTokens:        req.MaxTokens,
+				CodeContexts:     ragResponse.CodeContexts,
+				DocContexts:      ragResponse.DocsContexts,
+				ResponseLanguage: language,
+			}
+			var response *codegen.CodeGenerationResponse
+			if cached, ok := responseCache.GetGeneration(ctx, key); ok {
+				// Cached responses consumed no provider tokens
+				hit := *cached
+				hit.InputTokens, hit.OutputTokens = 0, 0
+				response = &hit
+			} else {
+				var err error
+				response, err = codegenService.GenerateCode(ctx, query, ragResponse.CodeContexts, ragResponse.DocsContexts, req.Temperature, req.MaxTokens)
+				if err != nil {
+					return nil, err
+				}
+				responseCache.SetGeneration(ctx, key, response)
+			}
+
+			applyGenerationWarnings(response, ragResponse)
+			attachCitations(response, ragResponse)
+			codegen.AttachProvenance(
+				response,
+				provider,
+				"",
+				ragResponse.CodeContexts,
+				ragResponse.DocsContexts,
+				codegen.ProvenanceHeaderFromEnv(),
+			)
+			return response, nil
+		}
+
+		batchReq := batch.Request{
+			UserID:      int64(userID),
+			Provider:    provider,
+			Queries:     req.Queries,
+			Temperature: req.Temperature,
+			MaxTokens:   req.MaxTokens,
+			Async:       req.Async,
+		}
+		if apiKeyID, ok := c.Get("api_key_id"); ok {
+			if id, ok := apiKeyID.(int); ok {
+				keyID := int64(id)
+				batchReq.APIKeyID = &keyID
+			}
+		}
+
+		job, err := manager.Submit(c.Request.Context(), batchReq, generate)
+		switch {
+		case errors.Is(err, batch.ErrNoQueries), errors.Is(err, batch.ErrTooManyQueries):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to run batch: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to run batch"})
+			return
+		}
+
+		if req.Async {
+			c.JSON(http.StatusAccepted, job)
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// GetBatchJob returns a batch job with its progress and per-query results
+func GetBatchJob(manager *batch.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, ok := loadOwnBatchJob(c, manager)
+		if !ok {
+			return
+		}
+
+		items, err := manager.Repository().Items(c.Request.Context(), job.ID)
+		if err != nil {
+			log.Printf("Failed to fetch items of batch job %d: %v", job.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch batch job"})
+			return
+		}
+		job.Items = items
+
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// CancelBatchJob cancels a queued or running batch job. Results already generated are kept.
+func CancelBatchJob(manager *batch.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, ok := loadOwnBatchJob(c, manager)
+		if !ok {
+			return
+		}
+
+		job, err := manager.Cancel(c.Request.Context(), job.ID)
+		switch {
+		case errors.Is(err, batch.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "batch job not found"})
+			return
+		case errors.Is(err, batch.ErrJobFinished):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+				"job":   job,
+			})
+			return
+		case err != nil:
+			log.Printf("Failed to cancel batch job: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel batch job"})
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// loadOwnBatchJob fetches the job named in the path, responding 404 when it does not belong
+// to the authenticated user.
+func loadOwnBatchJob(c *gin.Context, manager *batch.Manager) (*batch.Job, bool) {
+	userID, ok := extractUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, false
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return nil, false
+	}
+
+	job, err := manager.Repository().Get(c.Request.Context(), id, false)
+	if err != nil && !errors.Is(err, batch.ErrNotFound) {
+		log.Printf("Failed to fetch batch job %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch batch job"})
+		return nil, false
+	}
+	if err != nil || job.UserID != int64(userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "batch job not found"})
+		return nil, false
+	}
+	return job, true
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cache"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cachewarm"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// GetCacheStats returns response cache hit and miss counts since startup.
+func GetCacheStats(services *ServiceRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, services.ResponseCache().Stats())
+	}
+}
+
+// NewCacheWarmer builds a warmer that fills the registry's response cache through the same
+// retriever the handlers use.
+func NewCacheWarmer(services *ServiceRegistry, repo *querylog.Repository, cfg cachewarm.Config) *cachewarm.Warmer {
+	return cachewarm.NewWarmer(repo, cfg, services.RAG, services.ResponseCache)
+}
+
+// retrieveWithCache retrieves contexts for the query, reusing a cached retrieval when possible.
+// It reports whether the result came from the cache.
+func (r *ServiceRegistry) retrieveWithCache(c *gin.Context, service rag.Retriever, query string, nResults int, filter rag.Filter) (*rag.RAGResponse, bool, error) {
+	responseCache := r.ResponseCache()
+	if cached, ok := responseCache.GetRetrieval(c.Request.Context(), query, nResults, filter); ok {
+		return cached, true, nil
+	}
+
+	response, err := service.RetrieveContext(c.Request.Context(), query, nResults, filter)
+	if err != nil {
+		return nil, false, err
+	}
+	responseCache.SetRetrieval(c.Request.Context(), query, nResults, filter, response)
+	return response, false, nil
+}
+
+// generateWithCache generates a response, reusing a cached generation for an identical request.
+// It reports whether the result came from the cache.
+func (r *ServiceRegistry) generateWithCache(c *gin.Context, service codegen.Service, key cache.GenerationKey) (*codegen.CodeGenerationResponse, bool, error) {
+	responseCache := r.ResponseCache()
+	// Tool-calling generations depend on the client's tools and results, so they are never cached.
+	if _, ok := codegen.ToolsFromContext(c.Request.Context()); ok {
+		responseCache = nil
+	}
+	if cached, ok := responseCache.GetGeneration(c.Request.Context(), key); ok {
+		return cached, true, nil
+	}
+
+	response, err := generateValidated(c, service, key.Query, key.CodeContexts, key.DocContexts, key.Temperature, key.MaxTokens)
+	if err != nil {
+		return nil, false, err
+	}
+	responseCache.SetGeneration(c.Request.Context(), key, response)
+	return response, false, nil
+}
+
+// generateValidated generates a response and regenerates it while its code is not valid
+// Clarity, as CODE_VALIDATION_ENABLED and CODE_VALIDATION_RETRIES allow.
+func generateValidated(c *gin.Context, service codegen.Service, query string, codeContexts, docContexts []string, temperature float64, maxTokens int) (*codegen.CodeGenerationResponse, error) {
+	return codegen.GenerateValidated(codegen.ValidationConfigFromEnv(), query, func(query string) (*codegen.CodeGenerationResponse, error) {
+		return service.GenerateCode(c.Request.Context(), query, codeContexts, docContexts, temperature, maxTokens)
+	})
+}
+
+// annotateCodeValidation records whether the code of a response that cannot be regenerated,
+// such as a streamed one, is valid Clarity.
+func annotateCodeValidation(resp *codegen.CodeGenerationResponse) {
+	if codegen.ValidationConfigFromEnv().Enabled {
+		codegen.AnnotateValidation(resp, codegen.ValidateCode(resp))
+	}
+}
+
+// setCacheStatus records how much of the request was served from the cache in the query log.
+func (r *ServiceRegistry) setCacheStatus(c *gin.Context, retrievalHit, generationHit bool) {
+	responseCache := r.ResponseCache()
+	if !responseCache.RetrievalEnabled() && !responseCache.GenerationEnabled() {
+		return
+	}
+
+	status := cache.StatusMiss
+	switch {
+	case generationHit:
+		status = cache.StatusHit
+	case retrievalHit:
+		status = cache.StatusPartial
+	}
+	c.Set(middleware.QueryLogCacheStatus, status)
+}
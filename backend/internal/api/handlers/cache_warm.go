@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cachewarm"
+)
+
+// UpdateCacheWarmRequest pauses or resumes scheduled warming and changes how many queries
+// are warmed. Omitted fields are left unchanged.
+type UpdateCacheWarmRequest struct {
+	Paused *bool `json:"paused"`
+	TopN   *int  `json:"top_n"`
+}
+
+// GetCacheWarmStatus returns the cache warmer's configuration and its most recent pass,
+// including the popular queries it warmed.
+func GetCacheWarmStatus(warmer *cachewarm.Warmer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, warmer.Status())
+	}
+}
+
+// TriggerCacheWarm starts a warming pass in the background.
+func TriggerCacheWarm(warmer *cachewarm.Warmer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := warmer.Trigger(); err != nil {
+			switch {
+			case errors.Is(err, cachewarm.ErrRunning):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			case errors.Is(err, cachewarm.ErrCacheDisabled):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"success": true,
+			"message": "Cache warm started",
+		})
+	}
+}
+
+// UpdateCacheWarm changes the cache warmer's controls.
+func UpdateCacheWarm(warmer *cachewarm.Warmer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req UpdateCacheWarmRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		if req.TopN != nil {
+			if err := warmer.SetTopN(*req.TopN); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if req.Paused != nil {
+			warmer.SetPaused(*req.Paused)
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"paused": req.Paused, "top_n": req.TopN})
+
+		c.JSON(http.StatusOK, warmer.Status())
+	}
+}
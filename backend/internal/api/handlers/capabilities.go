@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/credential"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/models"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/ratelimit"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/requestlimit"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/version"
+)
+
+// capabilitiesMaxAge is how long clients may cache the capabilities response.
+const capabilitiesMaxAge = "public, max-age=60"
+
+// ModelCapabilities describes a model callers may select.
+type ModelCapabilities struct {
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	// ContextWindow and MaxOutputTokens are zero for models the registry does not know.
+	ContextWindow     int  `json:"context_window"`
+	MaxOutputTokens   int  `json:"max_output_tokens"`
+	SupportsStreaming bool `json:"supports_streaming"`
+	SupportsTools     bool `json:"supports_tools"`
+	// Default marks the model used by requests without a "model".
+	Default    bool `json:"default"`
+	Deprecated bool `json:"deprecated"`
+}
+
+// FeatureFlags reports which optional features this deployment offers.
+type FeatureFlags struct {
+	Streaming        bool `json:"streaming"`
+	Tools            bool `json:"tools"`
+	StructuredOutput bool `json:"structured_output"`
+	// Trial is true when anonymous trial tokens can be requested.
+	Trial          bool     `json:"trial"`
+	OAuthProviders []string `json:"oauth_providers"`
+	// ProviderKeys lists the providers users can bring their own API keys for; it is empty
+	// when the server has no encryption key for them.
+	ProviderKeys []string `json:"provider_keys"`
+}
+
+// CapabilityLimits are the request limits clients should respect. Zero means unlimited.
+type CapabilityLimits struct {
+	MaxBodyBytes    int64 `json:"max_body_bytes"`
+	MaxMessages     int   `json:"max_messages"`
+	MaxMessageChars int   `json:"max_message_chars"`
+	MaxNResults     int   `json:"max_n_results"`
+	// RateLimitRequests per RateLimitWindowSeconds apply to each API key.
+	RateLimitRequests      int `json:"rate_limit_requests"`
+	RateLimitWindowSeconds int `json:"rate_limit_window_seconds"`
+}
+
+// CapabilitiesResponse describes the providers, models, features and limits of the server.
+type CapabilitiesResponse struct {
+	Version   string                 `json:"version"`
+	Providers []codegen.ProviderInfo `json:"providers"`
+	Models    []ModelCapabilities    `json:"models"`
+	Features  FeatureFlags           `json:"features"`
+	Limits    CapabilityLimits       `json:"limits"`
+}
+
+// GetCapabilities describes what the server can do
+// @Summary Server capabilities
+// @Description List the configured providers, selectable models, feature flags and request limits. No authentication is required.
+// @Tags Models
+// @Produce json
+// @Success 200 {object} CapabilitiesResponse "Server capabilities"
+// @Router /capabilities [get]
+func GetCapabilities(oauth *auth.OAuthService, trials *auth.TrialService, credentials *credential.Store, requestLimits requestlimit.Config, rateLimits ratelimit.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registry := models.Default()
+		active := codegen.DefaultModelSelection().Model
+		now := time.Now()
+
+		providers := codegen.Providers()
+		resp := CapabilitiesResponse{
+			Version:   version.Get(),
+			Providers: providers,
+			Models:    make([]ModelCapabilities, 0),
+			Features: FeatureFlags{
+				Streaming:      true,
+				Trial:          trials.Enabled(),
+				OAuthProviders: oauth.Providers(),
+				ProviderKeys:   []string{},
+			},
+			Limits: CapabilityLimits{
+				MaxBodyBytes:           requestLimits.MaxBodyBytes,
+				MaxMessages:            requestLimits.MaxMessages,
+				MaxMessageChars:        requestLimits.MaxMessageChars,
+				MaxNResults:            requestLimits.MaxNResults,
+				RateLimitRequests:      rateLimits.Requests,
+				RateLimitWindowSeconds: int(rateLimits.Window / time.Second),
+			},
+		}
+
+		if credentials.Enabled() {
+			resp.Features.ProviderKeys = credential.Providers
+		}
+
+		for _, id := range codegen.AllowedModels() {
+			m, ok := registry.Lookup(id)
+			if !ok {
+				m = models.Model{ID: id, Provider: codegen.ModelProvider(id)}
+			}
+			resp.Models = append(resp.Models, ModelCapabilities{
+				ID:                m.ID,
+				Provider:          m.Provider,
+				ContextWindow:     m.ContextWindow,
+				MaxOutputTokens:   m.MaxOutputTokens,
+				SupportsStreaming: m.SupportsStreaming,
+				SupportsTools:     m.SupportsTools,
+				Default:           m.ID == active,
+				Deprecated:        m.Deprecated(now),
+			})
+			resp.Features.Tools = resp.Features.Tools || m.SupportsTools
+		}
+		for _, provider := range providers {
+			if provider.Configured && provider.StructuredOutput {
+				resp.Features.StructuredOutput = true
+			}
+		}
+
+		c.Header("Cache-Control", capabilitiesMaxAge)
+		c.JSON(http.StatusOK, resp)
+	}
+}
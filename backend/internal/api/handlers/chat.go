@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
@@ -12,14 +14,20 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cache"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
 )
 
 // ChatMessage represents a message in the chat
 type ChatMessage struct {
 	Role    string `json:"role" binding:"required"`
-	Content string `json:"content" binding:"required"`
+	Content string `json:"content"`
+	// ToolCalls are the functions an assistant message asked the client to run.
+	ToolCalls []ChatToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID links a "tool" message to the call whose result it carries.
+	ToolCallID string `json:"tool_call_id,omitempty"`
 }
 
 // ChatCompletionRequest represents an OpenAI-compatible chat completion request
@@ -28,18 +36,37 @@ type ChatCompletionRequest struct {
 	Messages       []ChatMessage `json:"messages" binding:"required"`
 	Temperature    float64       `json:"temperature"`
 	MaxTokens      int           `json:"max_tokens"`
+	Stream         bool          `json:"stream"`
 	ConversationID *int64        `json:"conversation_id,omitempty"`
+	// PromptTemplate names a prompt template to build the prompt from; it is not part of the OpenAI API.
+	PromptTemplate string `json:"prompt_template,omitempty"`
+	// Language is the language of explanations and code comments, e.g. "Spanish"; it is not
+	// part of the OpenAI API and defaults to the caller's saved response_language.
+	Language string `json:"language,omitempty"`
+	// Filter restricts retrieval with "collection" and "repos" and ranks it by "search_mode";
+	// it is not part of the OpenAI API.
+	rag.Filter
+	// Tools are functions the model may call; tool_choice is "auto", "none", "required" or a function.
+	Tools      []ChatTool      `json:"tools,omitempty"`
+	ToolChoice json.RawMessage `json:"tool_choice,omitempty"`
 }
 
 // ChatCompletionResponse represents an OpenAI-compatible chat completion response
 type ChatCompletionResponse struct {
-	ID             string                 `json:"id"`
-	Object         string                 `json:"object"`
-	Created        int64                  `json:"created"`
-	Model          string                 `json:"model"`
-	Choices        []ChatCompletionChoice `json:"choices"`
-	Usage          ChatCompletionUsage    `json:"usage"`
-	ConversationID int64                  `json:"conversation_id,omitempty"`
+	ID             string                  `json:"id"`
+	Object         string                  `json:"object"`
+	Created        int64                   `json:"created"`
+	Model          string                  `json:"model"`
+	Choices        []ChatCompletionChoice  `json:"choices"`
+	Usage          ChatCompletionUsage     `json:"usage"`
+	ConversationID int64                   `json:"conversation_id,omitempty"`
+	Provenance     *codegen.Provenance     `json:"provenance,omitempty"`
+	Warnings       []codegen.Warning       `json:"warnings,omitempty"`
+	Citations      []codegen.Citation      `json:"citations,omitempty"`
+	Validation     *codegen.CodeValidation `json:"validation,omitempty"`
+	// HistoryTrimmed is set when the oldest turns were evicted to keep the conversation
+	// within its history limits.
+	HistoryTrimmed *conversation.TrimResult `json:"history_trimmed,omitempty"`
 }
 
 // ChatCompletionChoice represents a choice in the chat completion response
@@ -57,7 +84,7 @@ type ChatCompletionUsage struct {
 }
 
 // ChatCompletions handles OpenAI-compatible chat completion requests
-func ChatCompletions(db *sql.DB) gin.HandlerFunc {
+func ChatCompletions(db *sql.DB, services *ServiceRegistry) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req ChatCompletionRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -77,9 +104,11 @@ func ChatCompletions(db *sql.DB) gin.HandlerFunc {
 
 		// Extract the last user message as the query
 		var query string
+		lastUser := -1
 		for i := len(req.Messages) - 1; i >= 0; i-- {
 			if req.Messages[i].Role == "user" {
 				query = req.Messages[i].Content
+				lastUser = i
 				break
 			}
 		}
@@ -91,6 +120,29 @@ func ChatCompletions(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Tool calls and results after the user message continue the same answer
+		tools, err := chatToolRequest(req, lastUser)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Request = c.Request.WithContext(codegen.WithTools(c.Request.Context(), tools))
+
+		assignExperiment(c, db, req.Model, req.PromptTemplate)
+		selection, language, ok := applyUserSettings(c, db, req.Model, req.Language, &req.Temperature, &req.MaxTokens)
+		if !ok {
+			return
+		}
+		if !validateRetrievalFilter(c, req.Filter) {
+			return
+		}
+		promptTemplate, ok := usePromptTemplate(c, db, req.PromptTemplate)
+		if !ok {
+			return
+		}
+
 		userID, ok := extractUserID(c)
 		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -116,10 +168,19 @@ func ChatCompletions(db *sql.DB) gin.HandlerFunc {
 		}
 
 		convo.NewMessage = query
-		conversationAwareQuery := buildConversationAwareQuery(convo, query)
+
+		provider := selection.Provider
+		if err := codegen.ValidateModelMaxTokens(selection.Model, req.MaxTokens); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Set(middleware.QueryLogModelProvider, provider)
+		c.Set(middleware.QueryLogModel, selection.Model)
 
 		// Get services
-		ragService, err := getRAGService()
+		ragService, err := services.RAG()
 		if err != nil {
 			log.Printf("Failed to initialize RAG service: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -127,9 +188,21 @@ func ChatCompletions(db *sql.DB) gin.HandlerFunc {
 			})
 			return
 		}
+		codegenService, err := services.requestModel(c, selection)
+		if err != nil {
+			log.Printf("Failed to initialize %s service: %v", provider, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to initialize code generation service: " + err.Error(),
+			})
+			return
+		}
 
-		// Step 1: Retrieve context from ChromaDB
-		ragResponse, err := ragService.RetrieveContext(c.Request.Context(), query, 5)
+		summarizeConversation(c, convo, codegenService)
+		conversationAwareQuery := buildConversationAwareQuery(convo, query)
+
+		// Step 1: Retrieve context from ChromaDB, resolving follow-ups against the history
+		retrievalQuery := services.rewriteRetrievalQuery(c, convo, query, codegenService)
+		ragResponse, retrievalHit, err := services.retrieveWithCache(c, ragService, retrievalQuery, 5, req.Filter)
 		if err != nil {
 			log.Printf("Failed to retrieve context: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -137,13 +210,184 @@ func ChatCompletions(db *sql.DB) gin.HandlerFunc {
 			})
 			return
 		}
+		ragResponse = withContractTemplate(c, db, retrievalQuery, req.Filter, ragResponse)
+		c.Set(middleware.QueryLogRAGContextsCount, len(ragResponse.CodeContexts)+len(ragResponse.DocsContexts))
+
+		if req.Stream {
+			services.setCacheStatus(c, retrievalHit, false)
+			services.streamChatCompletion(c, req, repo, convo, query, conversationAwareQuery, ragResponse, selection, promptTemplate, codegenService)
+			return
+		}
+
+		// Step 2: Generate response using configured provider with context
+		codeGenResponse, generationHit, err := services.generateWithCache(c, codegenService, cache.GenerationKey{
+			Provider:         provider,
+			Model:            selection.Model,
+			Query:            conversationAwareQuery,
+			Temperature:      req.Temperature,
+			MaxTokens:        req.MaxTokens,
+			CodeContexts:     ragResponse.CodeContexts,
+			DocContexts:      ragResponse.DocsContexts,
+			PromptTemplate:   promptTemplate,
+			ResponseLanguage: language,
+		})
+		services.setCacheStatus(c, retrievalHit, generationHit)
+		if err != nil {
+			var interrupted *codegen.InterruptedError
+			if errors.As(err, &interrupted) {
+				convo.AddTurn("user", query)
+				respondInterruptedChat(c, repo, convo, selection.Model, interrupted)
+				return
+			}
+			respondGenerationError(c, err, "Failed to generate response")
+			return
+		}
+
+		applyGenerationWarnings(codeGenResponse, ragResponse)
+		attachCitations(codeGenResponse, ragResponse)
+		codegen.AttachProvenance(
+			codeGenResponse,
+			provider,
+			promptTemplate,
+			ragResponse.CodeContexts,
+			ragResponse.DocsContexts,
+			codegen.ProvenanceHeaderFromEnv(),
+		)
+
+		// Step 3: Format response in OpenAI format
+		assistantMessage := formatAssistantMessage(codeGenResponse)
+
+		// The turn is recorded once the tool loop ends with an answer
+		if len(codeGenResponse.ToolCalls) == 0 {
+			convo.AddTurn("user", query)
+			convo.AddAssistantTurn(assistantMessage, conversationCitations(codeGenResponse.Citations))
+		}
+
+		// Use real token counts from codegen response; cached responses consumed none
+		if !generationHit {
+			c.Set(middleware.QueryLogInputTokens, codeGenResponse.InputTokens)
+			c.Set(middleware.QueryLogOutputTokens, codeGenResponse.OutputTokens)
+		}
+
+		// Create OpenAI-compatible response
+		response := newChatCompletionResponse(selection.Model, assistantMessage, chatFinishReason(codeGenResponse), codeGenResponse)
+		response.HistoryTrimmed = trimConversation(c.Request.Context(), convo, codegenService)
+
+		if err := repo.Save(c.Request.Context(), convo); err != nil {
+			if errors.Is(err, conversation.ErrVersionConflict) {
+				respondConversationConflict(c, repo, convo)
+				return
+			}
+			log.Printf("Failed to persist conversation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to persist conversation",
+			})
+			return
+		}
+
+		response.ConversationID = convo.ID
+		c.Set(middleware.QueryLogConversationID, convo.ID)
+		services.generateConversationTitle(c, repo, convo, codegenService)
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// ContinueCompletionRequest resumes an interrupted answer in a conversation.
+type ContinueCompletionRequest struct {
+	Model          string  `json:"model"`
+	ConversationID int64   `json:"conversation_id" binding:"required"`
+	Temperature    float64 `json:"temperature"`
+	MaxTokens      int     `json:"max_tokens"`
+	// Language should match the interrupted answer's; it defaults to the saved response_language.
+	Language string `json:"language"`
+	rag.Filter
+}
 
-		ragContextsCount := len(ragResponse.CodeContexts) + len(ragResponse.DocsContexts)
+// statusClientClosedRequest is reported when the client went away mid-generation.
+const statusClientClosedRequest = 499
+
+// ContinueChatCompletion resumes the interrupted final answer of a conversation from its partial text.
+func ContinueChatCompletion(db *sql.DB, services *ServiceRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ContinueCompletionRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request: " + err.Error(),
+			})
+			return
+		}
+
+		selection, _, ok := applyUserSettings(c, db, req.Model, req.Language, &req.Temperature, &req.MaxTokens)
+		if !ok {
+			return
+		}
+		if !validateRetrievalFilter(c, req.Filter) {
+			return
+		}
 
-		provider := codegen.ProviderFromEnv()
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Unable to resolve authenticated user",
+			})
+			return
+		}
+
+		repo := conversation.NewRepository(db)
+		convo, err := repo.Get(c.Request.Context(), req.ConversationID, userID)
+		if err != nil {
+			if errors.Is(err, conversation.ErrConversationNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Conversation not found",
+				})
+				return
+			}
+			log.Printf("Failed to load conversation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to load conversation",
+			})
+			return
+		}
+		c.Set(middleware.QueryLogConversationID, convo.ID)
+
+		turnIndex, query, ok := convo.InterruptedTurn()
+		if !ok {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Conversation has no interrupted response to continue",
+			})
+			return
+		}
+		// The message is moderated again, since rules may have changed since it was sent.
+		if !middleware.ModeratePrompt(c, query) {
+			return
+		}
+		partial := convo.History[turnIndex].Content
+
+		// Rebuild the prompt the interrupted answer was generated from.
+		prior := convo.Prefix(turnIndex - 1)
+		continuationQuery := codegen.ContinuationQuery(buildConversationAwareQuery(prior, query), partial)
+
+		ragService, err := services.RAG()
+		if err != nil {
+			log.Printf("Failed to initialize RAG service: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to initialize RAG service: " + err.Error(),
+			})
+			return
+		}
+
+		provider := selection.Provider
+		if err := codegen.ValidateModelMaxTokens(selection.Model, req.MaxTokens); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		c.Set(middleware.QueryLogModelProvider, provider)
-		c.Set(middleware.QueryLogRAGContextsCount, ragContextsCount)
-		codegenService, err := getCodegenService(provider)
+		c.Set(middleware.QueryLogModel, selection.Model)
+
+		codegenService, err := services.requestModel(c, selection)
 		if err != nil {
 			log.Printf("Failed to initialize %s service: %v", provider, err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -152,60 +396,64 @@ func ChatCompletions(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Step 2: Generate response using configured provider with context
-		codeGenResponse, err := codegenService.GenerateCode(
+		retrievalQuery := services.rewriteRetrievalQuery(c, prior, query, codegenService)
+		ragResponse, retrievalHit, err := services.retrieveWithCache(c, ragService, retrievalQuery, 5, req.Filter)
+		if err != nil {
+			log.Printf("Failed to retrieve context: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to retrieve context: " + err.Error(),
+			})
+			return
+		}
+		ragResponse = withContractTemplate(c, db, retrievalQuery, req.Filter, ragResponse)
+		c.Set(middleware.QueryLogRAGContextsCount, len(ragResponse.CodeContexts)+len(ragResponse.DocsContexts))
+		services.setCacheStatus(c, retrievalHit, false)
+
+		continuation, err := codegenService.GenerateCode(
 			c.Request.Context(),
-			conversationAwareQuery,
+			continuationQuery,
 			ragResponse.CodeContexts,
 			ragResponse.DocsContexts,
 			req.Temperature,
 			req.MaxTokens,
 		)
 		if err != nil {
-			log.Printf("Failed to generate response: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to generate response: " + err.Error(),
-			})
+			var interrupted *codegen.InterruptedError
+			if errors.As(err, &interrupted) {
+				// Keep whatever the continuation produced and stay resumable.
+				convo.History = convo.History[:turnIndex]
+				interrupted.Partial = partial + interrupted.Partial
+				respondInterruptedChat(c, repo, convo, selection.Model, interrupted)
+				return
+			}
+			respondGenerationError(c, err, "Failed to continue response")
 			return
 		}
 
-		// Step 3: Format response in OpenAI format
-		assistantMessage := codeGenResponse.Explanation
-		if codeGenResponse.Code != "" {
-			assistantMessage = codeGenResponse.Explanation + "\n\n```clarity\n" + codeGenResponse.Code + "\n```"
-		}
-
-		convo.AddTurn("user", query)
-		convo.AddTurn("assistant", assistantMessage)
+		merged := codegen.MergeContinuation(partial, continuation)
+		annotateCodeValidation(merged)
+		applyGenerationWarnings(merged, ragResponse)
+		attachCitations(merged, ragResponse)
+		codegen.AttachProvenance(
+			merged,
+			provider,
+			"",
+			ragResponse.CodeContexts,
+			ragResponse.DocsContexts,
+			codegen.ProvenanceHeaderFromEnv(),
+		)
 
-		// Use real token counts from codegen response
-		c.Set(middleware.QueryLogInputTokens, codeGenResponse.InputTokens)
-		c.Set(middleware.QueryLogOutputTokens, codeGenResponse.OutputTokens)
+		assistantMessage := formatAssistantMessage(merged)
+		convo.History[turnIndex] = conversation.Turn{Role: "assistant", Content: assistantMessage, Citations: conversationCitations(merged.Citations)}
 
-		// Create OpenAI-compatible response
-		response := ChatCompletionResponse{
-			ID:      "chatcmpl-" + uuid.New().String(),
-			Object:  "chat.completion",
-			Created: time.Now().Unix(),
-			Model:   resolveModel(req.Model, provider),
-			Choices: []ChatCompletionChoice{
-				{
-					Index: 0,
-					Message: ChatMessage{
-						Role:    "assistant",
-						Content: assistantMessage,
-					},
-					FinishReason: "stop",
-				},
-			},
-			Usage: ChatCompletionUsage{
-				PromptTokens:     codeGenResponse.InputTokens,
-				CompletionTokens: codeGenResponse.OutputTokens,
-				TotalTokens:      codeGenResponse.InputTokens + codeGenResponse.OutputTokens,
-			},
-		}
+		c.Set(middleware.QueryLogInputTokens, merged.InputTokens)
+		c.Set(middleware.QueryLogOutputTokens, merged.OutputTokens)
 
 		if err := repo.Save(c.Request.Context(), convo); err != nil {
+			if errors.Is(err, conversation.ErrVersionConflict) {
+				respondConversationConflict(c, repo, convo)
+				return
+			}
 			log.Printf("Failed to persist conversation: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "Failed to persist conversation",
@@ -213,13 +461,108 @@ func ChatCompletions(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
+		response := newChatCompletionResponse(selection.Model, assistantMessage, "stop", merged)
 		response.ConversationID = convo.ID
-		c.Set(middleware.QueryLogConversationID, convo.ID)
 
 		c.JSON(http.StatusOK, response)
 	}
 }
 
+// respondInterruptedChat persists the partial answer of a cancelled generation and reports
+// it with an "interrupted" finish reason.
+func respondInterruptedChat(c *gin.Context, repo *conversation.Repository, convo *conversation.Conversation, model string, interrupted *codegen.InterruptedError) {
+	if err := persistInterruptedChat(c, repo, convo, interrupted); err != nil {
+		if errors.Is(err, conversation.ErrVersionConflict) {
+			respondConversationConflict(c, repo, convo)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to persist conversation",
+		})
+		return
+	}
+
+	response := newChatCompletionResponse(model, interrupted.Partial, "interrupted", interrupted.Response())
+	response.ConversationID = convo.ID
+
+	c.JSON(statusClientClosedRequest, response)
+}
+
+// persistInterruptedChat saves the partial answer so it can be resumed via
+// /v1/chat/completions/continue, and flags the query log entry as interrupted.
+func persistInterruptedChat(c *gin.Context, repo *conversation.Repository, convo *conversation.Conversation, interrupted *codegen.InterruptedError) error {
+	log.Printf("Generation interrupted after %d characters: %v", len(interrupted.Partial), interrupted.Err)
+
+	convo.AddInterruptedTurn(interrupted.Partial)
+
+	// The request context is already cancelled, so persist on a detached one.
+	if err := repo.Save(context.WithoutCancel(c.Request.Context()), convo); err != nil {
+		log.Printf("Failed to persist interrupted conversation: %v", err)
+		return err
+	}
+
+	c.Set(middleware.QueryLogConversationID, convo.ID)
+	c.Set(middleware.QueryLogInterrupted, true)
+	c.Set(middleware.QueryLogErrorMessage, interrupted.Error())
+	return nil
+}
+
+func formatAssistantMessage(resp *codegen.CodeGenerationResponse) string {
+	if resp.Code == "" {
+		return resp.Explanation
+	}
+	return resp.Explanation + "\n\n```" + codegen.FenceLanguage(resp) + "\n" + resp.Code + "\n```"
+}
+
+// conversationCitations converts a response's citations for storage with its turn.
+func conversationCitations(citations []codegen.Citation) []conversation.Citation {
+	if len(citations) == 0 {
+		return nil
+	}
+	stored := make([]conversation.Citation, len(citations))
+	for i, citation := range citations {
+		stored[i] = conversation.Citation{
+			Collection: citation.Collection,
+			Repo:       citation.Repo,
+			FilePath:   citation.FilePath,
+			URL:        citation.URL,
+			Contract:   citation.Contract,
+			Function:   citation.Function,
+			Similarity: citation.Similarity,
+		}
+	}
+	return stored
+}
+
+func newChatCompletionResponse(model, content, finishReason string, resp *codegen.CodeGenerationResponse) ChatCompletionResponse {
+	return ChatCompletionResponse{
+		ID:      "chatcmpl-" + uuid.New().String(),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []ChatCompletionChoice{
+			{
+				Index: 0,
+				Message: ChatMessage{
+					Role:      "assistant",
+					Content:   content,
+					ToolCalls: chatToolCalls(resp.ToolCalls),
+				},
+				FinishReason: finishReason,
+			},
+		},
+		Usage: ChatCompletionUsage{
+			PromptTokens:     resp.InputTokens,
+			CompletionTokens: resp.OutputTokens,
+			TotalTokens:      resp.InputTokens + resp.OutputTokens,
+		},
+		Provenance: resp.Provenance,
+		Warnings:   resp.Warnings,
+		Citations:  resp.Citations,
+		Validation: resp.Validation,
+	}
+}
+
 func extractUserID(c *gin.Context) (int, bool) {
 	value, exists := c.Get("user_id")
 	if !exists {
@@ -252,6 +595,118 @@ func loadConversation(c *gin.Context, repo *conversation.Repository, idPtr *int6
 	return convo, nil
 }
 
+// summarizeConversation folds older turns into the conversation summary once the history
+// outgrows its token budget. Failures are logged and the full history is used instead.
+func summarizeConversation(c *gin.Context, convo *conversation.Conversation, service codegen.Service) {
+	summarizer, ok := service.(codegen.Summarizer)
+	if !ok {
+		return
+	}
+	if _, err := convo.Summarize(c.Request.Context(), conversation.SummaryConfigFromEnv(), codegen.CountTokens, summarizer.Summarize); err != nil {
+		log.Printf("Failed to summarize conversation %d: %v", convo.ID, err)
+	}
+}
+
+// trimConversation evicts the oldest turns once the conversation outgrows its history
+// limits, folding them into the summary first when configured. A failed summary is logged
+// and the turns are dropped anyway. It returns nil when nothing was evicted.
+func trimConversation(ctx context.Context, convo *conversation.Conversation, service codegen.Service) *conversation.TrimResult {
+	cfg := conversation.LimitConfigFromEnv()
+	var summarized bool
+	if summarizer, ok := service.(codegen.Summarizer); ok {
+		var err error
+		if summarized, err = convo.SummarizeEvicted(ctx, cfg, summarizer.Summarize); err != nil {
+			log.Printf("Failed to summarize trimmed turns of conversation %d: %v", convo.ID, err)
+		}
+	}
+	n := convo.Trim(cfg)
+	if n == 0 {
+		return nil
+	}
+	return &conversation.TrimResult{Turns: n, Summarized: summarized, TotalTurns: convo.TrimmedTurns}
+}
+
+// rewriteRetrievalQuery condenses the conversation history and the current message into a
+// standalone retrieval query, so follow-ups like "make it pausable" find relevant context.
+// Without history, when rewriting is disabled, or when the rewrite fails, the message is
+// retrieved with as is.
+func (r *ServiceRegistry) rewriteRetrievalQuery(c *gin.Context, convo *conversation.Conversation, query string, service codegen.Service) string {
+	cfg := codegen.RewriteConfigFromEnv()
+	history := strings.TrimSpace(convo.BuildHistoryPrompt())
+	if !cfg.Enabled || history == "" {
+		return query
+	}
+
+	if cfg.Model != "" {
+		if provider := codegen.ModelProvider(cfg.Model); provider == "" {
+			log.Printf("No provider serves query rewrite model %s", cfg.Model)
+		} else if rewriteService, err := r.Model(codegen.ModelSelection{Provider: provider, Model: cfg.Model}); err != nil {
+			log.Printf("Failed to initialize query rewrite model %s: %v", cfg.Model, err)
+		} else {
+			service = rewriteService
+		}
+	}
+	rewriter, ok := service.(codegen.QueryRewriter)
+	if !ok {
+		return query
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.Timeout)
+	defer cancel()
+	rewritten, err := rewriter.RewriteQuery(ctx, history, query)
+	if err != nil {
+		log.Printf("Failed to rewrite retrieval query for conversation %d: %v", convo.ID, err)
+		return query
+	}
+	if rewritten == "" {
+		return query
+	}
+	return rewritten
+}
+
+// generateConversationTitle names the conversation in the background once its first
+// exchange is saved, replacing the title taken from the first user message. Failures are
+// logged and that title is kept.
+func (r *ServiceRegistry) generateConversationTitle(c *gin.Context, repo *conversation.Repository, convo *conversation.Conversation, service codegen.Service) {
+	cfg := codegen.TitleConfigFromEnv()
+	if !cfg.Enabled || !convo.NeedsGeneratedTitle() {
+		return
+	}
+
+	if cfg.Model != "" {
+		if provider := codegen.ModelProvider(cfg.Model); provider == "" {
+			log.Printf("No provider serves conversation title model %s", cfg.Model)
+		} else if titleService, err := r.Model(codegen.ModelSelection{Provider: provider, Model: cfg.Model}); err != nil {
+			log.Printf("Failed to initialize conversation title model %s: %v", cfg.Model, err)
+		} else {
+			service = titleService
+		}
+	}
+	generator, ok := service.(codegen.TitleGenerator)
+	if !ok {
+		return
+	}
+
+	// The response is sent before the title is ready, so generate it on a detached context.
+	ctx := context.WithoutCancel(c.Request.Context())
+	id, message := convo.ID, convo.History[0].Content
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+		title, err := generator.GenerateTitle(ctx, message)
+		if err != nil {
+			log.Printf("Failed to generate title for conversation %d: %v", id, err)
+			return
+		}
+		if title == "" {
+			return
+		}
+		if _, err := repo.SetGeneratedTitle(ctx, id, title); err != nil {
+			log.Printf("Failed to store title for conversation %d: %v", id, err)
+		}
+	}()
+}
+
 func buildConversationAwareQuery(convo *conversation.Conversation, query string) string {
 	history := strings.TrimSpace(convo.BuildHistoryPrompt())
 	if history == "" {
@@ -265,17 +720,15 @@ func buildConversationAwareQuery(convo *conversation.Conversation, query string)
 	return builder.String()
 }
 
-func resolveModel(requested string, provider string) string {
-	if strings.TrimSpace(requested) != "" {
-		return requested
-	}
-
-	switch provider {
-	case codegen.ProviderOpenAI:
-		return "openai"
-	case codegen.ProviderClaude:
-		return "claude"
-	default:
-		return "gemini"
+// selectRequestModel resolves the model a request asked for, answering 400 when it is not
+// on the allowlist.
+func selectRequestModel(c *gin.Context, requested string) (codegen.ModelSelection, bool) {
+	selection, err := codegen.SelectModel(requested)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error() + "; see GET /v1/models for available models",
+		})
+		return codegen.ModelSelection{}, false
 	}
+	return selection, true
 }
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// RegenerateRequest re-runs the last user turn of a conversation. Omitted settings fall back
+// to the caller's saved settings, as in chat completions.
+type RegenerateRequest struct {
+	Model string `json:"model"`
+	// Provider selects a provider's configured model when model is omitted.
+	Provider       string  `json:"provider"`
+	Temperature    float64 `json:"temperature"`
+	MaxTokens      int     `json:"max_tokens"`
+	PromptTemplate string  `json:"prompt_template"`
+	Language       string  `json:"language"`
+	rag.Filter
+}
+
+// RegenerateConversation answers the last user turn of a conversation again
+// @Summary Regenerate last answer
+// @Description Re-run the last user message of a conversation, optionally with another model, provider or temperature, and replace its answer. Earlier turns are kept. The response cache is bypassed.
+// @Tags Conversations
+// @Accept json
+// @Produce json
+// @Security BasicAuth
+// @Param id path int true "Conversation ID"
+// @Param request body RegenerateRequest false "Generation settings"
+// @Success 200 {object} ChatCompletionResponse
+// @Failure 400 {object} map[string]interface{} "Invalid id or settings"
+// @Failure 404 {object} map[string]interface{} "Conversation not found"
+// @Failure 409 {object} map[string]interface{} "No user message, or the conversation changed meanwhile"
+// @Router /conversations/{id}/regenerate [post]
+func RegenerateConversation(db *sql.DB, services *ServiceRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		var req RegenerateRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request: " + err.Error(),
+			})
+			return
+		}
+		requestedModel := req.Model
+		if requestedModel == "" {
+			requestedModel = req.Provider
+		}
+
+		selection, _, ok := applyUserSettings(c, db, requestedModel, req.Language, &req.Temperature, &req.MaxTokens)
+		if !ok {
+			return
+		}
+		if !validateRetrievalFilter(c, req.Filter) {
+			return
+		}
+		promptTemplate, ok := usePromptTemplate(c, db, req.PromptTemplate)
+		if !ok {
+			return
+		}
+
+		repo := conversation.NewRepository(db)
+		convo, err := repo.Get(c.Request.Context(), id, userID)
+		if err != nil {
+			if errors.Is(err, conversation.ErrConversationNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{
+					"error": "Conversation not found",
+				})
+				return
+			}
+			log.Printf("Failed to load conversation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to load conversation",
+			})
+			return
+		}
+		c.Set(middleware.QueryLogConversationID, convo.ID)
+
+		turnIndex, ok := convo.LastUserTurn()
+		if !ok {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Conversation has no user message to regenerate",
+			})
+			return
+		}
+		query := convo.History[turnIndex].Content
+		// The message is moderated again, since rules may have changed since it was sent.
+		if !middleware.ModeratePrompt(c, query) {
+			return
+		}
+
+		// Rebuild the prompt from the turns before the message, as when it was first answered.
+		prior := convo.Prefix(turnIndex)
+		conversationAwareQuery := buildConversationAwareQuery(prior, query)
+
+		// Drop the answer being replaced, along with a summary that covers it.
+		convo.History = convo.History[:turnIndex+1]
+		convo.Summary, convo.SummarizedTurns = prior.Summary, prior.SummarizedTurns
+
+		provider := selection.Provider
+		if err := codegen.ValidateModelMaxTokens(selection.Model, req.MaxTokens); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Set(middleware.QueryLogModelProvider, provider)
+		c.Set(middleware.QueryLogModel, selection.Model)
+
+		ragService, err := services.RAG()
+		if err != nil {
+			log.Printf("Failed to initialize RAG service: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to initialize RAG service: " + err.Error(),
+			})
+			return
+		}
+		codegenService, err := services.requestModel(c, selection)
+		if err != nil {
+			log.Printf("Failed to initialize %s service: %v", provider, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to initialize code generation service: " + err.Error(),
+			})
+			return
+		}
+
+		retrievalQuery := services.rewriteRetrievalQuery(c, prior, query, codegenService)
+		ragResponse, retrievalHit, err := services.retrieveWithCache(c, ragService, retrievalQuery, 5, req.Filter)
+		if err != nil {
+			log.Printf("Failed to retrieve context: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to retrieve context: " + err.Error(),
+			})
+			return
+		}
+		ragResponse = withContractTemplate(c, db, retrievalQuery, req.Filter, ragResponse)
+		c.Set(middleware.QueryLogRAGContextsCount, len(ragResponse.CodeContexts)+len(ragResponse.DocsContexts))
+		services.setCacheStatus(c, retrievalHit, false)
+
+		// A cached generation would return the answer being replaced, so always generate.
+		codeGenResponse, err := generateValidated(
+			c,
+			codegenService,
+			conversationAwareQuery,
+			ragResponse.CodeContexts,
+			ragResponse.DocsContexts,
+			req.Temperature,
+			req.MaxTokens,
+		)
+		if err != nil {
+			var interrupted *codegen.InterruptedError
+			if errors.As(err, &interrupted) {
+				respondInterruptedChat(c, repo, convo, selection.Model, interrupted)
+				return
+			}
+			respondGenerationError(c, err, "Failed to regenerate response")
+			return
+		}
+
+		applyGenerationWarnings(codeGenResponse, ragResponse)
+		attachCitations(codeGenResponse, ragResponse)
+		codegen.AttachProvenance(
+			codeGenResponse,
+			provider,
+			promptTemplate,
+			ragResponse.CodeContexts,
+			ragResponse.DocsContexts,
+			codegen.ProvenanceHeaderFromEnv(),
+		)
+
+		assistantMessage := formatAssistantMessage(codeGenResponse)
+		convo.AddAssistantTurn(assistantMessage, conversationCitations(codeGenResponse.Citations))
+
+		c.Set(middleware.QueryLogInputTokens, codeGenResponse.InputTokens)
+		c.Set(middleware.QueryLogOutputTokens, codeGenResponse.OutputTokens)
+
+		response := newChatCompletionResponse(selection.Model, assistantMessage, chatFinishReason(codeGenResponse), codeGenResponse)
+		response.HistoryTrimmed = trimConversation(c.Request.Context(), convo, codegenService)
+
+		if err := repo.Save(c.Request.Context(), convo); err != nil {
+			if errors.Is(err, conversation.ErrVersionConflict) {
+				respondConversationConflict(c, repo, convo)
+				return
+			}
+			log.Printf("Failed to persist conversation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to persist conversation",
+			})
+			return
+		}
+
+		response.ConversationID = convo.ID
+		services.generateConversationTitle(c, repo, convo, codegenService)
+
+		c.JSON(http.StatusOK, response)
+	}
+}
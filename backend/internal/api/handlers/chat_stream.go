@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// ChatCompletionChunk is an OpenAI-compatible streamed chat completion event.
+type ChatCompletionChunk struct {
+	ID             string                      `json:"id"`
+	Object         string                      `json:"object"`
+	Created        int64                       `json:"created"`
+	Model          string                      `json:"model"`
+	Choices        []ChatCompletionChunkChoice `json:"choices"`
+	Usage          *ChatCompletionUsage        `json:"usage,omitempty"`
+	ConversationID int64                       `json:"conversation_id,omitempty"`
+	Provenance     *codegen.Provenance         `json:"provenance,omitempty"`
+	Warnings       []codegen.Warning           `json:"warnings,omitempty"`
+	Citations      []codegen.Citation          `json:"citations,omitempty"`
+	Validation     *codegen.CodeValidation     `json:"validation,omitempty"`
+	HistoryTrimmed *conversation.TrimResult    `json:"history_trimmed,omitempty"`
+}
+
+// ChatCompletionChunkChoice carries the delta for a single choice.
+type ChatCompletionChunkChoice struct {
+	Index        int                 `json:"index"`
+	Delta        ChatCompletionDelta `json:"delta"`
+	FinishReason *string             `json:"finish_reason"`
+}
+
+// ChatCompletionDelta is the incremental message content of a chunk.
+type ChatCompletionDelta struct {
+	Role      string              `json:"role,omitempty"`
+	Content   string              `json:"content,omitempty"`
+	ToolCalls []ChatToolCallDelta `json:"tool_calls,omitempty"`
+}
+
+// ChatToolCallDelta is a tool call in a streamed delta, positioned by its index in the message.
+type ChatToolCallDelta struct {
+	Index int `json:"index"`
+	ChatToolCall
+}
+
+// chatStream writes chat.completion.chunk events as Server-Sent Events. Headers are sent
+// lazily so failures before the first delta can still be reported as a normal JSON error.
+type chatStream struct {
+	c       *gin.Context
+	id      string
+	model   string
+	created int64
+	started bool
+	// trimmed is reported in the final chunk.
+	trimmed *conversation.TrimResult
+}
+
+func newChatStream(c *gin.Context, model string) *chatStream {
+	return &chatStream{
+		c:       c,
+		id:      "chatcmpl-" + uuid.New().String(),
+		model:   model,
+		created: time.Now().Unix(),
+	}
+}
+
+func (s *chatStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+
+	header := s.c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	s.c.Status(http.StatusOK)
+
+	s.write(s.chunk(ChatCompletionDelta{Role: "assistant"}, nil))
+}
+
+func (s *chatStream) delta(content string) {
+	s.start()
+	s.write(s.chunk(ChatCompletionDelta{Content: content}, nil))
+}
+
+func (s *chatStream) chunk(delta ChatCompletionDelta, finishReason *string) ChatCompletionChunk {
+	return ChatCompletionChunk{
+		ID:      s.id,
+		Object:  "chat.completion.chunk",
+		Created: s.created,
+		Model:   s.model,
+		Choices: []ChatCompletionChunkChoice{
+			{Index: 0, Delta: delta, FinishReason: finishReason},
+		},
+	}
+}
+
+// finish sends any tool calls, then the final chunk with the finish reason and response
+// metadata, then [DONE]. Tool calls arrive whole from providers, so each is sent in one delta.
+func (s *chatStream) finish(finishReason string, resp *codegen.CodeGenerationResponse, conversationID int64) {
+	s.start()
+
+	if resp != nil && len(resp.ToolCalls) > 0 {
+		var calls []ChatToolCallDelta
+		for i, call := range chatToolCalls(resp.ToolCalls) {
+			calls = append(calls, ChatToolCallDelta{Index: i, ChatToolCall: call})
+		}
+		s.write(s.chunk(ChatCompletionDelta{ToolCalls: calls}, nil))
+	}
+
+	final := s.chunk(ChatCompletionDelta{}, &finishReason)
+	final.ConversationID = conversationID
+	if resp != nil {
+		final.Usage = &ChatCompletionUsage{
+			PromptTokens:     resp.InputTokens,
+			CompletionTokens: resp.OutputTokens,
+			TotalTokens:      resp.InputTokens + resp.OutputTokens,
+		}
+		final.Provenance = resp.Provenance
+		final.Warnings = resp.Warnings
+		final.Citations = resp.Citations
+		final.Validation = resp.Validation
+	}
+	final.HistoryTrimmed = s.trimmed
+	s.write(final)
+	s.done()
+}
+
+// fail reports an error after streaming has begun.
+func (s *chatStream) fail(message string) {
+	s.write(gin.H{"error": gin.H{"message": message, "type": "server_error"}})
+	s.done()
+}
+
+func (s *chatStream) write(event any) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode stream event: %v", err)
+		return
+	}
+	fmt.Fprintf(s.c.Writer, "data: %s\n\n", payload)
+	s.c.Writer.Flush()
+}
+
+func (s *chatStream) done() {
+	fmt.Fprint(s.c.Writer, "data: [DONE]\n\n")
+	s.c.Writer.Flush()
+}
+
+// streamChatCompletion generates the answer for a stream:true request, forwarding provider
+// deltas as Server-Sent Events and persisting the conversation once the stream ends.
+func (r *ServiceRegistry) streamChatCompletion(
+	c *gin.Context,
+	req ChatCompletionRequest,
+	repo *conversation.Repository,
+	convo *conversation.Conversation,
+	query string,
+	prompt string,
+	ragResponse *rag.RAGResponse,
+	selection codegen.ModelSelection,
+	promptTemplate string,
+	service codegen.Service,
+) {
+	stream := newChatStream(c, selection.Model)
+
+	var (
+		resp *codegen.CodeGenerationResponse
+		err  error
+	)
+	if streaming, ok := service.(codegen.StreamingService); ok {
+		resp, err = streaming.GenerateCodeStream(
+			c.Request.Context(),
+			prompt,
+			ragResponse.CodeContexts,
+			ragResponse.DocsContexts,
+			req.Temperature,
+			req.MaxTokens,
+			stream.delta,
+		)
+	} else {
+		// Providers without native streaming are sent as a single delta.
+		resp, err = service.GenerateCode(
+			c.Request.Context(),
+			prompt,
+			ragResponse.CodeContexts,
+			ragResponse.DocsContexts,
+			req.Temperature,
+			req.MaxTokens,
+		)
+		if err == nil && formatAssistantMessage(resp) != "" {
+			stream.delta(formatAssistantMessage(resp))
+		}
+	}
+
+	if err != nil {
+		var interrupted *codegen.InterruptedError
+		if errors.As(err, &interrupted) {
+			convo.AddTurn("user", query)
+			if !stream.started {
+				respondInterruptedChat(c, repo, convo, stream.model, interrupted)
+				return
+			}
+			if err := persistInterruptedChat(c, repo, convo, interrupted); err != nil {
+				stream.fail("Failed to persist conversation")
+				return
+			}
+			stream.finish("interrupted", interrupted.Response(), convo.ID)
+			return
+		}
+
+		if !stream.started {
+			respondGenerationError(c, err, "Failed to generate response")
+			return
+		}
+		log.Printf("Failed to generate response: %v", err)
+		c.Set(middleware.QueryLogErrorMessage, err.Error())
+		stream.fail("Failed to generate response: " + err.Error())
+		return
+	}
+
+	annotateCodeValidation(resp)
+	applyGenerationWarnings(resp, ragResponse)
+	attachCitations(resp, ragResponse)
+	codegen.AttachProvenance(
+		resp,
+		selection.Provider,
+		promptTemplate,
+		ragResponse.CodeContexts,
+		ragResponse.DocsContexts,
+		codegen.ProvenanceHeaderFromEnv(),
+	)
+
+	// The turn is recorded once the tool loop ends with an answer
+	if len(resp.ToolCalls) == 0 {
+		convo.AddTurn("user", query)
+		convo.AddAssistantTurn(formatAssistantMessage(resp), conversationCitations(resp.Citations))
+	}
+
+	c.Set(middleware.QueryLogInputTokens, resp.InputTokens)
+	c.Set(middleware.QueryLogOutputTokens, resp.OutputTokens)
+
+	// The client may have gone away right after the last delta; still keep the answer.
+	stream.trimmed = trimConversation(context.WithoutCancel(c.Request.Context()), convo, service)
+	if err := repo.Save(context.WithoutCancel(c.Request.Context()), convo); err != nil {
+		if errors.Is(err, conversation.ErrVersionConflict) {
+			stream.fail("Conversation was updated by another request; reload it and retry")
+			return
+		}
+		log.Printf("Failed to persist conversation: %v", err)
+		stream.fail("Failed to persist conversation")
+		return
+	}
+	c.Set(middleware.QueryLogConversationID, convo.ID)
+	r.generateConversationTitle(c, repo, convo, service)
+
+	stream.finish(chatFinishReason(resp), resp, convo.ID)
+}
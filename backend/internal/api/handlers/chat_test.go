@@ -0,0 +1,97 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/handlers"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testharness"
+)
+
+func TestChatCompletionsContinuesConversation(t *testing.T) {
+	h := newHarness(t)
+	key := newAPIKey(t, h)
+
+	first := chatCompletion(t, h, key, map[string]any{
+		"messages": []map[string]string{{"role": "user", "content": "Write a counter contract"}},
+	})
+	if first.ConversationID == 0 {
+		t.Fatal("chat completion did not return a conversation ID")
+	}
+	if len(first.Choices) != 1 || !strings.Contains(first.Choices[0].Message.Content, "(define-read-only (hello)") {
+		t.Fatalf("chat completion choices = %+v, want the fake code", first.Choices)
+	}
+
+	second := chatCompletion(t, h, key, map[string]any{
+		"conversation_id": first.ConversationID,
+		"messages":        []map[string]string{{"role": "user", "content": "Make it pausable"}},
+	})
+	if second.ConversationID != first.ConversationID {
+		t.Fatalf("follow-up saved to conversation %d, want %d", second.ConversationID, first.ConversationID)
+	}
+	calls := h.Codegen.Calls()
+	if len(calls) != 2 || !strings.Contains(calls[1].Query, "Write a counter contract") {
+		t.Fatalf("follow-up prompt %q does not include the history", calls[len(calls)-1].Query)
+	}
+
+	stored, err := auth.LookupAPIKey(h.DB, key)
+	if err != nil {
+		t.Fatalf("look up key: %v", err)
+	}
+	convo, err := conversation.NewRepository(h.DB).Get(context.Background(), first.ConversationID, stored.UserID)
+	if err != nil {
+		t.Fatalf("load conversation: %v", err)
+	}
+	if len(convo.History) != 4 {
+		t.Fatalf("conversation has %d turns, want 4", len(convo.History))
+	}
+}
+
+func TestChatCompletionsRejectsOtherUsersConversation(t *testing.T) {
+	h := newHarness(t)
+	key := newAPIKey(t, h)
+	started := chatCompletion(t, h, key, map[string]any{
+		"messages": []map[string]string{{"role": "user", "content": "Write a counter contract"}},
+	})
+
+	bob, err := h.CreateUser("bob", "password123", "user")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	bobKey, err := h.CreateAPIKey(bob)
+	if err != nil {
+		t.Fatalf("create API key: %v", err)
+	}
+	rec, err := h.Do(http.MethodPost, "/v1/chat/completions", map[string]any{
+		"conversation_id": started.ConversationID,
+		"messages":        []map[string]string{{"role": "user", "content": "Make it pausable"}},
+	}, testharness.APIKey(bobKey))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("chat in another user's conversation: got %d, want 404: %s", rec.Code, rec.Body)
+	}
+}
+
+// chatCompletion sends a chat completion request and decodes the 200 response.
+func chatCompletion(t *testing.T, h *testharness.Harness, key string, body map[string]any) handlers.ChatCompletionResponse {
+	t.Helper()
+	rec, err := h.Do(http.MethodPost, "/v1/chat/completions", body, testharness.APIKey(key))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("chat completion: got %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp handlers.ChatCompletionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	return resp
+}
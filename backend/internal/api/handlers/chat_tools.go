@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+// maxChatTools bounds the tools a single request may offer, matching OpenAI's limit.
+const maxChatTools = 128
+
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ChatTool is an OpenAI-compatible tool definition. Only function tools are supported.
+type ChatTool struct {
+	Type     string           `json:"type"`
+	Function ChatToolFunction `json:"function"`
+}
+
+// ChatToolFunction describes a function the model may call.
+type ChatToolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+// ChatToolCall is a function call made by the assistant.
+type ChatToolCall struct {
+	ID       string               `json:"id"`
+	Type     string               `json:"type"`
+	Function ChatToolCallFunction `json:"function"`
+}
+
+// ChatToolCallFunction names the called function and its JSON-encoded arguments.
+type ChatToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// chatToolRequest converts the request's tools, tool_choice, and the tool rounds that follow
+// the last user message into a codegen tool request. lastUser is that message's index.
+func chatToolRequest(req ChatCompletionRequest, lastUser int) (codegen.ToolRequest, error) {
+	var tools codegen.ToolRequest
+
+	if len(req.Tools) > maxChatTools {
+		return tools, fmt.Errorf("at most %d tools are supported", maxChatTools)
+	}
+	names := make(map[string]bool, len(req.Tools))
+	for _, tool := range req.Tools {
+		if tool.Type != "" && tool.Type != "function" {
+			return tools, fmt.Errorf("unsupported tool type %q; only \"function\" tools are supported", tool.Type)
+		}
+		if !toolNamePattern.MatchString(tool.Function.Name) {
+			return tools, fmt.Errorf("tool name %q must be 1-64 letters, digits, underscores or dashes", tool.Function.Name)
+		}
+		if names[tool.Function.Name] {
+			return tools, fmt.Errorf("duplicate tool name %q", tool.Function.Name)
+		}
+		names[tool.Function.Name] = true
+
+		parameters := tool.Function.Parameters
+		if parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		tools.Tools = append(tools.Tools, codegen.Tool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  parameters,
+		})
+	}
+
+	choice, err := parseToolChoice(req.ToolChoice, names)
+	if err != nil {
+		return tools, err
+	}
+	tools.Choice = choice
+
+	for _, message := range req.Messages[lastUser+1:] {
+		switch message.Role {
+		case "assistant":
+			if len(message.ToolCalls) == 0 {
+				continue
+			}
+			turn := codegen.ToolTurn{Text: message.Content}
+			for _, call := range message.ToolCalls {
+				if call.ID == "" || call.Function.Name == "" {
+					return tools, fmt.Errorf("assistant tool calls need an id and a function name")
+				}
+				turn.Calls = append(turn.Calls, codegen.ToolCall{
+					ID:        call.ID,
+					Name:      call.Function.Name,
+					Arguments: call.Function.Arguments,
+				})
+			}
+			tools.Turns = append(tools.Turns, turn)
+		case "tool":
+			if len(tools.Turns) == 0 {
+				return tools, fmt.Errorf("tool messages must follow an assistant message with tool_calls")
+			}
+			turn := &tools.Turns[len(tools.Turns)-1]
+			if turn.CallName(message.ToolCallID) == "" {
+				return tools, fmt.Errorf("tool message tool_call_id %q does not match a preceding tool call", message.ToolCallID)
+			}
+			turn.Results = append(turn.Results, codegen.ToolResult{CallID: message.ToolCallID, Content: message.Content})
+		}
+	}
+
+	for _, turn := range tools.Turns {
+		for _, call := range turn.Calls {
+			if !hasToolResult(turn, call.ID) {
+				return tools, fmt.Errorf("tool call %q has no tool message with its result", call.ID)
+			}
+		}
+	}
+
+	return tools, nil
+}
+
+// parseToolChoice accepts "auto", "none", "required", or {"type": "function", "function": {"name": ...}}.
+func parseToolChoice(raw json.RawMessage, names map[string]bool) (codegen.ToolChoice, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return codegen.ToolChoice{}, nil
+	}
+	if len(names) == 0 {
+		return codegen.ToolChoice{}, fmt.Errorf("tool_choice requires tools")
+	}
+
+	var mode string
+	if err := json.Unmarshal(raw, &mode); err == nil {
+		switch mode {
+		case codegen.ToolChoiceAuto, codegen.ToolChoiceNone, codegen.ToolChoiceRequired:
+			return codegen.ToolChoice{Mode: mode}, nil
+		}
+		return codegen.ToolChoice{}, fmt.Errorf("tool_choice must be \"auto\", \"none\", \"required\" or a function")
+	}
+
+	var named struct {
+		Type     string `json:"type"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(raw, &named); err != nil || named.Type != "function" {
+		return codegen.ToolChoice{}, fmt.Errorf("tool_choice must be \"auto\", \"none\", \"required\" or a function")
+	}
+	if !names[named.Function.Name] {
+		return codegen.ToolChoice{}, fmt.Errorf("tool_choice names unknown function %q", named.Function.Name)
+	}
+	return codegen.ToolChoice{Mode: codegen.ToolChoiceFunction, Name: named.Function.Name}, nil
+}
+
+func hasToolResult(turn codegen.ToolTurn, callID string) bool {
+	for _, result := range turn.Results {
+		if result.CallID == callID {
+			return true
+		}
+	}
+	return false
+}
+
+// chatToolCalls converts provider tool calls to OpenAI's wire format.
+func chatToolCalls(calls []codegen.ToolCall) []ChatToolCall {
+	var toolCalls []ChatToolCall
+	for _, call := range calls {
+		arguments := call.Arguments
+		if strings.TrimSpace(arguments) == "" {
+			arguments = "{}"
+		}
+		toolCalls = append(toolCalls, ChatToolCall{
+			ID:       call.ID,
+			Type:     "function",
+			Function: ChatToolCallFunction{Name: call.Name, Arguments: arguments},
+		})
+	}
+	return toolCalls
+}
+
+// chatFinishReason reports "tool_calls" when the model is waiting on the client's tools.
+func chatFinishReason(resp *codegen.CodeGenerationResponse) string {
+	if len(resp.ToolCalls) > 0 {
+		return "tool_calls"
+	}
+	return "stop"
+}
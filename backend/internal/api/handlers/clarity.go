@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/clarity"
+)
+
+// maxAnalyzeCodeBytes bounds the contract source accepted for analysis.
+const maxAnalyzeCodeBytes = 256 * 1024
+
+// AnalyzeClarityRequest carries a contract to check and, optionally, which checks to run.
+type AnalyzeClarityRequest struct {
+	Code string `json:"code" binding:"required"`
+	// Checks defaults to every check.
+	Checks []string `json:"checks"`
+}
+
+// AnalyzeClarity statically checks Clarity code and returns its diagnostics. Code that does
+// not parse is not a request error: it yields a syntax_error diagnostic with its position.
+func AnalyzeClarity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req AnalyzeClarityRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.Code) > maxAnalyzeCodeBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("code exceeds %d bytes", maxAnalyzeCodeBytes)})
+			return
+		}
+
+		result, err := clarity.Analyze(req.Code, req.Checks)
+		switch {
+		case errors.Is(err, clarity.ErrUnknownCheck):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Clarity analysis failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to analyze code"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+// UpdateCodegenConfigRequest switches the provider, model and default temperature at runtime.
+// Empty fields keep the environment configuration.
+type UpdateCodegenConfigRequest struct {
+	Provider    string  `json:"provider"`
+	Model       string  `json:"model"`
+	Temperature float64 `json:"temperature"`
+}
+
+// GetCodegenConfig returns the active provider, model and default temperature along with
+// the runtime override and the environment configuration it replaces.
+func GetCodegenConfig() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, codegenConfigState())
+	}
+}
+
+// UpdateCodegenConfig stores a runtime override that takes effect for the next request.
+func UpdateCodegenConfig(store *codegen.RuntimeConfigStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req UpdateCodegenConfigRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to resolve authenticated user"})
+			return
+		}
+
+		cfg := codegen.RuntimeConfig{Provider: req.Provider, Model: req.Model, Temperature: req.Temperature}
+		if err := cfg.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if _, err := store.Save(c.Request.Context(), cfg, userID); err != nil {
+			log.Printf("Failed to save codegen configuration: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save codegen configuration"})
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{
+			"provider":    req.Provider,
+			"model":       req.Model,
+			"temperature": req.Temperature,
+		})
+
+		c.JSON(http.StatusOK, codegenConfigState())
+	}
+}
+
+// ResetCodegenConfig drops the runtime override and returns to the environment configuration.
+func ResetCodegenConfig(store *codegen.RuntimeConfigStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := store.Reset(c.Request.Context()); err != nil {
+			log.Printf("Failed to reset codegen configuration: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset codegen configuration"})
+			return
+		}
+
+		c.JSON(http.StatusOK, codegenConfigState())
+	}
+}
+
+func codegenConfigState() gin.H {
+	active := codegen.DefaultModelSelection()
+	envProvider := codegen.ProviderFromEnv()
+
+	state := gin.H{
+		"provider":    active.Provider,
+		"model":       active.Model,
+		"temperature": codegen.DefaultTemperature(),
+		"environment": gin.H{
+			"provider": envProvider,
+			"model":    codegen.ConfiguredModel(envProvider),
+		},
+	}
+	if override := codegen.CurrentRuntimeConfig(); override != (codegen.RuntimeConfig{}) {
+		state["override"] = override
+	}
+	return state
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cache"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/contracttemplate"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// ContractTemplateRequest creates or replaces a contract template.
+type ContractTemplateRequest struct {
+	Name        string                       `json:"name"`
+	Title       string                       `json:"title" binding:"required"`
+	Description string                       `json:"description"`
+	Category    string                       `json:"category"`
+	Keywords    []string                     `json:"keywords"`
+	Parameters  []contracttemplate.Parameter `json:"parameters"`
+	Body        string                       `json:"body" binding:"required"`
+}
+
+// InstantiateTemplateRequest renders a contract template.
+type InstantiateTemplateRequest struct {
+	// Parameters are the values to substitute; strings, numbers and booleans are accepted.
+	Parameters map[string]any `json:"parameters"`
+	// Customization describes changes for the model to make and lets it choose values for
+	// missing required parameters. Without it the template is rendered as is.
+	Customization string  `json:"customization"`
+	Temperature   float64 `json:"temperature"`
+	MaxTokens     int     `json:"max_tokens"`
+	Language      string  `json:"language"`
+}
+
+// InstantiateTemplateResponse is a rendered, and possibly customized, contract template.
+type InstantiateTemplateResponse struct {
+	Template string `json:"template"`
+	// Parameters are the values the template was rendered with, defaults included.
+	Parameters map[string]string `json:"parameters"`
+	// Generated is true when a model applied the customization.
+	Generated bool `json:"generated"`
+	*codegen.CodeGenerationResponse
+}
+
+// ListContractTemplates returns every contract template, optionally only those of a category.
+func ListContractTemplates(repo *contracttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templates, err := repo.List(c.Request.Context())
+		if err != nil {
+			respondContractTemplateError(c, err, "failed to list contract templates")
+			return
+		}
+		if category := strings.ToLower(strings.TrimSpace(c.Query("category"))); category != "" {
+			filtered := templates[:0]
+			for _, tmpl := range templates {
+				if tmpl.Category == category {
+					filtered = append(filtered, tmpl)
+				}
+			}
+			templates = filtered
+		}
+		c.JSON(http.StatusOK, gin.H{"templates": templates})
+	}
+}
+
+// GetContractTemplate returns a single contract template by name.
+func GetContractTemplate(repo *contracttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tmpl, err := repo.Get(c.Request.Context(), c.Param("name"))
+		if err != nil {
+			respondContractTemplateError(c, err, "failed to get contract template")
+			return
+		}
+		c.JSON(http.StatusOK, tmpl)
+	}
+}
+
+// CreateContractTemplate stores a new contract template, which may replace a built-in one.
+func CreateContractTemplate(repo *contracttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ContractTemplateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		c.Set(middleware.AuditTargetID, req.Name)
+
+		tmpl := req.template(req.Name)
+		if userID, ok := extractUserID(c); ok {
+			createdBy := int64(userID)
+			tmpl.CreatedBy = &createdBy
+		}
+		if err := repo.Create(c.Request.Context(), tmpl); err != nil {
+			respondContractTemplateError(c, err, "failed to create contract template")
+			return
+		}
+		c.JSON(http.StatusCreated, tmpl)
+	}
+}
+
+// UpdateContractTemplate replaces a stored contract template.
+func UpdateContractTemplate(repo *contracttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ContractTemplateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("name"))
+
+		tmpl := req.template(c.Param("name"))
+		if err := repo.Update(c.Request.Context(), tmpl); err != nil {
+			respondContractTemplateError(c, err, "failed to update contract template")
+			return
+		}
+		c.JSON(http.StatusOK, tmpl)
+	}
+}
+
+// DeleteContractTemplate removes a stored contract template, restoring any built-in one it replaced.
+func DeleteContractTemplate(repo *contracttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(middleware.AuditTargetID, c.Param("name"))
+
+		if err := repo.Delete(c.Request.Context(), c.Param("name")); err != nil {
+			respondContractTemplateError(c, err, "failed to delete contract template")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+func (req ContractTemplateRequest) template(name string) *contracttemplate.Template {
+	return &contracttemplate.Template{
+		Name:        name,
+		Title:       req.Title,
+		Description: req.Description,
+		Category:    req.Category,
+		Keywords:    req.Keywords,
+		Parameters:  req.Parameters,
+		Body:        req.Body,
+	}
+}
+
+// InstantiateContractTemplate renders a contract template with the supplied parameters and
+// their defaults. Without a customization the result is returned directly, no model is
+// called and every required parameter must be supplied. With one, the rendered template is
+// handed to the model, which applies the customization and fills in missing parameters.
+func InstantiateContractTemplate(db *sql.DB, services *ServiceRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req InstantiateTemplateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		req.Customization = strings.TrimSpace(req.Customization)
+
+		tmpl, err := contracttemplate.NewRepository(db).Get(c.Request.Context(), c.Param("name"))
+		if err != nil {
+			respondContractTemplateError(c, err, "failed to get contract template")
+			return
+		}
+		supplied, err := templateParameterValues(req.Parameters)
+		if err != nil {
+			respondContractTemplateError(c, err, "invalid template parameters")
+			return
+		}
+		values, missing, err := tmpl.Values(supplied)
+		if err != nil {
+			respondContractTemplateError(c, err, "invalid template parameters")
+			return
+		}
+		if len(missing) > 0 && req.Customization == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":              fmt.Sprintf("%v: %s; supply them or describe them in customization", contracttemplate.ErrMissingParameters, strings.Join(missing, ", ")),
+				"missing_parameters": missing,
+			})
+			return
+		}
+
+		code, err := tmpl.Render(values)
+		if err != nil {
+			respondContractTemplateError(c, err, "failed to render contract template")
+			return
+		}
+		if req.Customization == "" {
+			c.JSON(http.StatusOK, InstantiateTemplateResponse{
+				Template:               tmpl.Name,
+				Parameters:             values,
+				CodeGenerationResponse: &codegen.CodeGenerationResponse{Code: code},
+			})
+			return
+		}
+
+		selection, language, ok := applyUserSettings(c, db, "", req.Language, &req.Temperature, &req.MaxTokens)
+		if !ok {
+			return
+		}
+		if err := codegen.ValidateModelMaxTokens(selection.Model, req.MaxTokens); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(middleware.QueryLogModelProvider, selection.Provider)
+		c.Set(middleware.QueryLogModel, selection.Model)
+
+		codegenService, err := services.requestModel(c, selection)
+		if err != nil {
+			log.Printf("Failed to initialize %s service: %v", selection.Provider, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to initialize code generation service: " + err.Error(),
+			})
+			return
+		}
+
+		response, generationHit, err := services.generateWithCache(c, codegenService, cache.GenerationKey{
+			Provider:         selection.Provider,
+			Model:            selection.Model,
+			Query:            customizationPrompt(tmpl, missing, req.Customization),
+			Temperature:      req.Temperature,
+			MaxTokens:        req.MaxTokens,
+			CodeContexts:     []string{code},
+			ResponseLanguage: language,
+		})
+		services.setCacheStatus(c, false, generationHit)
+		if err != nil {
+			respondGenerationError(c, err, "Failed to customize contract template")
+			return
+		}
+		if !generationHit {
+			c.Set(middleware.QueryLogInputTokens, response.InputTokens)
+			c.Set(middleware.QueryLogOutputTokens, response.OutputTokens)
+		}
+
+		c.JSON(http.StatusOK, InstantiateTemplateResponse{
+			Template:               tmpl.Name,
+			Parameters:             values,
+			Generated:              true,
+			CodeGenerationResponse: response,
+		})
+	}
+}
+
+// customizationPrompt asks the model to adapt the rendered template, which it receives as
+// its only code context, and to choose values for the parameters left as placeholders.
+func customizationPrompt(tmpl *contracttemplate.Template, missing []string, customization string) string {
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Adapt the %s contract provided as context. Keep its structure and its public interface unless the request below changes them, and return the complete contract.\n", tmpl.Title)
+	if len(missing) > 0 {
+		prompt.WriteString("\nThe contract contains placeholders in angle brackets. Replace each one with a value that fits the request:\n")
+		for _, name := range missing {
+			for _, p := range tmpl.Parameters {
+				if p.Name == name {
+					fmt.Fprintf(&prompt, "- <%s> (%s): %s\n", p.Name, p.Type, p.Description)
+				}
+			}
+		}
+	}
+	prompt.WriteString("\nRequested changes:\n")
+	prompt.WriteString(customization)
+	return prompt.String()
+}
+
+// templateParameterValues converts JSON parameter values to the strings templates are
+// rendered with. Whole numbers lose any fractional part; other types are rejected.
+func templateParameterValues(parameters map[string]any) (map[string]string, error) {
+	values := make(map[string]string, len(parameters))
+	for name, value := range parameters {
+		switch v := value.(type) {
+		case string:
+			values[name] = v
+		case bool:
+			values[name] = strconv.FormatBool(v)
+		case float64:
+			if v != float64(int64(v)) {
+				return nil, fmt.Errorf("%w: parameter %s must be a whole number", contracttemplate.ErrInvalid, name)
+			}
+			values[name] = strconv.FormatInt(int64(v), 10)
+		case nil:
+		default:
+			return nil, fmt.Errorf("%w: parameter %s must be a string, number or boolean", contracttemplate.ErrInvalid, name)
+		}
+	}
+	return values, nil
+}
+
+// withContractTemplate returns ragResponse with the contract template matching the query,
+// rendered with its defaults, prepended to the code contexts, so generation can build on a
+// curated scaffold. Required parameters render as placeholders for the model to fill. The
+// response is copied, leaving cached retrievals untouched, and returned unchanged when no
+// template matches, the filter excludes code or CONTRACT_TEMPLATE_CONTEXT is false.
+func withContractTemplate(c *gin.Context, db *sql.DB, query string, filter rag.Filter, ragResponse *rag.RAGResponse) *rag.RAGResponse {
+	if !contracttemplate.ConfigFromEnv().BlendContext || !filter.Normalize().IncludesCode() {
+		return ragResponse
+	}
+	templates, err := contracttemplate.NewRepository(db).List(c.Request.Context())
+	if err != nil {
+		log.Printf("Failed to load contract templates: %v", err)
+		return ragResponse
+	}
+	tmpl := contracttemplate.Match(templates, query)
+	if tmpl == nil {
+		return ragResponse
+	}
+	values, _, err := tmpl.Values(nil)
+	if err == nil {
+		var code string
+		if code, err = tmpl.Render(values); err == nil {
+			blended := *ragResponse
+			blended.CodeContexts = append([]string{code}, ragResponse.CodeContexts...)
+			blended.CodeDistances = append([]float64{0}, ragResponse.CodeDistances...)
+			blended.CodeSources = make([]rag.Source, len(blended.CodeContexts))
+			blended.CodeSources[0] = rag.Source{ID: "contract-template:" + tmpl.Name, FilePath: "templates/" + tmpl.Name + ".clar"}
+			copy(blended.CodeSources[1:], ragResponse.CodeSources)
+			return &blended
+		}
+	}
+	log.Printf("Failed to render contract template %s: %v", tmpl.Name, err)
+	return ragResponse
+}
+
+func respondContractTemplateError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, contracttemplate.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, contracttemplate.ErrExists), errors.Is(err, contracttemplate.ErrReadOnly):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, contracttemplate.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Contract template request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
+)
+
+// ListConversations returns a page of the user's conversations without their history
+// @Summary List conversations
+// @Description Get a page of the authenticated user's chat conversations, optionally filtered by title
+// @Tags Conversations
+// @Produce json
+// @Security BasicAuth
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Conversations per page (max 100)" default(20)
+// @Param search query string false "Keep conversations whose title contains this text"
+// @Param sort query string false "updated_at, created_at or title" default(updated_at)
+// @Param order query string false "asc or desc" default(desc)
+// @Success 200 {object} map[string]interface{} "Conversations with total, page and limit"
+// @Failure 400 {object} map[string]interface{} "Invalid sort or order"
+// @Failure 401 {object} map[string]interface{} "Unauthorized"
+// @Router /conversations [get]
+func ListConversations(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+		conversations, total, err := conversation.NewRepository(db).List(c.Request.Context(), userID, conversation.ListParams{
+			Page:   page,
+			Limit:  limit,
+			Search: c.Query("search"),
+			Sort:   c.Query("sort"),
+			Order:  c.Query("order"),
+		})
+		if errors.Is(err, conversation.ErrInvalidListParams) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to list conversations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list conversations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"conversations": conversations,
+			"total":         total,
+			"page":          page,
+			"limit":         limit,
+		})
+	}
+}
+
+// GetConversation returns one of the user's conversations with its full history
+// @Summary Get conversation
+// @Description Get a conversation of the authenticated user with every turn
+// @Tags Conversations
+// @Produce json
+// @Security BasicAuth
+// @Param id path int true "Conversation ID"
+// @Success 200 {object} map[string]interface{} "Conversation"
+// @Failure 400 {object} map[string]interface{} "Invalid id"
+// @Failure 404 {object} map[string]interface{} "Conversation not found"
+// @Router /conversations/{id} [get]
+func GetConversation(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		convo, err := conversation.NewRepository(db).Get(c.Request.Context(), id, userID)
+		if errors.Is(err, conversation.ErrConversationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to load conversation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load conversation"})
+			return
+		}
+
+		c.JSON(http.StatusOK, conversationJSON(convo))
+	}
+}
+
+// conversationJSON renders a conversation with its full history.
+func conversationJSON(convo *conversation.Conversation) gin.H {
+	title := convo.Title
+	if title == "" {
+		title = convo.DefaultTitle()
+	}
+	body := gin.H{
+		"id":            convo.ID,
+		"title":         title,
+		"title_source":  convo.TitleSource,
+		"history":       convo.History,
+		"trimmed_turns": convo.TrimmedTurns,
+		"version":       convo.Version,
+		"created_at":    convo.CreatedAt,
+		"updated_at":    convo.UpdatedAt,
+	}
+	if convo.BranchedFrom != 0 {
+		body["branched_from"] = gin.H{"conversation_id": convo.BranchedFrom, "turn_index": convo.BranchTurn}
+	}
+	return body
+}
+
+// respondConversationConflict answers 409 when another request saved the conversation
+// first, with the conversation as it is now stored so the client can retry on top of it.
+func respondConversationConflict(c *gin.Context, repo *conversation.Repository, convo *conversation.Conversation) {
+	body := gin.H{"error": "Conversation was updated by another request; retry with its latest history"}
+	if latest, err := repo.Get(c.Request.Context(), convo.ID, convo.UserID); err != nil {
+		log.Printf("Failed to reload conversation %d: %v", convo.ID, err)
+	} else {
+		body["conversation"] = conversationJSON(latest)
+	}
+	c.JSON(http.StatusConflict, body)
+}
+
+// RenameConversationRequest sets a conversation's title.
+type RenameConversationRequest struct {
+	Title string `json:"title" binding:"required"`
+}
+
+// RenameConversation sets the title of one of the user's conversations
+// @Summary Rename conversation
+// @Description Set a conversation's title. Renamed conversations keep their title instead of the one generated after the first turn.
+// @Tags Conversations
+// @Accept json
+// @Produce json
+// @Security BasicAuth
+// @Param id path int true "Conversation ID"
+// @Param request body RenameConversationRequest true "New title"
+// @Success 200 {object} map[string]interface{} "Renamed conversation"
+// @Failure 400 {object} map[string]interface{} "Invalid id or title"
+// @Failure 404 {object} map[string]interface{} "Conversation not found"
+// @Router /conversations/{id} [patch]
+func RenameConversation(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		var req RenameConversationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		title, err := conversation.NewRepository(db).Rename(c.Request.Context(), id, userID, req.Title)
+		switch {
+		case errors.Is(err, conversation.ErrInvalidTitle):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, conversation.ErrConversationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+			return
+		case err != nil:
+			log.Printf("Failed to rename conversation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to rename conversation"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"id":           id,
+			"title":        title,
+			"title_source": conversation.TitleSourceUser,
+		})
+	}
+}
+
+// BranchConversationRequest picks the last turn a branch keeps.
+type BranchConversationRequest struct {
+	// TurnIndex counts turns from the start of the conversation, including trimmed ones, so
+	// History[i] is turn trimmed_turns+i. Omitted copies every turn.
+	TurnIndex *int `json:"turn_index"`
+}
+
+// BranchConversation copies one of the user's conversations into a new one
+// @Summary Branch conversation
+// @Description Start a new conversation from the turns of an existing one up to and including turn_index. The original conversation is not changed.
+// @Tags Conversations
+// @Accept json
+// @Produce json
+// @Security BasicAuth
+// @Param id path int true "Conversation ID"
+// @Param request body BranchConversationRequest false "Last turn to keep"
+// @Success 201 {object} map[string]interface{} "New conversation"
+// @Failure 400 {object} map[string]interface{} "Invalid id or turn index"
+// @Failure 404 {object} map[string]interface{} "Conversation not found"
+// @Router /conversations/{id}/branch [post]
+func BranchConversation(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		var req BranchConversationRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		turnIndex := -1
+		if req.TurnIndex != nil {
+			if *req.TurnIndex < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "turn_index must not be negative"})
+				return
+			}
+			turnIndex = *req.TurnIndex
+		}
+
+		branch, err := conversation.NewRepository(db).Branch(c.Request.Context(), id, userID, turnIndex)
+		switch {
+		case errors.Is(err, conversation.ErrInvalidTurn):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, conversation.ErrConversationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+			return
+		case err != nil:
+			log.Printf("Failed to branch conversation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to branch conversation"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, conversationJSON(branch))
+	}
+}
+
+// ExportConversation downloads one of the user's conversations as Markdown or JSON
+// @Summary Export conversation
+// @Description Download a conversation of the authenticated user as a Markdown document or a JSON file, with each turn's code blocks and optionally the retrieved sources each answer cited
+// @Tags Conversations
+// @Produce json
+// @Produce text/markdown
+// @Security BasicAuth
+// @Param id path int true "Conversation ID"
+// @Param format query string false "markdown or json" default(markdown)
+// @Param citations query bool false "Include the sources each answer was generated from" default(false)
+// @Success 200 {file} file "Conversation export"
+// @Failure 400 {object} map[string]interface{} "Invalid id, format or citations"
+// @Failure 404 {object} map[string]interface{} "Conversation not found"
+// @Router /conversations/{id}/export [get]
+func ExportConversation(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+		format := strings.ToLower(c.DefaultQuery("format", conversation.ExportMarkdown))
+		if format != conversation.ExportMarkdown && format != conversation.ExportJSON {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be markdown or json"})
+			return
+		}
+		var opts conversation.ExportOptions
+		if raw := c.Query("citations"); raw != "" {
+			if opts.Citations, err = strconv.ParseBool(raw); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "citations must be true or false"})
+				return
+			}
+		}
+
+		convo, err := conversation.NewRepository(db).Get(c.Request.Context(), id, userID)
+		if errors.Is(err, conversation.ErrConversationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to load conversation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load conversation"})
+			return
+		}
+
+		now := time.Now()
+		if format == conversation.ExportJSON {
+			body, err := json.MarshalIndent(convo.Export(opts, now), "", "  ")
+			if err != nil {
+				log.Printf("Failed to encode conversation export: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export conversation"})
+				return
+			}
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("conversation_%d.json", convo.ID)))
+			c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("conversation_%d.md", convo.ID)))
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(convo.Markdown(opts, now)))
+	}
+}
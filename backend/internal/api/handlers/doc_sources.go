@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/ingestion"
+)
+
+// CreateDocSourceRequest registers a documentation site crawled from a page or a sitemap.
+type CreateDocSourceRequest struct {
+	Name                 string `json:"name" binding:"required"`
+	URL                  string `json:"url" binding:"required"`
+	Kind                 string `json:"kind"`
+	PathPrefix           string `json:"path_prefix"`
+	MaxPages             int    `json:"max_pages"`
+	RecrawlIntervalHours int    `json:"recrawl_interval_hours"`
+	// Crawl queues the first crawl right away; it defaults to true.
+	Crawl *bool `json:"crawl"`
+}
+
+// UpdateDocSourceRequest changes a documentation source's crawl settings. Omitted fields are
+// left unchanged.
+type UpdateDocSourceRequest struct {
+	URL                  *string `json:"url"`
+	Kind                 *string `json:"kind"`
+	PathPrefix           *string `json:"path_prefix"`
+	MaxPages             *int    `json:"max_pages"`
+	RecrawlIntervalHours *int    `json:"recrawl_interval_hours"`
+}
+
+// ListDocSources returns every registered documentation source with its freshness.
+func ListDocSources(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sources, err := manager.DocSources().List(c.Request.Context())
+		if err != nil {
+			log.Printf("Failed to list documentation sources: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list documentation sources"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"sources": sources})
+	}
+}
+
+// GetDocSource returns a single documentation source.
+func GetDocSource(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := docSourceID(c)
+		if !ok {
+			return
+		}
+		source, err := manager.DocSources().Get(c.Request.Context(), id)
+		if err != nil {
+			respondDocSourceError(c, err, "failed to get documentation source")
+			return
+		}
+		c.JSON(http.StatusOK, source)
+	}
+}
+
+// ListDocSourcePages returns the pages indexed from a documentation source.
+func ListDocSourcePages(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := docSourceID(c)
+		if !ok {
+			return
+		}
+		if _, err := manager.DocSources().Get(c.Request.Context(), id); err != nil {
+			respondDocSourceError(c, err, "failed to list documentation pages")
+			return
+		}
+		pages, err := manager.DocSources().Pages(c.Request.Context(), id)
+		if err != nil {
+			respondDocSourceError(c, err, "failed to list documentation pages")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"pages": pages})
+	}
+}
+
+// CreateDocSource registers a documentation source and, unless crawl is false, queues its
+// first crawl. The source is created even when the crawl cannot be queued.
+func CreateDocSource(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateDocSourceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		var requestedBy *int64
+		if userID, ok := extractUserID(c); ok {
+			id := int64(userID)
+			requestedBy = &id
+		}
+		source, err := manager.CreateDocSource(c.Request.Context(), ingestion.DocSource{
+			Name:                 req.Name,
+			URL:                  req.URL,
+			Kind:                 req.Kind,
+			PathPrefix:           req.PathPrefix,
+			MaxPages:             req.MaxPages,
+			RecrawlIntervalHours: req.RecrawlIntervalHours,
+			CreatedBy:            requestedBy,
+		})
+		if err != nil {
+			respondDocSourceError(c, err, "failed to create documentation source")
+			return
+		}
+		c.Set(middleware.AuditTargetID, strconv.FormatInt(source.ID, 10))
+		c.Set(middleware.AuditDetails, map[string]any{"name": source.Name, "url": source.URL, "kind": source.Kind})
+
+		resp := gin.H{"source": source}
+		if req.Crawl == nil || *req.Crawl {
+			job, err := manager.CrawlDocSource(c.Request.Context(), source.ID, requestedBy)
+			if err != nil {
+				log.Printf("Failed to queue first crawl of documentation source %d: %v", source.ID, err)
+				resp["crawl_error"] = err.Error()
+			} else {
+				resp["job"] = job
+				if source, err = manager.DocSources().Get(c.Request.Context(), source.ID); err == nil {
+					resp["source"] = source
+				}
+			}
+		}
+		c.JSON(http.StatusCreated, resp)
+	}
+}
+
+// UpdateDocSource changes a documentation source's URL, scope, page limit or re-crawl
+// interval. The new settings apply from the next crawl.
+func UpdateDocSource(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := docSourceID(c)
+		if !ok {
+			return
+		}
+		var req UpdateDocSourceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("id"))
+
+		source, err := manager.DocSources().Get(c.Request.Context(), id)
+		if err != nil {
+			respondDocSourceError(c, err, "failed to update documentation source")
+			return
+		}
+		if req.URL != nil {
+			source.URL = *req.URL
+			// A new URL re-derives the kind and scope unless they are given too.
+			if req.Kind == nil {
+				source.Kind = ""
+			}
+			if req.PathPrefix == nil {
+				source.PathPrefix = ""
+			}
+		}
+		if req.Kind != nil {
+			source.Kind = *req.Kind
+		}
+		if req.PathPrefix != nil {
+			source.PathPrefix = *req.PathPrefix
+		}
+		if req.MaxPages != nil {
+			source.MaxPages = *req.MaxPages
+		}
+		if req.RecrawlIntervalHours != nil {
+			source.RecrawlIntervalHours = *req.RecrawlIntervalHours
+		}
+		source, err = manager.UpdateDocSource(c.Request.Context(), *source)
+		if err != nil {
+			respondDocSourceError(c, err, "failed to update documentation source")
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{
+			"url":                    source.URL,
+			"kind":                   source.Kind,
+			"path_prefix":            source.PathPrefix,
+			"max_pages":              source.MaxPages,
+			"recrawl_interval_hours": source.RecrawlIntervalHours,
+		})
+
+		c.JSON(http.StatusOK, source)
+	}
+}
+
+// DeleteDocSource removes a documentation source and its pages' chunks from the docs
+// collection.
+func DeleteDocSource(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := docSourceID(c)
+		if !ok {
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("id"))
+
+		deleted, err := manager.DeleteDocSource(c.Request.Context(), id)
+		if err != nil {
+			respondDocSourceError(c, err, "failed to delete documentation source")
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"deleted_chunks": deleted})
+
+		c.JSON(http.StatusOK, gin.H{"success": true, "deleted_chunks": deleted})
+	}
+}
+
+// CrawlDocSource queues a crawl_docs job that re-crawls a documentation source now.
+func CrawlDocSource(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := docSourceID(c)
+		if !ok {
+			return
+		}
+
+		var requestedBy *int64
+		if userID, ok := extractUserID(c); ok {
+			uid := int64(userID)
+			requestedBy = &uid
+		}
+		job, err := manager.CrawlDocSource(c.Request.Context(), id, requestedBy)
+		if errors.Is(err, ingestion.ErrJobActive) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "job": job})
+			return
+		}
+		if err != nil {
+			respondDocSourceError(c, err, "failed to enqueue ingestion job")
+			return
+		}
+
+		c.Set(middleware.AuditTargetID, job.ID)
+		c.Set(middleware.AuditDetails, map[string]any{
+			"job_type":      job.JobType,
+			"doc_source_id": id,
+		})
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+func docSourceID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondDocSourceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, ingestion.ErrDocSourceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ingestion.ErrInvalidDocSource):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ingestion.ErrDocSourceExists), errors.Is(err, ingestion.ErrJobActive):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ingestion.ErrIndexerRequired):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+	case errors.Is(err, ingestion.ErrQueueFull):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Documentation source request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
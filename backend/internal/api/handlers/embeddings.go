@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// EmbeddingRequest represents an OpenAI-compatible embeddings request
+type EmbeddingRequest struct {
+	// Input is a single string or an array of strings.
+	Input          json.RawMessage `json:"input" binding:"required"`
+	Model          string          `json:"model"`
+	EncodingFormat string          `json:"encoding_format"`
+	User           string          `json:"user"`
+}
+
+// EmbeddingObject is a single embedding in the response. Embedding is a float array,
+// or a base64 string of little-endian float32 values when encoding_format is "base64".
+type EmbeddingObject struct {
+	Object    string `json:"object"`
+	Index     int    `json:"index"`
+	Embedding any    `json:"embedding"`
+}
+
+// EmbeddingUsage reports the tokens consumed by an embeddings request
+type EmbeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// EmbeddingResponse represents an OpenAI-compatible embeddings response
+type EmbeddingResponse struct {
+	Object string            `json:"object"`
+	Data   []EmbeddingObject `json:"data"`
+	Model  string            `json:"model"`
+	Usage  EmbeddingUsage    `json:"usage"`
+}
+
+// CreateEmbeddings embeds one or more texts with the model used for RAG retrieval
+func CreateEmbeddings(services *ServiceRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req EmbeddingRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		texts, err := parseEmbeddingInput(req.Input)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		switch req.EncodingFormat {
+		case "", "float", "base64":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "encoding_format must be \"float\" or \"base64\""})
+			return
+		}
+
+		service, err := services.Embeddings()
+		if err != nil {
+			log.Printf("Failed to initialize embedding service: %v", err)
+			c.Set(middleware.QueryLogErrorMessage, err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initialize embedding service"})
+			return
+		}
+
+		// Only the pipeline's model is served; other names are rejected rather than silently remapped.
+		if req.Model != "" && req.Model != service.Model() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported model " + req.Model + "; use " + service.Model()})
+			return
+		}
+
+		c.Set(middleware.QueryLogModelProvider, service.Model())
+		c.Set(middleware.QueryLogModel, service.Model())
+
+		result, err := service.Embed(c.Request.Context(), texts)
+		if err != nil {
+			if errors.Is(err, rag.ErrNoEmbeddingInput) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Failed to create embeddings: %v", err)
+			c.Set(middleware.QueryLogErrorMessage, err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create embeddings"})
+			return
+		}
+
+		c.Set(middleware.QueryLogInputTokens, result.PromptTokens)
+
+		data := make([]EmbeddingObject, len(result.Vectors))
+		for i, vector := range result.Vectors {
+			var embedding any = vector
+			if req.EncodingFormat == "base64" {
+				embedding = encodeEmbedding(vector)
+			}
+			data[i] = EmbeddingObject{Object: "embedding", Index: i, Embedding: embedding}
+		}
+
+		c.JSON(http.StatusOK, EmbeddingResponse{
+			Object: "list",
+			Data:   data,
+			Model:  service.Model(),
+			Usage: EmbeddingUsage{
+				PromptTokens: result.PromptTokens,
+				TotalTokens:  result.PromptTokens,
+			},
+		})
+	}
+}
+
+// parseEmbeddingInput accepts a string or an array of strings. Pre-tokenized
+// (integer array) input is not supported because the model's tokenizer runs server-side.
+func parseEmbeddingInput(raw json.RawMessage) ([]string, error) {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+
+	var batch []string
+	if err := json.Unmarshal(raw, &batch); err == nil {
+		return batch, nil
+	}
+
+	return nil, errors.New("input must be a string or an array of strings")
+}
+
+func encodeEmbedding(vector []float32) string {
+	buf := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
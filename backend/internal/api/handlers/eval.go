@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/eval"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// evalRetrievalResults is how many contexts are retrieved for each golden prompt, matching
+// the generate endpoint's default.
+const evalRetrievalResults = 5
+
+// NewEvalService returns an eval service generating with the registry's RAG retriever and
+// the active provider and model. Caches are bypassed so every run measures fresh output.
+func NewEvalService(db *sql.DB, services *ServiceRegistry, cfg eval.Config) *eval.Service {
+	return eval.NewService(db, cfg, func() (eval.Target, error) {
+		selection := codegen.DefaultModelSelection()
+		retriever, err := services.RAG()
+		if err != nil {
+			return eval.Target{}, err
+		}
+		service, err := services.Model(selection)
+		if err != nil {
+			return eval.Target{}, err
+		}
+		return eval.Target{
+			Provider: selection.Provider,
+			Model:    selection.Model,
+			Generate: func(ctx context.Context, prompt string) (*codegen.CodeGenerationResponse, error) {
+				contexts, err := retriever.RetrieveContext(ctx, prompt, evalRetrievalResults, rag.Filter{})
+				if err != nil {
+					return nil, err
+				}
+				return service.GenerateCode(ctx, prompt, contexts.CodeContexts, contexts.DocsContexts, 0, 0)
+			},
+		}, nil
+	})
+}
+
+// EvalCaseRequest describes a golden prompt. On update, omitted fields are left unchanged.
+type EvalCaseRequest struct {
+	Name              *string   `json:"name"`
+	Prompt            *string   `json:"prompt"`
+	ExpectedFunctions *[]string `json:"expected_functions"`
+	// MustCompile defaults to true for new cases.
+	MustCompile   *bool    `json:"must_compile"`
+	ReferenceCode *string  `json:"reference_code"`
+	MinSimilarity *float64 `json:"min_similarity"`
+	// Enabled defaults to true for new cases.
+	Enabled *bool `json:"enabled"`
+}
+
+// apply copies the fields set in the request onto c.
+func (req EvalCaseRequest) apply(c *eval.Case) {
+	if req.Name != nil {
+		c.Name = *req.Name
+	}
+	if req.Prompt != nil {
+		c.Prompt = *req.Prompt
+	}
+	if req.ExpectedFunctions != nil {
+		c.ExpectedFunctions = *req.ExpectedFunctions
+	}
+	if req.MustCompile != nil {
+		c.MustCompile = *req.MustCompile
+	}
+	if req.ReferenceCode != nil {
+		c.ReferenceCode = *req.ReferenceCode
+	}
+	if req.MinSimilarity != nil {
+		c.MinSimilarity = *req.MinSimilarity
+	}
+	if req.Enabled != nil {
+		c.Enabled = *req.Enabled
+	}
+}
+
+// ListEvalCases returns every golden prompt.
+func ListEvalCases(evals *eval.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cases, err := evals.Cases(c.Request.Context())
+		if err != nil {
+			respondEvalError(c, err, "failed to list eval cases")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"cases": cases})
+	}
+}
+
+// CreateEvalCase adds a golden prompt.
+func CreateEvalCase(evals *eval.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req EvalCaseRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		evalCase := eval.Case{MustCompile: true, Enabled: true}
+		req.apply(&evalCase)
+		created, err := evals.CreateCase(c.Request.Context(), evalCase)
+		if err != nil {
+			respondEvalError(c, err, "failed to create eval case")
+			return
+		}
+		c.Set(middleware.AuditTargetID, strconv.FormatInt(created.ID, 10))
+		c.Set(middleware.AuditDetails, map[string]any{"name": created.Name})
+
+		c.JSON(http.StatusCreated, created)
+	}
+}
+
+// UpdateEvalCase changes a golden prompt. Later runs use the new expectations.
+func UpdateEvalCase(evals *eval.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := evalID(c)
+		if !ok {
+			return
+		}
+		var req EvalCaseRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("id"))
+
+		evalCase, err := evals.Case(c.Request.Context(), id)
+		if err != nil {
+			respondEvalError(c, err, "failed to update eval case")
+			return
+		}
+		req.apply(evalCase)
+		updated, err := evals.UpdateCase(c.Request.Context(), *evalCase)
+		if err != nil {
+			respondEvalError(c, err, "failed to update eval case")
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"name": updated.Name, "enabled": updated.Enabled})
+
+		c.JSON(http.StatusOK, updated)
+	}
+}
+
+// DeleteEvalCase removes a golden prompt. Results of past runs are kept.
+func DeleteEvalCase(evals *eval.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := evalID(c)
+		if !ok {
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("id"))
+
+		if err := evals.DeleteCase(c.Request.Context(), id); err != nil {
+			respondEvalError(c, err, "failed to delete eval case")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// TriggerEvalRun starts a run of every enabled case against the active provider.
+func TriggerEvalRun(evals *eval.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requestedBy *int64
+		if userID, ok := extractUserID(c); ok {
+			id := int64(userID)
+			requestedBy = &id
+		}
+
+		run, err := evals.Trigger(c.Request.Context(), requestedBy)
+		if err != nil {
+			respondEvalError(c, err, "failed to start eval run")
+			return
+		}
+		c.Set(middleware.AuditTargetID, strconv.FormatInt(run.ID, 10))
+		c.Set(middleware.AuditDetails, map[string]any{"provider": run.Provider, "model": run.Model, "cases": run.Total})
+
+		c.JSON(http.StatusAccepted, run)
+	}
+}
+
+// ListEvalRuns returns the most recent runs with their scores, newest first.
+func ListEvalRuns(evals *eval.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "0"))
+		if err != nil || limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		runs, err := evals.Runs(c.Request.Context(), limit)
+		if err != nil {
+			respondEvalError(c, err, "failed to list eval runs")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"runs": runs, "running": evals.Running()})
+	}
+}
+
+// GetEvalReport returns a run's per-case results compared to the run before it.
+func GetEvalReport(evals *eval.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := evalID(c)
+		if !ok {
+			return
+		}
+		report, err := evals.Report(c.Request.Context(), id)
+		if err != nil {
+			respondEvalError(c, err, "failed to get eval report")
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetLatestEvalReport reports on the most recent completed run.
+func GetLatestEvalReport(evals *eval.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := evals.LatestReport(c.Request.Context())
+		if err != nil {
+			respondEvalError(c, err, "failed to get eval report")
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+func evalID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondEvalError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, eval.ErrCaseNotFound), errors.Is(err, eval.ErrRunNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, eval.ErrInvalidCase), errors.Is(err, eval.ErrNoCases):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, eval.ErrCaseExists), errors.Is(err, eval.ErrRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Eval request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/experiment"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/prompttemplate"
+)
+
+// experimentVariantKey holds the experiment.Variant the request was assigned to.
+const experimentVariantKey = "experiment_variant"
+
+// ExperimentRequest creates or replaces an experiment.
+type ExperimentRequest struct {
+	Name        string               `json:"name" binding:"required"`
+	Description string               `json:"description"`
+	Variants    []experiment.Variant `json:"variants" binding:"required"`
+}
+
+// ListExperiments returns every experiment, newest first.
+func ListExperiments(repo *experiment.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		experiments, err := repo.List(c.Request.Context())
+		if err != nil {
+			respondExperimentError(c, err, "failed to list experiments")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"experiments": experiments})
+	}
+}
+
+// GetExperiment returns a single experiment.
+func GetExperiment(repo *experiment.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := experimentID(c)
+		if !ok {
+			return
+		}
+		e, err := repo.Get(c.Request.Context(), id)
+		if err != nil {
+			respondExperimentError(c, err, "failed to get experiment")
+			return
+		}
+		c.JSON(http.StatusOK, e)
+	}
+}
+
+// CreateExperiment stores a draft experiment; it assigns no users until started.
+func CreateExperiment(repo *experiment.Repository, templates *prompttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ExperimentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		if !requireVariantTemplates(c, templates, req.Variants) {
+			return
+		}
+
+		e := &experiment.Experiment{Name: req.Name, Description: req.Description, Variants: req.Variants}
+		if userID, ok := extractUserID(c); ok {
+			createdBy := int64(userID)
+			e.CreatedBy = &createdBy
+		}
+		if err := repo.Create(c.Request.Context(), e); err != nil {
+			respondExperimentError(c, err, "failed to create experiment")
+			return
+		}
+		c.Set(middleware.AuditTargetID, strconv.FormatInt(e.ID, 10))
+		c.Set(middleware.AuditDetails, map[string]any{"name": e.Name, "variants": e.Variants})
+
+		c.JSON(http.StatusCreated, e)
+	}
+}
+
+// UpdateExperiment replaces the name, description and variants of an experiment that is
+// not running.
+func UpdateExperiment(repo *experiment.Repository, templates *prompttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := experimentID(c)
+		if !ok {
+			return
+		}
+		var req ExperimentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("id"))
+		if !requireVariantTemplates(c, templates, req.Variants) {
+			return
+		}
+
+		e := &experiment.Experiment{ID: id, Name: req.Name, Description: req.Description, Variants: req.Variants}
+		if err := repo.Update(c.Request.Context(), e); err != nil {
+			respondExperimentError(c, err, "failed to update experiment")
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"name": e.Name, "variants": e.Variants})
+
+		c.JSON(http.StatusOK, e)
+	}
+}
+
+// DeleteExperiment removes an experiment that is not running.
+func DeleteExperiment(repo *experiment.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := experimentID(c)
+		if !ok {
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("id"))
+
+		if err := repo.Delete(c.Request.Context(), id); err != nil {
+			respondExperimentError(c, err, "failed to delete experiment")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// StartExperiment starts assigning users to the experiment's variants.
+func StartExperiment(repo *experiment.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := experimentID(c)
+		if !ok {
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("id"))
+
+		e, err := repo.Start(c.Request.Context(), id)
+		if err != nil {
+			respondExperimentError(c, err, "failed to start experiment")
+			return
+		}
+		c.JSON(http.StatusOK, e)
+	}
+}
+
+// StopExperiment stops assigning users; their requests return to their defaults.
+func StopExperiment(repo *experiment.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := experimentID(c)
+		if !ok {
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("id"))
+
+		e, err := repo.Stop(c.Request.Context(), id)
+		if err != nil {
+			respondExperimentError(c, err, "failed to stop experiment")
+			return
+		}
+		c.JSON(http.StatusOK, e)
+	}
+}
+
+// GetExperimentResults compares the success rate, latency, cost and feedback of each variant.
+func GetExperimentResults(repo *experiment.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := experimentID(c)
+		if !ok {
+			return
+		}
+		results, err := repo.Results(c.Request.Context(), id)
+		if err != nil {
+			respondExperimentError(c, err, "failed to get experiment results")
+			return
+		}
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+// requireVariantTemplates answers 400 and reports false when a variant names a prompt
+// template that does not exist or does not parse.
+func requireVariantTemplates(c *gin.Context, templates *prompttemplate.Repository, variants []experiment.Variant) bool {
+	for _, v := range variants {
+		if v.PromptTemplate == "" {
+			continue
+		}
+		tmpl, err := templates.Get(c.Request.Context(), v.PromptTemplate)
+		if err == nil {
+			_, err = tmpl.Parse()
+		}
+		if err != nil {
+			respondExperimentError(c, fmt.Errorf("%w: variant %s: prompt_template %s: %v", experiment.ErrInvalid, v.Name, v.PromptTemplate, err), "failed to load prompt template")
+			return false
+		}
+	}
+	return true
+}
+
+func experimentID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondExperimentError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, experiment.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, experiment.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, experiment.ErrExists), errors.Is(err, experiment.ErrRunning), errors.Is(err, experiment.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Experiment request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// assignExperiment enrolls the caller in the running experiment, if any. The assigned
+// variant's model replaces the caller's default in applyUserSettings and its prompt template
+// is used by usePromptTemplate, and the query log records the variant. Requests that name a
+// model or prompt template choose for themselves and are left out, as are variants that can
+// no longer serve, e.g. after their model left the allowlist, so every logged request of a
+// variant was generated with it. Call it before applyUserSettings and usePromptTemplate.
+func assignExperiment(c *gin.Context, db *sql.DB, requestedModel, requestedTemplate string) {
+	if requestedModel != "" || requestedTemplate != "" {
+		return
+	}
+	userID, ok := extractUserID(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	running, err := experiment.NewRepository(db).Running(ctx)
+	if err != nil {
+		log.Printf("Failed to load the running experiment: %v", err)
+		return
+	}
+	if running == nil {
+		return
+	}
+	variant, ok := running.Assign(int64(userID))
+	if !ok {
+		return
+	}
+
+	if variant.ChangesModel() {
+		if _, err := variant.Selection(); err != nil {
+			log.Printf("Skipping experiment %s variant %s: %v", running.Name, variant.Name, err)
+			return
+		}
+	}
+	if variant.PromptTemplate != "" {
+		if _, err := prompttemplate.NewRepository(db, prompttemplate.DirFromEnv()).Get(ctx, variant.PromptTemplate); err != nil {
+			log.Printf("Skipping experiment %s variant %s: prompt template %s: %v", running.Name, variant.Name, variant.PromptTemplate, err)
+			return
+		}
+	}
+
+	c.Set(experimentVariantKey, variant)
+	c.Set(middleware.QueryLogExperimentID, running.ID)
+	c.Set(middleware.QueryLogVariant, variant.Name)
+}
+
+// assignedVariant returns the variant assignExperiment assigned the request to.
+func assignedVariant(c *gin.Context) (experiment.Variant, bool) {
+	value, ok := c.Get(experimentVariantKey)
+	if !ok {
+		return experiment.Variant{}, false
+	}
+	variant, ok := value.(experiment.Variant)
+	return variant, ok
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/feedback"
+)
+
+// SubmitFeedbackRequest rates a generated answer, identified by the query log of the request
+// that produced it or by an assistant turn of a conversation.
+type SubmitFeedbackRequest struct {
+	QueryLogID     *int64 `json:"query_log_id"`
+	ConversationID *int64 `json:"conversation_id"`
+	TurnIndex      *int   `json:"turn_index"`
+	// Rating is "up" or "down".
+	Rating   string `json:"rating" binding:"required"`
+	Category string `json:"category"`
+	Comment  string `json:"comment"`
+}
+
+// SubmitFeedback records the caller's rating of an answer. Rating the same answer again
+// replaces the earlier rating.
+func SubmitFeedback(repo *feedback.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to resolve authenticated user"})
+			return
+		}
+
+		var req SubmitFeedbackRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		fb := &feedback.Feedback{
+			UserID:         int64(userID),
+			QueryLogID:     req.QueryLogID,
+			ConversationID: req.ConversationID,
+			TurnIndex:      req.TurnIndex,
+			Rating:         strings.ToLower(strings.TrimSpace(req.Rating)),
+			Category:       strings.ToLower(strings.TrimSpace(req.Category)),
+			Comment:        strings.TrimSpace(req.Comment),
+		}
+		created, err := repo.Submit(c.Request.Context(), fb)
+		switch {
+		case errors.Is(err, feedback.ErrInvalidFeedback):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, feedback.ErrTargetNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to record feedback for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record feedback"})
+			return
+		}
+
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		c.JSON(status, fb)
+	}
+}
+
+// ListFeedback returns feedback filtered by rating, category, endpoint, model_provider and
+// date range, newest first.
+func ListFeedback(repo *feedback.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+		params := feedback.ListParams{
+			Rating:        c.Query("rating"),
+			Category:      c.Query("category"),
+			Endpoint:      c.Query("endpoint"),
+			ModelProvider: c.Query("model_provider"),
+			Page:          page,
+			Limit:         limit,
+		}
+		if start, ok := parseDate(c.Query("start_date")); ok {
+			params.StartDate = &start
+		}
+		if end, ok := parseDate(c.Query("end_date")); ok {
+			params.EndDate = &end
+		}
+
+		items, total, err := repo.List(c.Request.Context(), params)
+		if err != nil {
+			log.Printf("Failed to list feedback: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list feedback"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"items": items,
+			"total": total,
+			"page":  page,
+			"limit": limit,
+		})
+	}
+}
+
+// GetFeedbackStats summarises ratings over a date range by provider, endpoint and category.
+func GetFeedbackStats(repo *feedback.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var startDate, endDate *time.Time
+		if start, ok := parseDate(c.Query("start_date")); ok {
+			startDate = &start
+		}
+		if end, ok := parseDate(c.Query("end_date")); ok {
+			endDate = &end
+		}
+
+		stats, err := repo.Stats(c.Request.Context(), startDate, endDate)
+		if err != nil {
+			log.Printf("Failed to fetch feedback stats: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch feedback stats"})
+			return
+		}
+
+		c.JSON(http.StatusOK, stats)
+	}
+}
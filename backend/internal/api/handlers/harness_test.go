@@ -0,0 +1,31 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/testharness"
+)
+
+func newHarness(t *testing.T) *testharness.Harness {
+	t.Helper()
+	h, err := testharness.New()
+	if err != nil {
+		t.Fatalf("create harness: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+// newAPIKey creates a user with a personal API key.
+func newAPIKey(t *testing.T, h *testharness.Harness) string {
+	t.Helper()
+	userID, err := h.CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	key, err := h.CreateAPIKey(userID)
+	if err != nil {
+		t.Fatalf("create API key: %v", err)
+	}
+	return key
+}
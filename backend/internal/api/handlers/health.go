@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/health"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/redis"
+)
+
+// NewHealthChecker registers the database and RAG backend as critical dependencies and the
+// configured LLM provider as a non-critical one (retrieval keeps working without it). Redis,
+// when REDIS_URL is set, is non-critical too.
+func NewHealthChecker(db *sql.DB, services *ServiceRegistry, cfg health.Config) *health.Checker {
+	checker := health.NewChecker(cfg)
+
+	checker.Register("database", true, db.PingContext)
+
+	checker.Register("rag", true, func(ctx context.Context) error {
+		service, err := services.RAG()
+		if err != nil {
+			return err
+		}
+		if probe, ok := service.(interface{ HealthCheck(context.Context) error }); ok {
+			return probe.HealthCheck(ctx)
+		}
+		return nil
+	})
+
+	checker.Register("llm_provider", false, func(ctx context.Context) error {
+		service, err := services.activeModel(codegen.ActiveProvider())
+		if err != nil {
+			return err
+		}
+		if probe, ok := service.(codegen.HealthChecker); ok {
+			return probe.HealthCheck(ctx)
+		}
+		return nil
+	})
+
+	// Redis backs the shared cache, rate limits and token revocation. API key traffic keeps
+	// working without it, since the cache and rate limiter fail open.
+	if redisURL := strings.TrimSpace(os.Getenv("REDIS_URL")); redisURL != "" {
+		client, err := redis.New(redisURL)
+		checker.Register("redis", false, func(ctx context.Context) error {
+			if err != nil {
+				return err
+			}
+			return client.Ping(ctx)
+		})
+	}
+
+	return checker
+}
+
+// HealthLive reports that the process is up. It never probes dependencies.
+func HealthLive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+	}
+}
+
+// HealthReady probes dependencies and returns per-component status.
+// It responds 503 when a critical dependency is down.
+func HealthReady(checker *health.Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := checker.Check(c.Request.Context())
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
@@ -1,68 +1,231 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/ingestion"
 )
 
-// CloneRepos handles repository cloning
-func CloneRepos(db *sql.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// TODO: Implement repository cloning
-		c.JSON(http.StatusNotImplemented, gin.H{
-			"error": "Not implemented yet",
-		})
-	}
+// CloneRepos queues a job that clones the Clarity sample repositories and documentation
+func CloneRepos(manager *ingestion.Manager) gin.HandlerFunc {
+	return enqueueIngestionJob(manager, ingestion.JobTypeCloneRepos)
+}
+
+// IngestSamples queues a job that ingests the cloned code samples into ChromaDB
+func IngestSamples(manager *ingestion.Manager) gin.HandlerFunc {
+	return enqueueIngestionJob(manager, ingestion.JobTypeIngestSamples)
+}
+
+// IngestDocs queues a job that ingests the cloned documentation into ChromaDB
+func IngestDocs(manager *ingestion.Manager) gin.HandlerFunc {
+	return enqueueIngestionJob(manager, ingestion.JobTypeIngestDocs)
 }
 
-// IngestSamples handles code sample ingestion
-func IngestSamples(db *sql.DB) gin.HandlerFunc {
+// IngestRepoRequest selects a git repository to clone and index.
+type IngestRepoRequest struct {
+	URL     string   `json:"url" binding:"required"`
+	Branch  string   `json:"branch"`
+	Name    string   `json:"name"`
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// Replace removes the repository's existing chunks before indexing, so files deleted
+	// upstream drop out of the index.
+	Replace bool `json:"replace"`
+	// Chunking overrides INGESTION_CHUNK_SIZE and INGESTION_CHUNK_OVERLAP for this job.
+	Chunking *ingestion.ChunkOptions `json:"chunking"`
+}
+
+// IngestJobRequest is the optional body of the clone and ingest endpoints.
+type IngestJobRequest struct {
+	// Chunking overrides how /api/v1/ingest/samples splits Clarity contracts.
+	Chunking *ingestion.ChunkOptions `json:"chunking"`
+}
+
+// IngestRepo queues a job that clones a git repository and indexes its matching files into the code sample collection
+func IngestRepo(manager *ingestion.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// TODO: Implement code sample ingestion
-		c.JSON(http.StatusNotImplemented, gin.H{
-			"error": "Not implemented yet",
+		var req IngestRepoRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var requestedBy *int64
+		if userID, ok := extractUserID(c); ok {
+			id := int64(userID)
+			requestedBy = &id
+		}
+
+		job, err := manager.EnqueueRepo(c.Request.Context(), ingestion.RepoSource{
+			URL:     req.URL,
+			Branch:  req.Branch,
+			Name:    req.Name,
+			Include: req.Include,
+			Exclude: req.Exclude,
+			Replace: req.Replace,
+		}, req.Chunking, requestedBy)
+		switch {
+		case errors.Is(err, ingestion.ErrInvalidSource), errors.Is(err, ingestion.ErrInvalidChunking):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, ingestion.ErrIndexerRequired):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, ingestion.ErrJobActive):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+				"job":   job,
+			})
+			return
+		case errors.Is(err, ingestion.ErrQueueFull):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to enqueue repository ingestion job: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enqueue ingestion job"})
+			return
+		}
+
+		c.Set(middleware.AuditTargetID, job.ID)
+		c.Set(middleware.AuditDetails, map[string]any{
+			"job_type": job.JobType,
+			"url":      job.Source.URL,
+			"branch":   job.Source.Branch,
+			"chunking": job.Chunking,
 		})
+
+		c.JSON(http.StatusAccepted, job)
 	}
 }
 
-// IngestDocs handles documentation ingestion
-func IngestDocs(db *sql.DB) gin.HandlerFunc {
+func enqueueIngestionJob(manager *ingestion.Manager, jobType string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// TODO: Implement documentation ingestion
-		c.JSON(http.StatusNotImplemented, gin.H{
-			"error": "Not implemented yet",
-		})
+		// The body is optional.
+		var req IngestJobRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var requestedBy *int64
+		if userID, ok := extractUserID(c); ok {
+			id := int64(userID)
+			requestedBy = &id
+		}
+
+		job, err := manager.Enqueue(c.Request.Context(), jobType, req.Chunking, requestedBy)
+		switch {
+		case errors.Is(err, ingestion.ErrInvalidChunking):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, ingestion.ErrJobActive):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+				"job":   job,
+			})
+			return
+		case errors.Is(err, ingestion.ErrQueueFull):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to enqueue %s job: %v", jobType, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enqueue ingestion job"})
+			return
+		}
+
+		c.Set(middleware.AuditTargetID, job.ID)
+		details := map[string]any{"job_type": jobType}
+		if job.Chunking != nil {
+			details["chunking"] = job.Chunking
+		}
+		c.Set(middleware.AuditDetails, details)
+
+		c.JSON(http.StatusAccepted, job)
 	}
 }
 
-// ListIngestionJobs lists all ingestion jobs
-func ListIngestionJobs(db *sql.DB) gin.HandlerFunc {
+// ListIngestionJobs lists ingestion jobs, newest first
+func ListIngestionJobs(manager *ingestion.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// TODO: Implement ingestion job listing
-		c.JSON(http.StatusNotImplemented, gin.H{
-			"error": "Not implemented yet",
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+		jobs, total, err := manager.Repository().List(c.Request.Context(), ingestion.ListParams{
+			Page:    page,
+			Limit:   limit,
+			Status:  c.Query("status"),
+			JobType: c.Query("job_type"),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list ingestion jobs"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"jobs":  jobs,
+			"total": total,
+			"page":  page,
+			"limit": limit,
 		})
 	}
 }
 
 // GetIngestionJob retrieves a specific ingestion job status
-func GetIngestionJob(db *sql.DB) gin.HandlerFunc {
+func GetIngestionJob(manager *ingestion.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// TODO: Implement ingestion job status retrieval
-		c.JSON(http.StatusNotImplemented, gin.H{
-			"error": "Not implemented yet",
-		})
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		job, err := manager.Repository().Get(c.Request.Context(), id)
+		if err != nil {
+			if errors.Is(err, ingestion.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "ingestion job not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch ingestion job"})
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
 	}
 }
 
-// CancelIngestionJob cancels a running ingestion job
-func CancelIngestionJob(db *sql.DB) gin.HandlerFunc {
+// CancelIngestionJob cancels a queued or running ingestion job
+func CancelIngestionJob(manager *ingestion.Manager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// TODO: Implement ingestion job cancellation
-		c.JSON(http.StatusNotImplemented, gin.H{
-			"error": "Not implemented yet",
-		})
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		job, err := manager.Cancel(c.Request.Context(), id)
+		switch {
+		case errors.Is(err, ingestion.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "ingestion job not found"})
+			return
+		case errors.Is(err, ingestion.ErrJobFinished):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+				"job":   job,
+			})
+			return
+		case err != nil:
+			log.Printf("Failed to cancel ingestion job %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel ingestion job"})
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
 	}
 }
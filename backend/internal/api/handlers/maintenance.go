@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+)
+
+// UpdateMaintenanceRequest replaces the maintenance state: partial (per-route) maintenance,
+// and maintenance of the whole API, now or in a scheduled window. Message is shown to
+// clients blocked by either.
+type UpdateMaintenanceRequest struct {
+	DisabledRoutes []string `json:"disabled_routes"`
+	Message        string   `json:"message"`
+	// Enabled puts the whole API in maintenance now, until ends_at or until switched off.
+	Enabled bool `json:"enabled"`
+	// StartsAt schedules maintenance of the whole API instead, until ends_at or until
+	// switched off.
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+}
+
+// GetMaintenance returns the current global and per-route maintenance state.
+func GetMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, maintenanceState())
+	}
+}
+
+// UpdateMaintenance replaces the set of route prefixes disabled for maintenance and the
+// maintenance schedule of the whole API.
+func UpdateMaintenance() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req UpdateMaintenanceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		schedule := middleware.MaintenanceSchedule{
+			Enabled:  req.Enabled,
+			StartsAt: req.StartsAt,
+			EndsAt:   req.EndsAt,
+			Message:  req.Message,
+		}
+		if err := middleware.SetMaintenanceSchedule(schedule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		middleware.SetRouteMaintenance(req.DisabledRoutes, req.Message)
+		c.Set(middleware.AuditDetails, map[string]any{
+			"disabled_routes": req.DisabledRoutes,
+			"message":         req.Message,
+			"enabled":         req.Enabled,
+			"starts_at":       req.StartsAt,
+			"ends_at":         req.EndsAt,
+		})
+
+		c.JSON(http.StatusOK, maintenanceState())
+	}
+}
+
+func maintenanceState() gin.H {
+	routes, message := middleware.RouteMaintenance()
+	return gin.H{
+		"enabled":         middleware.IsMaintenanceMode(),
+		"disabled_routes": routes,
+		"message":         message,
+		"schedule":        middleware.CurrentMaintenanceSchedule(),
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/models"
+)
+
+// ModelObject is an OpenAI-compatible model description extended with registry capabilities.
+type ModelObject struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+	models.Model
+	Active     bool `json:"active"`
+	Deprecated bool `json:"deprecated"`
+	// Available marks models callers may select with the chat completion "model" field.
+	Available bool `json:"available"`
+}
+
+// ModelListResponse is an OpenAI-compatible model list.
+type ModelListResponse struct {
+	Object string        `json:"object"`
+	Data   []ModelObject `json:"data"`
+}
+
+// ListModels returns the models callers may select in the OpenAI /v1/models format, with
+// registry capabilities for the models the registry knows.
+func ListModels() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registry := models.Default()
+		active := codegen.DefaultModelSelection().Model
+
+		data := make([]ModelObject, 0)
+		for _, id := range codegen.AllowedModels() {
+			m, ok := registry.Lookup(id)
+			if !ok {
+				m = models.Model{ID: id, Provider: codegen.ModelProvider(id)}
+			}
+			object := newModelObject(m, active, registry.LoadedAt())
+			object.Available = true
+			data = append(data, object)
+		}
+
+		c.JSON(http.StatusOK, ModelListResponse{Object: "list", Data: data})
+	}
+}
+
+// GetModel returns a single registry or allowlisted model in the OpenAI format.
+func GetModel() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registry := models.Default()
+		id := c.Param("id")
+		available := slices.Contains(codegen.AllowedModels(), id)
+
+		m, ok := registry.Lookup(id)
+		if !ok {
+			if !available {
+				c.JSON(http.StatusNotFound, gin.H{"error": "model not found"})
+				return
+			}
+			m = models.Model{ID: id, Provider: codegen.ModelProvider(id)}
+		}
+
+		object := newModelObject(m, codegen.DefaultModelSelection().Model, registry.LoadedAt())
+		object.Available = available
+		c.JSON(http.StatusOK, object)
+	}
+}
+
+// ReloadModelRegistry re-reads MODEL_REGISTRY_FILE so capability changes apply without a redeploy.
+func ReloadModelRegistry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registry := models.Default()
+		if err := registry.Reload(); err != nil {
+			log.Printf("Failed to reload model registry: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to reload model registry: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"models":    registry.List(),
+			"loaded_at": registry.LoadedAt(),
+		})
+	}
+}
+
+func newModelObject(m models.Model, active string, loadedAt time.Time) ModelObject {
+	return ModelObject{
+		ID:         m.ID,
+		Object:     "model",
+		Created:    loadedAt.Unix(),
+		OwnedBy:    m.Provider,
+		Model:      m,
+		Active:     m.ID == active,
+		Deprecated: m.Deprecated(time.Now()),
+	}
+}
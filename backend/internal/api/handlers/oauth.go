@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+)
+
+// ListOAuthProviders lists the enabled social login providers
+// @Summary List OAuth providers
+// @Description List the providers that can be used with /auth/oauth/{provider}
+// @Tags Authentication
+// @Produce json
+// @Success 200 {object} map[string]interface{} "Enabled providers"
+// @Router /auth/oauth/providers [get]
+func ListOAuthProviders(oauth *auth.OAuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"providers": oauth.Providers()})
+	}
+}
+
+// OAuthAuthorize starts a social login
+// @Summary Start OAuth login
+// @Description Redirect to the provider's consent page; the provider then redirects back to the callback. An HttpOnly oauth_state cookie binds the login to the browser.
+// @Tags Authentication
+// @Param provider path string true "github or google"
+// @Success 302 "Redirect to the provider"
+// @Failure 404 {object} map[string]interface{} "Provider not enabled"
+// @Router /auth/oauth/{provider} [get]
+func OAuthAuthorize(oauth *auth.OAuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorizeURL, state, err := oauth.AuthorizeURL(c.Request.Context(), c.Param("provider"))
+		if errors.Is(err, auth.ErrOAuthProviderDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to start %s login: %v", c.Param("provider"), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+		http.SetCookie(c.Writer, oauth.StateCookie(state))
+		c.Redirect(http.StatusFound, authorizeURL)
+	}
+}
+
+// OAuthCallback completes a social login and issues session tokens
+// @Summary Complete OAuth login
+// @Description Exchange the provider's authorization code, link or create the user and issue the same session tokens as password login. When OAUTH_SUCCESS_REDIRECT_URL is set successful logins redirect there with the tokens in the URL fragment.
+// @Tags Authentication
+// @Produce json
+// @Param provider path string true "github or google"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from the authorize redirect"
+// @Success 200 {object} map[string]interface{} "Authentication successful"
+// @Failure 400 {object} map[string]interface{} "Invalid state, missing state cookie or denied consent"
+// @Failure 401 {object} map[string]interface{} "Account inactive"
+// @Failure 404 {object} map[string]interface{} "Provider not enabled"
+// @Failure 502 {object} map[string]interface{} "Provider request failed"
+// @Router /auth/oauth/{provider}/callback [get]
+func OAuthCallback(oauth *auth.OAuthService, tokens *auth.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider := c.Param("provider")
+		c.Set(middleware.AuditDetails, map[string]any{"provider": provider})
+
+		if denied := c.Query("error"); denied != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Login was not authorized: " + denied})
+			return
+		}
+
+		// The state cookie is single use, like the state it carries.
+		cookieState, _ := c.Cookie(auth.OAuthStateCookie)
+		expired := oauth.StateCookie("")
+		expired.MaxAge = -1
+		http.SetCookie(c.Writer, expired)
+
+		login, err := oauth.Complete(c.Request.Context(), provider, c.Query("code"), c.Query("state"), cookieState)
+		switch {
+		case errors.Is(err, auth.ErrOAuthProviderDisabled):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, auth.ErrOAuthInvalidState):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, auth.ErrOAuthAccountInactive):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to complete %s login: %v", provider, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to complete login with " + provider})
+			return
+		}
+		user := login.User
+		c.Set(middleware.AuditActorID, user.ID)
+		c.Set(middleware.AuditActorUsername, user.Username)
+		c.Set(middleware.AuditTargetID, user.ID)
+		c.Set(middleware.AuditDetails, map[string]any{"provider": provider, "created": login.Created, "linked": login.Linked})
+
+		pair, err := tokens.Issue(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue session tokens"})
+			return
+		}
+
+		if redirect := oauth.SuccessRedirectURL(); redirect != "" {
+			fragment := url.Values{
+				"access_token":       {pair.AccessToken},
+				"token_type":         {pair.TokenType},
+				"expires_in":         {strconv.FormatInt(pair.ExpiresIn, 10)},
+				"refresh_token":      {pair.RefreshToken},
+				"refresh_expires_in": {strconv.FormatInt(pair.RefreshExpiresIn, 10)},
+			}
+			c.Redirect(http.StatusFound, redirect+"#"+fragment.Encode())
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":            true,
+			"message":            "Authentication successful",
+			"user_id":            user.ID,
+			"username":           user.Username,
+			"role":               user.Role,
+			"provider":           provider,
+			"created":            login.Created,
+			"access_token":       pair.AccessToken,
+			"token_type":         pair.TokenType,
+			"expires_in":         pair.ExpiresIn,
+			"refresh_token":      pair.RefreshToken,
+			"refresh_expires_in": pair.RefreshExpiresIn,
+		})
+	}
+}
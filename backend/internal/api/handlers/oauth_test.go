@@ -0,0 +1,75 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testharness"
+)
+
+// startOAuthLogin begins a GitHub login and returns the state sent to the provider and the
+// state cookie set on the browser.
+func startOAuthLogin(t *testing.T, h *testharness.Harness) (string, *http.Cookie) {
+	t.Helper()
+	rec, _ := h.Do(http.MethodGet, "/api/v1/auth/oauth/github", nil, nil)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("authorize: got %d, want 302: %s", rec.Code, rec.Body)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("parse redirect: %v", err)
+	}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == auth.OAuthStateCookie {
+			return location.Query().Get("state"), cookie
+		}
+	}
+	t.Fatal("authorize: no state cookie")
+	return "", nil
+}
+
+func TestOAuthAuthorizeSetsStateCookie(t *testing.T) {
+	t.Setenv("GITHUB_CLIENT_ID", "client")
+	t.Setenv("GITHUB_CLIENT_SECRET", "secret")
+	h := newHarness(t)
+
+	state, cookie := startOAuthLogin(t, h)
+	if state == "" || cookie.Value != state {
+		t.Fatalf("state cookie %q does not carry the redirect's state %q", cookie.Value, state)
+	}
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("state cookie must be HttpOnly and SameSite=Lax: %+v", cookie)
+	}
+}
+
+func TestOAuthCallbackRequiresMatchingStateCookie(t *testing.T) {
+	t.Setenv("GITHUB_CLIENT_ID", "client")
+	t.Setenv("GITHUB_CLIENT_SECRET", "secret")
+	h := newHarness(t)
+
+	// The attacker starts a login and hands the victim its callback URL.
+	attackerState, _ := startOAuthLogin(t, h)
+	_, victimCookie := startOAuthLogin(t, h)
+	callback := "/api/v1/auth/oauth/github/callback?code=attacker-code&state=" + url.QueryEscape(attackerState)
+
+	for name, headers := range map[string]map[string]string{
+		"no cookie":             nil,
+		"another login's state": {"Cookie": victimCookie.Name + "=" + victimCookie.Value},
+	} {
+		rec, _ := h.Do(http.MethodGet, callback, nil, headers)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: got %d, want 400: %s", name, rec.Code, rec.Body)
+		}
+	}
+
+	// Rejected callbacks leave the state unused.
+	var states int
+	if err := h.DB.QueryRow(`SELECT COUNT(*) FROM oauth_states`).Scan(&states); err != nil {
+		t.Fatalf("count states: %v", err)
+	}
+	if states != 2 {
+		t.Fatalf("%d oauth states left, want 2", states)
+	}
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/org"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/usage"
+)
+
+// CreateOrgRequest names a new organization.
+type CreateOrgRequest struct {
+	Name string `json:"name" binding:"required,min=2,max=100"`
+}
+
+// AddOrgMemberRequest invites an existing user into an organization. Role defaults to "member".
+type AddOrgMemberRequest struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role"`
+}
+
+// CreateOrg creates an organization owned by the authenticated user.
+func CreateOrg(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		var req CreateOrgRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		organization, err := org.NewRepository(db).Create(c.Request.Context(), strings.TrimSpace(req.Name), int64(userID))
+		if err != nil {
+			if errors.Is(err, org.ErrNameTaken) {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Failed to create organization: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create organization"})
+			return
+		}
+		c.Set(middleware.AuditTargetID, organization.ID)
+		c.Set(middleware.AuditDetails, map[string]any{"name": organization.Name})
+
+		c.JSON(http.StatusCreated, organization)
+	}
+}
+
+// ListOrgs returns the organizations the authenticated user belongs to.
+func ListOrgs(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		orgs, err := org.NewRepository(db).ListForUser(c.Request.Context(), int64(userID))
+		if err != nil {
+			log.Printf("Failed to list organizations: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list organizations"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"organizations": orgs})
+	}
+}
+
+// GetOrg returns an organization and its members to one of its members.
+func GetOrg(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repo := org.NewRepository(db)
+		orgID, _, role, ok := requireOrgMember(c, repo, false)
+		if !ok {
+			return
+		}
+
+		organization, err := repo.Get(c.Request.Context(), orgID)
+		if err != nil {
+			respondOrgError(c, err, "failed to get organization")
+			return
+		}
+		organization.Role = role
+
+		members, err := repo.Members(c.Request.Context(), orgID)
+		if err != nil {
+			respondOrgError(c, err, "failed to list members")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"organization": organization,
+			"members":      members,
+		})
+	}
+}
+
+// AddOrgMember adds an existing user to the organization. Only owners can add members.
+func AddOrgMember(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repo := org.NewRepository(db)
+		orgID, _, _, ok := requireOrgMember(c, repo, true)
+		if !ok {
+			return
+		}
+
+		var req AddOrgMemberRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		if req.Role == "" {
+			req.Role = org.RoleMember
+		}
+		if !org.ValidRole(req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be \"owner\" or \"member\""})
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"username": req.Username, "role": req.Role})
+
+		member, err := repo.AddMember(c.Request.Context(), orgID, req.Username, req.Role)
+		if err != nil {
+			respondOrgError(c, err, "failed to add member")
+			return
+		}
+		c.JSON(http.StatusCreated, member)
+	}
+}
+
+// RemoveOrgMember removes a member from the organization and revokes the organization keys
+// they created. Owners can remove anyone, and any member can remove themselves; the last
+// owner cannot leave.
+func RemoveOrgMember(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repo := org.NewRepository(db)
+		orgID, userID, role, ok := requireOrgMember(c, repo, false)
+		if !ok {
+			return
+		}
+
+		memberID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		if role != org.RoleOwner && memberID != int64(userID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only owners can remove other members"})
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"user_id": memberID})
+
+		if err := repo.RemoveMember(c.Request.Context(), orgID, memberID); err != nil {
+			respondOrgError(c, err, "failed to remove member")
+			return
+		}
+		revoked, err := auth.RevokeMemberOrgAPIKeys(db, int(orgID), int(memberID), userID)
+		if err != nil {
+			log.Printf("Failed to revoke organization %d keys of removed member %d: %v", orgID, memberID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "member removed, but failed to revoke their API keys"})
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"user_id": memberID, "revoked_keys": revoked})
+		c.JSON(http.StatusOK, gin.H{"success": true, "revoked_keys": revoked})
+	}
+}
+
+// CreateOrgAPIKey issues an API key owned by the organization. Any member can create one.
+func CreateOrgAPIKey(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, userID, _, ok := requireOrgMember(c, org.NewRepository(db), false)
+		if !ok {
+			return
+		}
+
+		var req auth.CreateAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			req = auth.CreateAPIKeyRequest{}
+		}
+
+		expiresAt, err := auth.ResolveAPIKeyExpiry(req.ExpiresIn, req.ExpiresAt, time.Now())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		apiKeyResp, err := auth.CreateOrgAPIKey(db, int(orgID), userID, req.Name, expiresAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(middleware.AuditTargetID, apiKeyResp.ID)
+		c.Set(middleware.AuditDetails, map[string]any{
+			"org_id":     orgID,
+			"name":       apiKeyResp.Name,
+			"prefix":     apiKeyResp.Prefix,
+			"expires_at": apiKeyResp.ExpiresAt,
+		})
+
+		c.JSON(http.StatusCreated, gin.H{
+			"success":    true,
+			"message":    "API key created successfully",
+			"id":         apiKeyResp.ID,
+			"api_key":    apiKeyResp.APIKey,
+			"name":       apiKeyResp.Name,
+			"prefix":     apiKeyResp.Prefix,
+			"expires_at": apiKeyResp.ExpiresAt,
+			"org_id":     orgID,
+		})
+	}
+}
+
+// ListOrgAPIKeys returns the organization's active API keys to its members.
+func ListOrgAPIKeys(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _, _, ok := requireOrgMember(c, org.NewRepository(db), false)
+		if !ok {
+			return
+		}
+
+		keys, err := auth.GetOrgAPIKeys(db, int(orgID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, keys)
+	}
+}
+
+// RevokeOrgAPIKey revokes one of the organization's API keys. Only owners can revoke keys.
+func RevokeOrgAPIKey(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, userID, _, ok := requireOrgMember(c, org.NewRepository(db), true)
+		if !ok {
+			return
+		}
+
+		keyID, err := strconv.Atoi(c.Param("key_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+			return
+		}
+		c.Set(middleware.AuditTargetID, keyID)
+		c.Set(middleware.AuditDetails, map[string]any{"org_id": orgID})
+
+		if err := auth.RevokeOrgAPIKey(db, int(orgID), keyID, userID); err != nil {
+			if errors.Is(err, auth.ErrAPIKeyNotOwned) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "API key not found in organization"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "API key revoked successfully",
+		})
+	}
+}
+
+// GetOrgUsage returns the organization's pooled token usage and quota for the current month
+// to its members.
+func GetOrgUsage(db *sql.DB, service *usage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, _, _, ok := requireOrgMember(c, org.NewRepository(db), false)
+		if !ok {
+			return
+		}
+
+		respondWithOrgUsage(c, service, orgID)
+	}
+}
+
+// GetAdminOrgUsage returns any organization's token usage and quota for the current month
+func GetAdminOrgUsage(service *usage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		respondWithOrgUsage(c, service, orgID)
+	}
+}
+
+// UpdateOrgQuota sets an organization's pooled monthly token quota. A null or zero limit
+// means unlimited.
+func UpdateOrgQuota(service *usage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orgID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		var req UpdateQuotaRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		if req.MonthlyTokenLimit != nil && *req.MonthlyTokenLimit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "monthly_token_limit must not be negative"})
+			return
+		}
+
+		if err := service.SetOrgLimit(c.Request.Context(), orgID, req.MonthlyTokenLimit); err != nil {
+			if errors.Is(err, usage.ErrOrgNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
+				return
+			}
+			log.Printf("Failed to update quota for organization %d: %v", orgID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update quota"})
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"monthly_token_limit": req.MonthlyTokenLimit})
+
+		respondWithOrgUsage(c, service, orgID)
+	}
+}
+
+func respondWithOrgUsage(c *gin.Context, service *usage.Service, orgID int64) {
+	summary, err := service.OrgSummary(c.Request.Context(), orgID)
+	if err != nil {
+		if errors.Is(err, usage.ErrOrgNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "organization not found"})
+			return
+		}
+		log.Printf("Failed to compute usage for organization %d: %v", orgID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// requireOrgMember resolves the :id organization and the caller's role in it, answering 404
+// to non-members so organization IDs are not disclosed, and 403 to members when ownerOnly.
+func requireOrgMember(c *gin.Context, repo *org.Repository, ownerOnly bool) (int64, int, string, bool) {
+	userID, ok := extractUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return 0, 0, "", false
+	}
+
+	orgID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, 0, "", false
+	}
+
+	role, err := repo.MemberRole(c.Request.Context(), orgID, int64(userID))
+	if err != nil {
+		respondOrgError(c, err, "failed to check membership")
+		return 0, 0, "", false
+	}
+	if ownerOnly && role != org.RoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"error": "organization owner role required"})
+		return 0, 0, "", false
+	}
+	return orgID, userID, role, true
+}
+
+func respondOrgError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, org.ErrNotFound), errors.Is(err, org.ErrNotMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, org.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, org.ErrAlreadyMember), errors.Is(err, org.ErrNameTaken), errors.Is(err, org.ErrLastOwner):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Organization request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,114 @@
+package handlers_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/credential"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/org"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testharness"
+)
+
+// newOrg creates alice's organization "acme" with bob as a member, and an organization key
+// created by each of them.
+func newOrg(t *testing.T, h *testharness.Harness) (orgID int64, alice, bob int, aliceKey, bobKey string) {
+	t.Helper()
+	alice, err := h.CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	bob, err = h.CreateUser("bob", "password123", "user")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	repo := org.NewRepository(h.DB)
+	organization, err := repo.Create(context.Background(), "acme", int64(alice))
+	if err != nil {
+		t.Fatalf("create organization: %v", err)
+	}
+	if _, err := repo.AddMember(context.Background(), organization.ID, "bob", org.RoleMember); err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+
+	created := make([]string, 0, 2)
+	for _, creator := range []int{alice, bob} {
+		key, err := auth.CreateOrgAPIKey(h.DB, int(organization.ID), creator, "shared", nil)
+		if err != nil {
+			t.Fatalf("create organization key: %v", err)
+		}
+		created = append(created, key.APIKey)
+	}
+	return organization.ID, alice, bob, created[0], created[1]
+}
+
+func TestOrgKeyDoesNotActAsItsCreator(t *testing.T) {
+	t.Setenv("BYOK_ENCRYPTION_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	h := newHarness(t)
+	_, alice, _, aliceKey, _ := newOrg(t, h)
+
+	// Alice's own provider keys must not be billed for requests made with her org key.
+	store := credential.NewStore(h.DB, credential.ConfigFromEnv())
+	for _, provider := range []string{codegen.ProviderGemini, codegen.ProviderOpenAI, codegen.ProviderClaude} {
+		if _, err := store.Set(context.Background(), alice, provider, "sk-alice-own-provider-key"); err != nil {
+			t.Fatalf("store %s key: %v", provider, err)
+		}
+	}
+
+	// Bob uses the organization key Alice created.
+	for _, tc := range []struct {
+		method, path string
+		body         any
+	}{
+		{http.MethodGet, "/v1/threads", nil},
+		{http.MethodGet, "/api/v1/settings", nil},
+		{http.MethodPut, "/api/v1/settings", map[string]any{"temperature": 0.1}},
+		{http.MethodGet, "/api/v1/usage/me", nil},
+		{http.MethodPost, "/v1/chat/completions", map[string]any{"messages": []map[string]string{{"role": "user", "content": "Write a counter"}}}},
+	} {
+		rec, err := h.Do(tc.method, tc.path, tc.body, testharness.APIKey(aliceKey))
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		if rec.Code != http.StatusForbidden {
+			t.Fatalf("%s %s with an organization key: got %d, want 403: %s", tc.method, tc.path, rec.Code, rec.Body)
+		}
+	}
+
+	rec, err := h.Do(http.MethodPost, "/api/v1/rag/generate", map[string]any{"query": "write a counter"}, testharness.APIKey(aliceKey))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("generate with an organization key: got %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if calls := h.Codegen.Calls(); len(calls) != 1 {
+		t.Fatalf("server codegen called %d times, want 1 instead of the creator's provider key", len(calls))
+	}
+}
+
+func TestRemoveOrgMemberRevokesTheirKeys(t *testing.T) {
+	h := newHarness(t)
+	orgID, _, bob, aliceKey, bobKey := newOrg(t, h)
+
+	rec, err := h.Do(http.MethodDelete, fmt.Sprintf("/api/v1/orgs/%d/members/%d", orgID, bob), nil, testharness.BasicAuth("alice", "password123"))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("remove member: got %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	for key, want := range map[string]int{bobKey: http.StatusUnauthorized, aliceKey: http.StatusOK} {
+		rec, err := h.Do(http.MethodGet, "/v1/models", nil, testharness.APIKey(key))
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		if rec.Code != want {
+			t.Fatalf("organization key after removing bob: got %d, want %d: %s", rec.Code, want, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/artifact"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// GenerateProjectRequest represents a multi-file project generation request
+type GenerateProjectRequest struct {
+	Query       string  `json:"query" binding:"required"`
+	Name        string  `json:"name"`
+	Temperature float64 `json:"temperature"`
+	MaxTokens   int     `json:"max_tokens"`
+	// Language overrides the saved response_language for explanations and code comments.
+	Language string `json:"language"`
+	// Format is "json" (default) or "zip" for a downloadable archive.
+	Format string `json:"format"`
+	// PromptTemplate names a prompt template to build the prompt from instead of the default.
+	PromptTemplate string `json:"prompt_template"`
+	rag.Filter
+}
+
+// GenerateProject generates a multi-file Clarinet project (contracts, traits, tests, Clarinet.toml)
+func GenerateProject(db *sql.DB, services *ServiceRegistry, artifacts *artifact.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req GenerateProjectRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request: " + err.Error(),
+			})
+			return
+		}
+		if req.Format != "" && req.Format != "json" && req.Format != "zip" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "format must be json or zip",
+			})
+			return
+		}
+		if !validateRetrievalFilter(c, req.Filter) {
+			return
+		}
+		assignExperiment(c, db, "", req.PromptTemplate)
+		promptTemplate, ok := usePromptTemplate(c, db, req.PromptTemplate)
+		if !ok {
+			return
+		}
+		selection, _, ok := applyUserSettings(c, db, "", req.Language, &req.Temperature, &req.MaxTokens)
+		if !ok {
+			return
+		}
+
+		ragService, err := services.RAG()
+		if err != nil {
+			log.Printf("Failed to initialize RAG service: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to initialize RAG service: " + err.Error(),
+			})
+			return
+		}
+
+		ragResponse, retrievalHit, err := services.retrieveWithCache(c, ragService, req.Query, 5, req.Filter)
+		if err != nil {
+			log.Printf("Failed to retrieve context: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to retrieve context: " + err.Error(),
+			})
+			return
+		}
+		ragResponse = withContractTemplate(c, db, req.Query, req.Filter, ragResponse)
+
+		provider := selection.Provider
+		if err := codegen.ValidateModelMaxTokens(selection.Model, req.MaxTokens); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.Set(middleware.QueryLogModelProvider, provider)
+		c.Set(middleware.QueryLogModel, selection.Model)
+		c.Set(middleware.QueryLogRAGContextsCount, len(ragResponse.CodeContexts)+len(ragResponse.DocsContexts))
+		services.setCacheStatus(c, retrievalHit, false)
+
+		codegenService, err := services.requestModel(c, selection)
+		if err != nil {
+			log.Printf("Failed to initialize %s service: %v", provider, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to initialize code generation service: " + err.Error(),
+			})
+			return
+		}
+
+		response, err := codegenService.GenerateCode(
+			codegen.WithProjectOutput(c.Request.Context()),
+			req.Query,
+			ragResponse.CodeContexts,
+			ragResponse.DocsContexts,
+			req.Temperature,
+			req.MaxTokens,
+		)
+		if err != nil {
+			var interrupted *codegen.InterruptedError
+			if errors.As(err, &interrupted) {
+				log.Printf("Project generation interrupted after %d characters: %v", len(interrupted.Partial), interrupted.Err)
+				c.Set(middleware.QueryLogInterrupted, true)
+				c.Set(middleware.QueryLogErrorMessage, interrupted.Error())
+				c.JSON(statusClientClosedRequest, interrupted.Response())
+				return
+			}
+			respondGenerationError(c, err, "Failed to generate project")
+			return
+		}
+
+		applyGenerationWarnings(response, ragResponse)
+		attachCitations(response, ragResponse)
+		codegen.AttachProvenance(response, provider, promptTemplate, ragResponse.CodeContexts, ragResponse.DocsContexts, false)
+
+		c.Set(middleware.QueryLogInputTokens, response.InputTokens)
+		c.Set(middleware.QueryLogOutputTokens, response.OutputTokens)
+
+		project := codegen.NewProjectResponse(response, req.Name)
+		if len(project.Files) == 0 {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error":    "The model did not return any project files",
+				"warnings": project.Warnings,
+			})
+			return
+		}
+
+		archive, saved, err := saveProjectArtifact(c, artifacts, project.Name, project.Files)
+		if err != nil {
+			log.Printf("Failed to build project archive: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to build project archive",
+			})
+			return
+		}
+
+		if req.Format == "zip" {
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", project.Name+".zip"))
+			c.Data(http.StatusOK, "application/zip", archive)
+			return
+		}
+
+		c.JSON(http.StatusOK, projectResponse{ProjectGenerationResponse: project, Artifact: saved})
+	}
+}
+
+// projectResponse adds the stored zip bundle, when there is one, to a generated project.
+type projectResponse struct {
+	*codegen.ProjectGenerationResponse
+	Artifact *artifact.Artifact `json:"artifact,omitempty"`
+}
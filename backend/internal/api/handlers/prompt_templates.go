@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/prompttemplate"
+)
+
+// PromptTemplateRequest creates or replaces a prompt template.
+type PromptTemplateRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Template    string `json:"template" binding:"required"`
+}
+
+// ListPromptTemplates returns every prompt template, from files and the database.
+func ListPromptTemplates(repo *prompttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templates, err := repo.List(c.Request.Context())
+		if err != nil {
+			log.Printf("Failed to list prompt templates: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list prompt templates"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"templates": templates})
+	}
+}
+
+// GetPromptTemplate returns a single prompt template by name.
+func GetPromptTemplate(repo *prompttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tmpl, err := repo.Get(c.Request.Context(), c.Param("name"))
+		if err != nil {
+			respondPromptTemplateError(c, err, "failed to get prompt template")
+			return
+		}
+		c.JSON(http.StatusOK, tmpl)
+	}
+}
+
+// CreatePromptTemplate stores a new prompt template.
+func CreatePromptTemplate(repo *prompttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req PromptTemplateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		c.Set(middleware.AuditTargetID, req.Name)
+
+		tmpl := &prompttemplate.Template{
+			Name:        req.Name,
+			Description: req.Description,
+			Body:        req.Template,
+		}
+		if userID, ok := extractUserID(c); ok {
+			createdBy := int64(userID)
+			tmpl.CreatedBy = &createdBy
+		}
+
+		if err := repo.Create(c.Request.Context(), tmpl); err != nil {
+			respondPromptTemplateError(c, err, "failed to create prompt template")
+			return
+		}
+		c.JSON(http.StatusCreated, tmpl)
+	}
+}
+
+// UpdatePromptTemplate replaces the description and body of a stored prompt template.
+func UpdatePromptTemplate(repo *prompttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req PromptTemplateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("name"))
+
+		tmpl := &prompttemplate.Template{
+			Name:        c.Param("name"),
+			Description: req.Description,
+			Body:        req.Template,
+		}
+		if err := repo.Update(c.Request.Context(), tmpl); err != nil {
+			respondPromptTemplateError(c, err, "failed to update prompt template")
+			return
+		}
+		c.JSON(http.StatusOK, tmpl)
+	}
+}
+
+// DeletePromptTemplate removes a stored prompt template, restoring any file template it shadowed.
+func DeletePromptTemplate(repo *prompttemplate.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(middleware.AuditTargetID, c.Param("name"))
+
+		if err := repo.Delete(c.Request.Context(), c.Param("name")); err != nil {
+			respondPromptTemplateError(c, err, "failed to delete prompt template")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+func respondPromptTemplateError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, prompttemplate.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, prompttemplate.ErrExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, prompttemplate.ErrReadOnly):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, prompttemplate.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Prompt template request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// usePromptTemplate attaches the named prompt template to the request context so providers
+// build the prompt from it. It returns the template version for generation cache keys, and
+// writes a 400 response and reports false when the template is unknown or invalid. An empty
+// name uses the template of the experiment variant the request was assigned to, if any, and
+// otherwise keeps the built-in prompt.
+func usePromptTemplate(c *gin.Context, db *sql.DB, name string) (string, bool) {
+	if variant, ok := assignedVariant(c); ok && name == "" {
+		name = variant.PromptTemplate
+	}
+	if name == "" {
+		return "", true
+	}
+
+	repo := prompttemplate.NewRepository(db, prompttemplate.DirFromEnv())
+	tmpl, err := repo.Get(c.Request.Context(), name)
+	if err != nil {
+		if errors.Is(err, prompttemplate.ErrNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown prompt_template " + name})
+			return "", false
+		}
+		log.Printf("Failed to load prompt template %s: %v", name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load prompt template"})
+		return "", false
+	}
+
+	parsed, err := tmpl.Parse()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prompt_template " + name + " is invalid: " + err.Error()})
+		return "", false
+	}
+
+	c.Request = c.Request.WithContext(codegen.WithPromptTemplate(c.Request.Context(), parsed))
+	return tmpl.Version(), true
+}
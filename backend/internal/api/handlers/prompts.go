@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+// GetPromptConfig returns the active deployment prompt configuration.
+func GetPromptConfig() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, codegen.CurrentPromptConfig())
+	}
+}
+
+// UpdatePromptConfig replaces the deployment prompt configuration.
+func UpdatePromptConfig() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req codegen.PromptConfig
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		if err := codegen.SetPromptConfig(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := codegen.SavePromptConfig(); err != nil {
+			log.Printf("Failed to persist prompt configuration: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Prompt configuration applied but could not be persisted"})
+			return
+		}
+
+		c.JSON(http.StatusOK, codegen.CurrentPromptConfig())
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/credential"
+)
+
+// providerKeyVerifyTimeout bounds the provider call that verifies a new key.
+const providerKeyVerifyTimeout = 15 * time.Second
+
+// SetProviderKeyRequest stores the caller's API key for a provider.
+type SetProviderKeyRequest struct {
+	APIKey string `json:"api_key" binding:"required"`
+	// Verify makes a test call to the provider before storing the key.
+	Verify bool `json:"verify"`
+}
+
+// ListProviderKeys returns the caller's stored provider keys
+// @Summary List provider keys
+// @Description List the provider API keys the authenticated user stored for their own generations. Only a hint of each key is returned.
+// @Tags Provider Keys
+// @Produce json
+// @Security BasicAuth
+// @Success 200 {object} map[string]interface{} "Stored keys and supported providers"
+// @Failure 503 {object} map[string]interface{} "Provider keys are not enabled"
+// @Router /provider-keys [get]
+func ListProviderKeys(store *credential.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		keys, err := store.List(c.Request.Context(), userID)
+		if err != nil {
+			respondProviderKeyError(c, err, "failed to list provider keys")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"keys": keys, "providers": credential.Providers})
+	}
+}
+
+// SetProviderKey stores the caller's API key for a provider
+// @Summary Set provider key
+// @Description Encrypt and store the authenticated user's API key for openai, claude or gemini, replacing an earlier one. Generations with that provider then use it instead of the server's key.
+// @Tags Provider Keys
+// @Accept json
+// @Produce json
+// @Security BasicAuth
+// @Param provider path string true "openai, claude or gemini"
+// @Param request body SetProviderKeyRequest true "API key"
+// @Success 200 {object} credential.Credential "Stored key"
+// @Failure 400 {object} map[string]interface{} "Unsupported provider, invalid key or failed verification"
+// @Failure 503 {object} map[string]interface{} "Provider keys are not enabled"
+// @Router /provider-keys/{provider} [put]
+func SetProviderKey(store *credential.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		provider := strings.ToLower(c.Param("provider"))
+		c.Set(middleware.AuditTargetID, provider)
+
+		var req SetProviderKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		if !store.Enabled() {
+			respondProviderKeyError(c, credential.ErrDisabled, "")
+			return
+		}
+		if !credential.SupportedProvider(provider) {
+			respondProviderKeyError(c, credential.ErrUnsupportedProvider, "")
+			return
+		}
+		apiKey, err := credential.NormalizeAPIKey(req.APIKey)
+		if err != nil {
+			respondProviderKeyError(c, err, "")
+			return
+		}
+
+		if req.Verify {
+			if err := verifyProviderKey(c.Request.Context(), provider, apiKey); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "the provider rejected the key: " + err.Error()})
+				return
+			}
+		}
+
+		stored, err := store.Set(c.Request.Context(), userID, provider, apiKey)
+		if err != nil {
+			respondProviderKeyError(c, err, "failed to store provider key")
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"hint": stored.Hint, "verified": req.Verify})
+
+		c.JSON(http.StatusOK, stored)
+	}
+}
+
+// DeleteProviderKey removes the caller's API key for a provider
+// @Summary Delete provider key
+// @Description Remove the authenticated user's stored key for a provider. Generations with that provider use the server's key again.
+// @Tags Provider Keys
+// @Produce json
+// @Security BasicAuth
+// @Param provider path string true "openai, claude or gemini"
+// @Success 200 {object} map[string]interface{} "Deleted"
+// @Failure 404 {object} map[string]interface{} "No key stored for the provider"
+// @Failure 503 {object} map[string]interface{} "Provider keys are not enabled"
+// @Router /provider-keys/{provider} [delete]
+func DeleteProviderKey(store *credential.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		provider := strings.ToLower(c.Param("provider"))
+		c.Set(middleware.AuditTargetID, provider)
+
+		if err := store.Delete(c.Request.Context(), userID, provider); err != nil {
+			respondProviderKeyError(c, err, "failed to delete provider key")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// verifyProviderKey makes a health check call to the provider with the key.
+func verifyProviderKey(ctx context.Context, provider, apiKey string) error {
+	service, err := codegen.NewServiceWithAPIKey(provider, "", apiKey)
+	if err != nil {
+		return err
+	}
+	probe, ok := service.(codegen.HealthChecker)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, providerKeyVerifyTimeout)
+	defer cancel()
+	return probe.HealthCheck(ctx)
+}
+
+func respondProviderKeyError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, credential.ErrDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case errors.Is(err, credential.ErrUnsupportedProvider):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "provider must be one of " + strings.Join(credential.Providers, ", ")})
+	case errors.Is(err, credential.ErrInvalidKey):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, credential.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Provider key request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
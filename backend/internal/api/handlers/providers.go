@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+// GetProviderGuards reports the concurrency and circuit breaker state of every LLM provider.
+func GetProviderGuards() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"providers": codegen.ProviderGuards()})
+	}
+}
+
+// ProviderMetrics exposes the LLM provider guards in Prometheus text format.
+func ProviderMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := codegen.WriteProviderMetrics(c.Writer); err != nil {
+			log.Printf("Failed to write provider metrics: %v", err)
+		}
+	}
+}
+
+// respondGenerationError reports a failed generation. An open breaker or saturated provider
+// is a 503 with Retry-After, a provider timeout a 504; anything else stays a 500.
+func respondGenerationError(c *gin.Context, err error, message string) {
+	log.Printf("%s: %v", message, err)
+	status := http.StatusInternalServerError
+	var unavailable *codegen.ProviderUnavailableError
+	switch {
+	case errors.As(err, &unavailable):
+		status = http.StatusServiceUnavailable
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(unavailable.RetryAfter.Seconds()))))
+	case errors.Is(err, codegen.ErrProviderUnavailable):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, codegen.ErrProviderTimeout):
+		status = http.StatusGatewayTimeout
+	}
+	c.JSON(status, gin.H{"error": message + ": " + err.Error()})
+}
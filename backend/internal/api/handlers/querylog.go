@@ -1,53 +1,62 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
 )
 
-// ListQueryLogs returns paginated query logs with optional filters.
+// ListQueryLogs returns paginated query logs with optional filters. A cursor parameter
+// switches from page numbers to keyset pagination; every response carries the next_cursor.
 func ListQueryLogs(repo *querylog.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 
-		params := querylog.ListParams{
-			Page:          page,
-			Limit:         limit,
-			Status:        c.Query("status"),
-			Endpoint:      c.Query("endpoint"),
-			ModelProvider: c.Query("model_provider"),
-		}
-
-		if userID, ok := parseInt64Ptr(c.Query("user_id")); ok {
-			params.UserID = userID
-		}
-		if apiKeyID, ok := parseInt64Ptr(c.Query("api_key_id")); ok {
-			params.APIKeyID = apiKeyID
-		}
-		if start, ok := parseDate(c.Query("start_date")); ok {
-			params.StartDate = &start
-		}
-		if end, ok := parseDate(c.Query("end_date")); ok {
-			params.EndDate = &end
+		params := queryLogFilters(c)
+		params.Page = page
+		params.Limit = limit
+		if token := c.Query("cursor"); token != "" {
+			cursor, err := querylog.ParseCursor(token)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+				return
+			}
+			params.After = cursor
 		}
 
-		logs, total, err := repo.List(params)
+		result, err := repo.List(params)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list query logs"})
 			return
 		}
 
+		var nextCursor *string
+		if result.NextCursor != nil {
+			token := result.NextCursor.String()
+			nextCursor = &token
+		}
+
+		if params.After != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"logs":        result.Logs,
+				"limit":       params.Limit,
+				"next_cursor": nextCursor,
+			})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"logs":  logs,
-			"total": total,
-			"page":  params.Page,
-			"limit": params.Limit,
+			"logs":        result.Logs,
+			"total":       result.Total,
+			"page":        params.Page,
+			"limit":       params.Limit,
+			"next_cursor": nextCursor,
 		})
 	}
 }
@@ -75,6 +84,33 @@ func GetQueryLog(repo *querylog.Repository) gin.HandlerFunc {
 	}
 }
 
+// PurgeQueryLogs deletes query logs created before the required "before" date.
+func PurgeQueryLogs(repo *querylog.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		before, ok := parseDate(c.Query("before"))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before is required (YYYY-MM-DD or RFC 3339)"})
+			return
+		}
+
+		deleted, err := repo.DeleteOlderThan(before)
+		if err != nil {
+			log.Printf("Failed to purge query logs: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to purge query logs"})
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{
+			"before":  before,
+			"deleted": deleted,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"deleted": deleted,
+			"before":  before,
+		})
+	}
+}
+
 // GetQueryLogStats returns aggregated statistics over a date range.
 func GetQueryLogStats(repo *querylog.Repository) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -96,6 +132,109 @@ func GetQueryLogStats(repo *querylog.Repository) gin.HandlerFunc {
 	}
 }
 
+// GetQueryLogPipelineStats reports how many query logs were queued, written, spilled to
+// disk and dropped since startup.
+func GetQueryLogPipelineStats(service *querylog.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, service.Stats())
+	}
+}
+
+// QueryLogMetrics exposes the query log pipeline counters for Prometheus scrapes.
+func QueryLogMetrics(service *querylog.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := service.WritePrometheus(c.Writer); err != nil {
+			log.Printf("Failed to write query log metrics: %v", err)
+		}
+	}
+}
+
+// maxTimeSeriesBuckets bounds the number of points a single time series request can return.
+const maxTimeSeriesBuckets = 2000
+
+// GetQueryLogTimeSeries returns query counts, error rates, latency percentiles and token usage
+// bucketed by hour or day. It defaults to the last 24 hours (hour) or 30 days (day).
+func GetQueryLogTimeSeries(repo *querylog.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		interval := c.DefaultQuery("interval", querylog.IntervalHour)
+		var span time.Duration
+		switch interval {
+		case querylog.IntervalHour:
+			span = time.Hour
+		case querylog.IntervalDay:
+			span = 24 * time.Hour
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be hour or day"})
+			return
+		}
+
+		endDate := time.Now().UTC()
+		if end, ok := parseDate(c.Query("end_date")); ok {
+			endDate = end
+			// A bare date covers the whole day.
+			if len(c.Query("end_date")) == len("2006-01-02") {
+				endDate = endDate.Add(24*time.Hour - time.Nanosecond)
+			}
+		}
+		startDate := endDate.Add(-24 * time.Hour)
+		if interval == querylog.IntervalDay {
+			startDate = endDate.AddDate(0, 0, -30)
+		}
+		if start, ok := parseDate(c.Query("start_date")); ok {
+			startDate = start
+		}
+
+		if startDate.After(endDate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be before end_date"})
+			return
+		}
+		if endDate.Sub(startDate)/span >= maxTimeSeriesBuckets {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date range is too large for the interval; use interval=day or a shorter range"})
+			return
+		}
+
+		series, err := repo.GetTimeSeries(querylog.TimeSeriesParams{
+			StartDate:     startDate,
+			EndDate:       endDate,
+			Interval:      interval,
+			Endpoint:      c.Query("endpoint"),
+			ModelProvider: c.Query("model_provider"),
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch query log time series"})
+			return
+		}
+
+		c.JSON(http.StatusOK, series)
+	}
+}
+
+// queryLogFilters reads the query log list filters from the query string.
+func queryLogFilters(c *gin.Context) querylog.ListParams {
+	params := querylog.ListParams{
+		Status:        c.Query("status"),
+		Endpoint:      c.Query("endpoint"),
+		ModelProvider: c.Query("model_provider"),
+		Moderation:    c.Query("moderation"),
+	}
+
+	if userID, ok := parseInt64Ptr(c.Query("user_id")); ok {
+		params.UserID = userID
+	}
+	if apiKeyID, ok := parseInt64Ptr(c.Query("api_key_id")); ok {
+		params.APIKeyID = apiKeyID
+	}
+	if start, ok := parseDate(c.Query("start_date")); ok {
+		params.StartDate = &start
+	}
+	if end, ok := parseDate(c.Query("end_date")); ok {
+		params.EndDate = &end
+	}
+	return params
+}
+
 func parseInt64Ptr(val string) (*int64, bool) {
 	if val == "" {
 		return nil, false
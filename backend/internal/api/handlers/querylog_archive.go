@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+)
+
+// ListQueryLogArchives returns the archive files, newest month first, with the archive
+// settings.
+func ListQueryLogArchives(archiver *querylog.Archiver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		archives, err := archiver.List(c.Request.Context())
+		if err != nil {
+			respondArchiveError(c, err, "failed to list query log archives")
+			return
+		}
+
+		cfg := archiver.Config()
+		body := gin.H{
+			"archives": archives,
+			"enabled":  cfg.Enabled(),
+		}
+		if cfg.Enabled() {
+			body["after_days"] = cfg.AfterDays
+			body["interval"] = cfg.Interval.String()
+		}
+		c.JSON(http.StatusOK, body)
+	}
+}
+
+// RunQueryLogArchive archives old query logs now instead of waiting for the schedule.
+func RunQueryLogArchive(archiver *querylog.Archiver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		archives, err := archiver.Run(c.Request.Context())
+		if err != nil {
+			respondArchiveError(c, err, "failed to archive query logs")
+			return
+		}
+
+		var entries int64
+		for _, archive := range archives {
+			entries += archive.Entries
+		}
+		c.Set(middleware.AuditDetails, map[string]any{
+			"archives": len(archives),
+			"entries":  entries,
+		})
+		c.JSON(http.StatusOK, gin.H{"archives": archives, "entries": entries})
+	}
+}
+
+// SearchQueryLogArchive lists an archive's entries matching the query log list filters,
+// newest first, paginated by page and limit.
+func SearchQueryLogArchive(archiver *querylog.Archiver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+		params := queryLogFilters(c)
+		params.Page = page
+		params.Limit = limit
+
+		logs, total, err := archiver.Search(c.Request.Context(), c.Param("name"), params)
+		if err != nil {
+			respondArchiveError(c, err, "failed to read query log archive")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"logs":  logs,
+			"total": total,
+			"page":  params.Page,
+			"limit": params.Limit,
+		})
+	}
+}
+
+// DownloadQueryLogArchive streams an archive as a gzip-compressed NDJSON file.
+func DownloadQueryLogArchive(archiver *querylog.Archiver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		path, err := archiver.Path(c.Request.Context(), name)
+		if err != nil {
+			respondArchiveError(c, err, "failed to open query log archive")
+			return
+		}
+		c.FileAttachment(path, name)
+	}
+}
+
+// RestoreQueryLogArchive moves an archive's entries back into the database and deletes the
+// archive.
+func RestoreQueryLogArchive(archiver *querylog.Archiver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		c.Set(middleware.AuditTargetID, name)
+
+		restored, err := archiver.Restore(c.Request.Context(), name)
+		if err != nil {
+			respondArchiveError(c, err, "failed to restore query log archive")
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"restored": restored})
+		c.JSON(http.StatusOK, gin.H{"restored": restored})
+	}
+}
+
+func respondArchiveError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, querylog.ErrArchiveDisabled):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "query log archiving is not configured; set QUERY_LOG_ARCHIVE_AFTER_DAYS"})
+	case errors.Is(err, querylog.ErrArchiveNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, querylog.ErrArchiveInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Query log archive request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+)
+
+// exportBatchSize is the number of query logs fetched and written per chunk.
+const exportBatchSize = 500
+
+var queryLogCSVHeader = []string{
+	"id", "created_at", "user_id", "api_key_id", "endpoint", "model_provider", "model", "status",
+	"latency_ms", "input_tokens", "output_tokens", "cost_usd", "rag_contexts_count", "conversation_id",
+	"interrupted", "cache_status", "moderation", "moderation_rules", "client_ip", "user_agent",
+	"experiment_id", "experiment_variant", "error_message", "query_text", "query", "response",
+}
+
+// ExportQueryLogs streams query logs matching the List filters as CSV or NDJSON.
+// Pass gzip=true (or send Accept-Encoding: gzip) for a gzip-encoded response.
+func ExportQueryLogs(repo *querylog.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format := strings.ToLower(c.DefaultQuery("format", "csv"))
+		var contentType string
+		switch format {
+		case "csv":
+			contentType = "text/csv; charset=utf-8"
+		case "ndjson":
+			contentType = "application/x-ndjson"
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+			return
+		}
+
+		useGzip := c.Query("gzip") == "true" || acceptsGzip(c.GetHeader("Accept-Encoding"))
+		params := queryLogFilters(c)
+
+		var (
+			out     io.Writer
+			gz      *gzip.Writer
+			csvOut  *csv.Writer
+			started bool
+		)
+
+		// Headers are written with the first batch so a failing query can still return a JSON error.
+		start := func() {
+			filename := fmt.Sprintf("query_logs_%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+			c.Header("Content-Type", contentType)
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+			c.Header("Vary", "Accept-Encoding")
+			out = c.Writer
+			if useGzip {
+				c.Header("Content-Encoding", "gzip")
+				gz = gzip.NewWriter(c.Writer)
+				out = gz
+			}
+			c.Status(http.StatusOK)
+
+			if format == "csv" {
+				csvOut = csv.NewWriter(out)
+				_ = csvOut.Write(queryLogCSVHeader)
+			}
+			started = true
+		}
+
+		err := repo.Export(c.Request.Context(), params, exportBatchSize, func(batch []querylog.QueryLog) error {
+			if !started {
+				start()
+			}
+
+			for i := range batch {
+				if err := writeQueryLogRecord(out, csvOut, &batch[i]); err != nil {
+					return err
+				}
+			}
+
+			if csvOut != nil {
+				csvOut.Flush()
+				if err := csvOut.Error(); err != nil {
+					return err
+				}
+			}
+			if gz != nil {
+				if err := gz.Flush(); err != nil {
+					return err
+				}
+			}
+			c.Writer.Flush()
+			return nil
+		})
+
+		if err != nil && !started {
+			log.Printf("Failed to export query logs: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export query logs"})
+			return
+		}
+		if err != nil {
+			// The status line has already been sent; the truncated body is all we can do.
+			log.Printf("Query log export aborted: %v", err)
+		}
+
+		if !started {
+			// No matching rows: still return a well-formed (header-only) file.
+			start()
+		}
+		if csvOut != nil {
+			csvOut.Flush()
+		}
+		if gz != nil {
+			_ = gz.Close()
+		}
+	}
+}
+
+func writeQueryLogRecord(out io.Writer, csvOut *csv.Writer, entry *querylog.QueryLog) error {
+	if csvOut == nil {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(append(data, '\n'))
+		return err
+	}
+
+	return csvOut.Write([]string{
+		strconv.FormatInt(entry.ID, 10),
+		entry.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatInt(entry.UserID, 10),
+		optionalInt64(entry.APIKeyID),
+		entry.Endpoint,
+		entry.ModelProvider,
+		entry.Model,
+		entry.Status,
+		strconv.FormatInt(entry.LatencyMs, 10),
+		strconv.Itoa(entry.InputTokens),
+		strconv.Itoa(entry.OutputTokens),
+		strconv.FormatFloat(entry.CostUSD, 'f', -1, 64),
+		strconv.Itoa(entry.RAGContextsCount),
+		optionalInt64(entry.ConversationID),
+		strconv.FormatBool(entry.Interrupted),
+		entry.CacheStatus,
+		entry.Moderation,
+		entry.ModerationRules,
+		entry.ClientIP,
+		entry.UserAgent,
+		optionalInt64(entry.ExperimentID),
+		entry.Variant,
+		entry.ErrorMessage,
+		entry.QueryText,
+		entry.Query,
+		entry.Response,
+	})
+}
+
+func optionalInt64(v *int64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatInt(*v, 10)
+}
+
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		encoding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(encoding), "gzip") && strings.TrimSpace(params) != "q=0" {
+			return true
+		}
+	}
+	return false
+}
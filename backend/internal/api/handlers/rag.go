@@ -2,12 +2,14 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strings"
 
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cache"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
 	"github.com/gin-gonic/gin"
@@ -17,68 +19,63 @@ import (
 type RetrieveContextRequest struct {
 	Query    string `json:"query" binding:"required"`
 	NResults int    `json:"n_results"`
+	// Verbose adds each chunk's rank, similarity and stored metadata, and a description of
+	// the retrieval, for tuning retrieval parameters.
+	Verbose bool `json:"verbose"`
+	// Filter restricts retrieval with "collection" ("code", "docs" or "all") and "repos", and
+	// ranks it by "search_mode" ("vector", "keyword" or "hybrid").
+	rag.Filter
 }
 
-// GenerateCodeRequest represents a code generation request
-type GenerateCodeRequest struct {
-	Query       string  `json:"query" binding:"required"`
-	Temperature float64 `json:"temperature"`
-	MaxTokens   int     `json:"max_tokens"`
+// RetrievedContext is a retrieved chunk with the source it came from. Source.Metadata is only
+// set for verbose retrievals.
+type RetrievedContext struct {
+	Collection string  `json:"collection"`
+	Content    string  `json:"content"`
+	Distance   float64 `json:"distance"`
+	rag.Source
+	*ContextScore
 }
 
-// Service singletons
-var (
-	ragServiceInstance      *rag.Service
-	codegenServiceInstances map[string]codegen.Service
-)
-
-// getRAGService creates or returns a RAG service instance
-func getRAGService() (*rag.Service, error) {
-	if ragServiceInstance == nil {
-		service, err := rag.NewServiceFromEnv()
-		if err != nil {
-			return nil, err
-		}
-		ragServiceInstance = service
-	}
-	return ragServiceInstance, nil
+// ContextScore ranks a chunk of a verbose retrieval within its collection.
+type ContextScore struct {
+	// Rank is the chunk's 1-based position in its collection's results.
+	Rank int `json:"rank"`
+	// Similarity is 1 - Distance, clamped to [0, 1].
+	Similarity float64 `json:"similarity"`
 }
 
-// getCodegenService creates or returns a code generation service instance for the provider.
-func getCodegenService(provider string) (codegen.Service, error) {
-	if codegenServiceInstances == nil {
-		codegenServiceInstances = make(map[string]codegen.Service)
-	}
-
-	normalized := strings.ToLower(provider)
-	if service, ok := codegenServiceInstances[normalized]; ok {
-		return service, nil
-	}
-
-	var (
-		service codegen.Service
-		err     error
-	)
-
-	switch normalized {
-	case codegen.ProviderOpenAI:
-		service, err = codegen.NewOpenAIServiceFromEnv()
-	case codegen.ProviderClaude:
-		service, err = codegen.NewClaudeServiceFromEnv()
-	default:
-		normalized = codegen.ProviderGemini
-		service, err = codegen.NewGeminiServiceFromEnv()
-	}
-	if err != nil {
-		return nil, err
-	}
+// RetrievalDetails describes a verbose retrieval: the request as the backend saw it and the
+// backend, embedding model, limits and reranker that served it.
+type RetrievalDetails struct {
+	rag.Info
+	// EmbeddingDimensions is the length of the query embedding, when the backend reports it.
+	EmbeddingDimensions int        `json:"embedding_dimensions,omitempty"`
+	NResults            int        `json:"n_results"`
+	Filter              rag.Filter `json:"filter"`
+	// Cached is true when the response came from the retrieval cache.
+	Cached bool `json:"cached"`
+}
 
-	codegenServiceInstances[normalized] = service
-	return service, nil
+// GenerateCodeRequest represents a code generation request
+type GenerateCodeRequest struct {
+	Query            string  `json:"query" binding:"required"`
+	Temperature      float64 `json:"temperature"`
+	MaxTokens        int     `json:"max_tokens"`
+	ProvenanceHeader bool    `json:"provenance_header"`
+	// Language is the language of explanations and code comments, e.g. "Spanish"; it defaults
+	// to the caller's saved response_language. Clarity code stays in English.
+	Language string `json:"language"`
+	// PromptTemplate names a prompt template to build the prompt from instead of the default.
+	PromptTemplate string `json:"prompt_template"`
+	// ResponseFormat is "text" (default) or "json", which asks providers with a JSON mode for
+	// validated code, explanation and files instead of parsing markdown fences.
+	ResponseFormat string `json:"response_format"`
+	rag.Filter
 }
 
 // RetrieveContext retrieves relevant Clarity code context from ChromaDB
-func RetrieveContext(db *sql.DB) gin.HandlerFunc {
+func RetrieveContext(db *sql.DB, services *ServiceRegistry) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req RetrieveContextRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -87,9 +84,12 @@ func RetrieveContext(db *sql.DB) gin.HandlerFunc {
 			})
 			return
 		}
+		if !validateRetrievalFilter(c, req.Filter) {
+			return
+		}
 
 		// Get RAG service
-		service, err := getRAGService()
+		service, err := services.RAG()
 		if err != nil {
 			log.Printf("Failed to initialize RAG service: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -104,7 +104,7 @@ func RetrieveContext(db *sql.DB) gin.HandlerFunc {
 		}
 
 		// Retrieve context
-		response, err := service.RetrieveContext(c.Request.Context(), req.Query, req.NResults)
+		response, cacheHit, err := services.retrieveWithCache(c, service, req.Query, req.NResults, req.Filter)
 		if err != nil {
 			log.Printf("Failed to retrieve context: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -118,29 +118,56 @@ func RetrieveContext(db *sql.DB) gin.HandlerFunc {
 		if len(response.CodeContexts) > 0 {
 			formatted.WriteString("## Code Contexts:\n\n")
 			for i, context := range response.CodeContexts {
-				formatted.WriteString(fmt.Sprintf("### Code Context %d:\n```clarity\n%s\n```\n\n", i+1, context))
+				formatted.WriteString(fmt.Sprintf("### Code Context %d%s:\n```clarity\n%s\n```\n\n", i+1, sourceLabel(response.CodeSources, i), context))
 			}
 		}
 
 		if len(response.DocsContexts) > 0 {
 			formatted.WriteString("## Documentation Contexts:\n\n")
 			for i, doc := range response.DocsContexts {
-				formatted.WriteString(fmt.Sprintf("### Documentation Context %d:\n```text\n%s\n```\n\n", i+1, doc))
+				formatted.WriteString(fmt.Sprintf("### Documentation Context %d%s:\n```text\n%s\n```\n\n", i+1, sourceLabel(response.DocsSources, i), doc))
 			}
 		}
 
 		formattedContext := formatted.String()
 		response.FormattedContext = formattedContext
 		c.Set(middleware.QueryLogRAGContextsCount, len(response.CodeContexts)+len(response.DocsContexts))
+		if services.ResponseCache().RetrievalEnabled() {
+			services.setCacheStatus(c, cacheHit, cacheHit)
+		}
 
-		c.JSON(http.StatusOK, gin.H{
+		body := gin.H{
 			"formatted_context": formattedContext,
-		})
+			"contexts":          retrievedContexts(response, req.Verbose),
+		}
+		if response.Rerank != nil {
+			body["rerank"] = response.Rerank
+		}
+		if response.Search != nil {
+			body["search"] = response.Search
+		}
+		if req.Verbose {
+			details := RetrievalDetails{
+				EmbeddingDimensions: response.EmbeddingDimensions,
+				NResults:            req.NResults,
+				Filter:              req.Filter.Normalize(),
+				Cached:              cacheHit,
+			}
+			if described, ok := service.(interface{ Info() rag.Info }); ok {
+				details.Info = described.Info()
+			}
+			body["retrieval"] = details
+		}
+		// Cached responses carry the timings of the retrieval that filled the cache.
+		if response.Timings != nil && !cacheHit {
+			body["timings"] = response.Timings
+		}
+		c.JSON(http.StatusOK, body)
 	}
 }
 
 // GenerateCode generates Clarity code using RAG + Gemini
-func GenerateCode(db *sql.DB) gin.HandlerFunc {
+func GenerateCode(db *sql.DB, services *ServiceRegistry) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req GenerateCodeRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -149,9 +176,31 @@ func GenerateCode(db *sql.DB) gin.HandlerFunc {
 			})
 			return
 		}
+		if !validateRetrievalFilter(c, req.Filter) {
+			return
+		}
+		if req.ResponseFormat == "" {
+			req.ResponseFormat = codegen.ResponseFormatText
+		}
+		if !codegen.IsResponseFormat(req.ResponseFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("response_format must be %q or %q", codegen.ResponseFormatText, codegen.ResponseFormatJSON),
+			})
+			return
+		}
+		c.Request = c.Request.WithContext(codegen.WithResponseFormat(c.Request.Context(), req.ResponseFormat))
+		assignExperiment(c, db, "", req.PromptTemplate)
+		promptTemplate, ok := usePromptTemplate(c, db, req.PromptTemplate)
+		if !ok {
+			return
+		}
+		selection, language, ok := applyUserSettings(c, db, "", req.Language, &req.Temperature, &req.MaxTokens)
+		if !ok {
+			return
+		}
 
 		// Get services
-		ragService, err := getRAGService()
+		ragService, err := services.RAG()
 		if err != nil {
 			log.Printf("Failed to initialize RAG service: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -161,7 +210,7 @@ func GenerateCode(db *sql.DB) gin.HandlerFunc {
 		}
 
 		// Step 1: Retrieve context from ChromaDB
-		ragResponse, err := ragService.RetrieveContext(c.Request.Context(), req.Query, 5)
+		ragResponse, retrievalHit, err := services.retrieveWithCache(c, ragService, req.Query, 5, req.Filter)
 		if err != nil {
 			log.Printf("Failed to retrieve context: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -169,15 +218,23 @@ func GenerateCode(db *sql.DB) gin.HandlerFunc {
 			})
 			return
 		}
+		ragResponse = withContractTemplate(c, db, req.Query, req.Filter, ragResponse)
 
 		ragContextsCount := len(ragResponse.CodeContexts) + len(ragResponse.DocsContexts)
 
-		provider := codegen.ProviderFromEnv()
+		provider := selection.Provider
+		if err := codegen.ValidateModelMaxTokens(selection.Model, req.MaxTokens); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 
 		c.Set(middleware.QueryLogModelProvider, provider)
+		c.Set(middleware.QueryLogModel, selection.Model)
 		c.Set(middleware.QueryLogRAGContextsCount, ragContextsCount)
 
-		codegenService, err := getCodegenService(provider)
+		codegenService, err := services.requestModel(c, selection)
 		if err != nil {
 			log.Printf("Failed to initialize %s service: %v", provider, err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -187,26 +244,190 @@ func GenerateCode(db *sql.DB) gin.HandlerFunc {
 		}
 
 		// Step 2: Generate code using the configured provider with the retrieved context
-		response, err := codegenService.GenerateCode(
-			c.Request.Context(),
-			req.Query,
+		response, generationHit, err := services.generateWithCache(c, codegenService, cache.GenerationKey{
+			Provider:         provider,
+			Model:            selection.Model,
+			Query:            req.Query,
+			Temperature:      req.Temperature,
+			MaxTokens:        req.MaxTokens,
+			CodeContexts:     ragResponse.CodeContexts,
+			DocContexts:      ragResponse.DocsContexts,
+			PromptTemplate:   promptTemplate,
+			ResponseLanguage: language,
+			ResponseFormat:   req.ResponseFormat,
+		})
+		services.setCacheStatus(c, retrievalHit, generationHit)
+		if err != nil {
+			var interrupted *codegen.InterruptedError
+			if errors.As(err, &interrupted) {
+				log.Printf("Code generation interrupted after %d characters: %v", len(interrupted.Partial), interrupted.Err)
+				c.Set(middleware.QueryLogInterrupted, true)
+				c.Set(middleware.QueryLogErrorMessage, interrupted.Error())
+				c.JSON(statusClientClosedRequest, interrupted.Response())
+				return
+			}
+			respondGenerationError(c, err, "Failed to generate code")
+			return
+		}
+
+		applyGenerationWarnings(response, ragResponse)
+		attachCitations(response, ragResponse)
+		codegen.AttachProvenance(
+			response,
+			provider,
+			promptTemplate,
 			ragResponse.CodeContexts,
 			ragResponse.DocsContexts,
-			req.Temperature,
-			req.MaxTokens,
+			req.ProvenanceHeader || codegen.ProvenanceHeaderFromEnv(),
 		)
+
+		// Log token usage for analytics; cached responses consumed no provider tokens
+		if !generationHit {
+			c.Set(middleware.QueryLogInputTokens, response.InputTokens)
+			c.Set(middleware.QueryLogOutputTokens, response.OutputTokens)
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// GetRAGBridgeMetrics returns health metrics and recent failures for the Python RAG bridge.
+func GetRAGBridgeMetrics(services *ServiceRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		service, err := services.RAG()
 		if err != nil {
-			log.Printf("Failed to generate code: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "Failed to generate code: " + err.Error(),
+				"error": "Failed to initialize RAG service: " + err.Error(),
+			})
+			return
+		}
+
+		bridge, ok := service.(*rag.Service)
+		if !ok {
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": "Bridge metrics are not available for the configured retriever",
 			})
 			return
 		}
 
-	// Log token usage for analytics
-	c.Set(middleware.QueryLogInputTokens, response.InputTokens)
-	c.Set(middleware.QueryLogOutputTokens, response.OutputTokens)
+		metrics, ok := bridge.BridgeMetrics()
+		if !ok {
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": "Bridge metrics are only collected for the python RAG backend",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, metrics)
+	}
+}
+
+// validateRetrievalFilter answers 400 when a request's retrieval filter is invalid.
+func validateRetrievalFilter(c *gin.Context, filter rag.Filter) bool {
+	if err := filter.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// retrievedContexts lists the code and documentation contexts of a retrieval with their sources.
+func retrievedContexts(response *rag.RAGResponse, verbose bool) []RetrievedContext {
+	contexts := make([]RetrievedContext, 0, len(response.CodeContexts)+len(response.DocsContexts))
+	add := func(collection string, chunks []string, distances []float64, sources []rag.Source) {
+		for i, chunk := range chunks {
+			context := RetrievedContext{Collection: collection, Content: chunk}
+			if i < len(distances) {
+				context.Distance = distances[i]
+			}
+			if i < len(sources) {
+				context.Source = sources[i]
+			}
+			if verbose {
+				context.ContextScore = &ContextScore{Rank: i + 1, Similarity: codegen.SimilarityFromDistance(context.Distance)}
+			} else {
+				context.Metadata = nil
+			}
+			contexts = append(contexts, context)
+		}
+	}
+	add(rag.FilterCollectionCode, response.CodeContexts, response.CodeDistances, response.CodeSources)
+	add(rag.FilterCollectionDocs, response.DocsContexts, response.DocsDistances, response.DocsSources)
+	return contexts
+}
+
+// sourceLabel renders the source of the i-th context as a heading suffix, if it is known.
+func sourceLabel(sources []rag.Source, i int) string {
+	if i >= len(sources) {
+		return ""
+	}
+	source := sources[i]
+	switch {
+	case source.DocURL != "":
+		return " (" + source.DocURL + ")"
+	case source.Repo != "" && source.FilePath != "" && !strings.HasPrefix(source.FilePath, source.Repo+"/"):
+		return " (" + source.Repo + "/" + source.FilePath + ")"
+	case source.FilePath != "":
+		return " (" + source.FilePath + ")"
+	default:
+		return ""
+	}
+}
+
+// attachCitations records the retrieved chunks supplied to the model on a generation response.
+func attachCitations(resp *codegen.CodeGenerationResponse, ragResp *rag.RAGResponse) {
+	if resp == nil || ragResp == nil {
+		return
+	}
+	citations := make([]codegen.Citation, 0, len(ragResp.CodeContexts)+len(ragResp.DocsContexts))
+	citations = appendCitations(citations, rag.FilterCollectionCode, ragResp.CodeContexts, ragResp.CodeDistances, ragResp.CodeSources)
+	citations = appendCitations(citations, rag.FilterCollectionDocs, ragResp.DocsContexts, ragResp.DocsDistances, ragResp.DocsSources)
+	if len(citations) == 0 {
+		citations = nil
+	}
+	resp.Citations = citations
+}
+
+func appendCitations(citations []codegen.Citation, collection string, contexts []string, distances []float64, sources []rag.Source) []codegen.Citation {
+	for i := range contexts {
+		citation := codegen.Citation{Collection: collection}
+		if i < len(distances) {
+			citation.Distance = distances[i]
+			citation.Similarity = codegen.SimilarityFromDistance(distances[i])
+		}
+		if i < len(sources) {
+			citation.ID = sources[i].ID
+			citation.Repo = sources[i].Repo
+			citation.FilePath = sources[i].FilePath
+			citation.URL = sources[i].DocURL
+			citation.Contract = sources[i].Contract
+			citation.Function = sources[i].Function
+		}
+		citations = append(citations, citation)
+	}
+	return citations
+}
+
+// applyGenerationWarnings adds retrieval and provider-selection caveats to a generation response.
+func applyGenerationWarnings(resp *codegen.CodeGenerationResponse, ragResp *rag.RAGResponse) {
+	if ragResp != nil {
+		if ragResp.Warning != "" {
+			resp.AddWarning(codegen.Warning{
+				Code:    codegen.WarningRetrieval,
+				Message: ragResp.Warning,
+			})
+		}
+		if len(ragResp.CodeContexts)+len(ragResp.DocsContexts) == 0 {
+			resp.AddWarning(codegen.Warning{
+				Code:    codegen.WarningNoContext,
+				Message: "No relevant code samples or documentation were retrieved; the answer is not grounded in context",
+			})
+		}
+	}
 
-	c.JSON(http.StatusOK, response)
+	if w := codegen.ProviderFallbackWarning(); w != nil {
+		resp.AddWarning(*w)
 	}
 }
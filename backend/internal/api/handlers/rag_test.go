@@ -0,0 +1,137 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/prompttemplate"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testharness"
+)
+
+func TestGenerateCodeUsesRetrievedContext(t *testing.T) {
+	h := newHarness(t)
+	key := newAPIKey(t, h)
+	h.VectorStore.Add(
+		testharness.Document{ID: "counter", Content: "(define-data-var counter uint u0)", Source: rag.Source{Repo: "clarity-examples"}},
+		testharness.Document{ID: "counter-docs", Content: "Data variables hold a counter between calls", Docs: true},
+	)
+	h.Codegen.Responses["counter"] = codegen.CodeGenerationResponse{
+		Code:        "(define-public (increment) (ok (var-set counter (+ (var-get counter) u1))))",
+		Explanation: "Increments the counter.",
+	}
+
+	rec, err := h.Do(http.MethodPost, "/api/v1/rag/generate", map[string]any{"query": "write a counter"}, testharness.APIKey(key))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("generate: got %d, want 200: %s", rec.Code, rec.Body)
+	}
+	var resp codegen.CodeGenerationResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Code != h.Codegen.Responses["counter"].Code || resp.Model != "fake-model" {
+		t.Fatalf("generate returned %+v, want the canned counter response", resp)
+	}
+
+	calls := h.Codegen.Calls()
+	if len(calls) != 1 {
+		t.Fatalf("codegen called %d times, want 1", len(calls))
+	}
+	if !slices.Contains(calls[0].CodeContexts, "(define-data-var counter uint u0)") {
+		t.Fatalf("code contexts = %q, want the retrieved counter", calls[0].CodeContexts)
+	}
+	if !slices.Contains(calls[0].DocContexts, "Data variables hold a counter between calls") {
+		t.Fatalf("docs contexts = %q, want the retrieved documentation", calls[0].DocContexts)
+	}
+}
+
+func TestGenerateCodeRetrievesFromFilteredRepos(t *testing.T) {
+	h := newHarness(t)
+	key := newAPIKey(t, h)
+	h.VectorStore.Add(
+		testharness.Document{ID: "examples", Content: "(define-map counters principal uint)", Source: rag.Source{Repo: "clarity-examples"}},
+		testharness.Document{ID: "other", Content: "(define-map counters uint uint)", Source: rag.Source{Repo: "other"}},
+	)
+
+	rec, err := h.Do(http.MethodPost, "/api/v1/rag/generate", map[string]any{"query": "counters map", "repos": []string{"clarity-examples"}}, testharness.APIKey(key))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("generate: got %d, want 200: %s", rec.Code, rec.Body)
+	}
+	calls := h.Codegen.Calls()
+	if len(calls) != 1 || !slices.Equal(calls[0].CodeContexts, []string{"(define-map counters principal uint)"}) {
+		t.Fatalf("codegen calls = %+v, want only the clarity-examples context", calls)
+	}
+}
+
+func TestGenerateCodeReportsUnavailableProvider(t *testing.T) {
+	h := newHarness(t)
+	key := newAPIKey(t, h)
+	h.Codegen.Err = codegen.ErrProviderUnavailable
+
+	rec, err := h.Do(http.MethodPost, "/api/v1/rag/generate", map[string]any{"query": "write a counter"}, testharness.APIKey(key))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("generate: got %d, want 503: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestGenerateCodeProvenanceNamesPromptTemplate(t *testing.T) {
+	h := newHarness(t)
+	key := newAPIKey(t, h)
+	templates := prompttemplate.NewRepository(h.DB, "")
+	ctx := context.Background()
+	if err := templates.Create(ctx, &prompttemplate.Template{Name: "terse", Body: "{{.Preamble}}\n{{.Query}}"}); err != nil {
+		t.Fatalf("create prompt template: %v", err)
+	}
+
+	provenance := func(body map[string]any) *codegen.Provenance {
+		t.Helper()
+		rec, err := h.Do(http.MethodPost, "/api/v1/rag/generate", body, testharness.APIKey(key))
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		if rec.Code != http.StatusOK {
+			t.Fatalf("generate: got %d, want 200: %s", rec.Code, rec.Body)
+		}
+		var resp codegen.CodeGenerationResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if resp.Provenance == nil || resp.Provenance.PromptFingerprint == "" {
+			t.Fatalf("response provenance = %+v, want a prompt fingerprint", resp.Provenance)
+		}
+		return resp.Provenance
+	}
+
+	if got := provenance(map[string]any{"query": "write a counter"}).PromptTemplateVersion; got != codegen.PromptTemplateVersion {
+		t.Fatalf("built-in prompt provenance = %q, want %q", got, codegen.PromptTemplateVersion)
+	}
+
+	stored, err := templates.Get(ctx, "terse")
+	if err != nil {
+		t.Fatalf("load prompt template: %v", err)
+	}
+	if got := provenance(map[string]any{"query": "write a counter", "prompt_template": "terse"}).PromptTemplateVersion; got != stored.Version() {
+		t.Fatalf("template provenance = %q, want %q", got, stored.Version())
+	}
+
+	stored.Body = "{{.Query}}"
+	if err := templates.Update(ctx, stored); err != nil {
+		t.Fatalf("update prompt template: %v", err)
+	}
+	if got := provenance(map[string]any{"query": "write a counter", "prompt_template": "terse"}).PromptTemplateVersion; got != stored.Version() {
+		t.Fatalf("edited template provenance = %q, want %q", got, stored.Version())
+	}
+}
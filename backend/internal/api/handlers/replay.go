@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/replay"
+)
+
+// ReplayRequest configures a replay of historical query logs.
+type ReplayRequest struct {
+	TargetURL      string `json:"target_url"`
+	APIKey         string `json:"api_key" binding:"required"`
+	Endpoint       string `json:"endpoint"`
+	SampleSize     int    `json:"sample_size"`
+	Concurrency    int    `json:"concurrency"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// ReplayQueryLogs replays a sample of historical queries and reports latency/error distributions.
+func ReplayQueryLogs(runner *replay.Runner) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ReplayRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		if req.TargetURL == "" {
+			req.TargetURL = replay.DefaultTargetURL()
+		}
+
+		report, err := runner.Run(c.Request.Context(), replay.Options{
+			TargetURL:   req.TargetURL,
+			APIKey:      req.APIKey,
+			Endpoint:    req.Endpoint,
+			SampleSize:  req.SampleSize,
+			Concurrency: req.Concurrency,
+			Timeout:     time.Duration(req.TimeoutSeconds) * time.Second,
+		})
+		if err != nil {
+			log.Printf("replay: run failed: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+)
+
+// RoleRequest defines a role's permissions.
+type RoleRequest struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// ListRoles returns every role with its permissions, and the permissions roles can be granted.
+func ListRoles(roles *auth.RoleRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := roles.List(c.Request.Context())
+		if err != nil {
+			log.Printf("Failed to list roles: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list roles"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"roles": list, "permissions": auth.AllPermissions})
+	}
+}
+
+// GetRole returns a single role by name.
+func GetRole(roles *auth.RoleRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := roles.Get(c.Request.Context(), c.Param("name"))
+		if err != nil {
+			respondRoleError(c, err, "failed to get role")
+			return
+		}
+		c.JSON(http.StatusOK, role)
+	}
+}
+
+// PutRole defines a role, or redefines a built-in one, with the given permissions.
+func PutRole(roles *auth.RoleRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("name"))
+
+		role, err := roles.Put(c.Request.Context(), c.Param("name"), req.Description, req.Permissions)
+		if err != nil {
+			respondRoleError(c, err, "failed to save role")
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"permissions": role.Permissions})
+		c.JSON(http.StatusOK, role)
+	}
+}
+
+// DeleteRole removes a defined role, or restores a built-in role's default permissions.
+func DeleteRole(roles *auth.RoleRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(middleware.AuditTargetID, c.Param("name"))
+
+		if err := roles.Delete(c.Request.Context(), c.Param("name")); err != nil {
+			respondRoleError(c, err, "failed to delete role")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+func respondRoleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, auth.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrRoleFixed), errors.Is(err, auth.ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrInvalidRoleName), errors.Is(err, auth.ErrUnknownPermission):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Role request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
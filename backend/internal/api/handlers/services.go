@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cache"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/credential"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// ServiceRegistry holds the RAG, codegen, embedding and response cache services shared by
+// handlers and the cache warmer. SetupRoutes passes one registry to every handler that needs
+// it. Services are created from the environment on first use unless overridden, and every
+// accessor and override is safe for concurrent use.
+type ServiceRegistry struct {
+	ragMu sync.Mutex
+	rag   rag.Retriever
+
+	// codegen caches services by provider, or provider/model for models other than the
+	// provider's configured one.
+	codegenMu sync.Mutex
+	codegen   map[string]codegen.Service
+
+	embeddingsMu sync.Mutex
+	embeddings   *rag.EmbeddingService
+
+	cacheMu     sync.Mutex
+	cache       *cache.Cache
+	cacheLoaded bool
+}
+
+// NewServiceRegistry returns a registry that builds each service on first use.
+func NewServiceRegistry() *ServiceRegistry {
+	return &ServiceRegistry{codegen: make(map[string]codegen.Service)}
+}
+
+// SetRAG overrides the RAG retriever (e.g. with a fake in tests).
+func (r *ServiceRegistry) SetRAG(retriever rag.Retriever) {
+	r.ragMu.Lock()
+	defer r.ragMu.Unlock()
+	r.rag = retriever
+}
+
+// SetCodegen overrides the code generation service used for a provider's configured model.
+func (r *ServiceRegistry) SetCodegen(provider string, service codegen.Service) {
+	r.codegenMu.Lock()
+	defer r.codegenMu.Unlock()
+	r.codegen[strings.ToLower(provider)] = service
+}
+
+// SetEmbeddings overrides the embedding service (e.g. with a fake embedder in tests).
+func (r *ServiceRegistry) SetEmbeddings(service *rag.EmbeddingService) {
+	r.embeddingsMu.Lock()
+	defer r.embeddingsMu.Unlock()
+	r.embeddings = service
+}
+
+// SetResponseCache overrides the response cache. Passing nil disables caching.
+func (r *ServiceRegistry) SetResponseCache(c *cache.Cache) {
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+	r.cache, r.cacheLoaded = c, true
+}
+
+// RAG creates or returns the RAG retriever.
+func (r *ServiceRegistry) RAG() (rag.Retriever, error) {
+	r.ragMu.Lock()
+	defer r.ragMu.Unlock()
+	if r.rag == nil {
+		service, err := rag.NewServiceFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		r.rag = service
+	}
+	return r.rag, nil
+}
+
+// Model creates or returns the service generating with a selected model.
+func (r *ServiceRegistry) Model(selection codegen.ModelSelection) (codegen.Service, error) {
+	normalized := strings.ToLower(selection.Provider)
+	switch normalized {
+	case codegen.ProviderOpenAI, codegen.ProviderClaude, codegen.ProviderLocal:
+	default:
+		normalized = codegen.ProviderGemini
+	}
+
+	key := normalized
+	if selection.Model != "" && selection.Model != codegen.ConfiguredModel(normalized) {
+		key += "/" + selection.Model
+	}
+
+	r.codegenMu.Lock()
+	defer r.codegenMu.Unlock()
+	if service, ok := r.codegen[key]; ok {
+		return service, nil
+	}
+
+	service, err := codegen.NewServiceFromEnv(normalized, selection.Model)
+	if err != nil {
+		return nil, err
+	}
+	r.codegen[key] = service
+	return service, nil
+}
+
+// Embeddings creates or returns the embedding service.
+func (r *ServiceRegistry) Embeddings() (*rag.EmbeddingService, error) {
+	r.embeddingsMu.Lock()
+	defer r.embeddingsMu.Unlock()
+	if r.embeddings == nil {
+		service, err := rag.NewEmbeddingServiceFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		r.embeddings = service
+	}
+	return r.embeddings, nil
+}
+
+// ResponseCache creates or returns the response cache. A nil cache means caching is disabled.
+func (r *ServiceRegistry) ResponseCache() *cache.Cache {
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+	if !r.cacheLoaded {
+		responseCache, err := cache.New(cache.ConfigFromEnv())
+		if err != nil {
+			log.Printf("Response cache disabled: %v", err)
+		}
+		r.cache, r.cacheLoaded = responseCache, true
+	}
+	return r.cache
+}
+
+// activeModel returns the service for the provider's active model.
+func (r *ServiceRegistry) activeModel(provider string) (codegen.Service, error) {
+	return r.Model(codegen.ModelSelection{Provider: provider, Model: codegen.ActiveModel(provider)})
+}
+
+// requestModel returns the service for a selected model, authenticated with the caller's own
+// key for the provider when they stored one. Requests served with the caller's key are
+// flagged in the query log, which leaves them out of the server's spend and quotas.
+func (r *ServiceRegistry) requestModel(c *gin.Context, selection codegen.ModelSelection) (codegen.Service, error) {
+	if apiKey, ok := credential.KeyFromContext(c.Request.Context(), selection.Provider); ok {
+		service, err := codegen.NewServiceWithAPIKey(selection.Provider, selection.Model, apiKey)
+		if err != nil {
+			return nil, err
+		}
+		c.Set(middleware.QueryLogUserKey, true)
+		return service, nil
+	}
+	return r.Model(selection)
+}
@@ -0,0 +1,109 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/handlers"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testharness"
+)
+
+func TestServiceRegistryConcurrentSwapAndRead(t *testing.T) {
+	registry := handlers.NewServiceRegistry()
+	retrievers := []rag.Retriever{testharness.NewFakeVectorStore(), testharness.NewFakeVectorStore()}
+	generators := []codegen.Service{testharness.NewFakeCodegen(), testharness.NewFakeCodegen()}
+	registry.SetRAG(retrievers[0])
+	registry.SetCodegen(codegen.ProviderGemini, generators[0])
+	registry.SetResponseCache(nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				registry.SetRAG(retrievers[j%2])
+				registry.SetCodegen(codegen.ProviderGemini, generators[j%2])
+				registry.SetResponseCache(nil)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				retriever, err := registry.RAG()
+				if err != nil || (retriever != retrievers[0] && retriever != retrievers[1]) {
+					t.Errorf("RAG() = %v, %v; want one of the installed retrievers", retriever, err)
+					return
+				}
+				service, err := registry.Model(codegen.ModelSelection{Provider: codegen.ProviderGemini})
+				if err != nil || (service != generators[0] && service != generators[1]) {
+					t.Errorf("Model() = %v, %v; want one of the installed services", service, err)
+					return
+				}
+				if registry.ResponseCache() != nil {
+					t.Error("ResponseCache() returned a cache after it was disabled")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestHarnessesServeTheirOwnServices(t *testing.T) {
+	counter := testharness.Document{ID: "counter", Content: "(define-data-var counter uint u0)"}
+	token := testharness.Document{ID: "token", Content: "(define-fungible-token token)"}
+	first, second := newHarness(t), newHarness(t)
+	first.VectorStore.Add(counter)
+	second.VectorStore.Add(token)
+	firstKey, secondKey := newAPIKey(t, first), newAPIKey(t, second)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	// Swap the first harness's retriever for an equivalent one while both serve requests.
+	go func() {
+		defer wg.Done()
+		replacement := testharness.NewFakeVectorStore(counter)
+		for i := 0; i < 50; i++ {
+			if i%2 == 0 {
+				first.Services.SetRAG(replacement)
+			} else {
+				first.Services.SetRAG(first.VectorStore)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		expectRetrieved(t, first, firstKey, counter.Content, token.Content)
+	}()
+	go func() {
+		defer wg.Done()
+		expectRetrieved(t, second, secondKey, token.Content, counter.Content)
+	}()
+	wg.Wait()
+}
+
+// expectRetrieved retrieves context for a query matching every document a few times, and
+// checks each response comes from the harness's own vector store.
+func expectRetrieved(t *testing.T, h *testharness.Harness, key, want, unwanted string) {
+	for i := 0; i < 10; i++ {
+		rec, err := h.Do(http.MethodPost, "/api/v1/rag/retrieve", map[string]any{"query": "define counter token"}, testharness.APIKey(key))
+		if err != nil {
+			t.Errorf("request: %v", err)
+			return
+		}
+		if rec.Code != http.StatusOK {
+			t.Errorf("retrieve: got %d, want 200: %s", rec.Code, rec.Body)
+			return
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, want) || strings.Contains(body, unwanted) {
+			t.Errorf("retrieve returned another harness's context: %s", body)
+			return
+		}
+	}
+}
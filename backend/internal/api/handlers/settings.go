@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/settings"
+)
+
+// GetSettings returns the caller's default generation settings. Unset fields are omitted.
+func GetSettings(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to resolve authenticated user"})
+			return
+		}
+
+		saved, err := settings.NewRepository(db).Get(c.Request.Context(), userID)
+		if err != nil {
+			log.Printf("Failed to load settings for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load settings"})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	}
+}
+
+// UpdateSettings replaces the caller's default generation settings; omitted fields are
+// cleared.
+func UpdateSettings(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to resolve authenticated user"})
+			return
+		}
+
+		var req settings.Settings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		err := settings.NewRepository(db).Put(c.Request.Context(), userID, &req)
+		switch {
+		case errors.Is(err, settings.ErrInvalidSettings):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to save settings for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save settings"})
+			return
+		}
+		c.JSON(http.StatusOK, req)
+	}
+}
+
+// applyUserSettings resolves the model and response language of a generation request and
+// fills the temperature and max_tokens it left at zero from the caller's saved settings. A
+// requested model or language wins over the saved one and answers 400 when it is invalid,
+// and the model of an experiment variant the request was assigned to wins over the saved
+// model. The language is attached to the request context and returned for the cache key.
+//
+// Settings that no longer apply, such as a model removed from the allowlist, are skipped so
+// they never block generation.
+func applyUserSettings(c *gin.Context, db *sql.DB, requestedModel, requestedLanguage string, temperature *float64, maxTokens *int) (codegen.ModelSelection, string, bool) {
+	language, err := codegen.NormalizeResponseLanguage(requestedLanguage)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "language: " + err.Error()})
+		return codegen.ModelSelection{}, "", false
+	}
+
+	var saved settings.Settings
+	if userID, ok := extractUserID(c); ok {
+		if saved, err = settings.NewRepository(db).Get(c.Request.Context(), userID); err != nil {
+			log.Printf("Failed to load settings for user %d, using server defaults: %v", userID, err)
+		}
+	}
+
+	var selection codegen.ModelSelection
+	if requestedModel != "" {
+		var ok bool
+		if selection, ok = selectRequestModel(c, requestedModel); !ok {
+			return codegen.ModelSelection{}, "", false
+		}
+	} else if variant, ok := assignedVariant(c); ok && variant.ChangesModel() {
+		// Checked when the request was assigned to the variant.
+		selection, _ = variant.Selection()
+	} else if selection, err = saved.Selection(); err != nil {
+		log.Printf("Ignoring saved model: %v", err)
+		selection = codegen.DefaultModelSelection()
+	}
+
+	if *temperature == 0 {
+		*temperature = saved.Temperature
+	}
+	if *maxTokens == 0 && codegen.ValidateModelMaxTokens(selection.Model, saved.MaxTokens) == nil {
+		*maxTokens = saved.MaxTokens
+	}
+	if language == "" {
+		language = saved.ResponseLanguage
+	}
+	c.Request = c.Request.WithContext(codegen.WithResponseLanguage(c.Request.Context(), language))
+	return selection, language, true
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/showcase"
+)
+
+// SubmitShowcaseRequest is a user's opt-in submission of a generation to the public showcase.
+type SubmitShowcaseRequest struct {
+	Title       string `json:"title" binding:"required,max=200"`
+	Prompt      string `json:"prompt" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	Explanation string `json:"explanation"`
+}
+
+// ReviewShowcaseRequest carries an optional moderator note.
+type ReviewShowcaseRequest struct {
+	Note string `json:"note"`
+}
+
+// SubmitShowcaseEntry queues a generation for moderation before it appears in the public gallery.
+func SubmitShowcaseEntry(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to resolve authenticated user"})
+			return
+		}
+
+		var req SubmitShowcaseRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		entry := &showcase.Entry{
+			UserID:      int64(userID),
+			Title:       strings.TrimSpace(req.Title),
+			Prompt:      req.Prompt,
+			Code:        req.Code,
+			Explanation: req.Explanation,
+		}
+		if err := showcase.NewRepository(db).Submit(c.Request.Context(), entry); err != nil {
+			log.Printf("Failed to submit showcase entry: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to submit showcase entry"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, entry)
+	}
+}
+
+// WithdrawShowcaseEntry deletes one of the caller's own showcase entries.
+func WithdrawShowcaseEntry(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to resolve authenticated user"})
+			return
+		}
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		if err := showcase.NewRepository(db).Delete(c.Request.Context(), id, int64(userID)); err != nil {
+			if errors.Is(err, showcase.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "showcase entry not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to withdraw showcase entry"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// ListPublicShowcase returns approved showcase entries without authentication.
+func ListPublicShowcase(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+		entries, total, err := showcase.NewRepository(db).List(c.Request.Context(), showcase.StatusApproved, page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list showcase entries"})
+			return
+		}
+
+		public := make([]showcase.PublicEntry, 0, len(entries))
+		for _, entry := range entries {
+			public = append(public, entry.Public())
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"entries": public,
+			"total":   total,
+			"page":    page,
+			"limit":   limit,
+		})
+	}
+}
+
+// GetPublicShowcaseEntry returns a single approved showcase entry without authentication.
+func GetPublicShowcaseEntry(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		entry, err := showcase.NewRepository(db).Get(c.Request.Context(), id)
+		if err != nil && !errors.Is(err, showcase.ErrNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch showcase entry"})
+			return
+		}
+		if entry == nil || entry.Status != showcase.StatusApproved {
+			c.JSON(http.StatusNotFound, gin.H{"error": "showcase entry not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, entry.Public())
+	}
+}
+
+// ListShowcaseModeration returns showcase entries for moderators, defaulting to the pending queue.
+func ListShowcaseModeration(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		status := c.DefaultQuery("status", showcase.StatusPending)
+		if status == "all" {
+			status = ""
+		}
+
+		entries, total, err := showcase.NewRepository(db).List(c.Request.Context(), status, page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list showcase entries"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"entries": entries,
+			"total":   total,
+			"page":    page,
+			"limit":   limit,
+		})
+	}
+}
+
+// ReviewShowcaseEntry approves or rejects a showcase entry.
+func ReviewShowcaseEntry(db *sql.DB, status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reviewerID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to resolve authenticated user"})
+			return
+		}
+
+		id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		var req ReviewShowcaseRequest
+		_ = c.ShouldBindJSON(&req)
+
+		repo := showcase.NewRepository(db)
+		if err := repo.Review(c.Request.Context(), id, status, int64(reviewerID), req.Note); err != nil {
+			if errors.Is(err, showcase.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "showcase entry not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to review showcase entry"})
+			return
+		}
+
+		if req.Note != "" {
+			c.Set(middleware.AuditDetails, map[string]any{"note": req.Note})
+		}
+
+		entry, err := repo.Get(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch showcase entry"})
+			return
+		}
+
+		c.JSON(http.StatusOK, entry)
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/ingestion"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// ReindexSourceRequest names the repository, or the repository file, to re-index. Exactly
+// one field must be set.
+type ReindexSourceRequest struct {
+	Repo string `json:"repo"`
+	File string `json:"file"`
+}
+
+// ListSources lists the indexed repositories, or one repository's files when ?repo= is set.
+// ?collection= restricts the listing to "code" or "docs".
+func ListSources(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := rag.Filter{Collection: c.Query("collection")}
+		if err := filter.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sources, err := manager.Sources(c.Request.Context(), filter.Normalize(), c.Query("repo"))
+		switch {
+		case errors.Is(err, ingestion.ErrIndexerRequired):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to list indexed sources: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list indexed sources"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"sources": sources,
+			"total":   len(sources),
+		})
+	}
+}
+
+// DeleteSource removes every chunk ingested from the source named by exactly one of ?repo=,
+// ?file= or ?doc_url=. ?collection= restricts the deletion to "code" or "docs".
+func DeleteSource(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := rag.Filter{Collection: c.Query("collection")}
+		if err := filter.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		selector, ok := sourceSelector(map[string]string{
+			rag.SourceKindRepo:   c.Query("repo"),
+			rag.SourceKindFile:   c.Query("file"),
+			rag.SourceKindDocURL: c.Query("doc_url"),
+		})
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of repo, file or doc_url is required"})
+			return
+		}
+
+		deleted, err := manager.DeleteSource(c.Request.Context(), filter.Normalize(), selector)
+		switch {
+		case errors.Is(err, ingestion.ErrIndexerRequired):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to delete indexed source %s %q after removing %d chunks: %v", selector.Kind, selector.Value, deleted, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete indexed source"})
+			return
+		}
+
+		c.Set(middleware.AuditTargetID, selector.Value)
+		c.Set(middleware.AuditDetails, map[string]any{
+			"kind":       selector.Kind,
+			"collection": filter.Collection,
+			"deleted":    deleted,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"deleted": deleted,
+			"source":  selector,
+		})
+	}
+}
+
+// ReindexSource queues a job that re-clones a repository ingested through POST
+// /api/v1/ingest/repos and replaces its chunks, or the chunks of one of its files.
+func ReindexSource(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ReindexSourceRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		selector, ok := sourceSelector(map[string]string{
+			rag.SourceKindRepo: req.Repo,
+			rag.SourceKindFile: req.File,
+		})
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of repo or file is required"})
+			return
+		}
+
+		var requestedBy *int64
+		if userID, ok := extractUserID(c); ok {
+			id := int64(userID)
+			requestedBy = &id
+		}
+
+		job, err := manager.ReindexSource(c.Request.Context(), selector, requestedBy)
+		switch {
+		case errors.Is(err, ingestion.ErrInvalidSource):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, ingestion.ErrNotReindexable):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, ingestion.ErrIndexerRequired):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, ingestion.ErrJobActive):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+				"job":   job,
+			})
+			return
+		case errors.Is(err, ingestion.ErrQueueFull):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to enqueue re-indexing of %s %q: %v", selector.Kind, selector.Value, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enqueue ingestion job"})
+			return
+		}
+
+		c.Set(middleware.AuditTargetID, job.ID)
+		c.Set(middleware.AuditDetails, map[string]any{
+			"job_type": job.JobType,
+			"reindex":  selector,
+		})
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// sourceSelector returns the selector for the single non-empty value, keyed by source kind.
+func sourceSelector(values map[string]string) (rag.SourceSelector, bool) {
+	var selector rag.SourceSelector
+	for kind, value := range values {
+		if value == "" {
+			continue
+		}
+		if selector.Kind != "" {
+			return rag.SourceSelector{}, false
+		}
+		selector = rag.SourceSelector{Kind: kind, Value: value}
+	}
+	return selector, selector.Kind != ""
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/spend"
+)
+
+// maxSpendReportDays bounds the date range of a spend report.
+const maxSpendReportDays = 366
+
+// GetSpend returns estimated LLM spend per day, provider and model together with the current
+// daily and monthly budget status. It defaults to the last 30 days; a bare end_date covers
+// the whole day.
+func GetSpend(service *spend.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := time.Now().UTC()
+		_, endDate := spend.DayPeriod(now)
+		if end, ok := parseDate(c.Query("end_date")); ok {
+			endDate = end
+			if len(c.Query("end_date")) == len("2006-01-02") {
+				endDate = endDate.AddDate(0, 0, 1)
+			}
+		}
+		startDate := endDate.AddDate(0, 0, -30)
+		if start, ok := parseDate(c.Query("start_date")); ok {
+			startDate = start
+		}
+
+		if !startDate.Before(endDate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be before end_date"})
+			return
+		}
+		if endDate.Sub(startDate) > maxSpendReportDays*24*time.Hour {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date range must not exceed " + strconv.Itoa(maxSpendReportDays) + " days"})
+			return
+		}
+
+		report, err := service.Report(c.Request.Context(), startDate, endDate, c.Query("model_provider"), now)
+		if err != nil {
+			log.Printf("spend: failed to build report: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch spend"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// ListSpendAlerts returns the most recent budget alerts, newest first.
+func ListSpendAlerts(service *spend.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+		if limit <= 0 || limit > 500 {
+			limit = 50
+		}
+
+		alerts, err := service.Alerts(c.Request.Context(), limit)
+		if err != nil {
+			log.Printf("spend: failed to list alerts: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch budget alerts"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"alerts": alerts})
+	}
+}
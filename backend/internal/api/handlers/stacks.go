@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/stacks"
+)
+
+// maxCallReadArguments bounds the arguments of a read-only call.
+const maxCallReadArguments = 32
+
+// CallReadRequest names a read-only function and its arguments. Arguments are typed objects,
+// e.g. {"type": "uint", "value": "10"}, or 0x-prefixed serialized Clarity values.
+type CallReadRequest struct {
+	// ContractID is "<address>.<contract-name>".
+	ContractID   string            `json:"contract_id" binding:"required"`
+	FunctionName string            `json:"function_name" binding:"required"`
+	Arguments    []json.RawMessage `json:"arguments"`
+	// Sender defaults to the contract's deployer.
+	Sender string `json:"sender"`
+	// Network is "mainnet" or "testnet", defaulting to the contract address's network.
+	Network string `json:"network"`
+}
+
+// CallReadOnly evaluates a read-only contract function on a Stacks node, so generated code
+// can be exercised without a wallet.
+func CallReadOnly(client *stacks.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CallReadRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		call, err := readOnlyCall(req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := client.CallReadOnly(c.Request.Context(), call)
+		switch {
+		case errors.Is(err, stacks.ErrInvalidValue):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, stacks.ErrContractNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Read-only call to %s.%s failed: %v", req.ContractID, req.FunctionName, err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+
+		arguments := make([]gin.H, len(call.Arguments))
+		for i, argument := range call.Arguments {
+			arguments[i] = gin.H{"repr": argument.String(), "hex": stacks.SerializeHex(argument)}
+		}
+		response := gin.H{
+			"okay":      result.Okay,
+			"network":   result.Network,
+			"contract":  call.Contract.Address(),
+			"function":  call.Function,
+			"arguments": arguments,
+		}
+		if result.Okay {
+			response["result"] = result.Result.String()
+			response["value"] = result.Result
+			response["hex"] = result.Hex
+		} else {
+			response["cause"] = result.Cause
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// readOnlyCall parses the request's contract, sender and arguments.
+func readOnlyCall(req CallReadRequest) (stacks.ReadOnlyCall, error) {
+	call := stacks.ReadOnlyCall{Function: req.FunctionName, Network: req.Network}
+
+	contract, err := stacks.ParsePrincipal(req.ContractID)
+	if err != nil {
+		return call, err
+	}
+	if contract.Contract == "" {
+		return call, fmt.Errorf("contract_id must be <address>.<contract-name>")
+	}
+	call.Contract = contract
+
+	if req.Sender != "" {
+		sender, err := stacks.ParsePrincipal(req.Sender)
+		if err != nil {
+			return call, fmt.Errorf("sender: %w", err)
+		}
+		call.Sender = &sender
+	}
+
+	if len(req.Arguments) > maxCallReadArguments {
+		return call, fmt.Errorf("at most %d arguments are supported", maxCallReadArguments)
+	}
+	for i, raw := range req.Arguments {
+		argument, err := stacks.ParseValue(raw)
+		if err != nil {
+			return call, fmt.Errorf("argument %d: %w", i, err)
+		}
+		call.Arguments = append(call.Arguments, argument)
+	}
+	return call, nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/compression"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+)
+
+// CompressStorage backfills compression for existing conversation histories and query log responses.
+func CompressStorage(db *sql.DB, qlRepo *querylog.Repository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !compression.Enabled() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "storage compression is disabled; set STORAGE_COMPRESSION"})
+			return
+		}
+
+		batchSize, _ := strconv.Atoi(c.DefaultQuery("batch_size", "100"))
+
+		conversations, err := conversation.NewRepository(db).CompressHistories(c.Request.Context(), batchSize)
+		if err != nil {
+			log.Printf("Failed to compress conversation histories: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":                    "failed to compress conversation histories",
+				"conversations_compressed": conversations,
+			})
+			return
+		}
+
+		queryLogs, err := qlRepo.CompressResponses(batchSize)
+		if err != nil {
+			log.Printf("Failed to compress query log responses: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":                    "failed to compress query log responses",
+				"conversations_compressed": conversations,
+				"query_logs_compressed":    queryLogs,
+			})
+			return
+		}
+
+		c.Set(middleware.AuditDetails, map[string]any{
+			"conversations_compressed": conversations,
+			"query_logs_compressed":    queryLogs,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"conversations_compressed": conversations,
+			"query_logs_compressed":    queryLogs,
+		})
+	}
+}
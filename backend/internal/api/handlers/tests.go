@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/artifact"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/clarity"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// testRetrievalQuery retrieves Clarinet SDK testing examples to ground generated tests.
+const testRetrievalQuery = "Clarinet SDK vitest unit tests with simnet callPublicFn callReadOnlyFn"
+
+// GenerateTestsRequest asks for unit tests of a Clarity contract.
+type GenerateTestsRequest struct {
+	Contract string `json:"contract" binding:"required"`
+	// ContractName is the name the contract is deployed as in Clarinet.toml.
+	ContractName string `json:"contract_name"`
+	// Instructions add to the built-in request, e.g. which scenarios to cover.
+	Instructions string  `json:"instructions"`
+	Temperature  float64 `json:"temperature"`
+	MaxTokens    int     `json:"max_tokens"`
+	// Language is used for comments in the tests and for the explanation.
+	Language string `json:"language"`
+	// PromptTemplate names a prompt template to build the prompt from instead of the default.
+	PromptTemplate string `json:"prompt_template"`
+	rag.Filter
+}
+
+// GenerateTests generates Clarinet SDK (vitest) unit tests for a contract and checks that
+// the generated files parse.
+func GenerateTests(db *sql.DB, services *ServiceRegistry, artifacts *artifact.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req GenerateTestsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid request: " + err.Error(),
+			})
+			return
+		}
+		if len(req.Contract) > maxAnalyzeCodeBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": fmt.Sprintf("contract exceeds %d bytes", maxAnalyzeCodeBytes),
+			})
+			return
+		}
+		if _, err := clarity.Parse(req.Contract); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "contract does not parse: " + err.Error(),
+			})
+			return
+		}
+		if !validateRetrievalFilter(c, req.Filter) {
+			return
+		}
+		assignExperiment(c, db, "", req.PromptTemplate)
+		promptTemplate, ok := usePromptTemplate(c, db, req.PromptTemplate)
+		if !ok {
+			return
+		}
+		selection, _, ok := applyUserSettings(c, db, "", req.Language, &req.Temperature, &req.MaxTokens)
+		if !ok {
+			return
+		}
+
+		ragService, err := services.RAG()
+		if err != nil {
+			log.Printf("Failed to initialize RAG service: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to initialize RAG service: " + err.Error(),
+			})
+			return
+		}
+
+		retrievalQuery := strings.TrimSpace(testRetrievalQuery + " " + req.Instructions)
+		ragResponse, retrievalHit, err := services.retrieveWithCache(c, ragService, retrievalQuery, 5, req.Filter)
+		if err != nil {
+			log.Printf("Failed to retrieve context: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to retrieve context: " + err.Error(),
+			})
+			return
+		}
+
+		provider := selection.Provider
+		if err := codegen.ValidateModelMaxTokens(selection.Model, req.MaxTokens); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		c.Set(middleware.QueryLogModelProvider, provider)
+		c.Set(middleware.QueryLogModel, selection.Model)
+		c.Set(middleware.QueryLogRAGContextsCount, len(ragResponse.CodeContexts)+len(ragResponse.DocsContexts))
+		services.setCacheStatus(c, retrievalHit, false)
+
+		codegenService, err := services.requestModel(c, selection)
+		if err != nil {
+			log.Printf("Failed to initialize %s service: %v", provider, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": "Failed to initialize code generation service: " + err.Error(),
+			})
+			return
+		}
+
+		name := codegen.TestContractName(req.ContractName)
+		response, err := codegenService.GenerateCode(
+			codegen.WithTestOutput(c.Request.Context()),
+			codegen.TestGenerationQuery(name, req.Contract, req.Instructions),
+			ragResponse.CodeContexts,
+			ragResponse.DocsContexts,
+			req.Temperature,
+			req.MaxTokens,
+		)
+		if err != nil {
+			var interrupted *codegen.InterruptedError
+			if errors.As(err, &interrupted) {
+				log.Printf("Test generation interrupted after %d characters: %v", len(interrupted.Partial), interrupted.Err)
+				c.Set(middleware.QueryLogInterrupted, true)
+				c.Set(middleware.QueryLogErrorMessage, interrupted.Error())
+				c.JSON(statusClientClosedRequest, interrupted.Response())
+				return
+			}
+			respondGenerationError(c, err, "Failed to generate tests")
+			return
+		}
+
+		applyGenerationWarnings(response, ragResponse)
+		attachCitations(response, ragResponse)
+		codegen.AttachProvenance(response, provider, promptTemplate, ragResponse.CodeContexts, ragResponse.DocsContexts, false)
+
+		c.Set(middleware.QueryLogInputTokens, response.InputTokens)
+		c.Set(middleware.QueryLogOutputTokens, response.OutputTokens)
+
+		tests := codegen.NewTestsResponse(response, name)
+		if len(tests.Files) == 0 {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error":    "The model did not return any test files",
+				"warnings": tests.Warnings,
+			})
+			return
+		}
+
+		files := make([]codegen.ProjectFile, 0, len(tests.Files))
+		for _, file := range tests.Files {
+			files = append(files, file.ProjectFile)
+		}
+		_, saved, err := saveProjectArtifact(c, artifacts, codegen.SanitizeProjectName(tests.ContractName+"-tests"), files)
+		if err != nil {
+			log.Printf("Failed to build test archive: %v", err)
+		}
+
+		c.JSON(http.StatusOK, testsResponse{TestGenerationResponse: tests, Artifact: saved})
+	}
+}
+
+// testsResponse adds the stored zip bundle of the test files to generated tests.
+type testsResponse struct {
+	*codegen.TestGenerationResponse
+	Artifact *artifact.Artifact `json:"artifact,omitempty"`
+}
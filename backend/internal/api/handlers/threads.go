@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
+)
+
+const (
+	threadIDPrefix  = "thread_"
+	messageIDPrefix = "msg_"
+)
+
+// ThreadObject is an OpenAI Assistants-style thread backed by a conversation. Its metadata
+// carries the title and the conversation_id to continue it with /v1/chat/completions.
+type ThreadObject struct {
+	ID            string            `json:"id"`
+	Object        string            `json:"object"`
+	CreatedAt     int64             `json:"created_at"`
+	Metadata      map[string]string `json:"metadata"`
+	ToolResources map[string]any    `json:"tool_resources"`
+}
+
+// ThreadMessage is a conversation turn in the OpenAI Assistants message format.
+type ThreadMessage struct {
+	ID                string                   `json:"id"`
+	Object            string                   `json:"object"`
+	CreatedAt         int64                    `json:"created_at"`
+	ThreadID          string                   `json:"thread_id"`
+	Status            string                   `json:"status"`
+	IncompleteDetails *ThreadMessageIncomplete `json:"incomplete_details"`
+	Role              string                   `json:"role"`
+	Content           []ThreadMessageContent   `json:"content"`
+	AssistantID       *string                  `json:"assistant_id"`
+	RunID             *string                  `json:"run_id"`
+	Attachments       []any                    `json:"attachments"`
+	Metadata          map[string]string        `json:"metadata"`
+}
+
+// ThreadMessageIncomplete explains why an assistant message is incomplete.
+type ThreadMessageIncomplete struct {
+	Reason string `json:"reason"`
+}
+
+// ThreadMessageContent is a text part of a message.
+type ThreadMessageContent struct {
+	Type string            `json:"type"`
+	Text ThreadMessageText `json:"text"`
+}
+
+// ThreadMessageText holds the text of a content part.
+type ThreadMessageText struct {
+	Value       string `json:"value"`
+	Annotations []any  `json:"annotations"`
+}
+
+// ThreadListResponse is an OpenAI cursor-paginated list of threads or messages.
+type ThreadListResponse struct {
+	Object  string  `json:"object"`
+	Data    any     `json:"data"`
+	FirstID *string `json:"first_id"`
+	LastID  *string `json:"last_id"`
+	HasMore bool    `json:"has_more"`
+}
+
+// CreateThreadRequest starts a thread, optionally seeded with earlier turns.
+type CreateThreadRequest struct {
+	Messages []CreateThreadMessage `json:"messages" binding:"dive"`
+}
+
+// CreateThreadMessage is a seeded turn. Only text content is supported.
+type CreateThreadMessage struct {
+	Role    string `json:"role" binding:"required,oneof=user assistant"`
+	Content string `json:"content" binding:"required"`
+}
+
+// ListThreads returns the caller's conversations as threads, newest first
+// @Summary List threads
+// @Description List the caller's conversations as OpenAI Assistants-style threads, paginated by the after and before cursors
+// @Tags OpenAI Compatible
+// @Produce json
+// @Security ApiKeyAuth
+// @Param limit query int false "Threads per page (1-100)" default(20)
+// @Param order query string false "asc or desc" default(desc)
+// @Param after query string false "Thread ID to list after"
+// @Param before query string false "Thread ID to list before"
+// @Success 200 {object} ThreadListResponse
+// @Failure 400 {object} map[string]interface{} "Invalid parameters"
+// @Router /v1/threads [get]
+func ListThreads(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to resolve authenticated user"})
+			return
+		}
+
+		limit, asc, ok := threadListParams(c)
+		if !ok {
+			return
+		}
+		params := conversation.CursorParams{Limit: limit, Asc: asc}
+		for _, cursor := range []struct {
+			name string
+			dest *int64
+		}{{"after", &params.After}, {"before", &params.Before}} {
+			value := c.Query(cursor.name)
+			if value == "" {
+				continue
+			}
+			id, ok := parseThreadID(value)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": cursor.name + " must be a thread ID"})
+				return
+			}
+			*cursor.dest = id
+		}
+
+		items, hasMore, err := conversation.NewRepository(db).ListByCursor(c.Request.Context(), userID, params)
+		if err != nil {
+			log.Printf("Failed to list threads: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list threads"})
+			return
+		}
+
+		threads := make([]ThreadObject, 0, len(items))
+		for _, item := range items {
+			threads = append(threads, newThreadObject(item.ID, item.Title, item.CreatedAt.Unix()))
+		}
+		response := ThreadListResponse{Object: "list", Data: threads, HasMore: hasMore}
+		if len(threads) > 0 {
+			response.FirstID = &threads[0].ID
+			response.LastID = &threads[len(threads)-1].ID
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// CreateThread starts a conversation, optionally seeded with earlier turns
+// @Summary Create thread
+// @Description Create an OpenAI Assistants-style thread. Seeded messages become the conversation's history; continue it with /v1/chat/completions and the conversation_id in its metadata.
+// @Tags OpenAI Compatible
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param request body CreateThreadRequest false "Seed messages"
+// @Success 200 {object} ThreadObject
+// @Failure 400 {object} map[string]interface{} "Invalid request"
+// @Router /v1/threads [post]
+func CreateThread(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to resolve authenticated user"})
+			return
+		}
+
+		var req CreateThreadRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		convo := conversation.New(userID)
+		for _, message := range req.Messages {
+			convo.AddTurn(message.Role, message.Content)
+		}
+		if err := conversation.NewRepository(db).Save(c.Request.Context(), convo); err != nil {
+			log.Printf("Failed to create thread: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create thread"})
+			return
+		}
+
+		c.JSON(http.StatusOK, newThreadObject(convo.ID, convo.Title, convo.CreatedAt.Unix()))
+	}
+}
+
+// GetThread returns one of the caller's conversations as a thread
+// @Summary Retrieve thread
+// @Description Get an OpenAI Assistants-style thread
+// @Tags OpenAI Compatible
+// @Produce json
+// @Security ApiKeyAuth
+// @Param thread_id path string true "Thread ID"
+// @Success 200 {object} ThreadObject
+// @Failure 404 {object} map[string]interface{} "Thread not found"
+// @Router /v1/threads/{thread_id} [get]
+func GetThread(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		convo, ok := loadThread(c, db)
+		if !ok {
+			return
+		}
+		title := convo.Title
+		if title == "" {
+			title = convo.DefaultTitle()
+		}
+		c.JSON(http.StatusOK, newThreadObject(convo.ID, title, convo.CreatedAt.Unix()))
+	}
+}
+
+// ListThreadMessages returns the turns of a thread, newest first
+// @Summary List thread messages
+// @Description List the turns of a thread as OpenAI Assistants-style messages, paginated by the after and before cursors
+// @Tags OpenAI Compatible
+// @Produce json
+// @Security ApiKeyAuth
+// @Param thread_id path string true "Thread ID"
+// @Param limit query int false "Messages per page (1-100)" default(20)
+// @Param order query string false "asc or desc" default(desc)
+// @Param after query string false "Message ID to list after"
+// @Param before query string false "Message ID to list before"
+// @Success 200 {object} ThreadListResponse
+// @Failure 400 {object} map[string]interface{} "Invalid parameters"
+// @Failure 404 {object} map[string]interface{} "Thread not found"
+// @Router /v1/threads/{thread_id}/messages [get]
+func ListThreadMessages(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, asc, ok := threadListParams(c)
+		if !ok {
+			return
+		}
+		convo, ok := loadThread(c, db)
+		if !ok {
+			return
+		}
+
+		messages := threadMessages(convo)
+		if !asc {
+			slices.Reverse(messages)
+		}
+
+		// Cursors are positions in the listing; unknown IDs are rejected like OpenAI does.
+		start, end := 0, len(messages)
+		if after := c.Query("after"); after != "" {
+			i := messageIndex(messages, after)
+			if i < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "after must be a message ID in this thread"})
+				return
+			}
+			start = i + 1
+		}
+		if before := c.Query("before"); before != "" {
+			i := messageIndex(messages, before)
+			if i < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "before must be a message ID in this thread"})
+				return
+			}
+			end = i
+		}
+		page := []ThreadMessage{}
+		hasMore := false
+		if start < end {
+			if c.Query("before") != "" && c.Query("after") == "" {
+				// Take the messages right before the cursor.
+				start = max(start, end-limit)
+				hasMore = start > 0
+			} else {
+				hasMore = end-start > limit
+				end = min(end, start+limit)
+			}
+			page = messages[start:end]
+		}
+
+		response := ThreadListResponse{Object: "list", Data: page, HasMore: hasMore}
+		if len(page) > 0 {
+			response.FirstID = &page[0].ID
+			response.LastID = &page[len(page)-1].ID
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// GetThreadMessage returns one turn of a thread
+// @Summary Retrieve thread message
+// @Description Get a turn of a thread as an OpenAI Assistants-style message
+// @Tags OpenAI Compatible
+// @Produce json
+// @Security ApiKeyAuth
+// @Param thread_id path string true "Thread ID"
+// @Param message_id path string true "Message ID"
+// @Success 200 {object} ThreadMessage
+// @Failure 404 {object} map[string]interface{} "Thread or message not found"
+// @Router /v1/threads/{thread_id}/messages/{message_id} [get]
+func GetThreadMessage(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		convo, ok := loadThread(c, db)
+		if !ok {
+			return
+		}
+		messages := threadMessages(convo)
+		i := messageIndex(messages, c.Param("message_id"))
+		if i < 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("No message found with id '%s'.", c.Param("message_id"))})
+			return
+		}
+		c.JSON(http.StatusOK, messages[i])
+	}
+}
+
+// threadListParams reads limit and order, answering 400 when they are invalid.
+func threadListParams(c *gin.Context) (int, bool, bool) {
+	limit := 20
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return 0, false, false
+		}
+		limit = n
+	}
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		return limit, true, true
+	case "desc":
+		return limit, false, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return 0, false, false
+	}
+}
+
+// loadThread loads the conversation named by the thread_id path parameter, answering 404
+// when it is malformed or not the caller's.
+func loadThread(c *gin.Context, db *sql.DB) (*conversation.Conversation, bool) {
+	userID, ok := extractUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unable to resolve authenticated user"})
+		return nil, false
+	}
+
+	threadID := c.Param("thread_id")
+	notFound := gin.H{"error": fmt.Sprintf("No thread found with id '%s'.", threadID)}
+	id, ok := parseThreadID(threadID)
+	if !ok {
+		c.JSON(http.StatusNotFound, notFound)
+		return nil, false
+	}
+
+	convo, err := conversation.NewRepository(db).Get(c.Request.Context(), id, userID)
+	if errors.Is(err, conversation.ErrConversationNotFound) {
+		c.JSON(http.StatusNotFound, notFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to load thread %s: %v", threadID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load thread"})
+		return nil, false
+	}
+	return convo, true
+}
+
+func newThreadObject(id int64, title string, createdAt int64) ThreadObject {
+	metadata := map[string]string{"conversation_id": strconv.FormatInt(id, 10)}
+	if title != "" {
+		metadata["title"] = title
+	}
+	return ThreadObject{
+		ID:            threadIDPrefix + strconv.FormatInt(id, 10),
+		Object:        "thread",
+		CreatedAt:     createdAt,
+		Metadata:      metadata,
+		ToolResources: map[string]any{},
+	}
+}
+
+func parseThreadID(value string) (int64, bool) {
+	digits, ok := strings.CutPrefix(value, threadIDPrefix)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(digits, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// threadMessages renders the history oldest first. Message IDs use the turn's position in
+// the whole conversation, so they survive history trimming. Turns carry no timestamp of
+// their own, so each message reports the conversation's creation time.
+func threadMessages(convo *conversation.Conversation) []ThreadMessage {
+	threadID := threadIDPrefix + strconv.FormatInt(convo.ID, 10)
+	messages := make([]ThreadMessage, 0, len(convo.History))
+	for i, turn := range convo.History {
+		message := ThreadMessage{
+			ID:          fmt.Sprintf("%s%d_%d", messageIDPrefix, convo.ID, convo.TrimmedTurns+i),
+			Object:      "thread.message",
+			CreatedAt:   convo.CreatedAt.Unix(),
+			ThreadID:    threadID,
+			Status:      "completed",
+			Role:        turn.Role,
+			Content:     []ThreadMessageContent{{Type: "text", Text: ThreadMessageText{Value: turn.Content, Annotations: []any{}}}},
+			Attachments: []any{},
+			Metadata:    map[string]string{},
+		}
+		if turn.Interrupted {
+			message.Status = "incomplete"
+			message.IncompleteDetails = &ThreadMessageIncomplete{Reason: "run_cancelled"}
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func messageIndex(messages []ThreadMessage, id string) int {
+	for i, message := range messages {
+		if message.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/usage"
+)
+
+// UpdateQuotaRequest sets a per-user monthly token quota. A null limit removes the override
+// so the role default applies; zero grants unlimited usage.
+type UpdateQuotaRequest struct {
+	MonthlyTokenLimit *int64 `json:"monthly_token_limit"`
+}
+
+// GetUsage returns the authenticated user's token usage and quota for the current month
+func GetUsage(service *usage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		respondWithUsage(c, service, int64(userID))
+	}
+}
+
+// maxUsageReportDays bounds the date range of a usage report.
+const maxUsageReportDays = 366
+
+// GetUsageReport returns the caller's requests, tokens and estimated cost by day and by API
+// key. It defaults to the last 30 days.
+func GetUsageReport(service *usage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := extractUserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		endDate := time.Now().UTC()
+		if value := c.Query("end_date"); value != "" {
+			end, ok := parseDate(value)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must be YYYY-MM-DD or RFC3339"})
+				return
+			}
+			endDate = end
+			// A bare date covers the whole day.
+			if len(value) == len("2006-01-02") {
+				endDate = endDate.Add(24*time.Hour - time.Nanosecond)
+			}
+		}
+		startDate := endDate.AddDate(0, 0, -30)
+		if value := c.Query("start_date"); value != "" {
+			start, ok := parseDate(value)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be YYYY-MM-DD or RFC3339"})
+				return
+			}
+			startDate = start
+		}
+		if startDate.After(endDate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must be before end_date"})
+			return
+		}
+		if endDate.Sub(startDate) > maxUsageReportDays*24*time.Hour {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("date range must not exceed %d days", maxUsageReportDays)})
+			return
+		}
+
+		report, err := service.Report(c.Request.Context(), int64(userID), startDate, endDate)
+		if err != nil {
+			log.Printf("Failed to compute usage report for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute usage"})
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// GetUserUsage returns a specific user's token usage and quota for the current month
+func GetUserUsage(service *usage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		respondWithUsage(c, service, userID)
+	}
+}
+
+// UpdateUserQuota sets or clears a user's monthly token quota override
+func UpdateUserQuota(service *usage.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		var req UpdateQuotaRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		if req.MonthlyTokenLimit != nil && *req.MonthlyTokenLimit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "monthly_token_limit must not be negative"})
+			return
+		}
+
+		if err := service.SetUserLimit(c.Request.Context(), userID, req.MonthlyTokenLimit); err != nil {
+			if errors.Is(err, usage.ErrUserNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+				return
+			}
+			log.Printf("Failed to update quota for user %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update quota"})
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"monthly_token_limit": req.MonthlyTokenLimit})
+
+		respondWithUsage(c, service, userID)
+	}
+}
+
+func respondWithUsage(c *gin.Context, service *usage.Service, userID int64) {
+	summary, err := service.Summary(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, usage.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		log.Printf("Failed to compute usage for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
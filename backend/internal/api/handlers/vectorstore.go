@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/ingestion"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// defaultCollectionSamples is the number of sample documents listed per collection.
+const defaultCollectionSamples = 3
+
+// ListVectorStoreCollections describes the code sample and documentation collections: their
+// document counts, embedding dimensions, last ingestion and ?samples= example documents
+// (default 3, at most 20).
+func ListVectorStoreCollections(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		samples, ok := collectionSamples(c)
+		if !ok {
+			return
+		}
+
+		collections, err := manager.Collections(c.Request.Context(), samples)
+		switch {
+		case errors.Is(err, ingestion.ErrIndexerRequired):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to describe vector store collections: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to describe vector store collections"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"collections": collections})
+	}
+}
+
+// GetVectorStoreCollection describes one collection, named in full or as "code" or "docs",
+// and counts its documents by repository, file type, file and Clarity contract.
+func GetVectorStoreCollection(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		collection, ok := rag.CollectionName(c.Param("name"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "collection not found"})
+			return
+		}
+		samples, ok := collectionSamples(c)
+		if !ok {
+			return
+		}
+
+		detail, err := manager.CollectionDetail(c.Request.Context(), collection, samples)
+		switch {
+		case errors.Is(err, ingestion.ErrIndexerRequired):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to describe vector store collection %s: %v", collection, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to describe vector store collection"})
+			return
+		}
+
+		c.JSON(http.StatusOK, detail)
+	}
+}
+
+// ReindexVectorStoreRequest selects the collections to rebuild, "code" and "docs" by default,
+// and how: "ingest" runs their ingest scripts again and "reembed" embeds their documents
+// again. min_ratio is the share of the active documents a rebuilt collection must hold
+// before it replaces the active one, 0.9 by default.
+type ReindexVectorStoreRequest struct {
+	Collections []string `json:"collections"`
+	Mode        string   `json:"mode"`
+	MinRatio    *float64 `json:"min_ratio"`
+}
+
+// ReindexVectorStore queues a reindex job that rebuilds collections beside the active ones
+// and switches retrieval to them once their document counts check out.
+func ReindexVectorStore(manager *ingestion.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// The body is optional.
+		var req ReindexVectorStoreRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var requestedBy *int64
+		if userID, ok := extractUserID(c); ok {
+			id := int64(userID)
+			requestedBy = &id
+		}
+
+		job, err := manager.Reindex(c.Request.Context(), ingestion.ReindexOptions{
+			Collections: req.Collections,
+			Mode:        req.Mode,
+			MinRatio:    req.MinRatio,
+		}, requestedBy)
+		switch {
+		case errors.Is(err, ingestion.ErrInvalidReindex):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, ingestion.ErrIndexerRequired):
+			c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, ingestion.ErrJobActive):
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+				"job":   job,
+			})
+			return
+		case errors.Is(err, ingestion.ErrQueueFull):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			log.Printf("Failed to enqueue vector store reindex: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enqueue ingestion job"})
+			return
+		}
+
+		c.Set(middleware.AuditTargetID, job.ID)
+		c.Set(middleware.AuditDetails, map[string]any{
+			"job_type":    job.JobType,
+			"collections": job.Reindex.Collections,
+			"mode":        job.Reindex.Mode,
+		})
+
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// collectionSamples parses ?samples=, answering 400 when it is not between 0 and 20.
+func collectionSamples(c *gin.Context) (int, bool) {
+	samples, err := strconv.Atoi(c.DefaultQuery("samples", strconv.Itoa(defaultCollectionSamples)))
+	if err != nil || samples < 0 || samples > 20 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "samples must be between 0 and 20"})
+		return 0, false
+	}
+	return samples, true
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/webhook"
+)
+
+const (
+	defaultWebhookDeliveryLimit = 50
+	maxWebhookDeliveryLimit     = 200
+)
+
+// CreateWebhookRequest registers a callback URL for a set of events.
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" binding:"required"`
+	Description string   `json:"description"`
+	Events      []string `json:"events" binding:"required"`
+	Active      *bool    `json:"active"`
+}
+
+// UpdateWebhookRequest changes a webhook. Omitted fields are left unchanged.
+type UpdateWebhookRequest struct {
+	URL         *string  `json:"url"`
+	Description *string  `json:"description"`
+	Events      []string `json:"events"`
+	Active      *bool    `json:"active"`
+}
+
+// ListWebhooks returns every registered webhook without its secret.
+func ListWebhooks(dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhooks, err := dispatcher.Repository().List(c.Request.Context())
+		if err != nil {
+			log.Printf("Failed to list webhooks: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list webhooks"})
+			return
+		}
+		for i := range webhooks {
+			webhooks[i].Secret = ""
+		}
+		c.JSON(http.StatusOK, gin.H{"webhooks": webhooks, "events": webhook.Events})
+	}
+}
+
+// GetWebhook returns a single webhook without its secret.
+func GetWebhook(dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+		w, err := dispatcher.Repository().Get(c.Request.Context(), id)
+		if err != nil {
+			respondWebhookError(c, err, "failed to get webhook")
+			return
+		}
+		w.Secret = ""
+		c.JSON(http.StatusOK, w)
+	}
+}
+
+// CreateWebhook registers a webhook. The generated signing secret is only returned here.
+func CreateWebhook(dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateWebhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+
+		w := &webhook.Webhook{
+			URL:         req.URL,
+			Description: req.Description,
+			Events:      req.Events,
+			Active:      req.Active == nil || *req.Active,
+		}
+		if userID, ok := extractUserID(c); ok {
+			createdBy := int64(userID)
+			w.CreatedBy = &createdBy
+		}
+		if err := dispatcher.Repository().Create(c.Request.Context(), w); err != nil {
+			respondWebhookError(c, err, "failed to create webhook")
+			return
+		}
+		c.Set(middleware.AuditTargetID, strconv.FormatInt(w.ID, 10))
+		c.Set(middleware.AuditDetails, map[string]any{"url": w.URL, "events": w.Events})
+
+		c.JSON(http.StatusCreated, w)
+	}
+}
+
+// UpdateWebhook changes a webhook's URL, description, events or active flag.
+func UpdateWebhook(dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+		var req UpdateWebhookRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("id"))
+
+		repo := dispatcher.Repository()
+		w, err := repo.Get(c.Request.Context(), id)
+		if err != nil {
+			respondWebhookError(c, err, "failed to update webhook")
+			return
+		}
+		if req.URL != nil {
+			w.URL = *req.URL
+		}
+		if req.Description != nil {
+			w.Description = *req.Description
+		}
+		if req.Events != nil {
+			w.Events = req.Events
+		}
+		if req.Active != nil {
+			w.Active = *req.Active
+		}
+		if err := repo.Update(c.Request.Context(), w); err != nil {
+			respondWebhookError(c, err, "failed to update webhook")
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"url": w.URL, "events": w.Events, "active": w.Active})
+
+		w.Secret = ""
+		c.JSON(http.StatusOK, w)
+	}
+}
+
+// DeleteWebhook removes a webhook and its delivery log.
+func DeleteWebhook(dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("id"))
+
+		if err := dispatcher.Repository().Delete(c.Request.Context(), id); err != nil {
+			respondWebhookError(c, err, "failed to delete webhook")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// TestWebhook sends a webhook.test event once, without retries, and returns the delivery.
+// Inactive webhooks are tested too so they can be checked before being enabled.
+func TestWebhook(dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+		c.Set(middleware.AuditTargetID, c.Param("id"))
+
+		w, err := dispatcher.Repository().Get(c.Request.Context(), id)
+		if err != nil {
+			respondWebhookError(c, err, "failed to test webhook")
+			return
+		}
+		delivery, err := dispatcher.Test(c.Request.Context(), *w)
+		if err != nil {
+			respondWebhookError(c, err, "failed to test webhook")
+			return
+		}
+		c.Set(middleware.AuditDetails, map[string]any{"status": delivery.Status, "response_status": delivery.ResponseStatus})
+
+		c.JSON(http.StatusOK, delivery)
+	}
+}
+
+// ListWebhookDeliveries returns the most recent deliveries to a webhook, newest first.
+func ListWebhookDeliveries(dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := webhookID(c)
+		if !ok {
+			return
+		}
+		limit := defaultWebhookDeliveryLimit
+		if raw := c.Query("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+				return
+			}
+			limit = min(n, maxWebhookDeliveryLimit)
+		}
+
+		repo := dispatcher.Repository()
+		if _, err := repo.Get(c.Request.Context(), id); err != nil {
+			respondWebhookError(c, err, "failed to list webhook deliveries")
+			return
+		}
+		deliveries, err := repo.ListDeliveries(c.Request.Context(), id, limit)
+		if err != nil {
+			respondWebhookError(c, err, "failed to list webhook deliveries")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+	}
+}
+
+func webhookID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondWebhookError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, webhook.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, webhook.ErrInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Webhook request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/audit"
+)
+
+// Context keys handlers set to enrich the audit entry of their request.
+const (
+	// AuditActorID identifies the actor on routes without an authenticated user (register, login).
+	AuditActorID = "audit_actor_id"
+	// AuditActorUsername names the actor on routes without an authenticated user.
+	AuditActorUsername = "audit_actor_username"
+	// AuditTargetID overrides the target taken from the :id route parameter.
+	AuditTargetID = "audit_target_id"
+	// AuditDetails holds a map[string]any of action-specific details. Never put secrets here.
+	AuditDetails = "audit_details"
+)
+
+// Audit records an audit entry for the route once its handler has run, whatever the outcome.
+// The entry is written synchronously so actions are never dropped; a failed write is logged.
+func Audit(repo *audit.Repository, action, targetType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		entry := &audit.Entry{
+			Action:     action,
+			TargetType: targetType,
+			TargetID:   c.Param("id"),
+			StatusCode: c.Writer.Status(),
+			IPAddress:  ClientIP(c),
+			UserAgent:  UserAgent(c),
+			CreatedAt:  time.Now().UTC(),
+		}
+		entry.Outcome = audit.OutcomeForStatus(entry.StatusCode)
+
+		if userID, ok := c.Get("user_id"); ok {
+			if id, ok := toInt64(userID); ok {
+				entry.ActorID = &id
+			}
+		}
+		if actorID, ok := c.Get(AuditActorID); ok {
+			if id, ok := toInt64(actorID); ok {
+				entry.ActorID = &id
+			}
+		}
+		if username, ok := c.Get("username"); ok {
+			entry.ActorUsername, _ = username.(string)
+		}
+		if username, ok := c.Get(AuditActorUsername); ok {
+			entry.ActorUsername, _ = username.(string)
+		}
+		if targetID, ok := c.Get(AuditTargetID); ok {
+			entry.TargetID = fmt.Sprint(targetID)
+		}
+		if details, ok := c.Get(AuditDetails); ok {
+			entry.Details, _ = details.(map[string]any)
+		}
+
+		// Record the action even when the client has already gone away.
+		if err := repo.Create(context.WithoutCancel(c.Request.Context()), entry); err != nil {
+			log.Printf("audit: failed to record %s: %v", action, err)
+		}
+	}
+}
@@ -1,11 +1,12 @@
 package middleware
 
 import (
-	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
-	"encoding/hex"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,8 +15,49 @@ import (
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
 )
 
-// BasicAuth middleware for username/password authentication
+// passwordChangeAllowed marks routes a user who must change their password may still use.
+const passwordChangeAllowed = "password_change_allowed"
+
+// AllowPendingPasswordChange lets users who must change their password through the user auth
+// middleware that follows it; every other route answers them 403 password_change_required.
+func AllowPendingPasswordChange() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(passwordChangeAllowed, true)
+		c.Next()
+	}
+}
+
+// requirePasswordChanged responds 403 when the user must change their password first.
+func requirePasswordChanged(c *gin.Context, mustChange bool) bool {
+	if !mustChange || c.GetBool(passwordChangeAllowed) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "password_change_required",
+		"message": "Change your password with POST /api/v1/auth/password before continuing",
+	})
+	return false
+}
+
+// LoginBlocked responds 429 to a password attempt made before until.
+func LoginBlocked(c *gin.Context, until time.Time) {
+	retryAfter := int(time.Until(until).Seconds()) + 1
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.Set(AuditDetails, map[string]any{"blocked_until": until})
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":         "too_many_login_attempts",
+		"message":       "Too many failed login attempts, retry later",
+		"retry_after":   retryAfter,
+		"blocked_until": until,
+	})
+}
+
+// BasicAuth middleware for username/password authentication. Failed attempts count towards
+// the same lockouts as POST /auth/login, so credentials cannot be guessed through any other
+// route.
 func BasicAuth(db *sql.DB) gin.HandlerFunc {
+	users := auth.NewUserRepository(db)
+	guard := auth.NewLoginGuard(db, auth.LoginGuardConfigFromEnv())
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -49,23 +91,139 @@ func BasicAuth(db *sql.DB) gin.HandlerFunc {
 		username := credentials[0]
 		password := credentials[1]
 
-		user, err := auth.AuthenticateUser(db, username, password)
+		until, err := guard.Check(username, ClientIP(c))
 		if err != nil {
+			log.Printf("Failed to check login attempts for %q: %v", username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
+			c.Abort()
+			return
+		}
+		if !until.IsZero() {
+			LoginBlocked(c, until)
+			c.Abort()
+			return
+		}
+
+		user, err := users.Authenticate(c.Request.Context(), username, password)
+		if err != nil {
+			if !errors.Is(err, auth.ErrInvalidCredentials) {
+				log.Printf("Failed to authenticate %q: %v", username, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
+				c.Abort()
+				return
+			}
+			if _, recordErr := guard.RecordFailure(username, ClientIP(c)); recordErr != nil {
+				log.Printf("Failed to record login failure for %q: %v", username, recordErr)
+			}
 			c.Header("WWW-Authenticate", "Basic realm=Restricted")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			c.Abort()
 			return
 		}
+		if err := guard.RecordSuccess(user.Username); err != nil {
+			log.Printf("Failed to clear login failures for %q: %v", user.Username, err)
+		}
 
 		// Store useful user info in context
 		c.Set("username", user.Username)
 		c.Set("user_id", user.ID)
 		c.Set("user_role", user.Role)
 
+		if !requirePasswordChanged(c, user.MustChangePassword) {
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// JWTAuth middleware for bearer access token authentication
+func JWTAuth(tokens *auth.TokenService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Bearer token required"})
+			c.Abort()
+			return
+		}
+
+		if !authenticateJWT(c, tokens, token) {
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
 
+// UserAuth accepts either a bearer access token or Basic Auth credentials, so web clients
+// can use sessions while scripts keep using username/password.
+func UserAuth(db *sql.DB, tokens *auth.TokenService) gin.HandlerFunc {
+	basic := BasicAuth(db)
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			basic(c)
+			return
+		}
+
+		if !authenticateJWT(c, tokens, token) {
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// APIKeyOrUserAuth authenticates with the x-api-key header when one is sent and like
+// UserAuth otherwise, for routes used by both API clients and signed-in web users.
+func APIKeyOrUserAuth(db *sql.DB, tokens *auth.TokenService) gin.HandlerFunc {
+	apiKey := APIKeyAuth(db)
+	user := UserAuth(db, tokens)
+	return func(c *gin.Context) {
+		if c.GetHeader("x-api-key") != "" {
+			apiKey(c)
+			return
+		}
+		user(c)
+	}
+}
+
+func authenticateJWT(c *gin.Context, tokens *auth.TokenService, token string) bool {
+	claims, err := tokens.ParseAccessToken(token)
+	if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenRevoked) {
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrInvalidToken.Error()})
+		return false
+	}
+
+	c.Set("username", claims.Username)
+	c.Set("user_id", userID)
+	c.Set("user_role", claims.Role)
+	c.Set("token_claims", claims)
+	return requirePasswordChanged(c, claims.PasswordChange)
+}
+
+func bearerToken(header string) (string, bool) {
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
+
 // APIKeyAuth middleware for API key authentication
 func APIKeyAuth(db *sql.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -76,20 +234,9 @@ func APIKeyAuth(db *sql.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Hash the API key
-		hash := sha256.Sum256([]byte(apiKey))
-		keyHash := hex.EncodeToString(hash[:])
-
 		// Verify API key exists and is valid
-		var keyID, userID int
-		var expiresAt sql.NullTime
-		err := db.QueryRow(`
-			SELECT id, user_id, expires_at
-			FROM api_keys
-			WHERE api_key_hash = ?
-		`, keyHash).Scan(&keyID, &userID, &expiresAt)
-
-		if err == sql.ErrNoRows {
+		key, err := auth.LookupAPIKey(db, apiKey)
+		if errors.Is(err, auth.ErrAPIKeyNotFound) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
 			c.Abort()
 			return
@@ -99,37 +246,84 @@ func APIKeyAuth(db *sql.DB) gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		keyID, userID := key.ID, key.UserID
+
+		// Revoked keys stay stored for their history and restores, so reject them here
+		if !key.IsActive {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "API key has been revoked"})
+			c.Abort()
+			return
+		}
 
 		// Check if key is expired
-		if expiresAt.Valid && expiresAt.Time.Before(time.Now()) {
+		if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "API key expired"})
 			c.Abort()
 			return
 		}
 
+		// Check the key's IP allowlist against the client address
+		if !key.AllowsIP(ClientIP(c)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is not allowed from this IP address"})
+			c.Abort()
+			return
+		}
+
 		// Update last_used_at
-		_, _ = db.Exec(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`, time.Now(), keyID)
+		_, _ = db.Exec(`
+			UPDATE api_keys
+			SET last_used_at = ?, stale_notified_at = NULL, stale_flagged_at = NULL
+			WHERE id = ?
+		`, time.Now(), keyID)
 
-		// Store user_id in context for handlers to use
-		c.Set("user_id", userID)
+		// Store user_id in context for handlers to use. Organization keys act for the
+		// organization, not for the member who created them, so they carry no user.
 		c.Set("api_key_id", keyID)
+		if key.OrgID != nil {
+			c.Set("org_id", *key.OrgID)
+			c.Set(QueryLogKeyCreator, userID)
+		} else {
+			c.Set("user_id", userID)
+			c.Set("user_role", key.UserRole)
+		}
 
 		c.Next()
 	}
 }
 
-// RequireRole ensures the authenticated user has the specified role.
-func RequireRole(role string) gin.HandlerFunc {
+// RejectOrgKeys refuses requests made with an organization API key, for routes that read or
+// change a user's own data such as conversations and settings. It must run after an
+// authentication middleware.
+func RejectOrgKeys() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		roleValue, exists := c.Get("user_role")
-		if !exists {
+		if _, ok := c.Get("org_id"); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "organization API keys cannot be used with this endpoint; use a personal API key"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePermission ensures the authenticated user's role grants permission. Roles are
+// looked up on every request, so redefining one takes effect immediately.
+func RequirePermission(roles *auth.RoleRepository, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("user_role")
+		if role == "" {
 			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
 			c.Abort()
 			return
 		}
 
-		roleStr, ok := roleValue.(string)
-		if !ok || roleStr != role {
+		allowed, err := roles.HasPermission(c.Request.Context(), role, permission)
+		if err != nil {
+			log.Printf("Failed to check permission %s for role %s: %v", permission, role, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check permissions"})
+			c.Abort()
+			return
+		}
+		if !allowed {
 			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
 			c.Abort()
 			return
@@ -0,0 +1,201 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/org"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testharness"
+)
+
+func newHarness(t *testing.T) *testharness.Harness {
+	t.Helper()
+	h, err := testharness.New()
+	if err != nil {
+		t.Fatalf("create harness: %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func TestAPIKeyAuthRejectsRevokedKey(t *testing.T) {
+	h := newHarness(t)
+	userID, keyID, key := newKeyOwner(t, h)
+
+	if err := auth.RevokeAPIKey(h.DB, userID, keyID); err != nil {
+		t.Fatalf("revoke key: %v", err)
+	}
+
+	expectKeyStatus(t, h, key, http.StatusUnauthorized)
+}
+
+// newKeyOwner creates a user with a personal API key and checks the key authenticates.
+func newKeyOwner(t *testing.T, h *testharness.Harness) (userID, keyID int, key string) {
+	t.Helper()
+	userID, err := h.CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	key, err = h.CreateAPIKey(userID)
+	if err != nil {
+		t.Fatalf("create API key: %v", err)
+	}
+	stored, err := auth.LookupAPIKey(h.DB, key)
+	if err != nil {
+		t.Fatalf("look up key: %v", err)
+	}
+	expectKeyStatus(t, h, key, http.StatusOK)
+	return userID, stored.ID, key
+}
+
+// expectKeyStatus requests an API key route with key and checks the response status.
+func expectKeyStatus(t *testing.T, h *testharness.Harness, key string, want int) {
+	t.Helper()
+	rec, err := h.Do(http.MethodGet, "/v1/models", nil, testharness.APIKey(key))
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if rec.Code != want {
+		t.Fatalf("got %d, want %d: %s", rec.Code, want, rec.Body)
+	}
+}
+
+func TestAPIKeyAuthRejectsRotatedKey(t *testing.T) {
+	h := newHarness(t)
+	userID, keyID, key := newKeyOwner(t, h)
+
+	replacement, err := auth.RotateAPIKey(h.DB, userID, keyID, nil)
+	if err != nil {
+		t.Fatalf("rotate key: %v", err)
+	}
+
+	expectKeyStatus(t, h, key, http.StatusUnauthorized)
+	expectKeyStatus(t, h, replacement.APIKey, http.StatusOK)
+}
+
+func TestAPIKeyAuthRejectsStaleRevokedKey(t *testing.T) {
+	h := newHarness(t)
+	_, keyID, key := newKeyOwner(t, h)
+
+	idle := time.Now().UTC().Add(-30 * 24 * time.Hour)
+	if _, err := h.DB.Exec(`UPDATE api_keys SET created_at = ?, last_used_at = ? WHERE id = ?`, idle, idle, keyID); err != nil {
+		t.Fatalf("age key: %v", err)
+	}
+	sweeper := auth.NewStaleKeySweeper(h.DB, auth.StaleKeyConfig{After: 7 * 24 * time.Hour, Revoke: true}, nil)
+	result, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if result.Revoked != 1 {
+		t.Fatalf("revoked %d keys, want 1", result.Revoked)
+	}
+
+	expectKeyStatus(t, h, key, http.StatusUnauthorized)
+}
+
+func TestAPIKeyAuthRestoredKey(t *testing.T) {
+	h := newHarness(t)
+	userID, keyID, key := newKeyOwner(t, h)
+
+	if err := auth.RevokeAPIKey(h.DB, userID, keyID); err != nil {
+		t.Fatalf("revoke key: %v", err)
+	}
+	expectKeyStatus(t, h, key, http.StatusUnauthorized)
+
+	if _, err := auth.RestoreAPIKey(h.DB, keyID, userID, &userID, time.Hour); err != nil {
+		t.Fatalf("restore key: %v", err)
+	}
+	expectKeyStatus(t, h, key, http.StatusOK)
+}
+
+func TestAPIKeyAuthRejectsRevokedOrgKey(t *testing.T) {
+	h := newHarness(t)
+	userID, err := h.CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	organization, err := org.NewRepository(h.DB).Create(context.Background(), "acme", int64(userID))
+	if err != nil {
+		t.Fatalf("create organization: %v", err)
+	}
+	orgKey, err := auth.CreateOrgAPIKey(h.DB, int(organization.ID), userID, "ci", nil)
+	if err != nil {
+		t.Fatalf("create organization key: %v", err)
+	}
+	expectKeyStatus(t, h, orgKey.APIKey, http.StatusOK)
+
+	if err := auth.RevokeOrgAPIKey(h.DB, int(organization.ID), orgKey.ID, userID); err != nil {
+		t.Fatalf("revoke organization key: %v", err)
+	}
+	expectKeyStatus(t, h, orgKey.APIKey, http.StatusUnauthorized)
+}
+
+func TestAPIKeyAuthRejectsDeactivatedUsersKey(t *testing.T) {
+	h := newHarness(t)
+	userID, _, key := newKeyOwner(t, h)
+
+	revoked, err := auth.NewUserRepository(h.DB).Deactivate(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("deactivate user: %v", err)
+	}
+	if revoked != 1 {
+		t.Fatalf("revoked %d keys, want 1", revoked)
+	}
+
+	expectKeyStatus(t, h, key, http.StatusUnauthorized)
+}
+
+func TestBasicAuthLocksOutAfterFailedAttempts(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	t.Setenv("LOGIN_BACKOFF_BASE", "0")
+	h := newHarness(t)
+	if _, err := h.CreateUser("alice", "password123", "user"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		rec, _ := h.Do(http.MethodGet, "/api/v1/usage", nil, testharness.BasicAuth("alice", "wrong-password"))
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got %d, want 401: %s", i+1, rec.Code, rec.Body)
+		}
+	}
+
+	rec, _ := h.Do(http.MethodGet, "/api/v1/usage", nil, testharness.BasicAuth("alice", "password123"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked basic auth: got %d, want 429: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatal("locked basic auth: missing Retry-After")
+	}
+
+	rec, _ = h.Do(http.MethodPost, "/api/v1/auth/login", map[string]string{"username": "alice", "password": "password123"}, nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("login after basic auth lockout: got %d, want 429: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestBasicAuthSuccessClearsFailedAttempts(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	t.Setenv("LOGIN_BACKOFF_BASE", "0")
+	h := newHarness(t)
+	if _, err := h.CreateUser("alice", "password123", "user"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	// Two typos before each successful request never add up to the three-attempt lockout.
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 2; i++ {
+			rec, _ := h.Do(http.MethodGet, "/api/v1/usage", nil, testharness.BasicAuth("alice", "wrong-password"))
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("round %d, typo %d: got %d, want 401: %s", round+1, i+1, rec.Code, rec.Body)
+			}
+		}
+		rec, _ := h.Do(http.MethodGet, "/api/v1/usage", nil, testharness.BasicAuth("alice", "password123"))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("round %d: got %d, want 200: %s", round+1, rec.Code, rec.Body)
+		}
+	}
+}
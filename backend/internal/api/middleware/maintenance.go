@@ -1,8 +1,17 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,14 +19,128 @@ import (
 var (
 	maintenanceEnabled atomic.Bool
 	maintenanceMessage atomic.Value
+
+	routeMaintenanceMu       sync.RWMutex
+	routeMaintenancePrefixes []string
+	routeMaintenanceMessage  string
+
+	// Maintenance set through the admin API, separate from the maintenance the server
+	// enters while initializing data.
+	scheduledMaintenanceMu sync.RWMutex
+	scheduledMaintenance   MaintenanceSchedule
 )
 
-const defaultMaintenanceMessage = "Service is temporarily unavailable while initialization is in progress. Please try again shortly."
+// ErrInvalidMaintenanceWindow is returned for maintenance windows that end before they start
+// or have already ended.
+var ErrInvalidMaintenanceWindow = errors.New("invalid maintenance window")
+
+const (
+	defaultMaintenanceMessage      = "Service is temporarily unavailable while initialization is in progress. Please try again shortly."
+	defaultRouteMaintenanceMessage = "This endpoint is temporarily unavailable for maintenance. Please try again shortly."
+	defaultAdminMaintenanceMessage = "The service is down for maintenance. Please try again later."
+	defaultMaintenanceRetryAfter   = 2 * time.Minute
+
+	// apiV1Prefix lets route prefixes be configured relative to /api/v1 (e.g. "/ingest").
+	apiV1Prefix = "/api/v1"
+	// maintenanceAdminPath is never blocked by partial maintenance so it can always be lifted.
+	maintenanceAdminPath = "/api/v1/admin/maintenance"
+)
+
+// defaultMaintenanceExemptPaths stay reachable during global maintenance: health checks for
+// load balancers, the API docs, and the admin API so maintenance can always be lifted.
+var defaultMaintenanceExemptPaths = []string{"/health", "/swagger", "/api/v1/admin"}
 
 func init() {
 	maintenanceMessage.Store(defaultMaintenanceMessage)
 }
 
+// MaintenanceConfig controls which paths bypass global maintenance and what Retry-After
+// clients are sent.
+type MaintenanceConfig struct {
+	// ExemptPaths are path prefixes served even during global maintenance.
+	ExemptPaths []string
+	// RetryAfter is sent on maintenance responses when no window end is known.
+	RetryAfter time.Duration
+}
+
+// MaintenanceConfigFromEnv reads MAINTENANCE_EXEMPT_PATHS, a comma-separated list of path
+// prefixes (default /health, /swagger and /api/v1/admin; "none" exempts nothing), and
+// MAINTENANCE_RETRY_AFTER, a duration such as 5m (default 2m).
+func MaintenanceConfigFromEnv() MaintenanceConfig {
+	cfg := MaintenanceConfig{
+		ExemptPaths: defaultMaintenanceExemptPaths,
+		RetryAfter:  defaultMaintenanceRetryAfter,
+	}
+	if raw := strings.TrimSpace(os.Getenv("MAINTENANCE_EXEMPT_PATHS")); strings.EqualFold(raw, "none") {
+		cfg.ExemptPaths = nil
+	} else if raw != "" {
+		cfg.ExemptPaths = nil
+		for _, path := range splitList(raw) {
+			if path = strings.TrimRight(path, "/"); path != "" {
+				cfg.ExemptPaths = append(cfg.ExemptPaths, path)
+			}
+		}
+	}
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv("MAINTENANCE_RETRY_AFTER"))); err == nil && d > 0 {
+		cfg.RetryAfter = d
+	}
+	return cfg
+}
+
+// MaintenanceSchedule is maintenance set by an admin. Enabled starts it now and StartsAt at
+// a later time; either way it lasts until EndsAt, or until switched off when EndsAt is unset.
+type MaintenanceSchedule struct {
+	Enabled  bool       `json:"enabled"`
+	StartsAt *time.Time `json:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty"`
+	Message  string     `json:"message,omitempty"`
+}
+
+// activeAt reports whether the schedule puts the service in maintenance at now.
+func (s MaintenanceSchedule) activeAt(now time.Time) bool {
+	switch {
+	case s.EndsAt != nil && !now.Before(*s.EndsAt):
+		return false
+	case s.Enabled:
+		return true
+	case s.StartsAt != nil:
+		return !now.Before(*s.StartsAt)
+	}
+	return false
+}
+
+// SetMaintenanceSchedule replaces the admin maintenance schedule. A window must end after it
+// starts, and in the future. The zero schedule clears it.
+func SetMaintenanceSchedule(schedule MaintenanceSchedule) error {
+	switch {
+	case schedule.Enabled && schedule.StartsAt != nil:
+		return fmt.Errorf("%w: set enabled to start maintenance now, or starts_at to schedule it", ErrInvalidMaintenanceWindow)
+	case schedule.EndsAt != nil && !schedule.Enabled && schedule.StartsAt == nil:
+		return fmt.Errorf("%w: ends_at needs enabled or starts_at", ErrInvalidMaintenanceWindow)
+	}
+	if schedule.EndsAt != nil {
+		if !schedule.EndsAt.After(time.Now()) {
+			return fmt.Errorf("%w: ends_at must be in the future", ErrInvalidMaintenanceWindow)
+		}
+		if schedule.StartsAt != nil && !schedule.EndsAt.After(*schedule.StartsAt) {
+			return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidMaintenanceWindow)
+		}
+	}
+	schedule.Message = strings.TrimSpace(schedule.Message)
+
+	scheduledMaintenanceMu.Lock()
+	defer scheduledMaintenanceMu.Unlock()
+	scheduledMaintenance = schedule
+	return nil
+}
+
+// CurrentMaintenanceSchedule returns the admin maintenance schedule.
+func CurrentMaintenanceSchedule() MaintenanceSchedule {
+	scheduledMaintenanceMu.RLock()
+	defer scheduledMaintenanceMu.RUnlock()
+	return scheduledMaintenance
+}
+
 // SetMaintenanceMode toggles maintenance mode and optionally updates the message returned to clients.
 func SetMaintenanceMode(enabled bool, message ...string) {
 	maintenanceEnabled.Store(enabled)
@@ -37,23 +160,96 @@ func SetMaintenanceMessage(message string) {
 	maintenanceMessage.Store(message)
 }
 
-// IsMaintenanceMode reports whether maintenance mode is currently active.
+// IsMaintenanceMode reports whether maintenance mode is currently active, either while the
+// server initializes data or as scheduled by an admin.
 func IsMaintenanceMode() bool {
-	return maintenanceEnabled.Load()
+	_, _, active := globalMaintenance(time.Now())
+	return active
 }
 
-// MaintenanceModeMiddleware blocks requests while maintenance mode is active.
-func MaintenanceModeMiddleware() gin.HandlerFunc {
+// globalMaintenance returns the message and, when a window is active, its end if the whole
+// API is in maintenance at now.
+func globalMaintenance(now time.Time) (string, *time.Time, bool) {
+	if maintenanceEnabled.Load() {
+		msg, _ := maintenanceMessage.Load().(string)
+		if msg == "" {
+			msg = defaultMaintenanceMessage
+		}
+		return msg, nil, true
+	}
+
+	schedule := CurrentMaintenanceSchedule()
+	if !schedule.activeAt(now) {
+		return "", nil, false
+	}
+	msg := schedule.Message
+	if msg == "" {
+		msg = defaultAdminMaintenanceMessage
+	}
+	return msg, schedule.EndsAt, true
+}
+
+// SetRouteMaintenance disables the given route prefixes while leaving the rest of the API available.
+// Passing an empty list clears partial maintenance.
+func SetRouteMaintenance(prefixes []string, message string) {
+	normalized := make([]string, 0, len(prefixes))
+	seen := make(map[string]bool, len(prefixes))
+	for _, prefix := range prefixes {
+		prefix = strings.TrimRight(strings.TrimSpace(prefix), "/")
+		if prefix == "" {
+			continue
+		}
+		if !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		if seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+		normalized = append(normalized, prefix)
+	}
+	sort.Strings(normalized)
+
+	routeMaintenanceMu.Lock()
+	defer routeMaintenanceMu.Unlock()
+	routeMaintenancePrefixes = normalized
+	routeMaintenanceMessage = message
+}
+
+// RouteMaintenance returns the currently disabled route prefixes and their message.
+func RouteMaintenance() ([]string, string) {
+	routeMaintenanceMu.RLock()
+	defer routeMaintenanceMu.RUnlock()
+	return append([]string{}, routeMaintenancePrefixes...), routeMaintenanceMessage
+}
+
+// MaintenanceModeMiddleware blocks requests while maintenance mode is active, except those
+// under the exempt paths, or when the request targets a route group disabled for partial
+// maintenance. Blocked requests get a 503 with Retry-After set to the end of the maintenance
+// window, or to cfg.RetryAfter when none is scheduled.
+func MaintenanceModeMiddleware(cfg MaintenanceConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if maintenanceEnabled.Load() {
-			msg, _ := maintenanceMessage.Load().(string)
+		now := time.Now()
+		path := c.Request.URL.Path
+		if msg, endsAt, active := globalMaintenance(now); active && !hasAnyRoutePrefix(path, cfg.ExemptPaths) {
+			c.Header("Retry-After", maintenanceRetryAfter(cfg, endsAt, now))
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "maintenance_mode",
+				"message": msg,
+			})
+			return
+		}
+
+		if prefix, msg, blocked := matchRouteMaintenance(path); blocked {
 			if msg == "" {
-				msg = defaultMaintenanceMessage
+				msg = defaultRouteMaintenanceMessage
 			}
 
+			c.Header("Retry-After", maintenanceRetryAfter(cfg, nil, now))
 			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
 				"error":   "maintenance_mode",
 				"message": msg,
+				"route":   prefix,
 			})
 			return
 		}
@@ -61,3 +257,45 @@ func MaintenanceModeMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// maintenanceRetryAfter returns the Retry-After seconds for a maintenance response.
+func maintenanceRetryAfter(cfg MaintenanceConfig, endsAt *time.Time, now time.Time) string {
+	wait := cfg.RetryAfter
+	if endsAt != nil {
+		wait = endsAt.Sub(now)
+	}
+	if wait <= 0 {
+		wait = defaultMaintenanceRetryAfter
+	}
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+func matchRouteMaintenance(path string) (string, string, bool) {
+	routeMaintenanceMu.RLock()
+	defer routeMaintenanceMu.RUnlock()
+
+	if len(routeMaintenancePrefixes) == 0 || path == maintenanceAdminPath {
+		return "", "", false
+	}
+
+	relative := strings.TrimPrefix(path, apiV1Prefix)
+	for _, prefix := range routeMaintenancePrefixes {
+		if hasRoutePrefix(path, prefix) || hasRoutePrefix(relative, prefix) {
+			return prefix, routeMaintenanceMessage, true
+		}
+	}
+	return "", "", false
+}
+
+func hasAnyRoutePrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if hasRoutePrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRoutePrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/moderation"
+)
+
+// moderatorKey holds the route's moderator for handlers that moderate stored prompts.
+const moderatorKey = "moderator"
+
+// ModerationMiddleware checks the prompt of chat and generation requests before the handler
+// runs. Blocked requests are rejected; flagged ones continue. Either verdict is recorded in
+// the query log, so the middleware must run after QueryLogMiddleware.
+func ModerationMiddleware(moderator *moderation.Moderator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !moderator.Enabled() {
+			c.Next()
+			return
+		}
+		c.Set(moderatorKey, moderator)
+
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+
+		if !moderate(c, moderator, moderation.PromptText(body)) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// ModeratePrompt checks a prompt the handler loaded itself, such as the stored message a
+// conversation is regenerated or continued from, with the moderator of the route's
+// ModerationMiddleware. It responds and returns false when the prompt is blocked; routes
+// without the middleware allow every prompt.
+func ModeratePrompt(c *gin.Context, prompt string) bool {
+	moderator, _ := c.Value(moderatorKey).(*moderation.Moderator)
+	if !moderator.Enabled() {
+		return true
+	}
+	return moderate(c, moderator, prompt)
+}
+
+// moderate records the moderator's verdict on prompt and aborts with an error response when
+// it is blocked.
+func moderate(c *gin.Context, moderator *moderation.Moderator, prompt string) bool {
+	verdict := moderator.Check(c.Request.Context(), prompt)
+	if verdict.Action == moderation.ActionAllow {
+		return true
+	}
+
+	rules := strings.Join(verdict.Rules, ",")
+	c.Set(QueryLogModeration, verdict.Recorded())
+	c.Set(QueryLogModerationRules, rules)
+	log.Printf("moderation: %s %s request from user %v (%s)", verdict.Recorded(), c.FullPath(), c.Value("user_id"), rules)
+
+	if verdict.Action != moderation.ActionBlock {
+		return true
+	}
+
+	if len(verdict.Rules) == 1 && verdict.Rules[0] == moderation.RuleMaxLength {
+		message := fmt.Sprintf("Prompt exceeds the maximum of %d characters", moderator.MaxPromptChars())
+		c.Set(QueryLogErrorMessage, message)
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":   "prompt_too_long",
+			"message": message,
+		})
+		return false
+	}
+	message := "Request was blocked by content moderation"
+	c.Set(QueryLogErrorMessage, message)
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+		"error":   "content_blocked",
+		"message": message,
+	})
+	return false
+}
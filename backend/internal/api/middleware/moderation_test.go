@@ -0,0 +1,78 @@
+package middleware_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testharness"
+)
+
+// moderatedHarness limits prompts to 40 characters, so long stored messages are blocked.
+func moderatedHarness(t *testing.T) *testharness.Harness {
+	t.Helper()
+	t.Setenv("MODERATION_ENABLED", "true")
+	t.Setenv("MODERATION_MAX_PROMPT_CHARS", "40")
+	return newHarness(t)
+}
+
+// saveConversation stores a conversation of the user's message and, when interrupted, a
+// partial answer to continue.
+func saveConversation(t *testing.T, h *testharness.Harness, userID int, message string, interrupted bool) int64 {
+	t.Helper()
+	convo := conversation.New(userID)
+	convo.AddTurn("user", message)
+	if interrupted {
+		convo.AddInterruptedTurn("(define-public (transfer")
+	} else {
+		convo.AddAssistantTurn("(define-read-only (get-count) (ok u1))", nil)
+	}
+	if err := conversation.NewRepository(h.DB).Save(context.Background(), convo); err != nil {
+		t.Fatalf("save conversation: %v", err)
+	}
+	return convo.ID
+}
+
+func TestContinueModeratesStoredMessage(t *testing.T) {
+	h := moderatedHarness(t)
+	userID, _, key := newKeyOwner(t, h)
+
+	for _, tc := range []struct {
+		message string
+		want    int
+	}{
+		{"Write a counter contract", http.StatusOK},
+		{strings.Repeat("Write a token contract. ", 4), http.StatusRequestEntityTooLarge},
+	} {
+		id := saveConversation(t, h, userID, tc.message, true)
+		rec, _ := h.Do(http.MethodPost, "/v1/chat/completions/continue", map[string]any{"conversation_id": id}, testharness.APIKey(key))
+		if rec.Code != tc.want {
+			t.Fatalf("continue %q: got %d, want %d: %s", tc.message, rec.Code, tc.want, rec.Body)
+		}
+	}
+}
+
+func TestRegenerateModeratesStoredMessage(t *testing.T) {
+	h := moderatedHarness(t)
+	userID, err := h.CreateUser("alice", "password123", "user")
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	for _, tc := range []struct {
+		message string
+		want    int
+	}{
+		{"Write a counter contract", http.StatusOK},
+		{strings.Repeat("Write a token contract. ", 4), http.StatusRequestEntityTooLarge},
+	} {
+		id := saveConversation(t, h, userID, tc.message, false)
+		rec, _ := h.Do(http.MethodPost, fmt.Sprintf("/api/v1/conversations/%d/regenerate", id), nil, testharness.BasicAuth("alice", "password123"))
+		if rec.Code != tc.want {
+			t.Fatalf("regenerate %q: got %d, want %d: %s", tc.message, rec.Code, tc.want, rec.Body)
+		}
+	}
+}
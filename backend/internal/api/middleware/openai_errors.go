@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenAIError is the error object OpenAI SDK clients expect under the "error" key.
+type OpenAIError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+// errorCodePattern matches machine-readable error values such as "quota_exceeded", as opposed
+// to human-readable messages.
+var errorCodePattern = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)+$`)
+
+// openAIErrorWriter holds back JSON error bodies so they can be rewritten once the handler
+// chain has finished. Successful responses and streams pass straight through.
+type openAIErrorWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	buffering bool
+	decided   bool
+}
+
+func (w *openAIErrorWriter) capture() bool {
+	if !w.decided {
+		w.decided = true
+		w.buffering = w.Status() >= http.StatusBadRequest &&
+			!w.ResponseWriter.Written() &&
+			strings.HasPrefix(w.Header().Get("Content-Type"), "application/json")
+	}
+	return w.buffering
+}
+
+func (w *openAIErrorWriter) Write(b []byte) (int, error) {
+	if w.capture() {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *openAIErrorWriter) WriteString(s string) (int, error) {
+	if w.capture() {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// OpenAIErrorMiddleware rewrites {"error": "..."} responses on the OpenAI-compatible routes
+// into OpenAI error objects, so SDK clients can parse failures from auth, quota and
+// maintenance middleware as well as handlers. It must run before those middleware.
+func OpenAIErrorMiddleware(pathPrefixes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasPathPrefix(c.Request.URL.Path, pathPrefixes) {
+			c.Next()
+			return
+		}
+
+		w := &openAIErrorWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		c.Next()
+
+		c.Writer = w.ResponseWriter
+		if !w.buffering {
+			return
+		}
+		_, _ = w.ResponseWriter.Write(translateOpenAIError(w.Status(), w.body.Bytes()))
+	}
+}
+
+// translateOpenAIError converts an error body into OpenAI's envelope. Bodies that already
+// carry an error object, or that are not errors at all, are returned unchanged.
+func translateOpenAIError(status int, body []byte) []byte {
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	value, ok := fields["error"].(string)
+	if !ok {
+		return body
+	}
+
+	message, code := value, ""
+	if errorCodePattern.MatchString(value) {
+		code = value
+		if detail, ok := fields["message"].(string); ok && detail != "" {
+			message = detail
+		}
+	}
+	if code == "" {
+		code = defaultOpenAIErrorCode(status)
+	}
+
+	apiErr := OpenAIError{Message: message, Type: openAIErrorType(status, code)}
+	if param, ok := fields["param"].(string); ok && param != "" {
+		apiErr.Param = &param
+	}
+	if code != "" {
+		apiErr.Code = &code
+	}
+
+	translated, err := json.Marshal(gin.H{"error": apiErr})
+	if err != nil {
+		return body
+	}
+	return translated
+}
+
+// openAIErrorType maps a status to the error type OpenAI uses for it.
+func openAIErrorType(status int, code string) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authentication_error"
+	case status == http.StatusForbidden:
+		return "permission_error"
+	case status == http.StatusNotFound:
+		return "not_found_error"
+	case status == http.StatusTooManyRequests && code == "quota_exceeded":
+		return "insufficient_quota"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status >= http.StatusInternalServerError:
+		return "server_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+// defaultOpenAIErrorCode supplies a code for errors that only carry a message.
+func defaultOpenAIErrorCode(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return "invalid_api_key"
+	case http.StatusTooManyRequests:
+		return "rate_limit_exceeded"
+	case http.StatusServiceUnavailable:
+		return "service_unavailable"
+	default:
+		return ""
+	}
+}
+
+func hasPathPrefix(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/credential"
+)
+
+// ProviderKeys loads the caller's own provider keys into the request context, so generation
+// handlers use them instead of the server's keys, and records when one served the request.
+// When the keys cannot be loaded the server's keys are used.
+func ProviderKeys(store *credential.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := contextUserID(c)
+		if !store.Enabled() || !ok {
+			c.Next()
+			return
+		}
+
+		keys, err := store.Keys(c.Request.Context(), int(userID))
+		if err != nil {
+			log.Printf("Failed to load provider keys of user %d: %v", userID, err)
+		} else if len(keys) > 0 {
+			c.Request = c.Request.WithContext(credential.WithKeys(c.Request.Context(), keys))
+		}
+
+		c.Next()
+
+		provider := c.GetString(QueryLogModelProvider)
+		if !c.GetBool(QueryLogUserKey) || provider == "" || c.Writer.Status() >= 400 {
+			return
+		}
+		if err := store.MarkUsed(context.WithoutCancel(c.Request.Context()), int(userID), provider); err != nil {
+			log.Printf("Failed to record provider key use: %v", err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxUserAgentLength bounds the user agents stored with query logs and audit entries.
+const maxUserAgentLength = 512
+
+// trustedPlatforms maps TRUSTED_PLATFORM names to the header their edge sets.
+var trustedPlatforms = map[string]string{
+	"cloudflare": gin.PlatformCloudflare,
+	"google":     gin.PlatformGoogleAppEngine,
+	"flyio":      gin.PlatformFlyIO,
+}
+
+// TrustedProxiesFromEnv reads TRUSTED_PROXIES, a comma-separated list of proxy IPs or CIDRs
+// whose X-Forwarded-For headers are used to find the client IP. Unset or "none" trusts no
+// proxy, so the client IP is always the connection's remote address and cannot be spoofed.
+func TrustedProxiesFromEnv() []string {
+	raw := strings.TrimSpace(os.Getenv("TRUSTED_PROXIES"))
+	if raw == "" || strings.EqualFold(raw, "none") {
+		return nil
+	}
+	return splitList(raw)
+}
+
+// ConfigureClientIP sets how engine finds the client IP of a request. Besides
+// TRUSTED_PROXIES it reads CLIENT_IP_HEADERS, the headers trusted proxies put the client IP
+// in, tried in order (default X-Forwarded-For, then X-Real-IP), and TRUSTED_PLATFORM, a
+// header set by the hosting platform's edge that is believed whatever the peer: "cloudflare",
+// "google", "flyio" or a header name.
+func ConfigureClientIP(engine *gin.Engine) error {
+	// gin trusts every proxy unless told otherwise, so the list is always set.
+	if err := engine.SetTrustedProxies(TrustedProxiesFromEnv()); err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	if headers := splitList(os.Getenv("CLIENT_IP_HEADERS")); len(headers) > 0 {
+		engine.RemoteIPHeaders = headers
+	}
+	if platform := strings.TrimSpace(os.Getenv("TRUSTED_PLATFORM")); platform != "" {
+		if header, ok := trustedPlatforms[strings.ToLower(platform)]; ok {
+			platform = header
+		}
+		engine.TrustedPlatform = platform
+	}
+	return nil
+}
+
+// ClientIP returns the IP of the client that sent the request, as resolved by
+// ConfigureClientIP. IPv4 clients reaching an IPv6 listener are reported in dotted form, so
+// rate limits, allowlists and logs see one address per client.
+func ClientIP(c *gin.Context) string {
+	ip := c.ClientIP()
+	if addr, err := netip.ParseAddr(ip); err == nil {
+		return addr.Unmap().WithZone("").String()
+	}
+	return ip
+}
+
+// UserAgent returns the request's User-Agent header, truncated for storage.
+func UserAgent(c *gin.Context) string {
+	ua := c.Request.UserAgent()
+	if len(ua) <= maxUserAgentLength {
+		return ua
+	}
+	ua = ua[:maxUserAgentLength]
+	for len(ua) > 0 && !utf8.ValidString(ua) {
+		ua = ua[:len(ua)-1]
+	}
+	return ua
+}
+
+func splitList(raw string) []string {
+	var values []string
+	for _, value := range strings.Split(raw, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,90 @@
+package middleware_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testharness"
+)
+
+// httptest requests come from 192.0.2.1.
+const remoteAddr = "192.0.2.1"
+
+// allowlistedKey returns a key that may only be used from 203.0.113.7.
+func allowlistedKey(t *testing.T, h *testharness.Harness) string {
+	t.Helper()
+	userID, keyID, key := newKeyOwner(t, h)
+	allowed, err := auth.NormalizeAllowedCIDRs([]string{"203.0.113.7"})
+	if err != nil {
+		t.Fatalf("normalize allowlist: %v", err)
+	}
+	if _, err := auth.UpdateAPIKey(h.DB, userID, keyID, nil, false, nil, &allowed); err != nil {
+		t.Fatalf("set allowlist: %v", err)
+	}
+	return key
+}
+
+func modelsFrom(t *testing.T, h *testharness.Harness, key, forwardedFor string) int {
+	t.Helper()
+	headers := testharness.APIKey(key)
+	headers["X-Forwarded-For"] = forwardedFor
+	rec, err := h.Do(http.MethodGet, "/v1/models", nil, headers)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	return rec.Code
+}
+
+func TestAllowlistIgnoresForwardedForWithoutTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	h := newHarness(t)
+	key := allowlistedKey(t, h)
+
+	if code := modelsFrom(t, h, key, "203.0.113.7"); code != http.StatusForbidden {
+		t.Fatalf("spoofed X-Forwarded-For: got %d, want 403", code)
+	}
+}
+
+func TestAllowlistUsesForwardedForFromTrustedProxy(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", remoteAddr)
+	h := newHarness(t)
+	key := allowlistedKey(t, h)
+
+	if code := modelsFrom(t, h, key, "203.0.113.7"); code != http.StatusOK {
+		t.Fatalf("allowed client behind trusted proxy: got %d, want 200", code)
+	}
+	if code := modelsFrom(t, h, key, "198.51.100.9"); code != http.StatusForbidden {
+		t.Fatalf("other client behind trusted proxy: got %d, want 403", code)
+	}
+}
+
+func TestLoginIPLockoutIgnoresForwardedForWithoutTrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	t.Setenv("LOGIN_MAX_ATTEMPTS_PER_IP", "2")
+	t.Setenv("LOGIN_BACKOFF_BASE", "0")
+	h := newHarness(t)
+	if _, err := h.CreateUser("alice", "password123", "user"); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	login := func(username, password, forwardedFor string) int {
+		rec, err := h.Do(http.MethodPost, "/api/v1/auth/login",
+			map[string]string{"username": username, "password": password},
+			map[string]string{"X-Forwarded-For": forwardedFor})
+		if err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		return rec.Code
+	}
+
+	// Each guess claims a different address, but all come from the same connection.
+	for i, forwardedFor := range []string{"198.51.100.1", "198.51.100.2"} {
+		if code := login("guess"+forwardedFor, "wrong-password", forwardedFor); code != http.StatusUnauthorized {
+			t.Fatalf("guess %d: got %d, want 401", i+1, code)
+		}
+	}
+	if code := login("alice", "password123", "198.51.100.3"); code != http.StatusTooManyRequests {
+		t.Fatalf("login from locked IP: got %d, want 429", code)
+	}
+}
@@ -4,22 +4,35 @@ import (
 	"bytes"
 	"io"
 	"log"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/models"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
 )
 
 // Context keys for handler-specific data.
 const (
 	QueryLogModelProvider    = "querylog_model_provider"
+	QueryLogModel            = "querylog_model"
 	QueryLogInputTokens      = "querylog_input_tokens"
 	QueryLogOutputTokens     = "querylog_output_tokens"
 	QueryLogRAGContextsCount = "querylog_rag_contexts_count"
 	QueryLogConversationID   = "querylog_conversation_id"
 	QueryLogErrorMessage     = "querylog_error_message"
+	QueryLogInterrupted      = "querylog_interrupted"
+	QueryLogCacheStatus      = "querylog_cache_status"
+	QueryLogModeration       = "querylog_moderation"
+	QueryLogModerationRules  = "querylog_moderation_rules"
+	// QueryLogUserKey is set when the caller's own provider key served the request.
+	QueryLogUserKey = "querylog_user_key"
+	// QueryLogExperimentID and QueryLogVariant record the experiment variant serving the request.
+	QueryLogExperimentID = "querylog_experiment_id"
+	QueryLogVariant      = "querylog_experiment_variant"
+	// QueryLogKeyCreator records the member who created the organization key of a request.
+	// Organization keys carry no user_id, so it only attributes the logged request.
+	QueryLogKeyCreator = "querylog_key_creator"
 )
 
 // responseWriter wraps gin.ResponseWriter to capture the response body.
@@ -39,7 +52,8 @@ func (w *responseWriter) WriteString(s string) (int, error) {
 }
 
 // QueryLogMiddleware captures request/response data for tracked endpoints and logs asynchronously.
-func QueryLogMiddleware(service *querylog.Service, trackedEndpoints []string) gin.HandlerFunc {
+// The extractor picks out the query of each request and redacts the stored payload.
+func QueryLogMiddleware(service *querylog.Service, extractor *querylog.Extractor, trackedEndpoints []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		path := c.FullPath()
 		if path == "" {
@@ -62,13 +76,17 @@ func QueryLogMiddleware(service *querylog.Service, trackedEndpoints []string) gi
 		c.Next() // Execute the rest of the chain/handler
 
 		latencyMs := time.Since(startTime).Milliseconds()
+		queryText, payload := extractor.Extract(path, requestBody)
 
 		logEntry := &querylog.QueryLog{
 			Endpoint:  path,
-			Query:     extractQuery(requestBody),
+			Query:     payload,
+			QueryText: queryText,
 			Response:  truncateResponse(rw.body.String(), 10000),
 			LatencyMs: latencyMs,
 			Status:    getStatus(c.Writer.Status()),
+			ClientIP:  ClientIP(c),
+			UserAgent: UserAgent(c),
 			CreatedAt: time.Now().UTC(),
 		}
 
@@ -76,6 +94,10 @@ func QueryLogMiddleware(service *querylog.Service, trackedEndpoints []string) gi
 			if id, ok := toInt64(userID); ok {
 				logEntry.UserID = id
 			}
+		} else if creatorID, ok := c.Get(QueryLogKeyCreator); ok {
+			if id, ok := toInt64(creatorID); ok {
+				logEntry.UserID = id
+			}
 		}
 
 		if apiKeyID, ok := c.Get("api_key_id"); ok {
@@ -89,6 +111,11 @@ func QueryLogMiddleware(service *querylog.Service, trackedEndpoints []string) gi
 				logEntry.ModelProvider = v
 			}
 		}
+		if model, ok := c.Get(QueryLogModel); ok {
+			if v, ok := model.(string); ok {
+				logEntry.Model = v
+			}
+		}
 		if tokens, ok := c.Get(QueryLogInputTokens); ok {
 			if v, ok := toInt(tokens); ok {
 				logEntry.InputTokens = v
@@ -115,6 +142,49 @@ func QueryLogMiddleware(service *querylog.Service, trackedEndpoints []string) gi
 			}
 		}
 
+		if status, ok := c.Get(QueryLogCacheStatus); ok {
+			if v, ok := status.(string); ok {
+				logEntry.CacheStatus = v
+			}
+		}
+
+		if verdict, ok := c.Get(QueryLogModeration); ok {
+			if v, ok := verdict.(string); ok {
+				logEntry.Moderation = v
+			}
+		}
+		if rules, ok := c.Get(QueryLogModerationRules); ok {
+			if v, ok := rules.(string); ok {
+				logEntry.ModerationRules = v
+			}
+		}
+
+		if interrupted, ok := c.Get(QueryLogInterrupted); ok {
+			if v, ok := interrupted.(bool); ok {
+				logEntry.Interrupted = v
+			}
+		}
+
+		if userKey, ok := c.Get(QueryLogUserKey); ok {
+			if v, ok := userKey.(bool); ok {
+				logEntry.UserKey = v
+			}
+		}
+
+		if experimentID, ok := c.Get(QueryLogExperimentID); ok {
+			if id, ok := toInt64(experimentID); ok {
+				logEntry.ExperimentID = &id
+			}
+		}
+
+		if variant, ok := c.Get(QueryLogVariant); ok {
+			if v, ok := variant.(string); ok {
+				logEntry.Variant = v
+			}
+		}
+
+		logEntry.CostUSD = models.EstimateCost(logEntry.ModelProvider, logEntry.Model, logEntry.InputTokens, logEntry.OutputTokens)
+
 		// Require user_id to avoid foreign-key failures.
 		if logEntry.UserID == 0 {
 			log.Printf("querylog: skipping entry for %s, no user_id in context", path)
@@ -134,10 +204,6 @@ func isTrackedEndpoint(path string, tracked []string) bool {
 	return false
 }
 
-func extractQuery(body []byte) string {
-	return strings.TrimSpace(string(body))
-}
-
 func truncateResponse(val string, maxLen int) string {
 	if maxLen <= 0 {
 		return ""
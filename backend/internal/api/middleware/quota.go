@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/usage"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/webhook"
+)
+
+// quotaNotified records, per subject, the end of the quota period a quota.exceeded event
+// was last published for, so each period is announced once.
+var quotaNotified sync.Map
+
+// QuotaMiddleware rejects requests from users who have used up their monthly token quota.
+// Requests made with an organization key are checked against the organization's pooled quota.
+// The first rejection of each period is published as a quota.exceeded event when events is
+// non-nil. It must run after an authentication middleware that sets user_id.
+func QuotaMiddleware(service *usage.Service, events webhook.Publisher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var (
+			summary *usage.Summary
+			subject string
+			err     error
+		)
+		if orgID, ok := c.Get("org_id"); ok {
+			subject = fmt.Sprintf("organization %v", orgID)
+			summary, err = service.OrgSummary(c.Request.Context(), int64(orgID.(int)))
+		} else if userID, ok := contextUserID(c); ok {
+			subject = fmt.Sprintf("user %d", userID)
+			summary, err = service.Summary(c.Request.Context(), userID)
+		} else {
+			c.Next()
+			return
+		}
+		if err != nil {
+			// Metering problems should not take generation down with them.
+			log.Printf("usage: failed to check quota for %s: %v", subject, err)
+			c.Next()
+			return
+		}
+
+		if summary.Limit != nil {
+			c.Header("X-Quota-Limit", strconv.FormatInt(*summary.Limit, 10))
+			c.Header("X-Quota-Remaining", strconv.FormatInt(*summary.Remaining, 10))
+			c.Header("X-Quota-Reset", strconv.FormatInt(summary.PeriodEnd.Unix(), 10))
+		}
+
+		if summary.Exceeded() {
+			retryAfter := int(time.Until(summary.PeriodEnd).Seconds()) + 1
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			if events != nil {
+				if previous, loaded := quotaNotified.Swap(subject, summary.PeriodEnd); !loaded || !previous.(time.Time).Equal(summary.PeriodEnd) {
+					events.Publish(webhook.EventQuotaExceeded, summary)
+				}
+			}
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":    "quota_exceeded",
+				"message":  "Monthly token quota exceeded",
+				"limit":    *summary.Limit,
+				"used":     summary.TotalTokens,
+				"reset_at": summary.PeriodEnd,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func contextUserID(c *gin.Context) (int64, bool) {
+	value, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/ratelimit"
+)
+
+// RateLimitMiddleware rejects requests beyond the limiter's per-window allowance with 429.
+// Authenticated requests are counted per user, across all of the user's API keys, requests
+// made with organization keys per organization, and anonymous ones per client IP, so it should run after an authentication middleware.
+// Requests made with a trial token are counted per token against trialLimiter instead.
+// A nil limiter allows everything.
+func RateLimitMiddleware(limiter, trialLimiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ip:" + ClientIP(c)
+		if userID, ok := contextUserID(c); ok {
+			key = "user:" + strconv.FormatInt(userID, 10)
+		} else if orgID, ok := c.Get("org_id"); ok {
+			key = fmt.Sprintf("org:%v", orgID)
+		}
+		if c.GetString("user_role") == auth.RoleTrial && trialLimiter != nil {
+			if keyID, ok := c.Get("api_key_id"); ok {
+				limiter, key = trialLimiter, fmt.Sprintf("token:%v", keyID)
+			}
+		}
+
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		result, err := limiter.Allow(c.Request.Context(), key)
+		if err != nil {
+			// An unreachable counter store should not take the API down with it.
+			log.Printf("ratelimit: failed to count request for %s: %v", key, err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(result.ResetAt.Unix(), 10))
+
+		if !result.Allowed {
+			retryAfter := int(time.Until(result.ResetAt).Seconds()) + 1
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":    "rate_limit_exceeded",
+				"message":  "Too many requests, retry after the current window resets",
+				"limit":    result.Limit,
+				"reset_at": result.ResetAt,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/requestlimit"
+)
+
+// RequestLimitsMiddleware rejects bodies over cfg.MaxBodyBytes with 413 and JSON requests
+// whose messages or n_results break the limits with 422, listing every offending field. It
+// reads the whole body, so it must run before middleware that buffers it for logging or
+// moderation.
+func RequestLimitsMiddleware(cfg requestlimit.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		if cfg.MaxBodyBytes > 0 {
+			if c.Request.ContentLength > cfg.MaxBodyBytes {
+				abortBodyTooLarge(c, cfg.MaxBodyBytes)
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.MaxBodyBytes)
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				abortBodyTooLarge(c, cfg.MaxBodyBytes)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		if errs := cfg.Check(body); len(errs) > 0 {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "validation_failed",
+				"message": errs[0].Message,
+				"param":   errs[0].Field,
+				"errors":  errs,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortBodyTooLarge(c *gin.Context, limit int64) {
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":   "request_too_large",
+		"message": fmt.Sprintf("Request body exceeds the maximum of %d bytes", limit),
+	})
+}
@@ -9,14 +9,37 @@ import (
 
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/handlers"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/artifact"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/audit"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/backup"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/batch"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cachewarm"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/contracttemplate"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/credential"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/eval"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/experiment"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/feedback"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/health"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/ingestion"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/moderation"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/prompttemplate"
 	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/ratelimit"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/replay"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/requestlimit"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/showcase"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/spend"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/stacks"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/usage"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/webhook"
 
 	_ "github.com/Quantum3-Labs/stacks-builder/backend/docs" // Import generated docs
 )
 
 // SetupRoutes configures all API routes
-func SetupRoutes(router *gin.Engine, db *sql.DB, qlRepo *querylog.Repository, qlService *querylog.Service) {
+func SetupRoutes(router *gin.Engine, db *sql.DB, qlRepo *querylog.Repository, qlService *querylog.Service, keySweeper *auth.StaleKeySweeper, staleKeyCfg auth.StaleKeyConfig, ingestManager *ingestion.Manager, batchManager *batch.Manager, cacheWarmer *cachewarm.Warmer, trials *auth.TrialService, services *handlers.ServiceRegistry, webhooks *webhook.Dispatcher, spendService *spend.Service, backups *backup.Service, artifacts *artifact.Store, evals *eval.Service, archiver *querylog.Archiver) {
 	// Swagger documentation
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
@@ -27,62 +50,380 @@ func SetupRoutes(router *gin.Engine, db *sql.DB, qlRepo *querylog.Repository, ql
 	router.GET("/health", healthHandler)
 	router.HEAD("/health", healthHandler)
 
+	// Liveness never touches dependencies; readiness probes them with cached results
+	router.GET("/health/live", handlers.HealthLive())
+	router.HEAD("/health/live", handlers.HealthLive())
+	router.GET("/health/ready", handlers.HealthReady(handlers.NewHealthChecker(db, services, health.ConfigFromEnv())))
+
+	// Password accounts for registration, login and role changes
+	users := auth.NewUserRepository(db)
+
+	// Role permissions checked by the admin and ingestion routes
+	roles := auth.NewRoleRepository(db)
+	can := func(permission string) gin.HandlerFunc {
+		return middleware.RequirePermission(roles, permission)
+	}
+
+	// Session tokens for web clients
+	tokens := auth.NewTokenService(db, auth.TokenConfigFromEnv())
+
+	// GitHub and Google login, issuing the same session tokens as password login
+	oauth := auth.NewOAuthService(db, auth.OAuthConfigFromEnv())
+
+	// How long owners may restore a revoked API key
+	keyRestoreWindow := auth.APIKeyRestoreWindowFromEnv()
+
+	// Backoff and lockout after failed password logins
+	loginGuard := auth.NewLoginGuard(db, auth.LoginGuardConfigFromEnv())
+
+	// Query extraction and redaction for query log entries
+	qlExtractor := querylog.NewExtractor(querylog.ExtractConfigFromEnv())
+
+	// Denylist, length and provider checks on chat and generation prompts
+	moderated := middleware.ModerationMiddleware(moderation.NewModerator(moderation.ConfigFromEnv()))
+
+	// Per-user request rate limits, shared through Redis when REDIS_URL is set
+	rateLimitCfg := ratelimit.ConfigFromEnv()
+	rateLimiter := ratelimit.New(rateLimitCfg)
+	// Stricter limits for anonymous trial tokens, counted per token
+	trialLimiter := ratelimit.New(ratelimit.TrialConfigFromEnv())
+
+	// Monthly token metering and quotas
+	usageService := usage.NewService(db, usage.ConfigFromEnv())
+
+	// Audit trail of auth and admin actions
+	auditRepo := audit.NewRepository(db)
+	audited := func(action, targetType string) gin.HandlerFunc {
+		return middleware.Audit(auditRepo, action, targetType)
+	}
+
+	// Named code generation prompt templates, from files and the database
+	templateRepo := prompttemplate.NewRepository(db, prompttemplate.DirFromEnv())
+
+	// Curated Clarity contract scaffolds, built in and from the database
+	contractTemplates := contracttemplate.NewRepository(db)
+
+	// Ratings of generated answers
+	feedbackRepo := feedback.NewRepository(db)
+
+	// A/B experiments over providers, models and prompt templates
+	experimentRepo := experiment.NewRepository(db)
+
+	// Users' own provider keys, encrypted at rest; disabled without BYOK_ENCRYPTION_KEY
+	credentials := credential.NewStore(db, credential.ConfigFromEnv())
+	providerKeys := middleware.ProviderKeys(credentials)
+
+	// Runtime override of the codegen provider and model; loaded at startup
+	codegenConfig := codegen.NewRuntimeConfigStore(db)
+
 	// API v1 routes
 	v1 := router.Group("/api/v1")
 	{
 		// Authentication routes (public register/login)
 		authGroup := v1.Group("/auth")
 		{
-			authGroup.POST("/register", handlers.Register(db))
-			authGroup.POST("/login", handlers.Login(db))
+			authGroup.POST("/register", audited(audit.ActionUserRegister, audit.TargetUser), handlers.Register(users))
+			authGroup.POST("/login", audited(audit.ActionUserLogin, audit.TargetUser), handlers.Login(users, tokens, loginGuard))
+			authGroup.POST("/trial", audited(audit.ActionTrialStart, audit.TargetUser), handlers.StartTrial(trials))
+			authGroup.GET("/oauth/providers", handlers.ListOAuthProviders(oauth))
+			authGroup.GET("/oauth/:provider", handlers.OAuthAuthorize(oauth))
+			authGroup.GET("/oauth/:provider/callback", audited(audit.ActionUserOAuthLogin, audit.TargetUser), handlers.OAuthCallback(oauth, tokens))
+			authGroup.POST("/refresh", handlers.RefreshToken(tokens))
+			authGroup.POST("/logout", handlers.Logout(tokens))
+			// The one route open to accounts that must change their password
+			authGroup.POST("/password", middleware.AllowPendingPasswordChange(), middleware.UserAuth(db, tokens), audited(audit.ActionUserPasswordChange, audit.TargetUser), handlers.ChangePassword(users, tokens))
 		}
 
 		protectedAuth := authGroup.Group("/")
-		protectedAuth.Use(middleware.BasicAuth(db))
+		protectedAuth.Use(middleware.UserAuth(db, tokens))
 		{
-			protectedAuth.POST("/keys", handlers.CreateAPIKey(db))
+			protectedAuth.POST("/keys", audited(audit.ActionAPIKeyCreate, audit.TargetAPIKey), handlers.CreateAPIKey(db))
 			protectedAuth.GET("/keys", handlers.ListAPIKeys(db))
-			protectedAuth.DELETE("/keys/:id", handlers.RevokeAPIKey(db))
+			protectedAuth.DELETE("/keys/:id", audited(audit.ActionAPIKeyRevoke, audit.TargetAPIKey), handlers.RevokeAPIKey(db))
+			protectedAuth.PATCH("/keys/:id", audited(audit.ActionAPIKeyUpdate, audit.TargetAPIKey), handlers.UpdateAPIKey(db))
+			protectedAuth.POST("/keys/:id/rotate", audited(audit.ActionAPIKeyRotate, audit.TargetAPIKey), handlers.RotateAPIKey(db))
+			protectedAuth.POST("/keys/:id/restore", audited(audit.ActionAPIKeyRestore, audit.TargetAPIKey), handlers.RestoreAPIKey(db, keyRestoreWindow))
+			protectedAuth.GET("/keys/:id/history", handlers.GetAPIKeyHistory(db))
+		}
+
+		// Providers, models, features and limits, for clients deciding what to offer before login
+		capabilities := handlers.GetCapabilities(oauth, trials, credentials, requestlimit.ConfigFromEnv(), rateLimitCfg)
+		v1.GET("/capabilities", capabilities)
+		v1.HEAD("/capabilities", capabilities)
+
+		// Token usage for the signed-in user
+		v1.GET("/usage", middleware.UserAuth(db, tokens), handlers.GetUsage(usageService))
+		// Token, request and cost breakdown by day and API key, from API clients and signed-in users
+		v1.GET("/usage/me", middleware.APIKeyOrUserAuth(db, tokens), middleware.RejectOrgKeys(), handlers.GetUsageReport(usageService))
+
+		// Chat conversations of the signed-in user
+		conversations := v1.Group("/conversations")
+		conversations.Use(middleware.UserAuth(db, tokens))
+		{
+			conversations.GET("", handlers.ListConversations(db))
+			conversations.GET("/:id", handlers.GetConversation(db))
+			conversations.PATCH("/:id", handlers.RenameConversation(db))
+			conversations.POST("/:id/branch", handlers.BranchConversation(db))
+			conversations.GET("/:id/export", handlers.ExportConversation(db))
+			conversations.POST(
+				"/:id/regenerate",
+				middleware.RateLimitMiddleware(rateLimiter, trialLimiter),
+				middleware.QuotaMiddleware(usageService, webhooks),
+				middleware.QueryLogMiddleware(qlService, qlExtractor, []string{"/api/v1/conversations/:id/regenerate"}),
+				providerKeys,
+				moderated,
+				handlers.RegenerateConversation(db, services),
+			)
+		}
+
+		// Provider API keys the signed-in user brings for their own generations
+		providerKeyGroup := v1.Group("/provider-keys")
+		providerKeyGroup.Use(middleware.UserAuth(db, tokens))
+		{
+			providerKeyGroup.GET("", handlers.ListProviderKeys(credentials))
+			providerKeyGroup.PUT("/:provider", audited(audit.ActionProviderKeySet, audit.TargetProviderKey), handlers.SetProviderKey(credentials))
+			providerKeyGroup.DELETE("/:provider", audited(audit.ActionProviderKeyDelete, audit.TargetProviderKey), handlers.DeleteProviderKey(credentials))
+		}
+
+		// Default generation settings of the caller, from API clients and signed-in users
+		v1.GET("/settings", middleware.APIKeyOrUserAuth(db, tokens), middleware.RejectOrgKeys(), handlers.GetSettings(db))
+		v1.PUT("/settings", middleware.APIKeyOrUserAuth(db, tokens), middleware.RejectOrgKeys(), handlers.UpdateSettings(db))
+
+		// Ratings of generated answers, from API clients and signed-in users
+		v1.POST("/feedback", middleware.APIKeyOrUserAuth(db, tokens), middleware.RejectOrgKeys(), handlers.SubmitFeedback(feedbackRepo))
+
+		// Organizations with shared API keys and pooled quotas
+		orgs := v1.Group("/orgs")
+		orgs.Use(middleware.UserAuth(db, tokens))
+		{
+			orgs.POST("", audited(audit.ActionOrgCreate, audit.TargetOrg), handlers.CreateOrg(db))
+			orgs.GET("", handlers.ListOrgs(db))
+			orgs.GET("/:id", handlers.GetOrg(db))
+			orgs.POST("/:id/members", audited(audit.ActionOrgMemberAdd, audit.TargetOrg), handlers.AddOrgMember(db))
+			orgs.DELETE("/:id/members/:user_id", audited(audit.ActionOrgMemberRemove, audit.TargetOrg), handlers.RemoveOrgMember(db))
+			orgs.POST("/:id/keys", audited(audit.ActionAPIKeyCreate, audit.TargetAPIKey), handlers.CreateOrgAPIKey(db))
+			orgs.GET("/:id/keys", handlers.ListOrgAPIKeys(db))
+			orgs.DELETE("/:id/keys/:key_id", audited(audit.ActionAPIKeyRevoke, audit.TargetAPIKey), handlers.RevokeOrgAPIKey(db))
+			orgs.GET("/:id/usage", handlers.GetOrgUsage(db, usageService))
 		}
 
 		// Ingestion routes (Basic Auth)
 		ingest := v1.Group("/ingest")
-		ingest.Use(middleware.BasicAuth(db), middleware.RequireRole(auth.RoleAdmin))
+		ingest.Use(middleware.UserAuth(db, tokens), can(auth.PermIngestionRun))
 		{
-			ingest.POST("/clone-repos", handlers.CloneRepos(db))
-			ingest.POST("/samples", handlers.IngestSamples(db))
-			ingest.POST("/docs", handlers.IngestDocs(db))
-			ingest.GET("/jobs", handlers.ListIngestionJobs(db))
-			ingest.GET("/jobs/:id", handlers.GetIngestionJob(db))
-			ingest.POST("/jobs/:id/cancel", handlers.CancelIngestionJob(db))
+			ingest.POST("/clone-repos", audited(audit.ActionIngestionStart, audit.TargetIngestion), handlers.CloneRepos(ingestManager))
+			ingest.POST("/samples", audited(audit.ActionIngestionStart, audit.TargetIngestion), handlers.IngestSamples(ingestManager))
+			ingest.POST("/docs", audited(audit.ActionIngestionStart, audit.TargetIngestion), handlers.IngestDocs(ingestManager))
+			ingest.POST("/repos", audited(audit.ActionIngestionStart, audit.TargetIngestion), handlers.IngestRepo(ingestManager))
+			ingest.GET("/jobs", handlers.ListIngestionJobs(ingestManager))
+			ingest.GET("/jobs/:id", handlers.GetIngestionJob(ingestManager))
+			ingest.POST("/jobs/:id/cancel", audited(audit.ActionIngestionCancel, audit.TargetIngestion), handlers.CancelIngestionJob(ingestManager))
 		}
 
-		// Admin query log endpoints (Basic Auth + admin role)
+		// Admin endpoints (session or Basic Auth), each requiring a permission of the caller's role
 		admin := v1.Group("/admin")
-		admin.Use(middleware.BasicAuth(db), middleware.RequireRole(auth.RoleAdmin))
+		admin.Use(middleware.UserAuth(db, tokens))
+		{
+			admin.GET("/query-logs", can(auth.PermQueryLogsRead), handlers.ListQueryLogs(qlRepo))
+			admin.GET("/query-logs/stats", can(auth.PermQueryLogsRead), handlers.GetQueryLogStats(qlRepo))  // Must come before /:id
+			admin.GET("/query-logs/export", can(auth.PermQueryLogsRead), handlers.ExportQueryLogs(qlRepo)) // Must come before /:id
+			admin.GET("/query-logs/pipeline", can(auth.PermQueryLogsRead), handlers.GetQueryLogPipelineStats(qlService)) // Must come before /:id
+			admin.GET("/query-logs/metrics", can(auth.PermQueryLogsRead), handlers.QueryLogMetrics(qlService))           // Must come before /:id
+			admin.GET("/query-logs/archives", can(auth.PermQueryLogsRead), handlers.ListQueryLogArchives(archiver))      // Must come before /:id
+			admin.POST("/query-logs/archives", can(auth.PermQueryLogsManage), audited(audit.ActionQueryLogArchive, audit.TargetQueryLog), handlers.RunQueryLogArchive(archiver))
+			admin.GET("/query-logs/archives/:name", can(auth.PermQueryLogsRead), handlers.SearchQueryLogArchive(archiver))
+			admin.GET("/query-logs/archives/:name/download", can(auth.PermQueryLogsRead), handlers.DownloadQueryLogArchive(archiver))
+			admin.POST("/query-logs/archives/:name/restore", can(auth.PermQueryLogsManage), audited(audit.ActionQueryLogRestore, audit.TargetQueryLog), handlers.RestoreQueryLogArchive(archiver))
+			admin.GET("/query-logs/:id", can(auth.PermQueryLogsRead), handlers.GetQueryLog(qlRepo))
+			admin.DELETE("/query-logs", can(auth.PermQueryLogsManage), audited(audit.ActionQueryLogPurge, audit.TargetQueryLog), handlers.PurgeQueryLogs(qlRepo))
+			admin.POST("/replay", can(auth.PermQueryLogsManage), audited(audit.ActionQueryLogReplay, audit.TargetQueryLog), handlers.ReplayQueryLogs(replay.NewRunner(qlRepo)))
+			admin.GET("/api-keys/stale", can(auth.PermAPIKeysManage), handlers.ListStaleAPIKeys(db, staleKeyCfg))
+			admin.POST("/api-keys/stale/sweep", can(auth.PermAPIKeysManage), audited(audit.ActionAPIKeySweep, audit.TargetAPIKey), handlers.SweepStaleAPIKeys(keySweeper))
+			admin.POST("/api-keys/:id/restore", can(auth.PermAPIKeysManage), audited(audit.ActionAPIKeyRestore, audit.TargetAPIKey), handlers.AdminRestoreAPIKey(db))
+			admin.GET("/api-keys/:id/history", can(auth.PermAPIKeysManage), handlers.AdminGetAPIKeyHistory(db))
+			admin.GET("/rag/bridge-health", can(auth.PermSystemManage), handlers.GetRAGBridgeMetrics(services))
+			admin.GET("/sources", can(auth.PermIngestionRun), handlers.ListSources(ingestManager))
+			admin.DELETE("/sources", can(auth.PermIngestionRun), audited(audit.ActionSourceDelete, audit.TargetSource), handlers.DeleteSource(ingestManager))
+			admin.POST("/sources/reindex", can(auth.PermIngestionRun), audited(audit.ActionIngestionStart, audit.TargetIngestion), handlers.ReindexSource(ingestManager))
+			admin.GET("/doc-sources", can(auth.PermIngestionRun), handlers.ListDocSources(ingestManager))
+			admin.POST("/doc-sources", can(auth.PermIngestionRun), audited(audit.ActionDocSourceCreate, audit.TargetDocSource), handlers.CreateDocSource(ingestManager))
+			admin.GET("/doc-sources/:id", can(auth.PermIngestionRun), handlers.GetDocSource(ingestManager))
+			admin.PUT("/doc-sources/:id", can(auth.PermIngestionRun), audited(audit.ActionDocSourceUpdate, audit.TargetDocSource), handlers.UpdateDocSource(ingestManager))
+			admin.DELETE("/doc-sources/:id", can(auth.PermIngestionRun), audited(audit.ActionDocSourceDelete, audit.TargetDocSource), handlers.DeleteDocSource(ingestManager))
+			admin.GET("/doc-sources/:id/pages", can(auth.PermIngestionRun), handlers.ListDocSourcePages(ingestManager))
+			admin.POST("/doc-sources/:id/crawl", can(auth.PermIngestionRun), audited(audit.ActionIngestionStart, audit.TargetIngestion), handlers.CrawlDocSource(ingestManager))
+			admin.GET("/vectorstore/collections", can(auth.PermIngestionRun), handlers.ListVectorStoreCollections(ingestManager))
+			admin.POST("/vectorstore/reindex", can(auth.PermIngestionRun), audited(audit.ActionIngestionStart, audit.TargetIngestion), handlers.ReindexVectorStore(ingestManager))
+			admin.GET("/vectorstore/collections/:name", can(auth.PermIngestionRun), handlers.GetVectorStoreCollection(ingestManager))
+			admin.GET("/cache/stats", can(auth.PermSystemManage), handlers.GetCacheStats(services))
+			admin.GET("/cache/warm", can(auth.PermSystemManage), handlers.GetCacheWarmStatus(cacheWarmer))
+			admin.POST("/cache/warm", can(auth.PermSystemManage), audited(audit.ActionCacheWarm, audit.TargetSystem), handlers.TriggerCacheWarm(cacheWarmer))
+			admin.PUT("/cache/warm", can(auth.PermSystemManage), audited(audit.ActionCacheWarmUpdate, audit.TargetSystem), handlers.UpdateCacheWarm(cacheWarmer))
+			admin.GET("/stats/timeseries", can(auth.PermQueryLogsRead), handlers.GetQueryLogTimeSeries(qlRepo))
+			admin.GET("/spend", can(auth.PermSystemManage), handlers.GetSpend(spendService))
+			admin.GET("/spend/alerts", can(auth.PermSystemManage), handlers.ListSpendAlerts(spendService))
+			admin.GET("/feedback", can(auth.PermQueryLogsRead), handlers.ListFeedback(feedbackRepo))
+			admin.GET("/feedback/stats", can(auth.PermQueryLogsRead), handlers.GetFeedbackStats(feedbackRepo))
+			admin.GET("/maintenance", can(auth.PermSystemManage), handlers.GetMaintenance())
+			admin.PUT("/maintenance", can(auth.PermSystemManage), audited(audit.ActionMaintenanceUpdate, audit.TargetSystem), handlers.UpdateMaintenance())
+			admin.GET("/prompts", can(auth.PermSystemManage), handlers.GetPromptConfig())
+			admin.PUT("/prompts", can(auth.PermSystemManage), audited(audit.ActionPromptsUpdate, audit.TargetSystem), handlers.UpdatePromptConfig())
+			admin.GET("/prompt-templates", can(auth.PermSystemManage), handlers.ListPromptTemplates(templateRepo))
+			admin.POST("/prompt-templates", can(auth.PermSystemManage), audited(audit.ActionPromptTemplateCreate, audit.TargetPromptTemplate), handlers.CreatePromptTemplate(templateRepo))
+			admin.GET("/prompt-templates/:name", can(auth.PermSystemManage), handlers.GetPromptTemplate(templateRepo))
+			admin.PUT("/prompt-templates/:name", can(auth.PermSystemManage), audited(audit.ActionPromptTemplateUpdate, audit.TargetPromptTemplate), handlers.UpdatePromptTemplate(templateRepo))
+			admin.DELETE("/prompt-templates/:name", can(auth.PermSystemManage), audited(audit.ActionPromptTemplateDelete, audit.TargetPromptTemplate), handlers.DeletePromptTemplate(templateRepo))
+			admin.POST("/contract-templates", can(auth.PermSystemManage), audited(audit.ActionContractTemplateCreate, audit.TargetContractTemplate), handlers.CreateContractTemplate(contractTemplates))
+			admin.PUT("/contract-templates/:name", can(auth.PermSystemManage), audited(audit.ActionContractTemplateUpdate, audit.TargetContractTemplate), handlers.UpdateContractTemplate(contractTemplates))
+			admin.DELETE("/contract-templates/:name", can(auth.PermSystemManage), audited(audit.ActionContractTemplateDelete, audit.TargetContractTemplate), handlers.DeleteContractTemplate(contractTemplates))
+			admin.POST("/storage/compress", can(auth.PermSystemManage), audited(audit.ActionStorageCompress, audit.TargetSystem), handlers.CompressStorage(db, qlRepo))
+			admin.POST("/backup", can(auth.PermSystemManage), audited(audit.ActionBackupCreate, audit.TargetBackup), handlers.CreateBackup(backups))
+			admin.GET("/backup", can(auth.PermSystemManage), handlers.ListBackups(backups))
+			admin.GET("/backup/:name", can(auth.PermSystemManage), audited(audit.ActionBackupDownload, audit.TargetBackup), handlers.DownloadBackup(backups))
+			admin.GET("/showcase", can(auth.PermSystemManage), handlers.ListShowcaseModeration(db))
+			admin.POST("/showcase/:id/approve", can(auth.PermSystemManage), audited(audit.ActionShowcaseApprove, audit.TargetShowcase), handlers.ReviewShowcaseEntry(db, showcase.StatusApproved))
+			admin.POST("/showcase/:id/reject", can(auth.PermSystemManage), audited(audit.ActionShowcaseReject, audit.TargetShowcase), handlers.ReviewShowcaseEntry(db, showcase.StatusRejected))
+			admin.GET("/providers/breakers", can(auth.PermSystemManage), handlers.GetProviderGuards())
+			admin.GET("/providers/metrics", can(auth.PermSystemManage), handlers.ProviderMetrics())
+			admin.GET("/evals/cases", can(auth.PermSystemManage), handlers.ListEvalCases(evals))
+			admin.POST("/evals/cases", can(auth.PermSystemManage), audited(audit.ActionEvalCaseCreate, audit.TargetEvalCase), handlers.CreateEvalCase(evals))
+			admin.PUT("/evals/cases/:id", can(auth.PermSystemManage), audited(audit.ActionEvalCaseUpdate, audit.TargetEvalCase), handlers.UpdateEvalCase(evals))
+			admin.DELETE("/evals/cases/:id", can(auth.PermSystemManage), audited(audit.ActionEvalCaseDelete, audit.TargetEvalCase), handlers.DeleteEvalCase(evals))
+			admin.POST("/evals/runs", can(auth.PermSystemManage), audited(audit.ActionEvalRun, audit.TargetEvalRun), handlers.TriggerEvalRun(evals))
+			admin.GET("/evals/runs", can(auth.PermSystemManage), handlers.ListEvalRuns(evals))
+			admin.GET("/evals/runs/:id", can(auth.PermSystemManage), handlers.GetEvalReport(evals))
+			admin.GET("/evals/report", can(auth.PermSystemManage), handlers.GetLatestEvalReport(evals))
+			admin.GET("/experiments", can(auth.PermSystemManage), handlers.ListExperiments(experimentRepo))
+			admin.POST("/experiments", can(auth.PermSystemManage), audited(audit.ActionExperimentCreate, audit.TargetExperiment), handlers.CreateExperiment(experimentRepo, templateRepo))
+			admin.GET("/experiments/:id", can(auth.PermSystemManage), handlers.GetExperiment(experimentRepo))
+			admin.PUT("/experiments/:id", can(auth.PermSystemManage), audited(audit.ActionExperimentUpdate, audit.TargetExperiment), handlers.UpdateExperiment(experimentRepo, templateRepo))
+			admin.DELETE("/experiments/:id", can(auth.PermSystemManage), audited(audit.ActionExperimentDelete, audit.TargetExperiment), handlers.DeleteExperiment(experimentRepo))
+			admin.POST("/experiments/:id/start", can(auth.PermSystemManage), audited(audit.ActionExperimentStart, audit.TargetExperiment), handlers.StartExperiment(experimentRepo))
+			admin.POST("/experiments/:id/stop", can(auth.PermSystemManage), audited(audit.ActionExperimentStop, audit.TargetExperiment), handlers.StopExperiment(experimentRepo))
+			admin.GET("/experiments/:id/results", can(auth.PermSystemManage), handlers.GetExperimentResults(experimentRepo))
+			admin.POST("/models/reload", can(auth.PermSystemManage), audited(audit.ActionModelsReload, audit.TargetSystem), handlers.ReloadModelRegistry())
+			admin.GET("/codegen-config", can(auth.PermSystemManage), handlers.GetCodegenConfig())
+			admin.PUT("/codegen-config", can(auth.PermSystemManage), audited(audit.ActionCodegenConfigUpdate, audit.TargetSystem), handlers.UpdateCodegenConfig(codegenConfig))
+			admin.DELETE("/codegen-config", can(auth.PermSystemManage), audited(audit.ActionCodegenConfigReset, audit.TargetSystem), handlers.ResetCodegenConfig(codegenConfig))
+			admin.GET("/webhooks", can(auth.PermSystemManage), handlers.ListWebhooks(webhooks))
+			admin.POST("/webhooks", can(auth.PermSystemManage), audited(audit.ActionWebhookCreate, audit.TargetWebhook), handlers.CreateWebhook(webhooks))
+			admin.GET("/webhooks/:id", can(auth.PermSystemManage), handlers.GetWebhook(webhooks))
+			admin.PUT("/webhooks/:id", can(auth.PermSystemManage), audited(audit.ActionWebhookUpdate, audit.TargetWebhook), handlers.UpdateWebhook(webhooks))
+			admin.DELETE("/webhooks/:id", can(auth.PermSystemManage), audited(audit.ActionWebhookDelete, audit.TargetWebhook), handlers.DeleteWebhook(webhooks))
+			admin.POST("/webhooks/:id/test", can(auth.PermSystemManage), audited(audit.ActionWebhookTest, audit.TargetWebhook), handlers.TestWebhook(webhooks))
+			admin.GET("/webhooks/:id/deliveries", can(auth.PermSystemManage), handlers.ListWebhookDeliveries(webhooks))
+			admin.GET("/users/:id/usage", can(auth.PermUsersManage), handlers.GetUserUsage(usageService))
+			admin.PUT("/users/:id/quota", can(auth.PermUsersManage), audited(audit.ActionUserQuotaUpdate, audit.TargetUser), handlers.UpdateUserQuota(usageService))
+			admin.GET("/orgs/:id/usage", can(auth.PermUsersManage), handlers.GetAdminOrgUsage(usageService))
+			admin.PUT("/orgs/:id/quota", can(auth.PermUsersManage), audited(audit.ActionOrgQuotaUpdate, audit.TargetOrg), handlers.UpdateOrgQuota(usageService))
+			admin.PUT("/users/:id/role", can(auth.PermUsersManage), audited(audit.ActionUserRoleChange, audit.TargetUser), handlers.UpdateUserRole(users))
+			admin.POST("/users/:id/unlock", can(auth.PermUsersManage), audited(audit.ActionUserUnlock, audit.TargetUser), handlers.UnlockUser(loginGuard))
+			admin.GET("/audit-logs", can(auth.PermAuditLogsRead), handlers.ListAuditLogs(auditRepo))
+			admin.GET("/audit-logs/:id", can(auth.PermAuditLogsRead), handlers.GetAuditLog(auditRepo))
+			admin.GET("/roles", can(auth.PermUsersManage), handlers.ListRoles(roles))
+			admin.GET("/roles/:name", can(auth.PermUsersManage), handlers.GetRole(roles))
+			admin.PUT("/roles/:name", can(auth.PermUsersManage), audited(audit.ActionRoleUpdate, audit.TargetRole), handlers.PutRole(roles))
+			admin.DELETE("/roles/:name", can(auth.PermUsersManage), audited(audit.ActionRoleDelete, audit.TargetRole), handlers.DeleteRole(roles))
+		}
+
+		// Public showcase gallery (no auth)
+		public := v1.Group("/public")
+		{
+			public.GET("/showcase", handlers.ListPublicShowcase(db))
+			public.GET("/showcase/:id", handlers.GetPublicShowcaseEntry(db))
+		}
+
+		// Showcase submissions (API Key Auth)
+		showcaseGroup := v1.Group("/showcase")
+		showcaseGroup.Use(middleware.APIKeyAuth(db), middleware.RejectOrgKeys())
 		{
-			admin.GET("/query-logs", handlers.ListQueryLogs(qlRepo))
-			admin.GET("/query-logs/stats", handlers.GetQueryLogStats(qlRepo))  // Must come before /:id
-			admin.GET("/query-logs/:id", handlers.GetQueryLog(qlRepo))
+			showcaseGroup.POST("", handlers.SubmitShowcaseEntry(db))
+			showcaseGroup.DELETE("/:id", handlers.WithdrawShowcaseEntry(db))
 		}
 
 		// RAG routes (API Key Auth)
 		rag := v1.Group("/rag")
 		rag.Use(
 			middleware.APIKeyAuth(db),
-			middleware.QueryLogMiddleware(qlService, []string{"/api/v1/rag/retrieve", "/api/v1/rag/generate"}),
+			middleware.RateLimitMiddleware(rateLimiter, trialLimiter),
+			middleware.QuotaMiddleware(usageService, webhooks),
+			middleware.QueryLogMiddleware(qlService, qlExtractor, []string{"/api/v1/rag/retrieve", "/api/v1/rag/generate", "/api/v1/rag/generate-project", "/api/v1/rag/generate-tests", "/api/v1/rag/templates/:name/instantiate"}),
+			providerKeys,
 		)
 		{
-			rag.POST("/retrieve", handlers.RetrieveContext(db))
-			rag.POST("/generate", handlers.GenerateCode(db))
+			rag.POST("/retrieve", handlers.RetrieveContext(db, services))
+			rag.POST("/generate", moderated, handlers.GenerateCode(db, services))
+			rag.POST("/generate-project", moderated, handlers.GenerateProject(db, services, artifacts))
+			rag.POST("/generate-tests", moderated, handlers.GenerateTests(db, services, artifacts))
+			rag.POST("/templates/:name/instantiate", moderated, handlers.InstantiateContractTemplate(db, services))
+			// Batches log one aggregated entry themselves
+			rag.POST("/generate/batch", middleware.RejectOrgKeys(), moderated, handlers.GenerateBatch(db, services, batchManager))
 		}
+
+		// Contract template library (API key or session)
+		v1.GET("/templates", middleware.APIKeyOrUserAuth(db, tokens), handlers.ListContractTemplates(contractTemplates))
+		v1.GET("/templates/:name", middleware.APIKeyOrUserAuth(db, tokens), handlers.GetContractTemplate(contractTemplates))
+
+		// Generated project bundles: signed links download without auth, owners renew links
+		v1.GET("/artifacts/:id", handlers.DownloadArtifact(artifacts))
+		v1.POST("/artifacts/:id/link", middleware.APIKeyOrUserAuth(db, tokens), middleware.RejectOrgKeys(), handlers.CreateArtifactLink(artifacts))
+
+		// Read-only contract calls against a Stacks node (API Key Auth, no quota check)
+		v1.POST("/stacks/call-read", middleware.APIKeyAuth(db), middleware.RateLimitMiddleware(rateLimiter, trialLimiter), handlers.CallReadOnly(stacks.NewClient(stacks.ConfigFromEnv())))
+
+		// Static analysis of Clarity code for the playground and generated code (API key or session)
+		v1.POST("/clarity/analyze", middleware.APIKeyOrUserAuth(db, tokens), middleware.RateLimitMiddleware(rateLimiter, trialLimiter), handlers.AnalyzeClarity())
+
+		// Batch job polling (API Key Auth, no quota check)
+		v1.GET("/rag/generate/batch/:id", middleware.APIKeyAuth(db), middleware.RejectOrgKeys(), handlers.GetBatchJob(batchManager))
+		v1.POST("/rag/generate/batch/:id/cancel", middleware.APIKeyAuth(db), middleware.RejectOrgKeys(), handlers.CancelBatchJob(batchManager))
 	}
 
-	// OpenAI-compatible chat completions endpoint (API Key Auth)
+	// OpenAI-compatible chat completions endpoint (personal API keys, which own the conversations)
 	router.POST(
 		"/v1/chat/completions",
 		middleware.APIKeyAuth(db),
-		middleware.QueryLogMiddleware(qlService, []string{"/v1/chat/completions"}),
-		handlers.ChatCompletions(db),
+		middleware.RejectOrgKeys(),
+		middleware.RateLimitMiddleware(rateLimiter, trialLimiter),
+		middleware.QuotaMiddleware(usageService, webhooks),
+		middleware.QueryLogMiddleware(qlService, qlExtractor, []string{"/v1/chat/completions"}),
+		providerKeys,
+		moderated,
+		handlers.ChatCompletions(db, services),
 	)
+	router.POST(
+		"/v1/chat/completions/continue",
+		middleware.APIKeyAuth(db),
+		middleware.RejectOrgKeys(),
+		middleware.RateLimitMiddleware(rateLimiter, trialLimiter),
+		middleware.QuotaMiddleware(usageService, webhooks),
+		middleware.QueryLogMiddleware(qlService, qlExtractor, []string{"/v1/chat/completions/continue"}),
+		providerKeys,
+		moderated,
+		handlers.ContinueChatCompletion(db, services),
+	)
+
+	// OpenAI-compatible embeddings with the RAG pipeline's model (API Key Auth)
+	router.POST(
+		"/v1/embeddings",
+		middleware.APIKeyAuth(db),
+		middleware.RateLimitMiddleware(rateLimiter, trialLimiter),
+		middleware.QuotaMiddleware(usageService, webhooks),
+		middleware.QueryLogMiddleware(qlService, qlExtractor, []string{"/v1/embeddings"}),
+		handlers.CreateEmbeddings(services),
+	)
+
+	// OpenAI Assistants-style threads over the caller's conversations (personal API keys)
+	threads := router.Group("/v1/threads", middleware.APIKeyAuth(db), middleware.RejectOrgKeys())
+	{
+		threads.GET("", handlers.ListThreads(db))
+		threads.POST("", handlers.CreateThread(db))
+		threads.GET("/:thread_id", handlers.GetThread(db))
+		threads.GET("/:thread_id/messages", handlers.ListThreadMessages(db))
+		threads.GET("/:thread_id/messages/:message_id", handlers.GetThreadMessage(db))
+	}
+
+	// OpenAI-compatible model listing backed by the model registry (API Key Auth)
+	router.GET("/v1/models", middleware.APIKeyAuth(db), handlers.ListModels())
+	router.GET("/v1/models/:id", middleware.APIKeyAuth(db), handlers.GetModel())
 }
@@ -0,0 +1,141 @@
+package artifact
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTTL             = 24 * time.Hour
+	defaultLinkTTL         = time.Hour
+	defaultMaxBytes        = 10 << 20
+	defaultCleanupInterval = time.Hour
+
+	// ContentTypeZip is the content type of every stored artifact.
+	ContentTypeZip = "application/zip"
+
+	idPrefix = "art_"
+)
+
+var (
+	// ErrNotFound is returned for unknown and expired artifacts.
+	ErrNotFound = errors.New("artifact not found")
+	// ErrInvalidLink is returned for download links with a missing, forged or expired signature.
+	ErrInvalidLink = errors.New("invalid or expired download link")
+	// ErrTooLarge is returned when a bundle exceeds the configured size limit.
+	ErrTooLarge = errors.New("artifact exceeds the size limit")
+)
+
+// Config controls how long artifacts are kept and how download links are signed.
+type Config struct {
+	// TTL is how long an artifact is kept after it is generated.
+	TTL time.Duration
+	// LinkTTL is how long a download link stays valid; links never outlive the artifact.
+	LinkTTL time.Duration
+	// MaxBytes bounds the size of a stored zip archive. Zero means unlimited.
+	MaxBytes int64
+	// CleanupInterval is how often expired artifacts are deleted.
+	CleanupInterval time.Duration
+	// Secret signs download links.
+	Secret []byte
+	// BaseURL prefixes download links, e.g. https://api.example.com. Links are relative
+	// without it.
+	BaseURL string
+}
+
+// ConfigFromEnv loads ARTIFACT_TTL, ARTIFACT_LINK_TTL, ARTIFACT_MAX_BYTES,
+// ARTIFACT_CLEANUP_INTERVAL and ARTIFACT_SIGNING_SECRET, which falls back to JWT_SECRET.
+// Links use PUBLIC_BACKEND_URL as their base. Without a secret, links do not survive a
+// restart.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		TTL:             defaultTTL,
+		LinkTTL:         defaultLinkTTL,
+		MaxBytes:        defaultMaxBytes,
+		CleanupInterval: defaultCleanupInterval,
+		Secret:          []byte(os.Getenv("ARTIFACT_SIGNING_SECRET")),
+		BaseURL:         strings.TrimRight(strings.TrimSpace(os.Getenv("PUBLIC_BACKEND_URL")), "/"),
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("ARTIFACT_TTL")); err == nil && ttl > 0 {
+		cfg.TTL = ttl
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("ARTIFACT_LINK_TTL")); err == nil && ttl > 0 {
+		cfg.LinkTTL = ttl
+	}
+	if n, err := strconv.ParseInt(strings.TrimSpace(os.Getenv("ARTIFACT_MAX_BYTES")), 10, 64); err == nil && n >= 0 {
+		cfg.MaxBytes = n
+	}
+	if interval, err := time.ParseDuration(os.Getenv("ARTIFACT_CLEANUP_INTERVAL")); err == nil && interval > 0 {
+		cfg.CleanupInterval = interval
+	}
+	if len(cfg.Secret) == 0 {
+		cfg.Secret = []byte(os.Getenv("JWT_SECRET"))
+	}
+	return cfg
+}
+
+// Artifact describes a stored project bundle. DownloadURL is only set on artifacts returned
+// with a fresh link.
+type Artifact struct {
+	ID          string    `json:"id"`
+	UserID      *int64    `json:"-"`
+	Name        string    `json:"name"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Files       int       `json:"files"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	DownloadURL string    `json:"download_url,omitempty"`
+	// LinkExpiresAt is when DownloadURL stops working.
+	LinkExpiresAt *time.Time `json:"link_expires_at,omitempty"`
+}
+
+// File is a single file of a bundle, stored under the bundle's top-level directory.
+type File struct {
+	Path    string
+	Content string
+}
+
+// Zip packs files into a zip archive under a top-level directory named after the bundle.
+func Zip(name string, files []File) ([]byte, error) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	modified := time.Now().UTC()
+
+	for _, file := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     name + "/" + file.Path,
+			Method:   zip.Deflate,
+			Modified: modified,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(file.Content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// newID returns a random artifact id; ids are unguessable but links still need a signature.
+func newID() string {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		log.Fatalf("artifact: failed to generate id: %v", err)
+	}
+	return idPrefix + hex.EncodeToString(raw)
+}
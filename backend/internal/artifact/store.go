@@ -0,0 +1,184 @@
+package artifact
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Store keeps generated bundles in the database and signs their download links.
+type Store struct {
+	db  *sql.DB
+	cfg Config
+	now func() time.Time
+}
+
+// NewStore returns a store backed by db. Without a secret, links are signed with a random
+// one.
+func NewStore(db *sql.DB, cfg Config) *Store {
+	if len(cfg.Secret) == 0 {
+		log.Println("artifact: no signing secret set, download links will not survive a restart")
+		cfg.Secret = make([]byte, 32)
+		if _, err := rand.Read(cfg.Secret); err != nil {
+			log.Fatalf("artifact: failed to generate signing secret: %v", err)
+		}
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultTTL
+	}
+	if cfg.LinkTTL <= 0 {
+		cfg.LinkTTL = defaultLinkTTL
+	}
+	if cfg.CleanupInterval <= 0 {
+		cfg.CleanupInterval = defaultCleanupInterval
+	}
+	return &Store{db: db, cfg: cfg, now: time.Now}
+}
+
+// Start deletes expired artifacts every CleanupInterval until ctx is cancelled.
+func (s *Store) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.cfg.CleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			if removed, err := s.Cleanup(ctx); err != nil {
+				log.Printf("artifact: cleanup failed: %v", err)
+			} else if removed > 0 {
+				log.Printf("artifact: removed %d expired artifacts", removed)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Save keeps content, a zip archive built with Zip holding the given number of files, for
+// TTL and returns it with a download link.
+func (s *Store) Save(ctx context.Context, userID *int64, name string, files int, content []byte) (*Artifact, error) {
+	if s.cfg.MaxBytes > 0 && int64(len(content)) > s.cfg.MaxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrTooLarge, len(content), s.cfg.MaxBytes)
+	}
+
+	now := s.now().UTC()
+	artifact := &Artifact{
+		ID:          newID(),
+		UserID:      userID,
+		Name:        name,
+		FileName:    name + ".zip",
+		ContentType: ContentTypeZip,
+		Size:        int64(len(content)),
+		Files:       files,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.cfg.TTL),
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO artifacts (id, user_id, name, file_name, content_type, size, files, content, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, artifact.ID, artifact.UserID, artifact.Name, artifact.FileName, artifact.ContentType,
+		artifact.Size, artifact.Files, content, artifact.CreatedAt, artifact.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("insert artifact: %w", err)
+	}
+	s.Link(artifact)
+	return artifact, nil
+}
+
+// Get returns an unexpired artifact without its content.
+func (s *Store) Get(ctx context.Context, id string) (*Artifact, error) {
+	var (
+		artifact Artifact
+		userID   sql.NullInt64
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, user_id, name, file_name, content_type, size, files, created_at, expires_at
+		FROM artifacts WHERE id = ? AND expires_at > ?
+	`, id, s.now().UTC()).Scan(&artifact.ID, &userID, &artifact.Name, &artifact.FileName,
+		&artifact.ContentType, &artifact.Size, &artifact.Files, &artifact.CreatedAt, &artifact.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get artifact: %w", err)
+	}
+	if userID.Valid {
+		artifact.UserID = &userID.Int64
+	}
+	return &artifact, nil
+}
+
+// Content returns an unexpired artifact with its zip archive.
+func (s *Store) Content(ctx context.Context, id string) (*Artifact, []byte, error) {
+	artifact, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	var content []byte
+	err = s.db.QueryRowContext(ctx, `SELECT content FROM artifacts WHERE id = ?`, id).Scan(&content)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read artifact: %w", err)
+	}
+	return artifact, content, nil
+}
+
+// Link sets a signed download link on artifact, valid for LinkTTL or until the artifact
+// expires, whichever comes first.
+func (s *Store) Link(artifact *Artifact) {
+	expires := s.now().UTC().Add(s.cfg.LinkTTL)
+	if artifact.ExpiresAt.Before(expires) {
+		expires = artifact.ExpiresAt
+	}
+	expires = expires.Truncate(time.Second)
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", s.sign(artifact.ID, expires.Unix()))
+	artifact.DownloadURL = s.cfg.BaseURL + "/api/v1/artifacts/" + url.PathEscape(artifact.ID) + "?" + query.Encode()
+	artifact.LinkExpiresAt = &expires
+}
+
+// Verify checks the expires and signature query parameters of a download link.
+func (s *Store) Verify(id, expires, signature string) error {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || signature == "" {
+		return ErrInvalidLink
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(id, unix))) {
+		return ErrInvalidLink
+	}
+	if !s.now().Before(time.Unix(unix, 0)) {
+		return ErrInvalidLink
+	}
+	return nil
+}
+
+// Cleanup deletes expired artifacts and returns how many were removed.
+func (s *Store) Cleanup(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM artifacts WHERE expires_at <= ?`, s.now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("delete expired artifacts: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *Store) sign(id string, expires int64) string {
+	mac := hmac.New(sha256.New, s.cfg.Secret)
+	mac.Write([]byte(id + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
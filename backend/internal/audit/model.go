@@ -0,0 +1,125 @@
+package audit
+
+import "time"
+
+// Actions stored in audit_logs.action.
+const (
+	ActionUserRegister           = "user.register"
+	ActionUserCreate             = "user.create"
+	ActionUserDeactivate         = "user.deactivate"
+	ActionUserLogin              = "user.login"
+	ActionUserOAuthLogin         = "user.oauth_login"
+	ActionUserRoleChange         = "user.role_change"
+	ActionUserQuotaUpdate        = "user.quota_update"
+	ActionUserUnlock             = "user.unlock"
+	ActionUserPasswordChange     = "user.password_change"
+	ActionRoleUpdate             = "role.update"
+	ActionRoleDelete             = "role.delete"
+	ActionTrialStart             = "trial.start"
+	ActionOrgCreate              = "org.create"
+	ActionOrgMemberAdd           = "org.member_add"
+	ActionOrgMemberRemove        = "org.member_remove"
+	ActionOrgQuotaUpdate         = "org.quota_update"
+	ActionAPIKeyCreate           = "api_key.create"
+	ActionAPIKeyUpdate           = "api_key.update"
+	ActionAPIKeyRotate           = "api_key.rotate"
+	ActionAPIKeyRevoke           = "api_key.revoke"
+	ActionAPIKeyRestore          = "api_key.restore"
+	ActionAPIKeySweep            = "api_key.sweep_stale"
+	ActionQueryLogPurge          = "query_log.purge"
+	ActionQueryLogReplay         = "query_log.replay"
+	ActionQueryLogArchive        = "query_log.archive"
+	ActionQueryLogRestore        = "query_log.restore"
+	ActionIngestionStart         = "ingestion.start"
+	ActionIngestionCancel        = "ingestion.cancel"
+	ActionSourceDelete           = "source.delete"
+	ActionDocSourceCreate        = "doc_source.create"
+	ActionDocSourceUpdate        = "doc_source.update"
+	ActionDocSourceDelete        = "doc_source.delete"
+	ActionMaintenanceUpdate      = "maintenance.update"
+	ActionPromptsUpdate          = "prompts.update"
+	ActionPromptTemplateCreate   = "prompt_template.create"
+	ActionPromptTemplateUpdate   = "prompt_template.update"
+	ActionPromptTemplateDelete   = "prompt_template.delete"
+	ActionModelsReload           = "models.reload"
+	ActionCodegenConfigUpdate    = "codegen_config.update"
+	ActionCodegenConfigReset     = "codegen_config.reset"
+	ActionCacheWarm              = "cache.warm"
+	ActionCacheWarmUpdate        = "cache.warm_update"
+	ActionStorageCompress        = "storage.compress"
+	ActionBackupCreate           = "backup.create"
+	ActionBackupDownload         = "backup.download"
+	ActionShowcaseApprove        = "showcase.approve"
+	ActionShowcaseReject         = "showcase.reject"
+	ActionWebhookCreate          = "webhook.create"
+	ActionWebhookUpdate          = "webhook.update"
+	ActionWebhookDelete          = "webhook.delete"
+	ActionWebhookTest            = "webhook.test"
+	ActionEvalCaseCreate         = "eval_case.create"
+	ActionEvalCaseUpdate         = "eval_case.update"
+	ActionEvalCaseDelete         = "eval_case.delete"
+	ActionEvalRun                = "eval.run"
+	ActionProviderKeySet         = "provider_key.set"
+	ActionProviderKeyDelete      = "provider_key.delete"
+	ActionExperimentCreate       = "experiment.create"
+	ActionExperimentUpdate       = "experiment.update"
+	ActionExperimentDelete       = "experiment.delete"
+	ActionExperimentStart        = "experiment.start"
+	ActionExperimentStop         = "experiment.stop"
+	ActionContractTemplateCreate = "contract_template.create"
+	ActionContractTemplateUpdate = "contract_template.update"
+	ActionContractTemplateDelete = "contract_template.delete"
+)
+
+// Target types stored in audit_logs.target_type.
+const (
+	TargetUser             = "user"
+	TargetOrg              = "organization"
+	TargetAPIKey           = "api_key"
+	TargetQueryLog         = "query_log"
+	TargetIngestion        = "ingestion_job"
+	TargetSource           = "indexed_source"
+	TargetDocSource        = "doc_source"
+	TargetShowcase         = "showcase_entry"
+	TargetPromptTemplate   = "prompt_template"
+	TargetWebhook          = "webhook"
+	TargetSystem           = "system"
+	TargetBackup           = "backup"
+	TargetRole             = "role"
+	TargetEvalCase         = "eval_case"
+	TargetEvalRun          = "eval_run"
+	TargetProviderKey      = "provider_key"
+	TargetExperiment       = "experiment"
+	TargetContractTemplate = "contract_template"
+)
+
+// Outcomes stored in audit_logs.outcome.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Entry records who performed an auth or admin action, on what, and whether it succeeded.
+type Entry struct {
+	ID      int64  `json:"id"`
+	ActorID *int64 `json:"actor_id,omitempty"`
+	// ActorUsername is the authenticated user, or the username submitted to register and login.
+	ActorUsername string         `json:"actor_username,omitempty"`
+	Action        string         `json:"action"`
+	TargetType    string         `json:"target_type,omitempty"`
+	TargetID      string         `json:"target_id,omitempty"`
+	Outcome       string         `json:"outcome"`
+	StatusCode    int            `json:"status_code"`
+	Details       map[string]any `json:"details,omitempty"`
+	IPAddress     string         `json:"ip_address,omitempty"`
+	UserAgent     string         `json:"user_agent,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// OutcomeForStatus maps an HTTP status code to an outcome.
+func OutcomeForStatus(code int) string {
+	if code >= 200 && code < 400 {
+		return OutcomeSuccess
+	}
+	return OutcomeFailure
+}
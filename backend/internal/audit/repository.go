@@ -0,0 +1,243 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an audit entry cannot be located.
+var ErrNotFound = errors.New("audit entry not found")
+
+// Repository persists audit entries.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository returns a repository backed by the supplied sql.DB handle.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// ListParams defines filters and pagination for listing audit entries.
+type ListParams struct {
+	Page       int
+	Limit      int
+	ActorID    *int64
+	Action     string
+	TargetType string
+	TargetID   string
+	Outcome    string
+	StartDate  *time.Time
+	EndDate    *time.Time
+}
+
+const selectColumns = `
+	id, actor_id, COALESCE(actor_username, ''), action, COALESCE(target_type, ''),
+	COALESCE(target_id, ''), outcome, status_code, COALESCE(details, ''),
+	COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at
+`
+
+// Create inserts an entry and fills in its ID.
+func (r *Repository) Create(ctx context.Context, entry *Entry) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	if entry.Outcome == "" {
+		entry.Outcome = OutcomeForStatus(entry.StatusCode)
+	}
+
+	var actorID any
+	if entry.ActorID != nil {
+		actorID = *entry.ActorID
+	}
+	var details any
+	if len(entry.Details) > 0 {
+		encoded, err := json.Marshal(entry.Details)
+		if err != nil {
+			return fmt.Errorf("encode audit details: %w", err)
+		}
+		details = string(encoded)
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO audit_logs (
+			actor_id, actor_username, action, target_type, target_id, outcome,
+			status_code, details, ip_address, user_agent, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		actorID,
+		nullableString(entry.ActorUsername),
+		entry.Action,
+		nullableString(entry.TargetType),
+		nullableString(entry.TargetID),
+		entry.Outcome,
+		entry.StatusCode,
+		details,
+		nullableString(entry.IPAddress),
+		nullableString(entry.UserAgent),
+		entry.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit entry: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("fetch audit entry id: %w", err)
+	}
+	entry.ID = id
+	return nil
+}
+
+// Get returns an entry by ID.
+func (r *Repository) Get(ctx context.Context, id int64) (*Entry, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+selectColumns+` FROM audit_logs WHERE id = ?`, id)
+	entry, err := scanEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return entry, err
+}
+
+// List returns entries matching the filters, newest first, and the total count.
+func (r *Repository) List(ctx context.Context, params ListParams) ([]Entry, int64, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	page := params.Page
+	if page <= 0 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	whereParts := make([]string, 0, 7)
+	args := make([]any, 0, 9)
+	if params.ActorID != nil {
+		whereParts = append(whereParts, "actor_id = ?")
+		args = append(args, *params.ActorID)
+	}
+	if params.Action != "" {
+		// A trailing ".*" matches every action of a category, e.g. "api_key.*".
+		if prefix, ok := strings.CutSuffix(params.Action, ".*"); ok {
+			whereParts = append(whereParts, "action LIKE ?")
+			args = append(args, prefix+".%")
+		} else {
+			whereParts = append(whereParts, "action = ?")
+			args = append(args, params.Action)
+		}
+	}
+	if params.TargetType != "" {
+		whereParts = append(whereParts, "target_type = ?")
+		args = append(args, params.TargetType)
+	}
+	if params.TargetID != "" {
+		whereParts = append(whereParts, "target_id = ?")
+		args = append(args, params.TargetID)
+	}
+	if params.Outcome != "" {
+		whereParts = append(whereParts, "outcome = ?")
+		args = append(args, params.Outcome)
+	}
+	if params.StartDate != nil {
+		whereParts = append(whereParts, "created_at >= ?")
+		args = append(args, params.StartDate.UTC())
+	}
+	if params.EndDate != nil {
+		whereParts = append(whereParts, "created_at <= ?")
+		args = append(args, params.EndDate.UTC())
+	}
+
+	whereClause := ""
+	if len(whereParts) > 0 {
+		whereClause = "WHERE " + strings.Join(whereParts, " AND ")
+	}
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM audit_logs `+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count audit entries: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM audit_logs
+		`+whereClause+`
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]Entry, 0)
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, *entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("iterate audit entries: %w", err)
+	}
+
+	return entries, total, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEntry(row rowScanner) (*Entry, error) {
+	var (
+		entry   Entry
+		actorID sql.NullInt64
+		details string
+	)
+	err := row.Scan(
+		&entry.ID,
+		&actorID,
+		&entry.ActorUsername,
+		&entry.Action,
+		&entry.TargetType,
+		&entry.TargetID,
+		&entry.Outcome,
+		&entry.StatusCode,
+		&details,
+		&entry.IPAddress,
+		&entry.UserAgent,
+		&entry.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan audit entry: %w", err)
+	}
+
+	if actorID.Valid {
+		entry.ActorID = &actorID.Int64
+	}
+	if details != "" {
+		if err := json.Unmarshal([]byte(details), &entry.Details); err != nil {
+			return nil, fmt.Errorf("decode audit details: %w", err)
+		}
+	}
+	return &entry, nil
+}
+
+func nullableString(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// MaxAllowedCIDRs bounds the size of an API key's IP allowlist.
+const MaxAllowedCIDRs = 32
+
+// ErrInvalidCIDR is returned for allowlist entries that are neither an IP address nor a CIDR.
+var ErrInvalidCIDR = errors.New("invalid IP allowlist")
+
+// NormalizeAllowedCIDRs validates an API key allowlist and returns it in canonical form:
+// bare addresses become single-host prefixes, host bits are cleared and duplicates dropped.
+// An empty list means the key may be used from anywhere.
+func NormalizeAllowedCIDRs(entries []string) ([]string, error) {
+	if len(entries) > MaxAllowedCIDRs {
+		return nil, fmt.Errorf("%w: at most %d entries are allowed", ErrInvalidCIDR, MaxAllowedCIDRs)
+	}
+	normalized := make([]string, 0, len(entries))
+	seen := make(map[netip.Prefix]bool, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		var prefix netip.Prefix
+		if strings.Contains(entry, "/") {
+			parsed, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q is not a CIDR", ErrInvalidCIDR, entry)
+			}
+			prefix = parsed.Masked()
+		} else {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %q is not an IP address", ErrInvalidCIDR, entry)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		if seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+		normalized = append(normalized, prefix.String())
+	}
+	return normalized, nil
+}
+
+// AllowsIP reports whether the key may be used from ip. Keys without an allowlist are
+// usable from anywhere; keys with one reject addresses that cannot be parsed.
+func (k *APIKey) AllowsIP(ip string) bool {
+	if len(k.AllowedCIDRs) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, cidr := range k.AllowedCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeAllowedCIDRs stores an allowlist as a JSON array; an empty list is stored as NULL.
+func encodeAllowedCIDRs(cidrs []string) any {
+	if len(cidrs) == 0 {
+		return nil
+	}
+	raw, _ := json.Marshal(cidrs)
+	return string(raw)
+}
+
+// decodeAllowedCIDRs reads an allowlist column stored by encodeAllowedCIDRs.
+func decodeAllowedCIDRs(raw sql.NullString) ([]string, error) {
+	if !raw.Valid || raw.String == "" {
+		return nil, nil
+	}
+	var cidrs []string
+	if err := json.Unmarshal([]byte(raw.String), &cidrs); err != nil {
+		return nil, fmt.Errorf("decode allowed_cidrs: %w", err)
+	}
+	return cidrs, nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// generatedPasswordBytes is the entropy of passwords generated for new admins.
+const generatedPasswordBytes = 18
+
+// BootstrapConfig names the admin created on a deployment's first start.
+type BootstrapConfig struct {
+	Username string
+	Password string
+}
+
+// BootstrapConfigFromEnv reads ADMIN_USERNAME and ADMIN_PASSWORD. Without both, no admin is
+// bootstrapped.
+func BootstrapConfigFromEnv() BootstrapConfig {
+	return BootstrapConfig{
+		Username: strings.TrimSpace(os.Getenv("ADMIN_USERNAME")),
+		Password: os.Getenv("ADMIN_PASSWORD"),
+	}
+}
+
+// Enabled reports whether an admin should be bootstrapped.
+func (c BootstrapConfig) Enabled() bool {
+	return c.Username != "" && c.Password != ""
+}
+
+// BootstrapAdmin creates the configured admin when no admin exists yet, so a fresh
+// deployment can reach the admin routes. The admin must change the password on first
+// login. It reports whether the admin was created; once any admin exists it does nothing,
+// so the variables can stay set.
+func BootstrapAdmin(ctx context.Context, users *UserRepository, cfg BootstrapConfig) (bool, error) {
+	if !cfg.Enabled() {
+		return false, nil
+	}
+	var exists bool
+	if err := users.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE role = ?)`, RoleAdmin).Scan(&exists); err != nil {
+		return false, fmt.Errorf("check for admins: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	_, err := users.Create(ctx, NewUser{
+		Username:           cfg.Username,
+		Password:           cfg.Password,
+		Role:               RoleAdmin,
+		MustChangePassword: true,
+	})
+	if errors.Is(err, ErrUsernameTaken) {
+		// Promoting an existing account from the environment would be too easy to misuse.
+		log.Printf("auth: not bootstrapping admin %q: the username belongs to an existing user", cfg.Username)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("create admin %q: %w", cfg.Username, err)
+	}
+	return true, nil
+}
+
+// GeneratePassword returns a random password for accounts created without one.
+func GeneratePassword() (string, error) {
+	return randomToken(generatedPasswordBytes)
+}
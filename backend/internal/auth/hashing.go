@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+)
+
+// API key hash versions stored in api_keys.hash_version.
+const (
+	// APIKeyHashSHA256 is the legacy unsalted SHA-256 digest.
+	APIKeyHashSHA256 = 1
+	// APIKeyHashHMAC is HMAC-SHA256 keyed with API_KEY_HASH_SECRET.
+	APIKeyHashHMAC = 2
+)
+
+// ErrAPIKeyNotFound is returned when no stored key matches the supplied secret.
+var ErrAPIKeyNotFound = errors.New("invalid API key")
+
+func apiKeyHashSecret() []byte {
+	return []byte(os.Getenv("API_KEY_HASH_SECRET"))
+}
+
+// CurrentAPIKeyHashVersion returns the hash version used for newly stored keys.
+func CurrentAPIKeyHashVersion() int {
+	if len(apiKeyHashSecret()) > 0 {
+		return APIKeyHashHMAC
+	}
+	return APIKeyHashSHA256
+}
+
+// HashAPIKeyVersion hashes the plain-text API key using the given scheme version.
+func HashAPIKeyVersion(apiKey string, version int) string {
+	if version == APIKeyHashHMAC {
+		mac := hmac.New(sha256.New, apiKeyHashSecret())
+		mac.Write([]byte(apiKey))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	return HashAPIKey(apiKey)
+}
+
+// LookupAPIKey finds the stored key matching apiKey, trying the current hash scheme first
+// and transparently upgrading legacy SHA-256 rows to HMAC on first use.
+func LookupAPIKey(db *sql.DB, apiKey string) (*APIKey, error) {
+	current := CurrentAPIKeyHashVersion()
+
+	versions := []int{current}
+	if current != APIKeyHashSHA256 {
+		versions = append(versions, APIKeyHashSHA256)
+	}
+
+	for _, version := range versions {
+		keyHash := HashAPIKeyVersion(apiKey, version)
+
+		var (
+			key          APIKey
+			allowedCIDRs sql.NullString
+		)
+		err := db.QueryRow(`
+			SELECT id, user_id, api_key_hash, api_key_prefix, COALESCE(name, ''), created_at,
+				last_used_at, expires_at, is_active, hash_version, org_id,
+				COALESCE((SELECT role FROM users WHERE users.id = api_keys.user_id), ''), allowed_cidrs
+			FROM api_keys
+			WHERE api_key_hash = ? AND hash_version = ?
+		`, keyHash, version).Scan(
+			&key.ID,
+			&key.UserID,
+			&key.APIKeyHash,
+			&key.APIKeyPrefix,
+			&key.Name,
+			&key.CreatedAt,
+			&key.LastUsedAt,
+			&key.ExpiresAt,
+			&key.IsActive,
+			&key.HashVersion,
+			&key.OrgID,
+			&key.UserRole,
+			&allowedCIDRs,
+		)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if key.AllowedCIDRs, err = decodeAllowedCIDRs(allowedCIDRs); err != nil {
+			return nil, err
+		}
+
+		if version != current {
+			upgradeAPIKeyHash(db, &key, apiKey, current)
+		}
+		return &key, nil
+	}
+
+	return nil, ErrAPIKeyNotFound
+}
+
+// upgradeAPIKeyHash rewrites a legacy hash with the current scheme. Failures are logged
+// and leave the legacy hash in place so the key keeps working.
+func upgradeAPIKeyHash(db *sql.DB, key *APIKey, apiKey string, version int) {
+	newHash := HashAPIKeyVersion(apiKey, version)
+	_, err := db.Exec(`
+		UPDATE api_keys
+		SET api_key_hash = ?, hash_version = ?
+		WHERE id = ? AND hash_version = ?
+	`, newHash, version, key.ID, key.HashVersion)
+	if err != nil {
+		log.Printf("auth: failed to upgrade hash for API key %d: %v", key.ID, err)
+		return
+	}
+	key.APIKeyHash = newHash
+	key.HashVersion = version
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultLoginMaxAttempts      = 5
+	defaultLoginMaxAttemptsPerIP = 20
+	defaultLoginLockout          = 15 * time.Minute
+	defaultLoginBackoffBase      = time.Second
+	defaultLoginAttemptWindow    = 15 * time.Minute
+
+	attemptScopeUser = "user"
+	attemptScopeIP   = "ip"
+)
+
+// LoginGuardConfig controls how failed password logins are throttled.
+type LoginGuardConfig struct {
+	// MaxAttempts is how many consecutive failures lock a username. Zero disables the guard.
+	MaxAttempts int
+	// MaxAttemptsPerIP is how many failures, across all usernames, lock a client IP. Zero
+	// disables IP lockouts.
+	MaxAttemptsPerIP int
+	// Lockout is how long a locked username or IP is refused.
+	Lockout time.Duration
+	// BackoffBase is the delay after a username's first failure; it doubles with each
+	// further failure until the lockout.
+	BackoffBase time.Duration
+	// Window is how long failures are remembered after the most recent one.
+	Window time.Duration
+}
+
+// LoginGuardConfigFromEnv loads LOGIN_MAX_ATTEMPTS, LOGIN_MAX_ATTEMPTS_PER_IP,
+// LOGIN_LOCKOUT_DURATION, LOGIN_BACKOFF_BASE and LOGIN_ATTEMPT_WINDOW.
+func LoginGuardConfigFromEnv() LoginGuardConfig {
+	cfg := LoginGuardConfig{
+		MaxAttempts:      defaultLoginMaxAttempts,
+		MaxAttemptsPerIP: defaultLoginMaxAttemptsPerIP,
+		Lockout:          defaultLoginLockout,
+		BackoffBase:      defaultLoginBackoffBase,
+		Window:           defaultLoginAttemptWindow,
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("LOGIN_MAX_ATTEMPTS"))); err == nil && n >= 0 {
+		cfg.MaxAttempts = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("LOGIN_MAX_ATTEMPTS_PER_IP"))); err == nil && n >= 0 {
+		cfg.MaxAttemptsPerIP = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_DURATION")); err == nil && d > 0 {
+		cfg.Lockout = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_BACKOFF_BASE")); err == nil && d >= 0 {
+		cfg.BackoffBase = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_ATTEMPT_WINDOW")); err == nil && d > 0 {
+		cfg.Window = d
+	}
+	return cfg
+}
+
+// LoginGuard tracks failed password logins per username and per client IP in the database,
+// so every replica sees the same counts. Each failure delays the username's next attempt
+// exponentially and MaxAttempts failures lock it; MaxAttemptsPerIP failures lock the IP.
+type LoginGuard struct {
+	db  *sql.DB
+	cfg LoginGuardConfig
+	now func() time.Time
+}
+
+// NewLoginGuard returns a guard. With cfg.MaxAttempts zero it allows every attempt.
+func NewLoginGuard(db *sql.DB, cfg LoginGuardConfig) *LoginGuard {
+	return &LoginGuard{db: db, cfg: cfg, now: time.Now}
+}
+
+func (g *LoginGuard) disabled() bool {
+	return g.cfg.MaxAttempts <= 0
+}
+
+// Check returns when username may next attempt to log in from ip, or the zero time when it
+// may do so now.
+func (g *LoginGuard) Check(username, ip string) (time.Time, error) {
+	if g.disabled() {
+		return time.Time{}, nil
+	}
+
+	now := g.now().UTC()
+	rows, err := g.db.Query(`
+		SELECT blocked_until FROM login_attempts
+		WHERE ((scope = ? AND key = ?) OR (scope = ? AND key = ?)) AND blocked_until > ?
+	`, attemptScopeUser, username, attemptScopeIP, ip, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer rows.Close()
+
+	var until time.Time
+	for rows.Next() {
+		var blockedUntil time.Time
+		if err := rows.Scan(&blockedUntil); err != nil {
+			return time.Time{}, err
+		}
+		if blockedUntil.After(until) {
+			until = blockedUntil
+		}
+	}
+	return until, rows.Err()
+}
+
+// RecordFailure counts a failed login for username and ip. Unknown usernames are counted
+// too, so responses do not reveal which accounts exist. It returns when username may next
+// attempt to log in.
+func (g *LoginGuard) RecordFailure(username, ip string) (time.Time, error) {
+	if g.disabled() {
+		return time.Time{}, nil
+	}
+
+	now := g.now().UTC()
+	tx, err := g.db.Begin()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		DELETE FROM login_attempts
+		WHERE last_failed_at < ? AND (blocked_until IS NULL OR blocked_until < ?)
+	`, now.Add(-g.cfg.Window), now); err != nil {
+		return time.Time{}, err
+	}
+
+	until, err := g.recordFailure(tx, attemptScopeUser, username, g.cfg.MaxAttempts, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if g.cfg.MaxAttemptsPerIP > 0 && ip != "" {
+		ipUntil, err := g.recordFailure(tx, attemptScopeIP, ip, g.cfg.MaxAttemptsPerIP, now)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if ipUntil.After(until) {
+			until = ipUntil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, err
+	}
+	return until, nil
+}
+
+// recordFailure increments one counter and sets how long it blocks further attempts. Only
+// usernames back off before they are locked; an IP is blocked only once it reaches its limit.
+func (g *LoginGuard) recordFailure(tx *sql.Tx, scope, key string, maxAttempts int, now time.Time) (time.Time, error) {
+	var (
+		failures     int
+		lastFailedAt time.Time
+	)
+	err := tx.QueryRow(`SELECT failures, last_failed_at FROM login_attempts WHERE scope = ? AND key = ?`, scope, key).
+		Scan(&failures, &lastFailedAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, err
+	}
+	if now.Sub(lastFailedAt) > g.cfg.Window {
+		failures = 0
+	}
+	failures++
+
+	var blockedUntil *time.Time
+	switch {
+	case failures >= maxAttempts:
+		until := now.Add(g.cfg.Lockout)
+		blockedUntil = &until
+	case scope == attemptScopeUser && g.cfg.BackoffBase > 0:
+		until := now.Add(g.backoff(failures))
+		blockedUntil = &until
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO login_attempts (scope, key, failures, last_failed_at, blocked_until)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(scope, key) DO UPDATE SET
+			failures = excluded.failures,
+			last_failed_at = excluded.last_failed_at,
+			blocked_until = excluded.blocked_until
+	`, scope, key, failures, now, blockedUntil)
+	if err != nil || blockedUntil == nil {
+		return time.Time{}, err
+	}
+	return *blockedUntil, nil
+}
+
+// backoff returns BackoffBase doubled for each failure after the first, capped at Lockout.
+func (g *LoginGuard) backoff(failures int) time.Duration {
+	delay := g.cfg.BackoffBase
+	for i := 1; i < failures && delay < g.cfg.Lockout; i++ {
+		delay *= 2
+	}
+	return min(delay, g.cfg.Lockout)
+}
+
+// RecordSuccess clears username's failures. The client IP's failures are kept, so one valid
+// account cannot be used to reset an IP that is guessing others' passwords.
+func (g *LoginGuard) RecordSuccess(username string) error {
+	if g.disabled() {
+		return nil
+	}
+	_, err := g.db.Exec(`DELETE FROM login_attempts WHERE scope = ? AND key = ?`, attemptScopeUser, username)
+	return err
+}
+
+// UnlockUser clears the failures and lockout of the user's username, and of ip when it is
+// set. It returns the username and whether anything was cleared.
+func (g *LoginGuard) UnlockUser(userID int, ip string) (string, bool, error) {
+	var username string
+	err := g.db.QueryRow(`SELECT username FROM users WHERE id = ?`, userID).Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, ErrUserNotFound
+	}
+	if err != nil {
+		return "", false, err
+	}
+	res, err := g.db.Exec(`
+		DELETE FROM login_attempts
+		WHERE (scope = ? AND key = ?) OR (scope = ? AND key = ?)
+	`, attemptScopeUser, username, attemptScopeIP, ip)
+	if err != nil {
+		return username, false, err
+	}
+	n, err := res.RowsAffected()
+	return username, n > 0, err
+}
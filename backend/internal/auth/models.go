@@ -7,6 +7,8 @@ const (
 	RoleAdmin = "admin"
 	// RoleUser identifies standard user accounts.
 	RoleUser = "user"
+	// RoleTrial identifies anonymous trial identities, which hold a single expiring API key.
+	RoleTrial = "trial"
 )
 
 // User represents an application user account.
@@ -18,6 +20,8 @@ type User struct {
 	CreatedAt    time.Time
 	IsActive     bool
 	Role         string
+	// MustChangePassword is set on accounts created with a temporary password.
+	MustChangePassword bool
 }
 
 // APIKey contains metadata about a stored API key.
@@ -31,6 +35,13 @@ type APIKey struct {
 	LastUsedAt   *time.Time
 	ExpiresAt    *time.Time
 	IsActive     bool
+	HashVersion  int
+	// OrgID is set for keys owned by an organization; UserID is then the member who created it.
+	OrgID *int
+	// UserRole is the role of the user the key belongs to.
+	UserRole string
+	// AllowedCIDRs restricts the client addresses the key may be used from; empty allows any.
+	AllowedCIDRs []string
 }
 
 // RegisterRequest encapsulates the payload for user registration.
@@ -38,6 +49,8 @@ type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Password string `json:"password" binding:"required,min=6"`
 	Email    string `json:"email,omitempty" binding:"omitempty,email"`
+	// CreateAPIKey also issues a non-expiring API key, returned once in the response.
+	CreateAPIKey bool `json:"create_api_key,omitempty"`
 }
 
 // LoginRequest encapsulates login credentials.
@@ -46,18 +59,68 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// ChangePasswordRequest replaces the caller's password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// StartTrialRequest identifies the device starting an anonymous trial by a client-generated ID.
+type StartTrialRequest struct {
+	DeviceID string `json:"device_id" binding:"required,min=8,max=128"`
+}
+
+// RefreshTokenRequest carries a refresh token for the refresh and logout endpoints.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 // CreateAPIKeyRequest is the request payload for API key creation.
+// At most one of ExpiresIn (e.g. "30d", "12h") and ExpiresAt may be set; neither means the key never expires.
 type CreateAPIKeyRequest struct {
-	Name string `json:"name,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	ExpiresIn string     `json:"expires_in,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// UpdateUserRoleRequest changes a user's role.
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// UnlockUserRequest optionally names a client IP to unlock along with the user.
+type UnlockUserRequest struct {
+	IP string `json:"ip,omitempty"`
+}
+
+// UpdateAPIKeyRequest is the request payload for changing an API key's name or expiry.
+// Omitted fields are left unchanged; NeverExpires removes the expiry.
+type UpdateAPIKeyRequest struct {
+	Name         *string    `json:"name,omitempty"`
+	ExpiresIn    string     `json:"expires_in,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	NeverExpires bool       `json:"never_expires,omitempty"`
+	// AllowedCIDRs replaces the key's IP allowlist; an empty list removes it.
+	AllowedCIDRs *[]string `json:"allowed_cidrs,omitempty"`
+}
+
+// RotateAPIKeyRequest optionally overrides the expiry of the replacement key.
+// Without it the replacement gets the same lifetime the old key was issued with.
+type RotateAPIKeyRequest struct {
+	ExpiresIn string     `json:"expires_in,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // APIKeyResponse contains API key details returned to the client.
 type APIKeyResponse struct {
-	ID        int       `json:"id"`
-	APIKey    string    `json:"api_key"`
-	Name      string    `json:"name"`
-	Prefix    string    `json:"prefix"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int        `json:"id"`
+	APIKey    string     `json:"api_key"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// AllowedCIDRs is carried over from the key a rotated key replaces.
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"`
 }
 
 // APIKeyListItem is used when returning a list of API keys (without the secret).
@@ -67,5 +130,29 @@ type APIKeyListItem struct {
 	Prefix     string     `json:"prefix"`
 	CreatedAt  time.Time  `json:"created_at"`
 	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	Expired    bool       `json:"expired"`
 	IsActive   bool       `json:"is_active"`
+	// RevokedAt and RevokeReason are set on revoked keys listed with include_revoked.
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	RevokeReason string     `json:"revoke_reason,omitempty"`
+	// CreatedBy is the member who created an organization key.
+	CreatedBy int `json:"created_by,omitempty"`
+	// AllowedCIDRs lists the networks the key may be used from; empty allows any.
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"`
+}
+
+// StaleAPIKey describes an active API key that has not been used within the stale window.
+type StaleAPIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Username   string     `json:"username"`
+	Email      *string    `json:"email,omitempty"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	IdleDays   int        `json:"idle_days"`
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+	FlaggedAt  *time.Time `json:"flagged_at,omitempty"`
 }
@@ -0,0 +1,557 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuthStateCookie binds a login's state to the browser that started it.
+const OAuthStateCookie = "oauth_state"
+
+// OAuth providers users can sign in with.
+const (
+	ProviderGitHub = "github"
+	ProviderGoogle = "google"
+)
+
+const (
+	defaultOAuthStateTTL = 10 * time.Minute
+	oauthRequestTimeout  = 10 * time.Second
+	// oauthPasswordHash is not a bcrypt hash, so accounts created by OAuth cannot log in with a
+	// password.
+	oauthPasswordHash = "!oauth"
+	// maxOAuthResponseBytes bounds token and profile responses from providers.
+	maxOAuthResponseBytes = 1 << 20
+)
+
+var (
+	// ErrOAuthProviderDisabled is returned for providers that are unknown or not configured.
+	ErrOAuthProviderDisabled = errors.New("oauth provider is not enabled")
+	// ErrOAuthInvalidState is returned when the callback state is unknown, expired or was
+	// issued for another provider.
+	ErrOAuthInvalidState = errors.New("invalid or expired oauth state")
+	// ErrOAuthAccountInactive is returned when the linked account has been deactivated.
+	ErrOAuthAccountInactive = errors.New("account is inactive")
+)
+
+// usernameUnsafe matches characters not kept in usernames derived from provider profiles.
+var usernameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// OAuthProviderConfig holds a provider's client credentials and endpoints.
+type OAuthProviderConfig struct {
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	// UserURL returns the signed-in user's profile.
+	UserURL string
+	// EmailsURL lists the user's email addresses when the profile may omit them (GitHub).
+	EmailsURL string
+	Scopes    []string
+}
+
+// OAuthConfig controls social login.
+type OAuthConfig struct {
+	// RedirectBaseURL is the public origin of the API; callbacks are sent to
+	// <RedirectBaseURL>/api/v1/auth/oauth/<provider>/callback.
+	RedirectBaseURL string
+	// SuccessRedirectURL, when set, receives the session tokens in its URL fragment after
+	// login instead of the callback answering with JSON.
+	SuccessRedirectURL string
+	// StateTTL bounds how long a user may take to authorize.
+	StateTTL time.Duration
+	// Providers holds the configured providers by name.
+	Providers map[string]OAuthProviderConfig
+}
+
+// OAuthConfigFromEnv loads GITHUB_CLIENT_ID, GITHUB_CLIENT_SECRET, GOOGLE_CLIENT_ID,
+// GOOGLE_CLIENT_SECRET, OAUTH_REDIRECT_BASE_URL, OAUTH_SUCCESS_REDIRECT_URL and
+// OAUTH_STATE_TTL. A provider is enabled when both of its credentials are set.
+func OAuthConfigFromEnv() OAuthConfig {
+	cfg := OAuthConfig{
+		RedirectBaseURL:    strings.TrimRight(strings.TrimSpace(os.Getenv("OAUTH_REDIRECT_BASE_URL")), "/"),
+		SuccessRedirectURL: strings.TrimSpace(os.Getenv("OAUTH_SUCCESS_REDIRECT_URL")),
+		StateTTL:           defaultOAuthStateTTL,
+		Providers:          make(map[string]OAuthProviderConfig),
+	}
+	if cfg.RedirectBaseURL == "" {
+		cfg.RedirectBaseURL = "http://localhost:8080"
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("OAUTH_STATE_TTL")); err == nil && ttl > 0 {
+		cfg.StateTTL = ttl
+	}
+
+	if id, secret := os.Getenv("GITHUB_CLIENT_ID"), os.Getenv("GITHUB_CLIENT_SECRET"); id != "" && secret != "" {
+		cfg.Providers[ProviderGitHub] = OAuthProviderConfig{
+			ClientID:     id,
+			ClientSecret: secret,
+			AuthURL:      "https://github.com/login/oauth/authorize",
+			TokenURL:     "https://github.com/login/oauth/access_token",
+			UserURL:      "https://api.github.com/user",
+			EmailsURL:    "https://api.github.com/user/emails",
+			Scopes:       []string{"read:user", "user:email"},
+		}
+	}
+	if id, secret := os.Getenv("GOOGLE_CLIENT_ID"), os.Getenv("GOOGLE_CLIENT_SECRET"); id != "" && secret != "" {
+		cfg.Providers[ProviderGoogle] = OAuthProviderConfig{
+			ClientID:     id,
+			ClientSecret: secret,
+			AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+			TokenURL:     "https://oauth2.googleapis.com/token",
+			UserURL:      "https://openidconnect.googleapis.com/v1/userinfo",
+			Scopes:       []string{"openid", "email", "profile"},
+		}
+	}
+	return cfg
+}
+
+// OAuthIdentity is a user's account at an OAuth provider.
+type OAuthIdentity struct {
+	Provider string
+	// Subject is the provider's stable user id.
+	Subject string
+	// Login is the provider username or display name, used to name new accounts.
+	Login string
+	// Email is only set when the provider has verified it.
+	Email string
+}
+
+// OAuthLogin is the outcome of a completed OAuth flow.
+type OAuthLogin struct {
+	User     *User
+	Identity OAuthIdentity
+	// Created is set when a new account was registered for the identity.
+	Created bool
+	// Linked is set when the identity was attached to an existing account by email.
+	Linked bool
+}
+
+// OAuthService runs the authorization code flow (with PKCE) against GitHub and Google and
+// resolves the provider identity to a local user: a previously linked account, an existing
+// account with the same verified email, or a newly registered one.
+type OAuthService struct {
+	db     *sql.DB
+	cfg    OAuthConfig
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewOAuthService constructs an OAuth service.
+func NewOAuthService(db *sql.DB, cfg OAuthConfig) *OAuthService {
+	if cfg.StateTTL <= 0 {
+		cfg.StateTTL = defaultOAuthStateTTL
+	}
+	return &OAuthService{
+		db:     db,
+		cfg:    cfg,
+		client: &http.Client{Timeout: oauthRequestTimeout},
+		now:    time.Now,
+	}
+}
+
+// Providers returns the names of the enabled providers.
+func (s *OAuthService) Providers() []string {
+	names := make([]string, 0, len(s.cfg.Providers))
+	for name := range s.cfg.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SuccessRedirectURL returns the client URL that receives session tokens, if configured.
+func (s *OAuthService) SuccessRedirectURL() string {
+	return s.cfg.SuccessRedirectURL
+}
+
+// AuthorizeURL starts a login with provider and returns the URL to send the user to, with
+// the state the browser must present on the callback.
+func (s *OAuthService) AuthorizeURL(ctx context.Context, provider string) (authorizeURL, state string, err error) {
+	cfg, ok := s.cfg.Providers[provider]
+	if !ok {
+		return "", "", ErrOAuthProviderDisabled
+	}
+
+	state, err = randomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := s.now().UTC()
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM oauth_states WHERE expires_at <= ?`, now); err != nil {
+		return "", "", fmt.Errorf("purge oauth states: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO oauth_states (state_hash, provider, code_verifier, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, hashToken(state), provider, verifier, now.Add(s.cfg.StateTTL), now); err != nil {
+		return "", "", fmt.Errorf("store oauth state: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"client_id":             {cfg.ClientID},
+		"redirect_uri":          {s.redirectURI(provider)},
+		"response_type":         {"code"},
+		"scope":                 {strings.Join(cfg.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	return cfg.AuthURL + "?" + query.Encode(), state, nil
+}
+
+// StateCookie returns the cookie that carries state through the provider's consent page. It
+// is sent on the provider's top-level redirect back to the callback, but not to scripts or
+// to other sites.
+func (s *OAuthService) StateCookie(state string) *http.Cookie {
+	return &http.Cookie{
+		Name:     OAuthStateCookie,
+		Value:    state,
+		Path:     "/api/v1/auth/oauth",
+		MaxAge:   int(s.cfg.StateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.cfg.RedirectBaseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// Complete finishes a login from the provider's callback: it checks the state against the
+// one in the browser's state cookie, exchanges the code for an access token, fetches the
+// user's identity and resolves it to a local user. Requiring the cookie stops an attacker
+// from logging a victim into the attacker's account with a callback URL of their own.
+func (s *OAuthService) Complete(ctx context.Context, provider, code, state, cookieState string) (*OAuthLogin, error) {
+	cfg, ok := s.cfg.Providers[provider]
+	if !ok {
+		return nil, ErrOAuthProviderDisabled
+	}
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		return nil, ErrOAuthInvalidState
+	}
+	verifier, err := s.consumeState(ctx, provider, state)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.exchange(ctx, provider, cfg, code, verifier)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := s.fetchIdentity(ctx, provider, cfg, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.resolveUser(ctx, identity)
+}
+
+func (s *OAuthService) redirectURI(provider string) string {
+	return s.cfg.RedirectBaseURL + "/api/v1/auth/oauth/" + provider + "/callback"
+}
+
+// consumeState deletes the state so it can only be used once, and returns its PKCE verifier.
+func (s *OAuthService) consumeState(ctx context.Context, provider, state string) (string, error) {
+	if state == "" {
+		return "", ErrOAuthInvalidState
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var (
+		stateProvider, verifier string
+		expiresAt               time.Time
+	)
+	err = tx.QueryRowContext(ctx, `SELECT provider, code_verifier, expires_at FROM oauth_states WHERE state_hash = ?`,
+		hashToken(state)).Scan(&stateProvider, &verifier, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrOAuthInvalidState
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oauth_states WHERE state_hash = ?`, hashToken(state)); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	if stateProvider != provider || !s.now().Before(expiresAt) {
+		return "", ErrOAuthInvalidState
+	}
+	return verifier, nil
+}
+
+func (s *OAuthService) exchange(ctx context.Context, provider string, cfg OAuthProviderConfig, code, verifier string) (string, error) {
+	if code == "" {
+		return "", errors.New("missing authorization code")
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.redirectURI(provider)},
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := s.doJSON(req, &body); err != nil {
+		return "", fmt.Errorf("%s token exchange: %w", provider, err)
+	}
+	// GitHub reports failed exchanges with a 200 and an error field.
+	if body.Error != "" {
+		return "", fmt.Errorf("%s token exchange: %s", provider, strings.TrimSpace(body.Error+" "+body.ErrorDescription))
+	}
+	if body.AccessToken == "" {
+		return "", fmt.Errorf("%s token exchange: no access token returned", provider)
+	}
+	return body.AccessToken, nil
+}
+
+func (s *OAuthService) fetchIdentity(ctx context.Context, provider string, cfg OAuthProviderConfig, token string) (OAuthIdentity, error) {
+	identity := OAuthIdentity{Provider: provider}
+
+	switch provider {
+	case ProviderGitHub:
+		var user struct {
+			ID    int64  `json:"id"`
+			Login string `json:"login"`
+		}
+		if err := s.getJSON(ctx, cfg.UserURL, token, &user); err != nil {
+			return identity, fmt.Errorf("github profile: %w", err)
+		}
+		identity.Subject, identity.Login = strconv.FormatInt(user.ID, 10), user.Login
+
+		// The profile's public email is not necessarily verified, so use the primary
+		// verified address instead.
+		var emails []struct {
+			Email    string `json:"email"`
+			Primary  bool   `json:"primary"`
+			Verified bool   `json:"verified"`
+		}
+		if err := s.getJSON(ctx, cfg.EmailsURL, token, &emails); err != nil {
+			return identity, fmt.Errorf("github emails: %w", err)
+		}
+		for _, email := range emails {
+			if email.Primary && email.Verified {
+				identity.Email = email.Email
+			}
+		}
+	case ProviderGoogle:
+		var user struct {
+			Subject       string `json:"sub"`
+			Email         string `json:"email"`
+			EmailVerified bool   `json:"email_verified"`
+			Name          string `json:"name"`
+		}
+		if err := s.getJSON(ctx, cfg.UserURL, token, &user); err != nil {
+			return identity, fmt.Errorf("google profile: %w", err)
+		}
+		identity.Subject, identity.Login = user.Subject, user.Name
+		if user.EmailVerified {
+			identity.Email = user.Email
+		}
+	default:
+		return identity, ErrOAuthProviderDisabled
+	}
+
+	if identity.Subject == "" || identity.Subject == "0" {
+		return identity, fmt.Errorf("%s profile: missing user id", provider)
+	}
+	return identity, nil
+}
+
+func (s *OAuthService) getJSON(ctx context.Context, endpoint, token string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	return s.doJSON(req, out)
+}
+
+func (s *OAuthService) doJSON(req *http.Request, out any) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxOAuthResponseBytes))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// resolveUser finds or creates the local user for identity and records the link.
+func (s *OAuthService) resolveUser(ctx context.Context, identity OAuthIdentity) (*OAuthLogin, error) {
+	now := s.now().UTC()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	login := &OAuthLogin{Identity: identity}
+
+	var userID int
+	err = tx.QueryRowContext(ctx, `SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?`,
+		identity.Provider, identity.Subject).Scan(&userID)
+	switch {
+	case err == nil:
+		_, err = tx.ExecContext(ctx, `UPDATE user_identities SET email = ?, last_login_at = ? WHERE provider = ? AND subject = ?`,
+			nullableString(identity.Email), now, identity.Provider, identity.Subject)
+		if err != nil {
+			return nil, fmt.Errorf("update identity: %w", err)
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		userID, login.Linked, err = s.userForEmail(ctx, tx, identity.Email)
+		if err != nil {
+			return nil, err
+		}
+		if userID == 0 {
+			userID, err = s.createOAuthUser(ctx, tx, identity)
+			if err != nil {
+				return nil, err
+			}
+			login.Created = true
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, userID, identity.Provider, identity.Subject, nullableString(identity.Email), now, now)
+		if err != nil {
+			return nil, fmt.Errorf("link identity: %w", err)
+		}
+	default:
+		return nil, err
+	}
+
+	var user User
+	err = tx.QueryRowContext(ctx, `SELECT id, username, email, created_at, is_active, role FROM users WHERE id = ?`, userID).
+		Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive, &user.Role)
+	if err != nil {
+		return nil, fmt.Errorf("load user %d: %w", userID, err)
+	}
+	if !user.IsActive {
+		return nil, ErrOAuthAccountInactive
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	login.User = &user
+	return login, nil
+}
+
+// userForEmail returns the existing registered account with a verified email, if any. Trial
+// identities never match as they have no email.
+func (s *OAuthService) userForEmail(ctx context.Context, tx *sql.Tx, email string) (int, bool, error) {
+	if email == "" {
+		return 0, false, nil
+	}
+	var userID int
+	err := tx.QueryRowContext(ctx, `
+		SELECT id FROM users WHERE email = ? COLLATE NOCASE AND role != ?
+		ORDER BY id LIMIT 1
+	`, email, RoleTrial).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("find user by email: %w", err)
+	}
+	return userID, true, nil
+}
+
+// createOAuthUser registers a user named after the identity's login or email, adding a
+// random suffix when the name is taken.
+func (s *OAuthService) createOAuthUser(ctx context.Context, tx *sql.Tx, identity OAuthIdentity) (int, error) {
+	base := identity.Login
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = strings.Trim(usernameUnsafe.ReplaceAllString(base, "-"), "-.")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if len(base) < 3 {
+		base = identity.Provider + "-user"
+	}
+
+	username := base
+	for attempt := 0; ; attempt++ {
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)`, username).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if !exists {
+			break
+		}
+		if attempt == 5 {
+			return 0, errors.New("could not choose a free username")
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return 0, err
+		}
+		username = base + "-" + hex.EncodeToString(suffix)
+	}
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO users (username, password_hash, email, role) VALUES (?, ?, ?, ?)`,
+		username, oauthPasswordHash, nullableString(identity.Email), RoleUser)
+	if err != nil {
+		return 0, fmt.Errorf("create user: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func nullableString(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CreateOrgAPIKey creates an API key owned by the organization. Requests made with it are
+// metered against the organization's pooled quota. userID records the member who created it.
+func CreateOrgAPIKey(db *sql.DB, orgID, userID int, name string, expiresAt *time.Time) (*APIKeyResponse, error) {
+	return createAPIKey(db, userID, &orgID, name, expiresAt)
+}
+
+// GetOrgAPIKeys returns the organization's active API keys.
+func GetOrgAPIKeys(db *sql.DB, orgID int) ([]APIKeyListItem, error) {
+	rows, err := db.Query(`
+		SELECT id, COALESCE(name, ''), api_key_prefix, created_at, last_used_at, expires_at, is_active, user_id
+		FROM api_keys
+		WHERE org_id = ? AND is_active = 1
+		ORDER BY created_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]APIKeyListItem, 0)
+	now := time.Now()
+	for rows.Next() {
+		var key APIKeyListItem
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt, &key.IsActive, &key.CreatedBy); err != nil {
+			return nil, err
+		}
+		key.Expired = key.ExpiresAt != nil && key.ExpiresAt.Before(now)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeOrgAPIKey marks one of the organization's API keys as inactive, recording actorID as
+// the member who revoked it. Revoking an already revoked key succeeds without changing it.
+func RevokeOrgAPIKey(db *sql.DB, orgID, keyID, actorID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM api_keys WHERE id = ? AND org_id = ?)`, keyID, orgID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrAPIKeyNotOwned
+	}
+
+	if _, err := revokeKey(tx, keyID, RevokeReasonOrg, &actorID, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeMemberOrgAPIKeys revokes the organization's active keys created by memberID, who saw
+// their plaintext, when the member leaves. actorID is recorded as the member who removed
+// them. It returns how many keys were revoked.
+func RevokeMemberOrgAPIKeys(db *sql.DB, orgID, memberID, actorID int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id FROM api_keys WHERE org_id = ? AND user_id = ? AND is_active = 1`, orgID, memberID)
+	if err != nil {
+		return 0, err
+	}
+	var keyIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keyIDs = append(keyIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	for _, id := range keyIDs {
+		if _, err := revokeKey(tx, id, RevokeReasonOrg, &actorID, now); err != nil {
+			return 0, fmt.Errorf("revoke api key %d: %w", id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(keyIDs), nil
+}
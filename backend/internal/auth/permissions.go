@@ -0,0 +1,86 @@
+package auth
+
+import "slices"
+
+// Permissions granted to roles. Admin routes each require one of them.
+const (
+	// PermUsersManage covers user roles, quotas and lockouts, usage reports and role definitions.
+	PermUsersManage = "users:manage"
+	// PermAPIKeysManage covers stale key sweeps and restoring any user's keys.
+	PermAPIKeysManage = "api_keys:manage"
+	// PermIngestionRun covers ingestion jobs, indexed sources and the vector store.
+	PermIngestionRun = "ingestion:run"
+	// PermQueryLogsRead covers query logs, their statistics and pipeline metrics, and feedback.
+	PermQueryLogsRead = "query_logs:read"
+	// PermQueryLogsManage covers purging and replaying query logs.
+	PermQueryLogsManage = "query_logs:manage"
+	// PermAuditLogsRead covers the audit log.
+	PermAuditLogsRead = "audit_logs:read"
+	// PermSystemManage covers maintenance, prompts, models, caches, storage, backups, webhooks,
+	// spend and showcase moderation.
+	PermSystemManage = "system:manage"
+)
+
+// Built-in roles beyond admin, user and trial.
+const (
+	// RoleIngester runs ingestion but cannot manage users or read query logs.
+	RoleIngester = "ingester"
+	// RoleAnalyst reads query logs and feedback.
+	RoleAnalyst = "analyst"
+)
+
+// Permission describes a permission for the role management endpoints.
+type Permission struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// AllPermissions lists every permission in a stable order.
+var AllPermissions = []Permission{
+	{PermUsersManage, "Change user roles, quotas and lockouts, read usage, and define roles"},
+	{PermAPIKeysManage, "Sweep stale API keys and restore any user's keys"},
+	{PermIngestionRun, "Run ingestion jobs and manage indexed sources and the vector store"},
+	{PermQueryLogsRead, "Read query logs, their statistics and pipeline metrics, and feedback"},
+	{PermQueryLogsManage, "Purge and replay query logs"},
+	{PermAuditLogsRead, "Read the audit log"},
+	{PermSystemManage, "Manage maintenance, prompts, models, caches, storage, backups, webhooks, spend and the showcase"},
+}
+
+// builtinRole is a role that exists without a row in the roles table. Its permissions can be
+// overridden by one unless it is fixed.
+type builtinRole struct {
+	name        string
+	description string
+	permissions []string
+	// fixed roles cannot be redefined: admin always holds every permission and trial none.
+	fixed bool
+}
+
+var builtinRoles = []builtinRole{
+	{name: RoleAdmin, description: "Every permission", permissions: permissionNames(), fixed: true},
+	{name: RoleUser, description: "API access without admin permissions"},
+	{name: RoleTrial, description: "Anonymous trial access", fixed: true},
+	{name: RoleIngester, description: "Runs ingestion", permissions: []string{PermIngestionRun}},
+	{name: RoleAnalyst, description: "Reads query logs", permissions: []string{PermQueryLogsRead}},
+}
+
+func permissionNames() []string {
+	names := make([]string, len(AllPermissions))
+	for i, permission := range AllPermissions {
+		names[i] = permission.Name
+	}
+	return names
+}
+
+func findBuiltinRole(name string) (builtinRole, bool) {
+	i := slices.IndexFunc(builtinRoles, func(role builtinRole) bool { return role.name == name })
+	if i < 0 {
+		return builtinRole{}, false
+	}
+	return builtinRoles[i], true
+}
+
+// IsPermission reports whether name is a known permission.
+func IsPermission(name string) bool {
+	return slices.ContainsFunc(AllPermissions, func(permission Permission) bool { return permission.Name == name })
+}
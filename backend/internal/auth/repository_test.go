@@ -0,0 +1,154 @@
+package auth_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testutil"
+)
+
+func TestUserRepositoryCreateAndAuthenticate(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	ctx := context.Background()
+	users := auth.NewUserRepository(db)
+
+	userID, err := users.Create(ctx, auth.NewUser{Username: "alice", Password: "password123"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := users.Create(ctx, auth.NewUser{Username: "alice", Password: "password456"}); !errors.Is(err, auth.ErrUsernameTaken) {
+		t.Fatalf("Create with a taken username: got %v, want ErrUsernameTaken", err)
+	}
+	if _, err := users.Create(ctx, auth.NewUser{Username: "al", Password: "password123"}); !errors.Is(err, auth.ErrUsernameTooShort) {
+		t.Fatalf("Create with a short username: got %v, want ErrUsernameTooShort", err)
+	}
+
+	user, err := users.Authenticate(ctx, "alice", "password123")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if user.ID != userID || user.PasswordHash != "" {
+		t.Fatalf("Authenticate = %+v, want user %d without its password hash", user, userID)
+	}
+	if _, err := users.Authenticate(ctx, "alice", "wrong-password"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("Authenticate with a wrong password: got %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestUserRepositorySetRoleAndDeactivate(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	ctx := context.Background()
+	users := auth.NewUserRepository(db)
+	userID := testutil.CreateUser(t, db, "")
+	testutil.CreateAPIKey(t, db, userID)
+
+	previous, err := users.SetRole(ctx, userID, "admin")
+	if err != nil {
+		t.Fatalf("SetRole: %v", err)
+	}
+	if previous != "user" {
+		t.Fatalf("SetRole returned previous role %q, want user", previous)
+	}
+	if _, err := users.SetRole(ctx, userID, "superuser"); !errors.Is(err, auth.ErrInvalidRole) {
+		t.Fatalf("SetRole to an unknown role: got %v, want ErrInvalidRole", err)
+	}
+
+	revoked, err := users.Deactivate(ctx, userID)
+	if err != nil {
+		t.Fatalf("Deactivate: %v", err)
+	}
+	if revoked != 1 {
+		t.Fatalf("Deactivate revoked %d keys, want 1", revoked)
+	}
+	user, err := users.Lookup(ctx, mustUsername(t, db, userID))
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if user.IsActive || user.Role != "admin" {
+		t.Fatalf("Lookup = %+v, want an inactive admin", user)
+	}
+	if _, err := users.Authenticate(ctx, user.Username, testutil.FixturePassword); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("Authenticate a deactivated user: got %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := users.Deactivate(ctx, userID+100); !errors.Is(err, auth.ErrUserNotFound) {
+		t.Fatalf("Deactivate a missing user: got %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestAPIKeyCreateLookupAndList(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	userID := testutil.CreateUser(t, db, "")
+	created := testutil.CreateAPIKey(t, db, userID)
+
+	key, err := auth.LookupAPIKey(db, created.APIKey)
+	if err != nil {
+		t.Fatalf("LookupAPIKey: %v", err)
+	}
+	if key.ID != created.ID || key.UserID != userID || !key.IsActive {
+		t.Fatalf("LookupAPIKey = %+v, want active key %d of user %d", key, created.ID, userID)
+	}
+	if _, err := auth.LookupAPIKey(db, "sk-unknown"); !errors.Is(err, auth.ErrAPIKeyNotFound) {
+		t.Fatalf("LookupAPIKey of an unknown key: got %v, want ErrAPIKeyNotFound", err)
+	}
+
+	name := "renamed"
+	updated, err := auth.UpdateAPIKey(db, userID, created.ID, &name, false, nil, nil)
+	if err != nil {
+		t.Fatalf("UpdateAPIKey: %v", err)
+	}
+	if updated.Name != name {
+		t.Fatalf("UpdateAPIKey name = %q, want %q", updated.Name, name)
+	}
+
+	keys, total, err := auth.GetUserAPIKeys(db, userID, auth.APIKeyListParams{})
+	if err != nil {
+		t.Fatalf("GetUserAPIKeys: %v", err)
+	}
+	if total != 1 || len(keys) != 1 || keys[0].Name != name {
+		t.Fatalf("GetUserAPIKeys = %+v (total %d), want the renamed key", keys, total)
+	}
+}
+
+func TestAPIKeyRevoke(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	owner := testutil.CreateUser(t, db, "")
+	other := testutil.CreateUser(t, db, "")
+	created := testutil.CreateAPIKey(t, db, owner)
+
+	if err := auth.RevokeAPIKey(db, other, created.ID); !errors.Is(err, auth.ErrAPIKeyNotOwned) {
+		t.Fatalf("RevokeAPIKey by another user: got %v, want ErrAPIKeyNotOwned", err)
+	}
+	if err := auth.RevokeAPIKey(db, owner, created.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if _, err := auth.ValidateAPIKey(db, created.APIKey); err == nil {
+		t.Fatal("ValidateAPIKey accepted a revoked key")
+	}
+
+	keys, total, err := auth.GetUserAPIKeys(db, owner, auth.APIKeyListParams{})
+	if err != nil {
+		t.Fatalf("GetUserAPIKeys: %v", err)
+	}
+	if total != 0 || len(keys) != 0 {
+		t.Fatalf("GetUserAPIKeys listed %d revoked keys", len(keys))
+	}
+	keys, _, err = auth.GetUserAPIKeys(db, owner, auth.APIKeyListParams{IncludeRevoked: true})
+	if err != nil {
+		t.Fatalf("GetUserAPIKeys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].IsActive {
+		t.Fatalf("GetUserAPIKeys with revoked keys = %+v, want the inactive key", keys)
+	}
+}
+
+func mustUsername(t *testing.T, db *sql.DB, userID int) string {
+	t.Helper()
+	var username string
+	if err := db.QueryRow(`SELECT username FROM users WHERE id = ?`, userID).Scan(&username); err != nil {
+		t.Fatalf("load username: %v", err)
+	}
+	return username
+}
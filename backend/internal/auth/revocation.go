@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Reasons stored in api_keys.revoke_reason.
+const (
+	// RevokeReasonUser marks keys revoked by their owner.
+	RevokeReasonUser = "user"
+	// RevokeReasonRotated marks keys replaced by rotation; they cannot be restored.
+	RevokeReasonRotated = "rotated"
+	// RevokeReasonStale marks keys revoked by the stale key sweeper.
+	RevokeReasonStale = "stale"
+	// RevokeReasonOrg marks organization keys revoked by an organization owner.
+	RevokeReasonOrg = "organization"
+	// RevokeReasonAdmin marks keys revoked by an operator; only admins may restore them.
+	RevokeReasonAdmin = "admin"
+	// RevokeReasonDeactivated marks keys revoked because their user was deactivated; only
+	// admins may restore them.
+	RevokeReasonDeactivated = "user_deactivated"
+)
+
+// Transitions stored in api_key_events.event.
+const (
+	APIKeyEventRevoked  = "revoked"
+	APIKeyEventRestored = "restored"
+)
+
+const defaultAPIKeyRestoreWindow = 7 * 24 * time.Hour
+
+var (
+	// ErrAPIKeyNotRevoked is returned when restoring a key that is still active.
+	ErrAPIKeyNotRevoked = errors.New("API key is not revoked")
+	// ErrAPIKeyNotRestorable wraps the reason a revoked key cannot be restored.
+	ErrAPIKeyNotRestorable = errors.New("API key cannot be restored")
+)
+
+// APIKeyRestoreWindowFromEnv loads API_KEY_RESTORE_WINDOW, how long after revocation owners
+// may restore a key: whole days ("7d") or a duration ("72h"). "0" stops owners restoring
+// keys; admins can restore them at any time.
+func APIKeyRestoreWindowFromEnv() time.Duration {
+	value := strings.TrimSpace(os.Getenv("API_KEY_RESTORE_WINDOW"))
+	if value == "0" {
+		return 0
+	}
+	if window, err := parseExpiresIn(value); err == nil {
+		return window
+	}
+	return defaultAPIKeyRestoreWindow
+}
+
+// APIKeyEvent is one revocation or restore of an API key.
+type APIKeyEvent struct {
+	ID       int    `json:"id"`
+	APIKeyID int    `json:"api_key_id"`
+	Event    string `json:"event"`
+	Reason   string `json:"reason,omitempty"`
+	// ActorID is the user who made the change; nil for the stale key sweeper.
+	ActorID   *int      `json:"actor_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// revokeKey deactivates an active key and records the revocation. It reports false when the
+// key was already inactive.
+func revokeKey(db dbExecutor, keyID int, reason string, actorID *int, now time.Time) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE api_keys
+		SET is_active = 0, revoked_at = ?, revoked_by = ?, revoke_reason = ?
+		WHERE id = ? AND is_active = 1
+	`, now, actorID, reason, keyID)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := recordAPIKeyEvent(db, keyID, APIKeyEventRevoked, reason, actorID, now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func recordAPIKeyEvent(db dbExecutor, keyID int, event, reason string, actorID *int, now time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO api_key_events (api_key_id, event, reason, actor_id, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, keyID, event, reason, actorID, now)
+	if err != nil {
+		return fmt.Errorf("record API key %s: %w", event, err)
+	}
+	return nil
+}
+
+// RestoreAPIKey reactivates a revoked key. With a non-nil ownerID the key must be one of the
+// owner's personal keys revoked within window; admins pass nil and may restore any key.
+// Rotated keys are never restored because their replacement is already in use. The key
+// keeps its original expiry.
+func RestoreAPIKey(db *sql.DB, keyID, actorID int, ownerID *int, window time.Duration) (*APIKeyListItem, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT user_id, org_id IS NULL, is_active, revoked_at, COALESCE(revoke_reason, '') FROM api_keys WHERE id = ?`
+	args := []any{keyID}
+	if ownerID != nil {
+		query += ` AND user_id = ? AND org_id IS NULL`
+		args = append(args, *ownerID)
+	}
+	var (
+		userID    int
+		personal  bool
+		active    bool
+		revokedAt *time.Time
+		reason    string
+	)
+	err = tx.QueryRow(query, args...).Scan(&userID, &personal, &active, &revokedAt, &reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotOwned
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case active:
+		return nil, ErrAPIKeyNotRevoked
+	case reason == RevokeReasonRotated:
+		return nil, fmt.Errorf("%w: it was replaced by rotation", ErrAPIKeyNotRestorable)
+	case ownerID != nil && (reason == RevokeReasonAdmin || reason == RevokeReasonDeactivated):
+		return nil, fmt.Errorf("%w: it was revoked by an admin", ErrAPIKeyNotRestorable)
+	case ownerID != nil && (revokedAt == nil || now.Sub(*revokedAt) > window):
+		return nil, fmt.Errorf("%w: the restore window has passed; ask an admin", ErrAPIKeyNotRestorable)
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE api_keys
+		SET is_active = 1, revoked_at = NULL, revoked_by = NULL, revoke_reason = NULL,
+			stale_notified_at = NULL, stale_flagged_at = NULL
+		WHERE id = ?
+	`, keyID); err != nil {
+		return nil, err
+	}
+	if err := recordAPIKeyEvent(tx, keyID, APIKeyEventRestored, "", &actorID, now); err != nil {
+		return nil, err
+	}
+
+	var (
+		key     APIKeyListItem
+		allowed sql.NullString
+	)
+	err = tx.QueryRow(`
+		SELECT id, COALESCE(name, ''), api_key_prefix, created_at, last_used_at, expires_at, is_active, allowed_cidrs
+		FROM api_keys WHERE id = ?
+	`, keyID).Scan(&key.ID, &key.Name, &key.Prefix, &key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt, &key.IsActive, &allowed)
+	if err != nil {
+		return nil, err
+	}
+	if key.AllowedCIDRs, err = decodeAllowedCIDRs(allowed); err != nil {
+		return nil, err
+	}
+	if !personal {
+		key.CreatedBy = userID
+	}
+	key.Expired = key.ExpiresAt != nil && key.ExpiresAt.Before(now)
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// AdminRevokeAPIKey revokes any personal or organization key. actorID is nil when the key
+// is revoked from the command line. Revoking an already revoked key succeeds without
+// changing it.
+func AdminRevokeAPIKey(db *sql.DB, keyID int, actorID *int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM api_keys WHERE id = ?)`, keyID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrAPIKeyNotOwned
+	}
+
+	if _, err := revokeKey(tx, keyID, RevokeReasonAdmin, actorID, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAPIKeyHistory returns the revocations and restores of a key, oldest first. With a
+// non-nil ownerID the key must be one of the owner's personal keys.
+func GetAPIKeyHistory(db *sql.DB, keyID int, ownerID *int) ([]APIKeyEvent, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM api_keys WHERE id = ?`
+	args := []any{keyID}
+	if ownerID != nil {
+		query += ` AND user_id = ? AND org_id IS NULL`
+		args = append(args, *ownerID)
+	}
+	var exists bool
+	if err := db.QueryRow(query+`)`, args...).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrAPIKeyNotOwned
+	}
+
+	rows, err := db.Query(`
+		SELECT id, api_key_id, event, COALESCE(reason, ''), actor_id, created_at
+		FROM api_key_events
+		WHERE api_key_id = ?
+		ORDER BY id
+	`, keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]APIKeyEvent, 0)
+	for rows.Next() {
+		var event APIKeyEvent
+		if err := rows.Scan(&event.ID, &event.APIKeyID, &event.Event, &event.Reason, &event.ActorID, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+)
+
+var (
+	// ErrRoleNotFound is returned for a role that is neither built in nor defined.
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleFixed is returned when redefining or deleting the admin or trial role.
+	ErrRoleFixed = errors.New("role cannot be changed")
+	// ErrRoleInUse is returned when deleting a defined role that users still hold.
+	ErrRoleInUse = errors.New("role is assigned to users")
+	// ErrInvalidRoleName rejects role names outside roleNamePattern.
+	ErrInvalidRoleName = errors.New("role name must be 2-32 lowercase letters, digits, '_' or '-', starting with a letter")
+	// ErrUnknownPermission is returned for a permission not in AllPermissions.
+	ErrUnknownPermission = errors.New("unknown permission")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// Role is a named set of permissions.
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	// Builtin roles exist without being defined; deleting one restores its default permissions.
+	Builtin bool `json:"builtin"`
+	// Customized reports a built-in role whose permissions were redefined.
+	Customized bool `json:"customized"`
+	// Editable is false for admin and trial.
+	Editable bool `json:"editable"`
+}
+
+// RoleRepository resolves role permissions. Built-in roles need no rows; a row in the roles
+// table defines a custom role or redefines a built-in one, with its permissions in
+// role_permissions.
+type RoleRepository struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+// NewRoleRepository returns a repository backed by the supplied sql.DB handle.
+func NewRoleRepository(db *sql.DB) *RoleRepository {
+	return &RoleRepository{db: db, writer: database.WriterFor(db)}
+}
+
+// HasPermission reports whether role grants permission. Admin always does.
+func (r *RoleRepository) HasPermission(ctx context.Context, role, permission string) (bool, error) {
+	if role == RoleAdmin {
+		return true, nil
+	}
+	found, err := r.Get(ctx, role)
+	if errors.Is(err, ErrRoleNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(found.Permissions, permission), nil
+}
+
+// Get returns a role with its permissions.
+func (r *RoleRepository) Get(ctx context.Context, name string) (*Role, error) {
+	builtin, isBuiltin := findBuiltinRole(name)
+	if isBuiltin && builtin.fixed {
+		return builtinRoleView(builtin), nil
+	}
+
+	var description sql.NullString
+	err := r.db.QueryRowContext(ctx, `SELECT description FROM roles WHERE name = ?`, name).Scan(&description)
+	if errors.Is(err, sql.ErrNoRows) {
+		if isBuiltin {
+			return builtinRoleView(builtin), nil
+		}
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load role: %w", err)
+	}
+
+	permissions, err := r.permissions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	role := &Role{Name: name, Description: description.String, Permissions: permissions, Editable: true}
+	if isBuiltin {
+		role.Builtin = true
+		role.Customized = true
+		if role.Description == "" {
+			role.Description = builtin.description
+		}
+	}
+	return role, nil
+}
+
+// List returns the built-in roles followed by the defined ones, sorted by name.
+func (r *RoleRepository) List(ctx context.Context) ([]Role, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT name FROM roles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list roles: %w", err)
+	}
+	var defined []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		defined = append(defined, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(builtinRoles)+len(defined))
+	for _, builtin := range builtinRoles {
+		names = append(names, builtin.name)
+	}
+	for _, name := range defined {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	roles := make([]Role, 0, len(names))
+	for _, name := range names {
+		role, err := r.Get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, *role)
+	}
+	return roles, nil
+}
+
+// Put defines a role, or redefines a built-in one, replacing its permissions.
+func (r *RoleRepository) Put(ctx context.Context, name, description string, permissions []string) (*Role, error) {
+	if builtin, ok := findBuiltinRole(name); ok && builtin.fixed {
+		return nil, ErrRoleFixed
+	}
+	if !roleNamePattern.MatchString(name) {
+		return nil, ErrInvalidRoleName
+	}
+	unique := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		if !IsPermission(permission) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, permission)
+		}
+		if !slices.Contains(unique, permission) {
+			unique = append(unique, permission)
+		}
+	}
+
+	err := r.writer.Do(ctx, func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO roles (name, description) VALUES (?, ?)
+			ON CONFLICT(name) DO UPDATE SET description = excluded.description, updated_at = CURRENT_TIMESTAMP
+		`, name, strings.TrimSpace(description)); err != nil {
+			return fmt.Errorf("save role: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role = ?`, name); err != nil {
+			return fmt.Errorf("clear permissions: %w", err)
+		}
+		for _, permission := range unique {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO role_permissions (role, permission) VALUES (?, ?)`, name, permission); err != nil {
+				return fmt.Errorf("save permission: %w", err)
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, name)
+}
+
+// Delete removes a defined role, or restores a built-in one's default permissions. Defined
+// roles that users still hold cannot be deleted.
+func (r *RoleRepository) Delete(ctx context.Context, name string) error {
+	builtin, isBuiltin := findBuiltinRole(name)
+	if isBuiltin && builtin.fixed {
+		return ErrRoleFixed
+	}
+
+	return r.writer.Do(ctx, func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if !isBuiltin {
+			var inUse bool
+			err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE role = ?)`, name).Scan(&inUse)
+			if err != nil {
+				return fmt.Errorf("check role users: %w", err)
+			}
+			if inUse {
+				return ErrRoleInUse
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role = ?`, name); err != nil {
+			return fmt.Errorf("delete permissions: %w", err)
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM roles WHERE name = ?`, name)
+		if err != nil {
+			return fmt.Errorf("delete role: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 && !isBuiltin {
+			return ErrRoleNotFound
+		}
+		return tx.Commit()
+	})
+}
+
+func (r *RoleRepository) permissions(ctx context.Context, role string) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT permission FROM role_permissions WHERE role = ?`, role)
+	if err != nil {
+		return nil, fmt.Errorf("load permissions: %w", err)
+	}
+	defer rows.Close()
+
+	granted := []string{}
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		granted = append(granted, permission)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Report them in catalog order; permissions no longer in the catalog are dropped.
+	ordered := []string{}
+	for _, permission := range permissionNames() {
+		if slices.Contains(granted, permission) {
+			ordered = append(ordered, permission)
+		}
+	}
+	return ordered, nil
+}
+
+// assignableRole checks that users may be given role: a built-in role other than trial, or a
+// defined one.
+func assignableRole(ctx context.Context, tx *sql.Tx, role string) error {
+	if role == RoleTrial {
+		return ErrInvalidRole
+	}
+	if _, ok := findBuiltinRole(role); ok {
+		return nil
+	}
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM roles WHERE name = ?)`, role).Scan(&exists); err != nil {
+		return fmt.Errorf("check role: %w", err)
+	}
+	if !exists {
+		return ErrInvalidRole
+	}
+	return nil
+}
+
+func builtinRoleView(builtin builtinRole) *Role {
+	return &Role{
+		Name:        builtin.name,
+		Description: builtin.description,
+		Permissions: append([]string{}, builtin.permissions...),
+		Builtin:     true,
+		Editable:    !builtin.fixed,
+	}
+}
@@ -6,10 +6,15 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"math/big"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
 )
 
 const (
@@ -55,89 +60,30 @@ func GetAPIKeyPrefix(apiKey string) string {
 	return apiKey[:8]
 }
 
-// CreateUser creates a new user record after validating and hashing credentials.
-func CreateUser(db *sql.DB, username, password string, email *string, role string) (int, error) {
-	if len(username) < 3 {
-		return 0, errors.New("username must be at least 3 characters")
-	}
-	if len(password) < 6 {
-		return 0, errors.New("password must be at least 6 characters")
-	}
-
-	if role == "" {
-		role = RoleUser
-	}
-	if role != RoleUser && role != RoleAdmin {
-		return 0, errors.New("invalid role")
-	}
-
-	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", username).Scan(&exists)
-	if err != nil {
-		return 0, err
-	}
-	if exists {
-		return 0, errors.New("username already exists")
-	}
-
-	passwordHash, err := HashPassword(password)
-	if err != nil {
-		return 0, err
-	}
-	result, err := db.Exec(`
-		INSERT INTO users (username, password_hash, email, role)
-		VALUES (?, ?, ?, ?)
-	`, username, passwordHash, email, role)
-	if err != nil {
-		return 0, err
-	}
+// ErrAPIKeyNotOwned is returned when an API key does not exist, is revoked, or belongs to another user.
+var ErrAPIKeyNotOwned = errors.New("API key not found or not owned by user")
 
-	userID, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
+// ErrInvalidExpiry is returned for an API key expiry that cannot be parsed or is not in the future.
+var ErrInvalidExpiry = errors.New("invalid API key expiry")
 
-	return int(userID), nil
+// dbExecutor is satisfied by both *sql.DB and *sql.Tx.
+type dbExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
 }
 
-// AuthenticateUser validates the provided credentials and returns the user.
-func AuthenticateUser(db *sql.DB, username, password string) (*User, error) {
-	var user User
-	err := db.QueryRow(`
-		SELECT id, username, password_hash, email, created_at, is_active, role
-		FROM users
-		WHERE username = ? AND is_active = 1
-	`, username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.PasswordHash,
-		&user.Email,
-		&user.CreatedAt,
-		&user.IsActive,
-		&user.Role,
-	)
-
-	if err == sql.ErrNoRows {
-		return nil, errors.New("invalid username or password")
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return nil, errors.New("invalid username or password")
-	}
-
-	user.PasswordHash = ""
-	return &user, nil
+// CreateAPIKey creates a new API key for the given user. A nil expiresAt creates a key that never expires.
+func CreateAPIKey(db *sql.DB, userID int, name string, expiresAt *time.Time) (*APIKeyResponse, error) {
+	return createAPIKey(db, userID, nil, name, expiresAt)
 }
 
-// CreateAPIKey creates a new API key for the given user.
-func CreateAPIKey(db *sql.DB, userID int, name string) (*APIKeyResponse, error) {
+// createAPIKey inserts a key created by userID, owned by the organization when orgID is set.
+func createAPIKey(db dbExecutor, userID int, orgID *int, name string, expiresAt *time.Time) (*APIKeyResponse, error) {
 	var (
 		apiKey string
 		err    error
 	)
+	hashVersion := CurrentAPIKeyHashVersion()
 
 	for attempt := 0; attempt < 10; attempt++ {
 		apiKey, err = GenerateAPIKey()
@@ -145,7 +91,7 @@ func CreateAPIKey(db *sql.DB, userID int, name string) (*APIKeyResponse, error)
 			return nil, err
 		}
 
-		keyHash := HashAPIKey(apiKey)
+		keyHash := HashAPIKeyVersion(apiKey, hashVersion)
 		var exists bool
 		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM api_keys WHERE api_key_hash = ?)", keyHash).Scan(&exists)
 		if err != nil {
@@ -164,13 +110,13 @@ func CreateAPIKey(db *sql.DB, userID int, name string) (*APIKeyResponse, error)
 		name = "API Key " + time.Now().Format("2006-01-02 15:04")
 	}
 
-	keyHash := HashAPIKey(apiKey)
+	keyHash := HashAPIKeyVersion(apiKey, hashVersion)
 	keyPrefix := GetAPIKeyPrefix(apiKey)
 
 	result, err := db.Exec(`
-		INSERT INTO api_keys (user_id, api_key_hash, api_key_prefix, name)
-		VALUES (?, ?, ?, ?)
-	`, userID, keyHash, keyPrefix, name)
+		INSERT INTO api_keys (user_id, api_key_hash, api_key_prefix, name, expires_at, hash_version, org_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, userID, keyHash, keyPrefix, name, expiresAt, hashVersion, orgID)
 	if err != nil {
 		return nil, err
 	}
@@ -186,42 +132,32 @@ func CreateAPIKey(db *sql.DB, userID int, name string) (*APIKeyResponse, error)
 		Name:      name,
 		Prefix:    keyPrefix,
 		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
 	}, nil
 }
 
 // ValidateAPIKey verifies the provided API key and returns the associated user ID.
 func ValidateAPIKey(db *sql.DB, apiKey string) (int, error) {
-	keyHash := HashAPIKey(apiKey)
-
-	var (
-		userID    int
-		isActive  bool
-		expiresAt sql.NullTime
-	)
-
-	err := db.QueryRow(`
-		SELECT user_id, is_active, expires_at
-		FROM api_keys
-		WHERE api_key_hash = ?
-	`, keyHash).Scan(&userID, &isActive, &expiresAt)
-	if err == sql.ErrNoRows {
-		return 0, errors.New("invalid API key")
-	}
+	key, err := LookupAPIKey(db, apiKey)
 	if err != nil {
 		return 0, err
 	}
 
-	if !isActive {
+	if !key.IsActive {
 		return 0, errors.New("API key has been revoked")
 	}
 
-	if expiresAt.Valid && expiresAt.Time.Before(time.Now()) {
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now()) {
 		return 0, errors.New("API key has expired")
 	}
 
-	_, _ = db.Exec("UPDATE api_keys SET last_used_at = ? WHERE api_key_hash = ?", time.Now(), keyHash)
+	_, _ = db.Exec(`
+		UPDATE api_keys
+		SET last_used_at = ?, stale_notified_at = NULL, stale_flagged_at = NULL
+		WHERE id = ?
+	`, time.Now(), key.ID)
 
-	return userID, nil
+	return key.UserID, nil
 }
 
 // CompareAPIKey checks whether the provided key matches an active key for the user.
@@ -230,71 +166,299 @@ func CompareAPIKey(db *sql.DB, userID int, apiKey string) (bool, error) {
 		return false, errors.New("API key cannot be empty")
 	}
 
-	keyHash := HashAPIKey(apiKey)
-
-	var exists bool
-	err := db.QueryRow(`
-		SELECT EXISTS(
-			SELECT 1
-			FROM api_keys
-			WHERE user_id = ? AND api_key_hash = ? AND is_active = 1
-		)
-	`, userID, keyHash).Scan(&exists)
+	key, err := LookupAPIKey(db, apiKey)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
 
-	return exists, nil
+	return key.UserID == userID && key.IsActive, nil
+}
+
+// ErrInvalidListParams is returned for an unknown sort field or order.
+var ErrInvalidListParams = errors.New("invalid list parameters")
+
+// APIKeyListParams pages, orders and filters a user's API key listing.
+type APIKeyListParams struct {
+	Page  int
+	Limit int
+	// Search keeps keys whose name contains it, ignoring ASCII case.
+	Search string
+	// Sort is "created_at" (the default), "name", "last_used_at" or "expires_at"; Order is
+	// "asc" or "desc".
+	Sort  string
+	Order string
+	// IncludeRevoked also lists revoked keys, with when and why they were revoked.
+	IncludeRevoked bool
+}
+
+var apiKeySortColumns = map[string]string{
+	"created_at":   "created_at",
+	"name":         "COALESCE(name, '') COLLATE NOCASE",
+	"last_used_at": "last_used_at",
+	"expires_at":   "expires_at",
 }
 
-// GetUserAPIKeys returns the active API keys owned by the user.
-func GetUserAPIKeys(db *sql.DB, userID int) ([]APIKeyListItem, error) {
+// GetUserAPIKeys returns a page of the user's active personal API keys, and revoked ones when
+// asked, and the total number matching the search; organization keys are listed per
+// organization.
+func GetUserAPIKeys(db *sql.DB, userID int, params APIKeyListParams) ([]APIKeyListItem, int, error) {
+	orderBy, err := database.OrderBy(params.Sort, params.Order, apiKeySortColumns, "created_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidListParams, err)
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	page := params.Page
+	if page <= 0 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	whereClause := "WHERE user_id = ? AND org_id IS NULL"
+	if !params.IncludeRevoked {
+		whereClause += " AND is_active = 1"
+	}
+	args := []any{userID}
+	if search := strings.TrimSpace(params.Search); search != "" {
+		whereClause += ` AND name LIKE ? ESCAPE '\'`
+		args = append(args, database.ContainsPattern(search))
+	}
+
+	var total int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM api_keys `+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
 	rows, err := db.Query(`
-		SELECT id, name, api_key_prefix, created_at, last_used_at, is_active
+		SELECT id, COALESCE(name, ''), api_key_prefix, created_at, last_used_at, expires_at, is_active,
+			revoked_at, COALESCE(revoke_reason, ''), allowed_cidrs
 		FROM api_keys
-		WHERE user_id = ? AND is_active = 1
-		ORDER BY created_at DESC
-	`, userID)
+		`+whereClause+`
+		ORDER BY `+orderBy+`
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var keys []APIKeyListItem
+	keys := make([]APIKeyListItem, 0)
+	now := time.Now()
 	for rows.Next() {
-		var key APIKeyListItem
-		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.CreatedAt, &key.LastUsedAt, &key.IsActive); err != nil {
-			return nil, err
+		var (
+			key          APIKeyListItem
+			allowedCIDRs sql.NullString
+		)
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt, &key.IsActive,
+			&key.RevokedAt, &key.RevokeReason, &allowedCIDRs); err != nil {
+			return nil, 0, err
 		}
+		if key.AllowedCIDRs, err = decodeAllowedCIDRs(allowedCIDRs); err != nil {
+			return nil, 0, err
+		}
+		key.Expired = key.ExpiresAt != nil && key.ExpiresAt.Before(now)
 		keys = append(keys, key)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return keys, nil
+	return keys, total, nil
 }
 
-// RevokeAPIKey marks the specified API key as inactive for the user.
+// RevokeAPIKey marks the specified API key as inactive for the user and records when and by
+// whom. Revoking an already revoked key succeeds without changing it.
 func RevokeAPIKey(db *sql.DB, userID, keyID int) error {
-	result, err := db.Exec(`
-		UPDATE api_keys
-		SET is_active = 0
-		WHERE id = ? AND user_id = ?
-	`, keyID, userID)
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	rowsAffected, err := result.RowsAffected()
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM api_keys WHERE id = ? AND user_id = ? AND org_id IS NULL)`,
+		keyID, userID).Scan(&exists)
 	if err != nil {
 		return err
 	}
+	if !exists {
+		return ErrAPIKeyNotOwned
+	}
+
+	if _, err := revokeKey(tx, keyID, RevokeReasonUser, &userID, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ResolveAPIKeyExpiry turns a relative expires_in or an absolute expires_at into an expiry time.
+// expiresIn accepts whole days ("30d") or a Go duration ("12h"). A nil result means no expiry.
+func ResolveAPIKeyExpiry(expiresIn string, expiresAt *time.Time, now time.Time) (*time.Time, error) {
+	if expiresIn != "" && expiresAt != nil {
+		return nil, fmt.Errorf("%w: set either expires_in or expires_at, not both", ErrInvalidExpiry)
+	}
+
+	var expiry time.Time
+	switch {
+	case expiresIn != "":
+		lifetime, err := parseExpiresIn(expiresIn)
+		if err != nil {
+			return nil, err
+		}
+		expiry = now.Add(lifetime)
+	case expiresAt != nil:
+		expiry = *expiresAt
+	default:
+		return nil, nil
+	}
+
+	if !expiry.After(now) {
+		return nil, fmt.Errorf("%w: expiry must be in the future", ErrInvalidExpiry)
+	}
+	expiry = expiry.UTC()
+	return &expiry, nil
+}
+
+func parseExpiresIn(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("%w: expires_in %q is not a positive number of days", ErrInvalidExpiry, value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	lifetime, err := time.ParseDuration(value)
+	if err != nil || lifetime <= 0 {
+		return 0, fmt.Errorf("%w: expires_in %q is not a positive duration", ErrInvalidExpiry, value)
+	}
+	return lifetime, nil
+}
 
-	if rowsAffected == 0 {
-		return errors.New("API key not found or not owned by user")
+// UpdateAPIKey changes the name, expiry and/or IP allowlist of an active API key owned by
+// the user. A nil name keeps the current name; expiry is only changed when setExpiry is
+// true, and a nil expiresAt then removes it. A nil allowedCIDRs keeps the allowlist, an
+// empty one removes it; entries must already be normalized.
+func UpdateAPIKey(db *sql.DB, userID, keyID int, name *string, setExpiry bool, expiresAt *time.Time, allowedCIDRs *[]string) (*APIKeyListItem, error) {
+	sets := []string{}
+	args := []any{}
+	if name != nil {
+		sets = append(sets, "name = ?")
+		args = append(args, *name)
+	}
+	if setExpiry {
+		sets = append(sets, "expires_at = ?")
+		args = append(args, expiresAt)
+	}
+	if allowedCIDRs != nil {
+		sets = append(sets, "allowed_cidrs = ?")
+		args = append(args, encodeAllowedCIDRs(*allowedCIDRs))
+	}
+	if len(sets) > 0 {
+		args = append(args, keyID, userID)
+		result, err := db.Exec(`
+			UPDATE api_keys
+			SET `+strings.Join(sets, ", ")+`
+			WHERE id = ? AND user_id = ? AND org_id IS NULL AND is_active = 1
+		`, args...)
+		if err != nil {
+			return nil, err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if rowsAffected == 0 {
+			return nil, ErrAPIKeyNotOwned
+		}
 	}
 
-	return nil
+	var (
+		key     APIKeyListItem
+		allowed sql.NullString
+	)
+	err := db.QueryRow(`
+		SELECT id, COALESCE(name, ''), api_key_prefix, created_at, last_used_at, expires_at, is_active, allowed_cidrs
+		FROM api_keys
+		WHERE id = ? AND user_id = ? AND org_id IS NULL AND is_active = 1
+	`, keyID, userID).Scan(&key.ID, &key.Name, &key.Prefix, &key.CreatedAt, &key.LastUsedAt, &key.ExpiresAt, &key.IsActive, &allowed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotOwned
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key.AllowedCIDRs, err = decodeAllowedCIDRs(allowed); err != nil {
+		return nil, err
+	}
+	key.Expired = key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now())
+	return &key, nil
+}
+
+// RotateAPIKey issues a replacement for an active API key and revokes the old key in one
+// transaction. The replacement keeps the old key's name and IP allowlist. A nil expiresAt gives it the same
+// lifetime the old key was issued with, starting now.
+func RotateAPIKey(db *sql.DB, userID, keyID int, expiresAt *time.Time) (*APIKeyResponse, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		name       string
+		createdAt  time.Time
+		oldExpires *time.Time
+		allowed    sql.NullString
+	)
+	err = tx.QueryRow(`
+		SELECT COALESCE(name, ''), created_at, expires_at, allowed_cidrs
+		FROM api_keys
+		WHERE id = ? AND user_id = ? AND org_id IS NULL AND is_active = 1
+	`, keyID, userID).Scan(&name, &createdAt, &oldExpires, &allowed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotOwned
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt == nil && oldExpires != nil {
+		if lifetime := oldExpires.Sub(createdAt); lifetime > 0 {
+			expiry := time.Now().UTC().Add(lifetime)
+			expiresAt = &expiry
+		}
+	}
+
+	resp, err := createAPIKey(tx, userID, nil, name, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if allowed.Valid {
+		if resp.AllowedCIDRs, err = decodeAllowedCIDRs(allowed); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`UPDATE api_keys SET allowed_cidrs = ? WHERE id = ?`, allowed.String, resp.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := revokeKey(tx, keyID, RevokeReasonRotated, &userID, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return resp, nil
 }
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/mail"
+)
+
+const (
+	defaultStaleKeyNoticeDays = 7
+	defaultStaleSweepInterval = 6 * time.Hour
+)
+
+// StaleKeyConfig controls how unused API keys are detected and handled.
+type StaleKeyConfig struct {
+	// After is how long a key may go unused before it is considered stale. Zero disables the sweeper.
+	After time.Duration
+	// NoticePeriod is how long before going stale an owner is notified. Revoked keys are
+	// never revoked sooner than NoticePeriod after the notice.
+	NoticePeriod time.Duration
+	// Revoke auto-revokes stale keys instead of only flagging them.
+	Revoke bool
+	// Interval is how often the sweeper runs.
+	Interval time.Duration
+}
+
+// Enabled reports whether stale key sweeping is configured.
+func (c StaleKeyConfig) Enabled() bool {
+	return c.After > 0
+}
+
+// StaleKeyConfigFromEnv loads the sweeper configuration from environment variables.
+func StaleKeyConfigFromEnv() StaleKeyConfig {
+	cfg := StaleKeyConfig{
+		NoticePeriod: defaultStaleKeyNoticeDays * 24 * time.Hour,
+		Interval:     defaultStaleSweepInterval,
+	}
+
+	if days, err := strconv.Atoi(os.Getenv("API_KEY_STALE_DAYS")); err == nil && days > 0 {
+		cfg.After = time.Duration(days) * 24 * time.Hour
+	}
+	if days, err := strconv.Atoi(os.Getenv("API_KEY_STALE_NOTICE_DAYS")); err == nil && days >= 0 {
+		cfg.NoticePeriod = time.Duration(days) * 24 * time.Hour
+	}
+	if interval, err := time.ParseDuration(os.Getenv("API_KEY_STALE_SWEEP_INTERVAL")); err == nil && interval > 0 {
+		cfg.Interval = interval
+	}
+	cfg.Revoke = strings.EqualFold(os.Getenv("API_KEY_STALE_ACTION"), "revoke")
+
+	if cfg.NoticePeriod > cfg.After {
+		cfg.NoticePeriod = cfg.After
+	}
+
+	return cfg
+}
+
+// Notifier delivers stale key warnings to key owners.
+type Notifier interface {
+	NotifyStaleAPIKey(ctx context.Context, key StaleAPIKey, staleAt time.Time) error
+}
+
+// LogNotifier writes stale key warnings to the server log.
+type LogNotifier struct{}
+
+// NotifyStaleAPIKey logs the warning for the key owner.
+func (LogNotifier) NotifyStaleAPIKey(_ context.Context, key StaleAPIKey, staleAt time.Time) error {
+	log.Printf("auth: API key %s (%s) for user %s has been idle for %d days and becomes stale at %s",
+		key.Prefix, key.Name, key.Username, key.IdleDays, staleAt.Format(time.RFC3339))
+	return nil
+}
+
+// EmailNotifier mails stale key warnings to key owners. Owners without an email address
+// are warned in the server log instead.
+type EmailNotifier struct {
+	Sender *mail.Sender
+}
+
+// NotifyStaleAPIKey sends the warning to the key owner's email address.
+func (n EmailNotifier) NotifyStaleAPIKey(ctx context.Context, key StaleAPIKey, staleAt time.Time) error {
+	if key.Email == nil || *key.Email == "" {
+		return LogNotifier{}.NotifyStaleAPIKey(ctx, key, staleAt)
+	}
+	subject := fmt.Sprintf("[Stacks Builder] API key %s becomes stale on %s", key.Prefix, staleAt.Format("2006-01-02"))
+	body := fmt.Sprintf(
+		"Hi %s,\n\nYour API key %s (%s) has not been used for %d days. "+
+			"From %s it is treated as stale and may be revoked.\n\n"+
+			"Using the key before then keeps it active. If you no longer need it, you can revoke it yourself.\n",
+		key.Username, key.Prefix, key.Name, key.IdleDays, staleAt.Format(time.RFC1123))
+	if err := n.Sender.Send(ctx, []string{*key.Email}, subject, body); err != nil {
+		return fmt.Errorf("email stale key notice: %w", err)
+	}
+	return nil
+}
+
+// SweepResult summarises one sweeper pass.
+type SweepResult struct {
+	Notified int `json:"notified"`
+	Flagged  int `json:"flagged"`
+	Revoked  int `json:"revoked"`
+}
+
+// StaleKeySweeper periodically notifies, flags, or revokes unused API keys.
+type StaleKeySweeper struct {
+	db       *sql.DB
+	cfg      StaleKeyConfig
+	notifier Notifier
+}
+
+// NewStaleKeySweeper constructs a sweeper. A nil notifier falls back to LogNotifier.
+func NewStaleKeySweeper(db *sql.DB, cfg StaleKeyConfig, notifier Notifier) *StaleKeySweeper {
+	if notifier == nil {
+		notifier = LogNotifier{}
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultStaleSweepInterval
+	}
+	return &StaleKeySweeper{db: db, cfg: cfg, notifier: notifier}
+}
+
+// Start runs the sweeper in the background until the context is cancelled.
+func (s *StaleKeySweeper) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			if res, err := s.Sweep(ctx); err != nil {
+				log.Printf("auth: stale key sweep failed: %v", err)
+			} else if res.Notified+res.Flagged+res.Revoked > 0 {
+				log.Printf("auth: stale key sweep notified=%d flagged=%d revoked=%d", res.Notified, res.Flagged, res.Revoked)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Sweep performs a single pass: notify owners of keys approaching the stale threshold,
+// then flag or revoke keys that have crossed it. A stale key is only revoked once its
+// owner was notified at least NoticePeriod ago; keys that went stale without a notice,
+// such as those already idle when the sweeper was enabled, are notified first.
+func (s *StaleKeySweeper) Sweep(ctx context.Context) (SweepResult, error) {
+	var result SweepResult
+	if !s.cfg.Enabled() {
+		return result, nil
+	}
+
+	now := time.Now().UTC()
+
+	upcoming, err := ListStaleAPIKeys(s.db, s.cfg.After-s.cfg.NoticePeriod)
+	if err != nil {
+		return result, err
+	}
+	for _, key := range upcoming {
+		if key.NotifiedAt != nil {
+			continue
+		}
+		lastActivity := key.CreatedAt
+		if key.LastUsedAt != nil {
+			lastActivity = *key.LastUsedAt
+		}
+		staleAt := lastActivity.Add(s.cfg.After)
+		if s.cfg.Revoke && staleAt.Before(now.Add(s.cfg.NoticePeriod)) {
+			staleAt = now.Add(s.cfg.NoticePeriod)
+		}
+		if err := s.notifier.NotifyStaleAPIKey(ctx, key, staleAt); err != nil {
+			log.Printf("auth: failed to notify owner of API key %d: %v", key.ID, err)
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, `UPDATE api_keys SET stale_notified_at = ? WHERE id = ?`, now, key.ID); err != nil {
+			return result, fmt.Errorf("mark key notified: %w", err)
+		}
+		result.Notified++
+	}
+
+	stale, err := ListStaleAPIKeys(s.db, s.cfg.After)
+	if err != nil {
+		return result, err
+	}
+	for _, key := range stale {
+		if s.cfg.Revoke {
+			if key.NotifiedAt == nil || now.Sub(*key.NotifiedAt) < s.cfg.NoticePeriod {
+				continue
+			}
+			if err := s.revoke(ctx, key.ID, now); err != nil {
+				return result, fmt.Errorf("revoke stale key: %w", err)
+			}
+			result.Revoked++
+			continue
+		}
+
+		if key.FlaggedAt != nil {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, `UPDATE api_keys SET stale_flagged_at = ? WHERE id = ?`, now, key.ID); err != nil {
+			return result, fmt.Errorf("flag stale key: %w", err)
+		}
+		result.Flagged++
+	}
+
+	return result, nil
+}
+
+// revoke flags and revokes a stale key, recording the sweeper as the reason.
+func (s *StaleKeySweeper) revoke(ctx context.Context, keyID int, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE api_keys SET stale_flagged_at = COALESCE(stale_flagged_at, ?) WHERE id = ?`,
+		now, keyID); err != nil {
+		return err
+	}
+	if _, err := revokeKey(tx, keyID, RevokeReasonStale, nil, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListStaleAPIKeys returns active keys that have not been used (or created) within idle.
+func ListStaleAPIKeys(db *sql.DB, idle time.Duration) ([]StaleAPIKey, error) {
+	now := time.Now().UTC()
+	cutoff := now.Add(-idle)
+
+	rows, err := db.Query(`
+		SELECT k.id, k.user_id, u.username, u.email, COALESCE(k.name, ''), k.api_key_prefix,
+			k.created_at, k.last_used_at, k.stale_notified_at, k.stale_flagged_at
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.is_active = 1 AND COALESCE(k.last_used_at, k.created_at) < ?
+		ORDER BY COALESCE(k.last_used_at, k.created_at) ASC
+	`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]StaleAPIKey, 0)
+	for rows.Next() {
+		var key StaleAPIKey
+		if err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Username,
+			&key.Email,
+			&key.Name,
+			&key.Prefix,
+			&key.CreatedAt,
+			&key.LastUsedAt,
+			&key.NotifiedAt,
+			&key.FlaggedAt,
+		); err != nil {
+			return nil, err
+		}
+
+		lastActivity := key.CreatedAt
+		if key.LastUsedAt != nil {
+			lastActivity = *key.LastUsedAt
+		}
+		key.IdleDays = int(now.Sub(lastActivity).Hours() / 24)
+
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
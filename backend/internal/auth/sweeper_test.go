@@ -0,0 +1,86 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testutil"
+)
+
+// recordingNotifier is an auth.Notifier remembering which keys it was asked to warn about.
+type recordingNotifier struct {
+	keys []int
+}
+
+func (n *recordingNotifier) NotifyStaleAPIKey(_ context.Context, key auth.StaleAPIKey, _ time.Time) error {
+	n.keys = append(n.keys, key.ID)
+	return nil
+}
+
+func TestStaleKeySweeperNotifiesBeforeRevoking(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	key := testutil.CreateAPIKey(t, db, testutil.CreateUser(t, db, ""))
+	idle := time.Now().UTC().Add(-60 * 24 * time.Hour)
+	if _, err := db.Exec(`UPDATE api_keys SET created_at = ?, last_used_at = ? WHERE id = ?`, idle, idle, key.ID); err != nil {
+		t.Fatalf("age key: %v", err)
+	}
+
+	notifier := &recordingNotifier{}
+	sweeper := auth.NewStaleKeySweeper(db, auth.StaleKeyConfig{After: 30 * 24 * time.Hour, NoticePeriod: 7 * 24 * time.Hour, Revoke: true}, notifier)
+	sweep := func(want auth.SweepResult) {
+		t.Helper()
+		got, err := sweeper.Sweep(context.Background())
+		if err != nil {
+			t.Fatalf("sweep: %v", err)
+		}
+		if got != want {
+			t.Fatalf("sweep = %+v, want %+v", got, want)
+		}
+	}
+
+	// Already past the threshold but never warned: the first pass only notifies.
+	sweep(auth.SweepResult{Notified: 1})
+	if len(notifier.keys) != 1 || notifier.keys[0] != key.ID {
+		t.Fatalf("notified keys %v, want [%d]", notifier.keys, key.ID)
+	}
+	sweep(auth.SweepResult{})
+
+	notified := time.Now().UTC().Add(-3 * 24 * time.Hour)
+	if _, err := db.Exec(`UPDATE api_keys SET stale_notified_at = ? WHERE id = ?`, notified, key.ID); err != nil {
+		t.Fatalf("backdate notice: %v", err)
+	}
+	sweep(auth.SweepResult{})
+
+	notified = time.Now().UTC().Add(-8 * 24 * time.Hour)
+	if _, err := db.Exec(`UPDATE api_keys SET stale_notified_at = ? WHERE id = ?`, notified, key.ID); err != nil {
+		t.Fatalf("backdate notice: %v", err)
+	}
+	sweep(auth.SweepResult{Revoked: 1})
+	if len(notifier.keys) != 1 {
+		t.Fatalf("notified keys %v, want the single earlier notice", notifier.keys)
+	}
+}
+
+func TestStaleKeySweeperNotifiesWithoutNoticePeriod(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	key := testutil.CreateAPIKey(t, db, testutil.CreateUser(t, db, ""))
+	idle := time.Now().UTC().Add(-60 * 24 * time.Hour)
+	if _, err := db.Exec(`UPDATE api_keys SET created_at = ?, last_used_at = ? WHERE id = ?`, idle, idle, key.ID); err != nil {
+		t.Fatalf("age key: %v", err)
+	}
+
+	notifier := &recordingNotifier{}
+	sweeper := auth.NewStaleKeySweeper(db, auth.StaleKeyConfig{After: 30 * 24 * time.Hour, Revoke: true}, notifier)
+	got, err := sweeper.Sweep(context.Background())
+	if err != nil {
+		t.Fatalf("sweep: %v", err)
+	}
+	if got != (auth.SweepResult{Notified: 1, Revoked: 1}) {
+		t.Fatalf("sweep = %+v, want the key notified and revoked", got)
+	}
+	if len(notifier.keys) != 1 || notifier.keys[0] != key.ID {
+		t.Fatalf("notified keys %v, want [%d]", notifier.keys, key.ID)
+	}
+}
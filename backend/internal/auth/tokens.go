@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/redis"
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+	tokenTypeAccess    = "access"
+	refreshTokenPrefix = "rt_"
+
+	// revokedKeyPrefix namespaces revoked access token ids in Redis.
+	revokedKeyPrefix = "stacks-builder:revoked-token:"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed, forged, or expired tokens.
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrTokenRevoked is returned for tokens that were revoked by logout or rotation.
+	ErrTokenRevoked = errors.New("token has been revoked")
+)
+
+// TokenConfig controls JWT access tokens and refresh tokens issued to web clients.
+type TokenConfig struct {
+	Secret     []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	// RedisURL, when set, keeps revoked access tokens in Redis so a logout on one replica is
+	// honoured by all of them.
+	RedisURL string
+}
+
+// TokenConfigFromEnv loads token settings from JWT_SECRET, JWT_ACCESS_TTL, JWT_REFRESH_TTL,
+// and REDIS_URL. Without JWT_SECRET a random secret is used, so sessions do not survive a
+// restart.
+func TokenConfigFromEnv() TokenConfig {
+	cfg := TokenConfig{
+		Secret:     []byte(os.Getenv("JWT_SECRET")),
+		AccessTTL:  defaultAccessTokenTTL,
+		RefreshTTL: defaultRefreshTokenTTL,
+		RedisURL:   strings.TrimSpace(os.Getenv("REDIS_URL")),
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("JWT_ACCESS_TTL")); err == nil && ttl > 0 {
+		cfg.AccessTTL = ttl
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("JWT_REFRESH_TTL")); err == nil && ttl > 0 {
+		cfg.RefreshTTL = ttl
+	}
+
+	if len(cfg.Secret) == 0 {
+		log.Println("auth: JWT_SECRET not set, using an ephemeral signing secret")
+		cfg.Secret = make([]byte, 32)
+		if _, err := rand.Read(cfg.Secret); err != nil {
+			log.Fatalf("auth: failed to generate JWT secret: %v", err)
+		}
+	}
+
+	return cfg
+}
+
+// AccessClaims are the claims carried by an access token.
+type AccessClaims struct {
+	Subject   string `json:"sub"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Type      string `json:"typ"`
+	ID        string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	// PasswordChange limits the session to changing the password.
+	PasswordChange bool `json:"pwd_change,omitempty"`
+}
+
+// UserID returns the numeric user id from the subject claim.
+func (c AccessClaims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// TokenPair is returned on login and refresh.
+type TokenPair struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+}
+
+// TokenService issues and validates session tokens. Access tokens are HS256 JWTs; refresh
+// tokens are opaque, stored hashed, and rotated on every use.
+type TokenService struct {
+	db  *sql.DB
+	cfg TokenConfig
+	// redis holds revoked access tokens when configured; otherwise they are kept in the database.
+	redis *redis.Client
+}
+
+// NewTokenService constructs a token service. An invalid RedisURL is logged and revoked
+// tokens are kept in the database instead.
+func NewTokenService(db *sql.DB, cfg TokenConfig) *TokenService {
+	if cfg.AccessTTL <= 0 {
+		cfg.AccessTTL = defaultAccessTokenTTL
+	}
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = defaultRefreshTokenTTL
+	}
+
+	service := &TokenService{db: db, cfg: cfg}
+	if cfg.RedisURL != "" {
+		client, err := redis.New(cfg.RedisURL)
+		if err != nil {
+			log.Printf("auth: keeping revoked tokens in the database: %v", err)
+		} else {
+			service.redis = client
+		}
+	}
+	return service
+}
+
+// Issue creates a new access token and refresh token for the user.
+func (s *TokenService) Issue(user *User) (*TokenPair, error) {
+	now := time.Now().UTC()
+
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.sign(AccessClaims{
+		Subject:   strconv.Itoa(user.ID),
+		Username:  user.Username,
+		Role:      user.Role,
+		Type:      tokenTypeAccess,
+		ID:        jti,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.cfg.AccessTTL).Unix(),
+
+		PasswordChange: user.MustChangePassword,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken := refreshTokenPrefix + secret
+	if _, err := s.db.Exec(`
+		INSERT INTO refresh_tokens (user_id, token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?)
+	`, user.ID, hashToken(refreshToken), now.Add(s.cfg.RefreshTTL), now); err != nil {
+		return nil, fmt.Errorf("store refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(s.cfg.AccessTTL.Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int64(s.cfg.RefreshTTL.Seconds()),
+	}, nil
+}
+
+// ParseAccessToken verifies the signature, expiry, and revocation state of an access token.
+func (s *TokenService) ParseAccessToken(token string) (*AccessClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	header, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(header, &h); err != nil || h.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, s.signature(parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims AccessClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Type != tokenTypeAccess || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+
+	revoked, err := s.accessTokenRevoked(claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("check token revocation: %w", err)
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return &claims, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair, revoking the old refresh token.
+// Presenting an already-rotated token revokes every refresh token of that user.
+func (s *TokenService) Refresh(refreshToken string) (*TokenPair, error) {
+	var (
+		id        int64
+		userID    int
+		expiresAt time.Time
+		revokedAt sql.NullTime
+	)
+	err := s.db.QueryRow(`
+		SELECT id, user_id, expires_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = ?
+	`, hashToken(refreshToken)).Scan(&id, &userID, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup refresh token: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if revokedAt.Valid {
+		if _, err := s.db.Exec(`UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, now, userID); err != nil {
+			return nil, fmt.Errorf("revoke refresh tokens: %w", err)
+		}
+		return nil, ErrTokenRevoked
+	}
+	if !now.Before(expiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	var user User
+	err = s.db.QueryRow(`
+		SELECT id, username, role, must_change_password
+		FROM users
+		WHERE id = ? AND is_active = 1
+	`, userID).Scan(&user.ID, &user.Username, &user.Role, &user.MustChangePassword)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup user: %w", err)
+	}
+
+	res, err := s.db.Exec(`UPDATE refresh_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, now, id)
+	if err != nil {
+		return nil, fmt.Errorf("rotate refresh token: %w", err)
+	}
+	if rows, _ := res.RowsAffected(); rows == 0 {
+		// A concurrent refresh already rotated this token.
+		return nil, ErrTokenRevoked
+	}
+
+	return s.Issue(&user)
+}
+
+// Logout revokes the refresh token and, when provided, the access token until it expires.
+func (s *TokenService) Logout(refreshToken string, accessClaims *AccessClaims) error {
+	now := time.Now().UTC()
+
+	if refreshToken != "" {
+		if _, err := s.db.Exec(`
+			UPDATE refresh_tokens SET revoked_at = ?
+			WHERE token_hash = ? AND revoked_at IS NULL
+		`, now, hashToken(refreshToken)); err != nil {
+			return fmt.Errorf("revoke refresh token: %w", err)
+		}
+	}
+
+	if accessClaims != nil {
+		if err := s.revokeAccessToken(accessClaims.ID, time.Unix(accessClaims.ExpiresAt, 0).UTC(), now); err != nil {
+			return fmt.Errorf("revoke access token: %w", err)
+		}
+	}
+
+	if s.redis == nil {
+		// Expired entries no longer need to be remembered.
+		if _, err := s.db.Exec(`DELETE FROM revoked_access_tokens WHERE expires_at < ?`, now); err != nil {
+			log.Printf("auth: failed to prune revoked access tokens: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// RevokeUserSessions revokes every refresh token of the user, signing out all of their
+// sessions once their access tokens expire.
+func (s *TokenService) RevokeUserSessions(userID int) error {
+	if _, err := s.db.Exec(`UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, time.Now().UTC(), userID); err != nil {
+		return fmt.Errorf("revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// revokeAccessToken remembers the token id until the token expires. Redis drops the entry
+// itself once it expires.
+func (s *TokenService) revokeAccessToken(jti string, expiresAt, now time.Time) error {
+	if s.redis != nil {
+		ttl := expiresAt.Sub(now)
+		if ttl <= 0 {
+			return nil
+		}
+		return s.redis.Set(context.Background(), revokedKeyPrefix+jti, []byte("1"), ttl)
+	}
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO revoked_access_tokens (jti, expires_at) VALUES (?, ?)`, jti, expiresAt)
+	return err
+}
+
+func (s *TokenService) accessTokenRevoked(jti string) (bool, error) {
+	if s.redis != nil {
+		return s.redis.Exists(context.Background(), revokedKeyPrefix+jti)
+	}
+	var revoked bool
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM revoked_access_tokens WHERE jti = ?)`, jti).Scan(&revoked)
+	return revoked, err
+}
+
+func (s *TokenService) sign(claims AccessClaims) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("marshal token claims: %w", err)
+	}
+
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(s.signature(unsigned)), nil
+}
+
+func (s *TokenService) signature(unsigned string) []byte {
+	mac := hmac.New(sha256.New, s.cfg.Secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+func randomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
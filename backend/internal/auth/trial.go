@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTrialTTL             = 24 * time.Hour
+	defaultTrialMaxPerIP        = 3
+	defaultTrialCleanupInterval = time.Hour
+
+	trialUsernamePrefix = "trial-"
+	trialAPIKeyName     = "Trial access"
+	// unusablePasswordHash is not a bcrypt hash, so password logins as a trial user always fail.
+	unusablePasswordHash = "!trial"
+)
+
+var (
+	// ErrTrialDisabled is returned when anonymous trial access is not enabled.
+	ErrTrialDisabled = errors.New("trial access is disabled")
+	// ErrTrialLimit is returned when a client IP has started too many trials recently.
+	ErrTrialLimit = errors.New("too many trials started from this address")
+)
+
+// TrialActiveError is returned when the device already has an unexpired trial.
+type TrialActiveError struct {
+	ExpiresAt time.Time
+}
+
+func (e *TrialActiveError) Error() string {
+	return "a trial is already active for this device"
+}
+
+// TrialConfig controls anonymous trial access. Trial token quotas are the "trial" role's
+// usage quota and their request rate the trial rate limiter's.
+type TrialConfig struct {
+	Enabled bool
+	// TTL is how long a trial token is valid.
+	TTL time.Duration
+	// MaxPerIP is how many trials one client IP may start per TTL. Zero means unlimited.
+	MaxPerIP int
+	// CleanupInterval is how often expired trial identities are deleted.
+	CleanupInterval time.Duration
+}
+
+// TrialConfigFromEnv loads TRIAL_ENABLED, TRIAL_TTL, TRIAL_MAX_PER_IP and
+// TRIAL_CLEANUP_INTERVAL.
+func TrialConfigFromEnv() TrialConfig {
+	cfg := TrialConfig{
+		Enabled:         strings.EqualFold(strings.TrimSpace(os.Getenv("TRIAL_ENABLED")), "true"),
+		TTL:             defaultTrialTTL,
+		MaxPerIP:        defaultTrialMaxPerIP,
+		CleanupInterval: defaultTrialCleanupInterval,
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("TRIAL_TTL")); err == nil && ttl > 0 {
+		cfg.TTL = ttl
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("TRIAL_MAX_PER_IP"))); err == nil && n >= 0 {
+		cfg.MaxPerIP = n
+	}
+	if interval, err := time.ParseDuration(os.Getenv("TRIAL_CLEANUP_INTERVAL")); err == nil && interval > 0 {
+		cfg.CleanupInterval = interval
+	}
+	return cfg
+}
+
+// TrialToken is an ephemeral API key issued to an anonymous client.
+type TrialToken struct {
+	Token     string    `json:"token"`
+	TokenID   int       `json:"token_id"`
+	UserID    int       `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TrialService issues trial tokens and removes them once expired. Each trial is a user with
+// the trial role holding one expiring API key, so quotas, rate limits and query logs apply
+// to trials like to any other user.
+type TrialService struct {
+	db  *sql.DB
+	cfg TrialConfig
+	now func() time.Time
+}
+
+// NewTrialService constructs a trial service.
+func NewTrialService(db *sql.DB, cfg TrialConfig) *TrialService {
+	return &TrialService{db: db, cfg: cfg, now: time.Now}
+}
+
+// Enabled reports whether trials may be started.
+func (s *TrialService) Enabled() bool {
+	return s.cfg.Enabled
+}
+
+// Issue starts a trial for the device, identified by a client-generated ID, connecting
+// from ip. A device may hold one unexpired trial at a time.
+func (s *TrialService) Issue(deviceID, ip string) (*TrialToken, error) {
+	if !s.cfg.Enabled {
+		return nil, ErrTrialDisabled
+	}
+
+	now := s.now().UTC()
+	expiresAt := now.Add(s.cfg.TTL)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var activeUntil time.Time
+	err = tx.QueryRow(`
+		SELECT expires_at FROM trial_identities
+		WHERE device_id = ? AND expires_at > ?
+		ORDER BY expires_at DESC LIMIT 1
+	`, deviceID, now).Scan(&activeUntil)
+	if err == nil {
+		return nil, &TrialActiveError{ExpiresAt: activeUntil}
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if s.cfg.MaxPerIP > 0 {
+		var started int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM trial_identities WHERE ip_address = ? AND created_at > ?`,
+			ip, now.Add(-s.cfg.TTL)).Scan(&started)
+		if err != nil {
+			return nil, err
+		}
+		if started >= s.cfg.MaxPerIP {
+			return nil, ErrTrialLimit
+		}
+	}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec(`INSERT INTO users (username, password_hash, role) VALUES (?, ?, ?)`,
+		trialUsernamePrefix+hex.EncodeToString(suffix), unusablePasswordHash, RoleTrial)
+	if err != nil {
+		return nil, fmt.Errorf("create trial user: %w", err)
+	}
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := createAPIKey(tx, int(userID), nil, trialAPIKeyName, &expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("create trial token: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO trial_identities (user_id, api_key_id, device_id, ip_address, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userID, key.ID, deviceID, ip, expiresAt, now)
+	if err != nil {
+		return nil, fmt.Errorf("record trial: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &TrialToken{Token: key.APIKey, TokenID: key.ID, UserID: int(userID), ExpiresAt: expiresAt}, nil
+}
+
+// Start deletes expired trial identities every CleanupInterval until ctx is done. It runs
+// even while trials are disabled, so tokens issued before they were turned off are removed.
+func (s *TrialService) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.cfg.CleanupInterval)
+		defer ticker.Stop()
+
+		for {
+			if removed, err := s.Cleanup(ctx); err != nil {
+				log.Printf("auth: trial cleanup failed: %v", err)
+			} else if removed > 0 {
+				log.Printf("auth: removed %d expired trial identities", removed)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Cleanup deletes expired trials with their users, API keys, quotas, conversations and
+// artifacts, and returns how many were removed. Their query logs and feedback are kept for
+// analytics.
+func (s *TrialService) Cleanup(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT user_id FROM trial_identities WHERE expires_at <= ?`, s.now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	var userIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, userID := range userIDs {
+		if err := s.deleteTrial(ctx, userID); err != nil {
+			return removed, fmt.Errorf("delete trial user %d: %w", userID, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (s *TrialService) deleteTrial(ctx context.Context, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range []string{
+		`DELETE FROM api_key_events WHERE api_key_id IN (SELECT id FROM api_keys WHERE user_id = ?)`,
+		`DELETE FROM api_keys WHERE user_id = ?`,
+		`DELETE FROM user_quotas WHERE user_id = ?`,
+		`DELETE FROM provider_credentials WHERE user_id = ?`,
+		`DELETE FROM conversations WHERE user_id = ?`,
+		`DELETE FROM artifacts WHERE user_id = ?`,
+		`DELETE FROM trial_identities WHERE user_id = ?`,
+		`DELETE FROM users WHERE id = ? AND role = '` + RoleTrial + `'`,
+	} {
+		if _, err := tx.ExecContext(ctx, statement, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+)
+
+var (
+	// ErrUserNotFound is returned when a user does not exist.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidCredentials is returned for an unknown or inactive user or a wrong password.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrUsernameTaken is returned when registering a username that is already in use.
+	ErrUsernameTaken = errors.New("username already exists")
+	// ErrUsernameTooShort and ErrPasswordTooShort reject credentials below the minimum length.
+	ErrUsernameTooShort = errors.New("username must be at least 3 characters")
+	ErrPasswordTooShort = errors.New("password must be at least 6 characters")
+	// ErrInvalidRole is returned for the trial role or a role that is neither built in nor
+	// defined.
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrPasswordUnchanged is returned when a new password equals the current one.
+	ErrPasswordUnchanged = errors.New("new password must differ from the current password")
+)
+
+// NewUser describes a password account to register. An empty Role creates a regular user.
+type NewUser struct {
+	Username string
+	Password string
+	Email    *string
+	Role     string
+	// MustChangePassword limits the account to changing its password until it does.
+	MustChangePassword bool
+}
+
+// validate checks the credentials and defaults the role to RoleUser. Whether the role exists
+// is checked when the user is stored.
+func (u *NewUser) validate() error {
+	if len(u.Username) < 3 {
+		return ErrUsernameTooShort
+	}
+	if err := validatePassword(u.Password); err != nil {
+		return err
+	}
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
+	return nil
+}
+
+func validatePassword(password string) error {
+	if len(password) < 6 {
+		return ErrPasswordTooShort
+	}
+	return nil
+}
+
+// UserStore manages password accounts. Handlers depend on it rather than on
+// UserRepository so tests can substitute an in-memory implementation.
+type UserStore interface {
+	// Create registers a user and returns its ID.
+	Create(ctx context.Context, user NewUser) (int, error)
+	// CreateWithAPIKey registers a user together with a non-expiring API key; neither is
+	// stored when either fails.
+	CreateWithAPIKey(ctx context.Context, user NewUser, keyName string) (int, *APIKeyResponse, error)
+	// Authenticate returns the active user with the given credentials.
+	Authenticate(ctx context.Context, username, password string) (*User, error)
+	// SetRole changes a user's role and returns the previous one.
+	SetRole(ctx context.Context, userID int, role string) (string, error)
+	// ChangePassword replaces the user's password after checking the current one.
+	ChangePassword(ctx context.Context, userID int, currentPassword, newPassword string) error
+}
+
+// UserRepository stores users in the users table. Writes go through the database's shared
+// writer.
+type UserRepository struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+var _ UserStore = (*UserRepository)(nil)
+
+// NewUserRepository returns a repository backed by the supplied sql.DB handle.
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: db, writer: database.WriterFor(db)}
+}
+
+// Create validates the credentials, hashes the password and inserts the user.
+func (r *UserRepository) Create(ctx context.Context, user NewUser) (int, error) {
+	userID, _, err := r.create(ctx, user, nil)
+	return userID, err
+}
+
+// CreateWithAPIKey inserts the user and an API key named keyName in one transaction. The
+// response carries the plain-text key, which is not stored.
+func (r *UserRepository) CreateWithAPIKey(ctx context.Context, user NewUser, keyName string) (int, *APIKeyResponse, error) {
+	return r.create(ctx, user, &keyName)
+}
+
+// create inserts the user and, when keyName is set, an API key for it.
+func (r *UserRepository) create(ctx context.Context, user NewUser, keyName *string) (int, *APIKeyResponse, error) {
+	if err := user.validate(); err != nil {
+		return 0, nil, err
+	}
+	// Hash before taking the writer; bcrypt is deliberately slow.
+	passwordHash, err := HashPassword(user.Password)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var (
+		userID int
+		key    *APIKeyResponse
+	)
+	err = r.writer.Do(ctx, func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var exists bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)`, user.Username).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("check username: %w", err)
+		}
+		if exists {
+			return ErrUsernameTaken
+		}
+		if err := assignableRole(ctx, tx, user.Role); err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO users (username, password_hash, email, role, must_change_password)
+			VALUES (?, ?, ?, ?, ?)
+		`, user.Username, passwordHash, user.Email, user.Role, user.MustChangePassword)
+		if err != nil {
+			return fmt.Errorf("create user: %w", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		if keyName != nil {
+			if key, err = createAPIKey(tx, int(id), nil, *keyName, nil); err != nil {
+				return fmt.Errorf("create api key: %w", err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		userID = int(id)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return userID, key, nil
+}
+
+// Authenticate looks up an active user by username and checks the password. The returned
+// user has no password hash.
+func (r *UserRepository) Authenticate(ctx context.Context, username, password string) (*User, error) {
+	var user User
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, username, password_hash, email, created_at, is_active, role, must_change_password
+		FROM users
+		WHERE username = ? AND is_active = 1
+	`, username).Scan(
+		&user.ID,
+		&user.Username,
+		&user.PasswordHash,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+		&user.Role,
+		&user.MustChangePassword,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load user: %w", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	user.PasswordHash = ""
+	return &user, nil
+}
+
+// SetRole changes a user's role and returns the previous one. Session tokens pick up the new
+// role when they are next refreshed; Basic Auth requests see it immediately.
+func (r *UserRepository) SetRole(ctx context.Context, userID int, role string) (string, error) {
+	var previous string
+	err := r.writer.Do(ctx, func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		err = tx.QueryRowContext(ctx, `SELECT role FROM users WHERE id = ?`, userID).Scan(&previous)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := assignableRole(ctx, tx, role); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET role = ? WHERE id = ?`, role, userID); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return "", err
+	}
+	return previous, nil
+}
+
+// Lookup returns the user with the given username, active or not. The returned user has no
+// password hash.
+func (r *UserRepository) Lookup(ctx context.Context, username string) (*User, error) {
+	var user User
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, username, email, created_at, is_active, role, must_change_password
+		FROM users
+		WHERE username = ?
+	`, username).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+		&user.Role,
+		&user.MustChangePassword,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load user: %w", err)
+	}
+	return &user, nil
+}
+
+// Deactivate stops a user from signing in and revokes their session refresh tokens and
+// personal API keys, returning how many keys were revoked. Organization keys they created
+// stay with the organization, and access tokens already issued stay valid until they
+// expire. Deactivating an inactive user revokes anything left.
+func (r *UserRepository) Deactivate(ctx context.Context, userID int) (int, error) {
+	var revoked int
+	err := r.writer.Do(ctx, func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		res, err := tx.ExecContext(ctx, `UPDATE users SET is_active = 0 WHERE id = ?`, userID)
+		if err != nil {
+			return fmt.Errorf("deactivate user: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrUserNotFound
+		}
+
+		now := time.Now().UTC()
+		if _, err := tx.ExecContext(ctx, `UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, now, userID); err != nil {
+			return fmt.Errorf("revoke refresh tokens: %w", err)
+		}
+
+		rows, err := tx.QueryContext(ctx, `SELECT id FROM api_keys WHERE user_id = ? AND org_id IS NULL AND is_active = 1`, userID)
+		if err != nil {
+			return err
+		}
+		var keyIDs []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			keyIDs = append(keyIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, id := range keyIDs {
+			if _, err := revokeKey(tx, id, RevokeReasonDeactivated, nil, now); err != nil {
+				return fmt.Errorf("revoke api key %d: %w", id, err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		revoked = len(keyIDs)
+		return nil
+	})
+	return revoked, err
+}
+
+// ChangePassword checks the user's current password, stores the new one and lifts a required
+// password change.
+func (r *UserRepository) ChangePassword(ctx context.Context, userID int, currentPassword, newPassword string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+	if newPassword == currentPassword {
+		return ErrPasswordUnchanged
+	}
+
+	var passwordHash string
+	err := r.db.QueryRowContext(ctx, `SELECT password_hash FROM users WHERE id = ? AND is_active = 1`, userID).Scan(&passwordHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("load user: %w", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(currentPassword)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	newHash, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	// The hash is compared again so a concurrent change is not overwritten.
+	res, err := r.writer.Exec(ctx, `
+		UPDATE users SET password_hash = ?, must_change_password = 0
+		WHERE id = ? AND password_hash = ?
+	`, newHash, userID, passwordHash)
+	if err != nil {
+		return fmt.Errorf("update password: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+// Package backup takes online snapshots of the SQLite database with VACUUM INTO, keeps the
+// most recent ones on disk and optionally uploads each to an S3-compatible bucket.
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetain = 7
+	// snapshotTimeFormat names snapshots so they sort by creation time.
+	snapshotTimeFormat = "20060102T150405.000Z"
+	snapshotPrefix     = "clarity_coder-"
+	snapshotSuffix     = ".db"
+)
+
+var snapshotName = regexp.MustCompile(`^clarity_coder-\d{8}T\d{6}\.\d{3}Z\.db$`)
+
+var (
+	// ErrNotConfigured is returned when no backup directory is configured.
+	ErrNotConfigured = errors.New("backups are not configured")
+	// ErrInProgress is returned when a backup is requested while another is running.
+	ErrInProgress = errors.New("a backup is already in progress")
+	// ErrSnapshotNotFound is returned for unknown or malformed snapshot names.
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+)
+
+// Config controls where snapshots are written, how many are kept and how often they are
+// taken.
+type Config struct {
+	// Dir holds the snapshots. Empty disables backups.
+	Dir string
+	// Interval is how often scheduled snapshots are taken. Zero disables the schedule;
+	// snapshots can still be taken on demand.
+	Interval time.Duration
+	// Retain is the number of snapshots kept on disk; older ones are deleted after each
+	// backup. Zero keeps every snapshot.
+	Retain int
+	// S3 uploads every snapshot when a bucket is set.
+	S3 S3Config
+}
+
+// ConfigFromEnv reads BACKUP_DIR, BACKUP_INTERVAL, BACKUP_RETAIN and the BACKUP_S3_*
+// variables. BACKUP_DIR defaults to a backups directory next to DATABASE_PATH; invalid
+// values are ignored.
+func ConfigFromEnv() Config {
+	dbPath := os.Getenv("DATABASE_PATH")
+	if dbPath == "" {
+		dbPath = "./data/clarity_coder.db"
+	}
+	cfg := Config{
+		Dir:    filepath.Join(filepath.Dir(dbPath), "backups"),
+		Retain: defaultRetain,
+		S3:     s3ConfigFromEnv(),
+	}
+	if dir := strings.TrimSpace(os.Getenv("BACKUP_DIR")); dir != "" {
+		cfg.Dir = dir
+	}
+	if interval, err := time.ParseDuration(os.Getenv("BACKUP_INTERVAL")); err == nil && interval > 0 {
+		cfg.Interval = interval
+	}
+	if retain, err := strconv.Atoi(os.Getenv("BACKUP_RETAIN")); err == nil && retain >= 0 {
+		cfg.Retain = retain
+	}
+	return cfg
+}
+
+// Snapshot is a database backup on disk.
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+	// S3Key is set on a new snapshot that was uploaded; UploadError explains a failed upload.
+	S3Key       string `json:"s3_key,omitempty"`
+	UploadError string `json:"upload_error,omitempty"`
+}
+
+// Service takes and lists snapshots. Only one snapshot is taken at a time.
+type Service struct {
+	db      *sql.DB
+	cfg     Config
+	s3      *s3Client
+	running sync.Mutex
+}
+
+// NewService returns a service that backs up db.
+func NewService(db *sql.DB, cfg Config) *Service {
+	s := &Service{db: db, cfg: cfg}
+	if cfg.S3.Enabled() {
+		s.s3 = newS3Client(cfg.S3)
+	}
+	return s
+}
+
+// Config returns the service's configuration.
+func (s *Service) Config() Config {
+	return s.cfg
+}
+
+// Start takes a snapshot every Interval in the background until the context is cancelled.
+// It does nothing when backups or the schedule are disabled.
+func (s *Service) Start(ctx context.Context) {
+	if s.cfg.Dir == "" || s.cfg.Interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			snapshot, err := s.Run(ctx)
+			switch {
+			case err != nil:
+				log.Printf("backup: scheduled backup failed: %v", err)
+			case snapshot.UploadError != "":
+				log.Printf("backup: wrote %s (%d bytes) but the upload failed: %s", snapshot.Name, snapshot.Size, snapshot.UploadError)
+			default:
+				log.Printf("backup: wrote %s (%d bytes)", snapshot.Name, snapshot.Size)
+			}
+		}
+	}()
+}
+
+// Run writes a consistent snapshot of the live database with VACUUM INTO, uploads it when
+// S3 is configured and prunes old snapshots. A failed upload keeps the local snapshot and
+// is reported in UploadError rather than as an error.
+func (s *Service) Run(ctx context.Context) (Snapshot, error) {
+	if s.cfg.Dir == "" {
+		return Snapshot{}, ErrNotConfigured
+	}
+	if !s.running.TryLock() {
+		return Snapshot{}, ErrInProgress
+	}
+	defer s.running.Unlock()
+
+	if err := os.MkdirAll(s.cfg.Dir, 0o700); err != nil {
+		return Snapshot{}, fmt.Errorf("create backup directory: %w", err)
+	}
+
+	createdAt := time.Now().UTC().Truncate(time.Millisecond)
+	name := snapshotPrefix + createdAt.Format(snapshotTimeFormat) + snapshotSuffix
+	path := filepath.Join(s.cfg.Dir, name)
+	// Write under a temporary name so a partial snapshot is never listed.
+	tmp := path + ".tmp"
+	if _, err := s.db.ExecContext(ctx, `VACUUM INTO ?`, tmp); err != nil {
+		os.Remove(tmp)
+		return Snapshot{}, fmt.Errorf("vacuum into %s: %w", tmp, err)
+	}
+	if err := os.Chmod(tmp, 0o600); err != nil {
+		os.Remove(tmp)
+		return Snapshot{}, fmt.Errorf("restrict snapshot permissions: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return Snapshot{}, fmt.Errorf("rename snapshot: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("stat snapshot: %w", err)
+	}
+	snapshot := Snapshot{Name: name, Size: info.Size(), CreatedAt: createdAt}
+
+	if s.s3 != nil {
+		key, err := s.s3.upload(ctx, name, path)
+		if err != nil {
+			snapshot.UploadError = err.Error()
+		} else {
+			snapshot.S3Key = key
+		}
+	}
+
+	if err := s.prune(); err != nil {
+		log.Printf("backup: failed to prune old snapshots: %v", err)
+	}
+	return snapshot, nil
+}
+
+// List returns the snapshots on disk, newest first.
+func (s *Service) List() ([]Snapshot, error) {
+	if s.cfg.Dir == "" {
+		return nil, ErrNotConfigured
+	}
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read backup directory: %w", err)
+	}
+
+	snapshots := []Snapshot{}
+	for _, entry := range entries {
+		if entry.IsDir() || !snapshotName.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{
+			Name:      entry.Name(),
+			Size:      info.Size(),
+			CreatedAt: snapshotTime(entry.Name(), info.ModTime()),
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Name > snapshots[j].Name
+	})
+	return snapshots, nil
+}
+
+// Path returns the file of the named snapshot. Names are checked against the snapshot
+// pattern, so they cannot reach outside the backup directory.
+func (s *Service) Path(name string) (string, error) {
+	if s.cfg.Dir == "" {
+		return "", ErrNotConfigured
+	}
+	if !snapshotName.MatchString(name) {
+		return "", ErrSnapshotNotFound
+	}
+	path := filepath.Join(s.cfg.Dir, name)
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrSnapshotNotFound
+		}
+		return "", fmt.Errorf("stat snapshot: %w", err)
+	}
+	return path, nil
+}
+
+// prune deletes the oldest snapshots beyond Retain.
+func (s *Service) prune() error {
+	if s.cfg.Retain <= 0 {
+		return nil
+	}
+	snapshots, err := s.List()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, snapshot := range snapshots[min(s.cfg.Retain, len(snapshots)):] {
+		if err := os.Remove(filepath.Join(s.cfg.Dir, snapshot.Name)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// snapshotTime parses the creation time from a snapshot name, falling back to fallback.
+func snapshotTime(name string, fallback time.Time) time.Time {
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix)
+	if t, err := time.Parse(snapshotTimeFormat, stamp); err == nil {
+		return t
+	}
+	return fallback.UTC()
+}
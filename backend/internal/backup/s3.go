@@ -0,0 +1,194 @@
+package backup
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	s3UploadTimeout = 30 * time.Minute
+)
+
+// S3Config uploads snapshots to an S3-compatible bucket with path-style requests, so it
+// also works with MinIO, R2 and similar stores.
+type S3Config struct {
+	Bucket string
+	// Endpoint is the store's base URL; it defaults to AWS for the region.
+	Endpoint string
+	Region   string
+	// Prefix is prepended to snapshot names, e.g. "stacks-builder/".
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Enabled reports whether a bucket and credentials are configured.
+func (c S3Config) Enabled() bool {
+	return c.Bucket != "" && c.AccessKeyID != "" && c.SecretAccessKey != ""
+}
+
+// s3ConfigFromEnv reads BACKUP_S3_BUCKET, BACKUP_S3_ENDPOINT, BACKUP_S3_REGION,
+// BACKUP_S3_PREFIX and the credentials, which fall back to the standard AWS_* variables.
+func s3ConfigFromEnv() S3Config {
+	cfg := S3Config{
+		Bucket:          strings.TrimSpace(os.Getenv("BACKUP_S3_BUCKET")),
+		Endpoint:        strings.TrimRight(strings.TrimSpace(os.Getenv("BACKUP_S3_ENDPOINT")), "/"),
+		Region:          envOr("BACKUP_S3_REGION", "AWS_REGION"),
+		Prefix:          strings.TrimLeft(os.Getenv("BACKUP_S3_PREFIX"), "/"),
+		AccessKeyID:     envOr("BACKUP_S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: envOr("BACKUP_S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    envOr("BACKUP_S3_SESSION_TOKEN", "AWS_SESSION_TOKEN"),
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultS3Region
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	return cfg
+}
+
+func envOr(name, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return strings.TrimSpace(os.Getenv(fallback))
+}
+
+// s3Client puts objects signed with AWS Signature Version 4.
+type s3Client struct {
+	cfg    S3Config
+	client *http.Client
+}
+
+func newS3Client(cfg S3Config) *s3Client {
+	return &s3Client{cfg: cfg, client: &http.Client{Timeout: s3UploadTimeout}}
+}
+
+// upload puts the file at path under the configured prefix and returns its key.
+func (c *s3Client) upload(ctx context.Context, name, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", fmt.Errorf("hash snapshot: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	key := c.cfg.Prefix + name
+	uri := "/" + uriEncode(c.cfg.Bucket) + "/" + uriEncodePath(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.cfg.Endpoint+uri, file)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/vnd.sqlite3")
+	c.sign(req, uri, hex.EncodeToString(hash.Sum(nil)), time.Now().UTC())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("upload to s3://%s/%s: %w", c.cfg.Bucket, key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("upload to s3://%s/%s: status %d: %s", c.cfg.Bucket, key, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return key, nil
+}
+
+// sign adds the SigV4 headers for a request without a query string.
+func (c *s3Client) sign(req *http.Request, uri, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	headers := []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{
+		"content-type":         req.Header.Get("Content-Type"),
+		"host":                 req.URL.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           amzDate,
+	}
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = c.cfg.SessionToken
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(values[name]) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method, uri, "", canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.cfg.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex(canonicalRequest),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// uriEncodePath encodes each segment of an object key, keeping the slashes.
+func uriEncodePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, as SigV4 requires.
+func uriEncode(s string) string {
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 'A' && ch <= 'Z' || ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '_' || ch == '.' || ch == '~' {
+			builder.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&builder, "%%%02X", ch)
+	}
+	return builder.String()
+}
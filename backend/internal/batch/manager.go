@@ -0,0 +1,382 @@
+// Package batch runs many generation prompts as one persisted job, either inline with the
+// request or in the background with progress polling.
+package batch
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/models"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/webhook"
+)
+
+// Endpoint is the path batch jobs are recorded under in the query logs.
+const Endpoint = "/api/v1/rag/generate/batch"
+
+const (
+	defaultConcurrency    = 4
+	defaultMaxQueries     = 100
+	defaultMaxSyncQueries = 10
+	defaultMaxRunning     = 2
+	defaultJobTimeout     = time.Hour
+)
+
+var (
+	// ErrNoQueries is returned when a batch has no non-empty queries.
+	ErrNoQueries = errors.New("queries must contain at least one non-empty query")
+	// ErrTooManyQueries is returned when a batch exceeds the configured size limit.
+	ErrTooManyQueries = errors.New("too many queries in batch")
+	// ErrJobFinished is returned when cancelling a job that has already finished.
+	ErrJobFinished = errors.New("batch job has already finished")
+
+	// errCancelled is the cancellation cause of jobs stopped through Cancel.
+	errCancelled = errors.New("cancelled by request")
+)
+
+// Config bounds batch sizes and how much generation work runs at once.
+type Config struct {
+	// Concurrency is the number of queries of one batch generated in parallel.
+	Concurrency int
+	// MaxQueries caps the size of an async batch; MaxSyncQueries caps a synchronous one.
+	MaxQueries     int
+	MaxSyncQueries int
+	// MaxRunning is the number of batches processed at once; others wait queued.
+	MaxRunning int
+	// Timeout bounds a single batch run. Zero disables the limit.
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads BATCH_CONCURRENCY, BATCH_MAX_QUERIES, BATCH_MAX_SYNC_QUERIES,
+// BATCH_MAX_RUNNING and BATCH_JOB_TIMEOUT.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Concurrency:    defaultConcurrency,
+		MaxQueries:     defaultMaxQueries,
+		MaxSyncQueries: defaultMaxSyncQueries,
+		MaxRunning:     defaultMaxRunning,
+		Timeout:        defaultJobTimeout,
+	}
+	if n, err := strconv.Atoi(os.Getenv("BATCH_CONCURRENCY")); err == nil && n > 0 {
+		cfg.Concurrency = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("BATCH_MAX_QUERIES")); err == nil && n > 0 {
+		cfg.MaxQueries = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("BATCH_MAX_SYNC_QUERIES")); err == nil && n > 0 {
+		cfg.MaxSyncQueries = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("BATCH_MAX_RUNNING")); err == nil && n > 0 {
+		cfg.MaxRunning = n
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("BATCH_JOB_TIMEOUT")); err == nil && timeout >= 0 {
+		cfg.Timeout = timeout
+	}
+	return cfg
+}
+
+// Generator produces the response for a single query of a batch.
+type Generator func(ctx context.Context, query string) (*codegen.CodeGenerationResponse, error)
+
+// Request describes a batch submitted by a user.
+type Request struct {
+	UserID      int64
+	APIKeyID    *int64
+	Provider    string
+	Queries     []string
+	Temperature float64
+	MaxTokens   int
+	// Async returns as soon as the job is queued instead of waiting for the results.
+	Async bool
+}
+
+// Manager creates batch jobs and runs them on a bounded pool of generation workers.
+type Manager struct {
+	repo    *Repository
+	cfg     Config
+	logs    *querylog.Service
+	events  webhook.Publisher
+	running chan struct{}
+
+	mu      sync.Mutex
+	cancels map[int64]context.CancelCauseFunc
+}
+
+// NewManager constructs a manager. Aggregated usage of each finished batch is written to
+// logs, and the job published as a batch.completed event, when they are non-nil.
+func NewManager(db *sql.DB, cfg Config, logs *querylog.Service, events webhook.Publisher) *Manager {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = defaultConcurrency
+	}
+	if cfg.MaxQueries <= 0 {
+		cfg.MaxQueries = defaultMaxQueries
+	}
+	if cfg.MaxSyncQueries <= 0 {
+		cfg.MaxSyncQueries = defaultMaxSyncQueries
+	}
+	if cfg.MaxRunning <= 0 {
+		cfg.MaxRunning = defaultMaxRunning
+	}
+	return &Manager{
+		repo:    NewRepository(db),
+		cfg:     cfg,
+		logs:    logs,
+		events:  events,
+		running: make(chan struct{}, cfg.MaxRunning),
+		cancels: make(map[int64]context.CancelCauseFunc),
+	}
+}
+
+// Repository returns the job repository used by the manager.
+func (m *Manager) Repository() *Repository {
+	return m.repo
+}
+
+// FailAbandoned marks batches left unfinished by a previous process as failed.
+func (m *Manager) FailAbandoned(ctx context.Context) {
+	if n, err := m.repo.FailAbandoned(ctx); err != nil {
+		log.Printf("batch: failed to clean up abandoned jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("batch: marked %d abandoned jobs as failed", n)
+	}
+}
+
+// Submit creates a job for the request. Async jobs run in the background and are returned
+// queued; otherwise Submit waits for every query and returns the job with its items.
+func (m *Manager) Submit(ctx context.Context, req Request, generate Generator) (*Job, error) {
+	queries := make([]string, 0, len(req.Queries))
+	for _, query := range req.Queries {
+		if query = strings.TrimSpace(query); query != "" {
+			queries = append(queries, query)
+		}
+	}
+	if len(queries) == 0 {
+		return nil, ErrNoQueries
+	}
+	limit := m.cfg.MaxQueries
+	if !req.Async {
+		limit = m.cfg.MaxSyncQueries
+	}
+	if len(queries) > limit {
+		return nil, fmt.Errorf("%w: %d exceeds the limit of %d", ErrTooManyQueries, len(queries), limit)
+	}
+
+	job := &Job{
+		UserID:        req.UserID,
+		APIKeyID:      req.APIKeyID,
+		ModelProvider: req.Provider,
+		Temperature:   req.Temperature,
+		MaxTokens:     req.MaxTokens,
+	}
+	if err := m.repo.Create(ctx, job, queries); err != nil {
+		return nil, err
+	}
+
+	if req.Async {
+		go m.run(context.WithoutCancel(ctx), job, queries, generate)
+		return job, nil
+	}
+
+	m.run(ctx, job, queries, generate)
+	return m.repo.Get(context.WithoutCancel(ctx), job.ID, true)
+}
+
+// Cancel stops a queued or running job and returns its updated record.
+func (m *Manager) Cancel(ctx context.Context, id int64) (*Job, error) {
+	job, err := m.repo.Get(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if job.Finished() {
+		return job, ErrJobFinished
+	}
+
+	m.mu.Lock()
+	cancel, ok := m.cancels[id]
+	m.mu.Unlock()
+	if ok {
+		// The runner records the cancelled status once in-flight generations return.
+		cancel(errCancelled)
+		job.Status = StatusCancelled
+		return job, nil
+	}
+
+	finished, err := m.repo.Finish(ctx, id, StatusCancelled, "")
+	if err != nil {
+		return nil, err
+	}
+	if !finished {
+		job, err = m.repo.Get(ctx, id, false)
+		if err != nil {
+			return nil, err
+		}
+		return job, ErrJobFinished
+	}
+	return m.publishFinished(ctx, id)
+}
+
+func (m *Manager) run(ctx context.Context, job *Job, queries []string, generate Generator) {
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	m.mu.Lock()
+	m.cancels[job.ID] = cancel
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.cancels, job.ID)
+		m.mu.Unlock()
+		cancel(nil)
+	}()
+
+	// Wait for a batch slot; the job stays queued meanwhile.
+	finishCtx := context.WithoutCancel(ctx)
+	select {
+	case m.running <- struct{}{}:
+		defer func() { <-m.running }()
+	case <-jobCtx.Done():
+		m.finish(finishCtx, job, queries, time.Now(), cancelledByRequest(jobCtx), jobCtx.Err())
+		return
+	}
+
+	started, err := m.repo.MarkRunning(finishCtx, job.ID)
+	if err != nil {
+		log.Printf("batch: failed to start job %d: %v", job.ID, err)
+		return
+	}
+	if !started {
+		// Cancelled while queued.
+		return
+	}
+
+	runCtx := jobCtx
+	if m.cfg.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		runCtx, cancelTimeout = context.WithTimeout(jobCtx, m.cfg.Timeout)
+		defer cancelTimeout()
+	}
+
+	start := time.Now()
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(m.cfg.Concurrency, len(queries)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				item := generateItem(runCtx, generate, i, queries[i])
+				if err := m.repo.RecordItem(finishCtx, job.ID, item); err != nil {
+					log.Printf("batch: failed to record item %d of job %d: %v", i, job.ID, err)
+				}
+			}
+		}()
+	}
+
+feed:
+	for i := range queries {
+		select {
+		case indexes <- i:
+		case <-runCtx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	m.finish(finishCtx, job, queries, start, cancelledByRequest(jobCtx), runCtx.Err())
+}
+
+func cancelledByRequest(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errCancelled)
+}
+
+func generateItem(ctx context.Context, generate Generator, index int, query string) Item {
+	item := Item{Index: index, Query: query, Status: ItemCompleted}
+	resp, err := generate(ctx, query)
+	if err != nil {
+		item.Status = ItemFailed
+		item.ErrorMessage = err.Error()
+		return item
+	}
+	item.Code = resp.Code
+	item.Explanation = resp.Explanation
+	item.InputTokens = resp.InputTokens
+	item.OutputTokens = resp.OutputTokens
+	item.Warnings = resp.Warnings
+	return item
+}
+
+// finish records the job outcome and its aggregated query log entry.
+func (m *Manager) finish(ctx context.Context, job *Job, queries []string, start time.Time, cancelled bool, runErr error) {
+	current, err := m.repo.Get(ctx, job.ID, false)
+	if err != nil {
+		log.Printf("batch: failed to load job %d: %v", job.ID, err)
+		return
+	}
+
+	status, message := StatusCompleted, ""
+	switch {
+	case cancelled:
+		status = StatusCancelled
+	case errors.Is(runErr, context.DeadlineExceeded):
+		status, message = StatusFailed, fmt.Sprintf("timed out after %s", m.cfg.Timeout)
+	case runErr != nil:
+		status, message = StatusFailed, runErr.Error()
+	case current.FailedItems == current.TotalItems:
+		status, message = StatusFailed, "all queries failed"
+	case current.FailedItems > 0:
+		message = fmt.Sprintf("%d of %d queries failed", current.FailedItems, current.TotalItems)
+	}
+
+	if _, err := m.repo.Finish(ctx, job.ID, status, message); err != nil {
+		log.Printf("batch: failed to record outcome of job %d: %v", job.ID, err)
+	}
+	log.Printf("batch: job %d %s (%d/%d completed)", job.ID, status, current.CompletedItems, current.TotalItems)
+	if _, err := m.publishFinished(ctx, job.ID); err != nil {
+		log.Printf("batch: failed to load finished job %d: %v", job.ID, err)
+	}
+
+	if m.logs == nil {
+		return
+	}
+	entry := &querylog.QueryLog{
+		UserID:        job.UserID,
+		APIKeyID:      job.APIKeyID,
+		Endpoint:      Endpoint,
+		Query:         strings.Join(queries, "\n"),
+		QueryText:     strings.Join(queries, "\n"),
+		Response:      fmt.Sprintf("batch %d %s: %d completed, %d failed", job.ID, status, current.CompletedItems, current.FailedItems),
+		ModelProvider: job.ModelProvider,
+		Model:         codegen.ActiveModel(job.ModelProvider),
+		InputTokens:   current.InputTokens,
+		OutputTokens:  current.OutputTokens,
+		LatencyMs:     time.Since(start).Milliseconds(),
+		Status:        "success",
+		ErrorMessage:  message,
+	}
+	entry.CostUSD = models.EstimateCost(entry.ModelProvider, entry.Model, entry.InputTokens, entry.OutputTokens)
+	if status != StatusCompleted {
+		entry.Status = "error"
+	}
+	m.logs.LogAsync(entry)
+}
+
+// publishFinished loads a finished job without its items and publishes it as a
+// batch.completed event.
+func (m *Manager) publishFinished(ctx context.Context, id int64) (*Job, error) {
+	job, err := m.repo.Get(ctx, id, false)
+	if err != nil {
+		return nil, err
+	}
+	if m.events != nil {
+		m.events.Publish(webhook.EventBatchCompleted, job)
+	}
+	return job, nil
+}
@@ -0,0 +1,75 @@
+package batch
+
+import (
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+// Batch job lifecycle states stored in batch_jobs.status.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Item states stored in batch_items.status.
+const (
+	ItemPending   = "pending"
+	ItemCompleted = "completed"
+	ItemFailed    = "failed"
+)
+
+// Job is a persisted batch of generation requests.
+type Job struct {
+	ID             int64      `json:"id"`
+	UserID         int64      `json:"user_id"`
+	APIKeyID       *int64     `json:"api_key_id,omitempty"`
+	Status         string     `json:"status"`
+	ModelProvider  string     `json:"model_provider"`
+	Temperature    float64    `json:"temperature"`
+	MaxTokens      int        `json:"max_tokens"`
+	TotalItems     int        `json:"total_items"`
+	CompletedItems int        `json:"completed_items"`
+	FailedItems    int        `json:"failed_items"`
+	Progress       int        `json:"progress"`
+	InputTokens    int        `json:"input_tokens"`
+	OutputTokens   int        `json:"output_tokens"`
+	ErrorMessage   string     `json:"error_message,omitempty"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Items          []Item     `json:"items,omitempty"`
+}
+
+// Item is the result of one query in a batch.
+type Item struct {
+	Index        int               `json:"index"`
+	Query        string            `json:"query"`
+	Status       string            `json:"status"`
+	Code         string            `json:"code,omitempty"`
+	Explanation  string            `json:"explanation,omitempty"`
+	InputTokens  int               `json:"input_tokens"`
+	OutputTokens int               `json:"output_tokens"`
+	Warnings     []codegen.Warning `json:"warnings,omitempty"`
+	ErrorMessage string            `json:"error_message,omitempty"`
+}
+
+// Finished reports whether the job has reached a terminal state.
+func (j Job) Finished() bool {
+	switch j.Status {
+	case StatusCompleted, StatusFailed, StatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+func progressOf(done, total int) int {
+	if total == 0 {
+		return 100
+	}
+	return done * 100 / total
+}
@@ -0,0 +1,294 @@
+package batch
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned when a batch job cannot be located.
+var ErrNotFound = errors.New("batch job not found")
+
+// Repository persists batch jobs and their items.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository returns a repository backed by the supplied sql.DB handle.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+const selectColumns = `
+	id, user_id, api_key_id, status, COALESCE(model_provider, ''), temperature, max_tokens,
+	total_items, completed_items, failed_items, input_tokens, output_tokens,
+	COALESCE(error_message, ''), started_at, completed_at, created_at
+`
+
+// Create inserts a queued job with one pending item per query and fills in its ID.
+func (r *Repository) Create(ctx context.Context, job *Job, queries []string) error {
+	job.Status = StatusQueued
+	job.TotalItems = len(queries)
+	job.CreatedAt = time.Now().UTC()
+
+	var apiKeyID any
+	if job.APIKeyID != nil {
+		apiKeyID = *job.APIKeyID
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin batch job: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO batch_jobs (user_id, api_key_id, status, model_provider, temperature, max_tokens, total_items, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.UserID, apiKeyID, job.Status, job.ModelProvider, job.Temperature, job.MaxTokens, job.TotalItems, job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert batch job: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("fetch batch job id: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO batch_items (batch_id, item_index, query, status) VALUES (?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare batch items: %w", err)
+	}
+	defer stmt.Close()
+	for i, query := range queries {
+		if _, err := stmt.ExecContext(ctx, id, i, query, ItemPending); err != nil {
+			return fmt.Errorf("insert batch item: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit batch job: %w", err)
+	}
+	job.ID = id
+	return nil
+}
+
+// Get returns a job by ID, with its items when withItems is set.
+func (r *Repository) Get(ctx context.Context, id int64, withItems bool) (*Job, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+selectColumns+` FROM batch_jobs WHERE id = ?`, id)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil || !withItems {
+		return job, err
+	}
+
+	job.Items, err = r.Items(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Items returns the items of a job in submission order.
+func (r *Repository) Items(ctx context.Context, batchID int64) ([]Item, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT item_index, query, status, COALESCE(code, ''), COALESCE(explanation, ''),
+			input_tokens, output_tokens, COALESCE(warnings, ''), COALESCE(error_message, '')
+		FROM batch_items
+		WHERE batch_id = ?
+		ORDER BY item_index
+	`, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("list batch items: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]Item, 0)
+	for rows.Next() {
+		var (
+			item     Item
+			warnings string
+		)
+		if err := rows.Scan(
+			&item.Index,
+			&item.Query,
+			&item.Status,
+			&item.Code,
+			&item.Explanation,
+			&item.InputTokens,
+			&item.OutputTokens,
+			&warnings,
+			&item.ErrorMessage,
+		); err != nil {
+			return nil, fmt.Errorf("scan batch item: %w", err)
+		}
+		if warnings != "" {
+			if err := json.Unmarshal([]byte(warnings), &item.Warnings); err != nil {
+				return nil, fmt.Errorf("decode batch item warnings: %w", err)
+			}
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate batch items: %w", err)
+	}
+	return items, nil
+}
+
+// MarkRunning moves a queued job to running. It reports false when the job is no longer queued.
+func (r *Repository) MarkRunning(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE batch_jobs
+		SET status = ?, started_at = ?
+		WHERE id = ? AND status = ?
+	`, StatusRunning, time.Now().UTC(), id, StatusQueued)
+	if err != nil {
+		return false, fmt.Errorf("start batch job: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// RecordItem stores an item's result and adds it to the job's progress and token totals.
+func (r *Repository) RecordItem(ctx context.Context, batchID int64, item Item) error {
+	var warnings, errMsg any
+	if len(item.Warnings) > 0 {
+		data, err := json.Marshal(item.Warnings)
+		if err != nil {
+			return fmt.Errorf("encode batch item warnings: %w", err)
+		}
+		warnings = string(data)
+	}
+	if item.ErrorMessage != "" {
+		errMsg = item.ErrorMessage
+	}
+
+	completed, failed := 0, 0
+	if item.Status == ItemCompleted {
+		completed = 1
+	} else {
+		failed = 1
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin batch item: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE batch_items
+		SET status = ?, code = ?, explanation = ?, input_tokens = ?, output_tokens = ?, warnings = ?, error_message = ?
+		WHERE batch_id = ? AND item_index = ?
+	`, item.Status, item.Code, item.Explanation, item.InputTokens, item.OutputTokens, warnings, errMsg, batchID, item.Index); err != nil {
+		return fmt.Errorf("update batch item: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE batch_jobs
+		SET completed_items = completed_items + ?, failed_items = failed_items + ?,
+			input_tokens = input_tokens + ?, output_tokens = output_tokens + ?
+		WHERE id = ?
+	`, completed, failed, item.InputTokens, item.OutputTokens, batchID); err != nil {
+		return fmt.Errorf("update batch job totals: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit batch item: %w", err)
+	}
+	return nil
+}
+
+// Finish moves a queued or running job to a terminal status.
+// It reports false when the job had already finished.
+func (r *Repository) Finish(ctx context.Context, id int64, status, errorMessage string) (bool, error) {
+	var errMsg any
+	if errorMessage != "" {
+		errMsg = errorMessage
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE batch_jobs
+		SET status = ?, error_message = ?, completed_at = ?
+		WHERE id = ? AND status IN (?, ?)
+	`, status, errMsg, time.Now().UTC(), id, StatusQueued, StatusRunning)
+	if err != nil {
+		return false, fmt.Errorf("finish batch job: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// FailAbandoned marks jobs left queued or running by a previous process as failed.
+func (r *Repository) FailAbandoned(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE batch_jobs
+		SET status = ?, error_message = ?, completed_at = ?
+		WHERE status IN (?, ?)
+	`, StatusFailed, "interrupted by server restart", time.Now().UTC(), StatusQueued, StatusRunning)
+	if err != nil {
+		return 0, fmt.Errorf("fail abandoned batch jobs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	var (
+		job         Job
+		apiKeyID    sql.NullInt64
+		startedAt   sql.NullTime
+		completedAt sql.NullTime
+	)
+	err := row.Scan(
+		&job.ID,
+		&job.UserID,
+		&apiKeyID,
+		&job.Status,
+		&job.ModelProvider,
+		&job.Temperature,
+		&job.MaxTokens,
+		&job.TotalItems,
+		&job.CompletedItems,
+		&job.FailedItems,
+		&job.InputTokens,
+		&job.OutputTokens,
+		&job.ErrorMessage,
+		&startedAt,
+		&completedAt,
+		&job.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan batch job: %w", err)
+	}
+
+	if apiKeyID.Valid {
+		job.APIKeyID = &apiKeyID.Int64
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	job.Progress = progressOf(job.CompletedItems+job.FailedItems, job.TotalItems)
+	return &job, nil
+}
@@ -0,0 +1,340 @@
+// Package cache stores RAG retrievals and code generations keyed on normalized requests,
+// so repeated questions skip the vector store and the LLM provider.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// Backends selectable with CACHE_BACKEND.
+const (
+	BackendNone   = "none"
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// Cache statuses recorded in query logs.
+const (
+	// StatusHit means the response was served from the generation cache (or, for
+	// retrieval-only requests, the retrieval cache).
+	StatusHit = "hit"
+	// StatusPartial means retrieval was cached but the response was generated.
+	StatusPartial = "partial"
+	// StatusMiss means nothing was served from the cache.
+	StatusMiss = "miss"
+)
+
+const (
+	defaultMaxEntries   = 1000
+	defaultRetrievalTTL = 10 * time.Minute
+	defaultKeyPrefix    = "stacks-builder:cache:"
+)
+
+// Store is a byte-oriented key/value store with per-entry expiry.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Config controls the cache backend and how long each kind of entry lives.
+type Config struct {
+	Backend string
+	// MaxEntries bounds the in-memory LRU.
+	MaxEntries int
+	// RetrievalTTL is how long retrieved contexts are reused. Zero disables retrieval caching.
+	RetrievalTTL time.Duration
+	// GenerationTTL is how long full generations are reused. Zero disables generation caching.
+	GenerationTTL time.Duration
+	RedisURL      string
+	KeyPrefix     string
+}
+
+// ConfigFromEnv loads CACHE_BACKEND, CACHE_MAX_ENTRIES, CACHE_RETRIEVAL_TTL,
+// CACHE_GENERATION_TTL, CACHE_KEY_PREFIX, and REDIS_URL. The backend defaults to redis when
+// REDIS_URL is set and to memory otherwise.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Backend:      strings.ToLower(strings.TrimSpace(os.Getenv("CACHE_BACKEND"))),
+		MaxEntries:   defaultMaxEntries,
+		RetrievalTTL: defaultRetrievalTTL,
+		RedisURL:     os.Getenv("REDIS_URL"),
+		KeyPrefix:    os.Getenv("CACHE_KEY_PREFIX"),
+	}
+	if cfg.Backend == "" {
+		cfg.Backend = BackendMemory
+		if strings.TrimSpace(cfg.RedisURL) != "" {
+			cfg.Backend = BackendRedis
+		}
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = defaultKeyPrefix
+	}
+
+	if n, err := strconv.Atoi(os.Getenv("CACHE_MAX_ENTRIES")); err == nil && n > 0 {
+		cfg.MaxEntries = n
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("CACHE_RETRIEVAL_TTL")); err == nil && ttl >= 0 {
+		cfg.RetrievalTTL = ttl
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("CACHE_GENERATION_TTL")); err == nil && ttl >= 0 {
+		cfg.GenerationTTL = ttl
+	}
+
+	return cfg
+}
+
+// Counters tracks lookups for one kind of entry.
+type Counters struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// Stats reports cache activity since the process started.
+type Stats struct {
+	Backend    string   `json:"backend"`
+	Retrieval  Counters `json:"retrieval"`
+	Generation Counters `json:"generation"`
+	Errors     int64    `json:"errors"`
+}
+
+type counters struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (c *counters) snapshot() Counters {
+	return Counters{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// Cache stores retrievals and generations. A nil *Cache is valid and caches nothing.
+type Cache struct {
+	store Store
+	cfg   Config
+
+	retrieval  counters
+	generation counters
+	errors     atomic.Int64
+}
+
+// New builds a cache for the configured backend. It returns nil when caching is disabled.
+func New(cfg Config) (*Cache, error) {
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = defaultKeyPrefix
+	}
+
+	var store Store
+	switch cfg.Backend {
+	case BackendNone:
+		return nil, nil
+	case "", BackendMemory:
+		cfg.Backend = BackendMemory
+		store = NewMemoryStore(cfg.MaxEntries)
+	case BackendRedis:
+		redis, err := NewRedisStore(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		store = redis
+	default:
+		return nil, fmt.Errorf("unsupported CACHE_BACKEND %q", cfg.Backend)
+	}
+
+	return NewWithStore(store, cfg), nil
+}
+
+// NewWithStore builds a cache on an existing store.
+func NewWithStore(store Store, cfg Config) *Cache {
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = defaultKeyPrefix
+	}
+	return &Cache{store: store, cfg: cfg}
+}
+
+// Stats returns hit and miss counts since the cache was created.
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{Backend: BackendNone}
+	}
+	return Stats{
+		Backend:    c.cfg.Backend,
+		Retrieval:  c.retrieval.snapshot(),
+		Generation: c.generation.snapshot(),
+		Errors:     c.errors.Load(),
+	}
+}
+
+// RetrievalEnabled reports whether retrieved contexts are cached.
+func (c *Cache) RetrievalEnabled() bool {
+	return c != nil && c.cfg.RetrievalTTL > 0
+}
+
+// GenerationEnabled reports whether full generations are cached.
+func (c *Cache) GenerationEnabled() bool {
+	return c != nil && c.cfg.GenerationTTL > 0
+}
+
+// GetRetrieval returns cached contexts for the query and filter.
+func (c *Cache) GetRetrieval(ctx context.Context, query string, nResults int, filter rag.Filter) (*rag.RAGResponse, bool) {
+	if !c.RetrievalEnabled() {
+		return nil, false
+	}
+
+	var resp rag.RAGResponse
+	if !c.get(ctx, c.retrievalKey(query, nResults, filter), &resp) {
+		c.retrieval.misses.Add(1)
+		return nil, false
+	}
+	c.retrieval.hits.Add(1)
+	return &resp, true
+}
+
+// SetRetrieval caches contexts retrieved for the query and filter.
+func (c *Cache) SetRetrieval(ctx context.Context, query string, nResults int, filter rag.Filter, resp *rag.RAGResponse) {
+	if !c.RetrievalEnabled() || resp == nil || resp.Error != "" {
+		return
+	}
+	c.set(ctx, c.retrievalKey(query, nResults, filter), resp, c.cfg.RetrievalTTL)
+}
+
+// GenerationKey identifies a generation request.
+type GenerationKey struct {
+	Provider     string
+	Model        string
+	Query        string
+	Temperature  float64
+	MaxTokens    int
+	CodeContexts []string
+	DocContexts  []string
+	// PromptTemplate is the version of the prompt template the request used, if any.
+	PromptTemplate string
+	// ResponseLanguage is the language explanations were requested in, if any.
+	ResponseLanguage string
+	// ResponseFormat is the codegen response format, if not the default text format.
+	ResponseFormat string
+}
+
+// cachedGeneration keeps the raw text, which is not part of the response's JSON form.
+type cachedGeneration struct {
+	Response *codegen.CodeGenerationResponse `json:"response"`
+	Text     string                          `json:"text"`
+}
+
+// GetGeneration returns a cached generation for the key.
+func (c *Cache) GetGeneration(ctx context.Context, key GenerationKey) (*codegen.CodeGenerationResponse, bool) {
+	if !c.GenerationEnabled() {
+		return nil, false
+	}
+
+	var entry cachedGeneration
+	if !c.get(ctx, c.generationKey(key), &entry) || entry.Response == nil {
+		c.generation.misses.Add(1)
+		return nil, false
+	}
+	c.generation.hits.Add(1)
+	entry.Response.Text = entry.Text
+	return entry.Response, true
+}
+
+// SetGeneration caches a completed generation. Interrupted responses are never cached.
+func (c *Cache) SetGeneration(ctx context.Context, key GenerationKey, resp *codegen.CodeGenerationResponse) {
+	if !c.GenerationEnabled() || resp == nil || resp.Interrupted {
+		return
+	}
+	c.set(ctx, c.generationKey(key), cachedGeneration{Response: resp, Text: resp.Text}, c.cfg.GenerationTTL)
+}
+
+func (c *Cache) get(ctx context.Context, key string, dest any) bool {
+	data, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		c.errors.Add(1)
+		log.Printf("cache: get failed: %v", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		c.errors.Add(1)
+		log.Printf("cache: discarding unreadable entry: %v", err)
+		return false
+	}
+	return true
+}
+
+func (c *Cache) set(ctx context.Context, key string, value any, ttl time.Duration) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		c.errors.Add(1)
+		log.Printf("cache: failed to encode entry: %v", err)
+		return
+	}
+	if err := c.store.Set(ctx, key, data, ttl); err != nil {
+		c.errors.Add(1)
+		log.Printf("cache: set failed: %v", err)
+	}
+}
+
+func (c *Cache) retrievalKey(query string, nResults int, filter rag.Filter) string {
+	filter = filter.Normalize()
+	// Unfiltered retrievals keep the keys they had before filters existed.
+	if filter.Collection == "" && len(filter.Repos) == 0 && filter.SearchMode == "" {
+		return c.key("retrieval", NormalizeQuery(query), nResults)
+	}
+	// Likewise filtered retrievals without a search mode.
+	if filter.SearchMode == "" {
+		return c.key("retrieval", NormalizeQuery(query), nResults, filter.Collection, filter.Repos)
+	}
+	return c.key("retrieval", NormalizeQuery(query), nResults, filter.Collection, filter.Repos, filter.SearchMode)
+}
+
+// generationKey includes the provider's prompt fingerprint, so editing the deployment
+// prompts stops generations made with the old ones from being served.
+func (c *Cache) generationKey(key GenerationKey) string {
+	provider := strings.ToLower(key.Provider)
+	parts := []any{
+		provider,
+		key.Model,
+		NormalizeQuery(key.Query),
+		strconv.FormatFloat(key.Temperature, 'f', -1, 64),
+		key.MaxTokens,
+		key.CodeContexts,
+		key.DocContexts,
+		"prompt:" + codegen.PromptFingerprint(provider),
+	}
+	if key.PromptTemplate != "" {
+		parts = append(parts, key.PromptTemplate)
+	}
+	if key.ResponseLanguage != "" {
+		parts = append(parts, "language:"+strings.ToLower(key.ResponseLanguage))
+	}
+	if key.ResponseFormat != "" && key.ResponseFormat != codegen.ResponseFormatText {
+		parts = append(parts, "format:"+key.ResponseFormat)
+	}
+	return c.key("generation", parts...)
+}
+
+// key hashes the parts so arbitrary query text yields a short, backend-safe key.
+func (c *Cache) key(kind string, parts ...any) string {
+	data, _ := json.Marshal(parts)
+	sum := sha256.Sum256(data)
+	return c.cfg.KeyPrefix + kind + ":" + hex.EncodeToString(sum[:])
+}
+
+// NormalizeQuery lowercases the query and collapses whitespace so trivially different
+// spellings of the same question share an entry.
+func NormalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
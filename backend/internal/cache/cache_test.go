@@ -0,0 +1,50 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cache"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+func TestGenerationMissesAfterPromptConfigChange(t *testing.T) {
+	previous := codegen.CurrentPromptConfig()
+	t.Cleanup(func() { _ = codegen.SetPromptConfig(previous) })
+
+	c, err := cache.New(cache.Config{Backend: cache.BackendMemory, MaxEntries: 10, GenerationTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("create cache: %v", err)
+	}
+	ctx := context.Background()
+	key := cache.GenerationKey{Provider: codegen.ProviderGemini, Model: "gemini-test", Query: "Write a counter"}
+	c.SetGeneration(ctx, key, &codegen.CodeGenerationResponse{Code: "(define-data-var counter uint u0)"})
+	if _, ok := c.GetGeneration(ctx, key); !ok {
+		t.Fatal("generation was not cached")
+	}
+
+	edited := codegen.CurrentPromptConfig()
+	edited.ProviderSystemMessages[codegen.ProviderOpenAI] = "Answer in terse Clarity."
+	if err := codegen.SetPromptConfig(edited); err != nil {
+		t.Fatalf("set prompt config: %v", err)
+	}
+	if _, ok := c.GetGeneration(ctx, key); !ok {
+		t.Fatal("editing another provider's system message dropped the cached generation")
+	}
+
+	edited.InstructionPreamble = "Use only the documentation excerpts as context."
+	if err := codegen.SetPromptConfig(edited); err != nil {
+		t.Fatalf("set prompt config: %v", err)
+	}
+	if _, ok := c.GetGeneration(ctx, key); ok {
+		t.Fatal("generation made with the old preamble was served")
+	}
+
+	if err := codegen.SetPromptConfig(previous); err != nil {
+		t.Fatalf("restore prompt config: %v", err)
+	}
+	if _, ok := c.GetGeneration(ctx, key); !ok {
+		t.Fatal("restoring the prompt config did not find the original generation")
+	}
+}
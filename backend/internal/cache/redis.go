@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/redis"
+)
+
+// RedisStore keeps entries in Redis, so every replica shares one cache.
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore connects to the server at a redis:// or rediss:// URL, e.g.
+// redis://:password@localhost:6379/0. The connection is opened lazily on first use.
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	client, err := redis.New(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: client}, nil
+}
+
+// Get returns the value stored under key.
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return s.client.Get(ctx, key)
+}
+
+// Set stores value under key with the given expiry.
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl)
+}
+
+// Close closes the underlying connections.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
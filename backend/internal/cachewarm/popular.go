@@ -0,0 +1,116 @@
+package cachewarm
+
+import (
+	"encoding/json"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cache"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// defaultNResults is the number of code contexts generation and chat endpoints retrieve.
+const defaultNResults = 5
+
+// Endpoints whose logged request bodies are mined for popular queries.
+var Endpoints = []string{
+	"/api/v1/rag/retrieve",
+	"/api/v1/rag/generate",
+	"/api/v1/rag/generate-project",
+	"/v1/chat/completions",
+}
+
+// PopularQuery is a normalized retrieval request and how often it was made.
+type PopularQuery struct {
+	Query    string     `json:"query"`
+	NResults int        `json:"n_results"`
+	Filter   rag.Filter `json:"filter"`
+	Count    int64      `json:"count"`
+}
+
+// loggedRequest covers the request shapes of every mined endpoint.
+type loggedRequest struct {
+	Query    string `json:"query"`
+	NResults int    `json:"n_results"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	rag.Filter
+}
+
+// parseLoggedRequest extracts the retrieval a logged request body performed. Chat requests
+// retrieve for their last user message.
+func parseLoggedRequest(body string) (PopularQuery, bool) {
+	var req loggedRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		return PopularQuery{}, false
+	}
+
+	query := req.Query
+	for i := len(req.Messages) - 1; query == "" && i >= 0; i-- {
+		if req.Messages[i].Role == "user" {
+			query = req.Messages[i].Content
+		}
+	}
+	if strings.TrimSpace(query) == "" {
+		return PopularQuery{}, false
+	}
+
+	nResults := req.NResults
+	if nResults <= 0 {
+		nResults = defaultNResults
+	}
+
+	filter := req.Filter.Normalize()
+	if filter.Validate() != nil {
+		return PopularQuery{}, false
+	}
+	slices.Sort(filter.Repos)
+
+	return PopularQuery{Query: query, NResults: nResults, Filter: filter}, true
+}
+
+// rankPopularQueries merges request counts that share a cache key and returns the topN most
+// frequent. The most frequent spelling of each query is kept.
+func rankPopularQueries(counts []querylog.RequestCount, topN int) []PopularQuery {
+	type group struct {
+		query PopularQuery
+		best  int64
+	}
+	groups := make(map[string]*group)
+	order := make([]string, 0)
+
+	for _, count := range counts {
+		parsed, ok := parseLoggedRequest(count.Query)
+		if !ok {
+			continue
+		}
+		key, _ := json.Marshal([]any{cache.NormalizeQuery(parsed.Query), parsed.NResults, parsed.Filter})
+
+		g, ok := groups[string(key)]
+		if !ok {
+			g = &group{query: parsed}
+			groups[string(key)] = g
+			order = append(order, string(key))
+		}
+		g.query.Count += count.Count
+		if count.Count > g.best {
+			g.best = count.Count
+			g.query.Query = parsed.Query
+		}
+	}
+
+	ranked := make([]PopularQuery, 0, len(order))
+	for _, key := range order {
+		ranked = append(ranked, groups[key].query)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].Count > ranked[j].Count })
+
+	if len(ranked) > topN {
+		ranked = ranked[:topN]
+	}
+	return ranked
+}
@@ -0,0 +1,279 @@
+// Package cachewarm precomputes retrieval cache entries for the queries users ask most often.
+// A scheduled pass mines recent query logs for the top-N normalized queries and stores their
+// RAG contexts in the response cache before the next request needs them.
+package cachewarm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cache"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+const (
+	defaultTopN   = 50
+	defaultWindow = 7 * 24 * time.Hour
+	maxTopN       = 500
+	// scanFactor bounds how many distinct request bodies are read per popular query, since
+	// bodies differing only in spelling or unrelated fields merge into one query.
+	scanFactor = 20
+)
+
+var (
+	// ErrRunning is returned when a pass is requested while another is in progress.
+	ErrRunning = errors.New("cache warm already running")
+	// ErrCacheDisabled is returned when retrieval caching is off, so there is nothing to warm.
+	ErrCacheDisabled = errors.New("retrieval cache is disabled")
+)
+
+// Config controls which queries are warmed and how often.
+type Config struct {
+	// Interval is how often the scheduled pass runs. Zero disables the schedule; passes can
+	// still be triggered by admins.
+	Interval time.Duration
+	// TopN is how many popular queries each pass warms.
+	TopN int
+	// Window is how far back query logs are mined.
+	Window time.Duration
+}
+
+// Enabled reports whether scheduled warming is configured.
+func (c Config) Enabled() bool {
+	return c.Interval > 0
+}
+
+// ConfigFromEnv loads CACHE_WARM_INTERVAL, CACHE_WARM_TOP_N and CACHE_WARM_WINDOW.
+func ConfigFromEnv() Config {
+	cfg := Config{TopN: defaultTopN, Window: defaultWindow}
+
+	if interval, err := time.ParseDuration(os.Getenv("CACHE_WARM_INTERVAL")); err == nil && interval > 0 {
+		cfg.Interval = interval
+	}
+	if n, err := strconv.Atoi(os.Getenv("CACHE_WARM_TOP_N")); err == nil && n > 0 {
+		cfg.TopN = min(n, maxTopN)
+	}
+	if window, err := time.ParseDuration(os.Getenv("CACHE_WARM_WINDOW")); err == nil && window > 0 {
+		cfg.Window = window
+	}
+
+	return cfg
+}
+
+// Result summarises one warming pass.
+type Result struct {
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Warmed     int            `json:"warmed"`
+	Failed     int            `json:"failed"`
+	Error      string         `json:"error,omitempty"`
+	Queries    []PopularQuery `json:"queries"`
+}
+
+// Status reports the warmer's configuration and its most recent pass.
+type Status struct {
+	Scheduled bool    `json:"scheduled"`
+	Interval  string  `json:"interval,omitempty"`
+	Paused    bool    `json:"paused"`
+	Running   bool    `json:"running"`
+	TopN      int     `json:"top_n"`
+	Window    string  `json:"window"`
+	LastRun   *Result `json:"last_run,omitempty"`
+}
+
+// Warmer mines popular queries and fills the retrieval cache with their contexts. The
+// retriever and cache are resolved on every pass so overrides made after construction apply.
+type Warmer struct {
+	repo      *querylog.Repository
+	retriever func() (rag.Retriever, error)
+	cache     func() *cache.Cache
+
+	mu      sync.Mutex
+	cfg     Config
+	paused  bool
+	running bool
+	lastRun *Result
+}
+
+// NewWarmer constructs a warmer reading query logs from repo.
+func NewWarmer(repo *querylog.Repository, cfg Config, retriever func() (rag.Retriever, error), responseCache func() *cache.Cache) *Warmer {
+	if cfg.TopN <= 0 {
+		cfg.TopN = defaultTopN
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaultWindow
+	}
+	return &Warmer{repo: repo, cfg: cfg, retriever: retriever, cache: responseCache}
+}
+
+// Start runs scheduled passes in the background until the context is cancelled. The first
+// pass runs one interval after start, once the retrieval backend has had time to come up.
+func (w *Warmer) Start(ctx context.Context) {
+	if !w.cfg.Enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(w.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if w.Paused() {
+				continue
+			}
+			res, err := w.Warm(ctx)
+			switch {
+			case errors.Is(err, ErrRunning), errors.Is(err, ErrCacheDisabled):
+			case err != nil:
+				log.Printf("cachewarm: scheduled pass failed: %v", err)
+			default:
+				log.Printf("cachewarm: warmed %d of %d popular queries (%d failed)", res.Warmed, len(res.Queries), res.Failed)
+			}
+		}
+	}()
+}
+
+// Trigger starts a pass in the background and returns immediately.
+func (w *Warmer) Trigger() error {
+	if err := w.begin(); err != nil {
+		return err
+	}
+	go func() {
+		if _, err := w.run(context.Background()); err != nil {
+			log.Printf("cachewarm: triggered pass failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Warm runs a pass synchronously.
+func (w *Warmer) Warm(ctx context.Context) (*Result, error) {
+	if err := w.begin(); err != nil {
+		return nil, err
+	}
+	return w.run(ctx)
+}
+
+// Status returns the current configuration and the most recent pass.
+func (w *Warmer) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := Status{
+		Scheduled: w.cfg.Enabled(),
+		Paused:    w.paused,
+		Running:   w.running,
+		TopN:      w.cfg.TopN,
+		Window:    w.cfg.Window.String(),
+		LastRun:   w.lastRun,
+	}
+	if w.cfg.Enabled() {
+		status.Interval = w.cfg.Interval.String()
+	}
+	return status
+}
+
+// Paused reports whether scheduled passes are skipped.
+func (w *Warmer) Paused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.paused
+}
+
+// SetPaused pauses or resumes scheduled passes. Triggered passes still run while paused.
+func (w *Warmer) SetPaused(paused bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paused = paused
+}
+
+// SetTopN changes how many popular queries later passes warm.
+func (w *Warmer) SetTopN(n int) error {
+	if n <= 0 || n > maxTopN {
+		return fmt.Errorf("top_n must be between 1 and %d", maxTopN)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.cfg.TopN = n
+	return nil
+}
+
+func (w *Warmer) begin() error {
+	responseCache := w.cache()
+	if responseCache == nil || !responseCache.RetrievalEnabled() {
+		return ErrCacheDisabled
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running {
+		return ErrRunning
+	}
+	w.running = true
+	return nil
+}
+
+// run performs a pass claimed by begin and records its result.
+func (w *Warmer) run(ctx context.Context) (*Result, error) {
+	w.mu.Lock()
+	cfg := w.cfg
+	w.mu.Unlock()
+
+	result := &Result{StartedAt: time.Now().UTC(), Queries: []PopularQuery{}}
+	err := w.warm(ctx, cfg, result)
+	result.FinishedAt = time.Now().UTC()
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	w.mu.Lock()
+	w.running = false
+	w.lastRun = result
+	w.mu.Unlock()
+
+	return result, err
+}
+
+func (w *Warmer) warm(ctx context.Context, cfg Config, result *Result) error {
+	counts, err := w.repo.TopRequests(time.Now().UTC().Add(-cfg.Window), Endpoints, cfg.TopN*scanFactor)
+	if err != nil {
+		return err
+	}
+	result.Queries = rankPopularQueries(counts, cfg.TopN)
+	if len(result.Queries) == 0 {
+		return nil
+	}
+
+	retriever, err := w.retriever()
+	if err != nil {
+		return fmt.Errorf("initialize retriever: %w", err)
+	}
+	responseCache := w.cache()
+
+	for _, query := range result.Queries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		resp, err := retriever.RetrieveContext(ctx, query.Query, query.NResults, query.Filter)
+		if err != nil {
+			log.Printf("cachewarm: retrieval for %q failed: %v", query.Query, err)
+			result.Failed++
+			continue
+		}
+		responseCache.SetRetrieval(ctx, query.Query, query.NResults, query.Filter, resp)
+		result.Warmed++
+	}
+	return nil
+}
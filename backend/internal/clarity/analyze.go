@@ -0,0 +1,534 @@
+package clarity
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Checks that can be requested. Each names the diagnostic code it reports, except that
+// CheckUncheckedUnwrap also reports CodeUncheckedResponse.
+const (
+	CheckUnusedVariable       = "unused_variable"
+	CheckMissingPostCondition = "missing_post_condition"
+	CheckUnsafeTxSender       = "unsafe_tx_sender"
+	CheckUncheckedUnwrap      = "unchecked_unwrap"
+)
+
+// Checks lists every check, in the order they are documented.
+var Checks = []string{
+	CheckUnusedVariable,
+	CheckMissingPostCondition,
+	CheckUnsafeTxSender,
+	CheckUncheckedUnwrap,
+}
+
+// Diagnostic codes not named after their check.
+const (
+	CodeSyntaxError       = "syntax_error"
+	CodeUncheckedResponse = "unchecked_response"
+)
+
+// Severities of diagnostics.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// ErrUnknownCheck is returned when a requested check does not exist.
+var ErrUnknownCheck = errors.New("unknown check")
+
+// Diagnostic is one finding, located by the span of the offending expression.
+type Diagnostic struct {
+	Code     string   `json:"code"`
+	Severity string   `json:"severity"`
+	Message  string   `json:"message"`
+	Start    Position `json:"start"`
+	End      Position `json:"end"`
+	// Function is the function the finding is in, if any.
+	Function string `json:"function,omitempty"`
+	// Symbol is the variable, parameter or builtin the finding is about.
+	Symbol string `json:"symbol,omitempty"`
+}
+
+// String formats the diagnostic as "line:column severity code: message".
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d %s %s: %s", d.Start.Line, d.Start.Column, d.Severity, d.Code, d.Message)
+}
+
+// Summary counts diagnostics by severity.
+type Summary struct {
+	Errors   int `json:"errors"`
+	Warnings int `json:"warnings"`
+	Infos    int `json:"infos"`
+}
+
+// Result holds the diagnostics of a contract, ordered by position.
+type Result struct {
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	Summary     Summary      `json:"summary"`
+}
+
+// responseFunctions return a response that Clarity requires callers to check.
+var responseFunctions = map[string]bool{
+	"stx-transfer?":      true,
+	"stx-transfer-memo?": true,
+	"stx-burn?":          true,
+	"ft-transfer?":       true,
+	"ft-mint?":           true,
+	"ft-burn?":           true,
+	"nft-transfer?":      true,
+	"nft-mint?":          true,
+	"nft-burn?":          true,
+	"contract-call?":     true,
+}
+
+// transferAmountArg maps asset-moving builtins to the index of their amount argument.
+var transferAmountArg = map[string]int{
+	"stx-transfer?":      0,
+	"stx-transfer-memo?": 0,
+	"stx-burn?":          0,
+	"ft-transfer?":       1,
+	"ft-burn?":           1,
+}
+
+// Analyze parses src and runs the requested checks, or all of them when none are given.
+// Source that does not parse yields a single syntax_error diagnostic.
+func Analyze(src string, checks []string) (*Result, error) {
+	enabled := make(map[string]bool, len(Checks))
+	for _, check := range checks {
+		if !validCheck(check) {
+			return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownCheck, check, strings.Join(Checks, ", "))
+		}
+		enabled[check] = true
+	}
+	if len(enabled) == 0 {
+		for _, check := range Checks {
+			enabled[check] = true
+		}
+	}
+
+	a := &analyzer{enabled: enabled}
+	forms, err := Parse(src)
+	var syntaxErr *SyntaxError
+	switch {
+	case errors.As(err, &syntaxErr):
+		a.diags = append(a.diags, Diagnostic{
+			Code:     CodeSyntaxError,
+			Severity: SeverityError,
+			Message:  syntaxErr.Message,
+			Start:    syntaxErr.Pos,
+			End:      syntaxErr.Pos,
+		})
+	case err != nil:
+		return nil, err
+	default:
+		a.contract(forms)
+	}
+
+	return a.result(), nil
+}
+
+func validCheck(check string) bool {
+	for _, known := range Checks {
+		if check == known {
+			return true
+		}
+	}
+	return false
+}
+
+type analyzer struct {
+	enabled map[string]bool
+	diags   []Diagnostic
+
+	// State of the function being analyzed.
+	function    string
+	public      bool
+	params      map[string]bool
+	traitParams map[string]bool
+	asserted    map[string]bool
+	transfers   []transfer
+}
+
+// transfer is an asset-moving call whose amount is a parameter of the function.
+type transfer struct {
+	call  *Node
+	param string
+}
+
+func (a *analyzer) report(check string, d Diagnostic) {
+	if !a.enabled[check] {
+		return
+	}
+	if d.Function == "" {
+		d.Function = a.function
+	}
+	// Nested guards can reach the same expression twice.
+	for _, existing := range a.diags {
+		if existing == d {
+			return
+		}
+	}
+	a.diags = append(a.diags, d)
+}
+
+func (a *analyzer) result() *Result {
+	sort.SliceStable(a.diags, func(i, j int) bool {
+		if a.diags[i].Start.Line != a.diags[j].Start.Line {
+			return a.diags[i].Start.Line < a.diags[j].Start.Line
+		}
+		return a.diags[i].Start.Column < a.diags[j].Start.Column
+	})
+
+	result := &Result{Diagnostics: a.diags}
+	if result.Diagnostics == nil {
+		result.Diagnostics = []Diagnostic{}
+	}
+	for _, d := range result.Diagnostics {
+		switch d.Severity {
+		case SeverityError:
+			result.Summary.Errors++
+		case SeverityWarning:
+			result.Summary.Warnings++
+		default:
+			result.Summary.Infos++
+		}
+	}
+	return result
+}
+
+func (a *analyzer) contract(forms []*Node) {
+	for _, form := range forms {
+		switch form.Head() {
+		case "define-constant", "define-data-var", "define-map":
+			a.unusedDefinition(form, forms)
+			for _, arg := range form.Args() {
+				a.expr(arg)
+			}
+		case "define-public", "define-private", "define-read-only":
+			a.functionDefinition(form)
+		}
+	}
+}
+
+// unusedDefinition reports a constant, data variable or map no other form refers to.
+func (a *analyzer) unusedDefinition(form *Node, forms []*Node) {
+	args := form.Args()
+	if len(args) == 0 || args[0].Kind != AtomNode {
+		return
+	}
+	name := args[0]
+	if references(forms, name.Text, name) {
+		return
+	}
+
+	kind := strings.TrimPrefix(form.Head(), "define-")
+	a.report(CheckUnusedVariable, Diagnostic{
+		Code:     CheckUnusedVariable,
+		Severity: SeverityWarning,
+		Message:  fmt.Sprintf("%s %s is never used", strings.ReplaceAll(kind, "-", " "), name.Text),
+		Start:    name.Pos,
+		End:      name.End,
+		Symbol:   name.Text,
+	})
+}
+
+func (a *analyzer) functionDefinition(form *Node) {
+	args := form.Args()
+	if len(args) == 0 || args[0].Kind != ListNode || len(args[0].Children) == 0 {
+		return
+	}
+	signature, body := args[0], args[1:]
+
+	a.function = signature.Children[0].Text
+	a.public = form.Head() == "define-public"
+	a.params = make(map[string]bool)
+	a.traitParams = make(map[string]bool)
+	a.asserted = make(map[string]bool)
+	a.transfers = nil
+	defer func() { a.function, a.public, a.params, a.traitParams = "", false, nil, nil }()
+
+	for _, param := range signature.Children[1:] {
+		if param.Kind != ListNode || len(param.Children) < 2 || param.Children[0].Kind != AtomNode {
+			continue
+		}
+		name, typ := param.Children[0], param.Children[1]
+		a.params[name.Text] = true
+		if typ.Kind == AtomNode && strings.HasPrefix(typ.Text, "<") {
+			a.traitParams[name.Text] = true
+		}
+		if !references(body, name.Text, nil) {
+			a.report(CheckUnusedVariable, Diagnostic{
+				Code:     CheckUnusedVariable,
+				Severity: SeverityInfo,
+				Message:  fmt.Sprintf("parameter %s is never used", name.Text),
+				Start:    name.Pos,
+				End:      name.End,
+				Symbol:   name.Text,
+			})
+		}
+	}
+
+	for _, expr := range body {
+		a.expr(expr)
+	}
+
+	for _, t := range a.transfers {
+		if a.asserted[t.param] {
+			continue
+		}
+		a.report(CheckMissingPostCondition, Diagnostic{
+			Code:     CheckMissingPostCondition,
+			Severity: SeverityWarning,
+			Message: fmt.Sprintf("%s moves %s, a caller-supplied amount, without an asserts! bound on it; only the transaction's post-conditions limit the transfer",
+				t.call.Head(), t.param),
+			Start:  t.call.Pos,
+			End:    t.call.End,
+			Symbol: t.param,
+		})
+	}
+}
+
+// expr checks an expression and everything nested in it.
+func (a *analyzer) expr(n *Node) {
+	switch n.Kind {
+	case TupleNode:
+		for i := 1; i < len(n.Children); i += 2 {
+			a.expr(n.Children[i])
+		}
+		return
+	case ListNode:
+	default:
+		return
+	}
+
+	args := n.Args()
+	switch head := n.Head(); head {
+	case "let":
+		a.let(n)
+	case "begin":
+		a.discardedResponses(args)
+	case "match":
+		a.match(n)
+	case "unwrap-panic", "unwrap-err-panic":
+		a.report(CheckUncheckedUnwrap, Diagnostic{
+			Code:     CheckUncheckedUnwrap,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("%s aborts the transaction without an error code; use %s with an error value", head, strings.TrimSuffix(head, "-panic")+"!"),
+			Start:    n.Pos,
+			End:      n.End,
+			Symbol:   head,
+		})
+	case "asserts!", "if":
+		if len(args) > 0 {
+			a.condition(args[0])
+		}
+	case "as-contract":
+		a.asContract(n)
+	default:
+		if index, ok := transferAmountArg[head]; ok && a.public && index < len(args) {
+			if amount := args[index]; amount.Kind == AtomNode && a.params[amount.Text] {
+				a.transfers = append(a.transfers, transfer{call: n, param: amount.Text})
+			}
+		}
+	}
+
+	for _, child := range n.Children {
+		a.expr(child)
+	}
+}
+
+// let reports bindings that neither later bindings nor the body refer to.
+func (a *analyzer) let(n *Node) {
+	args := n.Args()
+	if len(args) == 0 || args[0].Kind != ListNode {
+		return
+	}
+	bindings, body := args[0].Children, args[1:]
+
+	for i, binding := range bindings {
+		if binding.Kind != ListNode || len(binding.Children) < 2 || binding.Children[0].Kind != AtomNode {
+			continue
+		}
+		name := binding.Children[0]
+		scope := append([]*Node{}, body...)
+		for _, later := range bindings[i+1:] {
+			if later.Kind == ListNode && len(later.Children) > 1 {
+				scope = append(scope, later.Children[1:]...)
+			}
+		}
+		if references(scope, name.Text, nil) {
+			continue
+		}
+		a.report(CheckUnusedVariable, Diagnostic{
+			Code:     CheckUnusedVariable,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("let binding %s is never used", name.Text),
+			Start:    name.Pos,
+			End:      name.End,
+			Symbol:   name.Text,
+		})
+	}
+
+	a.discardedResponses(body)
+}
+
+// match reports names bound by a match expression that their branch does not use.
+func (a *analyzer) match(n *Node) {
+	args := n.Args()
+	var bound []struct{ name, branch *Node }
+	switch len(args) {
+	case 4: // (match optional name some-branch none-branch)
+		bound = append(bound, struct{ name, branch *Node }{args[1], args[2]})
+	case 5: // (match response ok-name ok-branch err-name err-branch)
+		bound = append(bound,
+			struct{ name, branch *Node }{args[1], args[2]},
+			struct{ name, branch *Node }{args[3], args[4]})
+	}
+
+	for _, b := range bound {
+		if b.name.Kind != AtomNode || references([]*Node{b.branch}, b.name.Text, nil) {
+			continue
+		}
+		a.report(CheckUnusedVariable, Diagnostic{
+			Code:     CheckUnusedVariable,
+			Severity: SeverityInfo,
+			Message:  fmt.Sprintf("match binding %s is never used", b.name.Text),
+			Start:    b.name.Pos,
+			End:      b.name.End,
+			Symbol:   b.name.Text,
+		})
+	}
+}
+
+// discardedResponses reports responses computed in non-final positions of a body and never
+// checked. Clarity rejects such contracts.
+func (a *analyzer) discardedResponses(body []*Node) {
+	if len(body) < 2 {
+		return
+	}
+	for _, expr := range body[:len(body)-1] {
+		head := expr.Head()
+		if !responseFunctions[head] {
+			continue
+		}
+		a.report(CheckUncheckedUnwrap, Diagnostic{
+			Code:     CodeUncheckedResponse,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("the response of %s is discarded; wrap it in try! or unwrap!", head),
+			Start:    expr.Pos,
+			End:      expr.End,
+			Symbol:   head,
+		})
+	}
+}
+
+// condition records the parameters a guard checks and reports authorization by tx-sender.
+func (a *analyzer) condition(cond *Node) {
+	walk(cond, func(n *Node) {
+		if n.Kind == AtomNode && a.params[n.Text] {
+			a.asserted[n.Text] = true
+		}
+		if n.Head() != "is-eq" {
+			return
+		}
+		usesTxSender, direct := false, false
+		for _, arg := range n.Args() {
+			usesTxSender = usesTxSender || arg.IsAtom("tx-sender")
+			direct = direct || arg.IsAtom("contract-caller")
+		}
+		// (is-eq tx-sender contract-caller) ensures the caller is not a contract.
+		if !usesTxSender || direct {
+			return
+		}
+		a.report(CheckUnsafeTxSender, Diagnostic{
+			Code:     CheckUnsafeTxSender,
+			Severity: SeverityWarning,
+			Message:  "authorizes with tx-sender, which any contract the user calls can act as; compare contract-caller instead",
+			Start:    n.Pos,
+			End:      n.End,
+			Symbol:   "tx-sender",
+		})
+	})
+}
+
+// asContract reports calls to caller-supplied contracts made with the contract's authority.
+func (a *analyzer) asContract(n *Node) {
+	walk(n, func(call *Node) {
+		args := call.Args()
+		if call.Head() != "contract-call?" || len(args) == 0 || args[0].Kind != AtomNode || !a.traitParams[args[0].Text] {
+			return
+		}
+		a.report(CheckUnsafeTxSender, Diagnostic{
+			Code:     CheckUnsafeTxSender,
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("calls the caller-supplied contract %s inside as-contract, so it runs with this contract as tx-sender", args[0].Text),
+			Start:    call.Pos,
+			End:      call.End,
+			Symbol:   args[0].Text,
+		})
+	})
+}
+
+// walk calls fn on n and every node nested in it.
+func walk(n *Node, fn func(*Node)) {
+	fn(n)
+	for _, child := range n.Children {
+		walk(child, fn)
+	}
+}
+
+// references reports whether any of nodes refers to name, ignoring exclude and tuple keys.
+func references(nodes []*Node, name string, exclude *Node) bool {
+	for _, n := range nodes {
+		if refersTo(n, name, exclude) {
+			return true
+		}
+	}
+	return false
+}
+
+func refersTo(n *Node, name string, exclude *Node) bool {
+	if n == exclude {
+		return false
+	}
+	switch n.Kind {
+	case AtomNode:
+		return n.Text == name
+	case TupleNode:
+		for i := 1; i < len(n.Children); i += 2 {
+			if refersTo(n.Children[i], name, exclude) {
+				return true
+			}
+		}
+		return false
+	case ListNode:
+	default:
+		return false
+	}
+
+	for i, child := range n.Children {
+		switch n.Head() {
+		case "get":
+			// (get key tuple)
+			if i == 1 {
+				continue
+			}
+		case "tuple":
+			// (tuple (key value) ...)
+			if i > 0 && child.Kind == ListNode {
+				if references(child.Args(), name, exclude) {
+					return true
+				}
+				continue
+			}
+		}
+		if refersTo(child, name, exclude) {
+			return true
+		}
+	}
+	return false
+}
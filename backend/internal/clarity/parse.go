@@ -0,0 +1,290 @@
+// Package clarity parses Clarity smart contracts and statically checks them for common
+// mistakes.
+package clarity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeKind distinguishes the forms of the syntax tree.
+type NodeKind int
+
+const (
+	// ListNode is a parenthesized expression.
+	ListNode NodeKind = iota
+	// TupleNode is a {key: value, ...} literal. Its children alternate keys and values.
+	TupleNode
+	// AtomNode is an identifier, keyword, number, buffer or principal.
+	AtomNode
+	// StringNode is a string literal; Text holds its unescaped contents.
+	StringNode
+)
+
+// Position is a 1-based line and column in the source.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Node is a node of the syntax tree.
+type Node struct {
+	Kind     NodeKind
+	Text     string
+	Children []*Node
+	Pos      Position
+	End      Position
+}
+
+// Head returns the name of the function or keyword a list applies, or "".
+func (n *Node) Head() string {
+	if n.Kind != ListNode || len(n.Children) == 0 || n.Children[0].Kind != AtomNode {
+		return ""
+	}
+	return n.Children[0].Text
+}
+
+// Args returns the children of a list after its head.
+func (n *Node) Args() []*Node {
+	if n.Kind != ListNode || len(n.Children) == 0 {
+		return nil
+	}
+	return n.Children[1:]
+}
+
+// IsAtom reports whether n is the atom text.
+func (n *Node) IsAtom(text string) bool {
+	return n != nil && n.Kind == AtomNode && n.Text == text
+}
+
+// FunctionNames returns the names of the public, read-only and private functions defined by
+// the top-level forms, in source order.
+func FunctionNames(forms []*Node) []string {
+	var names []string
+	for _, form := range forms {
+		switch form.Head() {
+		case "define-public", "define-private", "define-read-only":
+			args := form.Args()
+			if len(args) == 0 || args[0].Kind != ListNode || len(args[0].Children) == 0 {
+				continue
+			}
+			if name := args[0].Children[0]; name.Kind == AtomNode {
+				names = append(names, name.Text)
+			}
+		}
+	}
+	return names
+}
+
+// SyntaxError reports source that cannot be parsed.
+type SyntaxError struct {
+	Pos     Position
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Column, e.Message)
+}
+
+// maxDepth bounds nesting so hostile input cannot exhaust the stack.
+const maxDepth = 256
+
+// Parse returns the top-level forms of a contract.
+func Parse(src string) ([]*Node, error) {
+	p := &parser{src: src, line: 1, col: 1}
+	var forms []*Node
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return forms, nil
+		}
+		node, err := p.node(0)
+		if err != nil {
+			return nil, err
+		}
+		forms = append(forms, node)
+	}
+}
+
+type parser struct {
+	src       string
+	off       int
+	line, col int
+}
+
+func (p *parser) eof() bool {
+	return p.off >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	return p.src[p.off]
+}
+
+func (p *parser) pos() Position {
+	return Position{Line: p.line, Column: p.col}
+}
+
+func (p *parser) advance() byte {
+	c := p.src[p.off]
+	p.off++
+	if c == '\n' {
+		p.line++
+		p.col = 1
+	} else if c < 0x80 || c >= 0xC0 {
+		// Count runes, not continuation bytes.
+		p.col++
+	}
+	return c
+}
+
+func (p *parser) errorf(pos Position, format string, args ...any) error {
+	return &SyntaxError{Pos: pos, Message: fmt.Sprintf(format, args...)}
+}
+
+// skipSpace skips whitespace and ;; comments.
+func (p *parser) skipSpace() {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ';':
+			for !p.eof() && p.peek() != '\n' {
+				p.advance()
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.advance()
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) node(depth int) (*Node, error) {
+	if depth > maxDepth {
+		return nil, p.errorf(p.pos(), "nested more than %d levels deep", maxDepth)
+	}
+
+	start := p.pos()
+	switch c := p.peek(); c {
+	case '(':
+		p.advance()
+		children, err := p.sequence(')', depth)
+		if err != nil {
+			return nil, err
+		}
+		return &Node{Kind: ListNode, Children: children, Pos: start, End: p.pos()}, nil
+	case '{':
+		p.advance()
+		return p.tuple(start, depth)
+	case ')', '}':
+		return nil, p.errorf(start, "unexpected %q", c)
+	case '"':
+		return p.str(start)
+	default:
+		return p.atom(start)
+	}
+}
+
+// sequence reads nodes up to and including the closing delimiter.
+func (p *parser) sequence(closing byte, depth int) ([]*Node, error) {
+	var children []*Node
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf(p.pos(), "missing %q", closing)
+		}
+		if p.peek() == closing {
+			p.advance()
+			return children, nil
+		}
+		child, err := p.node(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+}
+
+// tuple reads the rest of a {key: value, ...} literal.
+func (p *parser) tuple(start Position, depth int) (*Node, error) {
+	node := &Node{Kind: TupleNode, Pos: start}
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf(p.pos(), "missing '}'")
+		}
+		if p.peek() == '}' {
+			p.advance()
+			node.End = p.pos()
+			return node, nil
+		}
+
+		key, err := p.atom(p.pos())
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.eof() || p.peek() != ':' {
+			return nil, p.errorf(p.pos(), "expected ':' after tuple key %s", key.Text)
+		}
+		p.advance()
+		p.skipSpace()
+		if p.eof() {
+			return nil, p.errorf(p.pos(), "missing value for tuple key %s", key.Text)
+		}
+		value, err := p.node(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, key, value)
+
+		p.skipSpace()
+		if !p.eof() && p.peek() == ',' {
+			p.advance()
+		}
+	}
+}
+
+// str reads a string literal; a u"..." prefix has already been consumed by atom.
+func (p *parser) str(start Position) (*Node, error) {
+	p.advance()
+	var text strings.Builder
+	for {
+		if p.eof() {
+			return nil, p.errorf(start, "unterminated string")
+		}
+		c := p.advance()
+		switch c {
+		case '"':
+			return &Node{Kind: StringNode, Text: text.String(), Pos: start, End: p.pos()}, nil
+		case '\\':
+			if p.eof() {
+				return nil, p.errorf(start, "unterminated string")
+			}
+			text.WriteByte(p.advance())
+		default:
+			text.WriteByte(c)
+		}
+	}
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '(', ')', '{', '}', ',', ':', '"', ';':
+		return true
+	}
+	return false
+}
+
+func (p *parser) atom(start Position) (*Node, error) {
+	from := p.off
+	for !p.eof() && !isDelimiter(p.peek()) {
+		p.advance()
+	}
+	text := p.src[from:p.off]
+	if text == "u" && !p.eof() && p.peek() == '"' {
+		return p.str(start)
+	}
+	if text == "" {
+		return nil, p.errorf(start, "unexpected %q", p.peek())
+	}
+	return &Node{Kind: AtomNode, Text: text, Pos: start, End: p.pos()}, nil
+}
@@ -0,0 +1,440 @@
+package codegen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/openai/openai-go"
+	"google.golang.org/genai"
+)
+
+const (
+	defaultProviderMaxConcurrent = 16
+	defaultProviderQueueTimeout  = 10 * time.Second
+	defaultProviderTimeout       = 3 * time.Minute
+	defaultBreakerFailures       = 5
+	defaultBreakerCooldown       = 30 * time.Second
+
+	// providerMetricPrefix namespaces the provider guard metrics.
+	providerMetricPrefix = "stacks_builder_llm_"
+)
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+var (
+	// ErrProviderUnavailable is returned without calling the provider while its circuit
+	// breaker is open or all of its concurrency slots stay busy.
+	ErrProviderUnavailable = errors.New("provider temporarily unavailable")
+	// ErrProviderTimeout is returned when a provider call runs past its request timeout.
+	ErrProviderTimeout = errors.New("provider request timed out")
+)
+
+// ProviderUnavailableError explains why a provider call was rejected and when to retry.
+type ProviderUnavailableError struct {
+	Provider   string
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *ProviderUnavailableError) Error() string {
+	return fmt.Sprintf("%s is temporarily unavailable: %s", e.Provider, e.Reason)
+}
+
+func (e *ProviderUnavailableError) Unwrap() error {
+	return ErrProviderUnavailable
+}
+
+// providerEnvPrefix prefixes the per-provider overrides of LLM_MAX_CONCURRENT and
+// LLM_REQUEST_TIMEOUT, e.g. CLAUDE_MAX_CONCURRENT.
+var providerEnvPrefix = map[string]string{
+	ProviderGemini: "GEMINI_",
+	ProviderOpenAI: "OPENAI_",
+	ProviderClaude: "CLAUDE_",
+	ProviderLocal:  "LOCAL_LLM_",
+}
+
+// GuardConfig limits the calls made to one provider.
+type GuardConfig struct {
+	// MaxConcurrent bounds the calls in flight. Zero disables the limit.
+	MaxConcurrent int
+	// QueueTimeout is how long a call waits for a free slot before it is rejected.
+	QueueTimeout time.Duration
+	// Timeout bounds a single call, including a streamed response. Zero disables it.
+	Timeout time.Duration
+	// FailureThreshold is the number of consecutive failures that opens the breaker.
+	// Zero disables the breaker.
+	FailureThreshold int
+	// Cooldown is how long the breaker stays open before a probe call is let through.
+	Cooldown time.Duration
+}
+
+// GuardConfigFromEnv reads LLM_MAX_CONCURRENT, LLM_QUEUE_TIMEOUT, LLM_REQUEST_TIMEOUT,
+// LLM_BREAKER_FAILURES and LLM_BREAKER_COOLDOWN. The concurrency limit and timeout can be
+// set per provider, e.g. with LOCAL_LLM_MAX_CONCURRENT and LOCAL_LLM_REQUEST_TIMEOUT.
+func GuardConfigFromEnv(provider string) GuardConfig {
+	cfg := GuardConfig{
+		MaxConcurrent:    defaultProviderMaxConcurrent,
+		QueueTimeout:     defaultProviderQueueTimeout,
+		Timeout:          defaultProviderTimeout,
+		FailureThreshold: defaultBreakerFailures,
+		Cooldown:         defaultBreakerCooldown,
+	}
+	prefix := providerEnvPrefix[provider]
+
+	for _, key := range []string{"LLM_MAX_CONCURRENT", prefix + "MAX_CONCURRENT"} {
+		if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n >= 0 {
+			cfg.MaxConcurrent = n
+		}
+	}
+	if d, err := time.ParseDuration(os.Getenv("LLM_QUEUE_TIMEOUT")); err == nil && d >= 0 {
+		cfg.QueueTimeout = d
+	}
+	for _, key := range []string{"LLM_REQUEST_TIMEOUT", prefix + "REQUEST_TIMEOUT"} {
+		if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d >= 0 {
+			cfg.Timeout = d
+		}
+	}
+	if n, err := strconv.Atoi(os.Getenv("LLM_BREAKER_FAILURES")); err == nil && n >= 0 {
+		cfg.FailureThreshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LLM_BREAKER_COOLDOWN")); err == nil && d > 0 {
+		cfg.Cooldown = d
+	}
+	return cfg
+}
+
+// ProviderGuardStats is a point-in-time view of a provider's limits and breaker.
+type ProviderGuardStats struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	// ConsecutiveFailures counts the failures since the last successful call.
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	// RetryAt is when an open breaker lets a probe call through.
+	RetryAt       *time.Time `json:"retry_at,omitempty"`
+	InFlight      int        `json:"in_flight"`
+	MaxConcurrent int        `json:"max_concurrent"`
+	Requests      int64      `json:"requests"`
+	Failures      int64      `json:"failures"`
+	Timeouts      int64      `json:"timeouts"`
+	RejectedOpen  int64      `json:"rejected_open"`
+	RejectedBusy  int64      `json:"rejected_busy"`
+	Trips         int64      `json:"trips"`
+	LastError     string     `json:"last_error,omitempty"`
+}
+
+// providerGuard applies a provider's concurrency limit, request timeout and circuit breaker.
+// It is shared by every service of the provider, whatever its model.
+type providerGuard struct {
+	provider string
+	cfg      GuardConfig
+	// slots holds a token per call in flight; nil when concurrency is unlimited.
+	slots chan struct{}
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	// probing is set while the half-open breaker's probe call runs.
+	probing   bool
+	inFlight  int
+	lastError string
+
+	requests, failed, timeouts, rejectedOpen, rejectedBusy, trips int64
+}
+
+var (
+	guardsMu sync.Mutex
+	guards   = make(map[string]*providerGuard)
+)
+
+// guardFor returns the provider's guard, configured from the environment on first use.
+func guardFor(provider string) *providerGuard {
+	guardsMu.Lock()
+	defer guardsMu.Unlock()
+	g, ok := guards[provider]
+	if !ok {
+		g = newProviderGuard(provider, GuardConfigFromEnv(provider))
+		guards[provider] = g
+	}
+	return g
+}
+
+func newProviderGuard(provider string, cfg GuardConfig) *providerGuard {
+	g := &providerGuard{provider: provider, cfg: cfg, state: BreakerClosed}
+	if cfg.MaxConcurrent > 0 {
+		g.slots = make(chan struct{}, cfg.MaxConcurrent)
+	}
+	return g
+}
+
+// callProvider runs fn through the provider's guard. fn receives a context bounded by the
+// request timeout.
+func callProvider(ctx context.Context, provider string, fn func(context.Context) error) error {
+	return guardFor(provider).call(ctx, fn)
+}
+
+// callProviderValue is callProvider for calls returning a value.
+func callProviderValue[T any](ctx context.Context, provider string, fn func(context.Context) (T, error)) (T, error) {
+	var value T
+	err := callProvider(ctx, provider, func(ctx context.Context) error {
+		var err error
+		value, err = fn(ctx)
+		return err
+	})
+	return value, err
+}
+
+func (g *providerGuard) call(ctx context.Context, fn func(context.Context) error) error {
+	probe, err := g.admit()
+	if err != nil {
+		return err
+	}
+	if err := g.acquire(ctx); err != nil {
+		g.abandon(probe)
+		return err
+	}
+	defer g.release()
+
+	callCtx := ctx
+	if g.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, g.cfg.Timeout)
+		defer cancel()
+	}
+	err = fn(callCtx)
+
+	// Calls the caller gave up on say nothing about the provider.
+	cancelled := err != nil && ctx.Err() != nil
+	timedOut := err != nil && !cancelled && errors.Is(callCtx.Err(), context.DeadlineExceeded)
+	if timedOut {
+		err = fmt.Errorf("%w after %s", ErrProviderTimeout, g.cfg.Timeout)
+	}
+	g.record(probe, err, cancelled, timedOut)
+	return err
+}
+
+// admit checks the breaker. While it is open, calls are rejected until the cooldown has
+// passed; then a single probe call is let through, reported by the first result.
+func (g *providerGuard) admit() (bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.requests++
+
+	if g.state == BreakerOpen {
+		if wait := g.cfg.Cooldown - time.Since(g.openedAt); wait > 0 {
+			g.rejectedOpen++
+			return false, g.unavailable("circuit breaker is open after repeated failures", wait)
+		}
+		g.state = BreakerHalfOpen
+	}
+	if g.state == BreakerHalfOpen {
+		if g.probing {
+			g.rejectedOpen++
+			return false, g.unavailable("circuit breaker is testing the provider", time.Second)
+		}
+		g.probing = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// acquire waits up to QueueTimeout for a concurrency slot.
+func (g *providerGuard) acquire(ctx context.Context) error {
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		default:
+			timer := time.NewTimer(g.cfg.QueueTimeout)
+			defer timer.Stop()
+			select {
+			case g.slots <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C:
+				g.mu.Lock()
+				g.rejectedBusy++
+				g.mu.Unlock()
+				return g.unavailable(fmt.Sprintf("all %d concurrent request slots are busy", g.cfg.MaxConcurrent), time.Second)
+			}
+		}
+	}
+	g.mu.Lock()
+	g.inFlight++
+	g.mu.Unlock()
+	return nil
+}
+
+func (g *providerGuard) release() {
+	g.mu.Lock()
+	g.inFlight--
+	g.mu.Unlock()
+	if g.slots != nil {
+		<-g.slots
+	}
+}
+
+// abandon gives up a probe that never reached the provider.
+func (g *providerGuard) abandon(probe bool) {
+	if !probe {
+		return
+	}
+	g.mu.Lock()
+	g.probing = false
+	g.mu.Unlock()
+}
+
+// record updates the breaker with a call's outcome. Provider failures count towards opening
+// it; any other answer from the provider closes it.
+func (g *providerGuard) record(probe bool, err error, cancelled, timedOut bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if probe {
+		g.probing = false
+	}
+	if cancelled {
+		return
+	}
+	if !timedOut && !providerFailure(err) {
+		if g.state != BreakerClosed && (probe || err == nil) {
+			log.Printf("codegen: %s circuit breaker closed", g.provider)
+		}
+		if probe || g.state == BreakerClosed || err == nil {
+			g.state, g.failures = BreakerClosed, 0
+		}
+		return
+	}
+
+	g.failed++
+	if timedOut {
+		g.timeouts++
+	}
+	g.failures++
+	g.lastError = err.Error()
+	if g.cfg.FailureThreshold <= 0 {
+		return
+	}
+	if probe || (g.state == BreakerClosed && g.failures >= g.cfg.FailureThreshold) {
+		g.state, g.openedAt = BreakerOpen, time.Now()
+		g.trips++
+		log.Printf("codegen: %s circuit breaker opened after %d consecutive failures: %v", g.provider, g.failures, err)
+	}
+}
+
+func (g *providerGuard) unavailable(reason string, retryAfter time.Duration) error {
+	return &ProviderUnavailableError{Provider: g.provider, Reason: reason, RetryAfter: retryAfter}
+}
+
+// providerFailure reports whether err means the provider is failing rather than rejecting
+// the request: server errors, rate limiting and errors without an HTTP status, such as
+// refused connections.
+func providerFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	status := 0
+	var (
+		openaiErr    *openai.Error
+		anthropicErr *anthropic.Error
+		geminiErr    genai.APIError
+		geminiErrPtr *genai.APIError
+	)
+	switch {
+	case errors.As(err, &openaiErr):
+		status = openaiErr.StatusCode
+	case errors.As(err, &anthropicErr):
+		status = anthropicErr.StatusCode
+	case errors.As(err, &geminiErr):
+		status = geminiErr.Code
+	case errors.As(err, &geminiErrPtr):
+		status = geminiErrPtr.Code
+	default:
+		return true
+	}
+	return status >= 500 || status == http.StatusTooManyRequests || status == http.StatusRequestTimeout
+}
+
+func (g *providerGuard) stats() ProviderGuardStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stats := ProviderGuardStats{
+		Provider:            g.provider,
+		State:               g.state,
+		ConsecutiveFailures: g.failures,
+		InFlight:            g.inFlight,
+		MaxConcurrent:       g.cfg.MaxConcurrent,
+		Requests:            g.requests,
+		Failures:            g.failed,
+		Timeouts:            g.timeouts,
+		RejectedOpen:        g.rejectedOpen,
+		RejectedBusy:        g.rejectedBusy,
+		Trips:               g.trips,
+		LastError:           g.lastError,
+	}
+	if g.state != BreakerClosed {
+		openedAt, retryAt := g.openedAt.UTC(), g.openedAt.Add(g.cfg.Cooldown).UTC()
+		stats.OpenedAt, stats.RetryAt = &openedAt, &retryAt
+		// The breaker moves to half-open lazily, on the first call after the cooldown.
+		if g.state == BreakerOpen && !time.Now().Before(retryAt) {
+			stats.State = BreakerHalfOpen
+		}
+	}
+	return stats
+}
+
+// ProviderGuards returns the limits and breaker state of every provider.
+func ProviderGuards() []ProviderGuardStats {
+	providers := []string{ProviderGemini, ProviderOpenAI, ProviderClaude, ProviderLocal}
+	stats := make([]ProviderGuardStats, 0, len(providers))
+	for _, provider := range providers {
+		stats = append(stats, guardFor(provider).stats())
+	}
+	return stats
+}
+
+// WriteProviderMetrics writes the provider guard gauges and counters in the Prometheus text
+// exposition format, labelled by provider.
+func WriteProviderMetrics(w io.Writer) error {
+	stats := ProviderGuards()
+	breakerState := map[string]float64{BreakerClosed: 0, BreakerHalfOpen: 1, BreakerOpen: 2}
+	metrics := []struct {
+		name, kind, help string
+		value            func(ProviderGuardStats) float64
+	}{
+		{"breaker_state", "gauge", "Circuit breaker state: 0 closed, 1 half-open, 2 open.", func(s ProviderGuardStats) float64 { return breakerState[s.State] }},
+		{"breaker_consecutive_failures", "gauge", "Provider failures since the last successful call.", func(s ProviderGuardStats) float64 { return float64(s.ConsecutiveFailures) }},
+		{"breaker_trips_total", "counter", "Times the circuit breaker opened.", func(s ProviderGuardStats) float64 { return float64(s.Trips) }},
+		{"requests_in_flight", "gauge", "Provider calls in flight.", func(s ProviderGuardStats) float64 { return float64(s.InFlight) }},
+		{"max_concurrent_requests", "gauge", "Concurrency limit; 0 is unlimited.", func(s ProviderGuardStats) float64 { return float64(s.MaxConcurrent) }},
+		{"requests_total", "counter", "Provider calls attempted, including rejected ones.", func(s ProviderGuardStats) float64 { return float64(s.Requests) }},
+		{"failures_total", "counter", "Provider calls that failed, including timeouts.", func(s ProviderGuardStats) float64 { return float64(s.Failures) }},
+		{"timeouts_total", "counter", "Provider calls that ran past the request timeout.", func(s ProviderGuardStats) float64 { return float64(s.Timeouts) }},
+		{"rejected_open_total", "counter", "Calls rejected because the circuit breaker was open.", func(s ProviderGuardStats) float64 { return float64(s.RejectedOpen) }},
+		{"rejected_busy_total", "counter", "Calls rejected because every concurrency slot stayed busy.", func(s ProviderGuardStats) float64 { return float64(s.RejectedBusy) }},
+	}
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %[1]s%[2]s %[3]s\n# TYPE %[1]s%[2]s %[4]s\n", providerMetricPrefix, m.name, m.help, m.kind); err != nil {
+			return err
+		}
+		for _, s := range stats {
+			if _, err := fmt.Fprintf(w, "%s%s{provider=%q} %g\n", providerMetricPrefix, m.name, s.Provider, m.value(s)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package codegen
+
+// Citation identifies a retrieved chunk that was supplied to the model as context.
+type Citation struct {
+	// ID is the chunk's document id in its collection.
+	ID string `json:"id,omitempty"`
+	// Collection is "code" or "docs".
+	Collection string `json:"collection"`
+	Repo       string `json:"repo,omitempty"`
+	FilePath   string `json:"file_path,omitempty"`
+	URL        string `json:"url,omitempty"`
+	// Contract and Function locate a code chunk within its Clarity contract.
+	Contract string `json:"contract,omitempty"`
+	Function string `json:"function,omitempty"`
+	// Similarity is 1 - Distance, clamped to [0, 1]; higher is more relevant.
+	Similarity float64 `json:"similarity"`
+	Distance   float64 `json:"distance"`
+}
+
+// SimilarityFromDistance converts a cosine distance to a similarity score in [0, 1].
+func SimilarityFromDistance(distance float64) float64 {
+	return min(max(1-distance, 0), 1)
+}
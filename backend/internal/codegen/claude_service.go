@@ -4,16 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
 )
 
 const (
-	defaultClaudeModel         = "claude-sonnet-4-5-20250514"
-	defaultClaudeSystemMessage = "You are an expert Clarity programmer."
-	defaultClaudeMaxTokens     = 4096
-	defaultClaudeTemperature   = 0.7
+	defaultClaudeModel     = "claude-sonnet-4-5-20250514"
+	defaultClaudeMaxTokens = 4096
 )
 
 // ClaudeService handles code generation using Anthropic Claude API.
@@ -24,13 +23,11 @@ type ClaudeService struct {
 }
 
 // NewClaudeService creates a new Claude service instance.
+// An empty systemMessage defers to the deployment prompt configuration at request time.
 func NewClaudeService(apiKey, model, baseURL, apiVersion, systemMessage string) *ClaudeService {
 	if model == "" {
 		model = defaultClaudeModel
 	}
-	if systemMessage == "" {
-		systemMessage = defaultClaudeSystemMessage
-	}
 
 	// Build client options
 	opts := []option.RequestOption{
@@ -65,29 +62,40 @@ func NewClaudeServiceFromEnv() (*ClaudeService, error) {
 	model := os.Getenv("CLAUDE_MODEL")
 	baseURL := os.Getenv("CLAUDE_BASE_URL")
 	apiVersion := os.Getenv("CLAUDE_API_VERSION")
-	systemMessage := os.Getenv("CLAUDE_SYSTEM_MESSAGE")
 
-	return NewClaudeService(apiKey, model, baseURL, apiVersion, systemMessage), nil
+	// CLAUDE_SYSTEM_MESSAGE is applied through PromptConfigFromEnv so admins can edit it at runtime.
+	return NewClaudeService(apiKey, model, baseURL, apiVersion, ""), nil
 }
 
 // GenerateCode calls Anthropic Claude API to generate code with provided contexts.
 func (s *ClaudeService) GenerateCode(ctx context.Context, query string, codeContexts []string, docContexts []string, temperature float64, maxTokens int) (*CodeGenerationResponse, error) {
-	if temperature == 0 {
-		temperature = defaultClaudeTemperature
-	}
+	return s.GenerateCodeStream(ctx, query, codeContexts, docContexts, temperature, maxTokens, nil)
+}
+
+// GenerateCodeStream is GenerateCode that also reports text deltas as they arrive.
+func (s *ClaudeService) GenerateCodeStream(ctx context.Context, query string, codeContexts []string, docContexts []string, temperature float64, maxTokens int, onDelta DeltaFunc) (*CodeGenerationResponse, error) {
+	temperature = defaultTemperature(temperature)
 	if maxTokens == 0 {
 		maxTokens = defaultClaudeMaxTokens
 	}
 
-	prompt := buildCodeGenerationInstruction(query, codeContexts, docContexts)
+	codeContexts, docContexts, contextTrimmed := fitToContextWindow(s.model, query, codeContexts, docContexts, maxTokens)
+	prompt, err := buildCodeGenerationPrompt(ctx, ProviderClaude, query, codeContexts, docContexts)
+	if err != nil {
+		return nil, err
+	}
+
+	systemMessage := s.systemMessage
+	if systemMessage == "" {
+		systemMessage = SystemMessage(ProviderClaude)
+	}
 
-	// Create message using SDK types
-	message, err := s.client.Messages.New(ctx, anthropic.MessageNewParams{
+	params := anthropic.MessageNewParams{
 		Model:       anthropic.Model(s.model),
 		MaxTokens:   int64(maxTokens),
 		Temperature: anthropic.Float(temperature),
 		System: []anthropic.TextBlockParam{
-			{Text: s.systemMessage},
+			{Text: systemMessage},
 		},
 		Messages: []anthropic.MessageParam{
 			{
@@ -101,22 +109,45 @@ func (s *ClaudeService) GenerateCode(ctx context.Context, query string, codeCont
 				},
 			},
 		},
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate code with Claude: %w", err)
+	}
+	if tools, ok := ToolsFromContext(ctx); ok {
+		applyClaudeTools(&params, tools)
 	}
 
-	// Extract text from response
-	var assistantText string
-	for _, block := range message.Content {
-		// Use type assertion to check for TextBlock
-		if textBlock, ok := block.AsAny().(anthropic.TextBlock); ok {
-			assistantText += textBlock.Text
+	// Stream the message so partial output survives a cancelled request
+	var (
+		message       anthropic.Message
+		assistantText string
+		accumulateErr error
+	)
+	err = callProvider(ctx, ProviderClaude, func(ctx context.Context) error {
+		stream := s.client.Messages.NewStreaming(ctx, params)
+		defer stream.Close()
+		for stream.Next() {
+			event := stream.Current()
+			if accumulateErr = message.Accumulate(event); accumulateErr != nil {
+				return nil
+			}
+			if delta, ok := event.AsAny().(anthropic.ContentBlockDeltaEvent); ok {
+				if text, ok := delta.Delta.AsAny().(anthropic.TextDelta); ok {
+					assistantText += text.Text
+					if onDelta != nil && text.Text != "" {
+						onDelta(text.Text)
+					}
+				}
+			}
 		}
+		return stream.Err()
+	})
+	if err != nil {
+		return nil, interruption(ctx, assistantText, fmt.Errorf("failed to generate code with Claude: %w", err))
+	}
+	if accumulateErr != nil {
+		return nil, fmt.Errorf("failed to accumulate Claude stream: %w", accumulateErr)
 	}
 
-	if assistantText == "" {
+	toolCalls := claudeToolCalls(message.Content)
+	if assistantText == "" && len(toolCalls) == 0 {
 		return nil, fmt.Errorf("claude response contained no text content")
 	}
 
@@ -128,10 +159,176 @@ func (s *ClaudeService) GenerateCode(ctx context.Context, query string, codeCont
 
 	explanation := removeCodeBlocks(assistantText)
 
-	return &CodeGenerationResponse{
+	response := &CodeGenerationResponse{
 		Code:         code,
 		Explanation:  explanation,
+		Text:         assistantText,
 		InputTokens:  int(message.Usage.InputTokens),
 		OutputTokens: int(message.Usage.OutputTokens),
-	}, nil
+		Model:        s.model,
+		ToolCalls:    toolCalls,
+	}
+	fillMissingUsage(response, systemMessage, prompt)
+	applyStructuredOutput(ctx, ProviderClaude, response)
+	finalizeResponse(response, message.StopReason == anthropic.StopReasonMaxTokens, contextTrimmed)
+
+	return response, nil
+}
+
+// applyClaudeTools offers the tools to the model and appends earlier tool rounds after the prompt.
+func applyClaudeTools(params *anthropic.MessageNewParams, tools ToolRequest) {
+	for _, tool := range tools.Tools {
+		schema := anthropic.ToolInputSchemaParam{ExtraFields: map[string]any{}}
+		for key, value := range tool.Parameters {
+			switch key {
+			case "type":
+			case "properties":
+				schema.Properties = value
+			case "required":
+				schema.Required = toStringSlice(value)
+			default:
+				schema.ExtraFields[key] = value
+			}
+		}
+		claudeTool := anthropic.ToolParam{Name: tool.Name, InputSchema: schema}
+		if tool.Description != "" {
+			claudeTool.Description = anthropic.String(tool.Description)
+		}
+		params.Tools = append(params.Tools, anthropic.ToolUnionParam{OfTool: &claudeTool})
+	}
+
+	if len(tools.Tools) > 0 {
+		switch tools.Choice.Mode {
+		case ToolChoiceAuto:
+			params.ToolChoice = anthropic.ToolChoiceUnionParam{OfAuto: &anthropic.ToolChoiceAutoParam{}}
+		case ToolChoiceNone:
+			params.ToolChoice = anthropic.ToolChoiceUnionParam{OfNone: &anthropic.ToolChoiceNoneParam{}}
+		case ToolChoiceRequired:
+			params.ToolChoice = anthropic.ToolChoiceUnionParam{OfAny: &anthropic.ToolChoiceAnyParam{}}
+		case ToolChoiceFunction:
+			params.ToolChoice = anthropic.ToolChoiceUnionParam{OfTool: &anthropic.ToolChoiceToolParam{Name: tools.Choice.Name}}
+		}
+	}
+
+	for _, turn := range tools.Turns {
+		var calls, results []anthropic.ContentBlockParamUnion
+		if turn.Text != "" {
+			calls = append(calls, anthropic.NewTextBlock(turn.Text))
+		}
+		for _, call := range turn.Calls {
+			calls = append(calls, anthropic.NewToolUseBlock(call.ID, toolArguments(call.Arguments), call.Name))
+		}
+		for _, result := range turn.Results {
+			results = append(results, anthropic.NewToolResultBlock(result.CallID, result.Content, false))
+		}
+		params.Messages = append(params.Messages, anthropic.NewAssistantMessage(calls...), anthropic.NewUserMessage(results...))
+	}
+}
+
+func claudeToolCalls(blocks []anthropic.ContentBlockUnion) []ToolCall {
+	var toolCalls []ToolCall
+	for _, block := range blocks {
+		if block.Type != "tool_use" {
+			continue
+		}
+		arguments := string(block.Input)
+		if arguments == "" {
+			arguments = "{}"
+		}
+		toolCalls = append(toolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: arguments})
+	}
+	return toolCalls
+}
+
+// Summarize condenses conversation history with a plain completion.
+func (s *ClaudeService) Summarize(ctx context.Context, previousSummary, transcript string) (string, error) {
+	message, err := callProviderValue(ctx, ProviderClaude, func(ctx context.Context) (*anthropic.Message, error) {
+		return s.client.Messages.New(ctx, anthropic.MessageNewParams{
+			Model:       anthropic.Model(s.model),
+			MaxTokens:   summaryMaxTokens,
+			Temperature: anthropic.Float(summaryTemperature),
+			System: []anthropic.TextBlockParam{
+				{Text: summarySystemMessage},
+			},
+			Messages: []anthropic.MessageParam{
+				anthropic.NewUserMessage(anthropic.NewTextBlock(buildSummaryPrompt(previousSummary, transcript))),
+			},
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("claude summarization failed: %w", err)
+	}
+
+	var text strings.Builder
+	for _, block := range message.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return strings.TrimSpace(text.String()), nil
+}
+
+// RewriteQuery condenses the conversation history and a follow-up into a standalone
+// retrieval query.
+func (s *ClaudeService) RewriteQuery(ctx context.Context, history, query string) (string, error) {
+	message, err := callProviderValue(ctx, ProviderClaude, func(ctx context.Context) (*anthropic.Message, error) {
+		return s.client.Messages.New(ctx, anthropic.MessageNewParams{
+			Model:       anthropic.Model(s.model),
+			MaxTokens:   rewriteMaxTokens,
+			Temperature: anthropic.Float(rewriteTemperature),
+			System: []anthropic.TextBlockParam{
+				{Text: rewriteSystemMessage},
+			},
+			Messages: []anthropic.MessageParam{
+				anthropic.NewUserMessage(anthropic.NewTextBlock(buildRewritePrompt(history, query))),
+			},
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("claude query rewrite failed: %w", err)
+	}
+
+	var text strings.Builder
+	for _, block := range message.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return cleanRewrittenQuery(text.String()), nil
+}
+
+// GenerateTitle names a conversation from its first user message.
+func (s *ClaudeService) GenerateTitle(ctx context.Context, message string) (string, error) {
+	reply, err := callProviderValue(ctx, ProviderClaude, func(ctx context.Context) (*anthropic.Message, error) {
+		return s.client.Messages.New(ctx, anthropic.MessageNewParams{
+			Model:       anthropic.Model(s.model),
+			MaxTokens:   titleMaxTokens,
+			Temperature: anthropic.Float(titleTemperature),
+			System: []anthropic.TextBlockParam{
+				{Text: titleSystemMessage},
+			},
+			Messages: []anthropic.MessageParam{
+				anthropic.NewUserMessage(anthropic.NewTextBlock(buildTitlePrompt(message))),
+			},
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("claude title generation failed: %w", err)
+	}
+
+	var text strings.Builder
+	for _, block := range reply.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	return cleanTitle(text.String()), nil
+}
+
+// HealthCheck verifies the API key by looking up the configured model.
+func (s *ClaudeService) HealthCheck(ctx context.Context) error {
+	if _, err := s.client.Models.Get(ctx, s.model, anthropic.ModelGetParams{}); err != nil {
+		return fmt.Errorf("claude model lookup failed: %w", err)
+	}
+	return nil
 }
@@ -2,8 +2,8 @@ package codegen
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"strings"
 
@@ -18,6 +18,7 @@ const (
 // GeminiService handles code generation using Gemini API
 type GeminiService struct {
 	client *genai.Client
+	model  string
 }
 
 // NewGeminiService creates a new Gemini service
@@ -31,7 +32,7 @@ func NewGeminiService(apiKey string) (*GeminiService, error) {
 		return nil, fmt.Errorf("failed to create genai client: %w", err)
 	}
 
-	return &GeminiService{client: client}, nil
+	return &GeminiService{client: client, model: defaultGeminiModel}, nil
 }
 
 // NewGeminiServiceFromEnv creates a new Gemini service using environment variables
@@ -41,72 +42,182 @@ func NewGeminiServiceFromEnv() (*GeminiService, error) {
 		return nil, fmt.Errorf("GEMINI_API_KEY environment variable not set")
 	}
 
-	return NewGeminiService(apiKey)
+	service, err := NewGeminiService(apiKey)
+	if err != nil {
+		return nil, err
+	}
+	if model := os.Getenv("GEMINI_MODEL"); model != "" {
+		service.model = model
+	}
+	return service, nil
 }
 
 // GenerateCode generates Clarity code using Gemini with provided context
 func (s *GeminiService) GenerateCode(ctx context.Context, query string, codeContexts []string, docContexts []string, temperature float64, maxTokens int) (*CodeGenerationResponse, error) {
-	// Assemble prompt with context
-	prompt := buildCodeGenerationInstruction(query, codeContexts, docContexts)
+	return s.GenerateCodeStream(ctx, query, codeContexts, docContexts, temperature, maxTokens, nil)
+}
 
+// GenerateCodeStream is GenerateCode that also reports text deltas as they arrive.
+func (s *GeminiService) GenerateCodeStream(ctx context.Context, query string, codeContexts []string, docContexts []string, temperature float64, maxTokens int, onDelta DeltaFunc) (*CodeGenerationResponse, error) {
 	// Set defaults
-	if temperature == 0 {
-		temperature = 0.7
-	}
+	temperature = defaultTemperature(temperature)
 	if maxTokens == 0 {
 		maxTokens = defaultGeminiMaxTokens
 	}
 
-	// Count input tokens
-	inputTokenCount, err := s.countTokens(ctx, prompt)
+	// Assemble prompt with as much retrieved context as the model can take
+	codeContexts, docContexts, contextTrimmed := fitToContextWindow(s.model, query, codeContexts, docContexts, maxTokens)
+	prompt, err := buildCodeGenerationPrompt(ctx, ProviderGemini, query, codeContexts, docContexts)
 	if err != nil {
-		log.Printf("Warning: failed to count input tokens: %v", err)
-		inputTokenCount = 0 // fallback to 0 if counting fails
+		return nil, err
 	}
 
 	// Call Gemini API
-	geminiResponse, err := s.callGemini(ctx, prompt, temperature, maxTokens)
+	geminiResponse, toolCalls, finishReason, usage, err := s.callGemini(ctx, prompt, temperature, maxTokens, onDelta)
 	if err != nil {
+		var interrupted *InterruptedError
+		if errors.As(err, &interrupted) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to call Gemini API: %w", err)
 	}
 
-	// Count output tokens
-	outputTokenCount, err := s.countTokens(ctx, geminiResponse)
-	if err != nil {
-		log.Printf("Warning: failed to count output tokens: %v", err)
-		outputTokenCount = 0
-	}
-
 	// Parse and return response
 	parsedResponse, err := s.parseGeminiResponse(geminiResponse)
 	if err != nil {
 		return nil, err
 	}
 
-	// Add token counts
-	parsedResponse.InputTokens = inputTokenCount
-	parsedResponse.OutputTokens = outputTokenCount
+	// Use the usage Gemini reports with the final chunk; thinking tokens are billed as output.
+	// Without it, estimate locally rather than spend CountTokens calls on every request.
+	parsedResponse.Text = geminiResponse
+	if usage != nil {
+		parsedResponse.InputTokens = int(usage.PromptTokenCount)
+		parsedResponse.OutputTokens = int(usage.CandidatesTokenCount + usage.ThoughtsTokenCount)
+	}
+	fillMissingUsage(parsedResponse, SystemMessage(ProviderGemini), prompt)
+	parsedResponse.Model = s.model
+	parsedResponse.ToolCalls = toolCalls
+	applyStructuredOutput(ctx, ProviderGemini, parsedResponse)
+	finalizeResponse(parsedResponse, finishReason == genai.FinishReasonMaxTokens, contextTrimmed)
 
 	return parsedResponse, nil
 }
 
 // callGemini calls the Gemini API using the go-genai SDK
-func (s *GeminiService) callGemini(ctx context.Context, prompt string, temperature float64, maxTokens int) (string, error) {
+// It also returns any function calls and the usage metadata from the final chunk, if the API reported any.
+func (s *GeminiService) callGemini(ctx context.Context, prompt string, temperature float64, maxTokens int, onDelta DeltaFunc) (string, []ToolCall, genai.FinishReason, *genai.GenerateContentResponseUsageMetadata, error) {
 	config := &genai.GenerateContentConfig{
-		Temperature:     genai.Ptr(float32(temperature)),
+		Temperature:       genai.Ptr(float32(temperature)),
+		SystemInstruction: genai.NewContentFromText(SystemMessage(ProviderGemini), genai.RoleUser),
+	}
+	contents := genai.Text(prompt)
+	if tools, ok := ToolsFromContext(ctx); ok {
+		contents = applyGeminiTools(config, contents, tools)
+	}
+	if structuredOutputActive(ctx, ProviderGemini) {
+		config.ResponseMIMEType = "application/json"
+		config.ResponseJsonSchema = structuredOutputSchema
 	}
 
-	result, err := s.client.Models.GenerateContent(
-		ctx,
-		defaultGeminiModel,
-		genai.Text(prompt),
-		config,
+	// Stream the response so partial output survives a cancelled request
+	var (
+		text         strings.Builder
+		toolCalls    []ToolCall
+		finishReason genai.FinishReason
+		usage        *genai.GenerateContentResponseUsageMetadata
 	)
+	err := callProvider(ctx, ProviderGemini, func(ctx context.Context) error {
+		for result, err := range s.client.Models.GenerateContentStream(
+			ctx,
+			s.model,
+			contents,
+			config,
+		) {
+			if err != nil {
+				return err
+			}
+			delta := result.Text()
+			text.WriteString(delta)
+			if onDelta != nil && delta != "" {
+				onDelta(delta)
+			}
+			if len(result.Candidates) > 0 && result.Candidates[0] != nil && result.Candidates[0].FinishReason != "" {
+				finishReason = result.Candidates[0].FinishReason
+			}
+			if result.UsageMetadata != nil {
+				usage = result.UsageMetadata
+			}
+			for _, call := range result.FunctionCalls() {
+				id := call.ID
+				if id == "" {
+					id = newToolCallID()
+				}
+				toolCalls = append(toolCalls, ToolCall{ID: id, Name: call.Name, Arguments: encodeToolArguments(call.Args)})
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("generation failed: %w", err)
+		return "", nil, "", nil, interruption(ctx, text.String(), fmt.Errorf("generation failed: %w", err))
 	}
 
-	return result.Text(), nil
+	return text.String(), toolCalls, finishReason, usage, nil
+}
+
+// applyGeminiTools offers the tools to the model and returns contents with earlier tool
+// rounds appended after the prompt.
+func applyGeminiTools(config *genai.GenerateContentConfig, contents []*genai.Content, tools ToolRequest) []*genai.Content {
+	if len(tools.Tools) > 0 {
+		declarations := make([]*genai.FunctionDeclaration, 0, len(tools.Tools))
+		for _, tool := range tools.Tools {
+			declarations = append(declarations, &genai.FunctionDeclaration{
+				Name:                 tool.Name,
+				Description:          tool.Description,
+				ParametersJsonSchema: tool.Parameters,
+			})
+		}
+		config.Tools = []*genai.Tool{{FunctionDeclarations: declarations}}
+
+		calling := &genai.FunctionCallingConfig{}
+		switch tools.Choice.Mode {
+		case ToolChoiceNone:
+			calling.Mode = genai.FunctionCallingConfigModeNone
+		case ToolChoiceRequired:
+			calling.Mode = genai.FunctionCallingConfigModeAny
+		case ToolChoiceFunction:
+			calling.Mode = genai.FunctionCallingConfigModeAny
+			calling.AllowedFunctionNames = []string{tools.Choice.Name}
+		default:
+			calling.Mode = genai.FunctionCallingConfigModeAuto
+		}
+		config.ToolConfig = &genai.ToolConfig{FunctionCallingConfig: calling}
+	}
+
+	for _, turn := range tools.Turns {
+		model := &genai.Content{Role: genai.RoleModel}
+		if turn.Text != "" {
+			model.Parts = append(model.Parts, &genai.Part{Text: turn.Text})
+		}
+		for _, call := range turn.Calls {
+			model.Parts = append(model.Parts, &genai.Part{FunctionCall: &genai.FunctionCall{
+				ID:   call.ID,
+				Name: call.Name,
+				Args: toolArguments(call.Arguments),
+			}})
+		}
+
+		results := &genai.Content{Role: genai.RoleUser}
+		for _, result := range turn.Results {
+			results.Parts = append(results.Parts, &genai.Part{FunctionResponse: &genai.FunctionResponse{
+				ID:       result.CallID,
+				Name:     turn.CallName(result.CallID),
+				Response: map[string]any{"output": toolOutput(result.Content)},
+			}})
+		}
+		contents = append(contents, model, results)
+	}
+	return contents
 }
 
 // parseGeminiResponse extracts code and explanation from Gemini's response
@@ -128,17 +239,71 @@ func (s *GeminiService) parseGeminiResponse(response string) (*CodeGenerationRes
 	}, nil
 }
 
-// countTokens counts tokens in text using Gemini's CountTokens API
-func (s *GeminiService) countTokens(ctx context.Context, text string) (int, error) {
-	result, err := s.client.Models.CountTokens(
-		ctx,
-		defaultGeminiModel,
-		genai.Text(text),
-		nil,
-	)
+// Summarize condenses conversation history with a plain completion.
+func (s *GeminiService) Summarize(ctx context.Context, previousSummary, transcript string) (string, error) {
+	result, err := callProviderValue(ctx, ProviderGemini, func(ctx context.Context) (*genai.GenerateContentResponse, error) {
+		return s.client.Models.GenerateContent(
+			ctx,
+			s.model,
+			genai.Text(buildSummaryPrompt(previousSummary, transcript)),
+			&genai.GenerateContentConfig{
+				Temperature:       genai.Ptr(float32(summaryTemperature)),
+				MaxOutputTokens:   summaryMaxTokens,
+				SystemInstruction: genai.NewContentFromText(summarySystemMessage, genai.RoleUser),
+			},
+		)
+	})
 	if err != nil {
-		return 0, fmt.Errorf("token counting failed: %w", err)
+		return "", fmt.Errorf("gemini summarization failed: %w", err)
 	}
+	return strings.TrimSpace(result.Text()), nil
+}
 
-	return int(result.TotalTokens), nil
+// RewriteQuery condenses the conversation history and a follow-up into a standalone
+// retrieval query.
+func (s *GeminiService) RewriteQuery(ctx context.Context, history, query string) (string, error) {
+	result, err := callProviderValue(ctx, ProviderGemini, func(ctx context.Context) (*genai.GenerateContentResponse, error) {
+		return s.client.Models.GenerateContent(
+			ctx,
+			s.model,
+			genai.Text(buildRewritePrompt(history, query)),
+			&genai.GenerateContentConfig{
+				Temperature:       genai.Ptr(float32(rewriteTemperature)),
+				MaxOutputTokens:   rewriteMaxTokens,
+				SystemInstruction: genai.NewContentFromText(rewriteSystemMessage, genai.RoleUser),
+			},
+		)
+	})
+	if err != nil {
+		return "", fmt.Errorf("gemini query rewrite failed: %w", err)
+	}
+	return cleanRewrittenQuery(result.Text()), nil
+}
+
+// GenerateTitle names a conversation from its first user message.
+func (s *GeminiService) GenerateTitle(ctx context.Context, message string) (string, error) {
+	result, err := callProviderValue(ctx, ProviderGemini, func(ctx context.Context) (*genai.GenerateContentResponse, error) {
+		return s.client.Models.GenerateContent(
+			ctx,
+			s.model,
+			genai.Text(buildTitlePrompt(message)),
+			&genai.GenerateContentConfig{
+				Temperature:       genai.Ptr(float32(titleTemperature)),
+				MaxOutputTokens:   titleMaxTokens,
+				SystemInstruction: genai.NewContentFromText(titleSystemMessage, genai.RoleUser),
+			},
+		)
+	})
+	if err != nil {
+		return "", fmt.Errorf("gemini title generation failed: %w", err)
+	}
+	return cleanTitle(result.Text()), nil
+}
+
+// HealthCheck verifies the API key by looking up the configured model.
+func (s *GeminiService) HealthCheck(ctx context.Context) error {
+	if _, err := s.client.Models.Get(ctx, s.model, nil); err != nil {
+		return fmt.Errorf("gemini model lookup failed: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,83 @@
+package codegen
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// InterruptedError is returned when a generation is cancelled (for example because the
+// client disconnected) after the provider had already produced output.
+type InterruptedError struct {
+	// Partial is the assistant text received before the interruption.
+	Partial string
+	Err     error
+}
+
+func (e *InterruptedError) Error() string {
+	return fmt.Sprintf("generation interrupted after %d characters: %v", len(e.Partial), e.Err)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// Response converts the partial output into a response flagged as interrupted.
+func (e *InterruptedError) Response() *CodeGenerationResponse {
+	resp := responseFromText(e.Partial)
+	resp.Interrupted = true
+	// The provider never reported usage for the cut-off stream
+	resp.OutputTokens = CountTokens(e.Partial)
+	return resp
+}
+
+// interruption wraps err as an *InterruptedError when ctx was cancelled after partial output.
+func interruption(ctx context.Context, partial string, err error) error {
+	if ctx.Err() != nil && partial != "" {
+		return &InterruptedError{Partial: partial, Err: ctx.Err()}
+	}
+	return err
+}
+
+// ContinuationQuery builds the query used to resume an interrupted answer to query.
+func ContinuationQuery(query, partial string) string {
+	var builder strings.Builder
+	builder.WriteString(query)
+	builder.WriteString("\n\nYour previous answer to this request was interrupted. Here is everything written so far:\n\n")
+	builder.WriteString(partial)
+	builder.WriteString("\n\nContinue the answer from exactly where it stops. Do not repeat any of the text above and do not restart the answer.")
+	return builder.String()
+}
+
+// MergeContinuation joins an interrupted partial answer with its continuation.
+func MergeContinuation(partial string, continuation *CodeGenerationResponse) *CodeGenerationResponse {
+	merged := responseFromText(partial + continuation.Text)
+	merged.InputTokens = continuation.InputTokens
+	merged.OutputTokens = continuation.OutputTokens
+	merged.Model = continuation.Model
+	merged.Interrupted = continuation.Interrupted
+	finalizeResponse(merged, hasWarning(continuation, WarningOutputTruncated), hasWarning(continuation, WarningContextTruncated))
+	return merged
+}
+
+func responseFromText(text string) *CodeGenerationResponse {
+	code := extractCodeBlock(text, "clarity")
+	if code == "" {
+		code = extractCodeBlock(text, "")
+	}
+
+	return &CodeGenerationResponse{
+		Code:        code,
+		Explanation: strings.TrimSpace(removeCodeBlocks(text)),
+		Text:        text,
+	}
+}
+
+func hasWarning(resp *CodeGenerationResponse, code string) bool {
+	for _, w := range resp.Warnings {
+		if w.Code == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package codegen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInvalidResponseLanguage is returned for a response language that is not a plain
+// language name or code.
+var ErrInvalidResponseLanguage = errors.New("invalid response language")
+
+// maxResponseLanguageRunes bounds a response language, e.g. "es" or "Brazilian Portuguese".
+const maxResponseLanguageRunes = 40
+
+// NormalizeResponseLanguage collapses the whitespace of a response language and checks that
+// it is a language name or code such as "Spanish", "zh-CN" or "Chinese (Simplified)". The
+// language is copied into the prompt, so anything else is rejected.
+func NormalizeResponseLanguage(language string) (string, error) {
+	language = strings.Join(strings.Fields(language), " ")
+	if utf8.RuneCountInString(language) > maxResponseLanguageRunes {
+		return "", fmt.Errorf("%w: must be at most %d characters", ErrInvalidResponseLanguage, maxResponseLanguageRunes)
+	}
+	for _, r := range language {
+		if !unicode.IsLetter(r) && r != ' ' && r != '-' && r != '(' && r != ')' {
+			return "", fmt.Errorf("%w: use a language name or code, e.g. \"Spanish\" or \"pt-BR\"", ErrInvalidResponseLanguage)
+		}
+	}
+	return language, nil
+}
+
+type responseLanguageKey struct{}
+
+// WithResponseLanguage asks providers to write explanations and code comments in language,
+// e.g. "Spanish". Clarity code and identifiers stay in English.
+func WithResponseLanguage(ctx context.Context, language string) context.Context {
+	if language == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, responseLanguageKey{}, language)
+}
+
+func responseLanguage(ctx context.Context) string {
+	language, _ := ctx.Value(responseLanguageKey{}).(string)
+	return language
+}
+
+// responseLanguageInstruction follows the output instructions when a response language
+// was requested.
+func responseLanguageInstruction(language string) string {
+	if language == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n## Response Language:\n"+
+		"Write the explanation, any other prose and the comments inside code in %s. "+
+		"Keep Clarity code, identifiers, file paths and the response format above in English.\n", language)
+}
@@ -0,0 +1,112 @@
+package codegen
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/models"
+)
+
+// promptOverheadTokens reserves room for the system message and prompt scaffolding.
+const promptOverheadTokens = 1024
+
+// ConfiguredModel returns the model id the provider is configured to use.
+func ConfiguredModel(provider string) string {
+	switch provider {
+	case ProviderOpenAI:
+		if model := os.Getenv("OPENAI_MODEL"); model != "" {
+			return model
+		}
+		return defaultOpenAIModel
+	case ProviderClaude:
+		if model := os.Getenv("CLAUDE_MODEL"); model != "" {
+			return model
+		}
+		return defaultClaudeModel
+	case ProviderLocal:
+		if model := os.Getenv("LOCAL_LLM_MODEL"); model != "" {
+			return model
+		}
+		return defaultLocalModel
+	default:
+		if model := os.Getenv("GEMINI_MODEL"); model != "" {
+			return model
+		}
+		return defaultGeminiModel
+	}
+}
+
+// ValidateMaxTokens rejects output limits the provider's active model cannot honour.
+// Models missing from the registry are not validated.
+func ValidateMaxTokens(provider string, maxTokens int) error {
+	return ValidateModelMaxTokens(ActiveModel(provider), maxTokens)
+}
+
+// ValidateModelMaxTokens rejects output limits the model cannot honour.
+func ValidateModelMaxTokens(modelID string, maxTokens int) error {
+	if maxTokens < 0 {
+		return fmt.Errorf("max_tokens cannot be negative")
+	}
+	model, ok := models.Lookup(modelID)
+	if !ok || model.MaxOutputTokens == 0 {
+		return nil
+	}
+	if maxTokens > model.MaxOutputTokens {
+		return fmt.Errorf("max_tokens %d exceeds the %d output token limit of %s", maxTokens, model.MaxOutputTokens, model.ID)
+	}
+	return nil
+}
+
+// fitToContextWindow drops retrieved contexts, documentation first and then code examples,
+// until the prompt fits the model's context window alongside maxTokens of output.
+// It reports whether anything was dropped.
+func fitToContextWindow(modelID, query string, codeContexts, docContexts []string, maxTokens int) ([]string, []string, bool) {
+	model, ok := models.Lookup(modelID)
+	if !ok || model.ContextWindow == 0 {
+		return codeContexts, docContexts, false
+	}
+
+	budget := model.ContextWindow - maxTokens - promptOverheadTokens - CountTokens(query)
+	used := 0
+	for _, ctx := range codeContexts {
+		used += CountTokens(ctx)
+	}
+	for _, doc := range docContexts {
+		used += CountTokens(doc)
+	}
+
+	trimmed := false
+	for used > budget && len(docContexts) > 0 {
+		last := len(docContexts) - 1
+		used -= CountTokens(docContexts[last])
+		docContexts = docContexts[:last]
+		trimmed = true
+	}
+	for used > budget && len(codeContexts) > 0 {
+		last := len(codeContexts) - 1
+		used -= CountTokens(codeContexts[last])
+		codeContexts = codeContexts[:last]
+		trimmed = true
+	}
+
+	return codeContexts, docContexts, trimmed
+}
+
+// applyModelMetadata sets the cost estimate and flags deprecated models using the registry
+// and MODEL_PRICES.
+func applyModelMetadata(resp *CodeGenerationResponse) {
+	model, ok := models.Lookup(resp.Model)
+	resp.EstimatedCostUSD = models.EstimateCost(model.Provider, resp.Model, resp.InputTokens, resp.OutputTokens)
+	if !ok {
+		return
+	}
+
+	if model.Deprecated(time.Now()) {
+		resp.AddWarning(Warning{
+			Code:    WarningModelDeprecated,
+			Message: fmt.Sprintf("Model %s was deprecated on %s", model.ID, model.DeprecationDate),
+			Detail:  model.ID,
+		})
+	}
+}
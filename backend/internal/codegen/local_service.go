@@ -0,0 +1,48 @@
+package codegen
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	defaultLocalModel = "llama3.1"
+	// localPlaceholderAPIKey is sent to servers that need no key. Without it the OpenAI client
+	// would fall back to OPENAI_API_KEY and send that to the local server.
+	localPlaceholderAPIKey = "local"
+)
+
+// NewLocalServiceFromEnv creates a service for a self-hosted model behind an OpenAI-compatible
+// API, such as Ollama, vLLM or LM Studio, from LOCAL_LLM_BASE_URL, LOCAL_LLM_MODEL and the
+// optional LOCAL_LLM_API_KEY.
+func NewLocalServiceFromEnv() (*OpenAIService, error) {
+	baseURL := strings.TrimSpace(os.Getenv("LOCAL_LLM_BASE_URL"))
+	if baseURL == "" {
+		return nil, fmt.Errorf("LOCAL_LLM_BASE_URL environment variable not set")
+	}
+	apiKey := os.Getenv("LOCAL_LLM_API_KEY")
+	if apiKey == "" {
+		apiKey = localPlaceholderAPIKey
+	}
+
+	service := NewOpenAIService(apiKey, ConfiguredModel(ProviderLocal), baseURL, "")
+	service.provider = ProviderLocal
+	return service, nil
+}
+
+// checkListedModel verifies that the server is reachable and serves the configured model.
+// Not every OpenAI-compatible server can retrieve a single model, but all of them list them.
+func (s *OpenAIService) checkListedModel(ctx context.Context) error {
+	iter := s.client.Models.ListAutoPaging(ctx)
+	for iter.Next() {
+		if iter.Current().ID == s.model {
+			return nil
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("local model listing failed: %w", err)
+	}
+	return fmt.Errorf("local server does not serve model %s", s.model)
+}
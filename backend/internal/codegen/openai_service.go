@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
@@ -11,9 +12,8 @@ import (
 )
 
 const (
-	defaultOpenAIModel         = openai.ChatModelGPT4o
-	defaultOpenAISystemMessage = "You are a Clarity expert."
-	defaultOpenAIMaxTokens     = 4096
+	defaultOpenAIModel     = openai.ChatModelGPT4o
+	defaultOpenAIMaxTokens = 4096
 )
 
 // OpenAIService handles code generation using OpenAI chat completions API.
@@ -21,16 +21,16 @@ type OpenAIService struct {
 	client        openai.Client
 	model         string
 	systemMessage string
+	// provider is ProviderOpenAI, or ProviderLocal for a self-hosted OpenAI-compatible server.
+	provider string
 }
 
 // NewOpenAIService creates a new OpenAI service instance.
+// An empty systemMessage defers to the deployment prompt configuration at request time.
 func NewOpenAIService(apiKey, model, baseURL, systemMessage string) *OpenAIService {
 	if model == "" {
 		model = defaultOpenAIModel
 	}
-	if systemMessage == "" {
-		systemMessage = defaultOpenAISystemMessage
-	}
 
 	// Build client options
 	opts := []option.RequestOption{
@@ -46,6 +46,7 @@ func NewOpenAIService(apiKey, model, baseURL, systemMessage string) *OpenAIServi
 		client:        client,
 		model:         model,
 		systemMessage: systemMessage,
+		provider:      ProviderOpenAI,
 	}
 }
 
@@ -58,44 +59,90 @@ func NewOpenAIServiceFromEnv() (*OpenAIService, error) {
 
 	model := os.Getenv("OPENAI_MODEL")
 	baseURL := os.Getenv("OPENAI_BASE_URL")
-	systemMessage := os.Getenv("OPENAI_SYSTEM_MESSAGE")
 
-	return NewOpenAIService(apiKey, model, baseURL, systemMessage), nil
+	// OPENAI_SYSTEM_MESSAGE is applied through PromptConfigFromEnv so admins can edit it at runtime.
+	return NewOpenAIService(apiKey, model, baseURL, ""), nil
 }
 
 // GenerateCode calls the OpenAI API to generate code using provided contexts.
 func (s *OpenAIService) GenerateCode(ctx context.Context, query string, codeContexts []string, docContexts []string, temperature float64, maxTokens int) (*CodeGenerationResponse, error) {
-	if temperature == 0 {
-		temperature = 0.7
-	}
+	return s.GenerateCodeStream(ctx, query, codeContexts, docContexts, temperature, maxTokens, nil)
+}
+
+// GenerateCodeStream is GenerateCode that also reports text deltas as they arrive.
+func (s *OpenAIService) GenerateCodeStream(ctx context.Context, query string, codeContexts []string, docContexts []string, temperature float64, maxTokens int, onDelta DeltaFunc) (*CodeGenerationResponse, error) {
+	temperature = defaultTemperature(temperature)
 	if maxTokens == 0 {
 		maxTokens = defaultOpenAIMaxTokens
 	}
 
-	prompt := buildCodeGenerationInstruction(query, codeContexts, docContexts)
+	codeContexts, docContexts, contextTrimmed := fitToContextWindow(s.model, query, codeContexts, docContexts, maxTokens)
+	prompt, err := buildCodeGenerationPrompt(ctx, s.provider, query, codeContexts, docContexts)
+	if err != nil {
+		return nil, err
+	}
+
+	systemMessage := s.systemMessage
+	if systemMessage == "" {
+		systemMessage = SystemMessage(s.provider)
+	}
 
 	// Build the chat completion request
 	params := openai.ChatCompletionNewParams{
 		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage(s.systemMessage),
+			openai.SystemMessage(systemMessage),
 			openai.UserMessage(prompt),
 		},
 		Model:       s.model,
 		Temperature: param.NewOpt(temperature),
 		MaxTokens:   param.NewOpt(int64(maxTokens)),
 	}
+	if tools, ok := ToolsFromContext(ctx); ok {
+		applyOpenAITools(&params, tools)
+	}
+	if structuredOutputActive(ctx, s.provider) {
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &openai.ResponseFormatJSONSchemaParam{
+				JSONSchema: openai.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   "code_generation",
+					Strict: param.NewOpt(true),
+					Schema: structuredOutputSchema,
+				},
+			},
+		}
+	}
 
-	// Call the OpenAI API
-	chatCompletion, err := s.client.Chat.Completions.New(ctx, params)
+	// Stream the completion so partial output survives a cancelled request
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: param.NewOpt(true)}
+	var (
+		chatCompletion openai.ChatCompletionAccumulator
+		partial        strings.Builder
+	)
+	err = callProvider(ctx, s.provider, func(ctx context.Context) error {
+		stream := s.client.Chat.Completions.NewStreaming(ctx, params)
+		defer stream.Close()
+		for stream.Next() {
+			chunk := stream.Current()
+			chatCompletion.AddChunk(chunk)
+			if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+				partial.WriteString(chunk.Choices[0].Delta.Content)
+				if onDelta != nil {
+					onDelta(chunk.Choices[0].Delta.Content)
+				}
+			}
+		}
+		return stream.Err()
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create chat completion: %w", err)
+		return nil, interruption(ctx, partial.String(), fmt.Errorf("failed to create chat completion: %w", err))
 	}
 
 	if len(chatCompletion.Choices) == 0 {
 		return nil, fmt.Errorf("openai response contained no choices")
 	}
 
-	assistantText := chatCompletion.Choices[0].Message.Content
+	message := chatCompletion.Choices[0].Message
+	assistantText := message.Content
 
 	code := extractCodeBlock(assistantText, "clarity")
 	if code == "" {
@@ -104,10 +151,156 @@ func (s *OpenAIService) GenerateCode(ctx context.Context, query string, codeCont
 
 	explanation := removeCodeBlocks(assistantText)
 
-	return &CodeGenerationResponse{
+	response := &CodeGenerationResponse{
 		Code:         code,
 		Explanation:  explanation,
+		Text:         assistantText,
 		InputTokens:  int(chatCompletion.Usage.PromptTokens),
 		OutputTokens: int(chatCompletion.Usage.CompletionTokens),
-	}, nil
+		Model:        s.model,
+		ToolCalls:    openAIToolCalls(message.ToolCalls),
+	}
+	fillMissingUsage(response, systemMessage, prompt)
+	applyStructuredOutput(ctx, s.provider, response)
+	finalizeResponse(response, chatCompletion.Choices[0].FinishReason == "length", contextTrimmed)
+
+	return response, nil
+}
+
+// applyOpenAITools offers the tools to the model and appends earlier tool rounds after the prompt.
+func applyOpenAITools(params *openai.ChatCompletionNewParams, tools ToolRequest) {
+	for _, tool := range tools.Tools {
+		function := openai.FunctionDefinitionParam{
+			Name:       tool.Name,
+			Parameters: openai.FunctionParameters(tool.Parameters),
+		}
+		if tool.Description != "" {
+			function.Description = param.NewOpt(tool.Description)
+		}
+		params.Tools = append(params.Tools, openai.ChatCompletionToolParam{Function: function})
+	}
+
+	if len(tools.Tools) > 0 {
+		switch tools.Choice.Mode {
+		case ToolChoiceFunction:
+			params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{
+				OfChatCompletionNamedToolChoice: &openai.ChatCompletionNamedToolChoiceParam{
+					Function: openai.ChatCompletionNamedToolChoiceFunctionParam{Name: tools.Choice.Name},
+				},
+			}
+		case ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+			params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: param.NewOpt(tools.Choice.Mode)}
+		}
+	}
+
+	for _, turn := range tools.Turns {
+		assistant := openai.ChatCompletionAssistantMessageParam{}
+		if turn.Text != "" {
+			assistant.Content.OfString = param.NewOpt(turn.Text)
+		}
+		for _, call := range turn.Calls {
+			assistant.ToolCalls = append(assistant.ToolCalls, openai.ChatCompletionMessageToolCallParam{
+				ID: call.ID,
+				Function: openai.ChatCompletionMessageToolCallFunctionParam{
+					Name:      call.Name,
+					Arguments: call.Arguments,
+				},
+			})
+		}
+		params.Messages = append(params.Messages, openai.ChatCompletionMessageParamUnion{OfAssistant: &assistant})
+		for _, result := range turn.Results {
+			params.Messages = append(params.Messages, openai.ToolMessage(result.Content, result.CallID))
+		}
+	}
+}
+
+func openAIToolCalls(calls []openai.ChatCompletionMessageToolCall) []ToolCall {
+	var toolCalls []ToolCall
+	for _, call := range calls {
+		toolCalls = append(toolCalls, ToolCall{
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+	return toolCalls
+}
+
+// Summarize condenses conversation history with a plain completion.
+func (s *OpenAIService) Summarize(ctx context.Context, previousSummary, transcript string) (string, error) {
+	completion, err := callProviderValue(ctx, s.provider, func(ctx context.Context) (*openai.ChatCompletion, error) {
+		return s.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.SystemMessage(summarySystemMessage),
+				openai.UserMessage(buildSummaryPrompt(previousSummary, transcript)),
+			},
+			Model:       s.model,
+			Temperature: param.NewOpt(summaryTemperature),
+			MaxTokens:   param.NewOpt(int64(summaryMaxTokens)),
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("openai summarization failed: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("openai response contained no choices")
+	}
+	return strings.TrimSpace(completion.Choices[0].Message.Content), nil
+}
+
+// RewriteQuery condenses the conversation history and a follow-up into a standalone
+// retrieval query.
+func (s *OpenAIService) RewriteQuery(ctx context.Context, history, query string) (string, error) {
+	completion, err := callProviderValue(ctx, s.provider, func(ctx context.Context) (*openai.ChatCompletion, error) {
+		return s.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.SystemMessage(rewriteSystemMessage),
+				openai.UserMessage(buildRewritePrompt(history, query)),
+			},
+			Model:       s.model,
+			Temperature: param.NewOpt(rewriteTemperature),
+			MaxTokens:   param.NewOpt(int64(rewriteMaxTokens)),
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("openai query rewrite failed: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("openai response contained no choices")
+	}
+	return cleanRewrittenQuery(completion.Choices[0].Message.Content), nil
+}
+
+// GenerateTitle names a conversation from its first user message.
+func (s *OpenAIService) GenerateTitle(ctx context.Context, message string) (string, error) {
+	completion, err := callProviderValue(ctx, s.provider, func(ctx context.Context) (*openai.ChatCompletion, error) {
+		return s.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.SystemMessage(titleSystemMessage),
+				openai.UserMessage(buildTitlePrompt(message)),
+			},
+			Model:       s.model,
+			Temperature: param.NewOpt(titleTemperature),
+			MaxTokens:   param.NewOpt(int64(titleMaxTokens)),
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("openai title generation failed: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", fmt.Errorf("openai response contained no choices")
+	}
+	return cleanTitle(completion.Choices[0].Message.Content), nil
+}
+
+// HealthCheck verifies the API key by looking up the configured model. Local servers are
+// checked by listing their models instead.
+func (s *OpenAIService) HealthCheck(ctx context.Context) error {
+	if s.provider == ProviderLocal {
+		return s.checkListedModel(ctx)
+	}
+	if _, err := s.client.Models.Get(ctx, s.model); err != nil {
+		return fmt.Errorf("openai model lookup failed: %w", err)
+	}
+	return nil
 }
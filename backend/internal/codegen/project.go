@@ -0,0 +1,315 @@
+package codegen
+
+import (
+	"context"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultProjectName names generated projects when the caller does not.
+const DefaultProjectName = "clarity-project"
+
+const projectInstructions = `## Instructions:
+Generate a complete Clarinet project that answers the user's question, based on the examples above.
+Include:
+- Clarinet.toml declaring every contract
+- contracts/*.clar for the contracts, with shared traits in contracts/traits/*.clar
+- tests/*.test.ts unit tests using the Clarinet SDK (vitest)
+
+Output every file as a heading with its path followed by a single fenced code block with the
+complete file contents, for example:
+
+### File: contracts/counter.clar
+` + "```clarity\n[file contents]\n```" + `
+
+After the files, add:
+
+**Explanation:**
+[how the project fits together]
+`
+
+type projectOutputKey struct{}
+
+// WithProjectOutput asks providers to answer with a multi-file Clarinet project instead of a single snippet.
+func WithProjectOutput(ctx context.Context) context.Context {
+	return context.WithValue(ctx, projectOutputKey{}, true)
+}
+
+func projectOutputRequested(ctx context.Context) bool {
+	requested, _ := ctx.Value(projectOutputKey{}).(bool)
+	return requested
+}
+
+// ProjectFile is a single file of a generated project.
+type ProjectFile struct {
+	Path     string `json:"path"`
+	Language string `json:"language,omitempty"`
+	Content  string `json:"content"`
+}
+
+// ProjectTreeNode is a directory or file in the project's file tree.
+type ProjectTreeNode struct {
+	Name     string             `json:"name"`
+	Path     string             `json:"path"`
+	Type     string             `json:"type"`
+	Children []*ProjectTreeNode `json:"children,omitempty"`
+}
+
+// ProjectGenerationResponse is a generated multi-file Clarinet project.
+type ProjectGenerationResponse struct {
+	Name             string           `json:"name"`
+	Files            []ProjectFile    `json:"files"`
+	Tree             *ProjectTreeNode `json:"tree"`
+	Explanation      string           `json:"explanation"`
+	InputTokens      int              `json:"input_tokens"`
+	OutputTokens     int              `json:"output_tokens"`
+	Model            string           `json:"model,omitempty"`
+	EstimatedCostUSD float64          `json:"estimated_cost_usd,omitempty"`
+	Provenance       *Provenance      `json:"provenance,omitempty"`
+	Warnings         []Warning        `json:"warnings,omitempty"`
+	Citations        []Citation       `json:"citations,omitempty"`
+}
+
+// NewProjectResponse parses the files out of a response generated with WithProjectOutput.
+// When the model ignored the file format, the extracted code becomes a single contract.
+func NewProjectResponse(resp *CodeGenerationResponse, name string) *ProjectGenerationResponse {
+	project := &ProjectGenerationResponse{
+		Name:             SanitizeProjectName(name),
+		InputTokens:      resp.InputTokens,
+		OutputTokens:     resp.OutputTokens,
+		Model:            resp.Model,
+		EstimatedCostUSD: resp.EstimatedCostUSD,
+		Provenance:       resp.Provenance,
+		Citations:        resp.Citations,
+	}
+
+	text := resp.Text
+	if text == "" {
+		text = resp.Code
+	}
+	files, explanation := parseProjectFiles(text)
+	project.Explanation = explanation
+	if project.Explanation == "" {
+		project.Explanation = resp.Explanation
+	}
+
+	if len(files) == 0 && resp.Code != "" {
+		files = []ProjectFile{{
+			Path:     "contracts/" + project.Name + ".clar",
+			Language: "clarity",
+			Content:  resp.Code,
+		}}
+		project.addWarning(Warning{
+			Code:    WarningIncompleteProject,
+			Message: "The response was not split into files; the code was saved as a single contract",
+		})
+	}
+	project.Files = files
+
+	hasContract, hasManifest := false, false
+	for _, file := range files {
+		if strings.HasSuffix(file.Path, ".clar") {
+			hasContract = true
+			for _, w := range analyzeCode(file.Content) {
+				w.Message = file.Path + ": " + w.Message
+				project.addWarning(w)
+			}
+		}
+		if path.Base(file.Path) == "Clarinet.toml" {
+			hasManifest = true
+		}
+	}
+	if len(files) > 0 && !hasManifest {
+		project.addWarning(Warning{
+			Code:    WarningIncompleteProject,
+			Message: "The project is missing Clarinet.toml",
+		})
+	}
+
+	// Keep the generation's caveats, minus the single-snippet check the files replace.
+	for _, w := range resp.Warnings {
+		if w.Code == WarningNoCode && hasContract {
+			continue
+		}
+		if w.Code == WarningDeprecatedFunction || w.Code == WarningRequiresClarity2 || w.Code == WarningRequiresClarity3 {
+			continue
+		}
+		project.addWarning(w)
+	}
+
+	project.Tree = buildProjectTree(project.Name, files)
+	return project
+}
+
+func (p *ProjectGenerationResponse) addWarning(w Warning) {
+	for _, existing := range p.Warnings {
+		if existing == w {
+			return
+		}
+	}
+	p.Warnings = append(p.Warnings, w)
+}
+
+var (
+	projectNameInvalid = regexp.MustCompile(`[^a-z0-9_-]+`)
+	// fileHeading matches "### File: path", "**File:** path", "File: `path`" and similar.
+	fileHeading = regexp.MustCompile("^\\s*(?:#{1,6}\\s*)?(?:\\*\\*)?\\s*(?:File|Path)\\s*:?\\s*(?:\\*\\*)?\\s*:?\\s*`?([^`*\\s]+)`?\\**\\s*$")
+)
+
+// SanitizeProjectName lowercases name and keeps only characters safe in paths and contract names.
+func SanitizeProjectName(name string) string {
+	name = strings.Trim(projectNameInvalid.ReplaceAllString(strings.ToLower(strings.TrimSpace(name)), "-"), "-")
+	if name == "" {
+		return DefaultProjectName
+	}
+	return name
+}
+
+// parseProjectFiles extracts "File: path" headed code blocks and the trailing explanation.
+func parseProjectFiles(text string) ([]ProjectFile, string) {
+	var (
+		files       []ProjectFile
+		seen        = make(map[string]int)
+		explanation []string
+		inFence     bool
+		inExplain   bool
+		pending     string
+		current     *ProjectFile
+		body        []string
+	)
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "```") {
+			if !inFence {
+				inFence = true
+				if pending != "" {
+					current = &ProjectFile{Path: pending, Language: strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))}
+					body = body[:0]
+					pending = ""
+				}
+				continue
+			}
+
+			inFence = false
+			if current != nil {
+				current.Content = strings.TrimRight(strings.Join(body, "\n"), "\n") + "\n"
+				current.Language = projectFileLanguage(current.Path, current.Language)
+				// A repeated path replaces the earlier version of the file.
+				if i, ok := seen[current.Path]; ok {
+					files[i] = *current
+				} else {
+					seen[current.Path] = len(files)
+					files = append(files, *current)
+				}
+				current = nil
+			}
+			continue
+		}
+
+		if inFence {
+			if current != nil {
+				body = append(body, line)
+			}
+			continue
+		}
+
+		if match := fileHeading.FindStringSubmatch(line); match != nil {
+			if p, ok := cleanProjectPath(match[1]); ok {
+				pending = p
+				inExplain = false
+				continue
+			}
+		}
+
+		if strings.HasPrefix(trimmed, "**Explanation:**") {
+			inExplain = true
+			trimmed = strings.TrimSpace(strings.TrimPrefix(trimmed, "**Explanation:**"))
+			if trimmed == "" {
+				continue
+			}
+		}
+		if inExplain {
+			explanation = append(explanation, line)
+		}
+	}
+
+	return files, strings.TrimSpace(strings.Join(explanation, "\n"))
+}
+
+// cleanProjectPath normalises a relative file path and rejects paths that escape the project.
+func cleanProjectPath(p string) (string, bool) {
+	p = strings.TrimSpace(strings.ReplaceAll(p, "\\", "/"))
+	if p == "" || strings.HasPrefix(p, "/") {
+		return "", false
+	}
+	cleaned := path.Clean(p)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", false
+	}
+	// Headings like "File: contracts" without an extension are not files.
+	if !strings.Contains(path.Base(cleaned), ".") {
+		return "", false
+	}
+	return cleaned, true
+}
+
+func projectFileLanguage(filePath, fenceLanguage string) string {
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".clar":
+		return "clarity"
+	case ".toml":
+		return "toml"
+	case ".ts":
+		return "typescript"
+	case ".js":
+		return "javascript"
+	case ".json":
+		return "json"
+	case ".md":
+		return "markdown"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return fenceLanguage
+}
+
+// buildProjectTree arranges the file paths into a directory tree rooted at the project name.
+func buildProjectTree(name string, files []ProjectFile) *ProjectTreeNode {
+	root := &ProjectTreeNode{Name: name, Path: "", Type: "directory"}
+
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		node := root
+		parts := strings.Split(p, "/")
+		for i, part := range parts {
+			nodeType := "directory"
+			if i == len(parts)-1 {
+				nodeType = "file"
+			}
+
+			var child *ProjectTreeNode
+			for _, existing := range node.Children {
+				if existing.Name == part && existing.Type == nodeType {
+					child = existing
+					break
+				}
+			}
+			if child == nil {
+				child = &ProjectTreeNode{Name: part, Path: strings.Join(parts[:i+1], "/"), Type: nodeType}
+				node.Children = append(node.Children, child)
+			}
+			node = child
+		}
+	}
+
+	return root
+}
@@ -0,0 +1,99 @@
+package codegen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// PromptLanguage is the language generated code is written in, exposed to prompt templates.
+const PromptLanguage = "clarity"
+
+// PromptData is the data a prompt template is executed with.
+type PromptData struct {
+	Query        string
+	CodeContexts []string
+	DocContexts  []string
+	// Language is the fence language for generated code, e.g. "clarity".
+	Language string
+	Provider string
+	// Project is true when the request asked for a multi-file Clarinet project.
+	Project bool
+	// Tests is true when the request asked for unit tests of a contract, which Query holds.
+	Tests bool
+	// Preamble is the deployment's rendered instruction preamble.
+	Preamble string
+	// OutputInstructions is the built-in answer format for single snippets, projects or tests.
+	// Templates should include it unless they describe an equivalent format.
+	OutputInstructions string
+	OrgGuidance        string
+	// ResponseLanguage is the language the user asked explanations in, empty for the default.
+	// OutputInstructions already asks for it.
+	ResponseLanguage string
+}
+
+var promptTemplateFuncs = template.FuncMap{
+	// inc turns a zero-based range index into a one-based number.
+	"inc":  func(i int) int { return i + 1 },
+	"join": strings.Join,
+	"trim": strings.TrimSpace,
+}
+
+// ParsePromptTemplate parses a code generation prompt template written with text/template.
+// The template is executed once against sample data so references to unknown fields are
+// reported here rather than at request time.
+func ParsePromptTemplate(name, body string) (*template.Template, error) {
+	if strings.TrimSpace(body) == "" {
+		return nil, fmt.Errorf("template cannot be empty")
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(promptTemplateFuncs).Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	sample := newPromptData(ProviderGemini, "sample question", []string{"(define-public (hello) (ok true))"}, []string{"sample excerpt"}, false, false)
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+type promptTemplateKey struct{}
+
+// WithPromptTemplate asks providers to build the code generation prompt from tmpl instead
+// of the built-in layout. The system message is unchanged.
+func WithPromptTemplate(ctx context.Context, tmpl *template.Template) context.Context {
+	return context.WithValue(ctx, promptTemplateKey{}, tmpl)
+}
+
+func promptTemplateFromContext(ctx context.Context) *template.Template {
+	tmpl, _ := ctx.Value(promptTemplateKey{}).(*template.Template)
+	return tmpl
+}
+
+func newPromptData(provider, query string, codeContexts, docContexts []string, project, tests bool) PromptData {
+	cfg := CurrentPromptConfig()
+	return PromptData{
+		Query:              query,
+		CodeContexts:       codeContexts,
+		DocContexts:        docContexts,
+		Language:           PromptLanguage,
+		Provider:           provider,
+		Project:            project,
+		Tests:              tests,
+		Preamble:           strings.TrimSpace(instructionPreamble()),
+		OutputInstructions: outputInstructions(project, tests),
+		OrgGuidance:        strings.TrimSpace(cfg.OrgGuidance),
+	}
+}
+
+func renderCodeGenerationTemplate(tmpl *template.Template, data PromptData) (string, error) {
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", fmt.Errorf("render prompt template %q: %w", tmpl.Name(), err)
+	}
+	return builder.String(), nil
+}
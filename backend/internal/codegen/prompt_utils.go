@@ -1,15 +1,34 @@
 package codegen
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
 
-func buildCodeGenerationInstruction(query string, codeContexts, docContexts []string) string {
+// buildCodeGenerationPrompt renders the prompt for a code generation request, using the
+// template attached with WithPromptTemplate when there is one.
+func buildCodeGenerationPrompt(ctx context.Context, provider, query string, codeContexts, docContexts []string) (string, error) {
+	project, tests := projectOutputRequested(ctx), testOutputRequested(ctx)
+	language := responseLanguage(ctx)
+	instructions := outputInstructions(project, tests)
+	if structuredOutputActive(ctx, provider) {
+		instructions = structuredInstructions
+	}
+	if tmpl := promptTemplateFromContext(ctx); tmpl != nil {
+		data := newPromptData(provider, query, codeContexts, docContexts, project, tests)
+		data.ResponseLanguage = language
+		data.OutputInstructions = instructions + responseLanguageInstruction(language)
+		return renderCodeGenerationTemplate(tmpl, data)
+	}
+	return buildCodeGenerationInstruction(query, codeContexts, docContexts, instructions) + responseLanguageInstruction(language), nil
+}
+
+func buildCodeGenerationInstruction(query string, codeContexts, docContexts []string, instructions string) string {
 	var promptBuilder strings.Builder
 
-	promptBuilder.WriteString("You are an expert Clarity programmer. ")
-	promptBuilder.WriteString("Use the provided Clarity code examples and documentation excerpts as context to answer the user's question.\n\n")
+	promptBuilder.WriteString(strings.TrimSpace(instructionPreamble()))
+	promptBuilder.WriteString("\n\n")
 
 	if len(codeContexts) > 0 {
 		promptBuilder.WriteString("## Code Examples:\n\n")
@@ -29,12 +48,25 @@ func buildCodeGenerationInstruction(query string, codeContexts, docContexts []st
 	promptBuilder.WriteString(query)
 	promptBuilder.WriteString("\n\n")
 
-	promptBuilder.WriteString("## Instructions:\n")
-	promptBuilder.WriteString("Provide a clear, working Clarity code solution based on the examples above. ")
-	promptBuilder.WriteString("Include a brief explanation of how the code works. ")
-	promptBuilder.WriteString("Format your response as:\n\n")
-	promptBuilder.WriteString("**Code:**\n```clarity\n[your code here]\n```\n\n")
-	promptBuilder.WriteString("**Explanation:**\n[your explanation here]\n")
-
+	promptBuilder.WriteString(instructions)
 	return promptBuilder.String()
 }
+
+// outputInstructions tells the model how to format its answer.
+func outputInstructions(project, tests bool) string {
+	if tests {
+		return testInstructions
+	}
+	if project {
+		return projectInstructions
+	}
+
+	var builder strings.Builder
+	builder.WriteString("## Instructions:\n")
+	builder.WriteString("Provide a clear, working Clarity code solution based on the examples above. ")
+	builder.WriteString("Include a brief explanation of how the code works. ")
+	builder.WriteString("Format your response as:\n\n")
+	builder.WriteString("**Code:**\n```clarity\n[your code here]\n```\n\n")
+	builder.WriteString("**Explanation:**\n[your explanation here]\n")
+	return builder.String()
+}
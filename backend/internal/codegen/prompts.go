@@ -0,0 +1,198 @@
+package codegen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultSystemMessage       = "You are an expert Clarity programmer."
+	defaultInstructionPreamble = "You are an expert Clarity programmer. Use the provided Clarity code examples and documentation excerpts as context to answer the user's question.\n\n{{org_guidance}}"
+
+	// Template variables substituted into system messages and the instruction preamble.
+	templateOrgGuidance = "{{org_guidance}}"
+	templateProvider    = "{{provider}}"
+)
+
+// PromptConfig holds the deployment-level prompt settings shared by all providers.
+type PromptConfig struct {
+	// SystemMessage is the default system message for every provider.
+	SystemMessage string `json:"system_message"`
+	// ProviderSystemMessages overrides SystemMessage for individual providers.
+	ProviderSystemMessages map[string]string `json:"provider_system_messages,omitempty"`
+	// InstructionPreamble opens every code generation prompt.
+	InstructionPreamble string `json:"instruction_preamble"`
+	// OrgGuidance is substituted for {{org_guidance}} in the templates above.
+	OrgGuidance string `json:"org_guidance,omitempty"`
+}
+
+var (
+	promptConfigMu sync.RWMutex
+	promptConfig   = DefaultPromptConfig()
+)
+
+// DefaultPromptConfig returns the built-in prompt configuration.
+func DefaultPromptConfig() PromptConfig {
+	return PromptConfig{
+		SystemMessage:          defaultSystemMessage,
+		ProviderSystemMessages: make(map[string]string),
+		InstructionPreamble:    defaultInstructionPreamble,
+	}
+}
+
+// PromptConfigFromEnv loads prompt settings from CODEGEN_PROMPTS_FILE (JSON) and then applies
+// environment overrides, including the legacy OPENAI_SYSTEM_MESSAGE and CLAUDE_SYSTEM_MESSAGE.
+func PromptConfigFromEnv() (PromptConfig, error) {
+	cfg := DefaultPromptConfig()
+
+	if path := os.Getenv("CODEGEN_PROMPTS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return cfg, fmt.Errorf("read prompts file: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return cfg, fmt.Errorf("parse prompts file: %w", err)
+			}
+		}
+	}
+
+	if msg := os.Getenv("CODEGEN_SYSTEM_MESSAGE"); msg != "" {
+		cfg.SystemMessage = msg
+	}
+	if preamble := os.Getenv("CODEGEN_INSTRUCTION_PREAMBLE"); preamble != "" {
+		cfg.InstructionPreamble = preamble
+	}
+	if guidance := os.Getenv("CODEGEN_ORG_GUIDANCE"); guidance != "" {
+		cfg.OrgGuidance = guidance
+	}
+
+	if cfg.ProviderSystemMessages == nil {
+		cfg.ProviderSystemMessages = make(map[string]string)
+	}
+	providerEnv := map[string]string{
+		ProviderGemini: "GEMINI_SYSTEM_MESSAGE",
+		ProviderOpenAI: "OPENAI_SYSTEM_MESSAGE",
+		ProviderClaude: "CLAUDE_SYSTEM_MESSAGE",
+		ProviderLocal:  "LOCAL_LLM_SYSTEM_MESSAGE",
+	}
+	for provider, key := range providerEnv {
+		if msg := os.Getenv(key); msg != "" {
+			cfg.ProviderSystemMessages[provider] = msg
+		}
+	}
+
+	return cfg, nil
+}
+
+// SetPromptConfig replaces the active prompt configuration.
+func SetPromptConfig(cfg PromptConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	normalized := PromptConfig{
+		SystemMessage:          cfg.SystemMessage,
+		ProviderSystemMessages: make(map[string]string, len(cfg.ProviderSystemMessages)),
+		InstructionPreamble:    cfg.InstructionPreamble,
+		OrgGuidance:            cfg.OrgGuidance,
+	}
+	for provider, msg := range cfg.ProviderSystemMessages {
+		if strings.TrimSpace(msg) != "" {
+			normalized.ProviderSystemMessages[strings.ToLower(provider)] = msg
+		}
+	}
+
+	promptConfigMu.Lock()
+	defer promptConfigMu.Unlock()
+	promptConfig = normalized
+	return nil
+}
+
+// CurrentPromptConfig returns a copy of the active prompt configuration.
+func CurrentPromptConfig() PromptConfig {
+	promptConfigMu.RLock()
+	defer promptConfigMu.RUnlock()
+
+	cfg := promptConfig
+	cfg.ProviderSystemMessages = make(map[string]string, len(promptConfig.ProviderSystemMessages))
+	for k, v := range promptConfig.ProviderSystemMessages {
+		cfg.ProviderSystemMessages[k] = v
+	}
+	return cfg
+}
+
+// SavePromptConfig writes the active configuration to CODEGEN_PROMPTS_FILE when it is set,
+// so admin edits survive restarts. It is a no-op otherwise.
+func SavePromptConfig() error {
+	path := os.Getenv("CODEGEN_PROMPTS_FILE")
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(CurrentPromptConfig(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal prompts: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("write prompts file: %w", err)
+	}
+	return nil
+}
+
+// Validate checks that the configuration is usable.
+func (c PromptConfig) Validate() error {
+	if strings.TrimSpace(c.SystemMessage) == "" {
+		return fmt.Errorf("system_message cannot be empty")
+	}
+	if strings.TrimSpace(c.InstructionPreamble) == "" {
+		return fmt.Errorf("instruction_preamble cannot be empty")
+	}
+	for provider := range c.ProviderSystemMessages {
+		switch strings.ToLower(provider) {
+		case ProviderGemini, ProviderOpenAI, ProviderClaude, ProviderLocal:
+		default:
+			return fmt.Errorf("unknown provider %q", provider)
+		}
+	}
+	return nil
+}
+
+// SystemMessage returns the rendered system message for the provider.
+func SystemMessage(provider string) string {
+	return CurrentPromptConfig().systemMessage(provider)
+}
+
+// PromptFingerprint identifies the rendered system message and instruction preamble the
+// provider currently generates with, so responses can be tied to the prompt that made them.
+func PromptFingerprint(provider string) string {
+	cfg := CurrentPromptConfig()
+	preamble := renderPromptTemplate(cfg.InstructionPreamble, "", cfg.OrgGuidance)
+	sum := sha256.Sum256([]byte(cfg.systemMessage(provider) + "\x00" + preamble))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (c PromptConfig) systemMessage(provider string) string {
+	msg := c.SystemMessage
+	if override, ok := c.ProviderSystemMessages[provider]; ok {
+		msg = override
+	}
+	return renderPromptTemplate(msg, provider, c.OrgGuidance)
+}
+
+// instructionPreamble returns the rendered preamble that opens code generation prompts.
+func instructionPreamble() string {
+	cfg := CurrentPromptConfig()
+	return renderPromptTemplate(cfg.InstructionPreamble, "", cfg.OrgGuidance)
+}
+
+func renderPromptTemplate(tmpl, provider, orgGuidance string) string {
+	rendered := strings.ReplaceAll(tmpl, templateOrgGuidance, strings.TrimSpace(orgGuidance))
+	rendered = strings.ReplaceAll(rendered, templateProvider, provider)
+	return rendered
+}
@@ -0,0 +1,98 @@
+package codegen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/version"
+)
+
+// PromptTemplateVersion identifies the revision of the built-in code generation prompt
+// template, used when a request selects no prompt template.
+const PromptTemplateVersion = "2024-10-v1"
+
+// Provenance describes where a generated response came from, for downstream audits.
+type Provenance struct {
+	Provider              string `json:"provider"`
+	Model                 string `json:"model"`
+	PromptTemplateVersion string `json:"prompt_template_version"`
+	// PromptFingerprint identifies the deployment system message and instruction preamble.
+	PromptFingerprint string    `json:"prompt_fingerprint"`
+	CodeContextHashes []string  `json:"code_context_hashes"`
+	DocContextHashes  []string  `json:"doc_context_hashes"`
+	ServerVersion     string    `json:"server_version"`
+	GeneratedAt       time.Time `json:"generated_at"`
+}
+
+// ProvenanceHeaderFromEnv reports whether generated code should carry an embedded provenance comment.
+func ProvenanceHeaderFromEnv() bool {
+	return strings.EqualFold(os.Getenv("CODEGEN_PROVENANCE_HEADER"), "true")
+}
+
+// AttachProvenance records provenance on the response and optionally prefixes the code with a comment header.
+// promptTemplate is the version of the prompt template the request generated with, or
+// empty for the built-in one.
+func AttachProvenance(resp *CodeGenerationResponse, provider, promptTemplate string, codeContexts, docContexts []string, withHeader bool) {
+	if resp == nil {
+		return
+	}
+	if promptTemplate == "" {
+		promptTemplate = PromptTemplateVersion
+	}
+
+	resp.Provenance = &Provenance{
+		Provider:              provider,
+		Model:                 resp.Model,
+		PromptTemplateVersion: promptTemplate,
+		PromptFingerprint:     PromptFingerprint(strings.ToLower(provider)),
+		CodeContextHashes:     hashContexts(codeContexts),
+		DocContextHashes:      hashContexts(docContexts),
+		ServerVersion:         version.Get(),
+		GeneratedAt:           time.Now().UTC(),
+	}
+
+	if withHeader && resp.Code != "" {
+		resp.Code = provenanceHeader(resp.Provenance) + resp.Code
+	}
+}
+
+func provenanceHeader(p *Provenance) string {
+	var builder strings.Builder
+	builder.WriteString(";; Generated by Stacks Builder\n")
+	builder.WriteString(fmt.Sprintf(";; provider: %s, model: %s\n", p.Provider, p.Model))
+	builder.WriteString(fmt.Sprintf(";; prompt-template: %s, prompt: %s, server: %s\n", p.PromptTemplateVersion, p.PromptFingerprint, p.ServerVersion))
+	builder.WriteString(fmt.Sprintf(";; generated-at: %s\n", p.GeneratedAt.Format(time.RFC3339)))
+	if digest := contextDigest(p); digest != "" {
+		builder.WriteString(fmt.Sprintf(";; context-digest: %s\n", digest))
+	}
+	builder.WriteString("\n")
+	return builder.String()
+}
+
+// contextDigest combines all context hashes into a single short fingerprint.
+func contextDigest(p *Provenance) string {
+	if len(p.CodeContextHashes)+len(p.DocContextHashes) == 0 {
+		return ""
+	}
+	hash := sha256.New()
+	for _, h := range p.CodeContextHashes {
+		hash.Write([]byte(h))
+	}
+	for _, h := range p.DocContextHashes {
+		hash.Write([]byte(h))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+func hashContexts(contexts []string) []string {
+	hashes := make([]string, 0, len(contexts))
+	for _, ctx := range contexts {
+		sum := sha256.Sum256([]byte(ctx))
+		hashes = append(hashes, hex.EncodeToString(sum[:]))
+	}
+	return hashes
+}
@@ -0,0 +1,79 @@
+package codegen
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	rewriteMaxTokens   = 256
+	rewriteTemperature = 0.0
+
+	defaultRewriteTimeout = 5 * time.Second
+	// maxRewriteQueryChars caps a rewritten query so a rambling reply cannot flood retrieval.
+	maxRewriteQueryChars = 1000
+)
+
+// rewriteSystemMessage instructs providers to condense a follow-up into a search query.
+const rewriteSystemMessage = "You rewrite follow-up requests to a Clarity smart contract assistant into standalone " +
+	"search queries for retrieving Clarity code examples and documentation. Resolve references such as " +
+	"\"it\" or \"that contract\" from the conversation, and keep contract, function and trait names and " +
+	"the features the user asks for. Reply with the query only, on a single line, without quotes or commentary."
+
+// QueryRewriter is implemented by providers that can turn a follow-up into a standalone query.
+type QueryRewriter interface {
+	RewriteQuery(ctx context.Context, history, query string) (string, error)
+}
+
+// RewriteConfig controls rewriting follow-up messages into standalone retrieval queries.
+type RewriteConfig struct {
+	Enabled bool
+	// Model rewrites queries instead of the model answering the request, e.g. a cheaper one.
+	Model string
+	// Timeout bounds the rewrite call; on timeout the original message is retrieved with.
+	Timeout time.Duration
+}
+
+// RewriteConfigFromEnv reads QUERY_REWRITE_ENABLED, QUERY_REWRITE_MODEL and QUERY_REWRITE_TIMEOUT.
+func RewriteConfigFromEnv() RewriteConfig {
+	cfg := RewriteConfig{
+		Enabled: true,
+		Model:   strings.TrimSpace(os.Getenv("QUERY_REWRITE_MODEL")),
+		Timeout: defaultRewriteTimeout,
+	}
+	if enabled, err := strconv.ParseBool(os.Getenv("QUERY_REWRITE_ENABLED")); err == nil {
+		cfg.Enabled = enabled
+	}
+	if d, err := time.ParseDuration(os.Getenv("QUERY_REWRITE_TIMEOUT")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	return cfg
+}
+
+// buildRewritePrompt asks for a standalone version of query given the conversation history.
+func buildRewritePrompt(history, query string) string {
+	var builder strings.Builder
+	builder.WriteString(strings.TrimSpace(history))
+	builder.WriteString("\n\nFollow-up request:\n")
+	builder.WriteString(strings.TrimSpace(query))
+	builder.WriteString("\n\nStandalone search query:")
+	return builder.String()
+}
+
+// cleanRewrittenQuery normalizes a rewriter's reply to a single-line query. It returns an
+// empty string when the reply holds no usable query.
+func cleanRewrittenQuery(reply string) string {
+	reply = strings.TrimSpace(reply)
+	if line, _, ok := strings.Cut(reply, "\n"); ok {
+		reply = strings.TrimSpace(line)
+	}
+	reply = strings.TrimSpace(strings.TrimPrefix(reply, "Standalone search query:"))
+	reply = strings.Trim(reply, "\"'`")
+	if len(reply) > maxRewriteQueryChars {
+		reply = strings.ToValidUTF8(reply[:maxRewriteQueryChars], "")
+	}
+	return strings.TrimSpace(reply)
+}
@@ -0,0 +1,195 @@
+package codegen
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDefaultTemperature bounds the default temperature every provider accepts.
+const maxDefaultTemperature = 2
+
+// fallbackTemperature is used when neither the request nor the runtime config sets one.
+const fallbackTemperature = 0.7
+
+// RuntimeConfig switches the codegen provider, model and default temperature without a
+// restart. Zero values keep the environment configuration.
+type RuntimeConfig struct {
+	Provider string `json:"provider,omitempty"`
+	// Model replaces the provider's configured model; it requires Provider.
+	Model string `json:"model,omitempty"`
+	// Temperature is used by requests that do not set one.
+	Temperature float64    `json:"temperature,omitempty"`
+	UpdatedBy   *int       `json:"updated_by,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+var (
+	runtimeConfigMu sync.RWMutex
+	runtimeConfig   RuntimeConfig
+)
+
+// CurrentRuntimeConfig returns the active runtime override.
+func CurrentRuntimeConfig() RuntimeConfig {
+	runtimeConfigMu.RLock()
+	defer runtimeConfigMu.RUnlock()
+	return runtimeConfig
+}
+
+// SetRuntimeConfig validates and activates a runtime override. An empty config restores
+// the environment configuration.
+func SetRuntimeConfig(cfg RuntimeConfig) error {
+	cfg.Provider = strings.TrimSpace(strings.ToLower(cfg.Provider))
+	cfg.Model = strings.TrimSpace(cfg.Model)
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	runtimeConfigMu.Lock()
+	runtimeConfig = cfg
+	runtimeConfigMu.Unlock()
+	return nil
+}
+
+// Validate checks that the provider is known and has credentials and that the model and
+// temperature are usable.
+func (c RuntimeConfig) Validate() error {
+	if c.Provider != "" {
+		envKey, ok := providerAPIKeyEnv[c.Provider]
+		if !ok {
+			return fmt.Errorf("unknown provider %q", c.Provider)
+		}
+		if os.Getenv(envKey) == "" {
+			return fmt.Errorf("provider %s is not configured (%s is not set)", c.Provider, envKey)
+		}
+	}
+	if c.Model != "" {
+		if c.Provider == "" {
+			return fmt.Errorf("model requires a provider")
+		}
+		if provider := ModelProvider(c.Model); provider != "" && provider != c.Provider {
+			return fmt.Errorf("model %s is served by %s, not %s", c.Model, provider, c.Provider)
+		}
+	}
+	if c.Temperature < 0 || c.Temperature > maxDefaultTemperature {
+		return fmt.Errorf("temperature must be between 0 and %d", maxDefaultTemperature)
+	}
+	return nil
+}
+
+// ActiveProvider returns the runtime provider, or the environment's when none is set.
+func ActiveProvider() string {
+	if provider := CurrentRuntimeConfig().Provider; provider != "" {
+		return provider
+	}
+	return ProviderFromEnv()
+}
+
+// ActiveModel returns the model the provider generates with: the runtime model when it
+// belongs to the provider, otherwise the configured one.
+func ActiveModel(provider string) string {
+	if cfg := CurrentRuntimeConfig(); cfg.Model != "" && cfg.Provider == provider {
+		return cfg.Model
+	}
+	return ConfiguredModel(provider)
+}
+
+// DefaultTemperature returns the temperature used by requests that do not set one.
+func DefaultTemperature() float64 {
+	return defaultTemperature(0)
+}
+
+// defaultTemperature resolves the temperature of a request that left it at zero.
+func defaultTemperature(temperature float64) float64 {
+	if temperature != 0 {
+		return temperature
+	}
+	if cfg := CurrentRuntimeConfig(); cfg.Temperature != 0 {
+		return cfg.Temperature
+	}
+	return fallbackTemperature
+}
+
+// RuntimeConfigStore persists the runtime override in the codegen_config table so it
+// survives restarts. The active override is held in memory.
+type RuntimeConfigStore struct {
+	db *sql.DB
+}
+
+// NewRuntimeConfigStore returns a store backed by db.
+func NewRuntimeConfigStore(db *sql.DB) *RuntimeConfigStore {
+	return &RuntimeConfigStore{db: db}
+}
+
+// Load activates the stored override, or clears the override when none is stored.
+func (s *RuntimeConfigStore) Load(ctx context.Context) error {
+	var (
+		cfg       RuntimeConfig
+		updatedBy sql.NullInt64
+		updatedAt time.Time
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT provider, model, temperature, updated_by, updated_at
+		FROM codegen_config WHERE id = 1`,
+	).Scan(&cfg.Provider, &cfg.Model, &cfg.Temperature, &updatedBy, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return SetRuntimeConfig(RuntimeConfig{})
+	}
+	if err != nil {
+		return fmt.Errorf("load codegen config: %w", err)
+	}
+
+	if updatedBy.Valid {
+		id := int(updatedBy.Int64)
+		cfg.UpdatedBy = &id
+	}
+	cfg.UpdatedAt = &updatedAt
+	if err := SetRuntimeConfig(cfg); err != nil {
+		return fmt.Errorf("stored codegen config: %w", err)
+	}
+	return nil
+}
+
+// Save validates, stores and activates an override on behalf of updatedBy.
+func (s *RuntimeConfigStore) Save(ctx context.Context, cfg RuntimeConfig, updatedBy int) (RuntimeConfig, error) {
+	cfg.Provider = strings.TrimSpace(strings.ToLower(cfg.Provider))
+	cfg.Model = strings.TrimSpace(cfg.Model)
+	if err := cfg.Validate(); err != nil {
+		return RuntimeConfig{}, err
+	}
+
+	now := time.Now().UTC()
+	cfg.UpdatedBy, cfg.UpdatedAt = &updatedBy, &now
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO codegen_config (id, provider, model, temperature, updated_by, updated_at)
+		VALUES (1, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			provider = excluded.provider,
+			model = excluded.model,
+			temperature = excluded.temperature,
+			updated_by = excluded.updated_by,
+			updated_at = excluded.updated_at`,
+		cfg.Provider, cfg.Model, cfg.Temperature, updatedBy, now,
+	)
+	if err != nil {
+		return RuntimeConfig{}, fmt.Errorf("save codegen config: %w", err)
+	}
+
+	if err := SetRuntimeConfig(cfg); err != nil {
+		return RuntimeConfig{}, err
+	}
+	return cfg, nil
+}
+
+// Reset deletes the stored override and restores the environment configuration.
+func (s *RuntimeConfigStore) Reset(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM codegen_config WHERE id = 1`); err != nil {
+		return fmt.Errorf("reset codegen config: %w", err)
+	}
+	return SetRuntimeConfig(RuntimeConfig{})
+}
@@ -0,0 +1,159 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/models"
+)
+
+// ErrModelNotAllowed is returned when a request names a model outside the allowlist.
+var ErrModelNotAllowed = errors.New("model not allowed")
+
+// providerAPIKeyEnv names the credential each provider needs to serve requests. A local
+// server may need no key, so its base URL stands in for one.
+var providerAPIKeyEnv = map[string]string{
+	ProviderGemini: "GEMINI_API_KEY",
+	ProviderOpenAI: "OPENAI_API_KEY",
+	ProviderClaude: "CLAUDE_API_KEY",
+	ProviderLocal:  "LOCAL_LLM_BASE_URL",
+}
+
+// providerOrder lists the providers in the order they are reported and allowed.
+var providerOrder = []string{ProviderGemini, ProviderOpenAI, ProviderClaude, ProviderLocal}
+
+// ProviderConfigured reports whether the provider has the credentials it needs.
+func ProviderConfigured(provider string) bool {
+	envKey, ok := providerAPIKeyEnv[provider]
+	return ok && os.Getenv(envKey) != ""
+}
+
+// ProviderInfo describes a provider and how it is configured, without its credentials.
+type ProviderInfo struct {
+	Name string `json:"name"`
+	// Configured is true when the provider has credentials and can serve requests.
+	Configured bool `json:"configured"`
+	// Active marks the provider that serves requests without a "model".
+	Active bool `json:"active"`
+	// Model is the model the provider generates with.
+	Model            string `json:"model"`
+	StructuredOutput bool   `json:"structured_output"`
+}
+
+// Providers describes every known provider, configured or not.
+func Providers() []ProviderInfo {
+	active := ActiveProvider()
+	providers := make([]ProviderInfo, 0, len(providerOrder))
+	for _, name := range providerOrder {
+		providers = append(providers, ProviderInfo{
+			Name:             name,
+			Configured:       ProviderConfigured(name),
+			Active:           name == active,
+			Model:            ActiveModel(name),
+			StructuredOutput: supportsStructuredOutput(name),
+		})
+	}
+	return providers
+}
+
+// ModelSelection is the provider and model that serve a request.
+type ModelSelection struct {
+	Provider string
+	Model    string
+}
+
+// DefaultModelSelection returns the active provider with its active model.
+func DefaultModelSelection() ModelSelection {
+	provider := ActiveProvider()
+	return ModelSelection{Provider: provider, Model: ActiveModel(provider)}
+}
+
+// AllowedModels returns the model ids callers may request: the default model followed by
+// the comma-separated CODEGEN_ALLOWED_MODELS. When unset, the configured model of every
+// provider with an API key is allowed.
+func AllowedModels() []string {
+	var allowed []string
+	seen := make(map[string]bool)
+	add := func(id string) {
+		id = strings.TrimSpace(id)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			allowed = append(allowed, id)
+		}
+	}
+
+	add(DefaultModelSelection().Model)
+	if value := os.Getenv("CODEGEN_ALLOWED_MODELS"); strings.TrimSpace(value) != "" {
+		for _, id := range strings.Split(value, ",") {
+			add(id)
+		}
+		return allowed
+	}
+
+	for _, provider := range providerOrder {
+		if ProviderConfigured(provider) {
+			add(ConfiguredModel(provider))
+		}
+	}
+	return allowed
+}
+
+// SelectModel resolves the model a request asked for. An empty request uses the default
+// selection, and a bare provider name ("openai") selects that provider's configured model.
+// Other models must be on the allowlist and belong to a known provider.
+func SelectModel(requested string) (ModelSelection, error) {
+	requested = strings.TrimSpace(requested)
+	if requested == "" {
+		return DefaultModelSelection(), nil
+	}
+	if _, ok := providerAPIKeyEnv[strings.ToLower(requested)]; ok {
+		requested = ActiveModel(strings.ToLower(requested))
+	}
+
+	allowed := false
+	for _, id := range AllowedModels() {
+		if id == requested {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return ModelSelection{}, fmt.Errorf("%w: %s", ErrModelNotAllowed, requested)
+	}
+
+	provider := ModelProvider(requested)
+	if provider == "" {
+		return ModelSelection{}, fmt.Errorf("%w: no provider serves %s", ErrModelNotAllowed, requested)
+	}
+	return ModelSelection{Provider: provider, Model: requested}, nil
+}
+
+// ModelProvider returns the provider serving a model id, taken from the model registry or
+// inferred from the id's prefix. The local server's configured model is served locally, even
+// when its name looks like a hosted one (e.g. gpt-oss). It returns an empty string for
+// unknown models.
+func ModelProvider(modelID string) string {
+	if model, ok := models.Lookup(modelID); ok {
+		if _, known := providerAPIKeyEnv[model.Provider]; known {
+			return model.Provider
+		}
+	}
+	if os.Getenv(providerAPIKeyEnv[ProviderLocal]) != "" && modelID == ConfiguredModel(ProviderLocal) {
+		return ProviderLocal
+	}
+
+	id := strings.ToLower(modelID)
+	switch {
+	case strings.HasPrefix(id, "gemini-"):
+		return ProviderGemini
+	case strings.HasPrefix(id, "claude-"):
+		return ProviderClaude
+	case strings.HasPrefix(id, "gpt-"), strings.HasPrefix(id, "chatgpt-"),
+		strings.HasPrefix(id, "o1"), strings.HasPrefix(id, "o3"), strings.HasPrefix(id, "o4"):
+		return ProviderOpenAI
+	default:
+		return ""
+	}
+}
@@ -2,6 +2,7 @@ package codegen
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"strings"
 )
@@ -10,6 +11,8 @@ const (
 	ProviderGemini = "gemini"
 	ProviderOpenAI = "openai"
 	ProviderClaude = "claude"
+	// ProviderLocal is a self-hosted model behind an OpenAI-compatible API.
+	ProviderLocal = "local"
 )
 
 // CodeGenerationResponse represents a code generation response
@@ -18,6 +21,23 @@ type CodeGenerationResponse struct {
 	Explanation  string `json:"explanation"`
 	InputTokens  int    `json:"input_tokens"`
 	OutputTokens int    `json:"output_tokens"`
+	Model        string `json:"model,omitempty"`
+	// EstimatedCostUSD is derived from the model registry's pricing and MODEL_PRICES.
+	EstimatedCostUSD float64     `json:"estimated_cost_usd,omitempty"`
+	Provenance       *Provenance `json:"provenance,omitempty"`
+	Warnings         []Warning   `json:"warnings,omitempty"`
+	// Validation reports the language of the code and whether it is valid Clarity.
+	Validation *CodeValidation `json:"validation,omitempty"`
+	// Citations lists the retrieved chunks the response was generated from.
+	Citations []Citation `json:"citations,omitempty"`
+	// Files are the files of a JSON mode answer; the main contract is also in Code.
+	Files []ProjectFile `json:"files,omitempty"`
+	// ToolCalls are functions the model asked the client to run before it answers.
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Interrupted marks a partial response cut short by cancellation.
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Text is the raw assistant output, kept so interrupted answers can be resumed.
+	Text string `json:"-"`
 }
 
 // Service describes a generic code generation provider.
@@ -25,13 +45,108 @@ type Service interface {
 	GenerateCode(ctx context.Context, query string, codeContexts []string, docContexts []string, temperature float64, maxTokens int) (*CodeGenerationResponse, error)
 }
 
+// DeltaFunc receives incremental assistant text while a response is streamed.
+type DeltaFunc func(delta string)
+
+// StreamingService is a Service that can report text deltas as the provider produces them.
+type StreamingService interface {
+	Service
+	GenerateCodeStream(ctx context.Context, query string, codeContexts []string, docContexts []string, temperature float64, maxTokens int, onDelta DeltaFunc) (*CodeGenerationResponse, error)
+}
+
+// HealthChecker is implemented by providers that can verify their credentials and model.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
 // ProviderFromEnv determines which provider is configured via environment variables.
 func ProviderFromEnv() string {
 	provider := strings.TrimSpace(strings.ToLower(os.Getenv("CODEGEN_PROVIDER")))
 	switch provider {
-	case ProviderOpenAI, ProviderClaude, ProviderGemini:
+	case ProviderOpenAI, ProviderClaude, ProviderGemini, ProviderLocal:
 		return provider
 	default:
 		return ProviderGemini
 	}
 }
+
+// NewServiceFromEnv creates the provider's service from its environment configuration,
+// generating with model instead of the configured model when set.
+func NewServiceFromEnv(provider, model string) (Service, error) {
+	switch provider {
+	case ProviderOpenAI:
+		service, err := NewOpenAIServiceFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		if model != "" {
+			service.model = model
+		}
+		return service, nil
+	case ProviderClaude:
+		service, err := NewClaudeServiceFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		if model != "" {
+			service.model = model
+		}
+		return service, nil
+	case ProviderLocal:
+		service, err := NewLocalServiceFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		if model != "" {
+			service.model = model
+		}
+		return service, nil
+	default:
+		service, err := NewGeminiServiceFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		if model != "" {
+			service.model = model
+		}
+		return service, nil
+	}
+}
+
+// NewServiceWithAPIKey creates the provider's service like NewServiceFromEnv, but
+// authenticating with apiKey instead of the server's key. The local provider has no key of
+// its own and is not supported.
+func NewServiceWithAPIKey(provider, model, apiKey string) (Service, error) {
+	if model == "" {
+		model = ConfiguredModel(provider)
+	}
+	switch provider {
+	case ProviderOpenAI:
+		return NewOpenAIService(apiKey, model, os.Getenv("OPENAI_BASE_URL"), ""), nil
+	case ProviderClaude:
+		return NewClaudeService(apiKey, model, os.Getenv("CLAUDE_BASE_URL"), os.Getenv("CLAUDE_API_VERSION"), ""), nil
+	case ProviderGemini:
+		service, err := NewGeminiService(apiKey)
+		if err != nil {
+			return nil, err
+		}
+		service.model = model
+		return service, nil
+	default:
+		return nil, fmt.Errorf("provider %s does not accept API keys", provider)
+	}
+}
+
+// ProviderFallbackWarning returns a warning when CODEGEN_PROVIDER names an unknown provider
+// and ProviderFromEnv fell back to Gemini.
+func ProviderFallbackWarning() *Warning {
+	requested := strings.TrimSpace(strings.ToLower(os.Getenv("CODEGEN_PROVIDER")))
+	if requested == "" || requested == ProviderFromEnv() {
+		return nil
+	}
+	return &Warning{
+		Code:    WarningProviderFallback,
+		Message: "Unknown provider " + requested + " configured; fell back to " + ProviderGemini,
+		Detail:  requested,
+	}
+}
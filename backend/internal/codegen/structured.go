@@ -0,0 +1,166 @@
+package codegen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Response formats accepted by WithResponseFormat.
+const (
+	// ResponseFormatText parses the code out of markdown fences. It is the default.
+	ResponseFormatText = "text"
+	// ResponseFormatJSON asks providers with a JSON mode for a validated {code, explanation, files}
+	// object. Other providers fall back to ResponseFormatText.
+	ResponseFormatJSON = "json"
+)
+
+// IsResponseFormat reports whether format is a supported response format.
+func IsResponseFormat(format string) bool {
+	return format == ResponseFormatText || format == ResponseFormatJSON
+}
+
+const structuredInstructions = `## Instructions:
+Provide a clear, working Clarity code solution based on the examples above, with a brief
+explanation of how the code works.
+
+Respond with a single JSON object and nothing else:
+{"code": "<the main Clarity contract>", "explanation": "<how the code works>", "files": [{"path": "contracts/<name>.clar", "language": "clarity", "content": "<file contents>"}]}
+
+Put the complete code in "code". List every file the answer needs in "files", including the
+main contract; use an empty array when the answer is a single snippet. Do not wrap the JSON
+or the code in markdown fences.
+`
+
+// structuredOutputSchema is the JSON Schema of the object requested in JSON mode. It keeps
+// to the subset OpenAI's strict mode accepts.
+var structuredOutputSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"code":        map[string]any{"type": "string"},
+		"explanation": map[string]any{"type": "string"},
+		"files": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"path":     map[string]any{"type": "string"},
+					"language": map[string]any{"type": "string"},
+					"content":  map[string]any{"type": "string"},
+				},
+				"required":             []string{"path", "language", "content"},
+				"additionalProperties": false,
+			},
+		},
+	},
+	"required":             []string{"code", "explanation", "files"},
+	"additionalProperties": false,
+}
+
+type responseFormatKey struct{}
+
+// WithResponseFormat sets how providers return code: ResponseFormatText or ResponseFormatJSON.
+func WithResponseFormat(ctx context.Context, format string) context.Context {
+	return context.WithValue(ctx, responseFormatKey{}, format)
+}
+
+func structuredOutputRequested(ctx context.Context) bool {
+	format, _ := ctx.Value(responseFormatKey{}).(string)
+	return format == ResponseFormatJSON
+}
+
+// supportsStructuredOutput reports whether the provider has a JSON mode. Local servers are
+// excluded because OpenAI-compatible servers differ in whether they honor json_schema.
+func supportsStructuredOutput(provider string) bool {
+	return provider == ProviderOpenAI || provider == ProviderGemini
+}
+
+// structuredOutputActive reports whether the provider should be asked for JSON. Tool calls
+// and multi-file projects keep their own formats.
+func structuredOutputActive(ctx context.Context, provider string) bool {
+	if !structuredOutputRequested(ctx) || !supportsStructuredOutput(provider) {
+		return false
+	}
+	if _, ok := ToolsFromContext(ctx); ok {
+		return false
+	}
+	return !projectOutputRequested(ctx) && !testOutputRequested(ctx)
+}
+
+type structuredOutput struct {
+	Code        string        `json:"code"`
+	Explanation string        `json:"explanation"`
+	Files       []ProjectFile `json:"files"`
+}
+
+// parseStructuredOutput decodes and validates a JSON mode answer.
+func parseStructuredOutput(text string) (*structuredOutput, error) {
+	var out structuredOutput
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &out); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	files := make([]ProjectFile, 0, len(out.Files))
+	for i, file := range out.Files {
+		cleaned, ok := cleanProjectPath(file.Path)
+		if !ok {
+			return nil, fmt.Errorf("files[%d] has an invalid path %q", i, file.Path)
+		}
+		if strings.TrimSpace(file.Content) == "" {
+			return nil, fmt.Errorf("files[%d] (%s) has no content", i, cleaned)
+		}
+		file.Path = cleaned
+		file.Language = projectFileLanguage(cleaned, strings.TrimSpace(file.Language))
+		files = append(files, file)
+	}
+	out.Files = files
+
+	out.Code = strings.TrimSpace(out.Code)
+	if out.Code == "" {
+		for _, file := range files {
+			if strings.HasSuffix(file.Path, ".clar") {
+				out.Code = strings.TrimSpace(file.Content)
+				break
+			}
+		}
+	}
+	if out.Code == "" {
+		return nil, errors.New("no code")
+	}
+	out.Explanation = strings.TrimSpace(out.Explanation)
+	return &out, nil
+}
+
+// applyStructuredOutput replaces the fence-extracted code with the JSON mode answer when
+// one was requested. When the provider has no JSON mode or its answer does not validate, the
+// fence extraction stands and a warning says so.
+func applyStructuredOutput(ctx context.Context, provider string, resp *CodeGenerationResponse) {
+	if !structuredOutputRequested(ctx) || projectOutputRequested(ctx) || testOutputRequested(ctx) {
+		return
+	}
+	if !structuredOutputActive(ctx, provider) {
+		if len(resp.ToolCalls) == 0 {
+			resp.AddWarning(Warning{
+				Code:    WarningStructuredOutputFallback,
+				Message: "JSON mode is not available for this request; the code was extracted from markdown",
+				Detail:  provider,
+			})
+		}
+		return
+	}
+
+	out, err := parseStructuredOutput(resp.Text)
+	if err != nil {
+		resp.AddWarning(Warning{
+			Code:    WarningStructuredOutputFallback,
+			Message: "The provider's JSON answer did not validate; the code was extracted from markdown",
+			Detail:  err.Error(),
+		})
+		return
+	}
+	resp.Code = out.Code
+	resp.Explanation = out.Explanation
+	resp.Files = out.Files
+}
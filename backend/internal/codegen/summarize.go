@@ -0,0 +1,36 @@
+package codegen
+
+import (
+	"context"
+	"strings"
+)
+
+const (
+	summaryMaxTokens   = 1024
+	summaryTemperature = 0.2
+)
+
+// summarySystemMessage instructs providers to condense history rather than generate code.
+const summarySystemMessage = "You summarize conversations between a developer and a Clarity smart contract assistant. " +
+	"Write a concise summary that preserves the user's goals, decisions, requirements, contract and " +
+	"function names, and any code the assistant produced that later turns may refer to. " +
+	"Reply with the summary only."
+
+// Summarizer is implemented by providers that can condense conversation history.
+type Summarizer interface {
+	Summarize(ctx context.Context, previousSummary, transcript string) (string, error)
+}
+
+// buildSummaryPrompt asks for a summary of transcript that folds in the previous summary.
+func buildSummaryPrompt(previousSummary, transcript string) string {
+	var builder strings.Builder
+	if previousSummary = strings.TrimSpace(previousSummary); previousSummary != "" {
+		builder.WriteString("Summary of the conversation so far:\n")
+		builder.WriteString(previousSummary)
+		builder.WriteString("\n\nUpdate the summary with these later turns:\n")
+	} else {
+		builder.WriteString("Summarize these conversation turns:\n")
+	}
+	builder.WriteString(transcript)
+	return builder.String()
+}
@@ -0,0 +1,297 @@
+package codegen
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/clarity"
+)
+
+// DefaultTestContractName names the contract under test when the caller does not.
+const DefaultTestContractName = "contract"
+
+// Warning codes of generated tests.
+const (
+	WarningInvalidTest     = "invalid_test"
+	WarningIncompleteTests = "incomplete_tests"
+)
+
+const testInstructions = `## Instructions:
+Write unit tests for the contract above with the Clarinet SDK and vitest, based on the examples
+above. Use the simnet global (simnet.callPublicFn, simnet.callReadOnlyFn,
+simnet.getAccounts()) and the Cl helpers from @stacks/transactions, and reference the contract
+by the name given above. Cover every public and read-only function, including the error
+paths of each asserts!.
+
+Output every file as a heading with its path followed by a single fenced code block with the
+complete file contents, for example:
+
+### File: tests/counter.test.ts
+` + "```typescript\n[file contents]\n```" + `
+
+After the files, add:
+
+**Explanation:**
+[what the tests cover]
+`
+
+type testOutputKey struct{}
+
+// WithTestOutput asks providers to answer with unit test files for the contract in the query.
+func WithTestOutput(ctx context.Context) context.Context {
+	return context.WithValue(ctx, testOutputKey{}, true)
+}
+
+func testOutputRequested(ctx context.Context) bool {
+	requested, _ := ctx.Value(testOutputKey{}).(bool)
+	return requested
+}
+
+// TestContractName sanitizes the name of the contract under test like a project name.
+func TestContractName(name string) string {
+	if strings.TrimSpace(name) == "" {
+		return DefaultTestContractName
+	}
+	return SanitizeProjectName(name)
+}
+
+// TestGenerationQuery builds the query asking for tests of contract, deployed as name, with
+// the caller's extra instructions.
+func TestGenerationQuery(name, contract, instructions string) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Write unit tests for the Clarity contract deployed as %q:\n\n", name)
+	builder.WriteString("```clarity\n")
+	builder.WriteString(strings.TrimSpace(contract))
+	builder.WriteString("\n```\n")
+	if instructions = strings.TrimSpace(instructions); instructions != "" {
+		builder.WriteString("\n")
+		builder.WriteString(instructions)
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// TestFile is a generated test file with the outcome of checking that it parses.
+type TestFile struct {
+	ProjectFile
+	Valid bool `json:"valid"`
+	// Error explains why the file does not parse.
+	Error string `json:"error,omitempty"`
+}
+
+// TestGenerationResponse holds generated unit tests for a contract.
+type TestGenerationResponse struct {
+	ContractName     string      `json:"contract_name"`
+	Files            []TestFile  `json:"files"`
+	Valid            bool        `json:"valid"`
+	Explanation      string      `json:"explanation"`
+	InputTokens      int         `json:"input_tokens"`
+	OutputTokens     int         `json:"output_tokens"`
+	Model            string      `json:"model,omitempty"`
+	EstimatedCostUSD float64     `json:"estimated_cost_usd,omitempty"`
+	Provenance       *Provenance `json:"provenance,omitempty"`
+	Warnings         []Warning   `json:"warnings,omitempty"`
+	Citations        []Citation  `json:"citations,omitempty"`
+}
+
+// NewTestsResponse parses the files out of a response generated with WithTestOutput and
+// checks that each parses. When the model ignored the file format, the extracted code
+// becomes a single test file.
+func NewTestsResponse(resp *CodeGenerationResponse, name string) *TestGenerationResponse {
+	tests := &TestGenerationResponse{
+		ContractName:     TestContractName(name),
+		InputTokens:      resp.InputTokens,
+		OutputTokens:     resp.OutputTokens,
+		Model:            resp.Model,
+		EstimatedCostUSD: resp.EstimatedCostUSD,
+		Provenance:       resp.Provenance,
+		Citations:        resp.Citations,
+		Valid:            true,
+	}
+
+	text := resp.Text
+	if text == "" {
+		text = resp.Code
+	}
+	files, explanation := parseProjectFiles(text)
+	tests.Explanation = explanation
+	if tests.Explanation == "" {
+		tests.Explanation = resp.Explanation
+	}
+
+	if len(files) == 0 && resp.Code != "" {
+		files = []ProjectFile{{
+			Path:     "tests/" + tests.ContractName + ".test.ts",
+			Language: "typescript",
+			Content:  resp.Code,
+		}}
+		tests.addWarning(Warning{
+			Code:    WarningIncompleteTests,
+			Message: "The response was not split into files; the code was saved as a single test file",
+		})
+	}
+
+	hasTest := false
+	for _, file := range files {
+		checked := TestFile{ProjectFile: file, Valid: true}
+		if err := checkTestFileSyntax(file); err != nil {
+			checked.Valid, checked.Error = false, err.Error()
+			tests.Valid = false
+			tests.addWarning(Warning{
+				Code:    WarningInvalidTest,
+				Message: file.Path + " does not parse: " + err.Error(),
+				Detail:  file.Path,
+			})
+		}
+		if isTestFile(file.Path) {
+			hasTest = true
+		}
+		tests.Files = append(tests.Files, checked)
+	}
+	if len(files) > 0 && !hasTest {
+		tests.Valid = false
+		tests.addWarning(Warning{
+			Code:    WarningIncompleteTests,
+			Message: "The response contains no *.test.ts file",
+		})
+	}
+
+	// Keep the generation's caveats, minus the Clarity checks that do not apply to tests.
+	for _, w := range resp.Warnings {
+		switch w.Code {
+		case WarningNoCode, WarningDeprecatedFunction, WarningRequiresClarity2, WarningRequiresClarity3:
+			if hasTest || w.Code != WarningNoCode {
+				continue
+			}
+		}
+		tests.addWarning(w)
+	}
+	return tests
+}
+
+func (t *TestGenerationResponse) addWarning(w Warning) {
+	for _, existing := range t.Warnings {
+		if existing == w {
+			return
+		}
+	}
+	t.Warnings = append(t.Warnings, w)
+}
+
+var testFileName = regexp.MustCompile(`\.(test|spec)\.[cm]?[jt]sx?$`)
+
+func isTestFile(filePath string) bool {
+	return testFileName.MatchString(path.Base(filePath))
+}
+
+// checkTestFileSyntax checks Clarity files with the Clarity parser and script files for
+// balanced brackets, strings and comments. It does not type-check scripts.
+func checkTestFileSyntax(file ProjectFile) error {
+	switch strings.ToLower(path.Ext(file.Path)) {
+	case ".clar":
+		_, err := clarity.Parse(file.Content)
+		return err
+	case ".ts", ".js", ".mts", ".mjs", ".cts", ".cjs", ".tsx", ".jsx":
+		if err := checkScriptBrackets(file.Content); err != nil {
+			return err
+		}
+		if isTestFile(file.Path) && !strings.Contains(file.Content, "it(") && !strings.Contains(file.Content, "test(") {
+			return fmt.Errorf("no it() or test() cases")
+		}
+	}
+	return nil
+}
+
+// checkScriptBrackets reports unbalanced (), [] or {} and unterminated strings, template
+// literals and block comments in JavaScript or TypeScript source. Template literal
+// placeholders are checked like code.
+func checkScriptBrackets(src string) error {
+	type open struct {
+		char byte
+		line int
+	}
+	var (
+		stack []open
+		line  = 1
+	)
+	closing := map[byte]byte{')': '(', ']': '[', '}': '{'}
+
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			line++
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			start := line
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return fmt.Errorf("line %d: unterminated comment", start)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 3
+		case c == '"' || c == '\'':
+			start := line
+			for i++; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' {
+					i++
+				} else if src[i] == '\n' {
+					return fmt.Errorf("line %d: unterminated string", start)
+				}
+			}
+			if i >= len(src) {
+				return fmt.Errorf("line %d: unterminated string", start)
+			}
+		case c == '`':
+			stack = append(stack, open{'`', line})
+		case c == '(' || c == '[' || c == '{':
+			stack = append(stack, open{c, line})
+		case c == ')' || c == ']' || c == '}':
+			if len(stack) == 0 || stack[len(stack)-1].char != closing[c] {
+				return fmt.Errorf("line %d: unexpected %q", line, c)
+			}
+			stack = stack[:len(stack)-1]
+		}
+
+		// Inside a template literal, skip text up to the closing backtick or a placeholder.
+		if len(stack) > 0 && stack[len(stack)-1].char == '`' && (c == '`' || c == '}') {
+			for i++; i < len(src); i++ {
+				if src[i] == '\\' {
+					i++
+					continue
+				}
+				if src[i] == '\n' {
+					line++
+				}
+				if src[i] == '`' {
+					stack = stack[:len(stack)-1]
+					break
+				}
+				if src[i] == '$' && i+1 < len(src) && src[i+1] == '{' {
+					i++
+					stack = append(stack, open{'{', line})
+					break
+				}
+			}
+			if i >= len(src) {
+				return fmt.Errorf("line %d: unterminated template literal", stack[len(stack)-1].line)
+			}
+		}
+	}
+
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if top.char == '`' {
+			return fmt.Errorf("line %d: unterminated template literal", top.line)
+		}
+		return fmt.Errorf("line %d: unclosed %q", top.line, top.char)
+	}
+	return nil
+}
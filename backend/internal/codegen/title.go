@@ -0,0 +1,76 @@
+package codegen
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	titleMaxTokens   = 32
+	titleTemperature = 0.2
+
+	defaultTitleTimeout = 15 * time.Second
+	// maxTitleChars caps a generated title so a rambling reply cannot become one.
+	maxTitleChars = 80
+)
+
+// titleSystemMessage instructs providers to name a conversation from its first message.
+const titleSystemMessage = "You name conversations between a developer and a Clarity smart contract assistant. " +
+	"Given the developer's first message, reply with a short title of at most six words that says what " +
+	"they want, such as \"SIP-010 token with pausable transfers\". Reply with the title only, on a single " +
+	"line, without quotes or a trailing period."
+
+// TitleGenerator is implemented by providers that can name a conversation.
+type TitleGenerator interface {
+	GenerateTitle(ctx context.Context, message string) (string, error)
+}
+
+// TitleConfig controls generating conversation titles after the first exchange.
+type TitleConfig struct {
+	Enabled bool
+	// Model generates titles instead of the model answering the request, e.g. a cheaper one.
+	Model string
+	// Timeout bounds the title call; on timeout the first message keeps serving as the title.
+	Timeout time.Duration
+}
+
+// TitleConfigFromEnv reads CONVERSATION_TITLE_ENABLED, CONVERSATION_TITLE_MODEL and
+// CONVERSATION_TITLE_TIMEOUT.
+func TitleConfigFromEnv() TitleConfig {
+	cfg := TitleConfig{
+		Enabled: true,
+		Model:   strings.TrimSpace(os.Getenv("CONVERSATION_TITLE_MODEL")),
+		Timeout: defaultTitleTimeout,
+	}
+	if enabled, err := strconv.ParseBool(os.Getenv("CONVERSATION_TITLE_ENABLED")); err == nil {
+		cfg.Enabled = enabled
+	}
+	if d, err := time.ParseDuration(os.Getenv("CONVERSATION_TITLE_TIMEOUT")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	return cfg
+}
+
+// buildTitlePrompt asks for a title for a conversation opened with message.
+func buildTitlePrompt(message string) string {
+	return "First message:\n" + strings.TrimSpace(message) + "\n\nTitle:"
+}
+
+// cleanTitle normalizes a generator's reply to a single-line title. It returns an empty
+// string when the reply holds no usable title.
+func cleanTitle(reply string) string {
+	reply = strings.TrimSpace(reply)
+	if line, _, ok := strings.Cut(reply, "\n"); ok {
+		reply = strings.TrimSpace(line)
+	}
+	reply = strings.TrimSpace(strings.TrimPrefix(reply, "Title:"))
+	reply = strings.Trim(reply, "\"'`*#")
+	reply = strings.TrimRight(strings.TrimSpace(reply), ".")
+	if len(reply) > maxTitleChars {
+		reply = strings.ToValidUTF8(reply[:maxTitleChars], "")
+	}
+	return strings.TrimSpace(reply)
+}
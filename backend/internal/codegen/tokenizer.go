@@ -0,0 +1,208 @@
+package codegen
+
+import (
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer counts the tokens a model sees for a piece of text.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+var (
+	tokenizerMu     sync.RWMutex
+	activeTokenizer Tokenizer = pretokenizer{}
+)
+
+// SetTokenizer replaces the tokenizer used when a provider does not report usage,
+// e.g. with an exact BPE encoder such as tiktoken-go. Passing nil restores the default.
+func SetTokenizer(t Tokenizer) {
+	tokenizerMu.Lock()
+	defer tokenizerMu.Unlock()
+	if t == nil {
+		t = pretokenizer{}
+	}
+	activeTokenizer = t
+}
+
+// CountTokens counts the tokens in text with the active tokenizer.
+func CountTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	tokenizerMu.RLock()
+	t := activeTokenizer
+	tokenizerMu.RUnlock()
+	return t.CountTokens(text)
+}
+
+// pretokenizer splits text the way tiktoken's cl100k/o200k pattern does (contractions,
+// letter runs with one leading space or symbol, digit groups of up to three, punctuation
+// runs and whitespace) and estimates the BPE merges within each piece. It tracks tiktoken
+// far more closely than a characters-per-token ratio without shipping the vocabulary files.
+type pretokenizer struct{}
+
+func (pretokenizer) CountTokens(text string) int {
+	tokens := 0
+	for len(text) > 0 {
+		n, pieceTokens := nextPiece(text)
+		tokens += pieceTokens
+		text = text[n:]
+	}
+	return tokens
+}
+
+// nextPiece returns the byte length of the next pre-token in text and its estimated token count.
+func nextPiece(text string) (int, int) {
+	r, size := utf8.DecodeRuneInString(text)
+
+	// Contractions: 's 't 're 've 'm 'll 'd
+	if r == '\'' {
+		if n := contractionLength(text[size:]); n > 0 {
+			return size + n, 1
+		}
+	}
+
+	// Letters, optionally led by a single space or symbol (" hello", "-public", "(define")
+	if !isNewline(r) && !unicode.IsNumber(r) {
+		start := 0
+		if !unicode.IsLetter(r) {
+			start = size
+		}
+		if letters, runes, wide := scanLetters(text[start:]); letters > 0 {
+			return start + letters, wordTokens(runes, wide)
+		}
+	}
+
+	// Digits in groups of up to three
+	if unicode.IsNumber(r) {
+		n, count := 0, 0
+		for n < len(text) && count < 3 {
+			d, s := utf8.DecodeRuneInString(text[n:])
+			if !unicode.IsNumber(d) {
+				break
+			}
+			n += s
+			count++
+		}
+		return n, 1
+	}
+
+	// Punctuation runs with an optional leading space and trailing newlines
+	if !unicode.IsSpace(r) || (r == ' ' && len(text) > size && isSymbol(text[size:])) {
+		n := 0
+		if r == ' ' {
+			n = size
+		}
+		runes := 0
+		for n < len(text) {
+			p, s := utf8.DecodeRuneInString(text[n:])
+			if unicode.IsSpace(p) || unicode.IsLetter(p) || unicode.IsNumber(p) {
+				break
+			}
+			n += s
+			runes++
+		}
+		for n < len(text) && isNewline(rune(text[n])) {
+			n++
+		}
+		// Common runs such as "))" or "::" merge into one token
+		return n, (runes + 1) / 2
+	}
+
+	// Whitespace: indentation and blank lines merge into a handful of tokens
+	n := 0
+	for n < len(text) {
+		w, s := utf8.DecodeRuneInString(text[n:])
+		if !unicode.IsSpace(w) {
+			break
+		}
+		n += s
+	}
+	// Leave a single space to lead the next word, as tiktoken's \s+(?!\S) does
+	if n > 1 && n < len(text) && text[n-1] == ' ' {
+		n--
+	}
+	return n, (n + 15) / 16
+}
+
+func contractionLength(text string) int {
+	for _, suffix := range []string{"ll", "re", "ve", "s", "t", "m", "d"} {
+		if len(text) >= len(suffix) && equalFoldASCII(text[:len(suffix)], suffix) {
+			if len(text) == len(suffix) {
+				return len(suffix)
+			}
+			next, _ := utf8.DecodeRuneInString(text[len(suffix):])
+			if !unicode.IsLetter(next) {
+				return len(suffix)
+			}
+		}
+	}
+	return 0
+}
+
+// scanLetters returns the byte length of the letter run at the start of text, its rune
+// count and whether it contains characters outside Latin script.
+func scanLetters(text string) (int, int, bool) {
+	n, runes, wide := 0, 0, false
+	for n < len(text) {
+		r, s := utf8.DecodeRuneInString(text[n:])
+		if !unicode.IsLetter(r) && !unicode.Is(unicode.Mn, r) {
+			break
+		}
+		if r > unicode.MaxLatin1 && !unicode.Is(unicode.Latin, r) {
+			wide = true
+		}
+		n += s
+		runes++
+	}
+	return n, runes, wide
+}
+
+// wordTokens estimates the BPE tokens in a word: common words are a single token,
+// long identifiers split roughly every six characters, and non-Latin scripts take
+// about one token per character.
+func wordTokens(runes int, wide bool) int {
+	if wide {
+		return runes
+	}
+	if runes <= 6 {
+		return 1
+	}
+	return (runes + 5) / 6
+}
+
+func isSymbol(text string) bool {
+	r, _ := utf8.DecodeRuneInString(text)
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+func isNewline(r rune) bool {
+	return r == '\n' || r == '\r'
+}
+
+func equalFoldASCII(a, b string) bool {
+	for i := 0; i < len(a); i++ {
+		c := a[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fillMissingUsage estimates the token counts a provider did not report, as happens with
+// OpenAI-compatible servers that ignore stream usage options.
+func fillMissingUsage(resp *CodeGenerationResponse, systemMessage, prompt string) {
+	if resp.InputTokens == 0 {
+		resp.InputTokens = CountTokens(systemMessage) + CountTokens(prompt)
+	}
+	if resp.OutputTokens == 0 {
+		resp.OutputTokens = CountTokens(resp.Text)
+	}
+}
@@ -0,0 +1,141 @@
+package codegen
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Tool choice modes accepted by ToolChoice.Mode.
+const (
+	ToolChoiceAuto     = "auto"
+	ToolChoiceNone     = "none"
+	ToolChoiceRequired = "required"
+	ToolChoiceFunction = "function"
+)
+
+// Tool is a client-defined function the model may call.
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON Schema of the function's arguments object.
+	Parameters map[string]any
+}
+
+// ToolChoice controls whether the model calls a tool. The zero value lets the provider decide.
+type ToolChoice struct {
+	Mode string
+	// Name is the function the model must call when Mode is ToolChoiceFunction.
+	Name string
+}
+
+// ToolCall is a function call requested by the model, to be executed by the client.
+type ToolCall struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Arguments is the call's arguments as a JSON object.
+	Arguments string `json:"arguments"`
+}
+
+// ToolResult is the output the client returned for one tool call.
+type ToolResult struct {
+	CallID  string
+	Content string
+}
+
+// ToolTurn is one round of the tool loop: the calls the model made and the results the
+// client sent back for them.
+type ToolTurn struct {
+	// Text is any assistant text that accompanied the calls.
+	Text    string
+	Calls   []ToolCall
+	Results []ToolResult
+}
+
+// CallName returns the function name of the call with the given ID.
+func (t ToolTurn) CallName(id string) string {
+	for _, call := range t.Calls {
+		if call.ID == id {
+			return call.Name
+		}
+	}
+	return ""
+}
+
+// ToolRequest carries the tools offered for a generation and the tool rounds that followed
+// the user's message.
+type ToolRequest struct {
+	Tools  []Tool
+	Choice ToolChoice
+	Turns  []ToolTurn
+}
+
+type toolsKey struct{}
+
+// WithTools offers tools to the provider and replays earlier tool rounds after the prompt.
+// Responses may then carry ToolCalls instead of, or alongside, text.
+func WithTools(ctx context.Context, tools ToolRequest) context.Context {
+	return context.WithValue(ctx, toolsKey{}, tools)
+}
+
+// ToolsFromContext returns the tool request set with WithTools.
+func ToolsFromContext(ctx context.Context) (ToolRequest, bool) {
+	tools, ok := ctx.Value(toolsKey{}).(ToolRequest)
+	return tools, ok && (len(tools.Tools) > 0 || len(tools.Turns) > 0)
+}
+
+// toolArguments decodes a call's JSON arguments, treating empty or invalid input as no arguments.
+func toolArguments(arguments string) map[string]any {
+	args := map[string]any{}
+	if strings.TrimSpace(arguments) != "" {
+		_ = json.Unmarshal([]byte(arguments), &args)
+	}
+	return args
+}
+
+// encodeToolArguments renders provider-decoded arguments as a JSON object.
+func encodeToolArguments(args map[string]any) string {
+	if len(args) == 0 {
+		return "{}"
+	}
+	data, err := json.Marshal(args)
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// toolOutput passes JSON tool output through decoded so providers that take structured
+// results see its fields; anything else is sent as text.
+func toolOutput(content string) any {
+	var decoded any
+	if err := json.Unmarshal([]byte(content), &decoded); err == nil {
+		return decoded
+	}
+	return content
+}
+
+// toStringSlice converts a decoded JSON array of strings.
+func toStringSlice(value any) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []any:
+		strs := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				strs = append(strs, str)
+			}
+		}
+		return strs
+	default:
+		return nil
+	}
+}
+
+// newToolCallID names calls from providers that do not assign IDs themselves.
+func newToolCallID() string {
+	return "call_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
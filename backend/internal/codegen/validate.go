@@ -0,0 +1,283 @@
+package codegen
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/clarity"
+)
+
+// Code validation statuses.
+const (
+	// ValidationValid is Clarity that parses; lint findings are reported but do not fail it.
+	ValidationValid = "valid"
+	// ValidationInvalid is a contract in another language, such as Solidity, or Clarity that
+	// does not parse.
+	ValidationInvalid = "invalid"
+	// ValidationOther is code that is not a contract, such as Stacks.js client code or shell
+	// commands. It is not regenerated.
+	ValidationOther = "other"
+	// ValidationNoCode is an answer without a code block.
+	ValidationNoCode = "no_code"
+)
+
+// Languages reported by code validation besides the fence tags it normalizes.
+const (
+	LanguageClarity = "clarity"
+	LanguageUnknown = "unknown"
+)
+
+// WarningInvalidCode marks an answer whose code is still not valid Clarity after every retry.
+const WarningInvalidCode = "invalid_code"
+
+const (
+	defaultValidationRetries = 1
+	maxValidationRetries     = 3
+)
+
+// ValidationConfig controls checking generated code and regenerating answers whose code is
+// not Clarity.
+type ValidationConfig struct {
+	Enabled bool
+	// Retries is how many times an answer with invalid code is regenerated; 0 only
+	// annotates it.
+	Retries int
+}
+
+// ValidationConfigFromEnv reads CODE_VALIDATION_ENABLED (default true) and
+// CODE_VALIDATION_RETRIES (default 1, at most 3).
+func ValidationConfigFromEnv() ValidationConfig {
+	cfg := ValidationConfig{Enabled: true, Retries: defaultValidationRetries}
+	if enabled, err := strconv.ParseBool(os.Getenv("CODE_VALIDATION_ENABLED")); err == nil {
+		cfg.Enabled = enabled
+	}
+	if retries, err := strconv.Atoi(strings.TrimSpace(os.Getenv("CODE_VALIDATION_RETRIES"))); err == nil && retries >= 0 {
+		cfg.Retries = min(retries, maxValidationRetries)
+	}
+	return cfg
+}
+
+// CodeValidation reports what language an answer's code is in and whether it is valid
+// Clarity, with the linter's findings.
+type CodeValidation struct {
+	Status   string `json:"status"`
+	Language string `json:"language,omitempty"`
+	// Reason explains an invalid status.
+	Reason      string               `json:"reason,omitempty"`
+	Diagnostics []clarity.Diagnostic `json:"diagnostics,omitempty"`
+	Summary     *clarity.Summary     `json:"summary,omitempty"`
+	// Attempts counts the generations made, including regenerations.
+	Attempts int `json:"attempts"`
+}
+
+// fenceLanguages normalizes code fence tags.
+var fenceLanguages = map[string]string{
+	"clarity":    LanguageClarity,
+	"clar":       LanguageClarity,
+	"solidity":   "solidity",
+	"sol":        "solidity",
+	"rust":       "rust",
+	"rs":         "rust",
+	"python":     "python",
+	"py":         "python",
+	"javascript": "javascript",
+	"js":         "javascript",
+	"typescript": "typescript",
+	"ts":         "typescript",
+	"go":         "go",
+	"golang":     "go",
+	"move":       "move",
+	"vyper":      "vyper",
+	"bash":       "shell",
+	"sh":         "shell",
+	"shell":      "shell",
+	"toml":       "toml",
+	"json":       "json",
+	"yaml":       "yaml",
+}
+
+// contractLanguages are the smart contract languages answers are regenerated for.
+var contractLanguages = map[string]bool{
+	"solidity": true,
+	"vyper":    true,
+	"move":     true,
+	"rust":     true,
+}
+
+// languageSignatures recognize code by constructs Clarity never contains, checked in order.
+var languageSignatures = []struct {
+	language string
+	pattern  *regexp.Regexp
+}{
+	{"solidity", regexp.MustCompile(`(?m)pragma\s+solidity|^\s*(abstract\s+)?contract\s+\w+(\s+is\s+[\w, ]+)?\s*\{|\bmapping\s*\(|\bmsg\.sender\b|\bfunction\s+\w+\s*\([^)]*\)\s*(public|external|internal|private)`)},
+	{"vyper", regexp.MustCompile(`(?m)^#\s*@version|^@external\b`)},
+	{"move", regexp.MustCompile(`(?m)^\s*module\s+[\w:]+\s*\{|\bpublic\s+(entry\s+)?fun\s+\w+`)},
+	{"rust", regexp.MustCompile(`(?m)\bfn\s+\w+\s*[(<]|\blet\s+mut\s+|^\s*(pub\s+)?(struct|impl|enum|mod|use)\s+\w`)},
+	{"go", regexp.MustCompile(`(?m)^package\s+\w+|^func\s+(\([^)]*\)\s*)?\w+\s*\(`)},
+	{"python", regexp.MustCompile(`(?m)^\s*def\s+\w+\s*\(.*\)\s*(->.*)?:\s*$|^\s*(from\s+[\w.]+\s+)?import\s+[\w.]+(\s+as\s+\w+)?\s*$`)},
+	{"typescript", regexp.MustCompile(`(?m)^\s*(export\s+)?(interface|type)\s+\w+|:\s*(string|number|boolean)\b[;,)=]`)},
+	{"javascript", regexp.MustCompile(`(?m)\b(const|let|var)\s+\w+\s*=|\bfunction\s+\w+\s*\(|=>|\brequire\(|^\s*import\s+.+\s+from\s+['"]`)},
+}
+
+// fencePattern matches a fenced code block, capturing its tag and body.
+var fencePattern = regexp.MustCompile("(?s)```([\\w+#-]*)[^\\n]*\\n(.*?)```")
+
+// ValidateCode detects the language of the answer's code and lints it when it is Clarity.
+// The tag of the fence the code was taken from is used when the code itself is ambiguous.
+func ValidateCode(resp *CodeGenerationResponse) *CodeValidation {
+	code := strings.TrimSpace(resp.Code)
+	if code == "" {
+		return &CodeValidation{Status: ValidationNoCode, Attempts: 1}
+	}
+
+	validation := &CodeValidation{Status: ValidationInvalid, Attempts: 1}
+	validation.Language = detectCodeLanguage(code, fenceTag(resp.Text, code))
+	switch {
+	case contractLanguages[validation.Language]:
+		validation.Reason = fmt.Sprintf("The code is %s, not Clarity", languageNames[validation.Language])
+		return validation
+	case validation.Language != LanguageClarity:
+		validation.Status = ValidationOther
+		return validation
+	}
+
+	result, err := clarity.Analyze(code, nil)
+	if err != nil {
+		validation.Reason = err.Error()
+		return validation
+	}
+	validation.Diagnostics = result.Diagnostics
+	validation.Summary = &result.Summary
+	for _, d := range result.Diagnostics {
+		if d.Code == clarity.CodeSyntaxError {
+			validation.Reason = "The Clarity code does not parse: " + d.String()
+			return validation
+		}
+	}
+	validation.Status = ValidationValid
+	return validation
+}
+
+// detectCodeLanguage returns the language of code: Clarity when every top-level form is a
+// list, otherwise the first language whose constructs it uses, then the fence tag.
+func detectCodeLanguage(code, tag string) string {
+	if forms, err := clarity.Parse(code); err == nil && len(forms) > 0 {
+		clarityForms := true
+		for _, form := range forms {
+			if form.Kind != clarity.ListNode {
+				clarityForms = false
+				break
+			}
+		}
+		if clarityForms {
+			return LanguageClarity
+		}
+	}
+	for _, signature := range languageSignatures {
+		if signature.pattern.MatchString(code) {
+			return signature.language
+		}
+	}
+	if language, ok := fenceLanguages[strings.ToLower(tag)]; ok {
+		return language
+	}
+	// Code that looks like Lisp but does not parse is treated as broken Clarity.
+	if strings.HasPrefix(code, "(") || strings.HasPrefix(code, ";;") {
+		return LanguageClarity
+	}
+	return LanguageUnknown
+}
+
+// fenceTag returns the tag of the fence in text whose body is code, or "".
+func fenceTag(text, code string) string {
+	for _, match := range fencePattern.FindAllStringSubmatch(text, -1) {
+		if strings.TrimSpace(match[2]) == code {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+// languageNames are the display names of detected languages.
+var languageNames = map[string]string{
+	"solidity":   "Solidity",
+	"rust":       "Rust",
+	"python":     "Python",
+	"javascript": "JavaScript",
+	"typescript": "TypeScript",
+	"go":         "Go",
+	"move":       "Move",
+	"vyper":      "Vyper",
+}
+
+// FenceLanguage returns the tag to fence the answer's code with: the detected language when
+// validation recognized one other than Clarity, and clarity otherwise.
+func FenceLanguage(resp *CodeGenerationResponse) string {
+	if v := resp.Validation; v != nil && v.Language != "" && v.Language != LanguageUnknown {
+		return v.Language
+	}
+	return LanguageClarity
+}
+
+// GenerateValidated calls generate with the query and, while the answer's code is not valid
+// Clarity and retries remain, again with a correction appended. The final answer is
+// annotated with its validation and counts the tokens of every attempt. A failed retry
+// returns the previous answer.
+func GenerateValidated(cfg ValidationConfig, query string, generate func(query string) (*CodeGenerationResponse, error)) (*CodeGenerationResponse, error) {
+	resp, err := generate(query)
+	if err != nil || !cfg.Enabled {
+		return resp, err
+	}
+
+	validation := ValidateCode(resp)
+	inputTokens, outputTokens := resp.InputTokens, resp.OutputTokens
+	for attempt := 1; validation.Status == ValidationInvalid && attempt <= cfg.Retries && len(resp.ToolCalls) == 0; attempt++ {
+		retry, err := generate(query + validationCorrection(validation))
+		if err != nil {
+			var interrupted *InterruptedError
+			if !errors.As(err, &interrupted) {
+				log.Printf("codegen: regenerating an answer with invalid code failed: %v", err)
+			}
+			break
+		}
+		inputTokens += retry.InputTokens
+		outputTokens += retry.OutputTokens
+
+		retried := ValidateCode(retry)
+		retried.Attempts = validation.Attempts + 1
+		if retried.Status == ValidationNoCode || retried.Status == ValidationOther {
+			// An answer without a contract is no improvement on one in the wrong language.
+			validation.Attempts = retried.Attempts
+			continue
+		}
+		resp, validation = retry, retried
+	}
+
+	resp.InputTokens, resp.OutputTokens = inputTokens, outputTokens
+	AnnotateValidation(resp, validation)
+	return resp, nil
+}
+
+// AnnotateValidation attaches the validation to the answer, with a warning when the code is
+// not valid Clarity.
+func AnnotateValidation(resp *CodeGenerationResponse, validation *CodeValidation) {
+	resp.Validation = validation
+	if validation.Status == ValidationInvalid {
+		resp.AddWarning(Warning{
+			Code:    WarningInvalidCode,
+			Message: validation.Reason,
+			Detail:  validation.Language,
+		})
+	}
+}
+
+// validationCorrection is appended to the query when an answer is regenerated.
+func validationCorrection(validation *CodeValidation) string {
+	return "\n\n## Correction:\n" + validation.Reason + ". Answer again with Clarity code for the Stacks " +
+		"blockchain in a ```clarity code block. Do not use Solidity, Rust or any other language.\n"
+}
@@ -0,0 +1,154 @@
+package codegen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Warning codes surfaced in generation responses.
+const (
+	WarningDeprecatedFunction = "deprecated_function"
+	WarningRequiresClarity2   = "requires_clarity_2"
+	WarningRequiresClarity3   = "requires_clarity_3"
+	WarningOutputTruncated    = "output_truncated"
+	WarningContextTruncated   = "context_truncated"
+	WarningNoContext          = "no_context"
+	WarningNoCode             = "no_code"
+	WarningProviderFallback   = "provider_fallback"
+	WarningModelDeprecated    = "model_deprecated"
+	WarningRetrieval          = "retrieval_warning"
+	WarningIncompleteProject  = "incomplete_project"
+	// WarningStructuredOutputFallback marks a JSON mode request answered from markdown fences.
+	WarningStructuredOutputFallback = "structured_output_fallback"
+)
+
+// Warning is a machine-readable caveat attached to a generation response.
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Detail carries the subject of the warning, e.g. the deprecated function name.
+	Detail string `json:"detail,omitempty"`
+}
+
+// AddWarning appends a warning unless an identical one is already present.
+func (r *CodeGenerationResponse) AddWarning(w Warning) {
+	for _, existing := range r.Warnings {
+		if existing == w {
+			return
+		}
+	}
+	r.Warnings = append(r.Warnings, w)
+}
+
+// deprecatedFunctions maps deprecated Clarity keywords/functions to their replacements.
+var deprecatedFunctions = map[string]string{
+	"block-height":    "stacks-block-height",
+	"get-block-info?": "get-stacks-block-info? or get-tenure-info?",
+}
+
+// clarity2Functions were introduced in Clarity 2.
+var clarity2Functions = []string{
+	"to-consensus-buff?",
+	"from-consensus-buff?",
+	"stx-transfer-memo?",
+	"is-standard",
+	"principal-destruct?",
+	"principal-construct?",
+	"string-to-int?",
+	"string-to-uint?",
+	"int-to-ascii",
+	"int-to-utf8",
+	"slice?",
+	"replace-at?",
+	"get-burn-block-info?",
+	"tx-sponsor?",
+	"chain-id",
+}
+
+// clarity3Functions were introduced in Clarity 3.
+var clarity3Functions = []string{
+	"stacks-block-height",
+	"tenure-height",
+	"get-stacks-block-info?",
+	"get-tenure-info?",
+}
+
+// analyzeCode inspects generated Clarity for deprecated functions and version requirements.
+func analyzeCode(code string) []Warning {
+	if code == "" {
+		return nil
+	}
+
+	var warnings []Warning
+
+	deprecated := make([]string, 0, len(deprecatedFunctions))
+	for name := range deprecatedFunctions {
+		deprecated = append(deprecated, name)
+	}
+	sort.Strings(deprecated)
+	for _, name := range deprecated {
+		if usesIdentifier(code, name) {
+			warnings = append(warnings, Warning{
+				Code:    WarningDeprecatedFunction,
+				Message: fmt.Sprintf("Uses deprecated %s; prefer %s", name, deprecatedFunctions[name]),
+				Detail:  name,
+			})
+		}
+	}
+
+	for _, name := range clarity3Functions {
+		if usesIdentifier(code, name) {
+			warnings = append(warnings, Warning{
+				Code:    WarningRequiresClarity3,
+				Message: fmt.Sprintf("Uses %s, which requires Clarity 3", name),
+				Detail:  name,
+			})
+		}
+	}
+
+	for _, name := range clarity2Functions {
+		if usesIdentifier(code, name) {
+			warnings = append(warnings, Warning{
+				Code:    WarningRequiresClarity2,
+				Message: fmt.Sprintf("Uses %s, which requires Clarity 2 or later", name),
+				Detail:  name,
+			})
+		}
+	}
+
+	return warnings
+}
+
+// usesIdentifier reports whether name appears as a whole Clarity identifier in code.
+func usesIdentifier(code, name string) bool {
+	pattern := `(^|[\s()])` + regexp.QuoteMeta(name) + `($|[\s()])`
+	matched, _ := regexp.MatchString(pattern, code)
+	return matched
+}
+
+// finalizeResponse attaches code-derived warnings and model metadata shared by every provider.
+func finalizeResponse(resp *CodeGenerationResponse, truncated, contextTrimmed bool) {
+	if contextTrimmed {
+		resp.AddWarning(Warning{
+			Code:    WarningContextTruncated,
+			Message: "Some retrieved context was dropped to fit the model's context window",
+		})
+	}
+	if truncated {
+		resp.AddWarning(Warning{
+			Code:    WarningOutputTruncated,
+			Message: "The provider stopped at the output token limit; the response may be incomplete",
+		})
+	}
+	if resp.Code == "" && len(resp.ToolCalls) == 0 {
+		resp.AddWarning(Warning{
+			Code:    WarningNoCode,
+			Message: "The response did not contain a code block",
+		})
+	}
+	for _, w := range analyzeCode(resp.Code) {
+		resp.AddWarning(w)
+	}
+	applyModelMetadata(resp)
+}
@@ -0,0 +1,129 @@
+// Package compression transparently compresses large text values before they are stored in SQLite.
+//
+// Compressed values are stored as BLOBs that start with a short magic header naming the codec,
+// so readers can tell them apart from legacy plain-text rows and new codecs can be added later.
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Supported algorithms.
+const (
+	AlgorithmNone = "none"
+	AlgorithmGzip = "gzip"
+)
+
+const defaultMinBytes = 4096
+
+// gzipMagic prefixes gzip-compressed values. Plain text and JSON never start with a NUL byte.
+var gzipMagic = []byte("\x00gz1")
+
+// Config controls when and how values are compressed.
+type Config struct {
+	Algorithm string
+	// MinBytes is the smallest value that is compressed; smaller values are stored as-is.
+	MinBytes int
+}
+
+var (
+	configMu sync.RWMutex
+	config   = Config{Algorithm: AlgorithmNone, MinBytes: defaultMinBytes}
+)
+
+// ConfigFromEnv reads STORAGE_COMPRESSION and STORAGE_COMPRESSION_MIN_BYTES.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{Algorithm: AlgorithmNone, MinBytes: defaultMinBytes}
+
+	if algorithm := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_COMPRESSION"))); algorithm != "" {
+		cfg.Algorithm = algorithm
+	}
+	if minBytes, err := strconv.Atoi(os.Getenv("STORAGE_COMPRESSION_MIN_BYTES")); err == nil && minBytes >= 0 {
+		cfg.MinBytes = minBytes
+	}
+
+	switch cfg.Algorithm {
+	case AlgorithmNone, AlgorithmGzip:
+		return cfg, nil
+	default:
+		return cfg, fmt.Errorf("unsupported STORAGE_COMPRESSION %q", cfg.Algorithm)
+	}
+}
+
+// Configure sets the process-wide compression configuration.
+func Configure(cfg Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config = cfg
+}
+
+// Enabled reports whether new values are being compressed.
+func Enabled() bool {
+	return current().Algorithm != AlgorithmNone
+}
+
+// MinBytes returns the configured compression threshold.
+func MinBytes() int {
+	return current().MinBytes
+}
+
+func current() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config
+}
+
+// EncodeString returns the value to store for s: either s unchanged or a compressed []byte.
+func EncodeString(s string) (any, error) {
+	cfg := current()
+	if cfg.Algorithm == AlgorithmNone || len(s) < cfg.MinBytes {
+		return s, nil
+	}
+
+	var buf bytes.Buffer
+	buf.Write(gzipMagic)
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		return nil, fmt.Errorf("compress value: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compress value: %w", err)
+	}
+
+	// Keep the plain value when compression does not help.
+	if buf.Len() >= len(s) {
+		return s, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// IsCompressed reports whether a stored value carries a compression header.
+func IsCompressed(stored string) bool {
+	return strings.HasPrefix(stored, string(gzipMagic))
+}
+
+// DecodeString returns the original text for a stored value, decompressing when needed.
+func DecodeString(stored string) (string, error) {
+	if !IsCompressed(stored) {
+		return stored, nil
+	}
+
+	zr, err := gzip.NewReader(strings.NewReader(stored[len(gzipMagic):]))
+	if err != nil {
+		return "", fmt.Errorf("decompress value: %w", err)
+	}
+	defer zr.Close()
+
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("decompress value: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,279 @@
+package contracttemplate
+
+// builtinTemplates are the curated scaffolds shipped with the server. A stored template with
+// the same name replaces one.
+var builtinTemplates = []Template{
+	{
+		Name:        "sip009-nft",
+		Title:       "SIP-009 NFT collection",
+		Description: "Non-fungible token implementing the SIP-009 trait, with owner-only sequential minting up to a maximum supply and token URIs built from a base URI.",
+		Category:    "nft",
+		Keywords:    []string{"sip-009", "sip009", "nft", "nfts", "non-fungible", "non-fungible token", "nft collection"},
+		Parameters: []Parameter{
+			{Name: "collection_name", Type: TypeName, Default: "my-nft", Description: "Identifier of the non-fungible token"},
+			{Name: "max_supply", Type: TypeUint, Default: "10000", Description: "Number of tokens that can ever be minted"},
+			{Name: "base_uri", Type: TypeString, Default: "ipfs://example/", MaxLength: 200, Description: "Prefix of token URIs; the token id is appended"},
+			{Name: "trait_contract", Type: TypePrincipal, Default: "SP2PABAF9FTAJYNFZH93XENAJ8FVY99RRM50D2JG9.nft-trait", Description: "Contract defining the SIP-009 nft-trait on the target network"},
+		},
+		Body: `;; {{.collection_name}}: a SIP-009 non-fungible token collection.
+
+(impl-trait '{{.trait_contract}}.nft-trait)
+
+(define-constant contract-owner tx-sender)
+(define-constant max-supply u{{.max_supply}})
+
+(define-constant err-owner-only (err u100))
+(define-constant err-not-token-owner (err u101))
+(define-constant err-sold-out (err u102))
+
+(define-non-fungible-token {{.collection_name}} uint)
+
+(define-data-var last-token-id uint u0)
+(define-data-var base-uri (string-ascii 200) "{{.base_uri}}")
+
+(define-read-only (get-last-token-id)
+  (ok (var-get last-token-id)))
+
+(define-read-only (get-token-uri (token-id uint))
+  (ok (some (concat (var-get base-uri) (int-to-ascii token-id)))))
+
+(define-read-only (get-owner (token-id uint))
+  (ok (nft-get-owner? {{.collection_name}} token-id)))
+
+(define-public (transfer (token-id uint) (sender principal) (recipient principal))
+  (begin
+    (asserts! (is-eq tx-sender sender) err-not-token-owner)
+    (nft-transfer? {{.collection_name}} token-id sender recipient)))
+
+(define-public (mint (recipient principal))
+  (let ((token-id (+ (var-get last-token-id) u1)))
+    (asserts! (is-eq tx-sender contract-owner) err-owner-only)
+    (asserts! (<= token-id max-supply) err-sold-out)
+    (try! (nft-mint? {{.collection_name}} token-id recipient))
+    (var-set last-token-id token-id)
+    (ok token-id)))
+
+(define-public (set-base-uri (uri (string-ascii 200)))
+  (begin
+    (asserts! (is-eq tx-sender contract-owner) err-owner-only)
+    (ok (var-set base-uri uri))))
+`,
+	},
+	{
+		Name:        "sip010-ft",
+		Title:       "SIP-010 fungible token",
+		Description: "Fungible token implementing the SIP-010 trait, with a capped supply, owner-only minting and an updatable token URI.",
+		Category:    "ft",
+		Keywords:    []string{"sip-010", "sip010", "fungible token", "ft", "erc20", "erc-20", "memecoin", "stablecoin"},
+		Parameters: []Parameter{
+			{Name: "token_name", Type: TypeName, Default: "my-token", Description: "Identifier of the fungible token"},
+			{Name: "display_name", Type: TypeString, Default: "My Token", MaxLength: 32, Description: "Name returned by get-name"},
+			{Name: "symbol", Type: TypeString, Default: "MTK", MaxLength: 32, Description: "Ticker returned by get-symbol"},
+			{Name: "decimals", Type: TypeUint, Default: "6", Description: "Decimal places of the smallest unit"},
+			{Name: "max_supply", Type: TypeUint, Default: "1000000000000000", Description: "Largest total supply, in the smallest unit"},
+			{Name: "token_uri", Type: TypeString, Description: "Metadata URI returned by get-token-uri; empty for none"},
+			{Name: "trait_contract", Type: TypePrincipal, Default: "SP3FBR2AGK5H9QBDH3EEN6DF8EK8JY7RX8QJ5SVTE.sip-010-trait-ft-standard", Description: "Contract defining the SIP-010 sip-010-trait on the target network"},
+		},
+		Body: `;; {{.display_name}} ({{.symbol}}): a SIP-010 fungible token.
+
+(impl-trait '{{.trait_contract}}.sip-010-trait)
+
+(define-constant contract-owner tx-sender)
+
+(define-constant err-owner-only (err u100))
+(define-constant err-not-token-owner (err u101))
+
+(define-fungible-token {{.token_name}} u{{.max_supply}})
+
+(define-data-var token-uri (optional (string-utf8 256)) {{if .token_uri}}(some u"{{.token_uri}}"){{else}}none{{end}})
+
+(define-public (transfer (amount uint) (sender principal) (recipient principal) (memo (optional (buff 34))))
+  (begin
+    (asserts! (or (is-eq tx-sender sender) (is-eq contract-caller sender)) err-not-token-owner)
+    (try! (ft-transfer? {{.token_name}} amount sender recipient))
+    (match memo to-print (print to-print) 0x)
+    (ok true)))
+
+(define-read-only (get-name)
+  (ok "{{.display_name}}"))
+
+(define-read-only (get-symbol)
+  (ok "{{.symbol}}"))
+
+(define-read-only (get-decimals)
+  (ok u{{.decimals}}))
+
+(define-read-only (get-balance (who principal))
+  (ok (ft-get-balance {{.token_name}} who)))
+
+(define-read-only (get-total-supply)
+  (ok (ft-get-supply {{.token_name}})))
+
+(define-read-only (get-token-uri)
+  (ok (var-get token-uri)))
+
+(define-public (set-token-uri (value (string-utf8 256)))
+  (begin
+    (asserts! (is-eq tx-sender contract-owner) err-owner-only)
+    (ok (var-set token-uri (some value)))))
+
+(define-public (mint (amount uint) (recipient principal))
+  (begin
+    (asserts! (is-eq tx-sender contract-owner) err-owner-only)
+    (ft-mint? {{.token_name}} amount recipient)))
+`,
+	},
+	{
+		Name:        "dao-voting",
+		Title:       "Membership DAO with proposal voting",
+		Description: "Members create proposals and vote once each during a voting period; a proposal passes when enough members voted and a majority was in favour. The deployer manages membership.",
+		Category:    "dao",
+		Keywords:    []string{"dao", "governance", "proposal", "proposals", "voting", "vote"},
+		Parameters: []Parameter{
+			{Name: "dao_name", Type: TypeString, Default: "My DAO", MaxLength: 64, Description: "Name in the contract header"},
+			{Name: "voting_period", Type: TypeUint, Default: "144", Description: "Length of a vote in Bitcoin blocks (144 is about a day)"},
+			{Name: "quorum", Type: TypeUint, Default: "3", Description: "Votes a proposal needs before it can pass"},
+		},
+		Body: `;; {{.dao_name}}: members propose and vote; a proposal passes once voting ends if at
+;; least the quorum voted and more members voted for it than against it.
+
+(define-constant contract-owner tx-sender)
+(define-constant voting-period u{{.voting_period}})
+(define-constant quorum u{{.quorum}})
+
+(define-constant err-owner-only (err u100))
+(define-constant err-not-member (err u101))
+(define-constant err-unknown-proposal (err u102))
+(define-constant err-voting-closed (err u103))
+(define-constant err-already-voted (err u104))
+(define-constant err-voting-open (err u105))
+(define-constant err-already-executed (err u106))
+
+(define-map members principal bool)
+(define-map votes { proposal-id: uint, voter: principal } bool)
+(define-map proposals uint {
+  proposer: principal,
+  title: (string-utf8 256),
+  end-height: uint,
+  votes-for: uint,
+  votes-against: uint,
+  executed: bool
+})
+
+(define-data-var proposal-count uint u0)
+
+(map-set members contract-owner true)
+
+(define-read-only (is-member (who principal))
+  (default-to false (map-get? members who)))
+
+(define-read-only (get-proposal (proposal-id uint))
+  (map-get? proposals proposal-id))
+
+(define-public (add-member (who principal))
+  (begin
+    (asserts! (is-eq tx-sender contract-owner) err-owner-only)
+    (ok (map-set members who true))))
+
+(define-public (remove-member (who principal))
+  (begin
+    (asserts! (is-eq tx-sender contract-owner) err-owner-only)
+    (ok (map-delete members who))))
+
+(define-public (propose (title (string-utf8 256)))
+  (let ((proposal-id (+ (var-get proposal-count) u1)))
+    (asserts! (is-member tx-sender) err-not-member)
+    (map-set proposals proposal-id {
+      proposer: tx-sender,
+      title: title,
+      end-height: (+ burn-block-height voting-period),
+      votes-for: u0,
+      votes-against: u0,
+      executed: false
+    })
+    (var-set proposal-count proposal-id)
+    (ok proposal-id)))
+
+(define-public (vote (proposal-id uint) (in-favor bool))
+  (let ((proposal (unwrap! (map-get? proposals proposal-id) err-unknown-proposal)))
+    (asserts! (is-member tx-sender) err-not-member)
+    (asserts! (< burn-block-height (get end-height proposal)) err-voting-closed)
+    (asserts! (map-insert votes { proposal-id: proposal-id, voter: tx-sender } in-favor) err-already-voted)
+    (ok (map-set proposals proposal-id
+      (if in-favor
+        (merge proposal { votes-for: (+ (get votes-for proposal) u1) })
+        (merge proposal { votes-against: (+ (get votes-against proposal) u1) }))))))
+
+;; Closes a proposal after its voting period and returns whether it passed.
+(define-public (execute (proposal-id uint))
+  (let ((proposal (unwrap! (map-get? proposals proposal-id) err-unknown-proposal)))
+    (asserts! (>= burn-block-height (get end-height proposal)) err-voting-open)
+    (asserts! (not (get executed proposal)) err-already-executed)
+    (map-set proposals proposal-id (merge proposal { executed: true }))
+    (ok (and
+      (>= (+ (get votes-for proposal) (get votes-against proposal)) quorum)
+      (> (get votes-for proposal) (get votes-against proposal))))))
+`,
+	},
+	{
+		Name:        "stx-vesting",
+		Title:       "STX vesting with cliff",
+		Description: "Holds an STX allocation for one beneficiary. Nothing vests before the cliff; afterwards the allocation vests linearly until the vesting period ends, and the beneficiary claims what has vested.",
+		Category:    "vesting",
+		Keywords:    []string{"vesting", "vest", "cliff", "token lockup", "lockup", "unlock schedule"},
+		Parameters: []Parameter{
+			{Name: "beneficiary", Type: TypePrincipal, Required: true, Description: "Principal that claims the vested STX"},
+			{Name: "total_amount", Type: TypeUint, Default: "1000000000", Description: "Allocation in micro-STX, deposited by the deployer with fund"},
+			{Name: "cliff_blocks", Type: TypeUint, Default: "4320", Description: "Bitcoin blocks after funding before anything vests (4320 is about a month)"},
+			{Name: "vesting_blocks", Type: TypeUint, Default: "52560", Description: "Bitcoin blocks after funding until everything has vested (52560 is about a year)"},
+		},
+		Body: `;; Linear STX vesting for {{.beneficiary}}: nothing vests before the cliff, then the
+;; allocation vests block by block until the vesting period ends.
+
+(define-constant contract-owner tx-sender)
+(define-constant beneficiary '{{.beneficiary}})
+(define-constant total-allocation u{{.total_amount}})
+(define-constant cliff-blocks u{{.cliff_blocks}})
+(define-constant vesting-blocks u{{.vesting_blocks}})
+
+(define-constant err-owner-only (err u100))
+(define-constant err-not-beneficiary (err u101))
+(define-constant err-not-funded (err u102))
+(define-constant err-already-funded (err u103))
+(define-constant err-nothing-to-claim (err u104))
+
+(define-data-var start-height (optional uint) none)
+(define-data-var claimed uint u0)
+
+;; The deployer deposits the allocation, which starts the schedule.
+(define-public (fund)
+  (begin
+    (asserts! (is-eq tx-sender contract-owner) err-owner-only)
+    (asserts! (is-none (var-get start-height)) err-already-funded)
+    (try! (stx-transfer? total-allocation tx-sender (as-contract tx-sender)))
+    (var-set start-height (some burn-block-height))
+    (ok true)))
+
+(define-read-only (get-vested-amount)
+  (match (var-get start-height)
+    start (let ((elapsed (- burn-block-height start)))
+      (if (< elapsed cliff-blocks)
+        u0
+        (if (>= elapsed vesting-blocks)
+          total-allocation
+          (/ (* total-allocation elapsed) vesting-blocks))))
+    u0))
+
+(define-read-only (get-claimable)
+  (- (get-vested-amount) (var-get claimed)))
+
+(define-public (claim)
+  (let ((amount (get-claimable)))
+    (asserts! (is-eq tx-sender beneficiary) err-not-beneficiary)
+    (asserts! (is-some (var-get start-height)) err-not-funded)
+    (asserts! (> amount u0) err-nothing-to-claim)
+    (var-set claimed (+ (var-get claimed) amount))
+    (as-contract (stx-transfer? amount tx-sender beneficiary))))
+`,
+	},
+}
@@ -0,0 +1,70 @@
+package contracttemplate
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Config controls how templates are used outside the template endpoints.
+type Config struct {
+	// BlendContext prepends the template matching a generation request to its code contexts.
+	BlendContext bool
+}
+
+// ConfigFromEnv reads CONTRACT_TEMPLATE_CONTEXT, which defaults to true.
+func ConfigFromEnv() Config {
+	cfg := Config{BlendContext: true}
+	if enabled, err := strconv.ParseBool(os.Getenv("CONTRACT_TEMPLATE_CONTEXT")); err == nil {
+		cfg.BlendContext = enabled
+	}
+	return cfg
+}
+
+// Match returns the template whose keywords the query mentions most, or nil when it
+// mentions none. Keywords match whole words in order, and hyphenated words only match as a
+// whole, so "fungible token" does not match "non-fungible token". Ties go to the template
+// listed first.
+func Match(templates []Template, query string) *Template {
+	words := matchWords(query)
+	var (
+		best      *Template
+		bestCount int
+	)
+	for i := range templates {
+		count := 0
+		for _, keyword := range templates[i].Keywords {
+			if phrase := matchWords(keyword); len(phrase) > 0 && containsPhrase(words, phrase) {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = &templates[i], count
+		}
+	}
+	return best
+}
+
+// matchWords lowercases text and splits it into words of letters, digits and hyphens.
+func matchWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '-'
+	}) {
+		if word = strings.Trim(word, "-"); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func containsPhrase(words, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(phrase)], phrase) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,262 @@
+package contracttemplate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Where a template was loaded from.
+const (
+	SourceBuiltin  = "builtin"
+	SourceDatabase = "database"
+)
+
+// Parameter types. Values are checked against their type before rendering, so a rendered
+// template is valid Clarity wherever the body quotes them correctly.
+const (
+	// TypeName is a Clarity identifier, e.g. a token or map name.
+	TypeName = "name"
+	// TypeString is printable ASCII, rendered with quotes and backslashes escaped for use
+	// inside a Clarity string literal.
+	TypeString = "string"
+	// TypeUint is a non-negative integer written without the u prefix.
+	TypeUint = "uint"
+	// TypePrincipal is a standard or contract principal written without the leading quote.
+	TypePrincipal = "principal"
+	// TypeBool is true or false.
+	TypeBool = "bool"
+)
+
+var (
+	// ErrInvalid wraps validation failures of a template or of the values it is rendered with.
+	ErrInvalid = errors.New("invalid contract template")
+	// ErrMissingParameters reports required parameters that have no value.
+	ErrMissingParameters = errors.New("missing required template parameters")
+)
+
+var (
+	namePattern          = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+	parameterNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+	identifierPattern    = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9-]{0,39}$`)
+	uintPattern          = regexp.MustCompile(`^[0-9]{1,39}$`)
+	principalPattern     = regexp.MustCompile(`^S[0-9A-Z]{28,40}(\.[a-zA-Z][a-zA-Z0-9-]{0,39})?$`)
+)
+
+const (
+	maxParameters  = 30
+	maxKeywords    = 20
+	maxBodyLength  = 64 * 1024
+	maxStringValue = 256
+)
+
+// Parameter is a value substituted into a template body as {{.name}}.
+type Parameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type"`
+	// Default is used when no value is supplied. Required parameters have no default.
+	Default  string `json:"default,omitempty"`
+	Required bool   `json:"required,omitempty"`
+	// MaxLength bounds string values; zero allows up to 256 characters.
+	MaxLength int `json:"max_length,omitempty"`
+}
+
+// Template is a curated Clarity contract scaffold whose body is written with text/template
+// and substitutes its parameters.
+type Template struct {
+	ID          int64  `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Category    string `json:"category,omitempty"`
+	// Keywords are phrases that mark a generation request as asking for this template.
+	Keywords   []string    `json:"keywords"`
+	Parameters []Parameter `json:"parameters"`
+	Body       string      `json:"body"`
+	Source     string      `json:"source"`
+	CreatedBy  *int64      `json:"created_by,omitempty"`
+	// CreatedAt and UpdatedAt are omitted for built-in templates.
+	CreatedAt time.Time `json:"created_at,omitzero"`
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
+
+// Normalize trims the template's fields and lowercases its keywords.
+func (t *Template) Normalize() {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Title = strings.TrimSpace(t.Title)
+	t.Description = strings.TrimSpace(t.Description)
+	t.Category = strings.ToLower(strings.TrimSpace(t.Category))
+	keywords := t.Keywords[:0]
+	for _, keyword := range t.Keywords {
+		if keyword = strings.Join(strings.Fields(strings.ToLower(keyword)), " "); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+	t.Keywords = keywords
+	for i := range t.Parameters {
+		p := &t.Parameters[i]
+		p.Name = strings.TrimSpace(p.Name)
+		p.Type = strings.ToLower(strings.TrimSpace(p.Type))
+	}
+}
+
+// Validate checks the name, the parameters and their defaults, and that the body parses
+// and renders with every parameter set.
+func (t Template) Validate() error {
+	if !namePattern.MatchString(t.Name) {
+		return fmt.Errorf("%w: name must be 1-64 lowercase letters, digits, '-' or '_', starting with a letter or digit", ErrInvalid)
+	}
+	if t.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalid)
+	}
+	if len(t.Keywords) > maxKeywords {
+		return fmt.Errorf("%w: at most %d keywords", ErrInvalid, maxKeywords)
+	}
+	if len(t.Parameters) > maxParameters {
+		return fmt.Errorf("%w: at most %d parameters", ErrInvalid, maxParameters)
+	}
+	if strings.TrimSpace(t.Body) == "" || len(t.Body) > maxBodyLength {
+		return fmt.Errorf("%w: body must be 1-%d bytes", ErrInvalid, maxBodyLength)
+	}
+
+	seen := make(map[string]bool, len(t.Parameters))
+	sample := make(map[string]string, len(t.Parameters))
+	for _, p := range t.Parameters {
+		if !parameterNamePattern.MatchString(p.Name) {
+			return fmt.Errorf("%w: parameter name %q must be lowercase letters, digits or '_', starting with a letter", ErrInvalid, p.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("%w: duplicate parameter %q", ErrInvalid, p.Name)
+		}
+		seen[p.Name] = true
+
+		switch p.Type {
+		case TypeName, TypeString, TypeUint, TypePrincipal, TypeBool:
+		default:
+			return fmt.Errorf("%w: parameter %s: type must be one of %s, %s, %s, %s or %s", ErrInvalid, p.Name, TypeName, TypeString, TypeUint, TypePrincipal, TypeBool)
+		}
+		if p.Required && p.Default != "" {
+			return fmt.Errorf("%w: parameter %s: required parameters have no default", ErrInvalid, p.Name)
+		}
+		if p.Default != "" {
+			if err := p.check(p.Default); err != nil {
+				return fmt.Errorf("%w: parameter %s: default: %v", ErrInvalid, p.Name, err)
+			}
+		}
+		sample[p.Name] = p.Default
+	}
+
+	if _, err := t.Render(sample); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return nil
+}
+
+// check reports whether value fits the parameter's type.
+func (p Parameter) check(value string) error {
+	switch p.Type {
+	case TypeName:
+		if !identifierPattern.MatchString(value) {
+			return errors.New("must be a Clarity identifier of up to 40 letters, digits or '-', starting with a letter")
+		}
+	case TypeString:
+		limit := p.MaxLength
+		if limit <= 0 {
+			limit = maxStringValue
+		}
+		if len(value) > limit {
+			return fmt.Errorf("must be at most %d characters", limit)
+		}
+		for _, r := range value {
+			if r < 0x20 || r > 0x7e {
+				return errors.New("must be printable ASCII")
+			}
+		}
+	case TypeUint:
+		if !uintPattern.MatchString(value) {
+			return errors.New("must be a non-negative integer without the u prefix")
+		}
+	case TypePrincipal:
+		if !principalPattern.MatchString(value) {
+			return errors.New("must be a standard or contract principal, e.g. SP2J6ZY48GV1EZ5V2V5RB9MP66SW86PYKKNRV9EJ7 or SP2J6ZY48GV1EZ5V2V5RB9MP66SW86PYKKNRV9EJ7.my-contract")
+		}
+	case TypeBool:
+		if value != "true" && value != "false" {
+			return errors.New("must be true or false")
+		}
+	}
+	return nil
+}
+
+// Values resolves supplied parameter values: unknown parameters and values that do not fit
+// their type are rejected, and defaults fill the gaps. It also returns the required
+// parameters that were not supplied, sorted.
+func (t Template) Values(supplied map[string]string) (map[string]string, []string, error) {
+	byName := make(map[string]Parameter, len(t.Parameters))
+	for _, p := range t.Parameters {
+		byName[p.Name] = p
+	}
+	for name := range supplied {
+		if _, ok := byName[name]; !ok {
+			return nil, nil, fmt.Errorf("%w: unknown parameter %q", ErrInvalid, name)
+		}
+	}
+
+	values := make(map[string]string, len(t.Parameters))
+	var missing []string
+	for _, p := range t.Parameters {
+		value := strings.TrimSpace(supplied[p.Name])
+		switch {
+		case value != "":
+			if err := p.check(value); err != nil {
+				return nil, nil, fmt.Errorf("%w: parameter %s: %v", ErrInvalid, p.Name, err)
+			}
+			values[p.Name] = value
+		case p.Required:
+			missing = append(missing, p.Name)
+		default:
+			values[p.Name] = p.Default
+		}
+	}
+	sort.Strings(missing)
+	return values, missing, nil
+}
+
+// Render executes the body with resolved values. String values are escaped for Clarity
+// string literals, and parameters without a value render as <name> placeholders.
+func (t Template) Render(values map[string]string) (string, error) {
+	tmpl, err := template.New(t.Name).Option("missingkey=error").Parse(t.Body)
+	if err != nil {
+		return "", fmt.Errorf("parse body: %w", err)
+	}
+
+	data := make(map[string]string, len(t.Parameters))
+	for _, p := range t.Parameters {
+		value, ok := values[p.Name]
+		switch {
+		case !ok || (value == "" && p.Required):
+			data[p.Name] = placeholder(p.Name)
+		case p.Type == TypeString:
+			data[p.Name] = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+		default:
+			data[p.Name] = value
+		}
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("render body: %w", err)
+	}
+	return out.String(), nil
+}
+
+// placeholder marks a parameter the caller has not chosen a value for.
+func placeholder(name string) string {
+	return "<" + name + ">"
+}
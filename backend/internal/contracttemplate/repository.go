@@ -0,0 +1,243 @@
+package contracttemplate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no template has the requested name.
+	ErrNotFound = errors.New("contract template not found")
+	// ErrExists is returned when creating a template whose name is already stored.
+	ErrExists = errors.New("contract template already exists")
+	// ErrReadOnly is returned when modifying a built-in template that has not been replaced.
+	ErrReadOnly = errors.New("contract template is built in and cannot be modified")
+)
+
+// Repository serves the built-in templates and those stored in the contract_templates
+// table. A stored template replaces a built-in one with the same name, and deleting it
+// restores the built-in version.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository returns a repository backed by db.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+const selectColumns = `id, name, title, COALESCE(description, ''), COALESCE(category, ''), keywords, parameters, body, created_by, created_at, updated_at`
+
+// List returns every template ordered by name.
+func (r *Repository) List(ctx context.Context) ([]Template, error) {
+	byName := make(map[string]Template, len(builtinTemplates))
+	for _, tmpl := range builtinTemplates {
+		byName[tmpl.Name] = builtin(tmpl)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+selectColumns+` FROM contract_templates`)
+	if err != nil {
+		return nil, fmt.Errorf("list contract templates: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tmpl, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		byName[tmpl.Name] = *tmpl
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate contract templates: %w", err)
+	}
+
+	templates := make([]Template, 0, len(byName))
+	for _, tmpl := range byName {
+		templates = append(templates, tmpl)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// Get returns the template with the name, preferring the stored version over a built-in one.
+func (r *Repository) Get(ctx context.Context, name string) (*Template, error) {
+	tmpl, err := r.getStored(ctx, name)
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return tmpl, err
+	}
+	return builtinTemplate(name)
+}
+
+// Create stores a new template. Its name may replace a built-in template.
+func (r *Repository) Create(ctx context.Context, tmpl *Template) error {
+	tmpl.Normalize()
+	if err := tmpl.Validate(); err != nil {
+		return err
+	}
+	if _, err := r.getStored(ctx, tmpl.Name); err == nil {
+		return ErrExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	keywords, parameters, err := encodeLists(tmpl)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO contract_templates (name, title, description, category, keywords, parameters, body, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, tmpl.Name, tmpl.Title, tmpl.Description, tmpl.Category, keywords, parameters, tmpl.Body, tmpl.CreatedBy, now, now)
+	if err != nil {
+		return fmt.Errorf("insert contract template: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("fetch contract template id: %w", err)
+	}
+	tmpl.ID = id
+	tmpl.Source = SourceDatabase
+	tmpl.CreatedAt = now
+	tmpl.UpdatedAt = now
+	return nil
+}
+
+// Update replaces a stored template, matched by name.
+func (r *Repository) Update(ctx context.Context, tmpl *Template) error {
+	tmpl.Normalize()
+	if err := tmpl.Validate(); err != nil {
+		return err
+	}
+
+	keywords, parameters, err := encodeLists(tmpl)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE contract_templates
+		SET title = ?, description = ?, category = ?, keywords = ?, parameters = ?, body = ?, updated_at = ?
+		WHERE name = ?
+	`, tmpl.Title, tmpl.Description, tmpl.Category, keywords, parameters, tmpl.Body, time.Now().UTC(), tmpl.Name)
+	if err != nil {
+		return fmt.Errorf("update contract template: %w", err)
+	}
+	if err := r.requireAffected(res, tmpl.Name); err != nil {
+		return err
+	}
+
+	updated, err := r.getStored(ctx, tmpl.Name)
+	if err != nil {
+		return err
+	}
+	*tmpl = *updated
+	return nil
+}
+
+// Delete removes a stored template.
+func (r *Repository) Delete(ctx context.Context, name string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM contract_templates WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("delete contract template: %w", err)
+	}
+	return r.requireAffected(res, name)
+}
+
+// requireAffected maps a statement that touched no rows to ErrReadOnly for built-in
+// templates and ErrNotFound otherwise.
+func (r *Repository) requireAffected(res sql.Result, name string) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected > 0 {
+		return nil
+	}
+	if _, err := builtinTemplate(name); err == nil {
+		return ErrReadOnly
+	}
+	return ErrNotFound
+}
+
+func (r *Repository) getStored(ctx context.Context, name string) (*Template, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+selectColumns+` FROM contract_templates WHERE name = ?`, name)
+	tmpl, err := scanTemplate(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return tmpl, err
+}
+
+func builtinTemplate(name string) (*Template, error) {
+	for _, tmpl := range builtinTemplates {
+		if tmpl.Name == name {
+			tmpl = builtin(tmpl)
+			return &tmpl, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// builtin returns a copy of a built-in template that callers may modify.
+func builtin(tmpl Template) Template {
+	tmpl.Source = SourceBuiltin
+	tmpl.Keywords = append([]string(nil), tmpl.Keywords...)
+	tmpl.Parameters = append([]Parameter(nil), tmpl.Parameters...)
+	return tmpl
+}
+
+func encodeLists(tmpl *Template) (string, string, error) {
+	if tmpl.Keywords == nil {
+		tmpl.Keywords = []string{}
+	}
+	if tmpl.Parameters == nil {
+		tmpl.Parameters = []Parameter{}
+	}
+	keywords, err := json.Marshal(tmpl.Keywords)
+	if err != nil {
+		return "", "", fmt.Errorf("encode contract template keywords: %w", err)
+	}
+	parameters, err := json.Marshal(tmpl.Parameters)
+	if err != nil {
+		return "", "", fmt.Errorf("encode contract template parameters: %w", err)
+	}
+	return string(keywords), string(parameters), nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTemplate(row rowScanner) (*Template, error) {
+	var (
+		tmpl                 Template
+		keywords, parameters string
+		createdBy            sql.NullInt64
+	)
+	err := row.Scan(&tmpl.ID, &tmpl.Name, &tmpl.Title, &tmpl.Description, &tmpl.Category, &keywords, &parameters, &tmpl.Body, &createdBy, &tmpl.CreatedAt, &tmpl.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan contract template: %w", err)
+	}
+	if err := json.Unmarshal([]byte(keywords), &tmpl.Keywords); err != nil {
+		return nil, fmt.Errorf("decode contract template keywords: %w", err)
+	}
+	if err := json.Unmarshal([]byte(parameters), &tmpl.Parameters); err != nil {
+		return nil, fmt.Errorf("decode contract template parameters: %w", err)
+	}
+
+	tmpl.Source = SourceDatabase
+	if createdBy.Valid {
+		tmpl.CreatedBy = &createdBy.Int64
+	}
+	return &tmpl, nil
+}
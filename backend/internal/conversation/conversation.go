@@ -12,16 +12,65 @@ import (
 type Turn struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Interrupted marks a partial assistant turn cut short by a cancelled generation.
+	Interrupted bool `json:"interrupted,omitempty"`
+	// Citations are the retrieved chunks an assistant turn was generated from.
+	Citations []Citation `json:"citations,omitempty"`
 }
 
+// Citation identifies a retrieved chunk supplied to the model for an assistant turn.
+type Citation struct {
+	// Collection is "code" or "docs".
+	Collection string  `json:"collection"`
+	Repo       string  `json:"repo,omitempty"`
+	FilePath   string  `json:"file_path,omitempty"`
+	URL        string  `json:"url,omitempty"`
+	Contract   string  `json:"contract,omitempty"`
+	Function   string  `json:"function,omitempty"`
+	Similarity float64 `json:"similarity"`
+}
+
+// maxTitleRunes bounds a title derived from the first user message.
+const maxTitleRunes = 80
+
+// maxRenameRunes bounds a title chosen by the user.
+const maxRenameRunes = 200
+
+// Sources of a conversation title, stored in conversations.title_source. Titles without a
+// source are derived from the first user message.
+const (
+	// TitleSourceGenerated marks titles written by the codegen provider after the first turn.
+	TitleSourceGenerated = "generated"
+	// TitleSourceUser marks titles set by renaming; they are never replaced.
+	TitleSourceUser = "user"
+)
+
 // Conversation captures the state of a chat between a user and the assistant.
 type Conversation struct {
 	ID         int64
 	UserID     int
 	History    []Turn
 	NewMessage string
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	// Title names the conversation in listings. It defaults to the first user message until
+	// a generated or user-chosen title replaces it; TitleSource records which.
+	Title       string
+	TitleSource string
+	// Summary condenses the first SummarizedTurns turns of History, which prompts no longer
+	// repeat verbatim. The full history is kept for clients.
+	Summary         string
+	SummarizedTurns int
+	// TrimmedTurns counts the oldest turns evicted to keep the history within its limits;
+	// History[i] is the conversation's turn TrimmedTurns+i.
+	TrimmedTurns int
+	// Version counts saves of the history. Save only succeeds while it still matches the
+	// stored version, so concurrent requests cannot overwrite each other's turns.
+	Version int64
+	// BranchedFrom is the conversation this one was copied from, and BranchTurn the last turn
+	// of that conversation the copy kept. Both are zero for conversations started afresh.
+	BranchedFrom int64
+	BranchTurn   int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 }
 
 // New returns a conversation initialised for the supplied user.
@@ -40,6 +89,48 @@ func (c *Conversation) AddTurn(role, content string) {
 	})
 }
 
+// AddAssistantTurn appends an assistant answer with the citations of its retrieved context.
+func (c *Conversation) AddAssistantTurn(content string, citations []Citation) {
+	c.History = append(c.History, Turn{
+		Role:      "assistant",
+		Content:   content,
+		Citations: citations,
+	})
+}
+
+// AddInterruptedTurn appends a partial assistant turn that can later be resumed.
+func (c *Conversation) AddInterruptedTurn(content string) {
+	c.History = append(c.History, Turn{
+		Role:        "assistant",
+		Content:     content,
+		Interrupted: true,
+	})
+}
+
+// InterruptedTurn returns the index of the final turn when it is an interrupted assistant
+// turn, along with the user query it answers.
+func (c *Conversation) InterruptedTurn() (int, string, bool) {
+	last := len(c.History) - 1
+	if last < 1 || !c.History[last].Interrupted || c.History[last].Role != "assistant" {
+		return 0, "", false
+	}
+	if c.History[last-1].Role != "user" {
+		return 0, "", false
+	}
+	return last, c.History[last-1].Content, true
+}
+
+// LastUserTurn returns the index of the final user turn. The turns after it hold its answer,
+// if any, which regeneration replaces.
+func (c *Conversation) LastUserTurn() (int, bool) {
+	for i := len(c.History) - 1; i >= 0; i-- {
+		if c.History[i].Role == "user" {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
 // SerializeHistory marshals the conversation history to a JSON string.
 func (c *Conversation) SerializeHistory() (string, error) {
 	data, err := json.Marshal(c.History)
@@ -62,17 +153,79 @@ func DeserializeHistory(history string) ([]Turn, error) {
 }
 
 // BuildHistoryPrompt renders the conversation history into a readable prompt segment.
+// Summarized turns are replaced by their summary, followed by the recent turns verbatim.
 func (c *Conversation) BuildHistoryPrompt() string {
-	if len(c.History) == 0 {
+	recent := c.RecentTurns()
+	if c.Summary == "" && len(recent) == 0 {
 		return ""
 	}
 
 	var builder strings.Builder
-	builder.WriteString("Previous conversation:\n")
+	if c.Summary != "" {
+		builder.WriteString("Summary of earlier conversation:\n")
+		builder.WriteString(strings.TrimSpace(c.Summary))
+		builder.WriteString("\n\n")
+	}
+	if len(recent) > 0 {
+		builder.WriteString("Previous conversation:\n")
+		builder.WriteString(renderTurns(recent))
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// RecentTurns returns the turns not yet covered by the summary.
+func (c *Conversation) RecentTurns() []Turn {
+	if c.Summary == "" || c.SummarizedTurns <= 0 {
+		return c.History
+	}
+	if c.SummarizedTurns >= len(c.History) {
+		return nil
+	}
+	return c.History[c.SummarizedTurns:]
+}
+
+// Prefix returns a copy of the conversation truncated to its first n turns, keeping the
+// summary when it covers no more than those turns.
+func (c *Conversation) Prefix(n int) *Conversation {
+	prefix := &Conversation{ID: c.ID, UserID: c.UserID, Title: c.Title, TitleSource: c.TitleSource, History: c.History[:n]}
+	if c.SummarizedTurns <= n {
+		prefix.Summary = c.Summary
+		prefix.SummarizedTurns = c.SummarizedTurns
+	}
+	return prefix
+}
+
+// DefaultTitle returns the first line of the first user message, shortened to maxTitleRunes.
+func (c *Conversation) DefaultTitle() string {
 	for _, turn := range c.History {
+		if turn.Role != "user" {
+			continue
+		}
+		title, _, _ := strings.Cut(strings.TrimSpace(turn.Content), "\n")
+		title = strings.TrimSpace(title)
+		if runes := []rune(title); len(runes) > maxTitleRunes {
+			title = strings.TrimSpace(string(runes[:maxTitleRunes-1])) + "…"
+		}
+		return title
+	}
+	return ""
+}
+
+// NeedsGeneratedTitle reports whether the conversation has just completed its first
+// exchange and still carries the title derived from the first user message.
+func (c *Conversation) NeedsGeneratedTitle() bool {
+	if c.TitleSource != "" || len(c.History) != 2 {
+		return false
+	}
+	return c.History[0].Role == "user" && c.History[1].Role == "assistant" && !c.History[1].Interrupted
+}
+
+func renderTurns(turns []Turn) string {
+	var builder strings.Builder
+	for _, turn := range turns {
 		builder.WriteString(fmt.Sprintf("%s: %s\n", capitaliseRole(turn.Role), turn.Content))
 	}
-	builder.WriteString("\n")
 	return builder.String()
 }
 
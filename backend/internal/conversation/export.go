@@ -0,0 +1,192 @@
+package conversation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Export formats.
+const (
+	ExportMarkdown = "markdown"
+	ExportJSON     = "json"
+)
+
+// ExportOptions controls what an export contains.
+type ExportOptions struct {
+	// Citations includes the retrieved chunks each answer was generated from.
+	Citations bool
+}
+
+// Export is the JSON export of a conversation.
+type Export struct {
+	ID           int64         `json:"id"`
+	Title        string        `json:"title"`
+	CreatedAt    time.Time     `json:"created_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	ExportedAt   time.Time     `json:"exported_at"`
+	BranchedFrom *ExportBranch `json:"branched_from,omitempty"`
+	// TrimmedTurns counts the oldest turns evicted before the export; they are not included.
+	TrimmedTurns int          `json:"trimmed_turns"`
+	Turns        []ExportTurn `json:"turns"`
+}
+
+// ExportBranch locates the conversation an exported conversation was branched from.
+type ExportBranch struct {
+	ConversationID int64 `json:"conversation_id"`
+	TurnIndex      int   `json:"turn_index"`
+}
+
+// ExportTurn is one turn of an exported conversation, with the code blocks of its content.
+type ExportTurn struct {
+	// Index is the turn's position in the whole conversation, counting trimmed turns.
+	Index       int         `json:"index"`
+	Role        string      `json:"role"`
+	Content     string      `json:"content"`
+	Interrupted bool        `json:"interrupted,omitempty"`
+	CodeBlocks  []CodeBlock `json:"code_blocks,omitempty"`
+	Citations   []Citation  `json:"citations,omitempty"`
+}
+
+// CodeBlock is a fenced code block of a turn.
+type CodeBlock struct {
+	Language string `json:"language,omitempty"`
+	Code     string `json:"code"`
+}
+
+// codeFencePattern matches a fenced code block, capturing its language and body.
+var codeFencePattern = regexp.MustCompile("(?s)```([\\w+#.-]*)[^\\n]*\\n(.*?)```")
+
+// Export returns the conversation's turns for the JSON export.
+func (c *Conversation) Export(opts ExportOptions, now time.Time) Export {
+	export := Export{
+		ID:           c.ID,
+		Title:        c.displayTitle(),
+		CreatedAt:    c.CreatedAt,
+		UpdatedAt:    c.UpdatedAt,
+		ExportedAt:   now.UTC(),
+		TrimmedTurns: c.TrimmedTurns,
+		Turns:        make([]ExportTurn, 0, len(c.History)),
+	}
+	if c.BranchedFrom != 0 {
+		export.BranchedFrom = &ExportBranch{ConversationID: c.BranchedFrom, TurnIndex: c.BranchTurn}
+	}
+	for i, turn := range c.History {
+		exported := ExportTurn{
+			Index:       c.TrimmedTurns + i,
+			Role:        turn.Role,
+			Content:     turn.Content,
+			Interrupted: turn.Interrupted,
+			CodeBlocks:  codeBlocks(turn.Content),
+		}
+		if opts.Citations {
+			exported.Citations = turn.Citations
+		}
+		export.Turns = append(export.Turns, exported)
+	}
+	return export
+}
+
+// Markdown renders the conversation as a Markdown document. Turn contents are copied as
+// written, so their code blocks keep their fences.
+func (c *Conversation) Markdown(opts ExportOptions, now time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", strings.Join(strings.Fields(c.displayTitle()), " "))
+	fmt.Fprintf(&b, "- Conversation: %d\n", c.ID)
+	fmt.Fprintf(&b, "- Created: %s\n", c.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Updated: %s\n", c.UpdatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Exported: %s\n", now.UTC().Format(time.RFC3339))
+	if c.BranchedFrom != 0 {
+		fmt.Fprintf(&b, "- Branched from conversation %d at turn %d\n", c.BranchedFrom, c.BranchTurn)
+	}
+	if c.TrimmedTurns > 0 {
+		fmt.Fprintf(&b, "- %d earlier turns were trimmed and are not included\n", c.TrimmedTurns)
+	}
+
+	for _, turn := range c.History {
+		fmt.Fprintf(&b, "\n---\n\n## %s\n\n", turnHeading(turn.Role))
+		content := strings.TrimSpace(turn.Content)
+		b.WriteString(content)
+		if strings.Count(content, "```")%2 == 1 {
+			// Close a fence left open by an interrupted answer so it does not swallow the rest.
+			b.WriteString("\n```")
+		}
+		b.WriteString("\n")
+		if turn.Interrupted {
+			b.WriteString("\n*This answer was interrupted before it finished.*\n")
+		}
+		if opts.Citations && len(turn.Citations) > 0 {
+			b.WriteString("\n**Sources**\n\n")
+			for i, citation := range turn.Citations {
+				fmt.Fprintf(&b, "%d. %s\n", i+1, citationMarkdown(citation))
+			}
+		}
+	}
+	return b.String()
+}
+
+// displayTitle is the title shown for the conversation, derived from its first message
+// until one is set.
+func (c *Conversation) displayTitle() string {
+	if c.Title != "" {
+		return c.Title
+	}
+	return c.DefaultTitle()
+}
+
+func turnHeading(role string) string {
+	switch role {
+	case "user":
+		return "User"
+	case "assistant":
+		return "Assistant"
+	case "system":
+		return "System"
+	case "tool":
+		return "Tool"
+	default:
+		return role
+	}
+}
+
+// citationMarkdown describes a citation as "[collection] location (similarity 0.83)", linking
+// documentation URLs.
+func citationMarkdown(citation Citation) string {
+	location := citation.FilePath
+	if citation.Repo != "" && location != "" {
+		location = citation.Repo + "/" + location
+	} else if citation.Repo != "" {
+		location = citation.Repo
+	}
+	if citation.Contract != "" {
+		symbol := citation.Contract
+		if citation.Function != "" {
+			symbol += "::" + citation.Function
+		}
+		location = strings.TrimSpace(location + " `" + symbol + "`")
+	}
+	if citation.URL != "" {
+		label := location
+		if label == "" {
+			label = citation.URL
+		}
+		location = "[" + label + "](" + citation.URL + ")"
+	}
+	if location == "" {
+		location = "unnamed chunk"
+	}
+	return fmt.Sprintf("[%s] %s (similarity %.2f)", citation.Collection, location, citation.Similarity)
+}
+
+// codeBlocks returns the fenced code blocks of content in order.
+func codeBlocks(content string) []CodeBlock {
+	var blocks []CodeBlock
+	for _, match := range codeFencePattern.FindAllStringSubmatch(content, -1) {
+		blocks = append(blocks, CodeBlock{
+			Language: strings.ToLower(match[1]),
+			Code:     strings.TrimRight(match[2], "\n"),
+		})
+	}
+	return blocks
+}
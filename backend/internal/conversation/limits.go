@@ -0,0 +1,145 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultMaxTurns = 200
+	defaultMaxBytes = 1 << 20
+)
+
+// Trim strategies for turns evicted from a conversation that outgrew its limits.
+const (
+	// TrimSummarize folds the evicted turns into the conversation summary before they are
+	// dropped, when the provider can summarize.
+	TrimSummarize = "summarize"
+	// TrimDrop drops the evicted turns.
+	TrimDrop = "drop"
+)
+
+// LimitConfig bounds the history stored for a conversation. The oldest turns are evicted
+// once either limit is exceeded; the latest exchange is always kept.
+type LimitConfig struct {
+	// MaxTurns is the most turns kept. Zero disables the limit.
+	MaxTurns int
+	// MaxBytes caps the size of the serialized history. Zero disables the limit.
+	MaxBytes int
+	// Strategy is TrimSummarize or TrimDrop.
+	Strategy string
+}
+
+// LimitConfigFromEnv reads CONVERSATION_MAX_TURNS, CONVERSATION_MAX_BYTES and
+// CONVERSATION_TRIM_STRATEGY. Unknown strategies fall back to summarize.
+func LimitConfigFromEnv() LimitConfig {
+	cfg := LimitConfig{
+		MaxTurns: defaultMaxTurns,
+		MaxBytes: defaultMaxBytes,
+		Strategy: TrimSummarize,
+	}
+	if n, err := strconv.Atoi(os.Getenv("CONVERSATION_MAX_TURNS")); err == nil && n >= 0 {
+		cfg.MaxTurns = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("CONVERSATION_MAX_BYTES")); err == nil && n >= 0 {
+		cfg.MaxBytes = n
+	}
+	switch strategy := strings.ToLower(strings.TrimSpace(os.Getenv("CONVERSATION_TRIM_STRATEGY"))); strategy {
+	case "":
+	case TrimSummarize, TrimDrop:
+		cfg.Strategy = strategy
+	default:
+		log.Printf("conversation: unknown CONVERSATION_TRIM_STRATEGY %q, using %s", strategy, TrimSummarize)
+	}
+	return cfg
+}
+
+// TrimResult reports the turns evicted from a conversation by a request.
+type TrimResult struct {
+	// Turns is the number of turns evicted by this request.
+	Turns int `json:"turns"`
+	// Summarized reports whether they were folded into the summary first.
+	Summarized bool `json:"summarized"`
+	// TotalTurns is the number of turns evicted over the conversation's lifetime.
+	TotalTurns int `json:"total_turns"`
+}
+
+// SummarizeEvicted folds the turns Trim would evict into the summary, so prompts keep their
+// gist after they are dropped. It does nothing unless the strategy is TrimSummarize, and
+// reports whether the summary changed.
+func (c *Conversation) SummarizeEvicted(ctx context.Context, cfg LimitConfig, summarize SummarizeFunc) (bool, error) {
+	if cfg.Strategy != TrimSummarize || summarize == nil {
+		return false, nil
+	}
+	start := 0
+	if c.Summary != "" {
+		start = min(c.SummarizedTurns, len(c.History))
+	}
+	end := c.evictCount(cfg)
+	if end <= start {
+		return false, nil
+	}
+	if err := c.summarizeTurns(ctx, start, end, summarize); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Trim evicts the oldest turns until the history fits cfg and returns how many it removed.
+// The remaining history starts with a user turn, and TrimmedTurns keeps the positions of
+// later turns stable for clients that refer to them by index.
+func (c *Conversation) Trim(cfg LimitConfig) int {
+	n := c.evictCount(cfg)
+	if n == 0 {
+		return 0
+	}
+	c.History = append([]Turn(nil), c.History[n:]...)
+	c.SummarizedTurns = max(c.SummarizedTurns-n, 0)
+	c.TrimmedTurns += n
+	return n
+}
+
+// evictCount returns how many of the oldest turns must go for the history to fit cfg,
+// never counting the latest exchange.
+func (c *Conversation) evictCount(cfg LimitConfig) int {
+	evictable := len(c.History) - minSummaryKeepTurns
+	if evictable <= 0 {
+		return 0
+	}
+
+	evict := 0
+	if cfg.MaxTurns > 0 && len(c.History) > cfg.MaxTurns {
+		evict = len(c.History) - max(cfg.MaxTurns, minSummaryKeepTurns)
+	}
+	if cfg.MaxBytes > 0 {
+		sizes := make([]int, len(c.History))
+		size := len("[]")
+		for i, turn := range c.History {
+			sizes[i] = turnSize(turn)
+			if i >= evict {
+				size += sizes[i]
+			}
+		}
+		for evict < evictable && size > cfg.MaxBytes {
+			size -= sizes[evict]
+			evict++
+		}
+	}
+	for evict > 0 && evict < evictable && c.History[evict].Role != "user" {
+		evict++
+	}
+	return min(evict, evictable)
+}
+
+// turnSize approximates a turn's share of the serialized history, including its separator.
+func turnSize(turn Turn) int {
+	data, err := json.Marshal(turn)
+	if err != nil {
+		return len(turn.Role) + len(turn.Content)
+	}
+	return len(data) + 1
+}
@@ -5,26 +5,49 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/compression"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
 )
 
-// ErrConversationNotFound signals that the requested conversation does not exist.
-var ErrConversationNotFound = errors.New("conversation not found")
+var (
+	// ErrConversationNotFound signals that the requested conversation does not exist.
+	ErrConversationNotFound = errors.New("conversation not found")
+	// ErrInvalidListParams signals an unknown sort field or order.
+	ErrInvalidListParams = errors.New("invalid list parameters")
+	// ErrInvalidTitle signals an empty or overly long title.
+	ErrInvalidTitle = errors.New("invalid title")
+	// ErrVersionConflict signals that the conversation was saved by another request since it
+	// was loaded.
+	ErrVersionConflict = errors.New("conversation was updated by another request")
+	// ErrInvalidTurn signals a turn index outside the stored history.
+	ErrInvalidTurn = errors.New("invalid turn index")
+)
 
-// Repository provides persistence for chat conversations.
+// Repository provides persistence for chat conversations. Writes go through the database's
+// shared writer.
 type Repository struct {
-	db *sql.DB
+	db     *sql.DB
+	writer *database.Writer
+	limits LimitConfig
 }
 
-// NewRepository returns a repository backed by the supplied sql.DB handle.
+// NewRepository returns a repository backed by the supplied sql.DB handle that keeps
+// histories within LimitConfigFromEnv.
 func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+	return &Repository{db: db, writer: database.WriterFor(db), limits: LimitConfigFromEnv()}
 }
 
 // Get loads a conversation ensuring it belongs to the specified user.
 func (r *Repository) Get(ctx context.Context, id int64, userID int) (*Conversation, error) {
 	const query = `
-		SELECT id, user_id, history, COALESCE(new_message, ''), created_at, updated_at
+		SELECT id, user_id, history, COALESCE(new_message, ''), COALESCE(title, ''),
+			COALESCE(title_source, ''), COALESCE(summary, ''), summarized_turns, trimmed_turns, version,
+			COALESCE(branched_from, 0), COALESCE(branch_turn, 0), created_at, updated_at
 		FROM conversations
 		WHERE id = ? AND user_id = ?
 	`
@@ -39,6 +62,14 @@ func (r *Repository) Get(ctx context.Context, id int64, userID int) (*Conversati
 		&convo.UserID,
 		&historyJSON,
 		&convo.NewMessage,
+		&convo.Title,
+		&convo.TitleSource,
+		&convo.Summary,
+		&convo.SummarizedTurns,
+		&convo.TrimmedTurns,
+		&convo.Version,
+		&convo.BranchedFrom,
+		&convo.BranchTurn,
 		&convo.CreatedAt,
 		&convo.UpdatedAt,
 	)
@@ -50,6 +81,11 @@ func (r *Repository) Get(ctx context.Context, id int64, userID int) (*Conversati
 		return nil, fmt.Errorf("query conversation: %w", err)
 	}
 
+	historyJSON, err = compression.DecodeString(historyJSON)
+	if err != nil {
+		return nil, fmt.Errorf("decode history: %w", err)
+	}
+
 	turns, err := DeserializeHistory(historyJSON)
 	if err != nil {
 		return nil, fmt.Errorf("parse history: %w", err)
@@ -59,21 +95,206 @@ func (r *Repository) Get(ctx context.Context, id int64, userID int) (*Conversati
 	return &convo, nil
 }
 
-// Save inserts or updates the conversation record.
+// ListParams pages, orders and filters a user's conversations.
+type ListParams struct {
+	Page  int
+	Limit int
+	// Search keeps conversations whose title contains it, ignoring ASCII case.
+	Search string
+	// Sort is "updated_at" (the default), "created_at" or "title"; Order is "asc" or "desc".
+	Sort  string
+	Order string
+}
+
+// ListItem describes a conversation in a listing, without its history.
+type ListItem struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	// TitleSource is "generated", "user", or empty for titles taken from the first message.
+	TitleSource string    `json:"title_source"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+var listSortColumns = map[string]string{
+	"updated_at": "updated_at",
+	"created_at": "created_at",
+	"title":      "COALESCE(title, '') COLLATE NOCASE",
+}
+
+// List returns a page of the user's conversations and the total number matching the search.
+// It returns ErrInvalidListParams for an unknown sort field or order.
+func (r *Repository) List(ctx context.Context, userID int, params ListParams) ([]ListItem, int64, error) {
+	orderBy, err := database.OrderBy(params.Sort, params.Order, listSortColumns, "updated_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidListParams, err)
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	page := params.Page
+	if page <= 0 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	whereClause := "WHERE user_id = ?"
+	args := []any{userID}
+	if search := strings.TrimSpace(params.Search); search != "" {
+		whereClause += ` AND title LIKE ? ESCAPE '\'`
+		args = append(args, database.ContainsPattern(search))
+	}
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM conversations `+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count conversations: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, COALESCE(title, ''), COALESCE(title_source, ''), created_at, updated_at
+		FROM conversations
+		`+whereClause+`
+		ORDER BY `+orderBy+`
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list conversations: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]ListItem, 0)
+	for rows.Next() {
+		var item ListItem
+		if err := rows.Scan(&item.ID, &item.Title, &item.TitleSource, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, 0, fmt.Errorf("scan conversation: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("iterate conversations: %w", err)
+	}
+	return items, total, nil
+}
+
+// CursorParams pages a user's conversations by ID, the way OpenAI list endpoints do.
+type CursorParams struct {
+	// Limit is clamped to 1-100 and defaults to 20.
+	Limit int
+	// Asc lists the oldest conversations first; the default is newest first.
+	Asc bool
+	// After and Before, when set, keep the conversations listed after or before that ID in
+	// the chosen order.
+	After  int64
+	Before int64
+}
+
+// ListByCursor returns a page of the user's conversations ordered by ID and reports whether
+// more follow in the direction of the page.
+func (r *Repository) ListByCursor(ctx context.Context, userID int, params CursorParams) ([]ListItem, bool, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	limit = min(limit, 100)
+
+	// Scan away from the cursor; a before cursor is read in reverse and flipped back.
+	asc := params.Asc
+	where := "WHERE user_id = ?"
+	args := []any{userID}
+	if params.After > 0 {
+		if asc {
+			where += " AND id > ?"
+		} else {
+			where += " AND id < ?"
+		}
+		args = append(args, params.After)
+	}
+	if params.Before > 0 {
+		if asc {
+			where += " AND id < ?"
+		} else {
+			where += " AND id > ?"
+		}
+		args = append(args, params.Before)
+	}
+	reverse := params.Before > 0 && params.After == 0
+	scanAsc := asc != reverse
+	order := "DESC"
+	if scanAsc {
+		order = "ASC"
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, COALESCE(title, ''), COALESCE(title_source, ''), created_at, updated_at
+		FROM conversations
+		`+where+`
+		ORDER BY id `+order+`
+		LIMIT ?
+	`, append(args, limit+1)...)
+	if err != nil {
+		return nil, false, fmt.Errorf("list conversations: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]ListItem, 0, limit)
+	for rows.Next() {
+		var item ListItem
+		if err := rows.Scan(&item.ID, &item.Title, &item.TitleSource, &item.CreatedAt, &item.UpdatedAt); err != nil {
+			return nil, false, fmt.Errorf("scan conversation: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("iterate conversations: %w", err)
+	}
+
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	if reverse {
+		slices.Reverse(items)
+	}
+	return items, hasMore, nil
+}
+
+// Save inserts or updates the conversation record. An update only applies while the stored
+// version still matches convo.Version and returns ErrVersionConflict otherwise; the stored
+// conversation is left untouched and can be reloaded with Get. Turns beyond the history
+// limits are dropped first; callers wanting them summarized call SummarizeEvicted before.
 func (r *Repository) Save(ctx context.Context, convo *Conversation) error {
+	convo.Trim(r.limits)
 	historyJSON, err := convo.SerializeHistory()
 	if err != nil {
 		return err
 	}
+	storedHistory, err := compression.EncodeString(historyJSON)
+	if err != nil {
+		return err
+	}
 
 	now := time.Now().UTC()
+	if convo.Title == "" {
+		convo.Title = convo.DefaultTitle()
+	}
 
 	if convo.ID == 0 {
 		const insert = `
-			INSERT INTO conversations (user_id, history, new_message, created_at, updated_at)
-			VALUES (?, ?, ?, ?, ?)
+			INSERT INTO conversations (user_id, history, new_message, title, title_source, summary, summarized_turns, trimmed_turns,
+				branched_from, branch_turn, version, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)
 		`
-		res, err := r.db.ExecContext(ctx, insert, convo.UserID, historyJSON, convo.NewMessage, now, now)
+		var branchedFrom, branchTurn any
+		if convo.BranchedFrom != 0 {
+			branchedFrom, branchTurn = convo.BranchedFrom, convo.BranchTurn
+		}
+		res, err := r.writer.Exec(ctx, insert, convo.UserID, storedHistory, convo.NewMessage, nullableString(convo.Title), nullableString(convo.TitleSource),
+			nullableString(convo.Summary), convo.SummarizedTurns, convo.TrimmedTurns, branchedFrom, branchTurn, now, now)
 		if err != nil {
 			return fmt.Errorf("insert conversation: %w", err)
 		}
@@ -83,19 +304,211 @@ func (r *Repository) Save(ctx context.Context, convo *Conversation) error {
 			return fmt.Errorf("fetch conversation id: %w", err)
 		}
 		convo.ID = convoID
+		convo.Version = 1
 		convo.CreatedAt = now
 		convo.UpdatedAt = now
 		return nil
 	}
 
+	// A title stored meanwhile by SetGeneratedTitle or Rename is kept; they do not bump the
+	// version as they never touch the history.
 	const update = `
 		UPDATE conversations
-		SET history = ?, new_message = ?, updated_at = ?
-		WHERE id = ? AND user_id = ?
+		SET history = ?, new_message = ?, title = COALESCE(title, ?), summary = ?, summarized_turns = ?,
+			trimmed_turns = ?, version = version + 1, updated_at = ?
+		WHERE id = ? AND user_id = ? AND version = ?
 	`
-	if _, err := r.db.ExecContext(ctx, update, historyJSON, convo.NewMessage, now, convo.ID, convo.UserID); err != nil {
-		return fmt.Errorf("update conversation: %w", err)
+	err = r.writer.Do(ctx, func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		res, err := tx.ExecContext(ctx, update, storedHistory, convo.NewMessage, nullableString(convo.Title), nullableString(convo.Summary), convo.SummarizedTurns, convo.TrimmedTurns, now, convo.ID, convo.UserID, convo.Version)
+		if err != nil {
+			return fmt.Errorf("update conversation: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("update conversation: %w", err)
+		}
+		if n == 0 {
+			// Tell a stale version apart from a conversation that is gone.
+			var exists bool
+			err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM conversations WHERE id = ? AND user_id = ?)`, convo.ID, convo.UserID).Scan(&exists)
+			if err != nil {
+				return fmt.Errorf("check conversation: %w", err)
+			}
+			if exists {
+				return ErrVersionConflict
+			}
+			return ErrConversationNotFound
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return err
 	}
+	convo.Version++
 	convo.UpdatedAt = now
 	return nil
 }
+
+// Branch copies one of the user's conversations into a new conversation ending at turnIndex,
+// counted from the start of the conversation including trimmed turns; a negative turnIndex
+// copies every stored turn. The branch keeps the title and the summary of the turns it
+// holds, and the source conversation is left unchanged.
+func (r *Repository) Branch(ctx context.Context, id int64, userID int, turnIndex int) (*Conversation, error) {
+	source, err := r.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(source.History) == 0 {
+		return nil, fmt.Errorf("%w: the conversation has no turns", ErrInvalidTurn)
+	}
+
+	last := source.TrimmedTurns + len(source.History) - 1
+	if turnIndex < 0 {
+		turnIndex = last
+	}
+	if turnIndex < source.TrimmedTurns || turnIndex > last {
+		return nil, fmt.Errorf("%w: turns %d to %d are stored", ErrInvalidTurn, source.TrimmedTurns, last)
+	}
+
+	branch := source.Prefix(turnIndex - source.TrimmedTurns + 1)
+	branch.ID = 0
+	branch.History = slices.Clone(branch.History)
+	branch.TrimmedTurns = source.TrimmedTurns
+	branch.BranchedFrom = source.ID
+	branch.BranchTurn = turnIndex
+	if err := r.Save(ctx, branch); err != nil {
+		return nil, err
+	}
+	return branch, nil
+}
+
+// SetGeneratedTitle stores a title generated after the first exchange. It reports false,
+// leaving the title alone, when the conversation was renamed or titled in the meantime.
+func (r *Repository) SetGeneratedTitle(ctx context.Context, id int64, title string) (bool, error) {
+	const update = `
+		UPDATE conversations
+		SET title = ?, title_source = ?
+		WHERE id = ? AND title_source IS NULL
+	`
+	res, err := r.writer.Exec(ctx, update, title, TitleSourceGenerated, id)
+	if err != nil {
+		return false, fmt.Errorf("set conversation title: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("set conversation title: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Rename sets a title chosen by the user, which generated titles never replace. The title
+// is trimmed and must hold between 1 and maxRenameRunes characters. Renaming does not move
+// the conversation in listings ordered by updated_at.
+func (r *Repository) Rename(ctx context.Context, id int64, userID int, title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if title == "" || strings.ContainsAny(title, "\r\n") {
+		return "", fmt.Errorf("%w: the title must be a single non-empty line", ErrInvalidTitle)
+	}
+	if utf8.RuneCountInString(title) > maxRenameRunes {
+		return "", fmt.Errorf("%w: the title must be at most %d characters", ErrInvalidTitle, maxRenameRunes)
+	}
+
+	const update = `
+		UPDATE conversations
+		SET title = ?, title_source = ?
+		WHERE id = ? AND user_id = ?
+	`
+	res, err := r.writer.Exec(ctx, update, title, TitleSourceUser, id, userID)
+	if err != nil {
+		return "", fmt.Errorf("rename conversation: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("rename conversation: %w", err)
+	}
+	if n == 0 {
+		return "", ErrConversationNotFound
+	}
+	return title, nil
+}
+
+// CompressHistories rewrites uncompressed histories at or above the compression threshold.
+// It processes rows in batches and returns the number of conversations rewritten.
+func (r *Repository) CompressHistories(ctx context.Context, batchSize int) (int, error) {
+	if !compression.Enabled() {
+		return 0, nil
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	const selectBatch = `
+		SELECT id, history
+		FROM conversations
+		WHERE typeof(history) = 'text' AND length(history) >= ? AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`
+
+	var (
+		total  int
+		lastID int64
+	)
+	for {
+		rows, err := r.db.QueryContext(ctx, selectBatch, compression.MinBytes(), lastID, batchSize)
+		if err != nil {
+			return total, fmt.Errorf("select conversations: %w", err)
+		}
+
+		type pending struct {
+			id      int64
+			history string
+		}
+		batch := make([]pending, 0, batchSize)
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.history); err != nil {
+				rows.Close()
+				return total, fmt.Errorf("scan conversation: %w", err)
+			}
+			batch = append(batch, p)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return total, fmt.Errorf("iterate conversations: %w", err)
+		}
+		rows.Close()
+
+		if len(batch) == 0 {
+			return total, nil
+		}
+
+		for _, p := range batch {
+			lastID = p.id
+			stored, err := compression.EncodeString(p.history)
+			if err != nil {
+				return total, err
+			}
+			if _, ok := stored.([]byte); !ok {
+				continue
+			}
+			if _, err := r.writer.Exec(ctx, `UPDATE conversations SET history = ? WHERE id = ?`, stored, p.id); err != nil {
+				return total, fmt.Errorf("update conversation: %w", err)
+			}
+			total++
+		}
+	}
+}
+
+func nullableString(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
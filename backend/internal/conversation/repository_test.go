@@ -0,0 +1,122 @@
+package conversation_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testutil"
+)
+
+func TestRepositorySaveAndGet(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	ctx := context.Background()
+	userID := testutil.CreateUser(t, db, "")
+	created := testutil.CreateConversation(t, db, userID, "Write a counter", "(define-data-var count uint u0)")
+
+	repo := conversation.NewRepository(db)
+	got, err := repo.Get(ctx, created.ID, userID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if len(got.History) != 2 || got.History[0].Role != "user" || got.History[1].Content != "(define-data-var count uint u0)" {
+		t.Fatalf("Get history = %+v", got.History)
+	}
+
+	got.AddTurn("user", "Add a reset function")
+	if err := repo.Save(ctx, got); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	reloaded, err := repo.Get(ctx, created.ID, userID)
+	if err != nil {
+		t.Fatalf("Get after Save: %v", err)
+	}
+	if len(reloaded.History) != 3 {
+		t.Fatalf("history has %d turns after Save, want 3", len(reloaded.History))
+	}
+}
+
+func TestRepositoryGetOtherUser(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	owner := testutil.CreateUser(t, db, "")
+	other := testutil.CreateUser(t, db, "")
+	convo := testutil.CreateConversation(t, db, owner, "Write a token")
+
+	repo := conversation.NewRepository(db)
+	if _, err := repo.Get(context.Background(), convo.ID, other); !errors.Is(err, conversation.ErrConversationNotFound) {
+		t.Fatalf("Get by another user: got %v, want ErrConversationNotFound", err)
+	}
+	if _, err := repo.Rename(context.Background(), convo.ID, other, "Mine"); !errors.Is(err, conversation.ErrConversationNotFound) {
+		t.Fatalf("Rename by another user: got %v, want ErrConversationNotFound", err)
+	}
+}
+
+func TestRepositorySaveVersionConflict(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	ctx := context.Background()
+	userID := testutil.CreateUser(t, db, "")
+	convo := testutil.CreateConversation(t, db, userID, "Write an NFT")
+
+	repo := conversation.NewRepository(db)
+	first, err := repo.Get(ctx, convo.ID, userID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	second, err := repo.Get(ctx, convo.ID, userID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	first.AddTurn("assistant", "(define-non-fungible-token nft uint)")
+	if err := repo.Save(ctx, first); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	second.AddTurn("assistant", "(define-fungible-token ft)")
+	if err := repo.Save(ctx, second); !errors.Is(err, conversation.ErrVersionConflict) {
+		t.Fatalf("stale Save: got %v, want ErrVersionConflict", err)
+	}
+}
+
+func TestRepositoryListRenameAndBranch(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	ctx := context.Background()
+	userID := testutil.CreateUser(t, db, "")
+	source := testutil.CreateConversation(t, db, userID, "Write a vault", "(define-map balances principal uint)", "Add withdrawals", "(define-public (withdraw))")
+	testutil.CreateConversation(t, db, userID, "Write a DAO")
+
+	repo := conversation.NewRepository(db)
+	if _, err := repo.Rename(ctx, source.ID, userID, "  Vault  "); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, err := repo.Rename(ctx, source.ID, userID, " "); !errors.Is(err, conversation.ErrInvalidTitle) {
+		t.Fatalf("Rename to a blank title: got %v, want ErrInvalidTitle", err)
+	}
+
+	items, total, err := repo.List(ctx, userID, conversation.ListParams{Search: "vault"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 1 || len(items) != 1 || items[0].Title != "Vault" || items[0].TitleSource != conversation.TitleSourceUser {
+		t.Fatalf("List = %+v (total %d), want the renamed conversation", items, total)
+	}
+
+	branch, err := repo.Branch(ctx, source.ID, userID, 1)
+	if err != nil {
+		t.Fatalf("Branch: %v", err)
+	}
+	if branch.ID == source.ID || branch.BranchedFrom != source.ID || len(branch.History) != 2 {
+		t.Fatalf("Branch = %+v, want a new conversation with the first two turns", branch)
+	}
+	if _, err := repo.Branch(ctx, source.ID, userID, 4); !errors.Is(err, conversation.ErrInvalidTurn) {
+		t.Fatalf("Branch past the last turn: got %v, want ErrInvalidTurn", err)
+	}
+
+	_, total, err = repo.List(ctx, userID, conversation.ListParams{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 3 {
+		t.Fatalf("List total = %d, want 3", total)
+	}
+}
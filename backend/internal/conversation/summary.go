@@ -0,0 +1,85 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultHistoryTokenBudget = 4000
+	defaultSummaryKeepTurns   = 6
+	// minSummaryKeepTurns keeps the latest exchange verbatim so interrupted answers can be resumed.
+	minSummaryKeepTurns = 2
+)
+
+// SummaryConfig controls when older turns are folded into the conversation summary.
+type SummaryConfig struct {
+	// TokenBudget is the largest history prompt, in tokens, sent without summarizing.
+	// Zero disables summarization.
+	TokenBudget int
+	// KeepTurns is the number of most recent turns always sent verbatim.
+	KeepTurns int
+}
+
+// SummaryConfigFromEnv reads CONVERSATION_HISTORY_TOKEN_BUDGET and CONVERSATION_SUMMARY_KEEP_TURNS.
+func SummaryConfigFromEnv() SummaryConfig {
+	cfg := SummaryConfig{
+		TokenBudget: defaultHistoryTokenBudget,
+		KeepTurns:   defaultSummaryKeepTurns,
+	}
+	if n, err := strconv.Atoi(os.Getenv("CONVERSATION_HISTORY_TOKEN_BUDGET")); err == nil && n >= 0 {
+		cfg.TokenBudget = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("CONVERSATION_SUMMARY_KEEP_TURNS")); err == nil && n >= minSummaryKeepTurns {
+		cfg.KeepTurns = n
+	}
+	return cfg
+}
+
+// SummarizeFunc condenses a transcript of turns, folding in the previous summary when set.
+type SummarizeFunc func(ctx context.Context, previousSummary, transcript string) (string, error)
+
+// Summarize folds older turns into the summary when the history prompt exceeds the token
+// budget, keeping the most recent turns verbatim. It reports whether the summary changed.
+func (c *Conversation) Summarize(ctx context.Context, cfg SummaryConfig, countTokens func(string) int, summarize SummarizeFunc) (bool, error) {
+	if cfg.TokenBudget <= 0 || summarize == nil {
+		return false, nil
+	}
+	if countTokens(c.BuildHistoryPrompt()) <= cfg.TokenBudget {
+		return false, nil
+	}
+
+	keep := max(cfg.KeepTurns, minSummaryKeepTurns)
+	start := 0
+	if c.Summary != "" {
+		start = min(c.SummarizedTurns, len(c.History))
+	}
+	end := len(c.History) - keep
+	if end <= start {
+		return false, nil
+	}
+	if err := c.summarizeTurns(ctx, start, end, summarize); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// summarizeTurns folds History[start:end] into the summary, which then covers the first end
+// turns.
+func (c *Conversation) summarizeTurns(ctx context.Context, start, end int, summarize SummarizeFunc) error {
+	summary, err := summarize(ctx, c.Summary, renderTurns(c.History[start:end]))
+	if err != nil {
+		return fmt.Errorf("summarize conversation: %w", err)
+	}
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return fmt.Errorf("summarize conversation: empty summary")
+	}
+
+	c.Summary = summary
+	c.SummarizedTurns = end
+	return nil
+}
@@ -0,0 +1,202 @@
+// Package credential stores provider API keys that users bring for their own generations
+// (BYOK), so that usage is billed to their provider account instead of the server's. Keys
+// are encrypted with AES-256-GCM under a server key before they reach the database and are
+// never returned to clients; only a short hint of each is shown.
+package credential
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+const (
+	// encryptionKeyBytes is the size of an AES-256 key.
+	encryptionKeyBytes = 32
+	// maxAPIKeyChars bounds a stored provider key.
+	maxAPIKeyChars = 512
+	// hintChars is how many trailing characters of a key its hint shows.
+	hintChars = 4
+)
+
+var (
+	// ErrDisabled is returned when no encryption key is configured.
+	ErrDisabled = errors.New("provider keys are not enabled on this server")
+	// ErrUnsupportedProvider is returned for providers users cannot bring keys for.
+	ErrUnsupportedProvider = errors.New("unsupported provider")
+	// ErrInvalidKey wraps validation failures of a provider key.
+	ErrInvalidKey = errors.New("invalid provider key")
+	// ErrNotFound is returned when the user stored no key for the provider.
+	ErrNotFound = errors.New("provider key not found")
+	// errUnknownEncryptionKey is returned for credentials encrypted under a key that is no
+	// longer configured.
+	errUnknownEncryptionKey = errors.New("credential was encrypted with an unknown key")
+)
+
+// Providers lists the providers users can bring keys for. The local provider has no keys.
+var Providers = []string{codegen.ProviderOpenAI, codegen.ProviderClaude, codegen.ProviderGemini}
+
+// SupportedProvider reports whether users can store a key for provider.
+func SupportedProvider(provider string) bool {
+	for _, p := range Providers {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// Config holds the server keys credentials are encrypted with. Key encrypts new credentials;
+// PreviousKeys only decrypt, so Key can be rotated without losing stored credentials.
+type Config struct {
+	Key          []byte
+	PreviousKeys [][]byte
+}
+
+// ConfigFromEnv reads BYOK_ENCRYPTION_KEY, or the file named by BYOK_ENCRYPTION_KEY_FILE,
+// and the comma-separated BYOK_PREVIOUS_ENCRYPTION_KEYS. Keys are base64-encoded 32-byte
+// values; invalid ones are logged and ignored. Without a key users cannot store provider keys.
+func ConfigFromEnv() Config {
+	var cfg Config
+	value := strings.TrimSpace(os.Getenv("BYOK_ENCRYPTION_KEY"))
+	if path := strings.TrimSpace(os.Getenv("BYOK_ENCRYPTION_KEY_FILE")); value == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("credential: reading BYOK_ENCRYPTION_KEY_FILE: %v", err)
+		}
+		value = strings.TrimSpace(string(data))
+	}
+	if value != "" {
+		key, err := decodeEncryptionKey(value)
+		if err != nil {
+			log.Printf("credential: ignoring BYOK_ENCRYPTION_KEY: %v", err)
+		} else {
+			cfg.Key = key
+		}
+	}
+	for _, value := range strings.Split(os.Getenv("BYOK_PREVIOUS_ENCRYPTION_KEYS"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		key, err := decodeEncryptionKey(value)
+		if err != nil {
+			log.Printf("credential: ignoring a BYOK_PREVIOUS_ENCRYPTION_KEYS entry: %v", err)
+			continue
+		}
+		cfg.PreviousKeys = append(cfg.PreviousKeys, key)
+	}
+	return cfg
+}
+
+func decodeEncryptionKey(value string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("not valid base64: %w", err)
+	}
+	if len(key) != encryptionKeyBytes {
+		return nil, fmt.Errorf("decodes to %d bytes, want %d", len(key), encryptionKeyBytes)
+	}
+	return key, nil
+}
+
+// Credential describes a stored provider key without revealing it.
+type Credential struct {
+	Provider string `json:"provider"`
+	// Hint is the last characters of the key, e.g. "…a1B2", to tell keys apart.
+	Hint       string     `json:"hint"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// NormalizeAPIKey trims a provider key and checks it can be stored.
+func NormalizeAPIKey(apiKey string) (string, error) {
+	apiKey = strings.TrimSpace(apiKey)
+	switch {
+	case apiKey == "":
+		return "", fmt.Errorf("%w: api_key is required", ErrInvalidKey)
+	case len(apiKey) > maxAPIKeyChars:
+		return "", fmt.Errorf("%w: api_key exceeds %d characters", ErrInvalidKey, maxAPIKeyChars)
+	case strings.ContainsFunc(apiKey, func(r rune) bool { return r <= ' ' || r == 0x7f }):
+		return "", fmt.Errorf("%w: api_key must not contain whitespace or control characters", ErrInvalidKey)
+	}
+	return apiKey, nil
+}
+
+func hint(apiKey string) string {
+	if len(apiKey) <= hintChars*2 {
+		return "…"
+	}
+	return "…" + apiKey[len(apiKey)-hintChars:]
+}
+
+// sealer encrypts with one server key. Its id is a fingerprint of the key, stored with each
+// credential to find the key that decrypts it.
+type sealer struct {
+	id   string
+	aead cipher.AEAD
+}
+
+func newSealer(key []byte) (*sealer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+	return &sealer{id: hex.EncodeToString(sum[:8]), aead: aead}, nil
+}
+
+// seal encrypts plaintext with a random nonce, which is prepended to the ciphertext. The
+// additional data binds the ciphertext to its row, so it cannot be copied to another one.
+func (s *sealer) seal(plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func (s *sealer) open(ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < s.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:s.aead.NonceSize()], ciphertext[s.aead.NonceSize():]
+	return s.aead.Open(nil, nonce, sealed, additionalData)
+}
+
+func additionalData(userID int, provider string) []byte {
+	return []byte(fmt.Sprintf("provider_credentials:%d:%s", userID, provider))
+}
+
+// Keys are a user's decrypted provider keys, by provider.
+type Keys map[string]string
+
+type keysContextKey struct{}
+
+// WithKeys returns a context carrying the caller's provider keys.
+func WithKeys(ctx context.Context, keys Keys) context.Context {
+	return context.WithValue(ctx, keysContextKey{}, keys)
+}
+
+// KeyFromContext returns the caller's key for provider, if they stored one.
+func KeyFromContext(ctx context.Context, provider string) (string, bool) {
+	keys, _ := ctx.Value(keysContextKey{}).(Keys)
+	key, ok := keys[provider]
+	return key, ok && key != ""
+}
@@ -0,0 +1,212 @@
+package credential
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+)
+
+// Store keeps users' encrypted provider keys. Writes go through the database's shared writer.
+type Store struct {
+	db     *sql.DB
+	writer *database.Writer
+	// current encrypts new credentials; sealers holds every configured key by its id.
+	current *sealer
+	sealers map[string]*sealer
+}
+
+// NewStore returns a store encrypting with cfg.Key. Without a usable key the store is
+// disabled and every method returns ErrDisabled.
+func NewStore(db *sql.DB, cfg Config) *Store {
+	s := &Store{db: db, writer: database.WriterFor(db), sealers: make(map[string]*sealer)}
+	if len(cfg.Key) == 0 {
+		return s
+	}
+	for i, key := range append([][]byte{cfg.Key}, cfg.PreviousKeys...) {
+		sealer, err := newSealer(key)
+		if err != nil {
+			log.Printf("credential: ignoring encryption key: %v", err)
+			continue
+		}
+		if i == 0 {
+			s.current = sealer
+		}
+		s.sealers[sealer.id] = sealer
+	}
+	return s
+}
+
+// Enabled reports whether users can store provider keys.
+func (s *Store) Enabled() bool {
+	return s != nil && s.current != nil
+}
+
+// List returns the user's stored keys, without the keys themselves.
+func (s *Store) List(ctx context.Context, userID int) ([]Credential, error) {
+	if !s.Enabled() {
+		return nil, ErrDisabled
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT provider, hint, created_at, updated_at, last_used_at
+		FROM provider_credentials WHERE user_id = ? ORDER BY provider
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list provider keys: %w", err)
+	}
+	defer rows.Close()
+
+	credentials := make([]Credential, 0)
+	for rows.Next() {
+		var (
+			c        Credential
+			lastUsed sql.NullTime
+		)
+		if err := rows.Scan(&c.Provider, &c.Hint, &c.CreatedAt, &c.UpdatedAt, &lastUsed); err != nil {
+			return nil, fmt.Errorf("scan provider key: %w", err)
+		}
+		if lastUsed.Valid {
+			c.LastUsedAt = &lastUsed.Time
+		}
+		credentials = append(credentials, c)
+	}
+	return credentials, rows.Err()
+}
+
+// Set encrypts and stores the user's key for provider, replacing any earlier one.
+func (s *Store) Set(ctx context.Context, userID int, provider, apiKey string) (*Credential, error) {
+	if !s.Enabled() {
+		return nil, ErrDisabled
+	}
+	if !SupportedProvider(provider) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProvider, provider)
+	}
+	apiKey, err := NormalizeAPIKey(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := s.current.seal([]byte(apiKey), additionalData(userID, provider))
+	if err != nil {
+		return nil, fmt.Errorf("encrypt provider key: %w", err)
+	}
+	now := time.Now().UTC()
+	c := &Credential{Provider: provider, Hint: hint(apiKey), UpdatedAt: now}
+	err = s.db.QueryRowContext(ctx, `SELECT created_at FROM provider_credentials WHERE user_id = ? AND provider = ?`, userID, provider).Scan(&c.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.CreatedAt = now
+	} else if err != nil {
+		return nil, fmt.Errorf("get provider key: %w", err)
+	}
+
+	// A replaced key starts without a last use.
+	_, err = s.writer.Exec(ctx, `
+		INSERT INTO provider_credentials (user_id, provider, ciphertext, key_id, hint, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, provider) DO UPDATE SET
+			ciphertext = excluded.ciphertext,
+			key_id = excluded.key_id,
+			hint = excluded.hint,
+			updated_at = excluded.updated_at,
+			last_used_at = NULL
+	`, userID, provider, ciphertext, s.current.id, c.Hint, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("store provider key: %w", err)
+	}
+	return c, nil
+}
+
+// Delete removes the user's key for provider.
+func (s *Store) Delete(ctx context.Context, userID int, provider string) error {
+	if !s.Enabled() {
+		return ErrDisabled
+	}
+	res, err := s.writer.Exec(ctx, `DELETE FROM provider_credentials WHERE user_id = ? AND provider = ?`, userID, provider)
+	if err != nil {
+		return fmt.Errorf("delete provider key: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Keys decrypts the user's stored keys. Keys encrypted under a previous server key are
+// re-encrypted under the current one; keys no configured server key can decrypt are
+// logged and skipped, so requests fall back to the server's keys. A disabled store
+// returns no keys.
+func (s *Store) Keys(ctx context.Context, userID int) (Keys, error) {
+	if !s.Enabled() {
+		return nil, nil
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT provider, ciphertext, key_id FROM provider_credentials WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("load provider keys: %w", err)
+	}
+	type stored struct {
+		provider   string
+		ciphertext []byte
+		keyID      string
+	}
+	var all []stored
+	for rows.Next() {
+		var row stored
+		if err := rows.Scan(&row.provider, &row.ciphertext, &row.keyID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan provider key: %w", err)
+		}
+		all = append(all, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load provider keys: %w", err)
+	}
+
+	keys := make(Keys, len(all))
+	for _, row := range all {
+		plaintext, err := s.open(row.ciphertext, row.keyID, userID, row.provider)
+		if err != nil {
+			log.Printf("credential: skipping %s key of user %d: %v", row.provider, userID, err)
+			continue
+		}
+		keys[row.provider] = string(plaintext)
+		if row.keyID != s.current.id {
+			if err := s.reencrypt(ctx, userID, row.provider, plaintext); err != nil {
+				log.Printf("credential: re-encrypting %s key of user %d: %v", row.provider, userID, err)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// MarkUsed records that the user's key for provider served a request.
+func (s *Store) MarkUsed(ctx context.Context, userID int, provider string) error {
+	_, err := s.writer.Exec(ctx, `UPDATE provider_credentials SET last_used_at = ? WHERE user_id = ? AND provider = ?`,
+		time.Now().UTC(), userID, provider)
+	if err != nil {
+		return fmt.Errorf("mark provider key used: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) open(ciphertext []byte, keyID string, userID int, provider string) ([]byte, error) {
+	sealer, ok := s.sealers[keyID]
+	if !ok {
+		return nil, errUnknownEncryptionKey
+	}
+	return sealer.open(ciphertext, additionalData(userID, provider))
+}
+
+func (s *Store) reencrypt(ctx context.Context, userID int, provider string, plaintext []byte) error {
+	ciphertext, err := s.current.seal(plaintext, additionalData(userID, provider))
+	if err != nil {
+		return err
+	}
+	_, err = s.writer.Exec(ctx, `UPDATE provider_credentials SET ciphertext = ?, key_id = ? WHERE user_id = ? AND provider = ?`,
+		ciphertext, s.current.id, userID, provider)
+	return err
+}
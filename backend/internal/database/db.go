@@ -4,17 +4,25 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Path returns the database file named by DATABASE_PATH, or the default.
+func Path() string {
+	if dbPath := os.Getenv("DATABASE_PATH"); dbPath != "" {
+		return dbPath
+	}
+	return "./data/clarity_coder.db"
+}
+
 // InitDB initializes the database connection and runs migrations
 func InitDB() (*sql.DB, error) {
-	dbPath := os.Getenv("DATABASE_PATH")
-	if dbPath == "" {
-		dbPath = "./data/clarity_coder.db"
-	}
+	dbPath := Path()
 
 	// Ensure the directory exists
 	dbDir := strings.TrimSuffix(dbPath, "/clarity_coder.db")
@@ -22,11 +30,31 @@ func InitDB() (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create database directory: %w", err)
 	}
 
-	db, err := sql.Open("sqlite3", dbPath)
+	return Open(dbPath)
+}
+
+const (
+	defaultBusyTimeout  = 5 * time.Second
+	defaultMaxOpenConns = 10
+)
+
+// Open connects to the SQLite database at dsn and runs migrations.
+// Every pooled connection uses WAL journaling, so readers do not block the writer, and waits
+// up to DATABASE_BUSY_TIMEOUT for a lock instead of failing with "database is locked".
+func Open(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", withPragmas(dsn))
 	if err != nil {
 		return nil, err
 	}
 
+	maxOpen := defaultMaxOpenConns
+	if n, err := strconv.Atoi(os.Getenv("DATABASE_MAX_OPEN_CONNS")); err == nil && n > 0 {
+		maxOpen = n
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxOpen)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
 	// Test connection
 	if err := db.Ping(); err != nil {
 		return nil, err
@@ -40,8 +68,163 @@ func InitDB() (*sql.DB, error) {
 	return db, nil
 }
 
+// withPragmas adds the connection options Open relies on, keeping any the caller already set.
+func withPragmas(dsn string) string {
+	busyTimeout := defaultBusyTimeout
+	if d, err := time.ParseDuration(os.Getenv("DATABASE_BUSY_TIMEOUT")); err == nil && d >= 0 {
+		busyTimeout = d
+	}
+
+	options := []string{
+		"_journal_mode=WAL",
+		"_synchronous=NORMAL",
+		fmt.Sprintf("_busy_timeout=%d", busyTimeout.Milliseconds()),
+		"_txlock=immediate",
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	for _, option := range options {
+		name := option[:strings.Index(option, "=")+1]
+		if strings.Contains(dsn, name) {
+			continue
+		}
+		dsn += separator + option
+		separator = "&"
+	}
+	return dsn
+}
+
+// OpenInMemory returns a migrated, private in-memory database.
+// The pool is limited to one connection because each SQLite memory connection is a separate database.
+func OpenInMemory() (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := runMigrations(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Pending reports the schema changes migrations would make to the existing database at dsn,
+// without applying them. The migrations run inside a transaction that is rolled back, and
+// each new table, index or column is described on its own line.
+func Pending(dsn string) ([]string, error) {
+	db, err := sql.Open("sqlite3", withPragmas(dsn))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := snapshotSchema(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := runMigrations(tx); err != nil {
+		return nil, err
+	}
+	after, err := snapshotSchema(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, object := range after.objects {
+		kind, existed := before.kinds[object]
+		if !existed {
+			pending = append(pending, fmt.Sprintf("create %s %s", after.kinds[object], object))
+			continue
+		}
+		if kind != "table" {
+			continue
+		}
+		for _, column := range after.columns[object] {
+			if !slices.Contains(before.columns[object], column) {
+				pending = append(pending, fmt.Sprintf("add column %s.%s", object, column))
+			}
+		}
+	}
+	return pending, nil
+}
+
+// schema lists a database's tables and indexes in creation order, with each table's columns.
+type schema struct {
+	objects []string
+	kinds   map[string]string
+	columns map[string][]string
+}
+
+func snapshotSchema(tx *sql.Tx) (*schema, error) {
+	rows, err := tx.Query(`
+		SELECT type, name FROM sqlite_master
+		WHERE type IN ('table', 'index') AND name NOT LIKE 'sqlite_%'
+		ORDER BY rowid
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	s := &schema{kinds: make(map[string]string), columns: make(map[string][]string)}
+	for rows.Next() {
+		var kind, name string
+		if err := rows.Scan(&kind, &name); err != nil {
+			return nil, err
+		}
+		s.objects = append(s.objects, name)
+		s.kinds[name] = kind
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, name := range s.objects {
+		if s.kinds[name] != "table" {
+			continue
+		}
+		columns, err := tx.Query(`SELECT name FROM pragma_table_info(?)`, name)
+		if err != nil {
+			return nil, err
+		}
+		for columns.Next() {
+			var column string
+			if err := columns.Scan(&column); err != nil {
+				columns.Close()
+				return nil, err
+			}
+			s.columns[name] = append(s.columns[name], column)
+		}
+		columns.Close()
+		if err := columns.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// execer runs schema statements on a database or inside a transaction.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
 // runMigrations creates the necessary database tables
-func runMigrations(db *sql.DB) error {
+func runMigrations(db execer) error {
 	migrations := []string{
 		// Users table (full schema)
 		`CREATE TABLE IF NOT EXISTS users (
@@ -51,7 +234,8 @@ func runMigrations(db *sql.DB) error {
 			email TEXT,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			is_active BOOLEAN DEFAULT 1,
-			role TEXT NOT NULL DEFAULT 'user'
+			role TEXT NOT NULL DEFAULT 'user',
+			must_change_password BOOLEAN NOT NULL DEFAULT 0
 		)`,
 		// API Keys table (full schema)
 		`CREATE TABLE IF NOT EXISTS api_keys (
@@ -64,8 +248,81 @@ func runMigrations(db *sql.DB) error {
 			last_used_at TIMESTAMP,
 			expires_at TIMESTAMP,
 			is_active BOOLEAN DEFAULT 1,
+			stale_notified_at TIMESTAMP,
+			stale_flagged_at TIMESTAMP,
+			hash_version INTEGER NOT NULL DEFAULT 1,
+			org_id INTEGER,
+			revoked_at TIMESTAMP,
+			revoked_by INTEGER,
+			revoke_reason TEXT,
+			allowed_cidrs TEXT,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (org_id) REFERENCES organizations(id)
+		)`,
+		// Refresh tokens issued to web sessions (stored hashed, rotated on use)
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (user_id) REFERENCES users(id)
 		)`,
+		// Access tokens revoked by logout before their expiry
+		`CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+			jti TEXT PRIMARY KEY,
+			expires_at TIMESTAMP NOT NULL
+		)`,
+		// Failed password logins per username and client IP, for backoff and lockout
+		`CREATE TABLE IF NOT EXISTS login_attempts (
+			scope TEXT NOT NULL,
+			key TEXT NOT NULL,
+			failures INTEGER NOT NULL DEFAULT 0,
+			last_failed_at TIMESTAMP NOT NULL,
+			blocked_until TIMESTAMP,
+			PRIMARY KEY (scope, key)
+		)`,
+		// Anonymous trial identities: a trial-role user and its expiring API key per device
+		`CREATE TABLE IF NOT EXISTS trial_identities (
+			user_id INTEGER PRIMARY KEY,
+			api_key_id INTEGER NOT NULL,
+			device_id TEXT NOT NULL,
+			ip_address TEXT,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		// Revocation history of API keys: every revoke and restore, with its actor and reason
+		`CREATE TABLE IF NOT EXISTS api_key_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			api_key_id INTEGER NOT NULL,
+			event TEXT NOT NULL,
+			reason TEXT,
+			actor_id INTEGER,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (api_key_id) REFERENCES api_keys(id)
+		)`,
+		// GitHub and Google accounts linked to users for OAuth login
+		`CREATE TABLE IF NOT EXISTS user_identities (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			provider TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			email TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_login_at TIMESTAMP,
+			UNIQUE (provider, subject),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		// Pending OAuth logins: hashed state and PKCE verifier, consumed by the callback
+		`CREATE TABLE IF NOT EXISTS oauth_states (
+			state_hash TEXT PRIMARY KEY,
+			provider TEXT NOT NULL,
+			code_verifier TEXT NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
 		// Ingestion Jobs table
 		`CREATE TABLE IF NOT EXISTS ingestion_jobs (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -74,10 +331,17 @@ func runMigrations(db *sql.DB) error {
 			progress INTEGER DEFAULT 0,
 			total_items INTEGER DEFAULT 0,
 			processed_items INTEGER DEFAULT 0,
+			message TEXT,
 			error_message TEXT,
+			requested_by INTEGER,
+			source TEXT,
+			chunking TEXT,
+			doc_source_id INTEGER,
+			reindex TEXT,
 			started_at TIMESTAMP,
 			completed_at TIMESTAMP,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (requested_by) REFERENCES users(id)
 		)`,
 		// Conversations table for chat history
 		`CREATE TABLE IF NOT EXISTS conversations (
@@ -85,6 +349,14 @@ func runMigrations(db *sql.DB) error {
 			user_id INTEGER NOT NULL,
 			history TEXT NOT NULL DEFAULT '[]',
 			new_message TEXT,
+			title TEXT,
+			title_source TEXT,
+			summary TEXT,
+			summarized_turns INTEGER NOT NULL DEFAULT 0,
+			trimmed_turns INTEGER NOT NULL DEFAULT 0,
+			version INTEGER NOT NULL DEFAULT 0,
+			branched_from INTEGER,
+			branch_turn INTEGER,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (user_id) REFERENCES users(id)
@@ -96,6 +368,7 @@ func runMigrations(db *sql.DB) error {
 			api_key_id INTEGER,
 			endpoint TEXT NOT NULL,
 			query TEXT NOT NULL,
+			query_text TEXT,
 			response TEXT,
 			model_provider TEXT,
 			rag_contexts_count INTEGER DEFAULT 0,
@@ -105,14 +378,406 @@ func runMigrations(db *sql.DB) error {
 			status TEXT NOT NULL,
 			error_message TEXT,
 			conversation_id INTEGER,
+			interrupted BOOLEAN NOT NULL DEFAULT 0,
+			cache_status TEXT,
+			moderation TEXT,
+			moderation_rules TEXT,
+			model TEXT,
+			cost_usd REAL NOT NULL DEFAULT 0,
+			user_key INTEGER NOT NULL DEFAULT 0,
+			client_ip TEXT,
+			user_agent TEXT,
+			experiment_id INTEGER,
+			experiment_variant TEXT,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (user_id) REFERENCES users(id),
 			FOREIGN KEY (api_key_id) REFERENCES api_keys(id),
 			FOREIGN KEY (conversation_id) REFERENCES conversations(id)
 		)`,
+		// Query log archive files written by the archive job, one per month and run
+		`CREATE TABLE IF NOT EXISTS query_log_archives (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			month TEXT NOT NULL,
+			entries INTEGER NOT NULL DEFAULT 0,
+			size_bytes INTEGER NOT NULL DEFAULT 0,
+			first_created_at TIMESTAMP NOT NULL,
+			last_created_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// Ratings of generated answers. query_log_id has no foreign key so feedback outlives
+		// query log purges.
+		`CREATE TABLE IF NOT EXISTS feedback (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			query_log_id INTEGER,
+			conversation_id INTEGER,
+			turn_index INTEGER,
+			rating TEXT NOT NULL,
+			category TEXT,
+			comment TEXT,
+			endpoint TEXT,
+			model_provider TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		// Per-user defaults for generation requests
+		`CREATE TABLE IF NOT EXISTS user_settings (
+			user_id INTEGER PRIMARY KEY,
+			provider TEXT,
+			model TEXT,
+			temperature REAL,
+			max_tokens INTEGER,
+			response_language TEXT,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		// Provider API keys users bring for their own generations, encrypted with AES-GCM;
+		// ciphertext starts with its nonce and key_id names the server key that encrypted it
+		`CREATE TABLE IF NOT EXISTS provider_credentials (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			provider TEXT NOT NULL,
+			ciphertext BLOB NOT NULL,
+			key_id TEXT NOT NULL,
+			hint TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP,
+			UNIQUE (user_id, provider),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		// Showcase entries published by users for the public gallery
+		`CREATE TABLE IF NOT EXISTS showcase_entries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			title TEXT NOT NULL,
+			prompt TEXT NOT NULL,
+			code TEXT NOT NULL,
+			explanation TEXT,
+			status TEXT NOT NULL DEFAULT 'pending',
+			review_note TEXT,
+			reviewed_by INTEGER,
+			reviewed_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (reviewed_by) REFERENCES users(id)
+		)`,
+		// Per-user monthly token quota overrides (0 = unlimited)
+		`CREATE TABLE IF NOT EXISTS user_quotas (
+			user_id INTEGER PRIMARY KEY,
+			monthly_token_limit INTEGER NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		// Batch generation jobs and their per-query results
+		`CREATE TABLE IF NOT EXISTS batch_jobs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			api_key_id INTEGER,
+			status TEXT NOT NULL,
+			model_provider TEXT,
+			temperature REAL NOT NULL DEFAULT 0,
+			max_tokens INTEGER NOT NULL DEFAULT 0,
+			total_items INTEGER NOT NULL DEFAULT 0,
+			completed_items INTEGER NOT NULL DEFAULT 0,
+			failed_items INTEGER NOT NULL DEFAULT 0,
+			input_tokens INTEGER NOT NULL DEFAULT 0,
+			output_tokens INTEGER NOT NULL DEFAULT 0,
+			error_message TEXT,
+			started_at TIMESTAMP,
+			completed_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (api_key_id) REFERENCES api_keys(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS batch_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			batch_id INTEGER NOT NULL,
+			item_index INTEGER NOT NULL,
+			query TEXT NOT NULL,
+			status TEXT NOT NULL,
+			code TEXT,
+			explanation TEXT,
+			input_tokens INTEGER NOT NULL DEFAULT 0,
+			output_tokens INTEGER NOT NULL DEFAULT 0,
+			warnings TEXT,
+			error_message TEXT,
+			UNIQUE (batch_id, item_index),
+			FOREIGN KEY (batch_id) REFERENCES batch_jobs(id)
+		)`,
+		// Audit trail of auth and admin actions; actor_id has no foreign key so entries
+		// outlive deleted users
+		`CREATE TABLE IF NOT EXISTS audit_logs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor_id INTEGER,
+			actor_username TEXT,
+			action TEXT NOT NULL,
+			target_type TEXT,
+			target_id TEXT,
+			outcome TEXT NOT NULL,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			details TEXT,
+			ip_address TEXT,
+			user_agent TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// Organizations share API keys and a pooled monthly token quota (NULL = unlimited)
+		`CREATE TABLE IF NOT EXISTS organizations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			monthly_token_limit INTEGER,
+			created_by INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS organization_members (
+			org_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			role TEXT NOT NULL DEFAULT 'member',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (org_id, user_id),
+			FOREIGN KEY (org_id) REFERENCES organizations(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		// Code generation prompt templates managed by admins; file templates are not stored
+		`CREATE TABLE IF NOT EXISTS prompt_templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT,
+			template TEXT NOT NULL,
+			created_by INTEGER,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id)
+		)`,
+		// Single-row runtime override of the codegen provider, model and default temperature
+		`CREATE TABLE IF NOT EXISTS codegen_config (
+			id INTEGER PRIMARY KEY CHECK (id = 1),
+			provider TEXT NOT NULL DEFAULT '',
+			model TEXT NOT NULL DEFAULT '',
+			temperature REAL NOT NULL DEFAULT 0,
+			updated_by INTEGER,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (updated_by) REFERENCES users(id)
+		)`,
+		// Admin-registered event callbacks; events is a comma-separated list of event types
+		`CREATE TABLE IF NOT EXISTS webhooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			url TEXT NOT NULL,
+			description TEXT,
+			events TEXT NOT NULL,
+			active BOOLEAN NOT NULL DEFAULT 1,
+			secret TEXT NOT NULL,
+			created_by INTEGER,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id)
+		)`,
+		// One row per event sent to a webhook, after retries
+		`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id INTEGER NOT NULL,
+			event_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_status INTEGER,
+			error_message TEXT,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP,
+			FOREIGN KEY (webhook_id) REFERENCES webhooks(id)
+		)`,
+		// Budget thresholds crossed by LLM spend; each fires once per budget period
+		`CREATE TABLE IF NOT EXISTS spend_alerts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			period TEXT NOT NULL,
+			provider TEXT NOT NULL DEFAULT '',
+			period_start TIMESTAMP NOT NULL,
+			threshold REAL NOT NULL,
+			budget_usd REAL NOT NULL,
+			spent_usd REAL NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (period, provider, period_start, threshold)
+		)`,
+		// Custom roles and redefined built-in ones; built-in roles need no row
+		`CREATE TABLE IF NOT EXISTS roles (
+			name TEXT PRIMARY KEY,
+			description TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS role_permissions (
+			role TEXT NOT NULL,
+			permission TEXT NOT NULL,
+			PRIMARY KEY (role, permission),
+			FOREIGN KEY (role) REFERENCES roles(name)
+		)`,
+		// Documentation sites crawled into the docs collection
+		`CREATE TABLE IF NOT EXISTS doc_sources (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			url TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			path_prefix TEXT NOT NULL,
+			max_pages INTEGER NOT NULL,
+			recrawl_interval_hours INTEGER NOT NULL DEFAULT 0,
+			created_by INTEGER,
+			pages INTEGER NOT NULL DEFAULT 0,
+			chunks INTEGER NOT NULL DEFAULT 0,
+			last_job_id INTEGER,
+			last_crawled_at TIMESTAMP,
+			last_success_at TIMESTAMP,
+			last_changed_at TIMESTAMP,
+			last_error TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id)
+		)`,
+		// Pages indexed from a documentation source, with the hash of their content
+		`CREATE TABLE IF NOT EXISTS doc_source_pages (
+			source_id INTEGER NOT NULL,
+			url TEXT NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			content_hash TEXT NOT NULL,
+			chunks INTEGER NOT NULL DEFAULT 0,
+			fetched_at TIMESTAMP NOT NULL,
+			changed_at TIMESTAMP NOT NULL,
+			PRIMARY KEY (source_id, url),
+			FOREIGN KEY (source_id) REFERENCES doc_sources(id)
+		)`,
+		// Zipped project bundles behind expiring download links
+		`CREATE TABLE IF NOT EXISTS artifacts (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER,
+			name TEXT NOT NULL,
+			file_name TEXT NOT NULL,
+			content_type TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			files INTEGER NOT NULL,
+			content BLOB NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			expires_at TIMESTAMP NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		)`,
+		// Golden prompts the nightly evaluation generates code for, with expected properties
+		`CREATE TABLE IF NOT EXISTS eval_cases (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			prompt TEXT NOT NULL,
+			expected_functions TEXT NOT NULL DEFAULT '[]',
+			must_compile INTEGER NOT NULL DEFAULT 1,
+			reference_code TEXT,
+			min_similarity REAL NOT NULL DEFAULT 0,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		// Evaluation runs with their aggregate scores
+		`CREATE TABLE IF NOT EXISTS eval_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			status TEXT NOT NULL,
+			triggered_by TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			model TEXT NOT NULL,
+			requested_by INTEGER,
+			total INTEGER NOT NULL DEFAULT 0,
+			passed INTEGER NOT NULL DEFAULT 0,
+			errors INTEGER NOT NULL DEFAULT 0,
+			pass_rate REAL,
+			compile_pass_rate REAL,
+			function_pass_rate REAL,
+			avg_similarity REAL,
+			checker TEXT NOT NULL,
+			error TEXT,
+			started_at TIMESTAMP NOT NULL,
+			finished_at TIMESTAMP,
+			FOREIGN KEY (requested_by) REFERENCES users(id)
+		)`,
+		// A/B experiments assigning users to provider, model and prompt template variants;
+		// variants holds the JSON array of arms and their traffic percentages
+		`CREATE TABLE IF NOT EXISTS experiments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT,
+			status TEXT NOT NULL,
+			variants TEXT NOT NULL DEFAULT '[]',
+			created_by INTEGER,
+			started_at TIMESTAMP,
+			stopped_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id)
+		)`,
+		// Per-case scores of an evaluation run; case_name survives deleting the case
+		`CREATE TABLE IF NOT EXISTS eval_results (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			run_id INTEGER NOT NULL,
+			case_id INTEGER NOT NULL,
+			case_name TEXT NOT NULL,
+			passed INTEGER NOT NULL,
+			compiled INTEGER NOT NULL,
+			check_output TEXT,
+			missing_functions TEXT,
+			similarity REAL,
+			error TEXT,
+			code TEXT,
+			latency_ms INTEGER NOT NULL DEFAULT 0,
+			input_tokens INTEGER NOT NULL DEFAULT 0,
+			output_tokens INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY (run_id) REFERENCES eval_runs(id)
+		)`,
+		// Admin-defined Clarity contract templates; a row replaces the built-in template of
+		// the same name. keywords and parameters hold JSON arrays
+		`CREATE TABLE IF NOT EXISTS contract_templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			title TEXT NOT NULL,
+			description TEXT,
+			category TEXT,
+			keywords TEXT NOT NULL DEFAULT '[]',
+			parameters TEXT NOT NULL DEFAULT '[]',
+			body TEXT NOT NULL,
+			created_by INTEGER,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (created_by) REFERENCES users(id)
+		)`,
+		// Physical vector store collection each logical collection resolves to, switched by
+		// reindex jobs. Collections without a row resolve to themselves
+		`CREATE TABLE IF NOT EXISTS vectorstore_aliases (
+			collection TEXT PRIMARY KEY,
+			target TEXT NOT NULL,
+			job_id INTEGER,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (job_id) REFERENCES ingestion_jobs(id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_organization_members_user_id ON organization_members(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_showcase_entries_status ON showcase_entries(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_ingestion_jobs_status ON ingestion_jobs(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_batch_jobs_status ON batch_jobs(status)`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_actor_id ON audit_logs(actor_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs(action)`,
 		`CREATE INDEX IF NOT EXISTS idx_query_logs_user_id ON query_logs(user_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_query_logs_created_at ON query_logs(created_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_query_logs_endpoint ON query_logs(endpoint)`,
+		`CREATE INDEX IF NOT EXISTS idx_query_logs_user_created ON query_logs(user_id, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_conversations_user_updated ON conversations(user_id, updated_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_feedback_user_id ON feedback(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_trial_identities_device_id ON trial_identities(device_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_trial_identities_ip_created ON trial_identities(ip_address, created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_trial_identities_expires_at ON trial_identities(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_key_events_api_key_id ON api_key_events(api_key_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_feedback_created_at ON feedback(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_artifacts_expires_at ON artifacts(expires_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_eval_results_run_id ON eval_results(run_id)`,
 	}
 
 	for _, migration := range migrations {
@@ -144,6 +809,43 @@ func runMigrations(db *sql.DB) error {
 		"ALTER TABLE api_keys ADD COLUMN last_used_at TIMESTAMP",
 		"ALTER TABLE api_keys ADD COLUMN expires_at TIMESTAMP",
 		"ALTER TABLE api_keys ADD COLUMN is_active BOOLEAN DEFAULT 1",
+		"ALTER TABLE api_keys ADD COLUMN stale_notified_at TIMESTAMP",
+		"ALTER TABLE api_keys ADD COLUMN stale_flagged_at TIMESTAMP",
+		"ALTER TABLE api_keys ADD COLUMN hash_version INTEGER NOT NULL DEFAULT 1",
+		"ALTER TABLE api_keys ADD COLUMN org_id INTEGER REFERENCES organizations(id)",
+		"ALTER TABLE api_keys ADD COLUMN revoked_at TIMESTAMP",
+		"ALTER TABLE api_keys ADD COLUMN revoked_by INTEGER",
+		"ALTER TABLE api_keys ADD COLUMN revoke_reason TEXT",
+		"ALTER TABLE api_keys ADD COLUMN allowed_cidrs TEXT",
+		"ALTER TABLE query_logs ADD COLUMN interrupted BOOLEAN NOT NULL DEFAULT 0",
+		"ALTER TABLE query_logs ADD COLUMN cache_status TEXT",
+		"ALTER TABLE query_logs ADD COLUMN query_text TEXT",
+		"ALTER TABLE query_logs ADD COLUMN moderation TEXT",
+		"ALTER TABLE query_logs ADD COLUMN moderation_rules TEXT",
+		"ALTER TABLE query_logs ADD COLUMN model TEXT",
+		"ALTER TABLE query_logs ADD COLUMN cost_usd REAL NOT NULL DEFAULT 0",
+		"ALTER TABLE ingestion_jobs ADD COLUMN message TEXT",
+		"ALTER TABLE ingestion_jobs ADD COLUMN requested_by INTEGER",
+		"ALTER TABLE ingestion_jobs ADD COLUMN source TEXT",
+		"ALTER TABLE ingestion_jobs ADD COLUMN chunking TEXT",
+		"ALTER TABLE ingestion_jobs ADD COLUMN doc_source_id INTEGER",
+		"ALTER TABLE ingestion_jobs ADD COLUMN reindex TEXT",
+		"ALTER TABLE conversations ADD COLUMN summary TEXT",
+		"ALTER TABLE conversations ADD COLUMN summarized_turns INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE conversations ADD COLUMN title TEXT",
+		"ALTER TABLE conversations ADD COLUMN title_source TEXT",
+		"ALTER TABLE conversations ADD COLUMN version INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE conversations ADD COLUMN trimmed_turns INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE conversations ADD COLUMN branched_from INTEGER",
+		"ALTER TABLE conversations ADD COLUMN branch_turn INTEGER",
+		"ALTER TABLE query_logs ADD COLUMN user_key INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE users ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT 0",
+		"ALTER TABLE query_logs ADD COLUMN client_ip TEXT",
+		"ALTER TABLE query_logs ADD COLUMN user_agent TEXT",
+		"ALTER TABLE query_logs ADD COLUMN experiment_id INTEGER",
+		"ALTER TABLE query_logs ADD COLUMN experiment_variant TEXT",
+		// Indexed here rather than with the other indexes so the column exists on old databases
+		"CREATE INDEX IF NOT EXISTS idx_query_logs_experiment ON query_logs(experiment_id, experiment_variant)",
 	}
 
 	for _, stmt := range columnAdds {
@@ -160,7 +862,7 @@ func runMigrations(db *sql.DB) error {
 	return nil
 }
 
-func tryExec(db *sql.DB, statement string) error {
+func tryExec(db execer, statement string) error {
 	if _, err := db.Exec(statement); err != nil {
 		msg := strings.ToLower(err.Error())
 		if strings.Contains(msg, "duplicate column name") ||
@@ -173,7 +875,7 @@ func tryExec(db *sql.DB, statement string) error {
 	return nil
 }
 
-func ensureUniqueConstraint(db *sql.DB, table, column string) error {
+func ensureUniqueConstraint(db execer, table, column string) error {
 	query := fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_%s ON %s(%s)`, table, column, table, column)
 	_, err := db.Exec(query)
 	return err
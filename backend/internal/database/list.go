@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Sort directions accepted by list endpoints.
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// OrderBy returns an ORDER BY expression for the named sort field. columns maps the fields a
+// listing accepts to their SQL columns; an empty field uses defaultField. order is "asc" or
+// "desc" and defaults to descending. The id column breaks ties so pages are stable.
+func OrderBy(field, order string, columns map[string]string, defaultField string) (string, error) {
+	if field == "" {
+		field = defaultField
+	}
+	column, ok := columns[field]
+	if !ok {
+		fields := make([]string, 0, len(columns))
+		for name := range columns {
+			fields = append(fields, fmt.Sprintf("%q", name))
+		}
+		slices.Sort(fields)
+		return "", fmt.Errorf("sort must be one of %s", strings.Join(fields, ", "))
+	}
+
+	switch strings.ToLower(order) {
+	case "", SortDesc:
+		return column + " DESC, id DESC", nil
+	case SortAsc:
+		return column + " ASC, id ASC", nil
+	default:
+		return "", fmt.Errorf("order must be %q or %q", SortAsc, SortDesc)
+	}
+}
+
+// ContainsPattern returns a LIKE pattern matching values that contain s, for use with
+// ESCAPE '\'. SQLite's LIKE is case-insensitive for ASCII.
+func ContainsPattern(s string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + escaped + "%"
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// writeQueueSize bounds how many writes may wait for the writer before callers block.
+const writeQueueSize = 256
+
+// Writer runs writes against a database one at a time on a dedicated goroutine. SQLite
+// allows a single writer; queueing writes in-process keeps concurrent requests from
+// contending for the lock and failing with "database is locked".
+type Writer struct {
+	db      *sql.DB
+	jobs    chan func()
+	closing chan struct{}
+	stopped chan struct{}
+}
+
+// ErrWriterClosed is returned by writes made after the database was closed with Close.
+var ErrWriterClosed = errors.New("database writer closed")
+
+// writers holds the running writer of each open database until Close stops it.
+var (
+	writersMu sync.Mutex
+	writers   = make(map[*sql.DB]*Writer)
+)
+
+// WriterFor returns the shared writer for db, starting it on first use. The writer runs
+// until db is closed with Close.
+func WriterFor(db *sql.DB) *Writer {
+	writersMu.Lock()
+	defer writersMu.Unlock()
+
+	if w, ok := writers[db]; ok {
+		return w
+	}
+	w := &Writer{
+		db:      db,
+		jobs:    make(chan func(), writeQueueSize),
+		closing: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.run()
+	writers[db] = w
+	return w
+}
+
+// Close stops db's writer, if one was started, and closes db. Writes still queued fail
+// with ErrWriterClosed.
+func Close(db *sql.DB) error {
+	writersMu.Lock()
+	w, ok := writers[db]
+	delete(writers, db)
+	writersMu.Unlock()
+
+	if ok {
+		close(w.closing)
+		<-w.stopped
+	}
+	return db.Close()
+}
+
+func (w *Writer) run() {
+	defer close(w.stopped)
+	for {
+		select {
+		case job := <-w.jobs:
+			job()
+		case <-w.closing:
+			return
+		}
+	}
+}
+
+// Do runs fn with exclusive write access and returns its error. fn must not call back into
+// the writer, which would deadlock. A write whose context is cancelled while it waits in
+// the queue is skipped.
+func (w *Writer) Do(ctx context.Context, fn func(db *sql.DB) error) error {
+	done := make(chan error, 1)
+	job := func() {
+		if err := ctx.Err(); err != nil {
+			done <- err
+			return
+		}
+		done <- fn(w.db)
+	}
+
+	select {
+	case w.jobs <- job:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-w.closing:
+		return ErrWriterClosed
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-w.stopped:
+		// The writer finishes a running job before it stops, so only skipped jobs lack a result.
+		select {
+		case err := <-done:
+			return err
+		default:
+			return ErrWriterClosed
+		}
+	}
+}
+
+// Exec runs a single statement through the writer.
+func (w *Writer) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	var res sql.Result
+	err := w.Do(ctx, func(db *sql.DB) error {
+		var err error
+		res, err = db.ExecContext(ctx, query, args...)
+		return err
+	})
+	return res, err
+}
@@ -0,0 +1,52 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+)
+
+func TestCloseStopsWriter(t *testing.T) {
+	db, err := database.OpenInMemory()
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	writer := database.WriterFor(db)
+	if database.WriterFor(db) != writer {
+		t.Fatal("WriterFor started a second writer for the same database")
+	}
+	if _, err := writer.Exec(context.Background(), `INSERT INTO users (username, password_hash) VALUES ('alice', 'x')`); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	if err := database.Close(db); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := writer.Exec(context.Background(), `DELETE FROM users`); !errors.Is(err, database.ErrWriterClosed) {
+		t.Fatalf("write after Close: got %v, want ErrWriterClosed", err)
+	}
+	if err := db.Ping(); err == nil {
+		t.Fatal("Close left the database open")
+	}
+}
+
+func TestCloseForgetsWriter(t *testing.T) {
+	first, err := database.OpenInMemory()
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	writer := database.WriterFor(first)
+	if err := database.Close(first); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// A closed database's writer is not handed out again, even for the same handle.
+	if database.WriterFor(first) == writer {
+		t.Fatal("WriterFor returned the stopped writer")
+	}
+	if err := database.Close(first); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+// Package eval measures generation quality against a set of golden prompts. Each run
+// generates code for every enabled case with the active provider, checks that it compiles,
+// defines the expected functions and resembles the reference solution, and stores the
+// scores so runs can be compared when prompts or providers change.
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+const (
+	defaultCaseTimeout    = 2 * time.Minute
+	defaultCheckTimeout   = time.Minute
+	maxPromptChars        = 20000
+	maxExpectedFunctions  = 50
+	maxReferenceCodeChars = 100000
+	// maxStoredOutputChars bounds the check output kept per result.
+	maxStoredOutputChars = 4000
+)
+
+// Run statuses.
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Run triggers.
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+)
+
+var (
+	// ErrCaseNotFound is returned for an unknown case ID.
+	ErrCaseNotFound = errors.New("eval case not found")
+	// ErrCaseExists is returned when another case already uses the name.
+	ErrCaseExists = errors.New("an eval case with this name already exists")
+	// ErrInvalidCase wraps validation failures of a case.
+	ErrInvalidCase = errors.New("invalid eval case")
+	// ErrRunNotFound is returned for an unknown run ID, or when no run has finished yet.
+	ErrRunNotFound = errors.New("eval run not found")
+	// ErrRunning is returned when a run is requested while another is in progress.
+	ErrRunning = errors.New("an eval run is already in progress")
+	// ErrNoCases is returned when a run is requested without any enabled case.
+	ErrNoCases = errors.New("no enabled eval cases")
+)
+
+var caseNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,100}$`)
+
+// Config controls when runs are scheduled and how generated code is checked.
+type Config struct {
+	// Interval is how often scheduled runs happen. Zero disables the schedule; runs can
+	// still be triggered by admins.
+	Interval time.Duration
+	// RunAt aligns scheduled runs to a UTC time of day, "HH:MM". Empty runs one Interval
+	// after start.
+	RunAt string
+	// CaseTimeout bounds generating and checking a single case.
+	CaseTimeout time.Duration
+	// ClarinetPath runs `clarinet check` on generated contracts. Empty uses the built-in
+	// Clarity parser and analyzer.
+	ClarinetPath string
+}
+
+// ConfigFromEnv loads EVAL_INTERVAL, EVAL_RUN_AT, EVAL_CASE_TIMEOUT and EVAL_CLARINET_PATH.
+// Invalid values are ignored.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		CaseTimeout:  defaultCaseTimeout,
+		ClarinetPath: strings.TrimSpace(os.Getenv("EVAL_CLARINET_PATH")),
+	}
+	if interval, err := time.ParseDuration(os.Getenv("EVAL_INTERVAL")); err == nil && interval > 0 {
+		cfg.Interval = interval
+	}
+	if runAt := strings.TrimSpace(os.Getenv("EVAL_RUN_AT")); runAt != "" {
+		if _, err := time.Parse("15:04", runAt); err != nil {
+			log.Printf("eval: ignoring EVAL_RUN_AT %q, expected HH:MM", runAt)
+		} else {
+			cfg.RunAt = runAt
+		}
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("EVAL_CASE_TIMEOUT")); err == nil && timeout > 0 {
+		cfg.CaseTimeout = timeout
+	}
+	return cfg
+}
+
+// nextRun returns when the scheduled run after now is due.
+func (c Config) nextRun(now time.Time) time.Time {
+	at, err := time.Parse("15:04", c.RunAt)
+	if c.RunAt == "" || err != nil {
+		return now.Add(c.Interval)
+	}
+	now = now.UTC()
+	anchor := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, time.UTC)
+	if anchor.After(now) {
+		return anchor
+	}
+	return anchor.Add((now.Sub(anchor)/c.Interval + 1) * c.Interval)
+}
+
+// Case is a golden prompt with the properties its generated code must have.
+type Case struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Prompt string `json:"prompt"`
+	// ExpectedFunctions must all be defined by the generated contract.
+	ExpectedFunctions []string `json:"expected_functions"`
+	// MustCompile fails the case when the generated contract does not pass the check.
+	MustCompile bool `json:"must_compile"`
+	// ReferenceCode is a known-good solution the generated code is compared to.
+	ReferenceCode string `json:"reference_code,omitempty"`
+	// MinSimilarity fails the case when the similarity to ReferenceCode is lower. Zero
+	// reports the similarity without enforcing it.
+	MinSimilarity float64   `json:"min_similarity,omitempty"`
+	Enabled       bool      `json:"enabled"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// normalize trims the case and validates it.
+func (c Case) normalize() (Case, error) {
+	c.Name = strings.TrimSpace(c.Name)
+	if !caseNamePattern.MatchString(c.Name) {
+		return c, fmt.Errorf("%w: name must be 1-100 letters, digits, dots, underscores or dashes", ErrInvalidCase)
+	}
+	c.Prompt = strings.TrimSpace(c.Prompt)
+	if c.Prompt == "" {
+		return c, fmt.Errorf("%w: prompt is required", ErrInvalidCase)
+	}
+	if len(c.Prompt) > maxPromptChars {
+		return c, fmt.Errorf("%w: prompt exceeds %d characters", ErrInvalidCase, maxPromptChars)
+	}
+
+	functions := make([]string, 0, len(c.ExpectedFunctions))
+	seen := make(map[string]bool, len(c.ExpectedFunctions))
+	for _, name := range c.ExpectedFunctions {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if strings.ContainsAny(name, " \t\n()") {
+			return c, fmt.Errorf("%w: %q is not a function name", ErrInvalidCase, name)
+		}
+		seen[name] = true
+		functions = append(functions, name)
+	}
+	if len(functions) > maxExpectedFunctions {
+		return c, fmt.Errorf("%w: at most %d expected functions are allowed", ErrInvalidCase, maxExpectedFunctions)
+	}
+	c.ExpectedFunctions = functions
+
+	c.ReferenceCode = strings.TrimSpace(c.ReferenceCode)
+	if len(c.ReferenceCode) > maxReferenceCodeChars {
+		return c, fmt.Errorf("%w: reference_code exceeds %d characters", ErrInvalidCase, maxReferenceCodeChars)
+	}
+	if c.MinSimilarity < 0 || c.MinSimilarity > 1 {
+		return c, fmt.Errorf("%w: min_similarity must be between 0 and 1", ErrInvalidCase)
+	}
+	if c.MinSimilarity > 0 && c.ReferenceCode == "" {
+		return c, fmt.Errorf("%w: min_similarity requires reference_code", ErrInvalidCase)
+	}
+	return c, nil
+}
+
+// Run is one evaluation of every enabled case. Rates are fractions between 0 and 1; a rate
+// is omitted when no case measured it.
+type Run struct {
+	ID       int64  `json:"id"`
+	Status   string `json:"status"`
+	Trigger  string `json:"trigger"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	// RequestedBy is the admin who triggered a manual run.
+	RequestedBy *int64 `json:"requested_by,omitempty"`
+	Total       int    `json:"total"`
+	Passed      int    `json:"passed"`
+	// Errors counts cases whose generation or check failed outright.
+	Errors           int      `json:"errors"`
+	PassRate         *float64 `json:"pass_rate,omitempty"`
+	CompilePassRate  *float64 `json:"compile_pass_rate,omitempty"`
+	FunctionPassRate *float64 `json:"function_pass_rate,omitempty"`
+	AvgSimilarity    *float64 `json:"avg_similarity,omitempty"`
+	// Checker is "clarinet" or "static", whichever checked compilation.
+	Checker    string     `json:"checker"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Result is the score of one case in a run.
+type Result struct {
+	CaseID   int64  `json:"case_id"`
+	CaseName string `json:"case_name"`
+	Passed   bool   `json:"passed"`
+	Compiled bool   `json:"compiled"`
+	// CheckOutput holds the errors reported by the compile check.
+	CheckOutput      string   `json:"check_output,omitempty"`
+	MissingFunctions []string `json:"missing_functions,omitempty"`
+	Similarity       *float64 `json:"similarity,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	Code             string   `json:"code,omitempty"`
+	LatencyMs        int64    `json:"latency_ms"`
+	InputTokens      int      `json:"input_tokens"`
+	OutputTokens     int      `json:"output_tokens"`
+}
+
+// Report is a run with its results, compared to the previous completed run.
+type Report struct {
+	Run      *Run     `json:"run"`
+	Results  []Result `json:"results"`
+	Previous *Run     `json:"previous,omitempty"`
+	// Regressions lists cases that passed in the previous run and fail in this one; Fixed
+	// lists the reverse.
+	Regressions []string `json:"regressions"`
+	Fixed       []string `json:"fixed"`
+}
+
+// Generator produces the response for one golden prompt.
+type Generator func(ctx context.Context, prompt string) (*codegen.CodeGenerationResponse, error)
+
+// Target is the provider and model a run generates with.
+type Target struct {
+	Provider string
+	Model    string
+	Generate Generator
+}
@@ -0,0 +1,316 @@
+package eval
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// repository stores cases, runs and their results.
+type repository struct {
+	db *sql.DB
+}
+
+const caseColumns = `
+	id, name, prompt, expected_functions, must_compile, COALESCE(reference_code, ''),
+	min_similarity, enabled, created_at, updated_at
+`
+
+const runColumns = `
+	id, status, triggered_by, provider, model, requested_by, total, passed, errors, pass_rate,
+	compile_pass_rate, function_pass_rate, avg_similarity, checker, COALESCE(error, ''),
+	started_at, finished_at
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCase(row rowScanner) (*Case, error) {
+	var (
+		c         Case
+		functions string
+	)
+	if err := row.Scan(&c.ID, &c.Name, &c.Prompt, &functions, &c.MustCompile, &c.ReferenceCode,
+		&c.MinSimilarity, &c.Enabled, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(functions), &c.ExpectedFunctions); err != nil {
+		return nil, fmt.Errorf("decode expected functions of eval case %d: %w", c.ID, err)
+	}
+	return &c, nil
+}
+
+func scanRun(row rowScanner) (*Run, error) {
+	var (
+		r           Run
+		requestedBy sql.NullInt64
+		finishedAt  sql.NullTime
+		rates       [4]sql.NullFloat64
+	)
+	if err := row.Scan(&r.ID, &r.Status, &r.Trigger, &r.Provider, &r.Model, &requestedBy, &r.Total,
+		&r.Passed, &r.Errors, &rates[0], &rates[1], &rates[2], &rates[3], &r.Checker, &r.Error,
+		&r.StartedAt, &finishedAt); err != nil {
+		return nil, err
+	}
+	if requestedBy.Valid {
+		r.RequestedBy = &requestedBy.Int64
+	}
+	if finishedAt.Valid {
+		r.FinishedAt = &finishedAt.Time
+	}
+	for i, dest := range []**float64{&r.PassRate, &r.CompilePassRate, &r.FunctionPassRate, &r.AvgSimilarity} {
+		if rates[i].Valid {
+			value := rates[i].Float64
+			*dest = &value
+		}
+	}
+	return &r, nil
+}
+
+func (r *repository) listCases(ctx context.Context, enabledOnly bool) ([]Case, error) {
+	query := `SELECT ` + caseColumns + ` FROM eval_cases`
+	if enabledOnly {
+		query += ` WHERE enabled = 1`
+	}
+	rows, err := r.db.QueryContext(ctx, query+` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("list eval cases: %w", err)
+	}
+	defer rows.Close()
+
+	cases := make([]Case, 0)
+	for rows.Next() {
+		c, err := scanCase(rows)
+		if err != nil {
+			return nil, err
+		}
+		cases = append(cases, *c)
+	}
+	return cases, rows.Err()
+}
+
+func (r *repository) getCase(ctx context.Context, id int64) (*Case, error) {
+	c, err := scanCase(r.db.QueryRowContext(ctx, `SELECT `+caseColumns+` FROM eval_cases WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCaseNotFound
+	}
+	return c, err
+}
+
+// nameTaken reports whether a case other than id uses the name.
+func (r *repository) nameTaken(ctx context.Context, name string, id int64) (bool, error) {
+	var taken bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM eval_cases WHERE name = ? AND id != ?)`, name, id).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("check eval case name: %w", err)
+	}
+	return taken, nil
+}
+
+func (r *repository) createCase(ctx context.Context, c *Case) error {
+	if taken, err := r.nameTaken(ctx, c.Name, 0); err != nil {
+		return err
+	} else if taken {
+		return ErrCaseExists
+	}
+	functions, _ := json.Marshal(c.ExpectedFunctions)
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO eval_cases (name, prompt, expected_functions, must_compile, reference_code, min_similarity, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.Name, c.Prompt, string(functions), c.MustCompile, c.ReferenceCode, c.MinSimilarity, c.Enabled, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("create eval case: %w", err)
+	}
+	if c.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("create eval case: %w", err)
+	}
+	c.CreatedAt, c.UpdatedAt = now, now
+	return nil
+}
+
+func (r *repository) updateCase(ctx context.Context, c *Case) error {
+	if taken, err := r.nameTaken(ctx, c.Name, c.ID); err != nil {
+		return err
+	} else if taken {
+		return ErrCaseExists
+	}
+	functions, _ := json.Marshal(c.ExpectedFunctions)
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE eval_cases
+		SET name = ?, prompt = ?, expected_functions = ?, must_compile = ?, reference_code = ?,
+			min_similarity = ?, enabled = ?, updated_at = ?
+		WHERE id = ?`,
+		c.Name, c.Prompt, string(functions), c.MustCompile, c.ReferenceCode, c.MinSimilarity, c.Enabled, now, c.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update eval case: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrCaseNotFound
+	}
+	c.UpdatedAt = now
+	return nil
+}
+
+// deleteCase removes a case. Results of past runs keep the case's name.
+func (r *repository) deleteCase(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM eval_cases WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete eval case: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrCaseNotFound
+	}
+	return nil
+}
+
+func (r *repository) createRun(ctx context.Context, run *Run) error {
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO eval_runs (status, triggered_by, provider, model, requested_by, total, checker, started_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.Status, run.Trigger, run.Provider, run.Model, run.RequestedBy, run.Total, run.Checker, run.StartedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create eval run: %w", err)
+	}
+	if run.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("create eval run: %w", err)
+	}
+	return nil
+}
+
+func (r *repository) finishRun(ctx context.Context, run *Run) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE eval_runs
+		SET status = ?, total = ?, passed = ?, errors = ?, pass_rate = ?, compile_pass_rate = ?,
+			function_pass_rate = ?, avg_similarity = ?, error = ?, finished_at = ?
+		WHERE id = ?`,
+		run.Status, run.Total, run.Passed, run.Errors, run.PassRate, run.CompilePassRate,
+		run.FunctionPassRate, run.AvgSimilarity, nullString(run.Error), run.FinishedAt, run.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("finish eval run: %w", err)
+	}
+	return nil
+}
+
+// failAbandoned marks runs left running by a previous process as failed.
+func (r *repository) failAbandoned(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE eval_runs SET status = ?, error = ?, finished_at = ? WHERE status = ?`,
+		StatusFailed, "interrupted by a server restart", time.Now().UTC(), StatusRunning,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("fail abandoned eval runs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (r *repository) saveResult(ctx context.Context, runID int64, result Result) error {
+	var missing any
+	if len(result.MissingFunctions) > 0 {
+		raw, _ := json.Marshal(result.MissingFunctions)
+		missing = string(raw)
+	}
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO eval_results (run_id, case_id, case_name, passed, compiled, check_output, missing_functions,
+			similarity, error, code, latency_ms, input_tokens, output_tokens)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		runID, result.CaseID, result.CaseName, result.Passed, result.Compiled, nullString(result.CheckOutput), missing,
+		result.Similarity, nullString(result.Error), nullString(result.Code), result.LatencyMs, result.InputTokens, result.OutputTokens,
+	)
+	if err != nil {
+		return fmt.Errorf("save eval result: %w", err)
+	}
+	return nil
+}
+
+func (r *repository) getRun(ctx context.Context, id int64) (*Run, error) {
+	run, err := scanRun(r.db.QueryRowContext(ctx, `SELECT `+runColumns+` FROM eval_runs WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRunNotFound
+	}
+	return run, err
+}
+
+// latestCompleted returns the most recent completed run before beforeID, or any when
+// beforeID is zero.
+func (r *repository) latestCompleted(ctx context.Context, beforeID int64) (*Run, error) {
+	query := `SELECT ` + runColumns + ` FROM eval_runs WHERE status = ?`
+	args := []any{StatusCompleted}
+	if beforeID > 0 {
+		query += ` AND id < ?`
+		args = append(args, beforeID)
+	}
+	run, err := scanRun(r.db.QueryRowContext(ctx, query+` ORDER BY id DESC LIMIT 1`, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRunNotFound
+	}
+	return run, err
+}
+
+func (r *repository) listRuns(ctx context.Context, limit int) ([]Run, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+runColumns+` FROM eval_runs ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list eval runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := make([]Run, 0)
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+func (r *repository) results(ctx context.Context, runID int64) ([]Result, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT case_id, case_name, passed, compiled, COALESCE(check_output, ''), missing_functions,
+			similarity, COALESCE(error, ''), COALESCE(code, ''), latency_ms, input_tokens, output_tokens
+		FROM eval_results WHERE run_id = ? ORDER BY id`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("list eval results: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]Result, 0)
+	for rows.Next() {
+		var (
+			result     Result
+			missing    sql.NullString
+			similarity sql.NullFloat64
+		)
+		if err := rows.Scan(&result.CaseID, &result.CaseName, &result.Passed, &result.Compiled, &result.CheckOutput,
+			&missing, &similarity, &result.Error, &result.Code, &result.LatencyMs, &result.InputTokens, &result.OutputTokens); err != nil {
+			return nil, err
+		}
+		if missing.Valid {
+			if err := json.Unmarshal([]byte(missing.String), &result.MissingFunctions); err != nil {
+				return nil, fmt.Errorf("decode missing functions: %w", err)
+			}
+		}
+		if similarity.Valid {
+			result.Similarity = &similarity.Float64
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,209 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/clarity"
+)
+
+// Checker names.
+const (
+	CheckerStatic   = "static"
+	CheckerClarinet = "clarinet"
+)
+
+// maxCheckDiagnostics bounds the diagnostics quoted in a failed static check.
+const maxCheckDiagnostics = 10
+
+// evalContractName is the contract name generated code is checked under.
+const evalContractName = "eval"
+
+// checker decides whether a contract compiles and explains why not.
+type checker interface {
+	name() string
+	check(ctx context.Context, code string) (compiled bool, output string, err error)
+}
+
+// staticChecker parses and analyzes contracts in process. Only error diagnostics fail it.
+type staticChecker struct{}
+
+func (staticChecker) name() string { return CheckerStatic }
+
+func (staticChecker) check(_ context.Context, code string) (bool, string, error) {
+	result, err := clarity.Analyze(code, nil)
+	if err != nil {
+		return false, "", err
+	}
+	var errs []string
+	for _, d := range result.Diagnostics {
+		if d.Severity == clarity.SeverityError && len(errs) < maxCheckDiagnostics {
+			errs = append(errs, d.String())
+		}
+	}
+	return result.Summary.Errors == 0, strings.Join(errs, "\n"), nil
+}
+
+// clarinetChecker runs `clarinet check` on a throwaway project holding the contract.
+type clarinetChecker struct {
+	path string
+}
+
+func (clarinetChecker) name() string { return CheckerClarinet }
+
+// clarinetManifest declares the single contract of the throwaway project.
+const clarinetManifest = `[project]
+name = "eval"
+authors = []
+telemetry = false
+requirements = []
+
+[contracts.` + evalContractName + `]
+path = "contracts/` + evalContractName + `.clar"
+clarity_version = 2
+epoch = 2.5
+`
+
+// clarinetDevnet is the devnet deployer clarinet needs to plan a deployment. The mnemonic
+// is clarinet's public default and never holds funds.
+const clarinetDevnet = `[network]
+name = "devnet"
+
+[accounts.deployer]
+mnemonic = "twice kind fence tip hidden tilt action fragile skin nothing glory cousin green tomorrow spring wrist shed math olympic multiply hip blue scout claw"
+balance = 100_000_000_000_000
+`
+
+func (c clarinetChecker) check(ctx context.Context, code string) (bool, string, error) {
+	dir, err := os.MkdirTemp("", "eval-clarinet-")
+	if err != nil {
+		return false, "", err
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"Clarinet.toml":                           clarinetManifest,
+		"settings/Devnet.toml":                    clarinetDevnet,
+		"contracts/" + evalContractName + ".clar": code,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return false, "", err
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return false, "", err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultCheckTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.path, "check")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return true, "", nil
+	case errors.As(err, &exitErr) && ctx.Err() == nil:
+		return false, truncate(strings.TrimSpace(string(output)), maxStoredOutputChars), nil
+	default:
+		return false, "", fmt.Errorf("run clarinet check: %w", err)
+	}
+}
+
+// score fills in how well the generated code meets the case's expectations.
+func score(ctx context.Context, check checker, c Case, code string, result *Result) error {
+	result.Code = code
+	if strings.TrimSpace(code) == "" {
+		result.CheckOutput = "no code was generated"
+		result.MissingFunctions = c.ExpectedFunctions
+		return nil
+	}
+
+	compiled, output, err := check.check(ctx, code)
+	if err != nil {
+		return err
+	}
+	result.Compiled, result.CheckOutput = compiled, output
+
+	defined := make(map[string]bool)
+	if forms, err := clarity.Parse(code); err == nil {
+		for _, name := range clarity.FunctionNames(forms) {
+			defined[name] = true
+		}
+	}
+	for _, name := range c.ExpectedFunctions {
+		if !defined[name] {
+			result.MissingFunctions = append(result.MissingFunctions, name)
+		}
+	}
+
+	if c.ReferenceCode != "" {
+		similarity := Similarity(code, c.ReferenceCode)
+		result.Similarity = &similarity
+	}
+	return nil
+}
+
+// passed reports whether a scored result meets every expectation of its case.
+func passed(c Case, result Result) bool {
+	if result.Error != "" || result.Code == "" {
+		return false
+	}
+	if c.MustCompile && !result.Compiled {
+		return false
+	}
+	if len(result.MissingFunctions) > 0 {
+		return false
+	}
+	if c.MinSimilarity > 0 && (result.Similarity == nil || *result.Similarity < c.MinSimilarity) {
+		return false
+	}
+	return true
+}
+
+// Similarity is the Jaccard index of the token sets of two contracts, ignoring comments,
+// whitespace and punctuation: 1 for the same tokens, 0 for none in common.
+func Similarity(a, b string) float64 {
+	ta, tb := tokens(a), tokens(b)
+	if len(ta) == 0 && len(tb) == 0 {
+		return 1
+	}
+	shared := 0
+	for token := range ta {
+		if tb[token] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(ta)+len(tb)-shared)
+}
+
+func tokens(code string) map[string]bool {
+	set := make(map[string]bool)
+	for _, line := range strings.Split(code, "\n") {
+		if i := strings.Index(line, ";;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return unicode.IsSpace(r) || strings.ContainsRune("(){},:\"", r)
+		})
+		for _, field := range fields {
+			set[field] = true
+		}
+	}
+	return set
+}
+
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return strings.ToValidUTF8(s[:limit], "") + "…"
+}
@@ -0,0 +1,352 @@
+package eval
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	defaultListRuns = 20
+	maxListRuns     = 100
+)
+
+// Service manages golden cases and runs them against the active provider. Only one run
+// happens at a time.
+type Service struct {
+	repo   *repository
+	cfg    Config
+	target func() (Target, error)
+	check  checker
+
+	mu      sync.Mutex
+	running bool
+}
+
+// NewService returns a service storing cases and runs in db. target resolves the provider
+// and model at the start of every run, so runtime provider switches apply.
+func NewService(db *sql.DB, cfg Config, target func() (Target, error)) *Service {
+	if cfg.CaseTimeout <= 0 {
+		cfg.CaseTimeout = defaultCaseTimeout
+	}
+	var check checker = staticChecker{}
+	if cfg.ClarinetPath != "" {
+		check = clarinetChecker{path: cfg.ClarinetPath}
+	}
+	return &Service{repo: &repository{db: db}, cfg: cfg, target: target, check: check}
+}
+
+// Start marks runs interrupted by a restart as failed, then runs the golden cases on
+// schedule until ctx is cancelled. Without an interval, runs only happen on request.
+func (s *Service) Start(ctx context.Context) {
+	if n, err := s.repo.failAbandoned(ctx); err != nil {
+		log.Printf("eval: %v", err)
+	} else if n > 0 {
+		log.Printf("eval: marked %d abandoned runs as failed", n)
+	}
+	if s.cfg.Interval <= 0 {
+		return
+	}
+
+	go func() {
+		timer := time.NewTimer(time.Until(s.cfg.nextRun(time.Now())))
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			run, err := s.Execute(ctx, TriggerScheduled, nil)
+			switch {
+			case errors.Is(err, ErrRunning), errors.Is(err, ErrNoCases):
+			case err != nil:
+				log.Printf("eval: scheduled run failed: %v", err)
+			default:
+				log.Printf("eval: run %d passed %d of %d cases", run.ID, run.Passed, run.Total)
+			}
+			timer.Reset(time.Until(s.cfg.nextRun(time.Now())))
+		}
+	}()
+}
+
+// Trigger starts a run in the background and returns it as soon as it is recorded.
+func (s *Service) Trigger(ctx context.Context, requestedBy *int64) (*Run, error) {
+	run, cases, target, err := s.begin(ctx, TriggerManual, requestedBy)
+	if err != nil {
+		return nil, err
+	}
+	started := *run
+	go s.run(context.Background(), run, cases, target)
+	return &started, nil
+}
+
+// Execute runs every enabled case and waits for the run to finish.
+func (s *Service) Execute(ctx context.Context, trigger string, requestedBy *int64) (*Run, error) {
+	run, cases, target, err := s.begin(ctx, trigger, requestedBy)
+	if err != nil {
+		return nil, err
+	}
+	s.run(ctx, run, cases, target)
+	if run.Status == StatusFailed {
+		return run, errors.New(run.Error)
+	}
+	return run, nil
+}
+
+// begin claims the run slot, resolves the target and records the new run.
+func (s *Service) begin(ctx context.Context, trigger string, requestedBy *int64) (*Run, []Case, Target, error) {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return nil, nil, Target{}, ErrRunning
+	}
+	s.running = true
+	s.mu.Unlock()
+
+	run, cases, target, err := s.prepare(ctx, trigger, requestedBy)
+	if err != nil {
+		s.release()
+		return nil, nil, Target{}, err
+	}
+	return run, cases, target, nil
+}
+
+func (s *Service) prepare(ctx context.Context, trigger string, requestedBy *int64) (*Run, []Case, Target, error) {
+	cases, err := s.repo.listCases(ctx, true)
+	if err != nil {
+		return nil, nil, Target{}, err
+	}
+	if len(cases) == 0 {
+		return nil, nil, Target{}, ErrNoCases
+	}
+	target, err := s.target()
+	if err != nil {
+		return nil, nil, Target{}, fmt.Errorf("resolve eval target: %w", err)
+	}
+
+	run := &Run{
+		Status:      StatusRunning,
+		Trigger:     trigger,
+		Provider:    target.Provider,
+		Model:       target.Model,
+		RequestedBy: requestedBy,
+		Total:       len(cases),
+		Checker:     s.check.name(),
+		StartedAt:   time.Now().UTC(),
+	}
+	if err := s.repo.createRun(ctx, run); err != nil {
+		return nil, nil, Target{}, err
+	}
+	return run, cases, target, nil
+}
+
+func (s *Service) release() {
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+}
+
+// run evaluates the cases one at a time and records the run's scores.
+func (s *Service) run(ctx context.Context, run *Run, cases []Case, target Target) {
+	defer s.release()
+
+	var (
+		compiled, functionCases, functionsMet, similarities int
+		similaritySum                                       float64
+	)
+	for _, c := range cases {
+		if ctx.Err() != nil {
+			break
+		}
+		result := s.evaluate(ctx, target, c)
+		if err := s.repo.saveResult(ctx, run.ID, result); err != nil {
+			log.Printf("eval: %v", err)
+		}
+
+		if result.Passed {
+			run.Passed++
+		}
+		if result.Error != "" {
+			run.Errors++
+		}
+		if result.Compiled {
+			compiled++
+		}
+		if len(c.ExpectedFunctions) > 0 {
+			functionCases++
+			if result.Error == "" && len(result.MissingFunctions) == 0 {
+				functionsMet++
+			}
+		}
+		if result.Similarity != nil {
+			similarities++
+			similaritySum += *result.Similarity
+		}
+	}
+
+	run.PassRate = rate(run.Passed, run.Total)
+	run.CompilePassRate = rate(compiled, run.Total)
+	run.FunctionPassRate = rate(functionsMet, functionCases)
+	if similarities > 0 {
+		avg := similaritySum / float64(similarities)
+		run.AvgSimilarity = &avg
+	}
+	run.Status = StatusCompleted
+	if err := ctx.Err(); err != nil {
+		run.Status, run.Error = StatusFailed, "run cancelled: "+err.Error()
+	}
+	finished := time.Now().UTC()
+	run.FinishedAt = &finished
+
+	// Record the outcome even when the run was cancelled with ctx
+	if err := s.repo.finishRun(context.WithoutCancel(ctx), run); err != nil {
+		log.Printf("eval: %v", err)
+	}
+}
+
+// evaluate generates and scores one case within the case timeout.
+func (s *Service) evaluate(ctx context.Context, target Target, c Case) Result {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.CaseTimeout)
+	defer cancel()
+
+	result := Result{CaseID: c.ID, CaseName: c.Name}
+	started := time.Now()
+	response, err := target.Generate(ctx, c.Prompt)
+	result.LatencyMs = time.Since(started).Milliseconds()
+	if err != nil {
+		result.Error = "generate: " + err.Error()
+		result.MissingFunctions = c.ExpectedFunctions
+		return result
+	}
+	result.InputTokens, result.OutputTokens = response.InputTokens, response.OutputTokens
+
+	if err := score(ctx, s.check, c, response.Code, &result); err != nil {
+		result.Error = "check: " + err.Error()
+	}
+	result.Passed = passed(c, result)
+	return result
+}
+
+func rate(n, total int) *float64 {
+	if total == 0 {
+		return nil
+	}
+	value := float64(n) / float64(total)
+	return &value
+}
+
+// Running reports whether a run is in progress.
+func (s *Service) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// Cases returns every case, oldest first.
+func (s *Service) Cases(ctx context.Context) ([]Case, error) {
+	return s.repo.listCases(ctx, false)
+}
+
+// Case returns a single case.
+func (s *Service) Case(ctx context.Context, id int64) (*Case, error) {
+	return s.repo.getCase(ctx, id)
+}
+
+// CreateCase validates and stores a new case.
+func (s *Service) CreateCase(ctx context.Context, c Case) (*Case, error) {
+	c, err := c.normalize()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.createCase(ctx, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UpdateCase validates and saves a changed case.
+func (s *Service) UpdateCase(ctx context.Context, c Case) (*Case, error) {
+	c, err := c.normalize()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.updateCase(ctx, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// DeleteCase removes a case; past results keep its name.
+func (s *Service) DeleteCase(ctx context.Context, id int64) error {
+	return s.repo.deleteCase(ctx, id)
+}
+
+// Runs returns the most recent runs, newest first. limit defaults to 20 and is capped at 100.
+func (s *Service) Runs(ctx context.Context, limit int) ([]Run, error) {
+	if limit <= 0 {
+		limit = defaultListRuns
+	}
+	return s.repo.listRuns(ctx, min(limit, maxListRuns))
+}
+
+// Report returns a run with its results, compared to the completed run before it.
+func (s *Service) Report(ctx context.Context, runID int64) (*Report, error) {
+	run, err := s.repo.getRun(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	return s.report(ctx, run)
+}
+
+// LatestReport reports on the most recent completed run.
+func (s *Service) LatestReport(ctx context.Context) (*Report, error) {
+	run, err := s.repo.latestCompleted(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	return s.report(ctx, run)
+}
+
+func (s *Service) report(ctx context.Context, run *Run) (*Report, error) {
+	results, err := s.repo.results(ctx, run.ID)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Run: run, Results: results, Regressions: []string{}, Fixed: []string{}}
+
+	previous, err := s.repo.latestCompleted(ctx, run.ID)
+	if errors.Is(err, ErrRunNotFound) {
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	report.Previous = previous
+
+	previousResults, err := s.repo.results(ctx, previous.ID)
+	if err != nil {
+		return nil, err
+	}
+	passedBefore := make(map[string]bool, len(previousResults))
+	for _, result := range previousResults {
+		passedBefore[result.CaseName] = result.Passed
+	}
+	for _, result := range results {
+		before, ok := passedBefore[result.CaseName]
+		switch {
+		case !ok:
+		case before && !result.Passed:
+			report.Regressions = append(report.Regressions, result.CaseName)
+		case !before && result.Passed:
+			report.Fixed = append(report.Fixed, result.CaseName)
+		}
+	}
+	return report, nil
+}
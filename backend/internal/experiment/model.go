@@ -0,0 +1,179 @@
+package experiment
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+// Experiment statuses. Variants can only be changed while an experiment is not running, and
+// at most one experiment runs at a time.
+const (
+	StatusDraft   = "draft"
+	StatusRunning = "running"
+	StatusStopped = "stopped"
+)
+
+// ErrInvalid wraps validation failures of an experiment or its variants.
+var ErrInvalid = errors.New("invalid experiment")
+
+const (
+	maxVariants    = 10
+	maxDescription = 1000
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Variant is one arm of an experiment. Provider, Model and PromptTemplate replace the
+// caller's defaults for requests assigned to it; unset fields keep them, so a variant that
+// sets none is a control group.
+type Variant struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// PromptTemplate names a prompt template to build the prompt from.
+	PromptTemplate string `json:"prompt_template,omitempty"`
+	// Traffic is the percentage of users assigned to the variant.
+	Traffic int `json:"traffic"`
+}
+
+// ChangesModel reports whether the variant replaces the caller's model.
+func (v Variant) ChangesModel() bool {
+	return v.Provider != "" || v.Model != ""
+}
+
+// Selection resolves the variant's model: Model when set, otherwise Provider's active model.
+// It fails when the model is not on the allowlist, which may happen after the allowlist changes.
+func (v Variant) Selection() (codegen.ModelSelection, error) {
+	if v.Model != "" {
+		return codegen.SelectModel(v.Model)
+	}
+	return codegen.SelectModel(v.Provider)
+}
+
+// Experiment splits users between variants by traffic percentage. Users outside the
+// variants' combined traffic are not enrolled and keep their defaults.
+type Experiment struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Status      string     `json:"status"`
+	Variants    []Variant  `json:"variants"`
+	CreatedBy   *int64     `json:"created_by,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	StoppedAt   *time.Time `json:"stopped_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Normalize trims the experiment and its variants and lowercases providers.
+func (e *Experiment) Normalize() {
+	e.Name = strings.TrimSpace(e.Name)
+	e.Description = strings.TrimSpace(e.Description)
+	for i := range e.Variants {
+		v := &e.Variants[i]
+		v.Name = strings.TrimSpace(v.Name)
+		v.Provider = strings.ToLower(strings.TrimSpace(v.Provider))
+		v.Model = strings.TrimSpace(v.Model)
+		v.PromptTemplate = strings.TrimSpace(v.PromptTemplate)
+	}
+}
+
+// Validate checks the name, that there are between two and ten uniquely named variants with
+// 1-100% traffic adding up to at most 100%, and that each variant's model can serve requests
+// and belongs to its provider. Prompt templates are checked by the caller.
+func (e Experiment) Validate() error {
+	if !namePattern.MatchString(e.Name) {
+		return fmt.Errorf("%w: name must be 1-64 lowercase letters, digits, '-' or '_', starting with a letter or digit", ErrInvalid)
+	}
+	if len(e.Description) > maxDescription {
+		return fmt.Errorf("%w: description must be at most %d characters", ErrInvalid, maxDescription)
+	}
+	if len(e.Variants) < 2 || len(e.Variants) > maxVariants {
+		return fmt.Errorf("%w: an experiment needs 2 to %d variants", ErrInvalid, maxVariants)
+	}
+
+	names := make(map[string]bool, len(e.Variants))
+	total := 0
+	for _, v := range e.Variants {
+		if !namePattern.MatchString(v.Name) {
+			return fmt.Errorf("%w: variant name %q must be 1-64 lowercase letters, digits, '-' or '_'", ErrInvalid, v.Name)
+		}
+		if names[v.Name] {
+			return fmt.Errorf("%w: duplicate variant %q", ErrInvalid, v.Name)
+		}
+		names[v.Name] = true
+
+		if v.Traffic < 1 || v.Traffic > 100 {
+			return fmt.Errorf("%w: variant %s: traffic must be between 1 and 100", ErrInvalid, v.Name)
+		}
+		total += v.Traffic
+
+		if v.ChangesModel() {
+			selection, err := v.Selection()
+			if err != nil {
+				return fmt.Errorf("%w: variant %s: %v", ErrInvalid, v.Name, err)
+			}
+			if v.Provider != "" && selection.Provider != v.Provider {
+				return fmt.Errorf("%w: variant %s: model %s is served by %s, not %s", ErrInvalid, v.Name, selection.Model, selection.Provider, v.Provider)
+			}
+		}
+	}
+	if total > 100 {
+		return fmt.Errorf("%w: variant traffic adds up to %d%%, more than 100%%", ErrInvalid, total)
+	}
+	return nil
+}
+
+// Assign returns the variant serving the user, or false when the user falls outside the
+// experiment's traffic. A user's bucket depends only on the experiment and user IDs, so
+// they stay in the same variant for the whole experiment.
+func (e Experiment) Assign(userID int64) (Variant, bool) {
+	bucket := Bucket(e.ID, userID)
+	for _, v := range e.Variants {
+		if bucket < v.Traffic {
+			return v, true
+		}
+		bucket -= v.Traffic
+	}
+	return Variant{}, false
+}
+
+// Bucket maps a user to one of 100 buckets of an experiment.
+func Bucket(experimentID, userID int64) int {
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatInt(experimentID, 10) + ":" + strconv.FormatInt(userID, 10)))
+	return int(h.Sum32() % 100)
+}
+
+// VariantResult aggregates the query logs and feedback of one variant.
+type VariantResult struct {
+	Variant      string  `json:"variant"`
+	Requests     int64   `json:"requests"`
+	Successes    int64   `json:"successes"`
+	Errors       int64   `json:"errors"`
+	SuccessRate  float64 `json:"success_rate"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	P50LatencyMs int64   `json:"p50_latency_ms"`
+	P95LatencyMs int64   `json:"p95_latency_ms"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+	// FeedbackUp and FeedbackDown count ratings of the variant's answers; PositiveRate is
+	// the share of up ratings.
+	FeedbackUp   int64   `json:"feedback_up"`
+	FeedbackDown int64   `json:"feedback_down"`
+	PositiveRate float64 `json:"positive_rate"`
+}
+
+// Results compares the variants of an experiment.
+type Results struct {
+	Experiment *Experiment     `json:"experiment"`
+	Variants   []VariantResult `json:"variants"`
+}
@@ -0,0 +1,360 @@
+package experiment
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no experiment has the requested ID.
+	ErrNotFound = errors.New("experiment not found")
+	// ErrExists is returned when another experiment already uses the name.
+	ErrExists = errors.New("experiment already exists")
+	// ErrRunning is returned when changing or deleting a running experiment.
+	ErrRunning = errors.New("experiment is running; stop it first")
+	// ErrConflict is returned when starting an experiment while another one is running.
+	ErrConflict = errors.New("another experiment is already running")
+)
+
+// Repository stores experiments and reports their results from query_logs and feedback.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository returns a repository backed by db.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+const selectColumns = `id, name, COALESCE(description, ''), status, variants, created_by,
+	started_at, stopped_at, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanExperiment(row rowScanner) (*Experiment, error) {
+	var (
+		e         Experiment
+		variants  string
+		createdBy sql.NullInt64
+		startedAt sql.NullTime
+		stoppedAt sql.NullTime
+	)
+	if err := row.Scan(&e.ID, &e.Name, &e.Description, &e.Status, &variants, &createdBy,
+		&startedAt, &stoppedAt, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(variants), &e.Variants); err != nil {
+		return nil, fmt.Errorf("decode variants of experiment %d: %w", e.ID, err)
+	}
+	if createdBy.Valid {
+		e.CreatedBy = &createdBy.Int64
+	}
+	if startedAt.Valid {
+		e.StartedAt = &startedAt.Time
+	}
+	if stoppedAt.Valid {
+		e.StoppedAt = &stoppedAt.Time
+	}
+	return &e, nil
+}
+
+// List returns every experiment, newest first.
+func (r *Repository) List(ctx context.Context) ([]Experiment, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+selectColumns+` FROM experiments ORDER BY id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("list experiments: %w", err)
+	}
+	defer rows.Close()
+
+	experiments := make([]Experiment, 0)
+	for rows.Next() {
+		e, err := scanExperiment(rows)
+		if err != nil {
+			return nil, err
+		}
+		experiments = append(experiments, *e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate experiments: %w", err)
+	}
+	return experiments, nil
+}
+
+// Get returns the experiment with the ID.
+func (r *Repository) Get(ctx context.Context, id int64) (*Experiment, error) {
+	e, err := scanExperiment(r.db.QueryRowContext(ctx, `SELECT `+selectColumns+` FROM experiments WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return e, err
+}
+
+// Running returns the running experiment, or nil when none is running.
+func (r *Repository) Running(ctx context.Context) (*Experiment, error) {
+	e, err := scanExperiment(r.db.QueryRowContext(ctx,
+		`SELECT `+selectColumns+` FROM experiments WHERE status = ? ORDER BY started_at DESC LIMIT 1`, StatusRunning))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return e, err
+}
+
+// Create validates and stores a new draft experiment.
+func (r *Repository) Create(ctx context.Context, e *Experiment) error {
+	e.Normalize()
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	if err := r.requireNameFree(ctx, e.Name, 0); err != nil {
+		return err
+	}
+
+	variants, _ := json.Marshal(e.Variants)
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO experiments (name, description, status, variants, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.Name, e.Description, StatusDraft, string(variants), e.CreatedBy, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("create experiment: %w", err)
+	}
+	if e.ID, err = res.LastInsertId(); err != nil {
+		return fmt.Errorf("create experiment: %w", err)
+	}
+	e.Status = StatusDraft
+	e.CreatedAt, e.UpdatedAt = now, now
+	return nil
+}
+
+// Update replaces the name, description and variants of an experiment that is not running.
+// Changing the variants of a stopped experiment mixes old and new assignments in its
+// results, so create a new experiment to compare different variants.
+func (r *Repository) Update(ctx context.Context, e *Experiment) error {
+	e.Normalize()
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	current, err := r.Get(ctx, e.ID)
+	if err != nil {
+		return err
+	}
+	if current.Status == StatusRunning {
+		return ErrRunning
+	}
+	if err := r.requireNameFree(ctx, e.Name, e.ID); err != nil {
+		return err
+	}
+
+	variants, _ := json.Marshal(e.Variants)
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE experiments SET name = ?, description = ?, variants = ?, updated_at = ?
+		WHERE id = ? AND status != ?`,
+		e.Name, e.Description, string(variants), time.Now().UTC(), e.ID, StatusRunning,
+	)
+	if err != nil {
+		return fmt.Errorf("update experiment: %w", err)
+	}
+
+	updated, err := r.Get(ctx, e.ID)
+	if err != nil {
+		return err
+	}
+	*e = *updated
+	return nil
+}
+
+// Delete removes an experiment that is not running. Query logs keep its ID and variant names.
+func (r *Repository) Delete(ctx context.Context, id int64) error {
+	current, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if current.Status == StatusRunning {
+		return ErrRunning
+	}
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM experiments WHERE id = ? AND status != ?`, id, StatusRunning); err != nil {
+		return fmt.Errorf("delete experiment: %w", err)
+	}
+	return nil
+}
+
+// Start runs the experiment, failing with ErrConflict while another one is running. A
+// stopped experiment resumes with the same assignments.
+func (r *Repository) Start(ctx context.Context, id int64) (*Experiment, error) {
+	if _, err := r.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE experiments SET status = ?, started_at = COALESCE(started_at, ?), stopped_at = NULL, updated_at = ?
+		WHERE id = ? AND status != ? AND NOT EXISTS (SELECT 1 FROM experiments WHERE status = ?)`,
+		StatusRunning, now, now, id, StatusRunning, StatusRunning,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("start experiment: %w", err)
+	}
+	if affected, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("start experiment: %w", err)
+	} else if affected == 0 {
+		running, err := r.Running(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if running == nil || running.ID != id {
+			return nil, ErrConflict
+		}
+	}
+	return r.Get(ctx, id)
+}
+
+// Stop ends a running experiment; stopping one that is not running is a no-op.
+func (r *Repository) Stop(ctx context.Context, id int64) (*Experiment, error) {
+	if _, err := r.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if _, err := r.db.ExecContext(ctx, `
+		UPDATE experiments SET status = ?, stopped_at = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		StatusStopped, now, now, id, StatusRunning,
+	); err != nil {
+		return nil, fmt.Errorf("stop experiment: %w", err)
+	}
+	return r.Get(ctx, id)
+}
+
+// requireNameFree returns ErrExists when an experiment other than id uses the name.
+func (r *Repository) requireNameFree(ctx context.Context, name string, id int64) error {
+	var taken bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM experiments WHERE name = ? AND id != ?)`, name, id).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("check experiment name: %w", err)
+	}
+	if taken {
+		return ErrExists
+	}
+	return nil
+}
+
+// Results aggregates the query logs of each variant and the feedback on them. Every
+// variant is listed, including ones that served no requests; variants removed from the
+// experiment while it was stopped are listed after them. Feedback is counted when it
+// references the query log of the rated answer.
+func (r *Repository) Results(ctx context.Context, id int64) (*Results, error) {
+	e, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Percentiles use the nearest-rank method, as in the query log time series.
+	rows, err := r.db.QueryContext(ctx, `
+		WITH logs AS (
+			SELECT id, COALESCE(experiment_variant, '') AS variant, status, latency_ms, input_tokens, output_tokens, cost_usd
+			FROM query_logs
+			WHERE experiment_id = ?
+		),
+		ranked AS (
+			SELECT
+				variant,
+				latency_ms,
+				ROW_NUMBER() OVER (PARTITION BY variant ORDER BY latency_ms) AS rn,
+				COUNT(*) OVER (PARTITION BY variant) AS cnt
+			FROM logs
+		),
+		percentiles AS (
+			SELECT
+				variant,
+				MAX(CASE WHEN rn = (cnt * 50 + 99) / 100 THEN latency_ms END) AS p50,
+				MAX(CASE WHEN rn = (cnt * 95 + 99) / 100 THEN latency_ms END) AS p95
+			FROM ranked
+			GROUP BY variant
+		),
+		ratings AS (
+			SELECT
+				l.variant,
+				SUM(CASE WHEN f.rating = 'up' THEN 1 ELSE 0 END) AS up,
+				SUM(CASE WHEN f.rating = 'down' THEN 1 ELSE 0 END) AS down
+			FROM feedback f
+			JOIN logs l ON l.id = f.query_log_id
+			GROUP BY l.variant
+		)
+		SELECT
+			l.variant,
+			COUNT(*),
+			SUM(CASE WHEN l.status = 'success' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN l.status = 'error' THEN 1 ELSE 0 END),
+			COALESCE(AVG(l.latency_ms), 0),
+			COALESCE(p.p50, 0),
+			COALESCE(p.p95, 0),
+			COALESCE(SUM(l.input_tokens), 0),
+			COALESCE(SUM(l.output_tokens), 0),
+			COALESCE(SUM(l.cost_usd), 0),
+			COALESCE(MAX(f.up), 0),
+			COALESCE(MAX(f.down), 0)
+		FROM logs l
+		JOIN percentiles p ON p.variant = l.variant
+		LEFT JOIN ratings f ON f.variant = l.variant
+		GROUP BY l.variant
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate experiment results: %w", err)
+	}
+	defer rows.Close()
+
+	byVariant := make(map[string]VariantResult)
+	var removed []string
+	for rows.Next() {
+		var result VariantResult
+		if err := rows.Scan(
+			&result.Variant,
+			&result.Requests,
+			&result.Successes,
+			&result.Errors,
+			&result.AvgLatencyMs,
+			&result.P50LatencyMs,
+			&result.P95LatencyMs,
+			&result.InputTokens,
+			&result.OutputTokens,
+			&result.CostUSD,
+			&result.FeedbackUp,
+			&result.FeedbackDown,
+		); err != nil {
+			return nil, fmt.Errorf("scan experiment results: %w", err)
+		}
+		if result.Requests > 0 {
+			result.SuccessRate = float64(result.Successes) / float64(result.Requests)
+		}
+		if rated := result.FeedbackUp + result.FeedbackDown; rated > 0 {
+			result.PositiveRate = float64(result.FeedbackUp) / float64(rated)
+		}
+		byVariant[result.Variant] = result
+		removed = append(removed, result.Variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate experiment results: %w", err)
+	}
+
+	results := &Results{Experiment: e, Variants: make([]VariantResult, 0, len(byVariant))}
+	for _, v := range e.Variants {
+		result, ok := byVariant[v.Name]
+		if !ok {
+			result = VariantResult{Variant: v.Name}
+		}
+		results.Variants = append(results.Variants, result)
+		delete(byVariant, v.Name)
+	}
+	for _, name := range removed {
+		if result, ok := byVariant[name]; ok {
+			results.Variants = append(results.Variants, result)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,74 @@
+package feedback
+
+import "time"
+
+// Ratings a user can give an answer.
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// Categories describing what was wrong with an answer.
+const (
+	CategoryIncorrectCode       = "incorrect_code"
+	CategoryDoesNotCompile      = "does_not_compile"
+	CategoryIrrelevantContext   = "irrelevant_context"
+	CategoryOutdated            = "outdated"
+	CategoryIncomplete          = "incomplete"
+	CategorySecurityIssue       = "security_issue"
+	CategoryInstructionsIgnored = "instructions_ignored"
+	CategoryOther               = "other"
+)
+
+// Categories lists the valid error categories.
+var Categories = []string{
+	CategoryIncorrectCode,
+	CategoryDoesNotCompile,
+	CategoryIrrelevantContext,
+	CategoryOutdated,
+	CategoryIncomplete,
+	CategorySecurityIssue,
+	CategoryInstructionsIgnored,
+	CategoryOther,
+}
+
+// maxCommentRunes bounds a feedback comment.
+const maxCommentRunes = 2000
+
+// Feedback is a user's rating of one generated answer, identified either by the query log
+// of the request that produced it or by an assistant turn of a conversation. Endpoint and
+// ModelProvider are copied from the query log so analytics survive log purges.
+type Feedback struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"user_id"`
+	QueryLogID     *int64    `json:"query_log_id,omitempty"`
+	ConversationID *int64    `json:"conversation_id,omitempty"`
+	TurnIndex      *int      `json:"turn_index,omitempty"`
+	Rating         string    `json:"rating"`
+	Category       string    `json:"category,omitempty"`
+	Comment        string    `json:"comment,omitempty"`
+	Endpoint       string    `json:"endpoint,omitempty"`
+	ModelProvider  string    `json:"model_provider,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Breakdown counts ratings for one provider, endpoint or category.
+type Breakdown struct {
+	Key      string  `json:"key"`
+	Total    int64   `json:"total"`
+	Up       int64   `json:"up"`
+	Down     int64   `json:"down"`
+	Positive float64 `json:"positive_rate"`
+}
+
+// Stats summarises feedback over a date range.
+type Stats struct {
+	Total      int64       `json:"total"`
+	Up         int64       `json:"up"`
+	Down       int64       `json:"down"`
+	Positive   float64     `json:"positive_rate"`
+	ByProvider []Breakdown `json:"by_provider"`
+	ByEndpoint []Breakdown `json:"by_endpoint"`
+	ByCategory []Breakdown `json:"by_category"`
+}
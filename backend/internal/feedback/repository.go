@@ -0,0 +1,382 @@
+package feedback
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+)
+
+var (
+	// ErrInvalidFeedback is returned for feedback with an unknown rating or category, an
+	// overlong comment, or not exactly one target.
+	ErrInvalidFeedback = errors.New("invalid feedback")
+	// ErrTargetNotFound is returned when the rated query log or conversation turn does not
+	// exist or belongs to another user.
+	ErrTargetNotFound = errors.New("rated answer not found")
+)
+
+// Repository persists feedback. Writes go through the database's shared writer.
+type Repository struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+// NewRepository returns a repository backed by the supplied sql.DB handle.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db, writer: database.WriterFor(db)}
+}
+
+const selectColumns = `
+	id, user_id, query_log_id, conversation_id, turn_index, rating, COALESCE(category, ''),
+	COALESCE(comment, ''), COALESCE(endpoint, ''), COALESCE(model_provider, ''), created_at, updated_at
+`
+
+// Validate checks the rating, category, comment and target of fb.
+func (fb *Feedback) Validate() error {
+	if fb.Rating != RatingUp && fb.Rating != RatingDown {
+		return fmt.Errorf("%w: rating must be %q or %q", ErrInvalidFeedback, RatingUp, RatingDown)
+	}
+	if fb.Category != "" && !slices.Contains(Categories, fb.Category) {
+		return fmt.Errorf("%w: category must be one of %s", ErrInvalidFeedback, strings.Join(Categories, ", "))
+	}
+	if utf8.RuneCountInString(fb.Comment) > maxCommentRunes {
+		return fmt.Errorf("%w: comment must be at most %d characters", ErrInvalidFeedback, maxCommentRunes)
+	}
+
+	switch {
+	case fb.QueryLogID != nil && fb.ConversationID != nil:
+		return fmt.Errorf("%w: set either query_log_id or conversation_id, not both", ErrInvalidFeedback)
+	case fb.QueryLogID != nil:
+		if fb.TurnIndex != nil {
+			return fmt.Errorf("%w: turn_index requires conversation_id", ErrInvalidFeedback)
+		}
+	case fb.ConversationID != nil:
+		if fb.TurnIndex == nil || *fb.TurnIndex < 0 {
+			return fmt.Errorf("%w: conversation_id requires a turn_index of 0 or more", ErrInvalidFeedback)
+		}
+	default:
+		return fmt.Errorf("%w: query_log_id or conversation_id is required", ErrInvalidFeedback)
+	}
+	return nil
+}
+
+// Submit stores fb, replacing the user's earlier rating of the same answer, and reports
+// whether it was new. The target must belong to fb.UserID; for conversation turns it must
+// be an assistant turn. Endpoint and ModelProvider are filled from the query log, which for
+// a conversation is its most recent one.
+func (r *Repository) Submit(ctx context.Context, fb *Feedback) (bool, error) {
+	if err := fb.Validate(); err != nil {
+		return false, err
+	}
+	if err := r.resolveTarget(ctx, fb); err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+	fb.UpdatedAt = now
+	created := false
+	err := r.writer.Do(ctx, func(db *sql.DB) error {
+		var (
+			existingID int64
+			createdAt  time.Time
+		)
+		err := db.QueryRowContext(ctx, `
+			SELECT id, created_at FROM feedback
+			WHERE user_id = ? AND query_log_id IS ? AND conversation_id IS ? AND turn_index IS ?
+		`, fb.UserID, fb.QueryLogID, fb.ConversationID, fb.TurnIndex).Scan(&existingID, &createdAt)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("find feedback: %w", err)
+		}
+
+		if err == nil {
+			fb.ID, fb.CreatedAt = existingID, createdAt
+			_, err := db.ExecContext(ctx, `
+				UPDATE feedback
+				SET rating = ?, category = ?, comment = ?, endpoint = ?, model_provider = ?, updated_at = ?
+				WHERE id = ?
+			`, fb.Rating, nullable(fb.Category), nullable(fb.Comment), nullable(fb.Endpoint), nullable(fb.ModelProvider), now, existingID)
+			if err != nil {
+				return fmt.Errorf("update feedback: %w", err)
+			}
+			return nil
+		}
+
+		fb.CreatedAt = now
+		res, err := db.ExecContext(ctx, `
+			INSERT INTO feedback (
+				user_id, query_log_id, conversation_id, turn_index, rating, category, comment,
+				endpoint, model_provider, created_at, updated_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, fb.UserID, fb.QueryLogID, fb.ConversationID, fb.TurnIndex, fb.Rating, nullable(fb.Category),
+			nullable(fb.Comment), nullable(fb.Endpoint), nullable(fb.ModelProvider), now, now)
+		if err != nil {
+			return fmt.Errorf("insert feedback: %w", err)
+		}
+		fb.ID, err = res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("fetch feedback id: %w", err)
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+// resolveTarget checks that the rated answer belongs to the user and copies its endpoint
+// and provider onto fb.
+func (r *Repository) resolveTarget(ctx context.Context, fb *Feedback) error {
+	if fb.QueryLogID != nil {
+		err := r.db.QueryRowContext(ctx, `
+			SELECT endpoint, COALESCE(model_provider, '') FROM query_logs WHERE id = ? AND user_id = ?
+		`, *fb.QueryLogID, fb.UserID).Scan(&fb.Endpoint, &fb.ModelProvider)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTargetNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("find query log: %w", err)
+		}
+		return nil
+	}
+
+	convo, err := conversation.NewRepository(r.db).Get(ctx, *fb.ConversationID, int(fb.UserID))
+	if errors.Is(err, conversation.ErrConversationNotFound) {
+		return ErrTargetNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if *fb.TurnIndex >= len(convo.History) || convo.History[*fb.TurnIndex].Role != "assistant" {
+		return fmt.Errorf("%w: turn_index must name an assistant turn of the conversation", ErrInvalidFeedback)
+	}
+
+	err = r.db.QueryRowContext(ctx, `
+		SELECT endpoint, COALESCE(model_provider, '') FROM query_logs
+		WHERE conversation_id = ? ORDER BY id DESC LIMIT 1
+	`, convo.ID).Scan(&fb.Endpoint, &fb.ModelProvider)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("find conversation query log: %w", err)
+	}
+	return nil
+}
+
+// ListParams filters and paginates feedback.
+type ListParams struct {
+	Rating        string
+	Category      string
+	Endpoint      string
+	ModelProvider string
+	StartDate     *time.Time
+	EndDate       *time.Time
+	Page          int
+	Limit         int
+}
+
+// List returns feedback matching params, newest first, and the total count.
+func (r *Repository) List(ctx context.Context, params ListParams) ([]Feedback, int64, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	page := params.Page
+	if page <= 0 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	var (
+		whereParts []string
+		args       []any
+	)
+	for _, filter := range []struct{ column, value string }{
+		{"rating", params.Rating},
+		{"category", params.Category},
+		{"endpoint", params.Endpoint},
+		{"model_provider", params.ModelProvider},
+	} {
+		if filter.value != "" {
+			whereParts = append(whereParts, filter.column+" = ?")
+			args = append(args, filter.value)
+		}
+	}
+	whereClause, args := dateFilter(whereParts, args, params.StartDate, params.EndDate)
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM feedback `+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count feedback: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM feedback
+		`+whereClause+`
+		ORDER BY updated_at DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list feedback: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]Feedback, 0)
+	for rows.Next() {
+		fb, err := scanFeedback(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, *fb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("iterate feedback: %w", err)
+	}
+	return items, total, nil
+}
+
+// Stats summarises ratings given between startDate and endDate, overall and by provider,
+// endpoint and category. A nil bound leaves that side of the range open.
+func (r *Repository) Stats(ctx context.Context, startDate, endDate *time.Time) (*Stats, error) {
+	whereClause, args := dateFilter(nil, nil, startDate, endDate)
+
+	var stats Stats
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN rating = 'up' THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(CASE WHEN rating = 'down' THEN 1 ELSE 0 END), 0)
+		FROM feedback `+whereClause, args...).Scan(&stats.Total, &stats.Up, &stats.Down)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate feedback: %w", err)
+	}
+	stats.Positive = positiveRate(stats.Up, stats.Total)
+
+	for _, group := range []struct {
+		column string
+		into   *[]Breakdown
+	}{
+		{"model_provider", &stats.ByProvider},
+		{"endpoint", &stats.ByEndpoint},
+		{"category", &stats.ByCategory},
+	} {
+		breakdown, err := r.breakdown(ctx, group.column, whereClause, args)
+		if err != nil {
+			return nil, err
+		}
+		*group.into = breakdown
+	}
+	return &stats, nil
+}
+
+// breakdown counts ratings grouped by column, most rated first. Feedback without a value
+// for column is grouped under an empty key.
+func (r *Repository) breakdown(ctx context.Context, column, whereClause string, args []any) ([]Breakdown, error) {
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT
+			COALESCE(%[1]s, '') AS key,
+			COUNT(*) AS total,
+			SUM(CASE WHEN rating = 'up' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN rating = 'down' THEN 1 ELSE 0 END)
+		FROM feedback
+		%[2]s
+		GROUP BY COALESCE(%[1]s, '')
+		ORDER BY total DESC, key
+	`, column, whereClause), args...)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate feedback by %s: %w", column, err)
+	}
+	defer rows.Close()
+
+	breakdown := make([]Breakdown, 0)
+	for rows.Next() {
+		var b Breakdown
+		if err := rows.Scan(&b.Key, &b.Total, &b.Up, &b.Down); err != nil {
+			return nil, fmt.Errorf("scan feedback %s stats: %w", column, err)
+		}
+		b.Positive = positiveRate(b.Up, b.Total)
+		breakdown = append(breakdown, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate feedback %s stats: %w", column, err)
+	}
+	return breakdown, nil
+}
+
+func dateFilter(whereParts []string, args []any, startDate, endDate *time.Time) (string, []any) {
+	if startDate != nil {
+		whereParts = append(whereParts, "created_at >= ?")
+		args = append(args, *startDate)
+	}
+	if endDate != nil {
+		whereParts = append(whereParts, "created_at <= ?")
+		args = append(args, *endDate)
+	}
+	if len(whereParts) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(whereParts, " AND "), args
+}
+
+func positiveRate(up, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(up) / float64(total)
+}
+
+func nullable(value string) any {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanFeedback(row rowScanner) (*Feedback, error) {
+	var (
+		fb             Feedback
+		queryLogID     sql.NullInt64
+		conversationID sql.NullInt64
+		turnIndex      sql.NullInt64
+	)
+	err := row.Scan(
+		&fb.ID,
+		&fb.UserID,
+		&queryLogID,
+		&conversationID,
+		&turnIndex,
+		&fb.Rating,
+		&fb.Category,
+		&fb.Comment,
+		&fb.Endpoint,
+		&fb.ModelProvider,
+		&fb.CreatedAt,
+		&fb.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("scan feedback: %w", err)
+	}
+
+	if queryLogID.Valid {
+		fb.QueryLogID = &queryLogID.Int64
+	}
+	if conversationID.Valid {
+		fb.ConversationID = &conversationID.Int64
+	}
+	if turnIndex.Valid {
+		index := int(turnIndex.Int64)
+		fb.TurnIndex = &index
+	}
+	return &fb, nil
+}
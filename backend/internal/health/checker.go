@@ -0,0 +1,160 @@
+package health
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// Component and overall statuses.
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusError    = "error"
+)
+
+const (
+	defaultCacheTTL     = 30 * time.Second
+	defaultProbeTimeout = 10 * time.Second
+)
+
+// Probe checks a single dependency and returns an error when it is unusable.
+type Probe func(ctx context.Context) error
+
+// Config controls how often dependencies are probed.
+type Config struct {
+	// CacheTTL is how long a probe result is reused before the dependency is probed again.
+	CacheTTL time.Duration
+	// Timeout bounds each individual probe.
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads HEALTH_CACHE_TTL and HEALTH_PROBE_TIMEOUT.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		CacheTTL: defaultCacheTTL,
+		Timeout:  defaultProbeTimeout,
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("HEALTH_CACHE_TTL")); err == nil && ttl >= 0 {
+		cfg.CacheTTL = ttl
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("HEALTH_PROBE_TIMEOUT")); err == nil && timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	return cfg
+}
+
+// ComponentStatus is the latest probe result for one dependency.
+type ComponentStatus struct {
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	LatencyMs int64     `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	Cached    bool      `json:"cached"`
+}
+
+// Report is the readiness of the service and each of its dependencies.
+// A failing critical component makes the service "error"; any other failure makes it "degraded".
+type Report struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Ready reports whether every critical component is healthy.
+func (r Report) Ready() bool {
+	return r.Status != StatusError
+}
+
+type component struct {
+	name     string
+	critical bool
+	probe    Probe
+
+	mu   sync.Mutex
+	last *ComponentStatus
+}
+
+// Checker probes registered dependencies and caches the results.
+type Checker struct {
+	cfg        Config
+	components []*component
+}
+
+// NewChecker returns a checker with no registered components.
+func NewChecker(cfg Config) *Checker {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultProbeTimeout
+	}
+	return &Checker{cfg: cfg}
+}
+
+// Register adds a dependency. Critical dependencies fail readiness; others only degrade it.
+func (c *Checker) Register(name string, critical bool, probe Probe) {
+	c.components = append(c.components, &component{name: name, critical: critical, probe: probe})
+}
+
+// Check probes every component concurrently, reusing results younger than the cache TTL.
+func (c *Checker) Check(ctx context.Context) Report {
+	results := make([]ComponentStatus, len(c.components))
+	var wg sync.WaitGroup
+	for i, comp := range c.components {
+		wg.Add(1)
+		go func(i int, comp *component) {
+			defer wg.Done()
+			results[i] = c.checkComponent(ctx, comp)
+		}(i, comp)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:     StatusOK,
+		Components: make(map[string]ComponentStatus, len(c.components)),
+	}
+	for i, comp := range c.components {
+		status := results[i]
+		report.Components[comp.name] = status
+		if status.Status == StatusOK {
+			continue
+		}
+		if comp.critical {
+			report.Status = StatusError
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// checkComponent returns the cached status or probes the component. Concurrent callers
+// wait for a single in-flight probe instead of all probing the dependency at once.
+func (c *Checker) checkComponent(ctx context.Context, comp *component) ComponentStatus {
+	comp.mu.Lock()
+	defer comp.mu.Unlock()
+
+	if comp.last != nil && time.Since(comp.last.CheckedAt) < c.cfg.CacheTTL {
+		cached := *comp.last
+		cached.Cached = true
+		return cached
+	}
+
+	probeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := comp.probe(probeCtx)
+	status := ComponentStatus{
+		Status:    StatusOK,
+		Critical:  comp.critical,
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		status.Status = StatusError
+		status.Error = err.Error()
+	}
+
+	comp.last = &status
+	return status
+}
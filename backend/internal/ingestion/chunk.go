@@ -0,0 +1,310 @@
+package ingestion
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+const (
+	// defaultChunkChars bounds a chunk of a Clarity contract unless INGESTION_CHUNK_SIZE
+	// or the job overrides it.
+	defaultChunkChars = 4000
+	minChunkChars     = 200
+	maxChunkChars     = 16000
+)
+
+// ErrInvalidChunking wraps invalid chunking options.
+var ErrInvalidChunking = errors.New("invalid chunking options")
+
+// Metadata keys describing the functions of a Clarity chunk, alongside rag.MetadataContract
+// and rag.MetadataFunction.
+const (
+	metadataFunctionKind = "function_kind"
+	metadataFunctions    = "functions"
+)
+
+// ChunkOptions controls how Clarity contracts are split into chunks.
+type ChunkOptions struct {
+	// MaxChars bounds a chunk. Forms between two public or read-only functions are packed
+	// up to this size.
+	MaxChars int `json:"max_chars,omitempty"`
+	// Overlap is the number of characters, in whole lines, repeated from the end of one
+	// chunk at the start of the next when a form too large for a chunk is split by lines.
+	Overlap int `json:"overlap,omitempty"`
+}
+
+// chunkOptionsFromEnv reads INGESTION_CHUNK_SIZE and INGESTION_CHUNK_OVERLAP. Values that
+// fail validation are ignored.
+func chunkOptionsFromEnv() ChunkOptions {
+	opts := ChunkOptions{MaxChars: defaultChunkChars}
+	if size, err := strconv.Atoi(os.Getenv("INGESTION_CHUNK_SIZE")); err == nil && size >= minChunkChars && size <= maxChunkChars {
+		opts.MaxChars = size
+	}
+	if overlap, err := strconv.Atoi(os.Getenv("INGESTION_CHUNK_OVERLAP")); err == nil && overlap >= 0 && overlap <= opts.MaxChars/2 {
+		opts.Overlap = overlap
+	}
+	return opts
+}
+
+// resolve fills the unset fields of requested options from defaults and validates them.
+func (o ChunkOptions) resolve(defaults ChunkOptions) (ChunkOptions, error) {
+	if o.MaxChars == 0 {
+		o.MaxChars = defaults.MaxChars
+	}
+	if o.MaxChars == 0 {
+		o.MaxChars = defaultChunkChars
+	}
+	if o.Overlap == 0 {
+		o.Overlap = defaults.Overlap
+	}
+
+	if o.MaxChars < minChunkChars || o.MaxChars > maxChunkChars {
+		return o, fmt.Errorf("%w: max_chars must be between %d and %d", ErrInvalidChunking, minChunkChars, maxChunkChars)
+	}
+	if o.Overlap < 0 || o.Overlap > o.MaxChars/2 {
+		return o, fmt.Errorf("%w: overlap must be between 0 and half of max_chars", ErrInvalidChunking)
+	}
+	return o, nil
+}
+
+// Chunk is a piece of a Clarity contract.
+type Chunk struct {
+	Content string
+	// Function and Kind name the public or read-only function the chunk starts with, e.g.
+	// "transfer" and "define-public".
+	Function string
+	Kind     string
+	// Functions lists every function the chunk defines, in order.
+	Functions []string
+}
+
+// annotate records the chunk's contract and functions in its document metadata.
+func (c Chunk) annotate(metadata map[string]any, contract string) {
+	if contract != "" {
+		metadata[rag.MetadataContract] = contract
+	}
+	if c.Function != "" {
+		metadata[rag.MetadataFunction] = c.Function
+		metadata[metadataFunctionKind] = c.Kind
+	}
+	if len(c.Functions) > 0 {
+		metadata[metadataFunctions] = strings.Join(c.Functions, ",")
+	}
+}
+
+// contractName returns the contract a Clarity file deploys, its base name without .clar.
+func contractName(filename string) string {
+	return strings.TrimSuffix(path.Base(filename), ".clar")
+}
+
+// chunkClarity splits a contract into chunks of whole top-level forms, each keeping the
+// comments directly above it. Every public and read-only function starts a new chunk, and
+// the forms that follow it are packed into the same chunk up to opts.MaxChars. A single
+// form longer than that is split on line boundaries, as are contracts that do not parse.
+func chunkClarity(code string, opts ChunkOptions) []Chunk {
+	forms, ok := clarityForms(code)
+	if !ok {
+		return lineChunks(splitLines(code, opts.MaxChars, opts.Overlap), Chunk{})
+	}
+
+	var (
+		chunks  []Chunk
+		current Chunk
+		content strings.Builder
+	)
+	flush := func() {
+		if text := strings.TrimSpace(content.String()); text != "" {
+			current.Content = text
+			chunks = append(chunks, current)
+		}
+		current = Chunk{}
+		content.Reset()
+	}
+	for _, form := range forms {
+		kind, name := formHead(form)
+		entry := kind == "define-public" || kind == "define-read-only"
+		if content.Len() > 0 && (entry || content.Len()+len(form) > opts.MaxChars) {
+			flush()
+		}
+
+		if len(form) > opts.MaxChars {
+			flush()
+			part := Chunk{}
+			if entry {
+				part.Function, part.Kind = name, kind
+			}
+			if isFunction(kind) {
+				part.Functions = []string{name}
+			}
+			chunks = append(chunks, lineChunks(splitLines(form, opts.MaxChars, opts.Overlap), part)...)
+			continue
+		}
+
+		content.WriteString(form)
+		if entry {
+			current.Function, current.Kind = name, kind
+		}
+		if isFunction(kind) {
+			current.Functions = append(current.Functions, name)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// lineChunks turns line-split pieces of a form into chunks that share its description.
+func lineChunks(parts []string, desc Chunk) []Chunk {
+	chunks := make([]Chunk, len(parts))
+	for i, part := range parts {
+		chunks[i] = desc
+		chunks[i].Content = part
+	}
+	return chunks
+}
+
+func isFunction(kind string) bool {
+	switch kind {
+	case "define-public", "define-read-only", "define-private":
+		return true
+	default:
+		return false
+	}
+}
+
+// formHead returns the keyword of a top-level form, e.g. "define-public", and the name it
+// defines. Leading comments are skipped.
+func formHead(form string) (kind, name string) {
+	open := -1
+	for i := 0; i < len(form); i++ {
+		if form[i] == ';' {
+			for i < len(form) && form[i] != '\n' {
+				i++
+			}
+			continue
+		}
+		if form[i] == '(' {
+			open = i
+			break
+		}
+	}
+	if open < 0 {
+		return "", ""
+	}
+
+	rest := form[open+1:]
+	kind, rest = nextToken(rest)
+	if !strings.HasPrefix(kind, "define-") {
+		return kind, ""
+	}
+	// Functions are defined as (define-public (name (arg type) ...) body).
+	rest = strings.TrimLeft(rest, " \t\r\n")
+	rest = strings.TrimPrefix(rest, "(")
+	name, _ = nextToken(rest)
+	return kind, name
+}
+
+// nextToken returns the first whitespace- or parenthesis-delimited token of s and the rest.
+func nextToken(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t\r\n")
+	end := strings.IndexAny(s, " \t\r\n()")
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], s[end:]
+}
+
+// clarityForms splits code into consecutive segments that each end with a top-level form,
+// so comments and whitespace stay with the form that follows them. It reports false when
+// parentheses or strings are unbalanced.
+func clarityForms(code string) ([]string, bool) {
+	var forms []string
+	depth, start := 0, 0
+
+	for i := 0; i < len(code); i++ {
+		switch code[i] {
+		case ';':
+			for i < len(code) && code[i] != '\n' {
+				i++
+			}
+		case '"':
+			for i++; i < len(code) && code[i] != '"'; i++ {
+				if code[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(code) {
+				return nil, false
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, false
+			}
+			if depth == 0 {
+				forms = append(forms, code[start:i+1])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, false
+	}
+
+	if rest := code[start:]; strings.TrimSpace(rest) != "" {
+		if len(forms) == 0 {
+			return []string{code}, true
+		}
+		forms[len(forms)-1] += rest
+	}
+	return forms, true
+}
+
+// splitLines packs whole lines into chunks of at most maxChars. Each chunk after the first
+// starts with the trailing lines of the previous one, up to overlap characters. A longer
+// line becomes its own chunk.
+func splitLines(code string, maxChars, overlap int) []string {
+	var (
+		chunks  []string
+		current []string
+		size    int
+		// carried is the number of lines at the start of current repeated from the
+		// previous chunk.
+		carried int
+	)
+	flush := func() {
+		if chunk := strings.TrimSpace(strings.Join(current, "")); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+	}
+	for _, line := range strings.SplitAfter(code, "\n") {
+		if len(current) > carried && size+len(line) > maxChars {
+			flush()
+			current, size = trailingLines(current, overlap)
+			carried = len(current)
+		}
+		current = append(current, line)
+		size += len(line)
+	}
+	if len(current) > carried {
+		flush()
+	}
+	return chunks
+}
+
+// trailingLines returns the last lines whose combined length fits within limit.
+func trailingLines(lines []string, limit int) ([]string, int) {
+	start, size := len(lines), 0
+	for start > 0 && size+len(lines[start-1]) <= limit {
+		start--
+		size += len(lines[start])
+	}
+	return append([]string(nil), lines[start:]...), size
+}
@@ -0,0 +1,90 @@
+package ingestion
+
+import (
+	"context"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// ingestJobTypes lists the job types that write to each collection.
+var ingestJobTypes = map[string][]string{
+	rag.CodeCollection: {JobTypeIngestSamples, JobTypeIngestRepo},
+	rag.DocsCollection: {JobTypeIngestDocs, JobTypeCrawlDocs},
+}
+
+// CollectionStatus describes a vector store collection along with its last ingestion.
+type CollectionStatus struct {
+	rag.CollectionInfo
+	// ActiveCollection is the physical collection a reindex switched the collection to.
+	ActiveCollection string `json:"active_collection,omitempty"`
+	// LastIngestedAt is when the last ingestion job writing to the collection completed.
+	LastIngestedAt *time.Time `json:"last_ingested_at,omitempty"`
+	LastJobID      int64      `json:"last_job_id,omitempty"`
+}
+
+// CollectionDetail is the document breakdown of a collection along with its last ingestion.
+type CollectionDetail struct {
+	rag.CollectionStats
+	ActiveCollection string     `json:"active_collection,omitempty"`
+	LastIngestedAt   *time.Time `json:"last_ingested_at,omitempty"`
+	LastJobID        int64      `json:"last_job_id,omitempty"`
+}
+
+// Collections describes the code sample and documentation collections with up to samples
+// example documents each.
+func (m *Manager) Collections(ctx context.Context, samples int) ([]CollectionStatus, error) {
+	if m.cfg.Indexer == nil {
+		return nil, ErrIndexerRequired
+	}
+
+	statuses := make([]CollectionStatus, 0, len(rag.Collections))
+	for _, collection := range rag.Collections {
+		info, err := m.cfg.Indexer.Describe(ctx, collection, samples)
+		if err != nil {
+			return nil, err
+		}
+		status := CollectionStatus{CollectionInfo: info, ActiveCollection: activeCollection(collection)}
+		if status.LastIngestedAt, status.LastJobID, err = m.lastIngestion(ctx, collection); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// CollectionDetail describes one collection and breaks its documents down by repository,
+// file type, file and Clarity contract.
+func (m *Manager) CollectionDetail(ctx context.Context, collection string, samples int) (*CollectionDetail, error) {
+	if m.cfg.Indexer == nil {
+		return nil, ErrIndexerRequired
+	}
+
+	stats, err := m.cfg.Indexer.Stats(ctx, collection, samples)
+	if err != nil {
+		return nil, err
+	}
+	detail := &CollectionDetail{CollectionStats: stats, ActiveCollection: activeCollection(collection)}
+	if detail.LastIngestedAt, detail.LastJobID, err = m.lastIngestion(ctx, collection); err != nil {
+		return nil, err
+	}
+	return detail, nil
+}
+
+// lastIngestion returns when the last completed job writing to the collection finished.
+func (m *Manager) lastIngestion(ctx context.Context, collection string) (*time.Time, int64, error) {
+	job, err := m.repo.LastCompleted(ctx, ingestJobTypes[collection]...)
+	if err != nil || job == nil {
+		return nil, 0, err
+	}
+	return job.CompletedAt, job.ID, nil
+}
+
+// activeCollection returns the physical collection the collection is aliased to, or "" when
+// it has no alias.
+func activeCollection(collection string) string {
+	if active := rag.ActiveCollection(collection); active != collection {
+		return active
+	}
+	return ""
+}
@@ -0,0 +1,596 @@
+package ingestion
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+const (
+	defaultCrawlUserAgent     = "stacks-builder-docs-crawler/1.0"
+	defaultCrawlDelay         = 500 * time.Millisecond
+	defaultCrawlTimeout       = 30 * time.Second
+	defaultCrawlMaxPages      = 200
+	defaultCrawlCheckInterval = 10 * time.Minute
+	// maxCrawlDelay caps the Crawl-delay a robots.txt can ask for.
+	maxCrawlDelay = 30 * time.Second
+	// maxRobotsBytes bounds a robots.txt file, as RFC 9309 allows crawlers to.
+	maxRobotsBytes = 500 * 1024
+	// maxDocPageBytes bounds a fetched page or sitemap.
+	maxDocPageBytes = 5 << 20
+	// maxSitemaps bounds the sitemaps read through nested sitemap indexes.
+	maxSitemaps = 50
+	// maxCrawlRedirects bounds the redirects followed per request.
+	maxCrawlRedirects = 5
+)
+
+var (
+	errDisallowed = errors.New("disallowed by robots.txt")
+	errNotDocPage = errors.New("not an HTML or markdown page")
+)
+
+// skippedExtensions are linked files that are never documentation pages.
+var skippedExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true, ".webp": true, ".ico": true,
+	".css": true, ".js": true, ".json": true, ".xml": true, ".pdf": true, ".zip": true, ".gz": true,
+	".tar": true, ".woff": true, ".woff2": true, ".ttf": true, ".mp4": true, ".webm": true, ".mp3": true,
+}
+
+// CrawlConfig controls how crawl_docs jobs fetch documentation sources.
+type CrawlConfig struct {
+	// UserAgent identifies the crawler and selects its robots.txt group.
+	UserAgent string
+	// Delay is the minimum time between requests. A longer Crawl-delay in robots.txt wins.
+	Delay time.Duration
+	// Timeout bounds each request.
+	Timeout time.Duration
+	// MaxPages is the page limit of sources that do not set one.
+	MaxPages int
+	// CheckInterval is how often sources are checked for a due re-crawl. Zero disables
+	// scheduled re-crawls.
+	CheckInterval time.Duration
+}
+
+// crawlConfigFromEnv reads DOCS_CRAWL_USER_AGENT, DOCS_CRAWL_DELAY, DOCS_CRAWL_TIMEOUT,
+// DOCS_CRAWL_MAX_PAGES and DOCS_RECRAWL_CHECK_INTERVAL.
+func crawlConfigFromEnv() CrawlConfig {
+	cfg := CrawlConfig{
+		UserAgent:     envOrDefault("DOCS_CRAWL_USER_AGENT", defaultCrawlUserAgent),
+		Delay:         defaultCrawlDelay,
+		Timeout:       defaultCrawlTimeout,
+		MaxPages:      defaultCrawlMaxPages,
+		CheckInterval: defaultCrawlCheckInterval,
+	}
+	if delay, err := time.ParseDuration(os.Getenv("DOCS_CRAWL_DELAY")); err == nil && delay >= 0 {
+		cfg.Delay = delay
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("DOCS_CRAWL_TIMEOUT")); err == nil && timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	if pages, err := strconv.Atoi(os.Getenv("DOCS_CRAWL_MAX_PAGES")); err == nil && pages > 0 {
+		cfg.MaxPages = min(pages, maxDocPages)
+	}
+	if interval, err := time.ParseDuration(os.Getenv("DOCS_RECRAWL_CHECK_INTERVAL")); err == nil && interval >= 0 {
+		cfg.CheckInterval = interval
+	}
+	return cfg
+}
+
+// crawler fetches pages politely: robots.txt is honored per host and requests are spaced
+// by the configured delay.
+type crawler struct {
+	cfg         CrawlConfig
+	client      *http.Client
+	robots      map[string]*robotsRules
+	lastRequest time.Time
+}
+
+func newCrawler(cfg CrawlConfig) *crawler {
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = defaultCrawlUserAgent
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultCrawlTimeout
+	}
+	return &crawler{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxCrawlRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxCrawlRedirects)
+				}
+				if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+					return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+				}
+				return nil
+			},
+		},
+		robots: make(map[string]*robotsRules),
+	}
+}
+
+// robotsFor returns the robots.txt rules of the URL's host. A missing robots.txt allows
+// everything; one that fails with a server error disallows everything, per RFC 9309.
+func (c *crawler) robotsFor(ctx context.Context, target *url.URL) (*robotsRules, error) {
+	key := target.Scheme + "://" + target.Host
+	if rules, ok := c.robots[key]; ok {
+		return rules, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, key+"/robots.txt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.cfg.UserAgent)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("ingestion: robots.txt of %s unreachable, not crawling it: %v", target.Host, err)
+		c.robots[key] = disallowAll
+		return disallowAll, nil
+	}
+	defer resp.Body.Close()
+
+	rules := allowAll
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		rules = parseRobots(resp.Body, c.cfg.UserAgent)
+	case resp.StatusCode >= 500:
+		rules = disallowAll
+	}
+	c.robots[key] = rules
+	return rules, nil
+}
+
+// get fetches a URL allowed by robots.txt, waiting out the delay since the last request.
+func (c *crawler) get(ctx context.Context, target *url.URL, accept string) (*http.Response, error) {
+	rules, err := c.robotsFor(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if !rules.allowed(target.RequestURI()) {
+		return nil, errDisallowed
+	}
+
+	delay := max(c.cfg.Delay, min(rules.crawlDelay, maxCrawlDelay))
+	if wait := time.Until(c.lastRequest.Add(delay)); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.cfg.UserAgent)
+	req.Header.Set("Accept", accept)
+	c.lastRequest = time.Now()
+	return c.client.Do(req)
+}
+
+// fetchedPage is a page converted to markdown. gone is set for pages that returned 404 or 410.
+type fetchedPage struct {
+	url   string
+	title string
+	// markdown is the page's main content.
+	markdown string
+	links    []string
+	gone     bool
+}
+
+// fetchPage fetches a documentation page and converts it to markdown. Markdown pages are
+// used as they are.
+func (c *crawler) fetchPage(ctx context.Context, target *url.URL) (*fetchedPage, error) {
+	resp, err := c.get(ctx, target, "text/html, application/xhtml+xml, text/markdown;q=0.9, text/plain;q=0.5")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	page := &fetchedPage{url: target.String()}
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		page.gone = true
+		return page, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%s returned %s", target, resp.Status)
+	}
+
+	body := io.LimitReader(resp.Body, maxDocPageBytes)
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	ext := strings.ToLower(path.Ext(target.Path))
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		converted, err := convertHTML(body, resp.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", target, err)
+		}
+		page.title, page.markdown, page.links = converted.Title, converted.Markdown, converted.Links
+	case mediaType == "text/markdown" || mediaType == "text/x-markdown" ||
+		(mediaType == "text/plain" && (ext == ".md" || ext == ".mdx")):
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", target, err)
+		}
+		page.markdown = strings.TrimSpace(string(data))
+		for _, line := range strings.Split(page.markdown, "\n") {
+			if match := markdownHeading.FindStringSubmatch(line); match != nil {
+				page.title = match[2]
+				break
+			}
+		}
+	default:
+		return nil, errNotDocPage
+	}
+	return page, nil
+}
+
+type sitemapDocument struct {
+	XMLName  xml.Name     `xml:""`
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemapURLs reads the page URLs of a sitemap, following sitemap indexes on the same host.
+// It returns at most limit URLs in scope, and whether the sitemaps listed no more.
+func (c *crawler) sitemapURLs(ctx context.Context, source DocSource, limit int) ([]string, bool, error) {
+	root, err := url.Parse(source.URL)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var (
+		pages    []string
+		seen     = make(map[string]bool)
+		queue    = []*url.URL{root}
+		read     = 0
+		complete = true
+	)
+	for len(queue) > 0 {
+		if read == maxSitemaps {
+			log.Printf("ingestion: %s lists more than %d sitemaps; the rest are skipped", source.URL, maxSitemaps)
+			complete = false
+			break
+		}
+		sitemap := queue[0]
+		queue = queue[1:]
+		read++
+
+		doc, err := c.fetchSitemap(ctx, sitemap)
+		if err != nil {
+			// Only the sitemap the source names must be readable.
+			if sitemap == root || ctx.Err() != nil {
+				return nil, false, err
+			}
+			log.Printf("ingestion: skipping sitemap %s: %v", sitemap, err)
+			complete = false
+			continue
+		}
+
+		for _, entry := range doc.Sitemaps {
+			nested, err := url.Parse(strings.TrimSpace(entry.Loc))
+			if err == nil && strings.EqualFold(nested.Host, root.Host) && !seen["sitemap "+nested.String()] {
+				seen["sitemap "+nested.String()] = true
+				queue = append(queue, nested)
+			}
+		}
+		for _, entry := range doc.URLs {
+			link := resolveLink(sitemap, entry.Loc)
+			if link == "" || seen[link] {
+				continue
+			}
+			u, _ := url.Parse(link)
+			if !source.inScope(u) {
+				continue
+			}
+			if len(pages) == limit {
+				return pages, false, nil
+			}
+			seen[link] = true
+			pages = append(pages, link)
+		}
+	}
+	return pages, complete, nil
+}
+
+func (c *crawler) fetchSitemap(ctx context.Context, target *url.URL) (*sitemapDocument, error) {
+	resp, err := c.get(ctx, target, "application/xml, text/xml")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sitemap %s returned %s", target, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDocPageBytes))
+	if err != nil {
+		return nil, fmt.Errorf("read sitemap %s: %w", target, err)
+	}
+	// Compressed sitemaps are served as files, not with a Content-Encoding the client undoes.
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decompress sitemap %s: %w", target, err)
+		}
+		if data, err = io.ReadAll(io.LimitReader(zr, maxDocPageBytes)); err != nil {
+			return nil, fmt.Errorf("decompress sitemap %s: %w", target, err)
+		}
+	}
+
+	var doc sitemapDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse sitemap %s: %w", target, err)
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("%s is not a sitemap", target)
+	}
+	return &doc, nil
+}
+
+// crawlLink reports whether a link found on a page should be crawled: in scope, without a
+// query, and not a static asset.
+func crawlLink(source DocSource, link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || u.RawQuery != "" || skippedExtensions[strings.ToLower(path.Ext(u.Path))] {
+		return false
+	}
+	return source.inScope(u)
+}
+
+// crawlDocSource fetches the source's pages and indexes the new and changed ones into the
+// docs collection, replacing their earlier chunks. Pages are compared with known, the pages
+// recorded by earlier crawls. When the crawl reaches every page in scope, known pages that
+// were not found again are removed from the index; pages returning 404 or 410 always are.
+func crawlDocSource(ctx context.Context, cfg Config, source DocSource, known []DocPage, onProgress func(progress, processed, total int, message string)) crawlOutcome {
+	var outcome crawlOutcome
+	if cfg.Indexer == nil {
+		outcome.err = ErrIndexerRequired
+		return outcome
+	}
+
+	c := newCrawler(cfg.Crawl)
+	previous := make(map[string]DocPage, len(known))
+	for _, page := range known {
+		previous[page.URL] = page
+	}
+
+	var (
+		queue    []string
+		complete = true
+		seen     = make(map[string]bool)
+	)
+	onProgress(0, 0, 0, "reading "+source.URL)
+	if source.Kind == DocSourceKindSitemap {
+		urls, listed, err := c.sitemapURLs(ctx, source, source.MaxPages)
+		if err != nil {
+			outcome.err = err
+			return outcome
+		}
+		queue, complete = urls, listed
+	} else {
+		queue = []string{source.URL}
+	}
+	for _, link := range queue {
+		seen[link] = true
+	}
+
+	remove := func(link string) error {
+		if _, err := cfg.Indexer.DeleteSource(ctx, rag.DocsCollection, docPageSelector(source, link)); err != nil {
+			return err
+		}
+		if _, ok := previous[link]; ok {
+			outcome.removed = append(outcome.removed, link)
+			outcome.changed = true
+		}
+		return nil
+	}
+
+	processed, indexed, failed := 0, 0, 0
+	for len(queue) > 0 {
+		if processed == source.MaxPages {
+			complete = false
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			outcome.err = err
+			return outcome
+		}
+		link := queue[0]
+		queue = queue[1:]
+		processed++
+
+		target, _ := url.Parse(link)
+		page, err := c.fetchPage(ctx, target)
+		switch {
+		case ctx.Err() != nil:
+			outcome.err = ctx.Err()
+			return outcome
+		case errors.Is(err, errDisallowed), errors.Is(err, errNotDocPage):
+			// Pages that stopped being crawlable drop out like removed ones.
+			if err := remove(link); err != nil {
+				outcome.err = err
+				return outcome
+			}
+		case err != nil:
+			// Keep the indexed copy of a page that failed to load.
+			log.Printf("ingestion: skipping %s: %v", link, err)
+			failed++
+			if prev, ok := previous[link]; ok {
+				outcome.pages = append(outcome.pages, prev)
+			}
+		case page.gone:
+			if err := remove(link); err != nil {
+				outcome.err = err
+				return outcome
+			}
+		default:
+			if source.Kind == DocSourceKindPage {
+				for _, next := range page.links {
+					if !seen[next] && crawlLink(source, next) {
+						seen[next] = true
+						queue = append(queue, next)
+					}
+				}
+			}
+			record, err := indexDocPage(ctx, cfg.Indexer, source, page, previous)
+			if err != nil {
+				outcome.err = err
+				return outcome
+			}
+			if prev, ok := previous[link]; !ok || prev.ContentHash != record.ContentHash {
+				outcome.changed = true
+			}
+			outcome.pages = append(outcome.pages, record)
+			indexed++
+		}
+
+		total := processed + len(queue)
+		onProgress(min(processed*100/total, 99), processed, total, fmt.Sprintf("crawled %d pages of %s", indexed, source.Name))
+	}
+
+	if indexed == 0 && failed > 0 {
+		outcome.err = fmt.Errorf("none of the %d pages of %s could be fetched", failed, source.URL)
+		return outcome
+	}
+	if complete {
+		for link := range previous {
+			if !seen[link] {
+				if err := remove(link); err != nil {
+					outcome.err = err
+					return outcome
+				}
+			}
+		}
+	}
+	return outcome
+}
+
+// indexDocPage chunks a page and stores it in the docs collection unless its content is
+// unchanged since the last crawl. Chunk IDs derive from the page URL, and the page's earlier
+// chunks are removed first so a page that shrank leaves none behind.
+func indexDocPage(ctx context.Context, indexer *rag.Indexer, source DocSource, page *fetchedPage, previous map[string]DocPage) (DocPage, error) {
+	sum := sha256.Sum256([]byte(page.markdown))
+	now := time.Now().UTC()
+	record := DocPage{
+		URL:         page.url,
+		Title:       page.title,
+		ContentHash: hex.EncodeToString(sum[:]),
+		FetchedAt:   now,
+		ChangedAt:   now,
+	}
+	if prev, ok := previous[page.url]; ok && prev.ContentHash == record.ContentHash {
+		record.Chunks, record.ChangedAt = prev.Chunks, prev.ChangedAt
+		return record, nil
+	}
+
+	if _, err := indexer.DeleteSource(ctx, rag.DocsCollection, docPageSelector(source, page.url)); err != nil {
+		return record, err
+	}
+	docs := docPageDocuments(source, page)
+	record.Chunks = len(docs)
+	for start := 0; start < len(docs); start += indexBatchSize {
+		if err := indexer.Index(ctx, rag.DocsCollection, docs[start:min(start+indexBatchSize, len(docs))]); err != nil {
+			return record, err
+		}
+	}
+	return record, nil
+}
+
+// docPageFile names a page's chunks by the source and the page's path, so sources crawling
+// the same URL do not replace each other's chunks.
+func docPageFile(source DocSource, pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return source.Name + "/" + pageURL
+	}
+	file := source.Name + "/" + strings.TrimPrefix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		file += "?" + u.RawQuery
+	}
+	return file
+}
+
+// docPageSelector selects the chunks of one page of a source.
+func docPageSelector(source DocSource, pageURL string) rag.SourceSelector {
+	return rag.SourceSelector{Kind: rag.SourceKindFile, Value: docPageFile(source, pageURL)}
+}
+
+// docPageDocuments splits a page into documents carrying the metadata the docs ingestion
+// script writes, with the page URL as doc_url and the source as repo.
+func docPageDocuments(source DocSource, page *fetchedPage) []rag.Document {
+	u, _ := url.Parse(page.url)
+	rel := strings.TrimPrefix(strings.TrimPrefix(u.Path, strings.TrimSuffix(source.PathPrefix, "/")), "/")
+	filename := path.Base(rel)
+	if rel == "" || strings.HasSuffix(rel, "/") {
+		filename = "index"
+	}
+	category := "general"
+	if first, _, found := strings.Cut(rel, "/"); found {
+		category = first
+	}
+	directory := path.Dir(strings.TrimSuffix(rel, "/"))
+	if directory == "." {
+		directory = ""
+	}
+
+	chunks := chunkMarkdown(page.markdown, page.title)
+	urlSum := sha256.Sum256([]byte(page.url))
+	docs := make([]rag.Document, 0, len(chunks))
+	for i, chunk := range chunks {
+		headers := append(append([]string(nil), chunk.Parents...), chunk.Title)
+		docs = append(docs, rag.Document{
+			ID:      fmt.Sprintf("docs_%s_%x_%d", source.Name, urlSum[:8], i),
+			Content: chunk.Content,
+			Metadata: map[string]any{
+				rag.MetadataRepo:       source.Name,
+				rag.MetadataSourceFile: docPageFile(source, page.url),
+				rag.MetadataDocURL:     page.url,
+				rag.MetadataSourceURL:  source.URL,
+				"filename":             filename,
+				"directory":            directory,
+				"file_type":            "documentation",
+				"content_type":         "clarity_docs",
+				"doc_category":         category,
+				"title":                page.title,
+				"chunk_title":          chunk.Title,
+				"parent_context":       strings.Join(chunk.Parents, " > "),
+				"section_type":         chunk.sectionType(),
+				"chunk_size":           len(chunk.Content),
+				"context_headers":      strings.Join(headers, ", "),
+				"chunk_index":          i,
+				"chunk_count":          len(chunks),
+			},
+		})
+	}
+	return docs
+}
@@ -0,0 +1,171 @@
+package ingestion
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// docChunkChars bounds a documentation chunk, as in the docs ingestion script.
+	docChunkChars = 2000
+	// minDocChunkChars drops fragments too short to be useful context.
+	minDocChunkChars = 50
+)
+
+var markdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// docChunk is a section of a documentation page.
+type docChunk struct {
+	Content string
+	Title   string
+	// Parents are the titles of the enclosing sections, outermost first.
+	Parents []string
+}
+
+// sectionType classifies a chunk the same way the docs ingestion script does.
+func (c docChunk) sectionType() string {
+	lower := strings.ToLower(c.Content)
+	switch {
+	case strings.Contains(c.Content, "```clarity") || strings.Contains(lower, "(define-"):
+		return "api_reference"
+	case strings.Contains(lower, "example") || strings.Contains(lower, "tutorial"):
+		return "tutorial"
+	case strings.Contains(lower, "install") || strings.Contains(lower, "setup"):
+		return "setup"
+	case strings.Contains(lower, "error") || strings.Contains(lower, "warning"):
+		return "troubleshooting"
+	default:
+		return "documentation"
+	}
+}
+
+// chunkMarkdown splits a page into one chunk per heading section. Sections longer than
+// docChunkChars are split at paragraph breaks, and headings inside code fences are ignored.
+func chunkMarkdown(markdown, pageTitle string) []docChunk {
+	type section struct {
+		title   string
+		parents []string
+		lines   []string
+	}
+	var (
+		sections []section
+		current  = section{title: pageTitle}
+		// stack holds the open headings by level.
+		stack   [7]string
+		inFence bool
+	)
+	for _, line := range strings.Split(markdown, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if match := markdownHeading.FindStringSubmatch(line); match != nil && !inFence {
+			sections = append(sections, current)
+
+			level := len(match[1])
+			stack[level] = match[2]
+			for i := level + 1; i < len(stack); i++ {
+				stack[i] = ""
+			}
+			var parents []string
+			for i := 1; i < level; i++ {
+				if stack[i] != "" {
+					parents = append(parents, stack[i])
+				}
+			}
+			current = section{title: match[2], parents: parents}
+		}
+		current.lines = append(current.lines, line)
+	}
+	sections = append(sections, current)
+
+	var chunks []docChunk
+	for _, s := range sections {
+		content := strings.TrimSpace(strings.Join(s.lines, "\n"))
+		for _, part := range splitSection(content) {
+			if len(strings.TrimSpace(part)) < minDocChunkChars {
+				continue
+			}
+			chunks = append(chunks, docChunk{Content: part, Title: s.title, Parents: s.parents})
+		}
+	}
+	return chunks
+}
+
+// splitSection packs the paragraphs of a section into parts of at most docChunkChars.
+// Paragraphs that are longer on their own are split by lines.
+func splitSection(content string) []string {
+	if len(content) <= docChunkChars {
+		return []string{content}
+	}
+
+	var (
+		parts   []string
+		current strings.Builder
+	)
+	flush := func() {
+		if text := strings.TrimSpace(current.String()); text != "" {
+			parts = append(parts, text)
+		}
+		current.Reset()
+	}
+	add := func(piece, sep string) {
+		if current.Len() > 0 && current.Len()+len(sep)+len(piece) > docChunkChars {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString(sep)
+		}
+		current.WriteString(piece)
+	}
+
+	for _, paragraph := range markdownParagraphs(content) {
+		if len(paragraph) <= docChunkChars {
+			add(paragraph, "\n\n")
+			continue
+		}
+		flush()
+		for _, line := range strings.Split(paragraph, "\n") {
+			for len(line) > docChunkChars {
+				cut := docChunkChars
+				for cut > 0 && !utf8.RuneStart(line[cut]) {
+					cut--
+				}
+				add(line[:cut], "\n")
+				line = line[cut:]
+			}
+			add(line, "\n")
+		}
+		flush()
+	}
+	flush()
+	return parts
+}
+
+// markdownParagraphs splits markdown at blank lines outside code fences.
+func markdownParagraphs(content string) []string {
+	var (
+		paragraphs []string
+		current    []string
+		inFence    bool
+	)
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if trimmed == "" && !inFence {
+			if len(current) > 0 {
+				paragraphs = append(paragraphs, strings.Join(current, "\n"))
+				current = nil
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		paragraphs = append(paragraphs, strings.Join(current, "\n"))
+	}
+	return paragraphs
+}
@@ -0,0 +1,563 @@
+package ingestion
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// Documentation source kinds.
+const (
+	// DocSourceKindPage crawls from a page, following links under the source's path prefix.
+	DocSourceKindPage = "page"
+	// DocSourceKindSitemap crawls the pages listed in a sitemap or sitemap index.
+	DocSourceKindSitemap = "sitemap"
+)
+
+const (
+	// maxDocPages bounds the pages crawled from one source.
+	maxDocPages = 5000
+	// maxRecrawlIntervalHours is one year.
+	maxRecrawlIntervalHours = 24 * 365
+)
+
+var (
+	// ErrDocSourceNotFound is returned for an unknown documentation source ID.
+	ErrDocSourceNotFound = errors.New("documentation source not found")
+	// ErrDocSourceExists is returned when another source already uses the name.
+	ErrDocSourceExists = errors.New("a documentation source with this name already exists")
+	// ErrInvalidDocSource wraps validation failures of a documentation source.
+	ErrInvalidDocSource = errors.New("invalid documentation source")
+)
+
+// DocSource is a documentation site registered for crawling into the docs collection.
+type DocSource struct {
+	ID int64 `json:"id"`
+	// Name is the repo metadata the source's chunks are filtered and deleted by.
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	Kind string `json:"kind"`
+	// PathPrefix restricts crawled pages to paths under it on the URL's host. It defaults to
+	// the directory of URL for page sources and to every path for sitemaps.
+	PathPrefix string `json:"path_prefix"`
+	MaxPages   int    `json:"max_pages"`
+	// RecrawlIntervalHours schedules re-crawls. Zero crawls only on request.
+	RecrawlIntervalHours int    `json:"recrawl_interval_hours"`
+	CreatedBy            *int64 `json:"created_by,omitempty"`
+
+	// Pages and Chunks are the pages and chunks indexed by the last successful crawl.
+	Pages         int        `json:"pages"`
+	Chunks        int        `json:"chunks"`
+	LastJobID     *int64     `json:"last_job_id,omitempty"`
+	LastCrawledAt *time.Time `json:"last_crawled_at,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	// LastChangedAt is when a crawl last found a new, changed or removed page.
+	LastChangedAt *time.Time `json:"last_changed_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextCrawlAt   *time.Time `json:"next_crawl_at,omitempty"`
+	// Stale is set when the source has never been crawled successfully, or when its last
+	// success is more than two recrawl intervals old.
+	Stale bool `json:"stale"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DocPage is a crawled page of a documentation source.
+type DocPage struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	ContentHash string    `json:"content_hash"`
+	Chunks      int       `json:"chunks"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+// normalize trims the source, fills in defaults and validates it.
+func (s DocSource) normalize(defaultMaxPages int) (DocSource, error) {
+	s.Name = strings.TrimSpace(s.Name)
+	if !repoNamePattern.MatchString(s.Name) || s.Name == "." || s.Name == ".." {
+		return s, fmt.Errorf("%w: name must be 1-100 letters, digits, dots, underscores or dashes", ErrInvalidDocSource)
+	}
+
+	s.URL = strings.TrimSpace(s.URL)
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return s, fmt.Errorf("%w: url must be an http or https URL", ErrInvalidDocSource)
+	}
+	if u.User != nil {
+		return s, fmt.Errorf("%w: credentials in the url are not supported", ErrInvalidDocSource)
+	}
+	u.Fragment = ""
+	s.URL = u.String()
+
+	if s.Kind == "" {
+		s.Kind = DocSourceKindPage
+		if strings.HasSuffix(u.Path, ".xml") || strings.HasSuffix(u.Path, ".xml.gz") {
+			s.Kind = DocSourceKindSitemap
+		}
+	}
+	if s.Kind != DocSourceKindPage && s.Kind != DocSourceKindSitemap {
+		return s, fmt.Errorf("%w: kind must be %q or %q", ErrInvalidDocSource, DocSourceKindPage, DocSourceKindSitemap)
+	}
+
+	s.PathPrefix = strings.TrimSpace(s.PathPrefix)
+	if s.PathPrefix == "" {
+		s.PathPrefix = "/"
+		if s.Kind == DocSourceKindPage {
+			s.PathPrefix = pageDirectory(u.Path)
+		}
+	}
+	if !strings.HasPrefix(s.PathPrefix, "/") {
+		return s, fmt.Errorf("%w: path_prefix must start with /", ErrInvalidDocSource)
+	}
+
+	if s.MaxPages == 0 {
+		s.MaxPages = defaultMaxPages
+	}
+	if s.MaxPages < 1 || s.MaxPages > maxDocPages {
+		return s, fmt.Errorf("%w: max_pages must be between 1 and %d", ErrInvalidDocSource, maxDocPages)
+	}
+	if s.RecrawlIntervalHours < 0 || s.RecrawlIntervalHours > maxRecrawlIntervalHours {
+		return s, fmt.Errorf("%w: recrawl_interval_hours must be between 0 and %d", ErrInvalidDocSource, maxRecrawlIntervalHours)
+	}
+	return s, nil
+}
+
+// pageDirectory returns the directory of a URL path, with a trailing slash.
+func pageDirectory(p string) string {
+	if p == "" || strings.HasSuffix(p, "/") {
+		return "/" + strings.TrimPrefix(p, "/")
+	}
+	dir := path.Dir(p)
+	if dir == "/" || dir == "." {
+		return "/"
+	}
+	return dir + "/"
+}
+
+// inScope reports whether a URL is on the source's host and under its path prefix.
+func (s DocSource) inScope(u *url.URL) bool {
+	base, err := url.Parse(s.URL)
+	if err != nil {
+		return false
+	}
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	return strings.EqualFold(u.Host, base.Host) && strings.HasPrefix(p, s.PathPrefix)
+}
+
+// withFreshness fills in the next scheduled crawl and the stale flag.
+func (s *DocSource) withFreshness(now time.Time) {
+	s.NextCrawlAt, s.Stale = nil, s.LastSuccessAt == nil
+	if s.RecrawlIntervalHours <= 0 {
+		return
+	}
+	interval := time.Duration(s.RecrawlIntervalHours) * time.Hour
+	next := now
+	if s.LastCrawledAt != nil {
+		next = s.LastCrawledAt.Add(interval)
+	}
+	s.NextCrawlAt = &next
+	if s.LastSuccessAt != nil && now.Sub(*s.LastSuccessAt) > 2*interval {
+		s.Stale = true
+	}
+}
+
+// crawlOutcome is the result of one crawl, recorded on its source.
+type crawlOutcome struct {
+	jobID   int64
+	pages   []DocPage
+	removed []string
+	// changed reports whether any page was added, changed or removed.
+	changed bool
+	err     error
+}
+
+// DocSources returns the repository of registered documentation sources.
+func (m *Manager) DocSources() *DocSourceRepository {
+	return m.docs
+}
+
+// CreateDocSource validates and registers a documentation source. Sources without a
+// max_pages use the configured DOCS_CRAWL_MAX_PAGES.
+func (m *Manager) CreateDocSource(ctx context.Context, source DocSource) (*DocSource, error) {
+	if m.cfg.Indexer == nil {
+		return nil, ErrIndexerRequired
+	}
+	source, err := source.normalize(m.cfg.Crawl.MaxPages)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.docs.Create(ctx, &source); err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// UpdateDocSource validates and saves a source's crawl settings. Pages that fall out of
+// scope are removed by the next complete crawl.
+func (m *Manager) UpdateDocSource(ctx context.Context, source DocSource) (*DocSource, error) {
+	source, err := source.normalize(m.cfg.Crawl.MaxPages)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.docs.Update(ctx, &source); err != nil {
+		return nil, err
+	}
+	return m.docs.Get(ctx, source.ID)
+}
+
+// DeleteDocSource removes a source along with the chunks of its pages and returns how many
+// chunks were removed. Sources cannot be deleted while a crawl of them is queued or running.
+func (m *Manager) DeleteDocSource(ctx context.Context, id int64) (int, error) {
+	if m.cfg.Indexer == nil {
+		return 0, ErrIndexerRequired
+	}
+
+	m.enqueueMu.Lock()
+	defer m.enqueueMu.Unlock()
+
+	source, err := m.docs.Get(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	active, err := m.repo.ActiveDocCrawl(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	if active != nil {
+		return 0, ErrJobActive
+	}
+
+	pages, err := m.docs.Pages(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, page := range pages {
+		n, err := m.cfg.Indexer.DeleteSource(ctx, rag.DocsCollection, docPageSelector(*source, page.URL))
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, m.docs.Delete(ctx, id)
+}
+
+// CrawlDocSource queues a crawl_docs job for the source. Only one crawl per source may be
+// queued or running at a time.
+func (m *Manager) CrawlDocSource(ctx context.Context, id int64, requestedBy *int64) (*Job, error) {
+	if m.cfg.Indexer == nil {
+		return nil, ErrIndexerRequired
+	}
+
+	m.enqueueMu.Lock()
+	defer m.enqueueMu.Unlock()
+
+	if _, err := m.docs.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	active, err := m.repo.ActiveDocCrawl(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return active, ErrJobActive
+	}
+
+	job, err := m.enqueue(ctx, &Job{JobType: JobTypeCrawlDocs, RequestedBy: requestedBy, DocSourceID: &id})
+	if err != nil {
+		return nil, err
+	}
+	if err := m.docs.MarkCrawlStarted(ctx, id, job.ID); err != nil {
+		log.Printf("ingestion: failed to record crawl %d of documentation source %d: %v", job.ID, id, err)
+	}
+	return job, nil
+}
+
+// DocSourceRepository persists documentation sources and their crawled pages. Writes go
+// through the database's shared writer.
+type DocSourceRepository struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+// NewDocSourceRepository returns a repository backed by the supplied sql.DB handle.
+func NewDocSourceRepository(db *sql.DB) *DocSourceRepository {
+	return &DocSourceRepository{db: db, writer: database.WriterFor(db)}
+}
+
+const docSourceColumns = `
+	id, name, url, kind, path_prefix, max_pages, recrawl_interval_hours, created_by, pages,
+	chunks, last_job_id, last_crawled_at, last_success_at, last_changed_at,
+	COALESCE(last_error, ''), created_at, updated_at
+`
+
+// Create stores a normalized source and fills in its ID and timestamps.
+func (r *DocSourceRepository) Create(ctx context.Context, s *DocSource) error {
+	now := time.Now().UTC()
+	err := r.writer.Do(ctx, func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var taken bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM doc_sources WHERE name = ?)`, s.Name).Scan(&taken); err != nil {
+			return fmt.Errorf("check documentation source name: %w", err)
+		}
+		if taken {
+			return ErrDocSourceExists
+		}
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO doc_sources (name, url, kind, path_prefix, max_pages, recrawl_interval_hours, created_by, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			s.Name, s.URL, s.Kind, s.PathPrefix, s.MaxPages, s.RecrawlIntervalHours, s.CreatedBy, now, now,
+		)
+		if err != nil {
+			return fmt.Errorf("create documentation source: %w", err)
+		}
+		if s.ID, err = res.LastInsertId(); err != nil {
+			return fmt.Errorf("create documentation source: %w", err)
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return err
+	}
+	s.CreatedAt, s.UpdatedAt = now, now
+	s.withFreshness(now)
+	return nil
+}
+
+// Update saves a source's crawl settings. The name cannot change.
+func (r *DocSourceRepository) Update(ctx context.Context, s *DocSource) error {
+	now := time.Now().UTC()
+	res, err := r.writer.Exec(ctx, `
+		UPDATE doc_sources
+		SET url = ?, kind = ?, path_prefix = ?, max_pages = ?, recrawl_interval_hours = ?, updated_at = ?
+		WHERE id = ?`,
+		s.URL, s.Kind, s.PathPrefix, s.MaxPages, s.RecrawlIntervalHours, now, s.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update documentation source: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrDocSourceNotFound
+	}
+	s.UpdatedAt = now
+	s.withFreshness(now)
+	return nil
+}
+
+// Get returns a source with its freshness.
+func (r *DocSourceRepository) Get(ctx context.Context, id int64) (*DocSource, error) {
+	s, err := scanDocSource(r.db.QueryRowContext(ctx, `SELECT `+docSourceColumns+` FROM doc_sources WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDocSourceNotFound
+	}
+	return s, err
+}
+
+// List returns every source, oldest first.
+func (r *DocSourceRepository) List(ctx context.Context) ([]DocSource, error) {
+	return r.query(ctx, `SELECT `+docSourceColumns+` FROM doc_sources ORDER BY id`)
+}
+
+// Due returns the sources whose scheduled re-crawl is due at now.
+func (r *DocSourceRepository) Due(ctx context.Context, now time.Time) ([]DocSource, error) {
+	sources, err := r.query(ctx, `SELECT `+docSourceColumns+` FROM doc_sources WHERE recrawl_interval_hours > 0 ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	due := make([]DocSource, 0, len(sources))
+	for _, s := range sources {
+		if s.NextCrawlAt != nil && !s.NextCrawlAt.After(now) {
+			due = append(due, s)
+		}
+	}
+	return due, nil
+}
+
+// Delete removes a source and its page records.
+func (r *DocSourceRepository) Delete(ctx context.Context, id int64) error {
+	return r.writer.Do(ctx, func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM doc_source_pages WHERE source_id = ?`, id); err != nil {
+			return fmt.Errorf("delete documentation pages: %w", err)
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM doc_sources WHERE id = ?`, id)
+		if err != nil {
+			return fmt.Errorf("delete documentation source: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrDocSourceNotFound
+		}
+		return tx.Commit()
+	})
+}
+
+// Pages returns the crawled pages of a source, by URL.
+func (r *DocSourceRepository) Pages(ctx context.Context, id int64) ([]DocPage, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT url, COALESCE(title, ''), content_hash, chunks, fetched_at, changed_at
+		FROM doc_source_pages
+		WHERE source_id = ?
+		ORDER BY url
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("list documentation pages: %w", err)
+	}
+	defer rows.Close()
+
+	pages := make([]DocPage, 0)
+	for rows.Next() {
+		var page DocPage
+		if err := rows.Scan(&page.URL, &page.Title, &page.ContentHash, &page.Chunks, &page.FetchedAt, &page.ChangedAt); err != nil {
+			return nil, fmt.Errorf("scan documentation page: %w", err)
+		}
+		pages = append(pages, page)
+	}
+	return pages, rows.Err()
+}
+
+// MarkCrawlStarted records the job crawling a source, so the schedule does not queue it
+// again while it runs.
+func (r *DocSourceRepository) MarkCrawlStarted(ctx context.Context, id, jobID int64) error {
+	_, err := r.writer.Exec(ctx, `
+		UPDATE doc_sources SET last_job_id = ?, last_crawled_at = ? WHERE id = ?
+	`, jobID, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("record documentation crawl: %w", err)
+	}
+	return nil
+}
+
+// RecordCrawl stores the pages a crawl fetched and the source's freshness. A failed crawl
+// keeps the pages it indexed before failing but leaves the last success unchanged.
+func (r *DocSourceRepository) RecordCrawl(ctx context.Context, id int64, outcome crawlOutcome) error {
+	return r.writer.Do(ctx, func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, page := range outcome.pages {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO doc_source_pages (source_id, url, title, content_hash, chunks, fetched_at, changed_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT(source_id, url) DO UPDATE SET
+					title = excluded.title, content_hash = excluded.content_hash, chunks = excluded.chunks,
+					fetched_at = excluded.fetched_at, changed_at = excluded.changed_at
+			`, id, page.URL, page.Title, page.ContentHash, page.Chunks, page.FetchedAt, page.ChangedAt); err != nil {
+				return fmt.Errorf("save documentation page: %w", err)
+			}
+		}
+		for _, removed := range outcome.removed {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM doc_source_pages WHERE source_id = ? AND url = ?`, id, removed); err != nil {
+				return fmt.Errorf("delete documentation page: %w", err)
+			}
+		}
+
+		now := time.Now().UTC()
+		var changedAt any
+		if outcome.changed {
+			changedAt = now
+		}
+		if outcome.err != nil {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE doc_sources
+				SET last_job_id = ?, last_crawled_at = ?, last_error = ?, last_changed_at = COALESCE(?, last_changed_at),
+					pages = (SELECT COUNT(*) FROM doc_source_pages WHERE source_id = ?),
+					chunks = (SELECT COALESCE(SUM(chunks), 0) FROM doc_source_pages WHERE source_id = ?)
+				WHERE id = ?
+			`, outcome.jobID, now, outcome.err.Error(), changedAt, id, id, id)
+		} else {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE doc_sources
+				SET last_job_id = ?, last_crawled_at = ?, last_success_at = ?, last_error = NULL,
+					last_changed_at = COALESCE(?, last_changed_at),
+					pages = (SELECT COUNT(*) FROM doc_source_pages WHERE source_id = ?),
+					chunks = (SELECT COALESCE(SUM(chunks), 0) FROM doc_source_pages WHERE source_id = ?)
+				WHERE id = ?
+			`, outcome.jobID, now, now, changedAt, id, id, id)
+		}
+		if err != nil {
+			return fmt.Errorf("record documentation crawl: %w", err)
+		}
+		return tx.Commit()
+	})
+}
+
+func (r *DocSourceRepository) query(ctx context.Context, query string, args ...any) ([]DocSource, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list documentation sources: %w", err)
+	}
+	defer rows.Close()
+
+	sources := make([]DocSource, 0)
+	for rows.Next() {
+		s, err := scanDocSource(rows)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, *s)
+	}
+	return sources, rows.Err()
+}
+
+func scanDocSource(row rowScanner) (*DocSource, error) {
+	var (
+		s                                     DocSource
+		createdBy, lastJobID                  sql.NullInt64
+		lastCrawled, lastSuccess, lastChanged sql.NullTime
+	)
+	err := row.Scan(
+		&s.ID, &s.Name, &s.URL, &s.Kind, &s.PathPrefix, &s.MaxPages, &s.RecrawlIntervalHours,
+		&createdBy, &s.Pages, &s.Chunks, &lastJobID, &lastCrawled, &lastSuccess, &lastChanged,
+		&s.LastError, &s.CreatedAt, &s.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan documentation source: %w", err)
+	}
+	if createdBy.Valid {
+		s.CreatedBy = &createdBy.Int64
+	}
+	if lastJobID.Valid {
+		s.LastJobID = &lastJobID.Int64
+	}
+	if lastCrawled.Valid {
+		s.LastCrawledAt = &lastCrawled.Time
+	}
+	if lastSuccess.Valid {
+		s.LastSuccessAt = &lastSuccess.Time
+	}
+	if lastChanged.Valid {
+		s.LastChangedAt = &lastChanged.Time
+	}
+	s.withFreshness(time.Now().UTC())
+	return &s, nil
+}
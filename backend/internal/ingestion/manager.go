@@ -0,0 +1,411 @@
+// Package ingestion runs the clone and ingest pipelines as background jobs whose status
+// and progress are persisted in the ingestion_jobs table.
+package ingestion
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/webhook"
+)
+
+var (
+	// ErrJobActive is returned when a job of the same type is already queued or running.
+	ErrJobActive = errors.New("an ingestion job of this type is already queued or running")
+	// ErrQueueFull is returned when the job queue cannot accept more work.
+	ErrQueueFull = errors.New("ingestion queue is full")
+	// ErrJobFinished is returned when cancelling a job that has already finished.
+	ErrJobFinished = errors.New("ingestion job has already finished")
+	// ErrUnknownJobType is returned for job types without a pipeline.
+	ErrUnknownJobType = errors.New("unknown ingestion job type")
+	// ErrIndexerRequired is returned for repository ingestion when no vector store is
+	// configured for the backend to write to.
+	ErrIndexerRequired = errors.New("repository ingestion requires RAG_BACKEND to be chroma, qdrant or pgvector")
+
+	// errCancelled is the cancellation cause of jobs stopped through Cancel.
+	errCancelled = errors.New("cancelled by request")
+)
+
+// Manager queues ingestion jobs and runs them on a fixed pool of background workers.
+type Manager struct {
+	repo   *Repository
+	docs   *DocSourceRepository
+	cfg    Config
+	queue  chan int64
+	events webhook.Publisher
+
+	// enqueueMu serialises the active-job check with job creation.
+	enqueueMu sync.Mutex
+
+	mu      sync.Mutex
+	cancels map[int64]context.CancelCauseFunc
+}
+
+// NewManager constructs a manager. Jobs are only executed after Start is called. Finished
+// jobs are published as ingestion.completed events when events is non-nil.
+func NewManager(db *sql.DB, cfg Config, events webhook.Publisher) *Manager {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	return &Manager{
+		repo:    NewRepository(db),
+		docs:    NewDocSourceRepository(db),
+		cfg:     cfg,
+		queue:   make(chan int64, cfg.QueueSize),
+		events:  events,
+		cancels: make(map[int64]context.CancelCauseFunc),
+	}
+}
+
+// Repository returns the job repository used by the manager.
+func (m *Manager) Repository() *Repository {
+	return m.repo
+}
+
+// Start fails jobs abandoned by a previous process and launches the workers, which stop
+// when ctx is cancelled. With a vector store configured, the collection aliases switched
+// by reindexes are loaded and then refreshed every minute, and documentation sources due
+// for a re-crawl are queued every Crawl.CheckInterval.
+func (m *Manager) Start(ctx context.Context) {
+	if n, err := m.repo.FailAbandoned(ctx); err != nil {
+		log.Printf("ingestion: failed to clean up abandoned jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("ingestion: marked %d abandoned jobs as failed", n)
+	}
+	if m.cfg.Indexer != nil {
+		if err := LoadCollectionAliases(ctx, m.repo.db); err != nil {
+			log.Printf("ingestion: failed to load vector store aliases: %v", err)
+		}
+		go m.refreshAliases(ctx)
+	}
+
+	for i := 0; i < m.cfg.Workers; i++ {
+		go m.work(ctx)
+	}
+	if m.cfg.Indexer != nil && m.cfg.Crawl.CheckInterval > 0 {
+		go m.scheduleDocCrawls(ctx)
+	}
+}
+
+// Enqueue creates a job of the given type and queues it for execution. Repository
+// ingestion jobs are queued with EnqueueRepo, documentation crawls with CrawlDocSource and
+// reindexes with Reindex.
+// chunking overrides the configured splitting of Clarity contracts and is only accepted for
+// ingest_samples jobs stored through the configured vector store.
+func (m *Manager) Enqueue(ctx context.Context, jobType string, chunking *ChunkOptions, requestedBy *int64) (*Job, error) {
+	if !ValidJobType(jobType) || jobType == JobTypeIngestRepo || jobType == JobTypeCrawlDocs || jobType == JobTypeReindex {
+		return nil, ErrUnknownJobType
+	}
+	if chunking != nil && jobType != JobTypeIngestSamples {
+		return nil, fmt.Errorf("%w: %s jobs do not chunk Clarity contracts", ErrInvalidChunking, jobType)
+	}
+	if chunking != nil && m.cfg.Indexer == nil {
+		return nil, fmt.Errorf("%w: chunking requires RAG_BACKEND to be chroma, qdrant or pgvector", ErrInvalidChunking)
+	}
+	// Without an indexer the script stores whole contracts, so no chunking is recorded.
+	var resolved *ChunkOptions
+	if jobType == JobTypeIngestSamples && m.cfg.Indexer != nil {
+		var err error
+		if resolved, err = m.chunking(chunking); err != nil {
+			return nil, err
+		}
+	}
+
+	m.enqueueMu.Lock()
+	defer m.enqueueMu.Unlock()
+
+	active, err := m.repo.Active(ctx, jobType)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return active, ErrJobActive
+	}
+
+	return m.enqueue(ctx, &Job{JobType: jobType, RequestedBy: requestedBy, Chunking: resolved})
+}
+
+// EnqueueRepo validates the repository source and queues a job that clones it and indexes
+// its files. chunking overrides the configured splitting of Clarity contracts. Only one
+// job per repository branch may be queued or running at a time.
+func (m *Manager) EnqueueRepo(ctx context.Context, source RepoSource, chunking *ChunkOptions, requestedBy *int64) (*Job, error) {
+	if m.cfg.Indexer == nil {
+		return nil, ErrIndexerRequired
+	}
+	source, err := source.normalize()
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := m.chunking(chunking)
+	if err != nil {
+		return nil, err
+	}
+
+	m.enqueueMu.Lock()
+	defer m.enqueueMu.Unlock()
+
+	active, err := m.repo.ActiveRepo(ctx, source.URL, source.Branch)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return active, ErrJobActive
+	}
+
+	return m.enqueue(ctx, &Job{JobType: JobTypeIngestRepo, RequestedBy: requestedBy, Source: &source, Chunking: resolved})
+}
+
+// chunking resolves requested chunking options against the configured defaults.
+func (m *Manager) chunking(requested *ChunkOptions) (*ChunkOptions, error) {
+	var opts ChunkOptions
+	if requested != nil {
+		opts = *requested
+	}
+	resolved, err := opts.resolve(m.cfg.Chunking)
+	if err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+// enqueue records the job and hands it to the workers. Jobs writing to the collections are
+// refused while a reindex is queued or running. Callers hold enqueueMu.
+func (m *Manager) enqueue(ctx context.Context, job *Job) (*Job, error) {
+	if job.JobType != JobTypeReindex && job.JobType != JobTypeCloneRepos {
+		reindex, err := m.repo.Active(ctx, JobTypeReindex)
+		if err != nil {
+			return nil, err
+		}
+		if reindex != nil {
+			return reindex, ErrCollectionsBusy
+		}
+	}
+
+	if err := m.repo.Create(ctx, job); err != nil {
+		return nil, err
+	}
+
+	select {
+	case m.queue <- job.ID:
+		return job, nil
+	default:
+		if _, err := m.repo.Finish(ctx, job.ID, StatusFailed, ErrQueueFull.Error()); err != nil {
+			log.Printf("ingestion: failed to reject job %d: %v", job.ID, err)
+		}
+		return nil, ErrQueueFull
+	}
+}
+
+// Cancel stops a queued or running job and returns its updated record.
+func (m *Manager) Cancel(ctx context.Context, id int64) (*Job, error) {
+	job, err := m.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Finished() {
+		return job, ErrJobFinished
+	}
+
+	m.mu.Lock()
+	cancel, running := m.cancels[id]
+	m.mu.Unlock()
+
+	if running {
+		// The worker records the cancelled status once the script has exited.
+		cancel(errCancelled)
+		job.Status = StatusCancelled
+		return job, nil
+	}
+
+	finished, err := m.repo.Finish(ctx, id, StatusCancelled, "")
+	if err != nil {
+		return nil, err
+	}
+	if !finished {
+		// The job finished between the lookup and the update.
+		job, err = m.repo.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return job, ErrJobFinished
+	}
+	return m.publishFinished(ctx, id)
+}
+
+func (m *Manager) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-m.queue:
+			m.run(ctx, id)
+		}
+	}
+}
+
+func (m *Manager) run(ctx context.Context, id int64) {
+	// Register the cancel func before the job is visible as running so Cancel never sees
+	// a running job it cannot stop.
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	m.mu.Lock()
+	m.cancels[id] = cancel
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.cancels, id)
+		m.mu.Unlock()
+		cancel(nil)
+	}()
+
+	started, err := m.repo.MarkRunning(ctx, id)
+	if err != nil {
+		log.Printf("ingestion: failed to start job %d: %v", id, err)
+		return
+	}
+	if !started {
+		// Cancelled while queued.
+		return
+	}
+
+	job, err := m.repo.Get(ctx, id)
+	if err != nil {
+		log.Printf("ingestion: failed to load job %d: %v", id, err)
+		return
+	}
+
+	runCtx := jobCtx
+	if m.cfg.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		runCtx, cancelTimeout = context.WithTimeout(jobCtx, m.cfg.Timeout)
+		defer cancelTimeout()
+	}
+
+	log.Printf("ingestion: job %d (%s) started", id, job.JobType)
+	var runErr error
+	chunking, err := m.chunking(job.Chunking)
+	switch {
+	case err != nil:
+		runErr = err
+	case job.JobType == JobTypeIngestRepo:
+		runErr = m.runRepo(runCtx, id, job.Source, *chunking)
+	case job.JobType == JobTypeCrawlDocs:
+		runErr = m.runDocCrawl(runCtx, id, job.DocSourceID)
+	case job.JobType == JobTypeReindex:
+		runErr = m.runReindex(runCtx, id, job.Reindex, *chunking)
+	default:
+		runErr = m.runSteps(runCtx, id, m.cfg.steps(job.JobType), *chunking)
+	}
+
+	// Record the outcome even if the server is shutting down.
+	finishCtx := context.WithoutCancel(ctx)
+	status, message := StatusCompleted, ""
+	switch {
+	case errors.Is(context.Cause(jobCtx), errCancelled):
+		status = StatusCancelled
+	case errors.Is(runErr, context.DeadlineExceeded):
+		status, message = StatusFailed, fmt.Sprintf("timed out after %s", m.cfg.Timeout)
+	case runErr != nil:
+		status, message = StatusFailed, runErr.Error()
+	}
+
+	if _, err := m.repo.Finish(finishCtx, id, status, message); err != nil {
+		log.Printf("ingestion: failed to record outcome of job %d: %v", id, err)
+		return
+	}
+	log.Printf("ingestion: job %d (%s) %s", id, job.JobType, status)
+	if _, err := m.publishFinished(finishCtx, id); err != nil {
+		log.Printf("ingestion: failed to load finished job %d: %v", id, err)
+	}
+}
+
+// publishFinished loads a finished job and publishes it as an ingestion.completed event.
+func (m *Manager) publishFinished(ctx context.Context, id int64) (*Job, error) {
+	job, err := m.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if m.events != nil {
+		m.events.Publish(webhook.EventIngestionCompleted, job)
+	}
+	return job, nil
+}
+
+// runRepo clones and indexes a repository, recording its progress on the job.
+func (m *Manager) runRepo(ctx context.Context, id int64, source *RepoSource, chunking ChunkOptions) error {
+	if source == nil {
+		return fmt.Errorf("job has no repository source")
+	}
+	return ingestRepo(ctx, m.cfg, *source, chunking, func(progress, processed, total int, message string) {
+		if err := m.repo.UpdateProgress(ctx, id, progress, processed, total, message); err != nil {
+			log.Printf("ingestion: failed to record progress of job %d: %v", id, err)
+		}
+	})
+}
+
+// runDocCrawl crawls a documentation source, recording its progress on the job and the
+// crawled pages on the source.
+func (m *Manager) runDocCrawl(ctx context.Context, id int64, sourceID *int64) error {
+	if sourceID == nil {
+		return fmt.Errorf("job has no documentation source")
+	}
+	source, err := m.docs.Get(ctx, *sourceID)
+	if err != nil {
+		return err
+	}
+	known, err := m.docs.Pages(ctx, source.ID)
+	if err != nil {
+		return err
+	}
+	outcome := crawlDocSource(ctx, m.cfg, *source, known, func(progress, processed, total int, message string) {
+		if err := m.repo.UpdateProgress(ctx, id, progress, processed, total, message); err != nil {
+			log.Printf("ingestion: failed to record progress of job %d: %v", id, err)
+		}
+	})
+	outcome.jobID = id
+	// Keep the pages indexed before a cancellation or timeout.
+	if err := m.docs.RecordCrawl(context.WithoutCancel(ctx), source.ID, outcome); err != nil {
+		log.Printf("ingestion: failed to record crawl of documentation source %d: %v", source.ID, err)
+	}
+	return outcome.err
+}
+
+// scheduleDocCrawls queues the documentation sources due for a re-crawl now and then every
+// Crawl.CheckInterval until ctx is cancelled.
+func (m *Manager) scheduleDocCrawls(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Crawl.CheckInterval)
+	defer ticker.Stop()
+	for {
+		due, err := m.docs.Due(ctx, time.Now().UTC())
+		if err != nil {
+			log.Printf("ingestion: failed to list documentation sources due for a crawl: %v", err)
+		}
+		for _, source := range due {
+			if _, err := m.CrawlDocSource(ctx, source.ID, nil); err != nil && !errors.Is(err, ErrJobActive) {
+				log.Printf("ingestion: failed to queue crawl of documentation source %s: %v", source.Name, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runSteps runs the pipeline, recording its progress on the job.
+func (m *Manager) runSteps(ctx context.Context, id int64, steps []step, chunking ChunkOptions) error {
+	return runPipeline(ctx, m.cfg, steps, chunking, func(progress, processed, total int, message string) {
+		if err := m.repo.UpdateProgress(ctx, id, progress, processed, total, message); err != nil {
+			log.Printf("ingestion: failed to record progress of job %d: %v", id, err)
+		}
+	})
+}
@@ -0,0 +1,371 @@
+package ingestion
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	blankLines    = regexp.MustCompile(`\n{3,}`)
+	inlineSpaces  = regexp.MustCompile(`[ \t\r\n\f]+`)
+	fenceLanguage = regexp.MustCompile(`(?:^|\s)(?:language|lang)-([A-Za-z0-9_+-]+)`)
+)
+
+// skippedElements hold navigation, chrome or non-text content that is never documentation.
+var skippedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Form: true, atom.Button: true, atom.Svg: true, atom.Iframe: true,
+	atom.Head: true,
+}
+
+// htmlPage is a fetched page converted to markdown.
+type htmlPage struct {
+	Title    string
+	Markdown string
+	// Links are the absolute http(s) URLs the page links to, without fragments.
+	Links []string
+}
+
+// convertHTML parses an HTML document and renders its main content as markdown. The main
+// content is the first <main>, <article> or role="main" element, falling back to <body>.
+// Relative links are resolved against base.
+func convertHTML(r io.Reader, base *url.URL) (*htmlPage, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &htmlPage{}
+	seen := make(map[string]bool)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if page.Title == "" {
+					page.Title = collapseSpaces(textContent(n))
+				}
+			case atom.A:
+				if link := resolveLink(base, attr(n, "href")); link != "" && !seen[link] {
+					seen[link] = true
+					page.Links = append(page.Links, link)
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	root := findMain(doc)
+	if root == nil {
+		root = findElement(doc, atom.Body)
+	}
+	if root == nil {
+		root = doc
+	}
+
+	w := &markdownWriter{base: base}
+	w.block(root)
+	page.Markdown = strings.TrimSpace(blankLines.ReplaceAllString(w.String(), "\n\n"))
+	if page.Title == "" {
+		if h1 := findElement(root, atom.H1); h1 != nil {
+			page.Title = collapseSpaces(textContent(h1))
+		}
+	}
+	return page, nil
+}
+
+// blockElements start a new markdown block.
+var blockElements = map[atom.Atom]bool{
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Main: true, atom.Article: true,
+	atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Figure: true, atom.Figcaption: true,
+	atom.Details: true, atom.Summary: true, atom.Pre: true, atom.Blockquote: true,
+	atom.Ul: true, atom.Ol: true, atom.Table: true, atom.Hr: true,
+}
+
+// markdownWriter renders block and inline HTML elements as markdown.
+type markdownWriter struct {
+	strings.Builder
+	base *url.URL
+}
+
+// block renders the children of n, separating block elements with blank lines.
+func (w *markdownWriter) block(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		w.node(child)
+	}
+}
+
+func (w *markdownWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.WriteString(inlineSpaces.ReplaceAllString(n.Data, " "))
+		return
+	case html.ElementNode:
+	default:
+		w.block(n)
+		return
+	}
+	if skippedElements[n.DataAtom] || attr(n, "hidden") != "" || attr(n, "aria-hidden") == "true" {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		if text := collapseSpaces(w.inline(n)); text != "" {
+			w.WriteString("\n\n" + strings.Repeat("#", level) + " " + text + "\n\n")
+		}
+	case atom.P, atom.Div, atom.Section, atom.Main, atom.Article, atom.Dl, atom.Figure, atom.Details:
+		w.WriteString("\n\n")
+		w.block(n)
+		w.WriteString("\n\n")
+	case atom.Dt, atom.Summary, atom.Figcaption:
+		w.WriteString("\n\n**" + collapseSpaces(w.inline(n)) + "**\n\n")
+	case atom.Dd:
+		w.WriteString("\n\n" + collapseSpaces(w.inline(n)) + "\n\n")
+	case atom.Pre:
+		w.WriteString("\n\n```" + codeLanguage(n) + "\n" + strings.Trim(textContent(n), "\n") + "\n```\n\n")
+	case atom.Blockquote:
+		inner := &markdownWriter{base: w.base}
+		inner.block(n)
+		text := strings.TrimSpace(blankLines.ReplaceAllString(inner.String(), "\n\n"))
+		if text != "" {
+			w.WriteString("\n\n> " + strings.ReplaceAll(text, "\n", "\n> ") + "\n\n")
+		}
+	case atom.Ul, atom.Ol:
+		w.list(n, n.DataAtom == atom.Ol)
+	case atom.Table:
+		w.table(n)
+	case atom.Hr:
+		w.WriteString("\n\n---\n\n")
+	case atom.Br:
+		w.WriteString("\n")
+	default:
+		// Unknown wrappers, e.g. custom elements, may hold whole sections.
+		if containsBlock(n) {
+			w.block(n)
+		} else {
+			w.WriteString(w.inline(n))
+		}
+	}
+}
+
+// inline renders the inline content of n on a single line.
+func (w *markdownWriter) inline(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		switch {
+		case child.Type == html.TextNode:
+			b.WriteString(inlineSpaces.ReplaceAllString(child.Data, " "))
+		case child.Type != html.ElementNode || skippedElements[child.DataAtom]:
+		case child.DataAtom == atom.Code || child.DataAtom == atom.Kbd || child.DataAtom == atom.Samp:
+			if code := textContent(child); strings.TrimSpace(code) != "" {
+				b.WriteString("`" + strings.ReplaceAll(code, "`", "'") + "`")
+			}
+		case child.DataAtom == atom.Strong || child.DataAtom == atom.B:
+			b.WriteString(wrapInline("**", w.inline(child)))
+		case child.DataAtom == atom.Em || child.DataAtom == atom.I:
+			b.WriteString(wrapInline("_", w.inline(child)))
+		case child.DataAtom == atom.A:
+			text := collapseSpaces(w.inline(child))
+			if link := resolveLink(w.base, attr(child, "href")); link != "" && text != "" {
+				b.WriteString("[" + text + "](" + link + ")")
+			} else {
+				b.WriteString(text)
+			}
+		case child.DataAtom == atom.Img:
+			b.WriteString(attr(child, "alt"))
+		case child.DataAtom == atom.Br:
+			b.WriteString(" ")
+		default:
+			b.WriteString(w.inline(child))
+		}
+	}
+	return b.String()
+}
+
+// list renders the items of a <ul> or <ol>. Continuation lines, including nested lists, are
+// indented under their item.
+func (w *markdownWriter) list(n *html.Node, ordered bool) {
+	w.WriteString("\n\n")
+	number := 1
+	for item := n.FirstChild; item != nil; item = item.NextSibling {
+		if item.Type != html.ElementNode || item.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+
+		inner := &markdownWriter{base: w.base}
+		inner.block(item)
+		text := strings.TrimSpace(blankLines.ReplaceAllString(inner.String(), "\n\n"))
+		text = strings.ReplaceAll(strings.ReplaceAll(text, "\n\n", "\n"), "\n", "\n  ")
+		w.WriteString(marker + text + "\n")
+	}
+	w.WriteString("\n")
+}
+
+// table renders a table as a pipe table, taking the first row as the header.
+func (w *markdownWriter) table(n *html.Node) {
+	var rows [][]string
+	var collect func(*html.Node)
+	collect = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if child.DataAtom != atom.Tr {
+				collect(child)
+				continue
+			}
+			var cells []string
+			for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+					cells = append(cells, strings.ReplaceAll(collapseSpaces(w.inline(cell)), "|", `\|`))
+				}
+			}
+			if len(cells) > 0 {
+				rows = append(rows, cells)
+			}
+		}
+	}
+	collect(n)
+	if len(rows) == 0 {
+		return
+	}
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	w.WriteString("\n\n")
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		w.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			w.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+	w.WriteString("\n")
+}
+
+// codeLanguage reads the language of a <pre> block from a language-* or lang-* class on it
+// or on its <code> child.
+func codeLanguage(pre *html.Node) string {
+	candidates := []*html.Node{pre}
+	if code := findElement(pre, atom.Code); code != nil {
+		candidates = append(candidates, code)
+	}
+	for _, n := range candidates {
+		if match := fenceLanguage.FindStringSubmatch(attr(n, "class")); match != nil {
+			return strings.ToLower(match[1])
+		}
+	}
+	return ""
+}
+
+func containsBlock(n *html.Node) bool {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && (blockElements[child.DataAtom] || containsBlock(child)) {
+			return true
+		}
+	}
+	return false
+}
+
+func findMain(n *html.Node) *html.Node {
+	if n.Type == html.ElementNode && (n.DataAtom == atom.Main || n.DataAtom == atom.Article || attr(n, "role") == "main") {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findMain(child); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(textContent(child))
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// resolveLink returns href as an absolute http(s) URL without its fragment, or "" for other
+// schemes and in-page anchors.
+func resolveLink(base *url.URL, href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
+
+func collapseSpaces(s string) string {
+	return strings.TrimSpace(inlineSpaces.ReplaceAllString(s, " "))
+}
+
+// wrapInline wraps text in a markdown emphasis marker, keeping surrounding spaces outside it.
+func wrapInline(marker, text string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	lead := text[:len(text)-len(strings.TrimLeft(text, " "))]
+	trail := text[len(strings.TrimRight(text, " ")):]
+	return lead + marker + trimmed + marker + trail
+}
@@ -0,0 +1,66 @@
+package ingestion
+
+import "time"
+
+// Job types accepted by the ingestion endpoints.
+const (
+	JobTypeCloneRepos    = "clone_repos"
+	JobTypeIngestSamples = "ingest_samples"
+	JobTypeIngestDocs    = "ingest_docs"
+	JobTypeIngestRepo    = "ingest_repo"
+	JobTypeCrawlDocs     = "crawl_docs"
+	JobTypeReindex       = "reindex"
+)
+
+// Job lifecycle states stored in ingestion_jobs.status.
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// Job is a persisted clone or ingestion run.
+type Job struct {
+	ID             int64  `json:"id"`
+	JobType        string `json:"job_type"`
+	Status         string `json:"status"`
+	Progress       int    `json:"progress"`
+	TotalItems     int    `json:"total_items"`
+	ProcessedItems int    `json:"processed_items"`
+	Message        string `json:"message,omitempty"`
+	ErrorMessage   string `json:"error_message,omitempty"`
+	RequestedBy    *int64 `json:"requested_by,omitempty"`
+	// Source is the repository an ingest_repo job clones.
+	Source *RepoSource `json:"source,omitempty"`
+	// DocSourceID is the documentation source a crawl_docs job fetches.
+	DocSourceID *int64 `json:"doc_source_id,omitempty"`
+	// Chunking is how ingest_samples and ingest_repo jobs split Clarity contracts.
+	Chunking *ChunkOptions `json:"chunking,omitempty"`
+	// Reindex is what a reindex job rebuilds and, once it has run, how each collection fared.
+	Reindex     *ReindexOptions `json:"reindex,omitempty"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// Finished reports whether the job has reached a terminal state.
+func (j Job) Finished() bool {
+	switch j.Status {
+	case StatusCompleted, StatusFailed, StatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidJobType reports whether jobType names a known pipeline.
+func ValidJobType(jobType string) bool {
+	switch jobType {
+	case JobTypeCloneRepos, JobTypeIngestSamples, JobTypeIngestDocs, JobTypeIngestRepo, JobTypeCrawlDocs, JobTypeReindex:
+		return true
+	default:
+		return false
+	}
+}
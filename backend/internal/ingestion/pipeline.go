@@ -0,0 +1,366 @@
+package ingestion
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+const (
+	defaultWorkers    = 1
+	defaultQueueSize  = 32
+	defaultJobTimeout = 2 * time.Hour
+
+	// maxStderrBytes bounds how much script stderr is kept for error messages.
+	maxStderrBytes = 8 * 1024
+	// maxEventBytes bounds a single stdout line; document events carry whole source files.
+	maxEventBytes = 16 * 1024 * 1024
+	// indexBatchSize is the number of emitted documents embedded and stored at once.
+	indexBatchSize = 64
+)
+
+// Config controls the ingestion workers and the scripts each pipeline runs.
+type Config struct {
+	PythonExecutable    string
+	CloneReposScript    string
+	CloneDocsScript     string
+	IngestSamplesScript string
+	IngestDocsScript    string
+	// GitExecutable clones the repositories of ingest_repo jobs.
+	GitExecutable string
+	// Workers is the number of jobs that run concurrently. Scripts share the ChromaDB
+	// directory, so the default of one avoids concurrent writers.
+	Workers   int
+	QueueSize int
+	// Timeout bounds a single job run. Zero disables the limit.
+	Timeout time.Duration
+	// Indexer, when set, stores ingested documents in the configured vector store: the
+	// ingest scripts only chunk the sources and emit the documents on stdout.
+	Indexer *rag.Indexer
+	// Chunking is the default splitting of Clarity contracts indexed through Indexer.
+	Chunking ChunkOptions
+	// Crawl controls the crawl_docs jobs of registered documentation sources.
+	Crawl CrawlConfig
+}
+
+// ConfigFromEnv loads the script paths used at startup initialization and GIT_EXECUTABLE
+// along with INGESTION_WORKERS, INGESTION_QUEUE_SIZE, INGESTION_JOB_TIMEOUT,
+// INGESTION_CHUNK_SIZE and INGESTION_CHUNK_OVERLAP, and the DOCS_CRAWL_* crawler settings.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		PythonExecutable:    envOrDefault("PYTHON_EXECUTABLE", "python3"),
+		CloneReposScript:    envOrDefault("PYTHON_CLONE_SCRIPT", "scripts/clone_repos.py"),
+		CloneDocsScript:     envOrDefault("PYTHON_CLONE_DOCS_SCRIPT", "scripts/clone_docs.py"),
+		IngestSamplesScript: envOrDefault("PYTHON_INGEST_SAMPLES_SCRIPT", "scripts/ingest_samples.py"),
+		IngestDocsScript:    envOrDefault("PYTHON_INGEST_DOCS_SCRIPT", "scripts/ingest_docs.py"),
+		GitExecutable:       envOrDefault("GIT_EXECUTABLE", "git"),
+		Workers:             defaultWorkers,
+		QueueSize:           defaultQueueSize,
+		Timeout:             defaultJobTimeout,
+		Chunking:            chunkOptionsFromEnv(),
+		Crawl:               crawlConfigFromEnv(),
+	}
+
+	if workers, err := strconv.Atoi(os.Getenv("INGESTION_WORKERS")); err == nil && workers > 0 {
+		cfg.Workers = workers
+	}
+	if size, err := strconv.Atoi(os.Getenv("INGESTION_QUEUE_SIZE")); err == nil && size > 0 {
+		cfg.QueueSize = size
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("INGESTION_JOB_TIMEOUT")); err == nil && timeout >= 0 {
+		cfg.Timeout = timeout
+	}
+
+	return cfg
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// step is a single script run within a pipeline.
+type step struct {
+	name   string
+	script string
+	// collection receives the documents the script emits; empty for clone steps.
+	collection string
+}
+
+// steps returns the scripts run for a job type, in order.
+func (c Config) steps(jobType string) []step {
+	switch jobType {
+	case JobTypeCloneRepos:
+		return []step{
+			{name: "clone code samples", script: c.CloneReposScript},
+			{name: "clone documentation", script: c.CloneDocsScript},
+		}
+	case JobTypeIngestSamples:
+		return []step{{name: "ingest code samples", script: c.IngestSamplesScript, collection: rag.CodeCollection}}
+	case JobTypeIngestDocs:
+		return []step{{name: "ingest documentation", script: c.IngestDocsScript, collection: rag.DocsCollection}}
+	default:
+		return nil
+	}
+}
+
+// progressEvent is a newline-delimited JSON message written by the ingestion scripts.
+// "document" events carry a chunk to store when the scripts run with INGEST_SINK=stdout.
+type progressEvent struct {
+	Type     string         `json:"type"`
+	Current  int            `json:"current"`
+	Total    int            `json:"total"`
+	Message  string         `json:"message"`
+	ID       string         `json:"id"`
+	Content  string         `json:"content"`
+	Metadata map[string]any `json:"metadata"`
+}
+
+// Run executes the pipeline of a job type synchronously without recording a job.
+// onProgress, when non-nil, receives the overall progress percentage and message.
+func Run(ctx context.Context, cfg Config, jobType string, onProgress func(progress, processed, total int, message string)) error {
+	if cfg.PythonExecutable == "" {
+		cfg.PythonExecutable = "python3"
+	}
+	if onProgress == nil {
+		onProgress = func(int, int, int, string) {}
+	}
+	chunking, err := ChunkOptions{}.resolve(cfg.Chunking)
+	if err != nil {
+		return err
+	}
+	return runPipeline(ctx, cfg, cfg.steps(jobType), chunking, onProgress)
+}
+
+// runPipeline runs each script of the pipeline in turn, spreading overall progress evenly
+// across steps. Emitted Clarity contracts are split with chunking.
+func runPipeline(ctx context.Context, cfg Config, steps []step, chunking ChunkOptions, onProgress func(progress, processed, total int, message string)) error {
+	if len(steps) == 0 {
+		return ErrUnknownJobType
+	}
+
+	for i, s := range steps {
+		var (
+			processed, total int
+			sink             *documentSink
+		)
+		if cfg.Indexer != nil && s.collection != "" {
+			sink = &documentSink{indexer: cfg.Indexer, collection: s.collection, chunking: chunking}
+		}
+
+		err := runScript(ctx, cfg.PythonExecutable, s, sink != nil, func(event progressEvent) error {
+			if event.Type == "document" {
+				if sink == nil {
+					return nil
+				}
+				return sink.add(ctx, event)
+			}
+			if event.Type != "progress" && event.Type != "start" && event.Type != "complete" {
+				return nil
+			}
+			// Completion events do not always repeat the item counts.
+			if event.Total > 0 {
+				processed, total = event.Current, event.Total
+			}
+			if event.Type == "complete" {
+				processed = total
+			}
+
+			stepPercent := 0
+			if event.Type == "complete" {
+				stepPercent = 100
+			} else if event.Total > 0 {
+				stepPercent = event.Current * 100 / event.Total
+			}
+
+			message := s.name
+			if event.Message != "" {
+				message += ": " + event.Message
+			}
+			onProgress((i*100+stepPercent)/len(steps), processed, total, message)
+			return nil
+		})
+		if err == nil && sink != nil {
+			err = sink.flush(ctx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// documentSink batches emitted documents into the vector store.
+type documentSink struct {
+	indexer    *rag.Indexer
+	collection string
+	// chunking splits emitted Clarity contracts, which the scripts emit whole.
+	chunking ChunkOptions
+	pending  []rag.Document
+}
+
+// add stores an emitted document. Clarity contracts are split into chunks; the first keeps
+// the document's ID so re-ingesting a contract overwrites it in place.
+func (d *documentSink) add(ctx context.Context, event progressEvent) error {
+	if event.ID == "" || strings.TrimSpace(event.Content) == "" {
+		return nil
+	}
+	fileType, _ := event.Metadata["file_type"].(string)
+	if fileType != "clarity" || d.chunking.MaxChars <= 0 {
+		return d.addDocument(ctx, rag.Document{ID: event.ID, Content: event.Content, Metadata: event.Metadata})
+	}
+
+	filename, _ := event.Metadata["filename"].(string)
+	chunks := chunkClarity(event.Content, d.chunking)
+	for i, chunk := range chunks {
+		metadata := maps.Clone(event.Metadata)
+		metadata["chunk_index"] = i
+		metadata["chunk_count"] = len(chunks)
+		chunk.annotate(metadata, contractName(filename))
+
+		id := event.ID
+		if i > 0 {
+			id = fmt.Sprintf("%s_%d", event.ID, i)
+		}
+		if err := d.addDocument(ctx, rag.Document{ID: id, Content: chunk.Content, Metadata: metadata}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *documentSink) addDocument(ctx context.Context, doc rag.Document) error {
+	d.pending = append(d.pending, doc)
+	if len(d.pending) < indexBatchSize {
+		return nil
+	}
+	return d.flush(ctx)
+}
+
+func (d *documentSink) flush(ctx context.Context) error {
+	if len(d.pending) == 0 {
+		return nil
+	}
+	err := d.indexer.Index(ctx, d.collection, d.pending)
+	d.pending = d.pending[:0]
+	return err
+}
+
+// runScript executes a pipeline script, reporting each event it prints to stdout. With
+// emitDocuments the script writes its documents to stdout instead of ChromaDB. An error
+// from report stops the script.
+func runScript(ctx context.Context, python string, s step, emitDocuments bool, report func(progressEvent) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, python, s.script)
+	cmd.Env = os.Environ()
+	if emitDocuments {
+		cmd.Env = append(cmd.Env, "INGEST_SINK=stdout")
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.name, err)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &limitedWriter{buf: &stderr, limit: maxStderrBytes}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s: failed to start %s: %w", s.name, s.script, err)
+	}
+
+	var (
+		scriptErr string
+		reportErr error
+	)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxEventBytes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var event progressEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil || event.Type == "" {
+			log.Printf("ingestion: %s: %s", s.name, line)
+			continue
+		}
+		if event.Type == "error" {
+			scriptErr = event.Message
+		}
+		if reportErr = report(event); reportErr != nil {
+			cancel()
+			break
+		}
+	}
+	// Drain anything left so the process is not blocked on a full pipe.
+	_, _ = io.Copy(io.Discard, stdout)
+
+	waitErr := cmd.Wait()
+	if reportErr != nil {
+		return fmt.Errorf("%s: %w", s.name, reportErr)
+	}
+	if err := scanner.Err(); err != nil && waitErr == nil {
+		return fmt.Errorf("%s: read script output: %w", s.name, err)
+	}
+	if err := waitErr; err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if scriptErr == "" {
+			scriptErr = lastErrorMessage(stderr.String())
+		}
+		if scriptErr != "" {
+			return fmt.Errorf("%s failed: %s", s.name, scriptErr)
+		}
+		return fmt.Errorf("%s failed: %w", s.name, err)
+	}
+	return nil
+}
+
+// lastErrorMessage extracts the message of the last JSON error event the script wrote to
+// stderr, falling back to the raw stderr tail.
+func lastErrorMessage(stderr string) string {
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		var event progressEvent
+		if err := json.Unmarshal([]byte(lines[i]), &event); err == nil && event.Message != "" {
+			return event.Message
+		}
+	}
+	text := strings.TrimSpace(stderr)
+	if len(text) > 500 {
+		text = text[len(text)-500:]
+	}
+	return text
+}
+
+// limitedWriter keeps only the last limit bytes written to it.
+type limitedWriter struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	if over := w.buf.Len() - w.limit; over > 0 {
+		w.buf.Next(over)
+	}
+	return len(p), nil
+}
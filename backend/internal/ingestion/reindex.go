@@ -0,0 +1,314 @@
+package ingestion
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// Reindex modes: how a reindex job fills the new collections.
+const (
+	// ReindexModeIngest runs the collection's ingest script again, as ingest_samples and
+	// ingest_docs jobs do.
+	ReindexModeIngest = "ingest"
+	// ReindexModeReembed embeds the active collection's documents again, e.g. after
+	// EMBEDDING_MODEL changed. It keeps documents ingested from repositories and crawls.
+	ReindexModeReembed = "reembed"
+)
+
+const (
+	defaultReindexMinRatio = 0.9
+	// aliasRefreshInterval is how often collection aliases switched by other server
+	// instances are picked up.
+	aliasRefreshInterval = time.Minute
+	// reindexDrainDelay is how long a replaced collection is kept after the switch, so every
+	// server instance picks up the new alias and in-flight searches finish first.
+	reindexDrainDelay = aliasRefreshInterval + 10*time.Second
+)
+
+// ErrInvalidReindex is returned for reindex requests with unknown collections or modes.
+var ErrInvalidReindex = errors.New("invalid reindex request")
+
+// ErrCollectionsBusy is returned when a reindex and a job writing to the collections would
+// overlap: writes to the active collections during a reindex would be lost in the switch.
+// It matches ErrJobActive.
+var ErrCollectionsBusy error = collectionsBusyError{}
+
+type collectionsBusyError struct{}
+
+func (collectionsBusyError) Error() string {
+	return "a vector store reindex cannot overlap other ingestion into the collections"
+}
+
+func (collectionsBusyError) Is(target error) bool {
+	return target == ErrJobActive
+}
+
+// collectionWriters lists the job types that write to the vector store collections.
+var collectionWriters = []string{JobTypeIngestSamples, JobTypeIngestDocs, JobTypeIngestRepo, JobTypeCrawlDocs, JobTypeReindex}
+
+// ReindexOptions selects what a reindex job rebuilds.
+type ReindexOptions struct {
+	// Collections are the collections to rebuild, by full name; all of them by default.
+	Collections []string `json:"collections"`
+	Mode        string   `json:"mode"`
+	// MinRatio is the share of the active collection's documents a rebuilt collection must
+	// hold before it is switched in; 0.9 by default.
+	MinRatio *float64        `json:"min_ratio"`
+	Results  []ReindexResult `json:"results,omitempty"`
+}
+
+// ReindexResult is how one collection fared in a reindex.
+type ReindexResult struct {
+	Collection string `json:"collection"`
+	// Previous is the physical collection that was active when the job started, and Target
+	// the one it built.
+	Previous          string `json:"previous"`
+	Target            string `json:"target"`
+	PreviousDocuments int    `json:"previous_documents"`
+	Documents         int    `json:"documents"`
+	Switched          bool   `json:"switched"`
+}
+
+// normalize resolves collection aliases such as "code" to full names and applies defaults.
+func (o ReindexOptions) normalize() (ReindexOptions, error) {
+	if o.Mode == "" {
+		o.Mode = ReindexModeIngest
+	}
+	if o.Mode != ReindexModeIngest && o.Mode != ReindexModeReembed {
+		return o, fmt.Errorf("%w: mode must be %s or %s", ErrInvalidReindex, ReindexModeIngest, ReindexModeReembed)
+	}
+	if o.MinRatio == nil {
+		ratio := defaultReindexMinRatio
+		o.MinRatio = &ratio
+	}
+	if ratio := *o.MinRatio; ratio < 0 || ratio > 1 || math.IsNaN(ratio) {
+		return o, fmt.Errorf("%w: min_ratio must be between 0 and 1", ErrInvalidReindex)
+	}
+
+	requested := o.Collections
+	if len(requested) == 0 {
+		requested = rag.Collections
+	}
+	seen := make(map[string]bool, len(requested))
+	o.Collections = nil
+	for _, name := range requested {
+		collection, ok := rag.CollectionName(name)
+		if !ok {
+			return o, fmt.Errorf("%w: unknown collection %q", ErrInvalidReindex, name)
+		}
+		if !seen[collection] {
+			seen[collection] = true
+			o.Collections = append(o.Collections, collection)
+		}
+	}
+	o.Results = nil
+	return o, nil
+}
+
+// Reindex queues a job that rebuilds collections beside the active ones and switches their
+// aliases once every rebuilt collection holds at least MinRatio of the documents of the one
+// it replaces. The job cannot overlap other ingestion into the collections.
+func (m *Manager) Reindex(ctx context.Context, opts ReindexOptions, requestedBy *int64) (*Job, error) {
+	if m.cfg.Indexer == nil {
+		return nil, ErrIndexerRequired
+	}
+	opts, err := opts.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	m.enqueueMu.Lock()
+	defer m.enqueueMu.Unlock()
+
+	active, err := m.repo.ActiveAny(ctx, collectionWriters...)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case active != nil && active.JobType == JobTypeReindex:
+		return active, ErrJobActive
+	case active != nil:
+		return active, ErrCollectionsBusy
+	}
+
+	return m.enqueue(ctx, &Job{JobType: JobTypeReindex, RequestedBy: requestedBy, Reindex: &opts})
+}
+
+// runReindex builds every selected collection under a new physical name, validates their
+// document counts, and switches all aliases together. Rebuilt collections are dropped when
+// any of them fails, and the replaced ones once searches have drained from them.
+func (m *Manager) runReindex(ctx context.Context, id int64, opts *ReindexOptions, chunking ChunkOptions) error {
+	if opts == nil {
+		return fmt.Errorf("job has no reindex options")
+	}
+	indexer := m.cfg.Indexer
+	if indexer == nil {
+		return ErrIndexerRequired
+	}
+
+	record := func() {
+		if err := m.repo.UpdateReindex(context.WithoutCancel(ctx), id, *opts); err != nil {
+			log.Printf("ingestion: failed to record reindex of job %d: %v", id, err)
+		}
+	}
+	dropTargets := func() {
+		for _, result := range opts.Results {
+			if err := indexer.Drop(context.WithoutCancel(ctx), result.Target); err != nil {
+				log.Printf("ingestion: failed to drop collection %s of job %d: %v", result.Target, id, err)
+			}
+		}
+	}
+
+	opts.Results = nil
+	for i, collection := range opts.Collections {
+		report := func(percent, processed, total int, message string) {
+			progress := (i*100 + percent) * 90 / (100 * len(opts.Collections))
+			if err := m.repo.UpdateProgress(ctx, id, progress, processed, total, collection+": "+message); err != nil {
+				log.Printf("ingestion: failed to record progress of job %d: %v", id, err)
+			}
+		}
+
+		result, err := m.rebuildCollection(ctx, id, collection, *opts, chunking, report)
+		opts.Results = append(opts.Results, result)
+		record()
+		if err != nil {
+			dropTargets()
+			return err
+		}
+	}
+
+	// A switch must not stop halfway, so finish even if the job is cancelled now.
+	ctx = context.WithoutCancel(ctx)
+	targets := make(map[string]string, len(opts.Results))
+	for _, result := range opts.Results {
+		targets[result.Collection] = result.Target
+	}
+	if err := m.repo.SwitchAliases(ctx, targets, id); err != nil {
+		dropTargets()
+		return err
+	}
+	for i := range opts.Results {
+		result := &opts.Results[i]
+		if err := rag.SetCollectionAlias(result.Collection, result.Target); err != nil {
+			return err
+		}
+		result.Switched = true
+		log.Printf("ingestion: job %d switched %s from %s to %s (%d documents)", id, result.Collection, result.Previous, result.Target, result.Documents)
+	}
+	record()
+
+	if err := m.repo.UpdateProgress(ctx, id, 95, 0, 0, "switched; dropping the previous collections"); err != nil {
+		log.Printf("ingestion: failed to record progress of job %d: %v", id, err)
+	}
+	time.Sleep(reindexDrainDelay)
+	switched := make([]string, 0, len(opts.Results))
+	for _, result := range opts.Results {
+		if err := indexer.Drop(ctx, result.Previous); err != nil {
+			log.Printf("ingestion: failed to drop previous collection %s of job %d: %v", result.Previous, id, err)
+		}
+		switched = append(switched, result.Collection+" to "+result.Target)
+	}
+	if err := m.repo.UpdateProgress(ctx, id, 100, 0, 0, "switched "+strings.Join(switched, ", ")); err != nil {
+		log.Printf("ingestion: failed to record progress of job %d: %v", id, err)
+	}
+	return nil
+}
+
+// rebuildCollection fills the job's physical collection for collection and checks its
+// document count against the active collection's.
+func (m *Manager) rebuildCollection(ctx context.Context, id int64, collection string, opts ReindexOptions, chunking ChunkOptions, report func(percent, processed, total int, message string)) (ReindexResult, error) {
+	indexer := m.cfg.Indexer
+	result := ReindexResult{
+		Collection: collection,
+		Previous:   rag.ActiveCollection(collection),
+		Target:     fmt.Sprintf("%s_r%d", collection, id),
+	}
+
+	previous, err := indexer.Describe(ctx, collection, 0)
+	if err != nil {
+		return result, err
+	}
+	result.PreviousDocuments = previous.Documents
+	// Clear anything left by an earlier attempt under the same name.
+	if err := indexer.Drop(ctx, result.Target); err != nil {
+		return result, err
+	}
+
+	switch opts.Mode {
+	case ReindexModeReembed:
+		_, err = indexer.Copy(ctx, collection, result.Target, func(copied int) {
+			report(min(copied*100/max(previous.Documents, 1), 100), copied, previous.Documents, "embedding documents")
+		})
+	default:
+		jobType := JobTypeIngestSamples
+		if collection == rag.DocsCollection {
+			jobType = JobTypeIngestDocs
+		}
+		steps := m.cfg.steps(jobType)
+		for i := range steps {
+			steps[i].collection = result.Target
+		}
+		err = runPipeline(ctx, m.cfg, steps, chunking, report)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	built, err := indexer.Describe(ctx, result.Target, 0)
+	if err != nil {
+		return result, err
+	}
+	result.Documents = built.Documents
+	minRatio := defaultReindexMinRatio
+	if opts.MinRatio != nil {
+		minRatio = *opts.MinRatio
+	}
+	required := int(math.Ceil(minRatio * float64(previous.Documents)))
+	switch {
+	case built.Documents == 0:
+		return result, fmt.Errorf("rebuilt %s is empty", collection)
+	case built.Documents < required:
+		return result, fmt.Errorf("rebuilt %s has %d documents, fewer than the %d required (%.0f%% of %d)", collection, built.Documents, required, minRatio*100, previous.Documents)
+	}
+	return result, nil
+}
+
+// LoadCollectionAliases points the collections at the physical collections recorded by the
+// last reindex, so retrieval and ingestion use them.
+func LoadCollectionAliases(ctx context.Context, db *sql.DB) error {
+	aliases, err := NewRepository(db).Aliases(ctx)
+	if err != nil {
+		return err
+	}
+	for collection, target := range aliases {
+		if err := rag.SetCollectionAlias(collection, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshAliases reloads the collection aliases every aliasRefreshInterval until ctx is
+// cancelled.
+func (m *Manager) refreshAliases(ctx context.Context) {
+	ticker := time.NewTicker(aliasRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := LoadCollectionAliases(ctx, m.repo.db); err != nil {
+				log.Printf("ingestion: failed to refresh vector store aliases: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package ingestion
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+const (
+	// maxRepoFiles bounds the files indexed from one repository, matching the sample
+	// ingestion script.
+	maxRepoFiles = 30000
+	// maxRepoFileBytes skips generated or vendored files too large to be useful context.
+	maxRepoFileBytes = 1 << 20
+	// maxRepoPatterns bounds the include and exclude globs of one source.
+	maxRepoPatterns = 20
+	// cloneProgress is the share of a repository job's progress spent cloning.
+	cloneProgress = 10
+)
+
+// ErrInvalidSource wraps validation failures of a repository source.
+var ErrInvalidSource = errors.New("invalid repository source")
+
+var (
+	repoNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,100}$`)
+	branchPattern   = regexp.MustCompile(`^[A-Za-z0-9._/-]{1,200}$`)
+)
+
+// defaultRepoInclude selects the Clarity contracts and project manifests of a repository.
+var defaultRepoInclude = []string{"**/*.clar", "**/Clarinet.toml"}
+
+// RepoSource is a git repository whose files are ingested into the code sample collection.
+type RepoSource struct {
+	URL string `json:"url"`
+	// Branch is cloned instead of the repository's default branch when set.
+	Branch string `json:"branch,omitempty"`
+	// Name is the repo metadata chunks are filtered by. It defaults to the last path
+	// segment of the URL.
+	Name string `json:"name,omitempty"`
+	// Include and Exclude are globs over repository-relative paths; "**" matches any number
+	// of directories. Include defaults to Clarity contracts and Clarinet.toml files.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// File restricts ingestion to one repository-relative file, overriding the globs.
+	File string `json:"file,omitempty"`
+	// Replace removes the chunks previously ingested for the repository, or for File, once
+	// the clone succeeds, so files deleted upstream disappear from the index.
+	Replace bool `json:"replace,omitempty"`
+}
+
+// normalize trims the source, fills in defaults and validates it.
+func (s RepoSource) normalize() (RepoSource, error) {
+	s.URL = strings.TrimSpace(s.URL)
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return s, fmt.Errorf("%w: url must be an http or https git URL", ErrInvalidSource)
+	}
+	if u.User != nil {
+		return s, fmt.Errorf("%w: credentials in the url are not supported", ErrInvalidSource)
+	}
+
+	s.Branch = strings.TrimSpace(s.Branch)
+	if s.Branch != "" && (!branchPattern.MatchString(s.Branch) || strings.HasPrefix(s.Branch, "-") || strings.Contains(s.Branch, "..")) {
+		return s, fmt.Errorf("%w: invalid branch %q", ErrInvalidSource, s.Branch)
+	}
+
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(path.Base(strings.TrimSuffix(u.Path, "/")), ".git")
+	}
+	if !repoNamePattern.MatchString(s.Name) || s.Name == "." || s.Name == ".." {
+		return s, fmt.Errorf("%w: name must be 1-100 letters, digits, dots, underscores or dashes", ErrInvalidSource)
+	}
+
+	if len(s.Include) == 0 {
+		s.Include = append([]string(nil), defaultRepoInclude...)
+	}
+	if len(s.Include)+len(s.Exclude) > maxRepoPatterns {
+		return s, fmt.Errorf("%w: at most %d include and exclude patterns are supported", ErrInvalidSource, maxRepoPatterns)
+	}
+	for _, pattern := range append(append([]string(nil), s.Include...), s.Exclude...) {
+		if !validGlob(pattern) {
+			return s, fmt.Errorf("%w: invalid glob %q", ErrInvalidSource, pattern)
+		}
+	}
+
+	if s.File != "" && (path.Clean(s.File) != s.File || path.IsAbs(s.File) || s.File == ".." || strings.HasPrefix(s.File, "../")) {
+		return s, fmt.Errorf("%w: file must be a clean repository-relative path", ErrInvalidSource)
+	}
+	return s, nil
+}
+
+// selector returns the indexed chunks the source replaces.
+func (s RepoSource) selector() rag.SourceSelector {
+	if s.File != "" {
+		return rag.SourceSelector{Kind: rag.SourceKindFile, Value: s.Name + "/" + s.File}
+	}
+	return rag.SourceSelector{Kind: rag.SourceKindRepo, Value: s.Name}
+}
+
+// matches reports whether a repository-relative path is selected by the source's globs.
+func (s RepoSource) matches(rel string) bool {
+	if s.File != "" {
+		return rel == s.File
+	}
+	included := false
+	for _, pattern := range s.Include {
+		if matchGlob(pattern, rel) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range s.Exclude {
+		if matchGlob(pattern, rel) {
+			return false
+		}
+	}
+	return true
+}
+
+func validGlob(pattern string) bool {
+	if pattern == "" || strings.HasPrefix(pattern, "/") {
+		return false
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment == "" {
+			return false
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// matchGlob matches a slash-separated path segment by segment with path.Match, where a
+// "**" segment matches zero or more directories.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ingestRepo clones the source into a temporary directory, chunks the matching files and
+// stores them in the code sample collection. Chunk IDs are derived from the URL and file
+// path, so ingesting a repository again updates its chunks in place.
+func ingestRepo(ctx context.Context, cfg Config, source RepoSource, chunking ChunkOptions, onProgress func(progress, processed, total int, message string)) error {
+	if cfg.Indexer == nil {
+		return ErrIndexerRequired
+	}
+
+	dir, err := os.MkdirTemp("", "ingest-repo-")
+	if err != nil {
+		return fmt.Errorf("create clone directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	onProgress(0, 0, 0, "cloning "+source.URL)
+	if err := cloneRepo(ctx, cfg.GitExecutable, source, dir); err != nil {
+		return err
+	}
+
+	files, projectDirs, err := repoFiles(dir, source)
+	if err != nil {
+		return err
+	}
+	// A single file that was deleted upstream is re-indexed by removing its chunks.
+	if len(files) == 0 && (source.File == "" || !source.Replace) {
+		if source.File != "" {
+			return fmt.Errorf("%s has no file %s", source.URL, source.File)
+		}
+		return fmt.Errorf("no files in %s match %s", source.URL, strings.Join(source.Include, ", "))
+	}
+
+	if source.Replace {
+		selector := source.selector()
+		deleted, err := cfg.Indexer.DeleteSource(ctx, rag.CodeCollection, selector)
+		if err != nil {
+			return err
+		}
+		log.Printf("ingestion: removed %d chunks of %s %s before re-indexing", deleted, selector.Kind, selector.Value)
+	}
+
+	sink := &documentSink{indexer: cfg.Indexer, collection: rag.CodeCollection}
+	chunks := 0
+	for i, rel := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		docs, err := repoFileDocuments(dir, rel, source, hasProject(rel, projectDirs), chunking)
+		if err != nil {
+			log.Printf("ingestion: skipping %s/%s: %v", source.Name, rel, err)
+		}
+		for _, doc := range docs {
+			if err := sink.addDocument(ctx, doc); err != nil {
+				return err
+			}
+		}
+		chunks += len(docs)
+
+		if (i+1)%10 == 0 || i+1 == len(files) {
+			progress := cloneProgress + (i+1)*(100-cloneProgress)/len(files)
+			onProgress(progress, i+1, len(files), fmt.Sprintf("indexed %d chunks from %s", chunks, source.Name))
+		}
+	}
+	return sink.flush(ctx)
+}
+
+// cloneRepo makes a shallow clone of the source branch into dir.
+func cloneRepo(ctx context.Context, git string, source RepoSource, dir string) error {
+	if git == "" {
+		git = "git"
+	}
+
+	// Only http(s) transports are allowed, so submodule or redirect tricks cannot reach
+	// local paths.
+	args := []string{
+		"-c", "protocol.allow=never",
+		"-c", "protocol.http.allow=always",
+		"-c", "protocol.https.allow=always",
+		"clone", "--depth", "1", "--single-branch", "--no-tags",
+	}
+	if source.Branch != "" {
+		args = append(args, "--branch", source.Branch)
+	}
+	args = append(args, "--", source.URL, dir)
+
+	cmd := exec.CommandContext(ctx, git, args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_LFS_SKIP_SMUDGE=1")
+	var stderr bytes.Buffer
+	cmd.Stderr = &limitedWriter{buf: &stderr, limit: maxStderrBytes}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		if message := strings.TrimSpace(lines[len(lines)-1]); message != "" {
+			return fmt.Errorf("clone %s failed: %s", source.URL, message)
+		}
+		return fmt.Errorf("clone %s failed: %w", source.URL, err)
+	}
+	return nil
+}
+
+// repoFiles lists the regular files under dir selected by the source, as slash-separated
+// relative paths, along with the directories that contain a Clarinet.toml.
+func repoFiles(dir string, source RepoSource) ([]string, map[string]bool, error) {
+	var files []string
+	projectDirs := make(map[string]bool)
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Symlinks could point outside the clone.
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.Name() == "Clarinet.toml" {
+			projectDirs[path.Dir(rel)] = true
+		}
+		if source.matches(rel) && len(files) < maxRepoFiles {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("list repository files: %w", err)
+	}
+	if len(files) == maxRepoFiles {
+		log.Printf("ingestion: %s has more than %d matching files; the rest are skipped", source.URL, maxRepoFiles)
+	}
+	return files, projectDirs, nil
+}
+
+// hasProject reports whether the file sits in a Clarinet project, i.e. the directory or an
+// ancestor contains a Clarinet.toml.
+func hasProject(rel string, projectDirs map[string]bool) bool {
+	for dir := path.Dir(rel); ; dir = path.Dir(dir) {
+		if projectDirs[dir] {
+			return true
+		}
+		if dir == "." || dir == "/" {
+			return false
+		}
+	}
+}
+
+// repoFileDocuments reads a repository file and splits it into documents carrying the same
+// metadata the sample ingestion script writes, plus the contract and functions of Clarity
+// chunks. Binary, empty and oversized files yield none.
+func repoFileDocuments(dir, rel string, source RepoSource, hasToml bool, chunking ChunkOptions) ([]rag.Document, error) {
+	full := filepath.Join(dir, filepath.FromSlash(rel))
+	info, err := os.Stat(full)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxRepoFileBytes {
+		return nil, fmt.Errorf("larger than %d bytes", maxRepoFileBytes)
+	}
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return nil, fmt.Errorf("not a text file")
+	}
+	content := string(data)
+	if strings.TrimSpace(content) == "" {
+		return nil, nil
+	}
+
+	filename := path.Base(rel)
+	fileType := strings.TrimPrefix(path.Ext(filename), ".")
+	chunks := []Chunk{{Content: content}}
+	contract := ""
+	switch {
+	case strings.HasSuffix(filename, ".clar"):
+		fileType = "clarity"
+		chunks = chunkClarity(content, chunking)
+		contract = contractName(filename)
+	case filename == "Clarinet.toml":
+		fileType = "toml"
+	}
+
+	// Paths are prefixed with the repository name, as in the cloned samples directory.
+	relPath := source.Name + "/" + rel
+	sum := sha256.Sum256([]byte(source.URL + "\x00" + rel))
+
+	docs := make([]rag.Document, 0, len(chunks))
+	for i, chunk := range chunks {
+		metadata := map[string]any{
+			rag.MetadataRepo:      source.Name,
+			rag.MetadataRelPath:   relPath,
+			"folders":             path.Dir(relPath),
+			"filename":            filename,
+			"file_type":           fileType,
+			"has_toml":            hasToml,
+			rag.MetadataSourceURL: source.URL,
+			"chunk_index":         i,
+			"chunk_count":         len(chunks),
+		}
+		if source.Branch != "" {
+			metadata[rag.MetadataBranch] = source.Branch
+		}
+		chunk.annotate(metadata, contract)
+		docs = append(docs, rag.Document{
+			ID:       fmt.Sprintf("repo_%s_%x_%d", source.Name, sum[:8], i),
+			Content:  chunk.Content,
+			Metadata: metadata,
+		})
+	}
+	return docs, nil
+}
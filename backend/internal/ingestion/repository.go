@@ -0,0 +1,483 @@
+package ingestion
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an ingestion job cannot be located.
+var ErrNotFound = errors.New("ingestion job not found")
+
+// Repository persists ingestion job records.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository returns a repository backed by the supplied sql.DB handle.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// ListParams defines filters and pagination for listing jobs.
+type ListParams struct {
+	Page    int
+	Limit   int
+	Status  string
+	JobType string
+}
+
+const selectColumns = `
+	id, job_type, status, progress, total_items, processed_items, COALESCE(message, ''),
+	COALESCE(error_message, ''), requested_by, source, chunking, doc_source_id, reindex, started_at, completed_at,
+	created_at
+`
+
+// Create inserts a queued job and fills in its ID and creation time.
+func (r *Repository) Create(ctx context.Context, job *Job) error {
+	job.Status = StatusQueued
+	job.CreatedAt = time.Now().UTC()
+
+	var requestedBy, source, chunking, docSourceID, reindex any
+	if job.RequestedBy != nil {
+		requestedBy = *job.RequestedBy
+	}
+	if job.DocSourceID != nil {
+		docSourceID = *job.DocSourceID
+	}
+	if job.Source != nil {
+		data, err := json.Marshal(job.Source)
+		if err != nil {
+			return fmt.Errorf("encode ingestion job source: %w", err)
+		}
+		source = string(data)
+	}
+	if job.Chunking != nil {
+		data, err := json.Marshal(job.Chunking)
+		if err != nil {
+			return fmt.Errorf("encode ingestion job chunking: %w", err)
+		}
+		chunking = string(data)
+	}
+	if job.Reindex != nil {
+		data, err := json.Marshal(job.Reindex)
+		if err != nil {
+			return fmt.Errorf("encode ingestion job reindex options: %w", err)
+		}
+		reindex = string(data)
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO ingestion_jobs (job_type, status, requested_by, source, chunking, doc_source_id, reindex, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, job.JobType, job.Status, requestedBy, source, chunking, docSourceID, reindex, job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert ingestion job: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("fetch ingestion job id: %w", err)
+	}
+	job.ID = id
+	return nil
+}
+
+// Get returns a job by ID.
+func (r *Repository) Get(ctx context.Context, id int64) (*Job, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+selectColumns+` FROM ingestion_jobs WHERE id = ?`, id)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// List returns jobs matching the filters, newest first, and the total count.
+func (r *Repository) List(ctx context.Context, params ListParams) ([]Job, int64, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	page := params.Page
+	if page <= 0 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	whereParts := make([]string, 0, 2)
+	args := make([]any, 0, 4)
+	if params.Status != "" {
+		whereParts = append(whereParts, "status = ?")
+		args = append(args, params.Status)
+	}
+	if params.JobType != "" {
+		whereParts = append(whereParts, "job_type = ?")
+		args = append(args, params.JobType)
+	}
+
+	whereClause := ""
+	if len(whereParts) > 0 {
+		whereClause = "WHERE " + strings.Join(whereParts, " AND ")
+	}
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM ingestion_jobs `+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count ingestion jobs: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM ingestion_jobs
+		`+whereClause+`
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list ingestion jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, *job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("iterate ingestion jobs: %w", err)
+	}
+
+	return jobs, total, nil
+}
+
+// Active returns the queued or running job of the given type, if any.
+func (r *Repository) Active(ctx context.Context, jobType string) (*Job, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM ingestion_jobs
+		WHERE job_type = ? AND status IN (?, ?)
+		ORDER BY id
+		LIMIT 1
+	`, jobType, StatusQueued, StatusRunning)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// ActiveRepo returns the queued or running ingest_repo job for the repository branch, if any.
+func (r *Repository) ActiveRepo(ctx context.Context, url, branch string) (*Job, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM ingestion_jobs
+		WHERE job_type = ? AND status IN (?, ?)
+			AND json_extract(source, '$.url') = ? AND COALESCE(json_extract(source, '$.branch'), '') = ?
+		ORDER BY id
+		LIMIT 1
+	`, JobTypeIngestRepo, StatusQueued, StatusRunning, url, branch)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// ActiveDocCrawl returns the queued or running crawl_docs job of the documentation source,
+// if any.
+func (r *Repository) ActiveDocCrawl(ctx context.Context, sourceID int64) (*Job, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM ingestion_jobs
+		WHERE job_type = ? AND status IN (?, ?) AND doc_source_id = ?
+		ORDER BY id
+		LIMIT 1
+	`, JobTypeCrawlDocs, StatusQueued, StatusRunning, sourceID)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// ActiveAny returns the oldest queued or running job of any of the given types, if any.
+func (r *Repository) ActiveAny(ctx context.Context, jobTypes ...string) (*Job, error) {
+	if len(jobTypes) == 0 {
+		return nil, nil
+	}
+	args := []any{StatusQueued, StatusRunning}
+	for _, jobType := range jobTypes {
+		args = append(args, jobType)
+	}
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM ingestion_jobs
+		WHERE status IN (?, ?) AND job_type IN (?`+strings.Repeat(", ?", len(jobTypes)-1)+`)
+		ORDER BY id
+		LIMIT 1
+	`, args...)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// LatestRepo returns the most recent completed ingest_repo job for the repository name, if any.
+func (r *Repository) LatestRepo(ctx context.Context, name string) (*Job, error) {
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM ingestion_jobs
+		WHERE job_type = ? AND status = ? AND json_extract(source, '$.name') = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`, JobTypeIngestRepo, StatusCompleted, name)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// LastCompleted returns the most recently completed job of any of the given types, if any.
+func (r *Repository) LastCompleted(ctx context.Context, jobTypes ...string) (*Job, error) {
+	if len(jobTypes) == 0 {
+		return nil, nil
+	}
+	args := []any{StatusCompleted}
+	for _, jobType := range jobTypes {
+		args = append(args, jobType)
+	}
+	row := r.db.QueryRowContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM ingestion_jobs
+		WHERE status = ? AND job_type IN (?`+strings.Repeat(", ?", len(jobTypes)-1)+`)
+		ORDER BY completed_at DESC, id DESC
+		LIMIT 1
+	`, args...)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// UpdateReindex records the outcome of a running reindex job so far.
+func (r *Repository) UpdateReindex(ctx context.Context, id int64, opts ReindexOptions) error {
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return fmt.Errorf("encode ingestion job reindex options: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, `UPDATE ingestion_jobs SET reindex = ? WHERE id = ?`, string(data), id); err != nil {
+		return fmt.Errorf("update ingestion job reindex options: %w", err)
+	}
+	return nil
+}
+
+// Aliases returns the physical collection each aliased collection resolves to.
+func (r *Repository) Aliases(ctx context.Context) (map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT collection, target FROM vectorstore_aliases`)
+	if err != nil {
+		return nil, fmt.Errorf("list vector store aliases: %w", err)
+	}
+	defer rows.Close()
+
+	aliases := make(map[string]string)
+	for rows.Next() {
+		var collection, target string
+		if err := rows.Scan(&collection, &target); err != nil {
+			return nil, fmt.Errorf("scan vector store alias: %w", err)
+		}
+		aliases[collection] = target
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate vector store aliases: %w", err)
+	}
+	return aliases, nil
+}
+
+// SwitchAliases points every collection in targets at its new physical collection in one
+// transaction.
+func (r *Repository) SwitchAliases(ctx context.Context, targets map[string]string, jobID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin alias switch: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for collection, target := range targets {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO vectorstore_aliases (collection, target, job_id, updated_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT(collection) DO UPDATE SET target = excluded.target, job_id = excluded.job_id, updated_at = excluded.updated_at
+		`, collection, target, jobID, now)
+		if err != nil {
+			return fmt.Errorf("switch vector store alias of %s: %w", collection, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit alias switch: %w", err)
+	}
+	return nil
+}
+
+// MarkRunning moves a queued job to running. It reports false when the job is no longer queued,
+// e.g. because it was cancelled while waiting.
+func (r *Repository) MarkRunning(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE ingestion_jobs
+		SET status = ?, started_at = ?
+		WHERE id = ? AND status = ?
+	`, StatusRunning, time.Now().UTC(), id, StatusQueued)
+	if err != nil {
+		return false, fmt.Errorf("start ingestion job: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// UpdateProgress records the latest progress report of a running job.
+func (r *Repository) UpdateProgress(ctx context.Context, id int64, progress, processed, total int, message string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE ingestion_jobs
+		SET progress = ?, processed_items = ?, total_items = ?, message = ?
+		WHERE id = ? AND status = ?
+	`, progress, processed, total, message, id, StatusRunning)
+	if err != nil {
+		return fmt.Errorf("update ingestion job progress: %w", err)
+	}
+	return nil
+}
+
+// Finish moves a queued or running job to a terminal status.
+// It reports false when the job had already finished.
+func (r *Repository) Finish(ctx context.Context, id int64, status, errorMessage string) (bool, error) {
+	var errMsg any
+	if errorMessage != "" {
+		errMsg = errorMessage
+	}
+
+	progressUpdate := "progress"
+	if status == StatusCompleted {
+		progressUpdate = "100"
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE ingestion_jobs
+		SET status = ?, error_message = ?, completed_at = ?, progress = `+progressUpdate+`
+		WHERE id = ? AND status IN (?, ?)
+	`, status, errMsg, time.Now().UTC(), id, StatusQueued, StatusRunning)
+	if err != nil {
+		return false, fmt.Errorf("finish ingestion job: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// FailAbandoned marks jobs left queued or running by a previous process as failed.
+func (r *Repository) FailAbandoned(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE ingestion_jobs
+		SET status = ?, error_message = ?, completed_at = ?
+		WHERE status IN (?, ?)
+	`, StatusFailed, "interrupted by server restart", time.Now().UTC(), StatusQueued, StatusRunning)
+	if err != nil {
+		return 0, fmt.Errorf("fail abandoned ingestion jobs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row rowScanner) (*Job, error) {
+	var (
+		job         Job
+		requestedBy sql.NullInt64
+		source      sql.NullString
+		chunking    sql.NullString
+		docSourceID sql.NullInt64
+		reindex     sql.NullString
+		startedAt   sql.NullTime
+		completedAt sql.NullTime
+	)
+	err := row.Scan(
+		&job.ID,
+		&job.JobType,
+		&job.Status,
+		&job.Progress,
+		&job.TotalItems,
+		&job.ProcessedItems,
+		&job.Message,
+		&job.ErrorMessage,
+		&requestedBy,
+		&source,
+		&chunking,
+		&docSourceID,
+		&reindex,
+		&startedAt,
+		&completedAt,
+		&job.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan ingestion job: %w", err)
+	}
+
+	if requestedBy.Valid {
+		job.RequestedBy = &requestedBy.Int64
+	}
+	if source.Valid {
+		var repoSource RepoSource
+		if err := json.Unmarshal([]byte(source.String), &repoSource); err != nil {
+			return nil, fmt.Errorf("decode ingestion job source: %w", err)
+		}
+		job.Source = &repoSource
+	}
+	if chunking.Valid {
+		var opts ChunkOptions
+		if err := json.Unmarshal([]byte(chunking.String), &opts); err != nil {
+			return nil, fmt.Errorf("decode ingestion job chunking: %w", err)
+		}
+		job.Chunking = &opts
+	}
+	if docSourceID.Valid {
+		job.DocSourceID = &docSourceID.Int64
+	}
+	if reindex.Valid {
+		var opts ReindexOptions
+		if err := json.Unmarshal([]byte(reindex.String), &opts); err != nil {
+			return nil, fmt.Errorf("decode ingestion job reindex options: %w", err)
+		}
+		job.Reindex = &opts
+	}
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return &job, nil
+}
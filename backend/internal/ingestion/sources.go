@@ -0,0 +1,100 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// ErrNotReindexable is returned when a source was not ingested from a repository URL the
+// backend can clone again.
+var ErrNotReindexable = errors.New("source cannot be re-indexed")
+
+// collections returns the vector store collections the filter searches.
+func collections(filter rag.Filter) []string {
+	var names []string
+	if filter.IncludesCode() {
+		names = append(names, rag.CodeCollection)
+	}
+	if filter.IncludesDocs() {
+		names = append(names, rag.DocsCollection)
+	}
+	return names
+}
+
+// Sources lists the repositories indexed in the collections selected by filter, or the
+// files of one repository when repo is set.
+func (m *Manager) Sources(ctx context.Context, filter rag.Filter, repo string) ([]rag.IndexedSource, error) {
+	if m.cfg.Indexer == nil {
+		return nil, ErrIndexerRequired
+	}
+
+	sources := make([]rag.IndexedSource, 0)
+	for _, collection := range collections(filter) {
+		found, err := m.cfg.Indexer.Sources(ctx, collection, repo)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, found...)
+	}
+	return sources, nil
+}
+
+// DeleteSource removes the chunks matching the selector from the collections selected by
+// filter and returns how many were removed.
+func (m *Manager) DeleteSource(ctx context.Context, filter rag.Filter, selector rag.SourceSelector) (int, error) {
+	if m.cfg.Indexer == nil {
+		return 0, ErrIndexerRequired
+	}
+
+	deleted := 0
+	for _, collection := range collections(filter) {
+		n, err := m.cfg.Indexer.DeleteSource(ctx, collection, selector)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// ReindexSource queues an ingest_repo job that re-ingests a repository, or one of its files,
+// from the source and chunking of the repository's last completed ingest_repo job. The
+// source's existing chunks are replaced, so files deleted upstream are removed from the index.
+func (m *Manager) ReindexSource(ctx context.Context, selector rag.SourceSelector, requestedBy *int64) (*Job, error) {
+	if m.cfg.Indexer == nil {
+		return nil, ErrIndexerRequired
+	}
+	if err := selector.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSource, err)
+	}
+
+	var name, file string
+	switch selector.Kind {
+	case rag.SourceKindRepo:
+		name = selector.Value
+	case rag.SourceKindFile:
+		name, file, _ = strings.Cut(selector.Value, "/")
+		if file == "" {
+			return nil, fmt.Errorf("%w: file must be named by its repository and path", ErrInvalidSource)
+		}
+	default:
+		return nil, fmt.Errorf("%w: documentation pages are re-indexed with POST /api/v1/ingest/docs", ErrNotReindexable)
+	}
+
+	last, err := m.repo.LatestRepo(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if last == nil || last.Source == nil {
+		return nil, fmt.Errorf("%w: %s was not ingested through POST /api/v1/ingest/repos", ErrNotReindexable, name)
+	}
+
+	source := *last.Source
+	source.File = file
+	source.Replace = true
+	return m.EnqueueRepo(ctx, source, last.Chunking, requestedBy)
+}
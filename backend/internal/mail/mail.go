@@ -0,0 +1,145 @@
+// Package mail sends plain-text notification emails, such as budget alerts, over SMTP.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPort    = 587
+	defaultTimeout = 30 * time.Second
+)
+
+// ErrNotConfigured is returned when sending without SMTP_HOST and SMTP_FROM.
+var ErrNotConfigured = errors.New("SMTP is not configured")
+
+// Config holds the SMTP server used to send mail.
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// ConfigFromEnv reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Host:     strings.TrimSpace(os.Getenv("SMTP_HOST")),
+		Port:     defaultPort,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     strings.TrimSpace(os.Getenv("SMTP_FROM")),
+	}
+	if port, err := strconv.Atoi(os.Getenv("SMTP_PORT")); err == nil && port > 0 {
+		cfg.Port = port
+	}
+	return cfg
+}
+
+// Enabled reports whether a server and sender address are configured.
+func (c Config) Enabled() bool {
+	return c.Host != "" && c.From != ""
+}
+
+// Sender delivers mail through the configured SMTP server. Connections upgrade to TLS when
+// the server offers STARTTLS, and authenticate when a username is set.
+type Sender struct {
+	cfg Config
+}
+
+// NewSender returns a sender for cfg.
+func NewSender(cfg Config) *Sender {
+	if cfg.Port <= 0 {
+		cfg.Port = defaultPort
+	}
+	return &Sender{cfg: cfg}
+}
+
+// Enabled reports whether the sender can deliver mail.
+func (s *Sender) Enabled() bool {
+	return s != nil && s.cfg.Enabled()
+}
+
+// Send delivers a plain-text message to the recipients.
+func (s *Sender) Send(ctx context.Context, to []string, subject, body string) error {
+	if !s.Enabled() {
+		return ErrNotConfigured
+	}
+	if len(to) == 0 {
+		return errors.New("no recipients")
+	}
+
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := net.Dialer{Timeout: defaultTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return fmt.Errorf("authenticate: %w", err)
+		}
+	}
+	if err := client.Mail(s.cfg.From); err != nil {
+		return fmt.Errorf("set sender: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("add recipient %s: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("start message: %w", err)
+	}
+	if _, err := w.Write(buildMessage(s.cfg.From, to, subject, body)); err != nil {
+		return fmt.Errorf("write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildMessage formats the headers and body of a plain-text message.
+func buildMessage(from string, to []string, subject, body string) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	b.WriteString("Subject: " + strings.NewReplacer("\r", "", "\n", " ").Replace(subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().UTC().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
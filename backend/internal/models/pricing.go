@@ -0,0 +1,82 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Price is a per-token price override in USD per thousand tokens.
+type Price struct {
+	InputPer1K  float64 `json:"input_per_1k"`
+	OutputPer1K float64 `json:"output_per_1k"`
+}
+
+var (
+	priceOverridesMu sync.RWMutex
+	priceOverrides   map[string]Price
+)
+
+// PriceOverridesFromEnv parses MODEL_PRICES, a comma-separated list of
+// "<model or provider>=<input>/<output>" prices in USD per thousand tokens, e.g.
+// "gpt-4o=0.0025/0.01,claude=0.003/0.015". Model entries override the registry's price
+// for that model; provider entries price the provider's models the registry does not know.
+func PriceOverridesFromEnv() (map[string]Price, error) {
+	overrides := make(map[string]Price)
+	for _, entry := range strings.Split(os.Getenv("MODEL_PRICES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		input, output, ok2 := strings.Cut(value, "/")
+		key = strings.TrimSpace(key)
+		if !ok || !ok2 || key == "" {
+			return nil, fmt.Errorf("MODEL_PRICES entry %q must be <model or provider>=<input>/<output>", entry)
+		}
+		in, err := strconv.ParseFloat(strings.TrimSpace(input), 64)
+		if err != nil || in < 0 {
+			return nil, fmt.Errorf("MODEL_PRICES entry %q: invalid input price", entry)
+		}
+		out, err := strconv.ParseFloat(strings.TrimSpace(output), 64)
+		if err != nil || out < 0 {
+			return nil, fmt.Errorf("MODEL_PRICES entry %q: invalid output price", entry)
+		}
+		overrides[key] = Price{InputPer1K: in, OutputPer1K: out}
+	}
+	return overrides, nil
+}
+
+// SetPriceOverrides replaces the process-wide price overrides.
+func SetPriceOverrides(overrides map[string]Price) {
+	priceOverridesMu.Lock()
+	defer priceOverridesMu.Unlock()
+	priceOverrides = overrides
+}
+
+// EstimateCost returns the estimated USD cost of a request to model, served by provider.
+// The price is taken from a MODEL_PRICES entry for the model, then the registry, then a
+// MODEL_PRICES entry for the provider; models without any price cost nothing.
+func EstimateCost(provider, model string, inputTokens, outputTokens int) float64 {
+	priceOverridesMu.RLock()
+	modelPrice, hasModelPrice := priceOverrides[model]
+	providerPrice, hasProviderPrice := priceOverrides[strings.ToLower(provider)]
+	priceOverridesMu.RUnlock()
+
+	if model != "" && hasModelPrice {
+		return modelPrice.cost(inputTokens, outputTokens)
+	}
+	if m, ok := Lookup(model); ok {
+		return m.EstimateCost(inputTokens, outputTokens)
+	}
+	if provider != "" && hasProviderPrice {
+		return providerPrice.cost(inputTokens, outputTokens)
+	}
+	return 0
+}
+
+func (p Price) cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*p.InputPer1K + float64(outputTokens)*p.OutputPer1K) / 1000
+}
@@ -0,0 +1,293 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const deprecationDateLayout = "2006-01-02"
+
+// Model describes the capabilities and pricing of a supported model.
+type Model struct {
+	ID                string `json:"id"`
+	Provider          string `json:"provider"`
+	ContextWindow     int    `json:"context_window"`
+	MaxOutputTokens   int    `json:"max_output_tokens"`
+	SupportsStreaming bool   `json:"supports_streaming"`
+	SupportsTools     bool   `json:"supports_tools"`
+	// Prices are in USD per million tokens.
+	InputPricePerMillion  float64 `json:"input_price_per_million"`
+	OutputPricePerMillion float64 `json:"output_price_per_million"`
+	// DeprecationDate is the YYYY-MM-DD date after which the provider retires the model.
+	DeprecationDate string `json:"deprecation_date,omitempty"`
+}
+
+// EstimateCost returns the estimated USD cost of a request with the given token counts.
+func (m Model) EstimateCost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*m.InputPricePerMillion + float64(outputTokens)*m.OutputPricePerMillion) / 1_000_000
+}
+
+// Deprecated reports whether the model's deprecation date has passed at now.
+func (m Model) Deprecated(now time.Time) bool {
+	if m.DeprecationDate == "" {
+		return false
+	}
+	date, err := time.Parse(deprecationDateLayout, m.DeprecationDate)
+	if err != nil {
+		return false
+	}
+	return !now.Before(date)
+}
+
+func (m Model) validate() error {
+	if strings.TrimSpace(m.ID) == "" {
+		return fmt.Errorf("model id cannot be empty")
+	}
+	if m.ContextWindow < 0 || m.MaxOutputTokens < 0 {
+		return fmt.Errorf("model %s: token limits cannot be negative", m.ID)
+	}
+	if m.InputPricePerMillion < 0 || m.OutputPricePerMillion < 0 {
+		return fmt.Errorf("model %s: prices cannot be negative", m.ID)
+	}
+	if m.DeprecationDate != "" {
+		if _, err := time.Parse(deprecationDateLayout, m.DeprecationDate); err != nil {
+			return fmt.Errorf("model %s: deprecation_date must be YYYY-MM-DD", m.ID)
+		}
+	}
+	return nil
+}
+
+// builtinModels are the models known without any registry file.
+var builtinModels = []Model{
+	{
+		ID:                    "gemini-3-flash-preview",
+		Provider:              "gemini",
+		ContextWindow:         1_048_576,
+		MaxOutputTokens:       65_536,
+		SupportsStreaming:     true,
+		SupportsTools:         true,
+		InputPricePerMillion:  0.50,
+		OutputPricePerMillion: 3.00,
+	},
+	{
+		ID:                    "gpt-4o",
+		Provider:              "openai",
+		ContextWindow:         128_000,
+		MaxOutputTokens:       16_384,
+		SupportsStreaming:     true,
+		SupportsTools:         true,
+		InputPricePerMillion:  2.50,
+		OutputPricePerMillion: 10.00,
+	},
+	{
+		ID:                    "gpt-4o-mini",
+		Provider:              "openai",
+		ContextWindow:         128_000,
+		MaxOutputTokens:       16_384,
+		SupportsStreaming:     true,
+		SupportsTools:         true,
+		InputPricePerMillion:  0.15,
+		OutputPricePerMillion: 0.60,
+	},
+	{
+		ID:                    "claude-sonnet-4-5-20250514",
+		Provider:              "claude",
+		ContextWindow:         200_000,
+		MaxOutputTokens:       64_000,
+		SupportsStreaming:     true,
+		SupportsTools:         true,
+		InputPricePerMillion:  3.00,
+		OutputPricePerMillion: 15.00,
+	},
+}
+
+// registryFile is the on-disk format of MODEL_REGISTRY_FILE.
+type registryFile struct {
+	Models []Model `json:"models"`
+}
+
+// Registry holds model capabilities, combining built-in entries with an optional JSON file.
+type Registry struct {
+	mu       sync.RWMutex
+	path     string
+	models   map[string]Model
+	modTime  time.Time
+	loadedAt time.Time
+}
+
+// NewRegistry returns a registry seeded with the built-in models. When path is set,
+// entries from that file are merged on Reload, overriding built-ins with the same id.
+func NewRegistry(path string) *Registry {
+	r := &Registry{path: path}
+	r.models = builtinIndex()
+	r.loadedAt = time.Now().UTC()
+	return r
+}
+
+func builtinIndex() map[string]Model {
+	index := make(map[string]Model, len(builtinModels))
+	for _, m := range builtinModels {
+		index[m.ID] = m
+	}
+	return index
+}
+
+// Reload rebuilds the registry from the built-ins and the registry file.
+// On error the previous contents are kept.
+func (r *Registry) Reload() error {
+	index := builtinIndex()
+	var modTime time.Time
+
+	if r.path != "" {
+		info, err := os.Stat(r.path)
+		if err != nil {
+			return fmt.Errorf("stat model registry: %w", err)
+		}
+		modTime = info.ModTime()
+
+		data, err := os.ReadFile(r.path)
+		if err != nil {
+			return fmt.Errorf("read model registry: %w", err)
+		}
+		var file registryFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return fmt.Errorf("parse model registry: %w", err)
+		}
+		for _, m := range file.Models {
+			if err := m.validate(); err != nil {
+				return err
+			}
+			m.Provider = strings.ToLower(m.Provider)
+			index[m.ID] = m
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.models = index
+	r.modTime = modTime
+	r.loadedAt = time.Now().UTC()
+	return nil
+}
+
+// Lookup returns the model with the given id.
+func (r *Registry) Lookup(id string) (Model, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.models[id]
+	return m, ok
+}
+
+// List returns all models sorted by provider and id.
+func (r *Registry) List() []Model {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]Model, 0, len(r.models))
+	for _, m := range r.models {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Provider != list[j].Provider {
+			return list[i].Provider < list[j].Provider
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// LoadedAt returns when the registry was last (re)loaded.
+func (r *Registry) LoadedAt() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.loadedAt
+}
+
+// Watch reloads the registry whenever the registry file changes, checking every interval,
+// until the context is cancelled. It is a no-op without a registry file.
+func (r *Registry) Watch(ctx context.Context, interval time.Duration) {
+	if r.path == "" || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			info, err := os.Stat(r.path)
+			if err != nil {
+				log.Printf("models: failed to stat registry file: %v", err)
+				continue
+			}
+
+			r.mu.RLock()
+			changed := !info.ModTime().Equal(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+
+			if err := r.Reload(); err != nil {
+				log.Printf("models: failed to reload registry: %v", err)
+				continue
+			}
+			log.Printf("models: reloaded registry from %s", r.path)
+		}
+	}()
+}
+
+var (
+	defaultRegistryMu sync.RWMutex
+	defaultRegistry   = NewRegistry("")
+)
+
+// Default returns the process-wide registry.
+func Default() *Registry {
+	defaultRegistryMu.RLock()
+	defer defaultRegistryMu.RUnlock()
+	return defaultRegistry
+}
+
+// SetDefault replaces the process-wide registry.
+func SetDefault(r *Registry) {
+	defaultRegistryMu.Lock()
+	defer defaultRegistryMu.Unlock()
+	defaultRegistry = r
+}
+
+// RegistryFromEnv builds a registry from MODEL_REGISTRY_FILE and loads it.
+func RegistryFromEnv() (*Registry, error) {
+	r := NewRegistry(os.Getenv("MODEL_REGISTRY_FILE"))
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// RefreshIntervalFromEnv returns MODEL_REGISTRY_REFRESH_INTERVAL, or zero when unset or invalid.
+func RefreshIntervalFromEnv() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("MODEL_REGISTRY_REFRESH_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return 0
+	}
+	return interval
+}
+
+// Lookup returns the model with the given id from the process-wide registry.
+func Lookup(id string) (Model, bool) {
+	return Default().Lookup(id)
+}
@@ -0,0 +1,269 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Actions taken on a moderated prompt.
+const (
+	ActionAllow = "allow"
+	ActionFlag  = "flag"
+	ActionBlock = "block"
+)
+
+// Verdicts recorded in query logs for prompts that were not simply allowed.
+const (
+	VerdictFlagged = "flagged"
+	VerdictBlocked = "blocked"
+)
+
+// RuleMaxLength names the check against Config.MaxPromptChars.
+const RuleMaxLength = "max_length"
+
+const (
+	defaultMaxPromptChars  = 32000
+	defaultProviderModel   = "omni-moderation-latest"
+	defaultProviderTimeout = 5 * time.Second
+)
+
+// Rule is a denylist pattern matched against prompts.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// builtinRules catch common attempts to extract the system prompt or the service's keys.
+var builtinRules = []Rule{
+	{
+		Name:    "instruction_override",
+		Pattern: regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b.{0,40}\b(previous|prior|above|earlier|system|original)\s+(instructions?|prompts?|rules|directions)\b`),
+	},
+	{
+		Name:    "system_prompt_exfiltration",
+		Pattern: regexp.MustCompile(`(?i)\b(reveal|print|show|repeat|output|leak|dump|display|tell me)\b.{0,40}\b(system|hidden|initial|original|developer)\s+(prompt|instructions?|message)\b`),
+	},
+	{
+		Name:    "secret_exfiltration",
+		Pattern: regexp.MustCompile(`(?i)\b(OPENAI|ANTHROPIC|CLAUDE|GEMINI|GOOGLE)_API_KEY\b|\b(JWT_SECRET|OAUTH_[A-Z_]*SECRET|GITHUB_CLIENT_SECRET|GOOGLE_CLIENT_SECRET)\b|\b(reveal|print|leak|dump)\b.{0,40}\b(your|the server'?s?|backend)\s+(api[ _-]?keys?|secrets?|credentials|environment variables)\b`),
+	},
+}
+
+// Config controls how chat and generation prompts are moderated.
+type Config struct {
+	Enabled bool
+	// Action is what denylist and provider matches do: ActionBlock rejects the request,
+	// ActionFlag lets it through and records the verdict.
+	Action string
+	// MaxPromptChars blocks prompts longer than this many characters; 0 disables the check.
+	MaxPromptChars int
+	// Rules are matched against every prompt.
+	Rules []Rule
+	// Provider is "openai" to also classify prompts with OpenAI's moderation API, or empty.
+	Provider string
+	// ProviderModel is the moderation model the provider uses.
+	ProviderModel string
+	// ProviderTimeout bounds the provider call; prompts are allowed when it fails.
+	ProviderTimeout time.Duration
+}
+
+// ConfigFromEnv reads MODERATION_ENABLED, MODERATION_ACTION, MODERATION_MAX_PROMPT_CHARS,
+// MODERATION_BUILTIN_RULES, MODERATION_DENYLIST_FILE, MODERATION_PROVIDER,
+// MODERATION_PROVIDER_MODEL and MODERATION_PROVIDER_TIMEOUT. Invalid denylist patterns
+// are logged and skipped.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Enabled:         true,
+		Action:          ActionBlock,
+		MaxPromptChars:  defaultMaxPromptChars,
+		Provider:        strings.ToLower(strings.TrimSpace(os.Getenv("MODERATION_PROVIDER"))),
+		ProviderModel:   strings.TrimSpace(os.Getenv("MODERATION_PROVIDER_MODEL")),
+		ProviderTimeout: defaultProviderTimeout,
+	}
+	if enabled, err := strconv.ParseBool(os.Getenv("MODERATION_ENABLED")); err == nil {
+		cfg.Enabled = enabled
+	}
+	if action := strings.ToLower(strings.TrimSpace(os.Getenv("MODERATION_ACTION"))); action == ActionFlag || action == ActionBlock {
+		cfg.Action = action
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("MODERATION_MAX_PROMPT_CHARS"))); err == nil && n >= 0 {
+		cfg.MaxPromptChars = n
+	}
+	if builtin, err := strconv.ParseBool(os.Getenv("MODERATION_BUILTIN_RULES")); err != nil || builtin {
+		cfg.Rules = append(cfg.Rules, builtinRules...)
+	}
+	if path := strings.TrimSpace(os.Getenv("MODERATION_DENYLIST_FILE")); path != "" {
+		rules, err := LoadDenylist(path)
+		if err != nil {
+			log.Printf("moderation: %v", err)
+		}
+		cfg.Rules = append(cfg.Rules, rules...)
+	}
+	if d, err := time.ParseDuration(os.Getenv("MODERATION_PROVIDER_TIMEOUT")); err == nil && d > 0 {
+		cfg.ProviderTimeout = d
+	}
+	return cfg
+}
+
+// LoadDenylist reads rules from a file with one "<name> <regexp>" per line. Blank lines and
+// lines starting with "#" are ignored. Lines that do not compile are skipped and reported in
+// the returned error alongside the rules that did.
+func LoadDenylist(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open denylist: %w", err)
+	}
+	defer file.Close()
+
+	var (
+		rules   []Rule
+		invalid []string
+		lineNo  int
+	)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, pattern, ok := strings.Cut(line, " ")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			invalid = append(invalid, fmt.Sprintf("line %d: expected \"<name> <regexp>\"", lineNo))
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("line %d: %v", lineNo, err))
+			continue
+		}
+		rules = append(rules, Rule{Name: name, Pattern: re})
+	}
+	if err := scanner.Err(); err != nil {
+		return rules, fmt.Errorf("read denylist: %w", err)
+	}
+	if len(invalid) > 0 {
+		return rules, fmt.Errorf("denylist %s: skipped %s", path, strings.Join(invalid, "; "))
+	}
+	return rules, nil
+}
+
+// Classifier reports which moderation categories a prompt is flagged for.
+type Classifier interface {
+	Classify(ctx context.Context, text string) ([]string, error)
+}
+
+// Verdict is the outcome of moderating a prompt.
+type Verdict struct {
+	// Action is ActionAllow, ActionFlag or ActionBlock.
+	Action string
+	// Rules names what matched: RuleMaxLength, denylist rule names, and provider categories
+	// prefixed with the provider, e.g. "openai:harassment".
+	Rules []string
+}
+
+// Recorded returns the verdict stored in query logs, or "" for allowed prompts.
+func (v Verdict) Recorded() string {
+	switch v.Action {
+	case ActionBlock:
+		return VerdictBlocked
+	case ActionFlag:
+		return VerdictFlagged
+	}
+	return ""
+}
+
+// Moderator checks prompts against the configured length limit, denylist and provider.
+type Moderator struct {
+	cfg        Config
+	classifier Classifier
+}
+
+// NewModerator returns a moderator. With Provider set to "openai" prompts are also sent to
+// OpenAI's moderation API using OPENAI_API_KEY and OPENAI_BASE_URL; an unknown provider or
+// a missing key is logged and prompts are checked without one.
+func NewModerator(cfg Config) *Moderator {
+	if cfg.Action != ActionFlag {
+		cfg.Action = ActionBlock
+	}
+	if cfg.ProviderTimeout <= 0 {
+		cfg.ProviderTimeout = defaultProviderTimeout
+	}
+	if cfg.ProviderModel == "" {
+		cfg.ProviderModel = defaultProviderModel
+	}
+
+	m := &Moderator{cfg: cfg}
+	switch cfg.Provider {
+	case "":
+	case ProviderOpenAI:
+		if apiKey := os.Getenv("OPENAI_API_KEY"); apiKey != "" {
+			m.classifier = NewOpenAIClassifier(apiKey, os.Getenv("OPENAI_BASE_URL"), cfg.ProviderModel)
+		} else {
+			log.Printf("moderation: provider %s requires OPENAI_API_KEY; checking prompts without it", cfg.Provider)
+		}
+	default:
+		log.Printf("moderation: unknown provider %q; checking prompts without it", cfg.Provider)
+	}
+	return m
+}
+
+// Enabled reports whether prompts are moderated.
+func (m *Moderator) Enabled() bool {
+	return m != nil && m.cfg.Enabled
+}
+
+// Check moderates a prompt. Overlong prompts are always blocked; denylist and provider
+// matches take the configured action. The provider is only asked when nothing else blocked
+// the prompt, and its failures are logged and ignored.
+func (m *Moderator) Check(ctx context.Context, prompt string) Verdict {
+	verdict := Verdict{Action: ActionAllow}
+	if !m.Enabled() || strings.TrimSpace(prompt) == "" {
+		return verdict
+	}
+
+	if m.cfg.MaxPromptChars > 0 && utf8.RuneCountInString(prompt) > m.cfg.MaxPromptChars {
+		return Verdict{Action: ActionBlock, Rules: []string{RuleMaxLength}}
+	}
+
+	for _, rule := range m.cfg.Rules {
+		if rule.Pattern.MatchString(prompt) {
+			verdict.Rules = append(verdict.Rules, rule.Name)
+		}
+	}
+	if len(verdict.Rules) > 0 {
+		verdict.Action = m.cfg.Action
+	}
+	if m.classifier == nil || verdict.Action == ActionBlock {
+		return verdict
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.cfg.ProviderTimeout)
+	defer cancel()
+	categories, err := m.classifier.Classify(ctx, prompt)
+	if err != nil {
+		log.Printf("moderation: %s classification failed, allowing prompt: %v", m.cfg.Provider, err)
+		return verdict
+	}
+	for _, category := range categories {
+		verdict.Rules = append(verdict.Rules, m.cfg.Provider+":"+category)
+	}
+	if len(categories) > 0 {
+		verdict.Action = m.cfg.Action
+	}
+	return verdict
+}
+
+// MaxPromptChars returns the configured prompt length limit; 0 means no limit.
+func (m *Moderator) MaxPromptChars() int {
+	return m.cfg.MaxPromptChars
+}
@@ -0,0 +1,58 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// ProviderOpenAI classifies prompts with OpenAI's moderation API.
+const ProviderOpenAI = "openai"
+
+// OpenAIClassifier classifies prompts with OpenAI's moderation API.
+type OpenAIClassifier struct {
+	client openai.Client
+	model  string
+}
+
+// NewOpenAIClassifier returns a classifier using model; baseURL may be empty.
+func NewOpenAIClassifier(apiKey, baseURL, model string) *OpenAIClassifier {
+	opts := []option.RequestOption{option.WithAPIKey(apiKey)}
+	if baseURL != "" {
+		opts = append(opts, option.WithBaseURL(baseURL))
+	}
+	return &OpenAIClassifier{client: openai.NewClient(opts...), model: model}
+}
+
+// Classify returns the categories, such as "harassment" or "violence", text is flagged for.
+func (c *OpenAIClassifier) Classify(ctx context.Context, text string) ([]string, error) {
+	resp, err := c.client.Moderations.New(ctx, openai.ModerationNewParams{
+		Input: openai.ModerationNewParamsInputUnion{OfString: openai.String(text)},
+		Model: openai.ModerationModel(c.model),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("openai moderation failed: %w", err)
+	}
+
+	var categories []string
+	for _, result := range resp.Results {
+		if !result.Flagged {
+			continue
+		}
+		var flags map[string]bool
+		if err := json.Unmarshal([]byte(result.Categories.RawJSON()), &flags); err != nil {
+			return nil, fmt.Errorf("decode openai moderation categories: %w", err)
+		}
+		for category, flagged := range flags {
+			if flagged {
+				categories = append(categories, category)
+			}
+		}
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
@@ -0,0 +1,50 @@
+package moderation
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// promptFields are the request fields holding user-written prompt text on the chat and
+// generation endpoints.
+var promptFields = []string{"query", "queries", "instructions", "contract", "customization", "messages"}
+
+// PromptText returns the prompt text of a chat or generation request body, one piece per
+// line: queries, instructions, contracts under test, template customizations, and the
+// content of every chat message, since earlier messages are sent to the model too. Bodies
+// that are not JSON objects are moderated as they are.
+func PromptText(body []byte) string {
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return string(body)
+	}
+
+	var parts []string
+	for _, name := range promptFields {
+		parts = appendText(parts, fields[name])
+	}
+	return strings.Join(parts, "\n")
+}
+
+// appendText collects the strings of a field: plain strings, arrays of strings, chat
+// messages and their content parts.
+func appendText(parts []string, value any) []string {
+	switch v := value.(type) {
+	case string:
+		if strings.TrimSpace(v) != "" {
+			parts = append(parts, v)
+		}
+	case []any:
+		for _, item := range v {
+			parts = appendText(parts, item)
+		}
+	case map[string]any:
+		if content, ok := v["content"]; ok {
+			return appendText(parts, content)
+		}
+		if text, ok := v["text"].(string); ok {
+			return appendText(parts, text)
+		}
+	}
+	return parts
+}
@@ -0,0 +1,36 @@
+// Package org manages organizations: teams whose members share API keys and a pooled
+// monthly token quota.
+package org
+
+import "time"
+
+// Membership roles. Owners manage members and keys; members can use and create keys.
+const (
+	RoleOwner  = "owner"
+	RoleMember = "member"
+)
+
+// ValidRole reports whether role is a known membership role.
+func ValidRole(role string) bool {
+	return role == RoleOwner || role == RoleMember
+}
+
+// Organization is a team account.
+type Organization struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// MonthlyTokenLimit is the pooled quota for the organization's keys; nil means unlimited.
+	MonthlyTokenLimit *int64    `json:"monthly_token_limit"`
+	CreatedBy         int64     `json:"created_by"`
+	CreatedAt         time.Time `json:"created_at"`
+	// Role is the requesting user's membership role, set when listing their organizations.
+	Role string `json:"role,omitempty"`
+}
+
+// Member is a user's membership in an organization.
+type Member struct {
+	UserID   int64     `json:"user_id"`
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
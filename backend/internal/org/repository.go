@@ -0,0 +1,240 @@
+package org
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when an organization cannot be located.
+	ErrNotFound = errors.New("organization not found")
+	// ErrNameTaken is returned when creating an organization with an existing name.
+	ErrNameTaken = errors.New("organization name already taken")
+	// ErrUserNotFound is returned when adding a member that does not exist.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrNotMember is returned when a user does not belong to the organization.
+	ErrNotMember = errors.New("user is not a member of the organization")
+	// ErrAlreadyMember is returned when adding a user who already belongs to the organization.
+	ErrAlreadyMember = errors.New("user is already a member of the organization")
+	// ErrLastOwner is returned when removing or demoting the organization's only owner.
+	ErrLastOwner = errors.New("an organization must keep at least one owner")
+)
+
+// Repository persists organizations and their memberships.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository returns a repository backed by the supplied sql.DB handle.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+// Create stores a new organization with ownerID as its first owner.
+func (r *Repository) Create(ctx context.Context, name string, ownerID int64) (*Organization, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM organizations WHERE name = ?)`, name).Scan(&taken); err != nil {
+		return nil, fmt.Errorf("query organization name: %w", err)
+	}
+	if taken {
+		return nil, ErrNameTaken
+	}
+
+	now := time.Now().UTC()
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO organizations (name, created_by, created_at) VALUES (?, ?, ?)
+	`, name, ownerID, now)
+	if err != nil {
+		return nil, fmt.Errorf("insert organization: %w", err)
+	}
+	orgID, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("fetch organization id: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO organization_members (org_id, user_id, role, created_at) VALUES (?, ?, ?, ?)
+	`, orgID, ownerID, RoleOwner, now); err != nil {
+		return nil, fmt.Errorf("insert owner: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &Organization{ID: orgID, Name: name, CreatedBy: ownerID, CreatedAt: now, Role: RoleOwner}, nil
+}
+
+// Get returns the organization with the id.
+func (r *Repository) Get(ctx context.Context, id int64) (*Organization, error) {
+	var (
+		org   Organization
+		limit sql.NullInt64
+	)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, name, monthly_token_limit, created_by, created_at FROM organizations WHERE id = ?
+	`, id).Scan(&org.ID, &org.Name, &limit, &org.CreatedBy, &org.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get organization: %w", err)
+	}
+	if limit.Valid {
+		org.MonthlyTokenLimit = &limit.Int64
+	}
+	return &org, nil
+}
+
+// ListForUser returns the organizations the user belongs to, with the user's role in each.
+func (r *Repository) ListForUser(ctx context.Context, userID int64) ([]Organization, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT o.id, o.name, o.monthly_token_limit, o.created_by, o.created_at, m.role
+		FROM organizations o
+		JOIN organization_members m ON m.org_id = o.id
+		WHERE m.user_id = ?
+		ORDER BY o.name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := make([]Organization, 0)
+	for rows.Next() {
+		var (
+			org   Organization
+			limit sql.NullInt64
+		)
+		if err := rows.Scan(&org.ID, &org.Name, &limit, &org.CreatedBy, &org.CreatedAt, &org.Role); err != nil {
+			return nil, fmt.Errorf("scan organization: %w", err)
+		}
+		if limit.Valid {
+			org.MonthlyTokenLimit = &limit.Int64
+		}
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate organizations: %w", err)
+	}
+	return orgs, nil
+}
+
+// MemberRole returns the user's role in the organization, or ErrNotMember.
+func (r *Repository) MemberRole(ctx context.Context, orgID, userID int64) (string, error) {
+	var role string
+	err := r.db.QueryRowContext(ctx, `
+		SELECT role FROM organization_members WHERE org_id = ? AND user_id = ?
+	`, orgID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("query membership: %w", err)
+	}
+	return role, nil
+}
+
+// Members returns the organization's members ordered by username.
+func (r *Repository) Members(ctx context.Context, orgID int64) ([]Member, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT m.user_id, u.username, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = ?
+		ORDER BY u.username
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list members: %w", err)
+	}
+	defer rows.Close()
+
+	members := make([]Member, 0)
+	for rows.Next() {
+		var member Member
+		if err := rows.Scan(&member.UserID, &member.Username, &member.Role, &member.JoinedAt); err != nil {
+			return nil, fmt.Errorf("scan member: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate members: %w", err)
+	}
+	return members, nil
+}
+
+// AddMember adds the user with the username to the organization with the role.
+func (r *Repository) AddMember(ctx context.Context, orgID int64, username, role string) (*Member, error) {
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("invalid role %q", role)
+	}
+
+	member := Member{Username: username, Role: role}
+	err := r.db.QueryRowContext(ctx, `SELECT id FROM users WHERE username = ? AND is_active = 1`, username).Scan(&member.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query user: %w", err)
+	}
+
+	if _, err := r.MemberRole(ctx, orgID, member.UserID); err == nil {
+		return nil, ErrAlreadyMember
+	} else if !errors.Is(err, ErrNotMember) {
+		return nil, err
+	}
+
+	member.JoinedAt = time.Now().UTC()
+	if _, err := r.db.ExecContext(ctx, `
+		INSERT INTO organization_members (org_id, user_id, role, created_at) VALUES (?, ?, ?, ?)
+	`, orgID, member.UserID, role, member.JoinedAt); err != nil {
+		return nil, fmt.Errorf("insert member: %w", err)
+	}
+	return &member, nil
+}
+
+// RemoveMember removes the user from the organization. The last owner cannot be removed.
+// Keys the user created stay with the organization.
+func (r *Repository) RemoveMember(ctx context.Context, orgID, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var role string
+	err = tx.QueryRowContext(ctx, `
+		SELECT role FROM organization_members WHERE org_id = ? AND user_id = ?
+	`, orgID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotMember
+	}
+	if err != nil {
+		return fmt.Errorf("query membership: %w", err)
+	}
+
+	if role == RoleOwner {
+		var owners int
+		if err := tx.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM organization_members WHERE org_id = ? AND role = ?
+		`, orgID, RoleOwner).Scan(&owners); err != nil {
+			return fmt.Errorf("count owners: %w", err)
+		}
+		if owners <= 1 {
+			return ErrLastOwner
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM organization_members WHERE org_id = ? AND user_id = ?`, orgID, userID); err != nil {
+		return fmt.Errorf("delete member: %w", err)
+	}
+	return tx.Commit()
+}
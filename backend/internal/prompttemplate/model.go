@@ -0,0 +1,57 @@
+package prompttemplate
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+// Where a template was loaded from.
+const (
+	SourceFile     = "file"
+	SourceDatabase = "database"
+)
+
+// ErrInvalid wraps validation failures of a template's name or body.
+var ErrInvalid = errors.New("invalid prompt template")
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Template is a named code generation prompt template written with text/template.
+// See codegen.PromptData for the variables it can use.
+type Template struct {
+	ID          int64     `json:"id,omitempty"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Body        string    `json:"template"`
+	Source      string    `json:"source"`
+	CreatedBy   *int64    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate checks the name and that the body parses and renders against sample data.
+func (t Template) Validate() error {
+	if !namePattern.MatchString(t.Name) {
+		return fmt.Errorf("%w: name must be 1-64 lowercase letters, digits, '-' or '_', starting with a letter or digit", ErrInvalid)
+	}
+	if _, err := codegen.ParsePromptTemplate(t.Name, t.Body); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return nil
+}
+
+// Parse returns the compiled template.
+func (t Template) Parse() (*template.Template, error) {
+	return codegen.ParsePromptTemplate(t.Name, t.Body)
+}
+
+// Version identifies this revision of the template, e.g. for cache keys.
+func (t Template) Version() string {
+	return t.Name + "@" + t.Source + ":" + strconv.FormatInt(t.UpdatedAt.UnixNano(), 10)
+}
@@ -0,0 +1,260 @@
+package prompttemplate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fileExtension marks template files in the templates directory.
+const fileExtension = ".tmpl"
+
+var (
+	// ErrNotFound is returned when no template has the requested name.
+	ErrNotFound = errors.New("prompt template not found")
+	// ErrExists is returned when creating a template whose name is already stored.
+	ErrExists = errors.New("prompt template already exists")
+	// ErrReadOnly is returned when modifying a template that only exists as a file.
+	ErrReadOnly = errors.New("prompt template is loaded from a file and cannot be modified")
+)
+
+// DirFromEnv returns PROMPT_TEMPLATES_DIR, the directory of file templates.
+func DirFromEnv() string {
+	return os.Getenv("PROMPT_TEMPLATES_DIR")
+}
+
+// Repository serves prompt templates from a directory of <name>.tmpl files and from the
+// prompt_templates table. A stored template overrides a file template with the same name,
+// and deleting it restores the file version. Files are re-read on every lookup so edits
+// take effect without a restart.
+type Repository struct {
+	db  *sql.DB
+	dir string
+}
+
+// NewRepository returns a repository backed by db and the template directory dir, which
+// may be empty.
+func NewRepository(db *sql.DB, dir string) *Repository {
+	return &Repository{db: db, dir: dir}
+}
+
+const selectColumns = `id, name, COALESCE(description, ''), template, created_by, created_at, updated_at`
+
+// List returns every template ordered by name.
+func (r *Repository) List(ctx context.Context) ([]Template, error) {
+	byName, err := r.fileTemplates()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT `+selectColumns+` FROM prompt_templates`)
+	if err != nil {
+		return nil, fmt.Errorf("list prompt templates: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tmpl, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		byName[tmpl.Name] = *tmpl
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate prompt templates: %w", err)
+	}
+
+	templates := make([]Template, 0, len(byName))
+	for _, tmpl := range byName {
+		templates = append(templates, tmpl)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// Get returns the template with the name, preferring the stored version over a file.
+func (r *Repository) Get(ctx context.Context, name string) (*Template, error) {
+	tmpl, err := r.getStored(ctx, name)
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return tmpl, err
+	}
+	return r.fileTemplate(name)
+}
+
+// Create stores a new template. Its name may shadow a file template.
+func (r *Repository) Create(ctx context.Context, tmpl *Template) error {
+	if err := tmpl.Validate(); err != nil {
+		return err
+	}
+	if _, err := r.getStored(ctx, tmpl.Name); err == nil {
+		return ErrExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO prompt_templates (name, description, template, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, tmpl.Name, tmpl.Description, tmpl.Body, tmpl.CreatedBy, now, now)
+	if err != nil {
+		return fmt.Errorf("insert prompt template: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("fetch prompt template id: %w", err)
+	}
+	tmpl.ID = id
+	tmpl.Source = SourceDatabase
+	tmpl.CreatedAt = now
+	tmpl.UpdatedAt = now
+	return nil
+}
+
+// Update replaces the description and body of a stored template, matched by name.
+func (r *Repository) Update(ctx context.Context, tmpl *Template) error {
+	if err := tmpl.Validate(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE prompt_templates SET description = ?, template = ?, updated_at = ? WHERE name = ?
+	`, tmpl.Description, tmpl.Body, now, tmpl.Name)
+	if err != nil {
+		return fmt.Errorf("update prompt template: %w", err)
+	}
+	if err := r.requireAffected(res, tmpl.Name); err != nil {
+		return err
+	}
+
+	updated, err := r.getStored(ctx, tmpl.Name)
+	if err != nil {
+		return err
+	}
+	*tmpl = *updated
+	return nil
+}
+
+// Delete removes a stored template.
+func (r *Repository) Delete(ctx context.Context, name string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM prompt_templates WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("delete prompt template: %w", err)
+	}
+	return r.requireAffected(res, name)
+}
+
+// requireAffected maps a statement that touched no rows to ErrReadOnly for file templates
+// and ErrNotFound otherwise.
+func (r *Repository) requireAffected(res sql.Result, name string) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected > 0 {
+		return nil
+	}
+	if _, err := r.fileTemplate(name); err == nil {
+		return ErrReadOnly
+	}
+	return ErrNotFound
+}
+
+func (r *Repository) getStored(ctx context.Context, name string) (*Template, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+selectColumns+` FROM prompt_templates WHERE name = ?`, name)
+	tmpl, err := scanTemplate(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return tmpl, err
+}
+
+func (r *Repository) fileTemplate(name string) (*Template, error) {
+	if r.dir == "" || !namePattern.MatchString(name) {
+		return nil, ErrNotFound
+	}
+	tmpl, err := readTemplateFile(filepath.Join(r.dir, name+fileExtension))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return tmpl, err
+}
+
+func (r *Repository) fileTemplates() (map[string]Template, error) {
+	templates := make(map[string]Template)
+	if r.dir == "" {
+		return templates, nil
+	}
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return templates, nil
+		}
+		return nil, fmt.Errorf("read prompt templates dir: %w", err)
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), fileExtension)
+		if entry.IsDir() || !ok || !namePattern.MatchString(name) {
+			continue
+		}
+		tmpl, err := readTemplateFile(filepath.Join(r.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = *tmpl
+	}
+	return templates, nil
+}
+
+func readTemplateFile(path string) (*Template, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read prompt template: %w", err)
+	}
+
+	modified := info.ModTime().UTC()
+	return &Template{
+		Name:      strings.TrimSuffix(filepath.Base(path), fileExtension),
+		Body:      string(data),
+		Source:    SourceFile,
+		CreatedAt: modified,
+		UpdatedAt: modified,
+	}, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTemplate(row rowScanner) (*Template, error) {
+	var (
+		tmpl      Template
+		createdBy sql.NullInt64
+	)
+	err := row.Scan(&tmpl.ID, &tmpl.Name, &tmpl.Description, &tmpl.Body, &createdBy, &tmpl.CreatedAt, &tmpl.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan prompt template: %w", err)
+	}
+
+	tmpl.Source = SourceDatabase
+	if createdBy.Valid {
+		tmpl.CreatedBy = &createdBy.Int64
+	}
+	return &tmpl, nil
+}
@@ -0,0 +1,531 @@
+package querylog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+)
+
+const (
+	defaultArchiveInterval = 24 * time.Hour
+	// minArchiveAfterDays keeps the current calendar month in the database, since monthly
+	// quotas and spend budgets are computed from it.
+	minArchiveAfterDays = 32
+	// archiveBatchSize is how many entries are read, deleted or restored per statement.
+	archiveBatchSize  = 500
+	archiveTimeFormat = "20060102T150405Z"
+)
+
+// archiveName matches archive files: the month they cover and when they were written.
+var archiveName = regexp.MustCompile(`^query_logs-\d{4}-\d{2}-\d{8}T\d{6}Z\.ndjson\.gz$`)
+
+var (
+	// ErrArchiveDisabled is returned when no archive age is configured.
+	ErrArchiveDisabled = errors.New("query log archiving is not configured")
+	// ErrArchiveInProgress is returned while another archive or restore is running.
+	ErrArchiveInProgress = errors.New("a query log archive or restore is already in progress")
+	// ErrArchiveNotFound is returned for unknown or malformed archive names.
+	ErrArchiveNotFound = errors.New("archive not found")
+)
+
+// ArchiveConfig controls when query logs are moved out of the database and where to.
+type ArchiveConfig struct {
+	// Dir holds the archive files.
+	Dir string
+	// AfterDays is the age in days past which entries are archived. Zero disables archiving.
+	AfterDays int
+	// Interval is how often the archive job runs.
+	Interval time.Duration
+}
+
+// ArchiveConfigFromEnv reads QUERY_LOG_ARCHIVE_AFTER_DAYS, QUERY_LOG_ARCHIVE_DIR and
+// QUERY_LOG_ARCHIVE_INTERVAL. The directory defaults to query_log_archives next to
+// DATABASE_PATH. Ages below 32 days are raised to 32 so the current month stays in the
+// database; invalid values are ignored.
+func ArchiveConfigFromEnv() ArchiveConfig {
+	dbPath := os.Getenv("DATABASE_PATH")
+	if dbPath == "" {
+		dbPath = "./data/clarity_coder.db"
+	}
+	cfg := ArchiveConfig{
+		Dir:      filepath.Join(filepath.Dir(dbPath), "query_log_archives"),
+		Interval: defaultArchiveInterval,
+	}
+	if dir := strings.TrimSpace(os.Getenv("QUERY_LOG_ARCHIVE_DIR")); dir != "" {
+		cfg.Dir = dir
+	}
+	if days, err := strconv.Atoi(os.Getenv("QUERY_LOG_ARCHIVE_AFTER_DAYS")); err == nil && days > 0 {
+		if days < minArchiveAfterDays {
+			log.Printf("querylog: raising QUERY_LOG_ARCHIVE_AFTER_DAYS from %d to %d", days, minArchiveAfterDays)
+			days = minArchiveAfterDays
+		}
+		cfg.AfterDays = days
+	}
+	if interval, err := time.ParseDuration(os.Getenv("QUERY_LOG_ARCHIVE_INTERVAL")); err == nil && interval > 0 {
+		cfg.Interval = interval
+	}
+	return cfg
+}
+
+// Enabled reports whether entries are archived.
+func (c ArchiveConfig) Enabled() bool {
+	return c.AfterDays > 0 && c.Dir != ""
+}
+
+// Archive is a gzip-compressed NDJSON file of query logs from one UTC calendar month.
+// A month archived over several runs has one file per run.
+type Archive struct {
+	Name    string `json:"name"`
+	Month   string `json:"month"`
+	Entries int64  `json:"entries"`
+	Size    int64  `json:"size"`
+	// FirstCreatedAt and LastCreatedAt bound the created_at of the archived entries.
+	FirstCreatedAt time.Time `json:"first_created_at"`
+	LastCreatedAt  time.Time `json:"last_created_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Archiver moves old query logs from the database into archive files and back. Only one
+// archive or restore runs at a time.
+type Archiver struct {
+	db      *sql.DB
+	writer  *database.Writer
+	cfg     ArchiveConfig
+	running sync.Mutex
+}
+
+// NewArchiver returns an archiver for the query logs in db.
+func NewArchiver(db *sql.DB, cfg ArchiveConfig) *Archiver {
+	return &Archiver{db: db, writer: database.WriterFor(db), cfg: cfg}
+}
+
+// Config returns the archiver's configuration.
+func (a *Archiver) Config() ArchiveConfig {
+	return a.cfg
+}
+
+// Start archives old entries every Interval in the background until the context is
+// cancelled. It does nothing when archiving is disabled.
+func (a *Archiver) Start(ctx context.Context) {
+	if !a.cfg.Enabled() || a.cfg.Interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(a.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			archives, err := a.Run(ctx)
+			if err != nil {
+				log.Printf("querylog: scheduled archive failed: %v", err)
+				continue
+			}
+			for _, archive := range archives {
+				log.Printf("querylog: archived %d entries from %s to %s", archive.Entries, archive.Month, archive.Name)
+			}
+		}
+	}()
+}
+
+// Run archives every entry older than AfterDays, writing one file per calendar month, and
+// deletes the archived entries from the database. Months archived before a failure keep
+// their files.
+func (a *Archiver) Run(ctx context.Context) ([]Archive, error) {
+	if !a.cfg.Enabled() {
+		return nil, ErrArchiveDisabled
+	}
+	if !a.running.TryLock() {
+		return nil, ErrArchiveInProgress
+	}
+	defer a.running.Unlock()
+
+	if err := os.MkdirAll(a.cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create archive directory: %w", err)
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -a.cfg.AfterDays)
+	archives := []Archive{}
+	var oldest time.Time
+	err := a.db.QueryRowContext(ctx, `SELECT created_at FROM query_logs WHERE created_at < ? ORDER BY created_at LIMIT 1`, cutoff).Scan(&oldest)
+	if errors.Is(err, sql.ErrNoRows) {
+		return archives, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find oldest query log: %w", err)
+	}
+
+	runAt := time.Now().UTC()
+	oldest = oldest.UTC()
+	month := time.Date(oldest.Year(), oldest.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for month.Before(cutoff) {
+		end := month.AddDate(0, 1, 0)
+		if end.After(cutoff) {
+			end = cutoff
+		}
+		archive, err := a.archiveRange(ctx, month, end, runAt)
+		if err != nil {
+			return archives, fmt.Errorf("archive %s: %w", month.Format("2006-01"), err)
+		}
+		if archive != nil {
+			archives = append(archives, *archive)
+		}
+		month = month.AddDate(0, 1, 0)
+	}
+	return archives, nil
+}
+
+// archiveRange writes the entries created in [start, end) to a new file, records it and
+// deletes them. It returns nil when there are none.
+func (a *Archiver) archiveRange(ctx context.Context, start, end, runAt time.Time) (*Archive, error) {
+	archive := &Archive{
+		Month:     start.Format("2006-01"),
+		CreatedAt: runAt,
+	}
+	archive.Name = "query_logs-" + archive.Month + "-" + runAt.Format(archiveTimeFormat) + ".ndjson.gz"
+	path := filepath.Join(a.cfg.Dir, archive.Name)
+	// Write under a temporary name so a partial archive is never listed.
+	tmp := path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("create archive: %w", err)
+	}
+	defer os.Remove(tmp)
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	encoder := json.NewEncoder(gz)
+	const query = `
+		SELECT
+			id, user_id, api_key_id, endpoint, query, query_text, response, model_provider,
+			rag_contexts_count, input_tokens, output_tokens, latency_ms, status,
+			error_message, conversation_id, interrupted, cache_status, moderation, moderation_rules,
+			model, cost_usd, user_key, client_ip, user_agent, experiment_id, experiment_variant, created_at
+		FROM query_logs
+		WHERE created_at >= ? AND created_at < ? AND id > ?
+		ORDER BY id
+		LIMIT ?`
+
+	var lastID int64
+	for {
+		batch, err := a.batch(ctx, query, start, end, lastID, archiveBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range batch {
+			if err := encoder.Encode(entry); err != nil {
+				return nil, fmt.Errorf("write archive: %w", err)
+			}
+			if archive.Entries == 0 || entry.CreatedAt.Before(archive.FirstCreatedAt) {
+				archive.FirstCreatedAt = entry.CreatedAt
+			}
+			if entry.CreatedAt.After(archive.LastCreatedAt) {
+				archive.LastCreatedAt = entry.CreatedAt
+			}
+			archive.Entries++
+			lastID = entry.ID
+		}
+		if len(batch) < archiveBatchSize {
+			break
+		}
+	}
+	if archive.Entries == 0 {
+		return nil, nil
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("write archive: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("sync archive: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat archive: %w", err)
+	}
+	archive.Size = info.Size()
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, fmt.Errorf("rename archive: %w", err)
+	}
+
+	if _, err := a.writer.Exec(ctx, `
+		INSERT INTO query_log_archives (name, month, entries, size_bytes, first_created_at, last_created_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, archive.Name, archive.Month, archive.Entries, archive.Size, archive.FirstCreatedAt, archive.LastCreatedAt, archive.CreatedAt); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("record archive: %w", err)
+	}
+
+	// Entries logged into the range since it was read have higher ids and stay.
+	for {
+		res, err := a.writer.Exec(ctx, `
+			DELETE FROM query_logs WHERE id IN (
+				SELECT id FROM query_logs WHERE created_at >= ? AND created_at < ? AND id <= ? LIMIT ?
+			)
+		`, start, end, lastID, archiveBatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("delete archived entries: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			break
+		}
+	}
+	return archive, nil
+}
+
+func (a *Archiver) batch(ctx context.Context, query string, args ...any) ([]QueryLog, error) {
+	rows, err := a.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("read query logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := make([]QueryLog, 0)
+	for rows.Next() {
+		entry, err := scanQueryLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, *entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate query logs: %w", err)
+	}
+	return logs, nil
+}
+
+// List returns the archives, newest month first.
+func (a *Archiver) List(ctx context.Context) ([]Archive, error) {
+	rows, err := a.db.QueryContext(ctx, `
+		SELECT name, month, entries, size_bytes, first_created_at, last_created_at, created_at
+		FROM query_log_archives
+		ORDER BY month DESC, created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("list archives: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []Archive{}
+	for rows.Next() {
+		var archive Archive
+		if err := rows.Scan(&archive.Name, &archive.Month, &archive.Entries, &archive.Size,
+			&archive.FirstCreatedAt, &archive.LastCreatedAt, &archive.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan archive: %w", err)
+		}
+		archives = append(archives, archive)
+	}
+	return archives, rows.Err()
+}
+
+// Path returns the file of the named archive. Names are checked against the archive
+// pattern, so they cannot reach outside the archive directory.
+func (a *Archiver) Path(ctx context.Context, name string) (string, error) {
+	if !archiveName.MatchString(name) {
+		return "", ErrArchiveNotFound
+	}
+	var exists bool
+	if err := a.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM query_log_archives WHERE name = ?)`, name).Scan(&exists); err != nil {
+		return "", fmt.Errorf("get archive: %w", err)
+	}
+	if !exists {
+		return "", ErrArchiveNotFound
+	}
+	path := filepath.Join(a.cfg.Dir, name)
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrArchiveNotFound
+		}
+		return "", fmt.Errorf("stat archive: %w", err)
+	}
+	return path, nil
+}
+
+// Search returns a page of the named archive's entries matching the List filters, newest
+// first, and how many match in total. Cursors are not supported; the file is scanned on
+// every call.
+func (a *Archiver) Search(ctx context.Context, name string, params ListParams) ([]QueryLog, int64, error) {
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 500 {
+		limit = 500
+	}
+	offset := (max(params.Page, 1) - 1) * limit
+
+	// Entries are stored oldest first; keep the last offset+limit matches.
+	window := offset + limit
+	matches := make([]QueryLog, 0, window)
+	var total int64
+	err := a.read(ctx, name, func(entry QueryLog) error {
+		if !params.matches(entry) {
+			return nil
+		}
+		total++
+		if len(matches) == window {
+			matches = matches[1:]
+		}
+		matches = append(matches, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page := make([]QueryLog, 0, limit)
+	for i := len(matches) - 1 - offset; i >= 0 && len(page) < limit; i-- {
+		page = append(page, matches[i])
+	}
+	return page, total, nil
+}
+
+// Restore inserts the named archive's entries back into the database with their original
+// ids and deletes the archive. Entries still in the database are left as they are.
+func (a *Archiver) Restore(ctx context.Context, name string) (int64, error) {
+	if !a.running.TryLock() {
+		return 0, ErrArchiveInProgress
+	}
+	defer a.running.Unlock()
+
+	path, err := a.Path(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		restored int64
+		batch    []QueryLog
+	)
+	flush := func() error {
+		n, err := a.insert(ctx, batch)
+		restored += n
+		batch = batch[:0]
+		return err
+	}
+	err = a.read(ctx, name, func(entry QueryLog) error {
+		batch = append(batch, entry)
+		if len(batch) == archiveBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return restored, err
+	}
+
+	if _, err := a.writer.Exec(ctx, `DELETE FROM query_log_archives WHERE name = ?`, name); err != nil {
+		return restored, fmt.Errorf("delete archive record: %w", err)
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("querylog: failed to remove restored archive %s: %v", name, err)
+	}
+	return restored, nil
+}
+
+// insert writes entries with their ids, skipping ids already present.
+func (a *Archiver) insert(ctx context.Context, entries []QueryLog) (int64, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	rows := make([]string, 0, len(entries))
+	args := make([]any, 0, len(entries)*23)
+	for i := range entries {
+		values, err := insertArgs(&entries[i])
+		if err != nil {
+			return 0, err
+		}
+		rows = append(rows, "(?, "+strings.TrimPrefix(insertPlaceholders, "("))
+		args = append(append(args, entries[i].ID), values...)
+	}
+	res, err := a.writer.Exec(ctx,
+		"INSERT OR IGNORE INTO query_logs (id, "+insertColumns+") VALUES "+strings.Join(rows, ", "), args...)
+	if err != nil {
+		return 0, fmt.Errorf("restore query logs: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n, nil
+}
+
+// read decodes the named archive's entries in order, passing each to fn.
+func (a *Archiver) read(ctx context.Context, name string, fn func(QueryLog) error) error {
+	path, err := a.Path(ctx, name)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return fmt.Errorf("read archive: %w", err)
+	}
+	defer gz.Close()
+
+	decoder := json.NewDecoder(gz)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var entry QueryLog
+		if err := decoder.Decode(&entry); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("decode archive: %w", err)
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// matches applies the listFilter conditions to an entry in memory.
+func (p ListParams) matches(entry QueryLog) bool {
+	switch {
+	case p.UserID != nil && entry.UserID != *p.UserID:
+		return false
+	case p.APIKeyID != nil && (entry.APIKeyID == nil || *entry.APIKeyID != *p.APIKeyID):
+		return false
+	case p.Status != "" && entry.Status != p.Status:
+		return false
+	case p.Endpoint != "" && entry.Endpoint != p.Endpoint:
+		return false
+	case p.ModelProvider != "" && entry.ModelProvider != p.ModelProvider:
+		return false
+	case p.Moderation != "" && entry.Moderation != p.Moderation:
+		return false
+	case p.StartDate != nil && entry.CreatedAt.Before(*p.StartDate):
+		return false
+	case p.EndDate != nil && entry.CreatedAt.After(*p.EndDate):
+		return false
+	}
+	return true
+}
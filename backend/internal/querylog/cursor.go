@@ -0,0 +1,51 @@
+package querylog
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned for a cursor that was not issued by List.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in the newest-first listing of query logs: the created_at and id of
+// the last entry on a page. Entries with the same created_at are ordered by id.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// cursorFor returns the cursor after log.
+func cursorFor(log QueryLog) *Cursor {
+	return &Cursor{CreatedAt: log.CreatedAt, ID: log.ID}
+}
+
+// String encodes the cursor as an opaque URL-safe token.
+func (c Cursor) String() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes a token returned as next_cursor.
+func ParseCursor(token string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	logID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || logID <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{CreatedAt: time.Unix(0, unixNano).UTC(), ID: logID}, nil
+}
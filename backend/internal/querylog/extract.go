@@ -0,0 +1,255 @@
+package querylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultMaxQueryChars   = 2000
+	defaultMaxFieldChars   = 4000
+	defaultMaxPayloadBytes = 32 * 1024
+
+	redactedValue   = "[REDACTED]"
+	truncatedSuffix = "…[truncated]"
+)
+
+// sensitiveFields are request fields whose values are never stored, compared after
+// lowercasing and dropping "-" and "_".
+var sensitiveFields = map[string]bool{
+	"apikey":        true,
+	"xapikey":       true,
+	"authorization": true,
+	"password":      true,
+	"secret":        true,
+	"clientsecret":  true,
+	"token":         true,
+	"accesstoken":   true,
+	"refreshtoken":  true,
+	"privatekey":    true,
+	"secretkey":     true,
+	"mnemonic":      true,
+	"seedphrase":    true,
+}
+
+// ExtractConfig bounds what is stored of a logged request.
+type ExtractConfig struct {
+	// MaxQueryChars caps the structured query.
+	MaxQueryChars int
+	// MaxFieldChars caps each string value of the stored payload.
+	MaxFieldChars int
+	// MaxPayloadBytes caps the stored payload as a whole. A payload cut at this limit is no
+	// longer valid JSON and cannot be replayed.
+	MaxPayloadBytes int
+}
+
+// ExtractConfigFromEnv loads QUERY_LOG_MAX_QUERY_CHARS, QUERY_LOG_MAX_FIELD_CHARS and
+// QUERY_LOG_MAX_PAYLOAD_BYTES.
+func ExtractConfigFromEnv() ExtractConfig {
+	cfg := ExtractConfig{
+		MaxQueryChars:   defaultMaxQueryChars,
+		MaxFieldChars:   defaultMaxFieldChars,
+		MaxPayloadBytes: defaultMaxPayloadBytes,
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("QUERY_LOG_MAX_QUERY_CHARS"))); err == nil && n > 0 {
+		cfg.MaxQueryChars = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("QUERY_LOG_MAX_FIELD_CHARS"))); err == nil && n > 0 {
+		cfg.MaxFieldChars = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("QUERY_LOG_MAX_PAYLOAD_BYTES"))); err == nil && n > 0 {
+		cfg.MaxPayloadBytes = n
+	}
+	return cfg
+}
+
+// queryExtractor pulls the user's query out of a decoded request body.
+type queryExtractor func(body map[string]any) string
+
+// queryExtractors maps tracked endpoints to how their query is found. Other endpoints are
+// logged without a structured query.
+var queryExtractors = map[string]queryExtractor{
+	"/api/v1/rag/retrieve":                    stringField("query"),
+	"/api/v1/rag/generate":                    stringField("query"),
+	"/api/v1/rag/generate-project":            stringField("query"),
+	"/api/v1/rag/generate-tests":              testedContract,
+	"/api/v1/rag/templates/:name/instantiate": stringField("customization"),
+	"/v1/chat/completions":                    lastUserMessage,
+	"/v1/chat/completions/continue":           continuedConversation,
+	"/v1/embeddings":                          embeddingInput,
+}
+
+// Extractor turns tracked request bodies into a structured query and a redacted payload.
+type Extractor struct {
+	cfg ExtractConfig
+}
+
+// NewExtractor returns an extractor. Zero limits fall back to the defaults.
+func NewExtractor(cfg ExtractConfig) *Extractor {
+	if cfg.MaxQueryChars <= 0 {
+		cfg.MaxQueryChars = defaultMaxQueryChars
+	}
+	if cfg.MaxFieldChars <= 0 {
+		cfg.MaxFieldChars = defaultMaxFieldChars
+	}
+	if cfg.MaxPayloadBytes <= 0 {
+		cfg.MaxPayloadBytes = defaultMaxPayloadBytes
+	}
+	return &Extractor{cfg: cfg}
+}
+
+// Extract returns the query of a request to endpoint and the payload to store. The payload
+// is the body re-encoded with sensitive fields redacted and long strings truncated; a body
+// that is not JSON is stored as text, truncated.
+func (e *Extractor) Extract(endpoint string, body []byte) (query, payload string) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var decoded any
+	if err := decoder.Decode(&decoded); err != nil {
+		return "", truncateBytes(strings.TrimSpace(string(body)), e.cfg.MaxPayloadBytes)
+	}
+
+	if object, ok := decoded.(map[string]any); ok {
+		if extract, ok := queryExtractors[endpoint]; ok {
+			query = truncateRunes(strings.TrimSpace(extract(object)), e.cfg.MaxQueryChars)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(e.redact(decoded)); err != nil {
+		return query, ""
+	}
+	return query, truncateBytes(strings.TrimSpace(buf.String()), e.cfg.MaxPayloadBytes)
+}
+
+// redact replaces sensitive fields and truncates long strings throughout a decoded value.
+func (e *Extractor) redact(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if isSensitiveField(key) {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = e.redact(field)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = e.redact(item)
+		}
+		return v
+	case string:
+		return truncateRunes(v, e.cfg.MaxFieldChars)
+	default:
+		return v
+	}
+}
+
+func isSensitiveField(key string) bool {
+	normalized := strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(key))
+	return sensitiveFields[normalized]
+}
+
+func stringField(name string) queryExtractor {
+	return func(body map[string]any) string {
+		value, _ := body[name].(string)
+		return value
+	}
+}
+
+// lastUserMessage returns the text of the last user message of a chat completion request.
+// Content may be a string or an array of parts, of which the text parts are joined.
+func lastUserMessage(body map[string]any) string {
+	messages, _ := body["messages"].([]any)
+	for i := len(messages) - 1; i >= 0; i-- {
+		message, _ := messages[i].(map[string]any)
+		if role, _ := message["role"].(string); role != "user" {
+			continue
+		}
+		switch content := message["content"].(type) {
+		case string:
+			return content
+		case []any:
+			var parts []string
+			for _, part := range content {
+				part, _ := part.(map[string]any)
+				if text, ok := part["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+			return strings.Join(parts, "\n")
+		}
+		return ""
+	}
+	return ""
+}
+
+// continuedConversation names the conversation a continue request resumes; it carries no
+// new user text.
+func continuedConversation(body map[string]any) string {
+	if id, ok := body["conversation_id"].(json.Number); ok {
+		return fmt.Sprintf("continue conversation %s", id)
+	}
+	return ""
+}
+
+// testedContract names the contract a test generation request covers, with its extra
+// instructions.
+func testedContract(body map[string]any) string {
+	name, _ := body["contract_name"].(string)
+	instructions, _ := body["instructions"].(string)
+	query := "tests for " + strings.TrimSpace(name)
+	if strings.TrimSpace(name) == "" {
+		query = "tests for contract"
+	}
+	if instructions = strings.TrimSpace(instructions); instructions != "" {
+		query += ": " + instructions
+	}
+	return query
+}
+
+// embeddingInput returns an embedding request's input, one line per string.
+func embeddingInput(body map[string]any) string {
+	switch input := body["input"].(type) {
+	case string:
+		return input
+	case []any:
+		var lines []string
+		for _, item := range input {
+			if text, ok := item.(string); ok {
+				lines = append(lines, text)
+			}
+		}
+		return strings.Join(lines, "\n")
+	}
+	return ""
+}
+
+// truncateRunes cuts s to at most maxChars runes, marking the cut.
+func truncateRunes(s string, maxChars int) string {
+	if utf8.RuneCountInString(s) <= maxChars {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:maxChars]) + truncatedSuffix
+}
+
+// truncateBytes cuts s to at most maxBytes without splitting a UTF-8 sequence.
+func truncateBytes(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
+}
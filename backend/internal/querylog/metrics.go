@@ -0,0 +1,41 @@
+package querylog
+
+import (
+	"fmt"
+	"io"
+)
+
+// metricPrefix namespaces the pipeline metrics.
+const metricPrefix = "stacks_builder_querylog_"
+
+// WritePrometheus writes the pipeline counters and gauges in the Prometheus text exposition
+// format.
+func (s *Service) WritePrometheus(w io.Writer) error {
+	stats := s.Stats()
+	metrics := []struct {
+		name, kind, help string
+		value            float64
+	}{
+		{"received_total", "counter", "Query log entries logged.", float64(stats.Received)},
+		{"enqueued_total", "counter", "Entries added to the in-memory queue.", float64(stats.Enqueued)},
+		{"persisted_total", "counter", "Entries written to the database.", float64(stats.Persisted)},
+		{"batches_total", "counter", "Batch inserts written.", float64(stats.Batches)},
+		{"spilled_total", "counter", "Entries appended to the spill file.", float64(stats.Spilled)},
+		{"replayed_total", "counter", "Spilled entries read back for writing.", float64(stats.Replayed)},
+		{"dropped_total", "counter", "Entries lost because the queue or spill file was full.", float64(stats.Dropped)},
+		{"failed_total", "counter", "Entries that could not be written or decoded.", float64(stats.Failed)},
+		{"blocked_total", "counter", "Entries whose callers waited for room in the queue.", float64(stats.Blocked)},
+		{"queue_length", "gauge", "Entries waiting in the queue.", float64(stats.QueueLength)},
+		{"queue_capacity", "gauge", "Size of the queue.", float64(stats.QueueCapacity)},
+		{"spill_bytes", "gauge", "Size of the spill file in bytes.", float64(stats.SpillBytes)},
+	}
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %[1]s%[2]s %[3]s\n# TYPE %[1]s%[2]s %[4]s\n%[1]s%[2]s %[5]g\n",
+			metricPrefix, m.name, m.help, m.kind, m.value); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "# HELP %[1]soverflow_strategy Overflow strategy in use.\n# TYPE %[1]soverflow_strategy gauge\n%[1]soverflow_strategy{strategy=%[2]q} 1\n",
+		metricPrefix, stats.Overflow)
+	return err
+}
@@ -3,22 +3,46 @@ package querylog
 import "time"
 
 // QueryLog represents a single tracked request/response cycle for analytics and debugging.
+// Query holds the request payload with sensitive fields redacted and long strings truncated;
+// QueryText holds the user's query extracted from it, e.g. the last user message of a chat
+// completion, and is empty for entries logged before it was recorded.
 type QueryLog struct {
-	ID               int64     `json:"id"`
-	UserID           int64     `json:"user_id"`
-	APIKeyID         *int64    `json:"api_key_id,omitempty"`
-	Endpoint         string    `json:"endpoint"`
-	Query            string    `json:"query"`
-	Response         string    `json:"response,omitempty"`
-	ModelProvider    string    `json:"model_provider,omitempty"`
-	RAGContextsCount int       `json:"rag_contexts_count"`
-	InputTokens      int       `json:"input_tokens"`
-	OutputTokens     int       `json:"output_tokens"`
-	LatencyMs        int64     `json:"latency_ms"`
-	Status           string    `json:"status"`
-	ErrorMessage     string    `json:"error_message,omitempty"`
-	ConversationID   *int64    `json:"conversation_id,omitempty"`
-	CreatedAt        time.Time `json:"created_at"`
+	ID               int64  `json:"id"`
+	UserID           int64  `json:"user_id"`
+	APIKeyID         *int64 `json:"api_key_id,omitempty"`
+	Endpoint         string `json:"endpoint"`
+	Query            string `json:"query"`
+	QueryText        string `json:"query_text,omitempty"`
+	Response         string `json:"response,omitempty"`
+	ModelProvider    string `json:"model_provider,omitempty"`
+	RAGContextsCount int    `json:"rag_contexts_count"`
+	InputTokens      int    `json:"input_tokens"`
+	OutputTokens     int    `json:"output_tokens"`
+	LatencyMs        int64  `json:"latency_ms"`
+	Status           string `json:"status"`
+	ErrorMessage     string `json:"error_message,omitempty"`
+	ConversationID   *int64 `json:"conversation_id,omitempty"`
+	Interrupted      bool   `json:"interrupted"`
+	CacheStatus      string `json:"cache_status,omitempty"`
+	// Moderation is "flagged" or "blocked" for prompts caught by content moderation, and
+	// ModerationRules lists the comma-separated rules that matched.
+	Moderation      string `json:"moderation,omitempty"`
+	ModerationRules string `json:"moderation_rules,omitempty"`
+	// Model is the model that served the request and CostUSD its estimated cost, priced
+	// from the model registry and MODEL_PRICES.
+	Model   string  `json:"model,omitempty"`
+	CostUSD float64 `json:"cost_usd"`
+	// UserKey marks requests served with the caller's own provider key, which the server's
+	// spend and token quotas leave out.
+	UserKey bool `json:"user_key,omitempty"`
+	// ClientIP and UserAgent identify the caller's client. ClientIP is the address reported
+	// by a trusted proxy; both are empty for entries logged before they were recorded.
+	ClientIP  string `json:"client_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	// ExperimentID and Variant identify the A/B experiment variant that served the request.
+	ExperimentID *int64    `json:"experiment_id,omitempty"`
+	Variant      string    `json:"experiment_variant,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 // QueryLogStats aggregates query log metrics for reporting.
@@ -29,6 +53,44 @@ type QueryLogStats struct {
 	AvgLatencyMs      float64          `json:"avg_latency_ms"`
 	TotalInputTokens  int64            `json:"total_input_tokens"`
 	TotalOutputTokens int64            `json:"total_output_tokens"`
+	TotalCostUSD      float64          `json:"total_cost_usd"`
 	QueriesByEndpoint map[string]int64 `json:"queries_by_endpoint"`
 	QueriesByProvider map[string]int64 `json:"queries_by_provider"`
+	// QueriesByCacheStatus counts requests served from the response cache ("hit"),
+	// with only retrieval cached ("partial"), or uncached ("miss").
+	QueriesByCacheStatus map[string]int64 `json:"queries_by_cache_status"`
+}
+
+// RequestCount is how often one exact request body was logged.
+type RequestCount struct {
+	Query string `json:"query"`
+	Count int64  `json:"count"`
+}
+
+// Time series bucket sizes accepted by GetTimeSeries.
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+)
+
+// TimeSeriesPoint aggregates the query logs created within one bucket.
+type TimeSeriesPoint struct {
+	Bucket            time.Time `json:"bucket"`
+	TotalQueries      int64     `json:"total_queries"`
+	ErrorCount        int64     `json:"error_count"`
+	ErrorRate         float64   `json:"error_rate"`
+	AvgLatencyMs      float64   `json:"avg_latency_ms"`
+	P50LatencyMs      int64     `json:"p50_latency_ms"`
+	P95LatencyMs      int64     `json:"p95_latency_ms"`
+	P99LatencyMs      int64     `json:"p99_latency_ms"`
+	TotalInputTokens  int64     `json:"total_input_tokens"`
+	TotalOutputTokens int64     `json:"total_output_tokens"`
+}
+
+// TimeSeries is a gap-free series of buckets covering [StartDate, EndDate].
+type TimeSeries struct {
+	Interval  string            `json:"interval"`
+	StartDate time.Time         `json:"start_date"`
+	EndDate   time.Time         `json:"end_date"`
+	Points    []TimeSeriesPoint `json:"points"`
 }
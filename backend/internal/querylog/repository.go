@@ -1,54 +1,132 @@
 package querylog
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/compression"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
 )
 
 // ErrNotFound is returned when a query log record cannot be located.
 var ErrNotFound = errors.New("query log not found")
 
-// Repository persists and queries query log records.
+// Repository persists and queries query log records. Writes go through the database's
+// shared writer.
 type Repository struct {
-	db *sql.DB
+	db     *sql.DB
+	writer *database.Writer
 }
 
 // NewRepository returns a repository backed by the supplied sql.DB handle.
 func NewRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+	return &Repository{db: db, writer: database.WriterFor(db)}
 }
 
-// ListParams defines filters and pagination for listing query logs.
+// ListParams defines filters and pagination for listing query logs. With After set, the
+// page starts after that cursor and Page is ignored.
 type ListParams struct {
 	Page          int
 	Limit         int
+	After         *Cursor
 	UserID        *int64
 	APIKeyID      *int64
 	Status        string
 	Endpoint      string
 	ModelProvider string
-	StartDate     *time.Time
-	EndDate       *time.Time
+	// Moderation keeps entries with this moderation verdict, "flagged" or "blocked".
+	Moderation string
+	StartDate  *time.Time
+	EndDate    *time.Time
 }
 
-// Create inserts a new query log record.
+// insertColumns lists the columns written for each query log, in the order of insertArgs.
+const insertColumns = `user_id, api_key_id, endpoint, query, query_text, response, model_provider,
+	rag_contexts_count, input_tokens, output_tokens, latency_ms, status,
+	error_message, conversation_id, interrupted, cache_status, moderation, moderation_rules,
+	model, cost_usd, user_key, client_ip, user_agent, experiment_id, experiment_variant, created_at`
+
+// insertPlaceholders holds one row of insert placeholders.
+const insertPlaceholders = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// Create inserts a new query log record. CreatedAt defaults to the current time.
 func (r *Repository) Create(log *QueryLog) error {
 	if log == nil {
 		return fmt.Errorf("log is nil")
 	}
 
-	now := time.Now().UTC()
-	log.CreatedAt = now
+	args, err := insertArgs(log)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.writer.Exec(context.Background(),
+		"INSERT INTO query_logs ("+insertColumns+") VALUES "+insertPlaceholders, args...)
+	if err != nil {
+		return fmt.Errorf("insert query log: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("fetch query log id: %w", err)
+	}
+	log.ID = id
+	return nil
+}
+
+// CreateBatch inserts logs with a single multi-row statement. IDs are not populated.
+func (r *Repository) CreateBatch(ctx context.Context, logs []*QueryLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	rows := make([]string, 0, len(logs))
+	args := make([]any, 0, len(logs)*26)
+	for _, log := range logs {
+		if log == nil {
+			return fmt.Errorf("log is nil")
+		}
+		values, err := insertArgs(log)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, insertPlaceholders)
+		args = append(args, values...)
+	}
+
+	query := "INSERT INTO query_logs (" + insertColumns + ") VALUES " + strings.Join(rows, ", ")
+	if _, err := r.writer.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("insert %d query logs: %w", len(logs), err)
+	}
+	return nil
+}
+
+// insertArgs returns the values of insertColumns for log, compressing the response.
+func insertArgs(log *QueryLog) ([]any, error) {
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = time.Now().UTC()
+	}
 
 	var (
-		apiKeyID       any
-		conversationID any
-		response       any
-		modelProvider  any
-		errorMessage   any
+		apiKeyID        any
+		conversationID  any
+		response        any
+		modelProvider   any
+		errorMessage    any
+		cacheStatus     any
+		queryText       any
+		moderation      any
+		moderationRules any
+		model           any
+		clientIP        any
+		userAgent       any
+		experimentID    any
+		variant         any
 	)
 
 	if log.APIKeyID != nil {
@@ -58,7 +136,11 @@ func (r *Repository) Create(log *QueryLog) error {
 		conversationID = *log.ConversationID
 	}
 	if log.Response != "" {
-		response = log.Response
+		stored, err := compression.EncodeString(log.Response)
+		if err != nil {
+			return nil, err
+		}
+		response = stored
 	}
 	if log.ModelProvider != "" {
 		modelProvider = log.ModelProvider
@@ -66,20 +148,40 @@ func (r *Repository) Create(log *QueryLog) error {
 	if log.ErrorMessage != "" {
 		errorMessage = log.ErrorMessage
 	}
+	if log.CacheStatus != "" {
+		cacheStatus = log.CacheStatus
+	}
+	if log.QueryText != "" {
+		queryText = log.QueryText
+	}
+	if log.Moderation != "" {
+		moderation = log.Moderation
+	}
+	if log.ModerationRules != "" {
+		moderationRules = log.ModerationRules
+	}
+	if log.Model != "" {
+		model = log.Model
+	}
+	if log.ClientIP != "" {
+		clientIP = log.ClientIP
+	}
+	if log.UserAgent != "" {
+		userAgent = log.UserAgent
+	}
+	if log.ExperimentID != nil {
+		experimentID = *log.ExperimentID
+	}
+	if log.Variant != "" {
+		variant = log.Variant
+	}
 
-	const insertQuery = `
-		INSERT INTO query_logs (
-			user_id, api_key_id, endpoint, query, response, model_provider,
-			rag_contexts_count, input_tokens, output_tokens, latency_ms, status,
-			error_message, conversation_id, created_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
-
-	res, err := r.db.Exec(insertQuery,
+	return []any{
 		log.UserID,
 		apiKeyID,
 		log.Endpoint,
 		log.Query,
+		queryText,
 		response,
 		modelProvider,
 		log.RAGContextsCount,
@@ -89,38 +191,49 @@ func (r *Repository) Create(log *QueryLog) error {
 		log.Status,
 		errorMessage,
 		conversationID,
+		log.Interrupted,
+		cacheStatus,
+		moderation,
+		moderationRules,
+		model,
+		log.CostUSD,
+		log.UserKey,
+		clientIP,
+		userAgent,
+		experimentID,
+		variant,
 		log.CreatedAt,
-	)
-	if err != nil {
-		return fmt.Errorf("insert query log: %w", err)
-	}
-
-	id, err := res.LastInsertId()
-	if err != nil {
-		return fmt.Errorf("fetch query log id: %w", err)
-	}
-	log.ID = id
-	return nil
+	}, nil
 }
 
 // GetByID returns a query log by its identifier.
 func (r *Repository) GetByID(id int64) (*QueryLog, error) {
 	const query = `
 		SELECT
-			id, user_id, api_key_id, endpoint, query, response, model_provider,
+			id, user_id, api_key_id, endpoint, query, query_text, response, model_provider,
 			rag_contexts_count, input_tokens, output_tokens, latency_ms, status,
-			error_message, conversation_id, created_at
+			error_message, conversation_id, interrupted, cache_status, moderation, moderation_rules,
+			model, cost_usd, user_key, client_ip, user_agent, experiment_id, experiment_variant, created_at
 		FROM query_logs
 		WHERE id = ?
 	`
 
 	var (
-		log            QueryLog
-		apiKeyID       sql.NullInt64
-		conversationID sql.NullInt64
-		response       sql.NullString
-		modelProvider  sql.NullString
-		errorMessage   sql.NullString
+		log             QueryLog
+		apiKeyID        sql.NullInt64
+		conversationID  sql.NullInt64
+		response        sql.NullString
+		modelProvider   sql.NullString
+		errorMessage    sql.NullString
+		cacheStatus     sql.NullString
+		queryText       sql.NullString
+		moderation      sql.NullString
+		moderationRules sql.NullString
+		model           sql.NullString
+		clientIP        sql.NullString
+		userAgent       sql.NullString
+		experimentID    sql.NullInt64
+		variant         sql.NullString
 	)
 
 	err := r.db.QueryRow(query, id).Scan(
@@ -129,6 +242,7 @@ func (r *Repository) GetByID(id int64) (*QueryLog, error) {
 		&apiKeyID,
 		&log.Endpoint,
 		&log.Query,
+		&queryText,
 		&response,
 		&modelProvider,
 		&log.RAGContextsCount,
@@ -138,6 +252,17 @@ func (r *Repository) GetByID(id int64) (*QueryLog, error) {
 		&log.Status,
 		&errorMessage,
 		&conversationID,
+		&log.Interrupted,
+		&cacheStatus,
+		&moderation,
+		&moderationRules,
+		&model,
+		&log.CostUSD,
+		&log.UserKey,
+		&clientIP,
+		&userAgent,
+		&experimentID,
+		&variant,
 		&log.CreatedAt,
 	)
 	if errors.Is(err, sql.ErrNoRows) {
@@ -154,7 +279,11 @@ func (r *Repository) GetByID(id int64) (*QueryLog, error) {
 		log.ConversationID = &conversationID.Int64
 	}
 	if response.Valid {
-		log.Response = response.String
+		decoded, err := compression.DecodeString(response.String)
+		if err != nil {
+			return nil, fmt.Errorf("decode query log response: %w", err)
+		}
+		log.Response = decoded
 	}
 	if modelProvider.Valid {
 		log.ModelProvider = modelProvider.String
@@ -162,12 +291,51 @@ func (r *Repository) GetByID(id int64) (*QueryLog, error) {
 	if errorMessage.Valid {
 		log.ErrorMessage = errorMessage.String
 	}
+	if cacheStatus.Valid {
+		log.CacheStatus = cacheStatus.String
+	}
+	if queryText.Valid {
+		log.QueryText = queryText.String
+	}
+	if moderation.Valid {
+		log.Moderation = moderation.String
+	}
+	if moderationRules.Valid {
+		log.ModerationRules = moderationRules.String
+	}
+	if model.Valid {
+		log.Model = model.String
+	}
+	if clientIP.Valid {
+		log.ClientIP = clientIP.String
+	}
+	if userAgent.Valid {
+		log.UserAgent = userAgent.String
+	}
+	if experimentID.Valid {
+		log.ExperimentID = &experimentID.Int64
+	}
+	if variant.Valid {
+		log.Variant = variant.String
+	}
 
 	return &log, nil
 }
 
-// List returns paginated query logs matching the provided filters and the total count.
-func (r *Repository) List(params ListParams) ([]QueryLog, int64, error) {
+// ListPage is a page of query logs.
+type ListPage struct {
+	Logs []QueryLog
+	// Total counts every matching entry. It is only computed for offset pagination, since
+	// counting is what makes deep pages slow on large tables.
+	Total int64
+	// NextCursor continues the listing after the page; nil on the last page.
+	NextCursor *Cursor
+}
+
+// List returns a page of query logs matching the filters, newest first. Pages are selected
+// by Page (offset pagination) or, when After is set, by keyset pagination on
+// (created_at, id), which stays fast however deep the page.
+func (r *Repository) List(params ListParams) (*ListPage, error) {
 	limit := params.Limit
 	if limit <= 0 {
 		limit = 20
@@ -175,129 +343,145 @@ func (r *Repository) List(params ListParams) ([]QueryLog, int64, error) {
 	if limit > 500 {
 		limit = 500
 	}
-	page := params.Page
-	if page <= 0 {
-		page = 1
-	}
-	offset := (page - 1) * limit
-
-	whereParts := make([]string, 0)
-	args := make([]any, 0)
-
-	if params.UserID != nil {
-		whereParts = append(whereParts, "user_id = ?")
-		args = append(args, *params.UserID)
-	}
-	if params.APIKeyID != nil {
-		whereParts = append(whereParts, "api_key_id = ?")
-		args = append(args, *params.APIKeyID)
-	}
-	if params.Status != "" {
-		whereParts = append(whereParts, "status = ?")
-		args = append(args, params.Status)
-	}
-	if params.Endpoint != "" {
-		whereParts = append(whereParts, "endpoint = ?")
-		args = append(args, params.Endpoint)
-	}
-	if params.ModelProvider != "" {
-		whereParts = append(whereParts, "model_provider = ?")
-		args = append(args, params.ModelProvider)
-	}
-	if params.StartDate != nil {
-		whereParts = append(whereParts, "created_at >= ?")
-		args = append(args, *params.StartDate)
-	}
-	if params.EndDate != nil {
-		whereParts = append(whereParts, "created_at <= ?")
-		args = append(args, *params.EndDate)
-	}
+	pageNumber := max(params.Page, 1)
 
-	whereClause := ""
-	if len(whereParts) > 0 {
-		whereClause = "WHERE " + strings.Join(whereParts, " AND ")
-	}
+	whereClause, args := listFilter(params)
+	page := &ListPage{}
 
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM query_logs %s", whereClause)
-	var total int64
-	if err := r.db.QueryRow(countQuery, args...).Scan(&total); err != nil {
-		return nil, 0, fmt.Errorf("count query logs: %w", err)
+	var pagination string
+	listArgs := append([]any{}, args...)
+	if params.After != nil {
+		cursorClause := "(created_at, id) < (?, ?)"
+		if whereClause == "" {
+			whereClause = "WHERE " + cursorClause
+		} else {
+			whereClause += " AND " + cursorClause
+		}
+		listArgs = append(listArgs, params.After.CreatedAt.UTC(), params.After.ID)
+		// One extra entry tells whether another page follows.
+		pagination = "LIMIT ?"
+		listArgs = append(listArgs, limit+1)
+	} else {
+		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM query_logs %s", whereClause)
+		if err := r.db.QueryRow(countQuery, args...).Scan(&page.Total); err != nil {
+			return nil, fmt.Errorf("count query logs: %w", err)
+		}
+		pagination = "LIMIT ? OFFSET ?"
+		listArgs = append(listArgs, limit, (pageNumber-1)*limit)
 	}
 
 	listQuery := fmt.Sprintf(`
 		SELECT
-			id, user_id, api_key_id, endpoint, query, response, model_provider,
+			id, user_id, api_key_id, endpoint, query, query_text, response, model_provider,
 			rag_contexts_count, input_tokens, output_tokens, latency_ms, status,
-			error_message, conversation_id, created_at
+			error_message, conversation_id, interrupted, cache_status, moderation, moderation_rules,
+			model, cost_usd, user_key, client_ip, user_agent, experiment_id, experiment_variant, created_at
 		FROM query_logs
 		%s
-		ORDER BY created_at DESC
-		LIMIT ? OFFSET ?`, whereClause)
-
-	listArgs := append(append([]any{}, args...), limit, offset)
+		ORDER BY created_at DESC, id DESC
+		%s`, whereClause, pagination)
 
 	rows, err := r.db.Query(listQuery, listArgs...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("list query logs: %w", err)
+		return nil, fmt.Errorf("list query logs: %w", err)
 	}
 	defer rows.Close()
 
 	logs := make([]QueryLog, 0)
 
 	for rows.Next() {
-		var (
-			log            QueryLog
-			apiKeyID       sql.NullInt64
-			conversationID sql.NullInt64
-			response       sql.NullString
-			modelProvider  sql.NullString
-			errorMessage   sql.NullString
-		)
-
-		if err := rows.Scan(
-			&log.ID,
-			&log.UserID,
-			&apiKeyID,
-			&log.Endpoint,
-			&log.Query,
-			&response,
-			&modelProvider,
-			&log.RAGContextsCount,
-			&log.InputTokens,
-			&log.OutputTokens,
-			&log.LatencyMs,
-			&log.Status,
-			&errorMessage,
-			&conversationID,
-			&log.CreatedAt,
-		); err != nil {
-			return nil, 0, fmt.Errorf("scan query log: %w", err)
+		log, err := scanQueryLog(rows)
+		if err != nil {
+			return nil, err
 		}
+		logs = append(logs, *log)
+	}
 
-		if apiKeyID.Valid {
-			log.APIKeyID = &apiKeyID.Int64
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate query logs: %w", err)
+	}
+
+	var more bool
+	if params.After != nil {
+		more = len(logs) > limit
+		if more {
+			logs = logs[:limit]
 		}
-		if conversationID.Valid {
-			log.ConversationID = &conversationID.Int64
+	} else {
+		more = int64((pageNumber-1)*limit+len(logs)) < page.Total
+	}
+	if more && len(logs) > 0 {
+		page.NextCursor = cursorFor(logs[len(logs)-1])
+	}
+	page.Logs = logs
+
+	return page, nil
+}
+
+// Export streams every query log matching the List filters (pagination is ignored), newest
+// first, passing them to fn in batches. Batches are fetched with keyset pagination so the
+// database is not held by a long-running cursor while a slow client reads the export.
+func (r *Repository) Export(ctx context.Context, params ListParams, batchSize int, fn func([]QueryLog) error) error {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	whereClause, args := listFilter(params)
+	if whereClause == "" {
+		whereClause = "WHERE id < ?"
+	} else {
+		whereClause += " AND id < ?"
+	}
+
+	exportQuery := fmt.Sprintf(`
+		SELECT
+			id, user_id, api_key_id, endpoint, query, query_text, response, model_provider,
+			rag_contexts_count, input_tokens, output_tokens, latency_ms, status,
+			error_message, conversation_id, interrupted, cache_status, moderation, moderation_rules,
+			model, cost_usd, user_key, client_ip, user_agent, experiment_id, experiment_variant, created_at
+		FROM query_logs
+		%s
+		ORDER BY id DESC
+		LIMIT ?`, whereClause)
+
+	beforeID := int64(math.MaxInt64)
+	for {
+		batch, err := r.exportBatch(ctx, exportQuery, append(append([]any{}, args...), beforeID, batchSize))
+		if err != nil {
+			return err
 		}
-		if response.Valid {
-			log.Response = response.String
+		if len(batch) == 0 {
+			return nil
 		}
-		if modelProvider.Valid {
-			log.ModelProvider = modelProvider.String
+		if err := fn(batch); err != nil {
+			return err
 		}
-		if errorMessage.Valid {
-			log.ErrorMessage = errorMessage.String
+		if len(batch) < batchSize {
+			return nil
 		}
+		beforeID = batch[len(batch)-1].ID
+	}
+}
 
-		logs = append(logs, log)
+func (r *Repository) exportBatch(ctx context.Context, query string, args []any) ([]QueryLog, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("export query logs: %w", err)
 	}
+	defer rows.Close()
 
+	logs := make([]QueryLog, 0)
+	for rows.Next() {
+		log, err := scanQueryLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, *log)
+	}
 	if err := rows.Err(); err != nil {
-		return nil, 0, fmt.Errorf("iterate query logs: %w", err)
+		return nil, fmt.Errorf("iterate query logs: %w", err)
 	}
-
-	return logs, total, nil
+	return logs, nil
 }
 
 // GetStats returns aggregated query log statistics for a date range.
@@ -321,8 +505,9 @@ func (r *Repository) GetStats(startDate, endDate time.Time) (*QueryLogStats, err
 	}
 
 	stats := QueryLogStats{
-		QueriesByEndpoint: make(map[string]int64),
-		QueriesByProvider: make(map[string]int64),
+		QueriesByEndpoint:    make(map[string]int64),
+		QueriesByProvider:    make(map[string]int64),
+		QueriesByCacheStatus: make(map[string]int64),
 	}
 
 	aggregateQuery := fmt.Sprintf(`
@@ -332,7 +517,8 @@ func (r *Repository) GetStats(startDate, endDate time.Time) (*QueryLogStats, err
 			SUM(CASE WHEN status = 'error' THEN 1 ELSE 0 END) AS error_count,
 			COALESCE(AVG(latency_ms), 0) AS avg_latency_ms,
 			COALESCE(SUM(input_tokens), 0) AS total_input_tokens,
-			COALESCE(SUM(output_tokens), 0) AS total_output_tokens
+			COALESCE(SUM(output_tokens), 0) AS total_output_tokens,
+			COALESCE(SUM(cost_usd), 0) AS total_cost_usd
 		FROM query_logs
 		%s
 	`, whereClause)
@@ -344,6 +530,7 @@ func (r *Repository) GetStats(startDate, endDate time.Time) (*QueryLogStats, err
 		&stats.AvgLatencyMs,
 		&stats.TotalInputTokens,
 		&stats.TotalOutputTokens,
+		&stats.TotalCostUSD,
 	); err != nil {
 		return nil, fmt.Errorf("aggregate stats: %w", err)
 	}
@@ -368,12 +555,352 @@ func (r *Repository) GetStats(startDate, endDate time.Time) (*QueryLogStats, err
 		return nil, fmt.Errorf("aggregate provider stats: %w", err)
 	}
 
+	cacheWhere := "WHERE cache_status IS NOT NULL"
+	if whereClause != "" {
+		cacheWhere = whereClause + " AND cache_status IS NOT NULL"
+	}
+	cacheQuery := fmt.Sprintf(`
+		SELECT cache_status, COUNT(*) FROM query_logs
+		%s
+		GROUP BY cache_status
+	`, cacheWhere)
+
+	if err := r.collectCounts(cacheQuery, args, stats.QueriesByCacheStatus); err != nil {
+		return nil, fmt.Errorf("aggregate cache stats: %w", err)
+	}
+
 	return &stats, nil
 }
 
+// TimeSeriesParams selects the range, bucket size and optional filters of a time series.
+type TimeSeriesParams struct {
+	StartDate     time.Time
+	EndDate       time.Time
+	Interval      string
+	Endpoint      string
+	ModelProvider string
+}
+
+// timeSeriesBucketFormats truncates created_at to the start of its bucket in SQLite.
+var timeSeriesBucketFormats = map[string]string{
+	IntervalHour: "%Y-%m-%d %H:00:00",
+	IntervalDay:  "%Y-%m-%d 00:00:00",
+}
+
+// GetTimeSeries buckets query counts, error rates, latency percentiles and token usage
+// over [StartDate, EndDate]. Aggregation runs in SQL; buckets without traffic are filled with zeros.
+func (r *Repository) GetTimeSeries(params TimeSeriesParams) (*TimeSeries, error) {
+	bucketFormat, ok := timeSeriesBucketFormats[params.Interval]
+	if !ok {
+		return nil, fmt.Errorf("unsupported interval %q", params.Interval)
+	}
+
+	start, end := params.StartDate.UTC(), params.EndDate.UTC()
+	whereParts := []string{"created_at >= ?", "created_at <= ?"}
+	args := []any{start, end}
+	if params.Endpoint != "" {
+		whereParts = append(whereParts, "endpoint = ?")
+		args = append(args, params.Endpoint)
+	}
+	if params.ModelProvider != "" {
+		whereParts = append(whereParts, "model_provider = ?")
+		args = append(args, params.ModelProvider)
+	}
+
+	// Percentiles use the nearest-rank method: the ceil(p*n)-th smallest latency in the bucket.
+	query := fmt.Sprintf(`
+		WITH bucketed AS (
+			SELECT strftime('%s', created_at) AS bucket, status, latency_ms, input_tokens, output_tokens
+			FROM query_logs
+			WHERE %s
+		),
+		ranked AS (
+			SELECT
+				bucket,
+				latency_ms,
+				ROW_NUMBER() OVER (PARTITION BY bucket ORDER BY latency_ms) AS rn,
+				COUNT(*) OVER (PARTITION BY bucket) AS cnt
+			FROM bucketed
+		),
+		percentiles AS (
+			SELECT
+				bucket,
+				MAX(CASE WHEN rn = (cnt * 50 + 99) / 100 THEN latency_ms END) AS p50,
+				MAX(CASE WHEN rn = (cnt * 95 + 99) / 100 THEN latency_ms END) AS p95,
+				MAX(CASE WHEN rn = (cnt * 99 + 99) / 100 THEN latency_ms END) AS p99
+			FROM ranked
+			GROUP BY bucket
+		)
+		SELECT
+			b.bucket,
+			COUNT(*),
+			SUM(CASE WHEN b.status = 'error' THEN 1 ELSE 0 END),
+			COALESCE(AVG(b.latency_ms), 0),
+			COALESCE(p.p50, 0),
+			COALESCE(p.p95, 0),
+			COALESCE(p.p99, 0),
+			COALESCE(SUM(b.input_tokens), 0),
+			COALESCE(SUM(b.output_tokens), 0)
+		FROM bucketed b
+		JOIN percentiles p ON p.bucket = b.bucket
+		GROUP BY b.bucket
+		ORDER BY b.bucket
+	`, bucketFormat, strings.Join(whereParts, " AND "))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate time series: %w", err)
+	}
+	defer rows.Close()
+
+	byBucket := make(map[time.Time]TimeSeriesPoint)
+	for rows.Next() {
+		var (
+			bucket string
+			point  TimeSeriesPoint
+		)
+		if err := rows.Scan(
+			&bucket,
+			&point.TotalQueries,
+			&point.ErrorCount,
+			&point.AvgLatencyMs,
+			&point.P50LatencyMs,
+			&point.P95LatencyMs,
+			&point.P99LatencyMs,
+			&point.TotalInputTokens,
+			&point.TotalOutputTokens,
+		); err != nil {
+			return nil, fmt.Errorf("scan time series: %w", err)
+		}
+		bucketTime, err := time.Parse(time.DateTime, bucket)
+		if err != nil {
+			return nil, fmt.Errorf("parse time series bucket %q: %w", bucket, err)
+		}
+		point.Bucket = bucketTime
+		if point.TotalQueries > 0 {
+			point.ErrorRate = float64(point.ErrorCount) / float64(point.TotalQueries)
+		}
+		byBucket[bucketTime] = point
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate time series: %w", err)
+	}
+
+	series := &TimeSeries{
+		Interval:  params.Interval,
+		StartDate: start,
+		EndDate:   end,
+		Points:    make([]TimeSeriesPoint, 0),
+	}
+	for bucket := truncateToInterval(start, params.Interval); !bucket.After(end); bucket = nextBucket(bucket, params.Interval) {
+		point, ok := byBucket[bucket]
+		if !ok {
+			point = TimeSeriesPoint{Bucket: bucket}
+		}
+		series.Points = append(series.Points, point)
+	}
+	return series, nil
+}
+
+// truncateToInterval returns the start of the UTC hour or day containing t.
+func truncateToInterval(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	if interval == IntervalDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Hour)
+}
+
+func nextBucket(t time.Time, interval string) time.Time {
+	if interval == IntervalDay {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.Add(time.Hour)
+}
+
+// ReplayableEndpoints are the tracked endpoints whose logged payloads can be sent again as
+// they are: their routes have no path parameters and accept an API key.
+var ReplayableEndpoints = []string{
+	"/api/v1/rag/retrieve",
+	"/api/v1/rag/generate",
+	"/api/v1/rag/generate-project",
+	"/api/v1/rag/generate-tests",
+	"/v1/chat/completions",
+	"/v1/embeddings",
+}
+
+// SampleReplayable returns up to n randomly selected successful query logs that can be
+// replayed, optionally restricted to one of ReplayableEndpoints. Entries whose payload was
+// cut off, had fields redacted or truncated, or continues a stored conversation are left
+// out, since sending them again would not repeat the original request.
+func (r *Repository) SampleReplayable(endpoint string, n int) ([]QueryLog, error) {
+	if n <= 0 {
+		n = 50
+	}
+
+	endpoints := ReplayableEndpoints
+	if endpoint != "" {
+		endpoints = []string{endpoint}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(endpoints)), ", ")
+	whereClause := fmt.Sprintf(`WHERE status = 'success' AND endpoint IN (%s)
+		AND json_valid(query) AND json_type(query) = 'object'
+		AND json_extract(query, '$.conversation_id') IS NULL
+		AND instr(query, ?) = 0 AND instr(query, ?) = 0`, placeholders)
+	args := make([]any, 0, len(endpoints)+3)
+	for _, e := range endpoints {
+		args = append(args, e)
+	}
+	args = append(args, redactedValue, truncatedSuffix, n)
+
+	sampleQuery := fmt.Sprintf(`
+		SELECT
+			id, user_id, api_key_id, endpoint, query, query_text, response, model_provider,
+			rag_contexts_count, input_tokens, output_tokens, latency_ms, status,
+			error_message, conversation_id, interrupted, cache_status, moderation, moderation_rules,
+			model, cost_usd, user_key, client_ip, user_agent, experiment_id, experiment_variant, created_at
+		FROM query_logs
+		%s
+		ORDER BY RANDOM()
+		LIMIT ?`, whereClause)
+
+	rows, err := r.db.Query(sampleQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("sample query logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := make([]QueryLog, 0, n)
+	for rows.Next() {
+		log, err := scanQueryLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, *log)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate query logs: %w", err)
+	}
+
+	return logs, nil
+}
+
+// TopRequests returns the most frequently logged successful request bodies since the given
+// time, most frequent first, optionally restricted to endpoints.
+func (r *Repository) TopRequests(since time.Time, endpoints []string, limit int) ([]RequestCount, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	whereClause := "WHERE status = 'success' AND created_at >= ? AND query <> ''"
+	args := []any{since}
+	if len(endpoints) > 0 {
+		whereClause += " AND endpoint IN (?" + strings.Repeat(", ?", len(endpoints)-1) + ")"
+		for _, endpoint := range endpoints {
+			args = append(args, endpoint)
+		}
+	}
+	args = append(args, limit)
+
+	rows, err := r.db.Query(fmt.Sprintf(`
+		SELECT query, COUNT(*) AS hits
+		FROM query_logs
+		%s
+		GROUP BY query
+		ORDER BY hits DESC, MAX(created_at) DESC
+		LIMIT ?`, whereClause), args...)
+	if err != nil {
+		return nil, fmt.Errorf("count query log requests: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make([]RequestCount, 0, limit)
+	for rows.Next() {
+		var count RequestCount
+		if err := rows.Scan(&count.Query, &count.Count); err != nil {
+			return nil, fmt.Errorf("scan request count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate request counts: %w", err)
+	}
+
+	return counts, nil
+}
+
+// CompressResponses rewrites uncompressed responses at or above the compression threshold.
+// It processes rows in batches and returns the number of logs rewritten.
+func (r *Repository) CompressResponses(batchSize int) (int, error) {
+	if !compression.Enabled() {
+		return 0, nil
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	const selectBatch = `
+		SELECT id, response
+		FROM query_logs
+		WHERE typeof(response) = 'text' AND length(response) >= ? AND id > ?
+		ORDER BY id
+		LIMIT ?
+	`
+
+	var (
+		total  int
+		lastID int64
+	)
+	for {
+		rows, err := r.db.Query(selectBatch, compression.MinBytes(), lastID, batchSize)
+		if err != nil {
+			return total, fmt.Errorf("select query logs: %w", err)
+		}
+
+		type pending struct {
+			id       int64
+			response string
+		}
+		batch := make([]pending, 0, batchSize)
+		for rows.Next() {
+			var p pending
+			if err := rows.Scan(&p.id, &p.response); err != nil {
+				rows.Close()
+				return total, fmt.Errorf("scan query log: %w", err)
+			}
+			batch = append(batch, p)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return total, fmt.Errorf("iterate query logs: %w", err)
+		}
+		rows.Close()
+
+		if len(batch) == 0 {
+			return total, nil
+		}
+
+		for _, p := range batch {
+			lastID = p.id
+			stored, err := compression.EncodeString(p.response)
+			if err != nil {
+				return total, err
+			}
+			if _, ok := stored.([]byte); !ok {
+				continue
+			}
+			if _, err := r.writer.Exec(context.Background(), `UPDATE query_logs SET response = ? WHERE id = ?`, stored, p.id); err != nil {
+				return total, fmt.Errorf("update query log: %w", err)
+			}
+			total++
+		}
+	}
+}
+
 // DeleteOlderThan removes query log records older than the provided timestamp.
 func (r *Repository) DeleteOlderThan(date time.Time) (int64, error) {
-	res, err := r.db.Exec("DELETE FROM query_logs WHERE created_at < ?", date)
+	res, err := r.writer.Exec(context.Background(), "DELETE FROM query_logs WHERE created_at < ?", date)
 	if err != nil {
 		return 0, fmt.Errorf("delete query logs: %w", err)
 	}
@@ -402,3 +929,149 @@ func (r *Repository) collectCounts(query string, args []any, target map[string]i
 
 	return rows.Err()
 }
+
+// scanQueryLog reads a single query_logs row selected with the standard column list.
+func scanQueryLog(rows *sql.Rows) (*QueryLog, error) {
+	var (
+		log             QueryLog
+		apiKeyID        sql.NullInt64
+		conversationID  sql.NullInt64
+		response        sql.NullString
+		modelProvider   sql.NullString
+		errorMessage    sql.NullString
+		cacheStatus     sql.NullString
+		queryText       sql.NullString
+		moderation      sql.NullString
+		moderationRules sql.NullString
+		model           sql.NullString
+		clientIP        sql.NullString
+		userAgent       sql.NullString
+		experimentID    sql.NullInt64
+		variant         sql.NullString
+	)
+
+	if err := rows.Scan(
+		&log.ID,
+		&log.UserID,
+		&apiKeyID,
+		&log.Endpoint,
+		&log.Query,
+		&queryText,
+		&response,
+		&modelProvider,
+		&log.RAGContextsCount,
+		&log.InputTokens,
+		&log.OutputTokens,
+		&log.LatencyMs,
+		&log.Status,
+		&errorMessage,
+		&conversationID,
+		&log.Interrupted,
+		&cacheStatus,
+		&moderation,
+		&moderationRules,
+		&model,
+		&log.CostUSD,
+		&log.UserKey,
+		&clientIP,
+		&userAgent,
+		&experimentID,
+		&variant,
+		&log.CreatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("scan query log: %w", err)
+	}
+
+	if apiKeyID.Valid {
+		log.APIKeyID = &apiKeyID.Int64
+	}
+	if conversationID.Valid {
+		log.ConversationID = &conversationID.Int64
+	}
+	if response.Valid {
+		decoded, err := compression.DecodeString(response.String)
+		if err != nil {
+			return nil, fmt.Errorf("decode query log response: %w", err)
+		}
+		log.Response = decoded
+	}
+	if modelProvider.Valid {
+		log.ModelProvider = modelProvider.String
+	}
+	if errorMessage.Valid {
+		log.ErrorMessage = errorMessage.String
+	}
+	if cacheStatus.Valid {
+		log.CacheStatus = cacheStatus.String
+	}
+	if queryText.Valid {
+		log.QueryText = queryText.String
+	}
+	if moderation.Valid {
+		log.Moderation = moderation.String
+	}
+	if moderationRules.Valid {
+		log.ModerationRules = moderationRules.String
+	}
+	if model.Valid {
+		log.Model = model.String
+	}
+	if clientIP.Valid {
+		log.ClientIP = clientIP.String
+	}
+	if userAgent.Valid {
+		log.UserAgent = userAgent.String
+	}
+	if experimentID.Valid {
+		log.ExperimentID = &experimentID.Int64
+	}
+	if variant.Valid {
+		log.Variant = variant.String
+	}
+
+	return &log, nil
+}
+
+// listFilter builds the WHERE clause and arguments for the List filters.
+func listFilter(params ListParams) (string, []any) {
+	whereParts := make([]string, 0)
+	args := make([]any, 0)
+
+	if params.UserID != nil {
+		whereParts = append(whereParts, "user_id = ?")
+		args = append(args, *params.UserID)
+	}
+	if params.APIKeyID != nil {
+		whereParts = append(whereParts, "api_key_id = ?")
+		args = append(args, *params.APIKeyID)
+	}
+	if params.Status != "" {
+		whereParts = append(whereParts, "status = ?")
+		args = append(args, params.Status)
+	}
+	if params.Endpoint != "" {
+		whereParts = append(whereParts, "endpoint = ?")
+		args = append(args, params.Endpoint)
+	}
+	if params.ModelProvider != "" {
+		whereParts = append(whereParts, "model_provider = ?")
+		args = append(args, params.ModelProvider)
+	}
+	if params.Moderation != "" {
+		whereParts = append(whereParts, "moderation = ?")
+		args = append(args, params.Moderation)
+	}
+	if params.StartDate != nil {
+		whereParts = append(whereParts, "created_at >= ?")
+		args = append(args, *params.StartDate)
+	}
+	if params.EndDate != nil {
+		whereParts = append(whereParts, "created_at <= ?")
+		args = append(args, *params.EndDate)
+	}
+
+	if len(whereParts) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(whereParts, " AND "), args
+}
@@ -0,0 +1,144 @@
+package querylog_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testutil"
+)
+
+func TestRepositoryCreateAndGet(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	userID := testutil.CreateUser(t, db, "")
+	created := testutil.CreateQueryLog(t, db, userID, func(log *querylog.QueryLog) {
+		log.ClientIP = "203.0.113.7"
+		log.CacheStatus = "miss"
+	})
+	if created.ID == 0 {
+		t.Fatal("Create did not set the ID")
+	}
+
+	repo := querylog.NewRepository(db)
+	got, err := repo.GetByID(created.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.UserID != int64(userID) || got.Query != created.Query || got.Response != created.Response {
+		t.Fatalf("GetByID = %+v, want the created log %+v", got, created)
+	}
+	if got.ClientIP != "203.0.113.7" || got.CacheStatus != "miss" || got.InputTokens != 100 || got.OutputTokens != 50 {
+		t.Fatalf("GetByID lost fields: %+v", got)
+	}
+
+	if _, err := repo.GetByID(created.ID + 1); !errors.Is(err, querylog.ErrNotFound) {
+		t.Fatalf("GetByID of a missing log: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRepositoryListFilters(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	alice := testutil.CreateUser(t, db, "")
+	bob := testutil.CreateUser(t, db, "")
+	testutil.CreateQueryLog(t, db, alice, nil)
+	testutil.CreateQueryLog(t, db, alice, func(log *querylog.QueryLog) {
+		log.Status = "error"
+		log.ErrorMessage = "provider unavailable"
+	})
+	testutil.CreateQueryLog(t, db, bob, func(log *querylog.QueryLog) {
+		log.Endpoint = "/v1/chat/completions"
+		log.ModelProvider = "openai"
+	})
+
+	repo := querylog.NewRepository(db)
+	aliceID := int64(alice)
+	for name, tc := range map[string]struct {
+		params querylog.ListParams
+		want   int
+	}{
+		"all":      {querylog.ListParams{}, 3},
+		"user":     {querylog.ListParams{UserID: &aliceID}, 2},
+		"status":   {querylog.ListParams{Status: "error"}, 1},
+		"endpoint": {querylog.ListParams{Endpoint: "/v1/chat/completions"}, 1},
+		"provider": {querylog.ListParams{ModelProvider: "gemini"}, 2},
+	} {
+		page, err := repo.List(tc.params)
+		if err != nil {
+			t.Fatalf("%s: List: %v", name, err)
+		}
+		if len(page.Logs) != tc.want || page.Total != int64(tc.want) {
+			t.Fatalf("%s: got %d logs (total %d), want %d", name, len(page.Logs), page.Total, tc.want)
+		}
+	}
+}
+
+func TestRepositoryListCursor(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	userID := testutil.CreateUser(t, db, "")
+	for i := 0; i < 5; i++ {
+		testutil.CreateQueryLog(t, db, userID, nil)
+	}
+
+	repo := querylog.NewRepository(db)
+	seen := make(map[int64]bool)
+	params := querylog.ListParams{Limit: 2, After: &querylog.Cursor{CreatedAt: time.Now().Add(time.Hour)}}
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("cursor pagination did not end")
+		}
+		page, err := repo.List(params)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		for _, log := range page.Logs {
+			if seen[log.ID] {
+				t.Fatalf("log %d listed twice", log.ID)
+			}
+			seen[log.ID] = true
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		params.After = page.NextCursor
+	}
+	if len(seen) != 5 {
+		t.Fatalf("listed %d logs, want 5", len(seen))
+	}
+}
+
+func TestRepositoryStatsAndDelete(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	userID := testutil.CreateUser(t, db, "")
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	testutil.CreateQueryLog(t, db, userID, func(log *querylog.QueryLog) { log.CreatedAt = old })
+	testutil.CreateQueryLog(t, db, userID, nil)
+	testutil.CreateQueryLog(t, db, userID, func(log *querylog.QueryLog) { log.Status = "error" })
+
+	repo := querylog.NewRepository(db)
+	stats, err := repo.GetStats(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if stats.TotalQueries != 3 || stats.SuccessCount != 2 || stats.ErrorCount != 1 {
+		t.Fatalf("GetStats = %+v, want 3 queries, 2 successes and 1 error", stats)
+	}
+	if stats.TotalInputTokens != 300 || stats.QueriesByProvider["gemini"] != 3 {
+		t.Fatalf("GetStats = %+v, want 300 input tokens from gemini", stats)
+	}
+
+	deleted, err := repo.DeleteOlderThan(time.Now().UTC().Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("DeleteOlderThan: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("DeleteOlderThan removed %d logs, want 1", deleted)
+	}
+	page, err := repo.List(querylog.ListParams{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if page.Total != 2 {
+		t.Fatalf("%d logs left, want 2", page.Total)
+	}
+}
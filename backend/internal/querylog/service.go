@@ -1,36 +1,544 @@
 package querylog
 
-import "log"
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
-// Service provides asynchronous logging over a buffered channel.
+const (
+	defaultQueueSize     = 1000
+	defaultBatchSize     = 100
+	defaultFlushInterval = time.Second
+	defaultMaxSpillBytes = 64 << 20
+	defaultBlockTimeout  = 50 * time.Millisecond
+
+	// replaySuffix marks a spill file taken over by the worker for replay.
+	replaySuffix = ".replay"
+)
+
+// Overflow strategies for entries that arrive while the queue is full.
+const (
+	// OverflowSpill appends the entry to the spill file, or drops it when spilling is
+	// disabled or the file is full.
+	OverflowSpill = "spill"
+	// OverflowDropOldest drops the oldest queued entry to make room for the new one.
+	OverflowDropOldest = "drop-oldest"
+	// OverflowBlock makes the caller wait up to BlockTimeout for room, then drops the entry.
+	OverflowBlock = "block"
+)
+
+// ServiceConfig controls how query logs are buffered and written.
+type ServiceConfig struct {
+	// QueueSize is how many entries are buffered in memory.
+	QueueSize int
+	// BatchSize is how many entries are written per insert.
+	BatchSize int
+	// FlushInterval is how long a partial batch may wait before it is written.
+	FlushInterval time.Duration
+	// SpillPath is the file entries are appended to while the queue is full, to be written
+	// once it drains. Empty disables spilling, so such entries are dropped.
+	SpillPath string
+	// MaxSpillBytes caps the spill file; entries beyond it are dropped.
+	MaxSpillBytes int64
+	// Overflow is the strategy for entries that do not fit in the queue. It defaults to
+	// OverflowSpill.
+	Overflow string
+	// BlockTimeout is how long OverflowBlock waits for room in the queue.
+	BlockTimeout time.Duration
+}
+
+// ServiceConfigFromEnv loads QUERY_LOG_QUEUE_SIZE, QUERY_LOG_BATCH_SIZE,
+// QUERY_LOG_FLUSH_INTERVAL, QUERY_LOG_SPILL_PATH, QUERY_LOG_SPILL_MAX_BYTES,
+// QUERY_LOG_OVERFLOW and QUERY_LOG_BLOCK_TIMEOUT. The spill file defaults to the temp
+// directory; QUERY_LOG_SPILL_MAX_BYTES=0 disables it. Unknown strategies fall back to spill.
+func ServiceConfigFromEnv() ServiceConfig {
+	cfg := ServiceConfig{
+		QueueSize:     defaultQueueSize,
+		BatchSize:     defaultBatchSize,
+		FlushInterval: defaultFlushInterval,
+		SpillPath:     filepath.Join(os.TempDir(), "stacks-builder-querylog-spill.jsonl"),
+		MaxSpillBytes: defaultMaxSpillBytes,
+		Overflow:      OverflowSpill,
+		BlockTimeout:  defaultBlockTimeout,
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("QUERY_LOG_QUEUE_SIZE"))); err == nil && n > 0 {
+		cfg.QueueSize = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("QUERY_LOG_BATCH_SIZE"))); err == nil && n > 0 {
+		cfg.BatchSize = n
+	}
+	if interval, err := time.ParseDuration(os.Getenv("QUERY_LOG_FLUSH_INTERVAL")); err == nil && interval > 0 {
+		cfg.FlushInterval = interval
+	}
+	if path := strings.TrimSpace(os.Getenv("QUERY_LOG_SPILL_PATH")); path != "" {
+		cfg.SpillPath = path
+	}
+	if n, err := strconv.ParseInt(strings.TrimSpace(os.Getenv("QUERY_LOG_SPILL_MAX_BYTES")), 10, 64); err == nil && n >= 0 {
+		cfg.MaxSpillBytes = n
+		if n == 0 {
+			cfg.SpillPath = ""
+		}
+	}
+	if strategy := strings.ToLower(strings.TrimSpace(os.Getenv("QUERY_LOG_OVERFLOW"))); strategy != "" {
+		if validOverflow(strategy) {
+			cfg.Overflow = strategy
+		} else {
+			log.Printf("querylog: unknown QUERY_LOG_OVERFLOW %q, using %s", strategy, OverflowSpill)
+		}
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("QUERY_LOG_BLOCK_TIMEOUT")); err == nil && timeout > 0 {
+		cfg.BlockTimeout = timeout
+	}
+	return cfg
+}
+
+func validOverflow(strategy string) bool {
+	switch strategy {
+	case OverflowSpill, OverflowDropOldest, OverflowBlock:
+		return true
+	}
+	return false
+}
+
+// ServiceStats counts query log entries through the write pipeline. Received counts every
+// entry logged; DropRate is the share of them that was dropped.
+type ServiceStats struct {
+	Overflow      string  `json:"overflow"`
+	Received      int64   `json:"received"`
+	Enqueued      int64   `json:"enqueued"`
+	Persisted     int64   `json:"persisted"`
+	Batches       int64   `json:"batches"`
+	Spilled       int64   `json:"spilled"`
+	Replayed      int64   `json:"replayed"`
+	Dropped       int64   `json:"dropped"`
+	Failed        int64   `json:"failed"`
+	Blocked       int64   `json:"blocked"`
+	DropRate      float64 `json:"drop_rate"`
+	QueueLength   int     `json:"queue_length"`
+	QueueCapacity int     `json:"queue_capacity"`
+	SpillBytes    int64   `json:"spill_bytes"`
+}
+
+// Service writes query logs asynchronously in batches. By default entries that do not fit
+// in the queue are spilled to a file and written once the queue drains, so a burst does not
+// slow down requests or lose entries. An entry is written at least once: one spilled just
+// before a crash may be written twice.
 type Service struct {
 	repo    *Repository
+	cfg     ServiceConfig
 	logChan chan *QueryLog
+	flushes chan chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+
+	// mu guards closed so no entry is queued after the worker has stopped.
+	mu     sync.RWMutex
+	closed bool
+
+	spillMu    sync.Mutex
+	spillFile  *os.File
+	spillBytes int64
+
+	received  atomic.Int64
+	enqueued  atomic.Int64
+	persisted atomic.Int64
+	batches   atomic.Int64
+	spilled   atomic.Int64
+	replayed  atomic.Int64
+	dropped   atomic.Int64
+	failed    atomic.Int64
+	blocked   atomic.Int64
 }
 
-// NewService constructs a Service with a buffered channel and background worker.
-func NewService(repo *Repository) *Service {
+// NewService constructs a Service and starts its worker. Zero sizes and intervals fall back
+// to the defaults. A spill file left by a previous run is written once the queue is idle.
+func NewService(repo *Repository, cfg ServiceConfig) *Service {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.MaxSpillBytes <= 0 {
+		cfg.MaxSpillBytes = defaultMaxSpillBytes
+	}
+	if !validOverflow(cfg.Overflow) {
+		cfg.Overflow = OverflowSpill
+	}
+	if cfg.BlockTimeout <= 0 {
+		cfg.BlockTimeout = defaultBlockTimeout
+	}
+
 	s := &Service{
 		repo:    repo,
-		logChan: make(chan *QueryLog, 1000),
+		cfg:     cfg,
+		logChan: make(chan *QueryLog, cfg.QueueSize),
+		flushes: make(chan chan struct{}),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	if cfg.SpillPath != "" {
+		if info, err := os.Stat(cfg.SpillPath); err == nil {
+			s.spillBytes = info.Size()
+		}
 	}
-	go s.processLogs()
+	go s.run()
 	return s
 }
 
-// LogAsync enqueues a log entry without blocking callers.
-func (s *Service) LogAsync(log *QueryLog) {
+// LogAsync enqueues a log entry. When the queue is full the configured overflow strategy
+// applies; only OverflowBlock makes callers wait. Once the service is closed entries are
+// spilled to disk, or dropped if that is not possible.
+func (s *Service) LogAsync(entry *QueryLog) {
+	if entry == nil {
+		return
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	s.received.Add(1)
+
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		s.spill(entry)
+		return
+	}
+	defer s.mu.RUnlock()
+
+	if s.tryEnqueue(entry) {
+		return
+	}
+	switch s.cfg.Overflow {
+	case OverflowDropOldest:
+		s.replaceOldest(entry)
+	case OverflowBlock:
+		s.enqueueWithTimeout(entry)
+	default:
+		s.spill(entry)
+	}
+}
+
+func (s *Service) tryEnqueue(entry *QueryLog) bool {
 	select {
-	case s.logChan <- log:
+	case s.logChan <- entry:
+		s.enqueued.Add(1)
+		return true
 	default:
-		// Drop when buffer is full to avoid backpressure on request path.
+		return false
 	}
 }
 
-func (s *Service) processLogs() {
-	for logEntry := range s.logChan {
-		if err := s.repo.Create(logEntry); err != nil {
+// replaceOldest drops queued entries until entry fits. The worker may take entries
+// meanwhile, so it gives up after a few attempts and drops entry instead.
+func (s *Service) replaceOldest(entry *QueryLog) {
+	for range 3 {
+		select {
+		case <-s.logChan:
+			s.drop("queue full, dropped oldest")
+		default:
+		}
+		if s.tryEnqueue(entry) {
+			return
+		}
+	}
+	s.drop("queue full")
+}
+
+// enqueueWithTimeout waits up to BlockTimeout for room in the queue, then drops entry. The
+// read lock is held while waiting, so Close waits for blocked callers.
+func (s *Service) enqueueWithTimeout(entry *QueryLog) {
+	s.blocked.Add(1)
+	timer := time.NewTimer(s.cfg.BlockTimeout)
+	defer timer.Stop()
+
+	select {
+	case s.logChan <- entry:
+		s.enqueued.Add(1)
+	case <-timer.C:
+		s.drop("queue full after waiting " + s.cfg.BlockTimeout.String())
+	}
+}
+
+// Flush writes every entry queued or spilled before the call, or returns when ctx is done.
+func (s *Service) Flush(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case s.flushes <- reply:
+	case <-s.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-reply:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close writes the queued entries and stops the worker, or returns when ctx is done.
+// Entries logged afterwards are spilled and written by the next run. Spilled entries are
+// not written on close, which could outlast a shutdown deadline.
+func (s *Service) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+	if s.spillFile != nil {
+		err := s.spillFile.Close()
+		s.spillFile = nil
+		return err
+	}
+	return nil
+}
+
+// Stats returns the pipeline counters.
+func (s *Service) Stats() ServiceStats {
+	s.spillMu.Lock()
+	spillBytes := s.spillBytes
+	s.spillMu.Unlock()
+
+	received := s.received.Load()
+	dropped := s.dropped.Load()
+	var dropRate float64
+	if received > 0 {
+		dropRate = float64(dropped) / float64(received)
+	}
+
+	return ServiceStats{
+		Overflow:      s.cfg.Overflow,
+		Received:      received,
+		Enqueued:      s.enqueued.Load(),
+		Persisted:     s.persisted.Load(),
+		Batches:       s.batches.Load(),
+		Spilled:       s.spilled.Load(),
+		Replayed:      s.replayed.Load(),
+		Dropped:       dropped,
+		Failed:        s.failed.Load(),
+		Blocked:       s.blocked.Load(),
+		DropRate:      dropRate,
+		QueueLength:   len(s.logChan),
+		QueueCapacity: cap(s.logChan),
+		SpillBytes:    spillBytes,
+	}
+}
+
+func (s *Service) run() {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*QueryLog, 0, s.cfg.BatchSize)
+	for {
+		select {
+		case entry := <-s.logChan:
+			batch = append(batch, entry)
+			if len(batch) >= s.cfg.BatchSize {
+				batch = s.write(batch)
+			}
+		case <-ticker.C:
+			batch = s.write(batch)
+			if len(s.logChan) == 0 {
+				s.replaySpill()
+			}
+		case reply := <-s.flushes:
+			batch = s.write(s.drain(batch))
+			s.replaySpill()
+			close(reply)
+		case <-s.done:
+			s.write(s.drain(batch))
+			return
+		}
+	}
+}
+
+// drain moves the queued entries into batch, writing each batch that fills up.
+func (s *Service) drain(batch []*QueryLog) []*QueryLog {
+	for {
+		select {
+		case entry := <-s.logChan:
+			batch = append(batch, entry)
+			if len(batch) >= s.cfg.BatchSize {
+				batch = s.write(batch)
+			}
+		default:
+			return batch
+		}
+	}
+}
+
+// write inserts batch and returns it emptied. When the batch insert fails, entries are
+// inserted one by one so a single bad entry does not take the others with it.
+func (s *Service) write(batch []*QueryLog) []*QueryLog {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	err := s.repo.CreateBatch(context.Background(), batch)
+	if err == nil {
+		s.persisted.Add(int64(len(batch)))
+		s.batches.Add(1)
+		return batch[:0]
+	}
+	log.Printf("querylog: batch insert failed, retrying entries individually: %v", err)
+
+	for _, entry := range batch {
+		if err := s.repo.Create(entry); err != nil {
+			s.failed.Add(1)
 			log.Printf("querylog: failed to persist query log: %v", err)
+			continue
+		}
+		s.persisted.Add(1)
+	}
+	return batch[:0]
+}
+
+// spill appends entry to the spill file, or drops it when spilling is disabled, the file is
+// full or it cannot be written.
+func (s *Service) spill(entry *QueryLog) {
+	if s.cfg.SpillPath == "" {
+		s.drop("queue full")
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		s.drop("encode: " + err.Error())
+		return
+	}
+	line = append(line, '\n')
+
+	s.spillMu.Lock()
+	defer s.spillMu.Unlock()
+
+	if s.spillBytes+int64(len(line)) > s.cfg.MaxSpillBytes {
+		s.drop("spill file full")
+		return
+	}
+	if s.spillFile == nil {
+		f, err := os.OpenFile(s.cfg.SpillPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			s.drop("open spill file: " + err.Error())
+			return
+		}
+		s.spillFile = f
+	}
+	if _, err := s.spillFile.Write(line); err != nil {
+		s.drop("write spill file: " + err.Error())
+		return
+	}
+	s.spillBytes += int64(len(line))
+	s.spilled.Add(1)
+}
+
+// drop counts a lost entry, logging the first and then every thousandth.
+func (s *Service) drop(reason string) {
+	if n := s.dropped.Add(1); n%1000 == 1 {
+		log.Printf("querylog: dropped query log (%s), %d dropped so far", reason, n)
+	}
+}
+
+// replaySpill writes the spilled entries. The spill file is moved aside first so entries
+// spilled meanwhile start a new file; a moved file left by an interrupted run is replayed
+// before it.
+func (s *Service) replaySpill() {
+	if s.cfg.SpillPath == "" {
+		return
+	}
+	replayPath := s.cfg.SpillPath + replaySuffix
+
+	s.spillMu.Lock()
+	if _, err := os.Stat(replayPath); errors.Is(err, fs.ErrNotExist) {
+		if s.spillBytes == 0 {
+			s.spillMu.Unlock()
+			return
+		}
+		if s.spillFile != nil {
+			s.spillFile.Close()
+			s.spillFile = nil
+		}
+		if err := os.Rename(s.cfg.SpillPath, replayPath); err != nil {
+			s.spillMu.Unlock()
+			log.Printf("querylog: failed to take over spill file: %v", err)
+			return
+		}
+		s.spillBytes = 0
+	}
+	s.spillMu.Unlock()
+
+	if err := s.replayFile(replayPath); err != nil {
+		log.Printf("querylog: failed to replay spill file: %v", err)
+		return
+	}
+	if err := os.Remove(replayPath); err != nil {
+		log.Printf("querylog: failed to remove replayed spill file: %v", err)
+	}
+}
+
+func (s *Service) replayFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	batch := make([]*QueryLog, 0, s.cfg.BatchSize)
+	flush := func() {
+		s.replayed.Add(int64(len(batch)))
+		batch = s.write(batch)
+	}
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			var entry QueryLog
+			if decodeErr := json.Unmarshal(line, &entry); decodeErr != nil {
+				// A line cut short by a crash mid-write cannot be recovered.
+				s.failed.Add(1)
+			} else {
+				batch = append(batch, &entry)
+				if len(batch) >= s.cfg.BatchSize {
+					flush()
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
 		}
 	}
+	flush()
+	return nil
 }
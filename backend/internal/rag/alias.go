@@ -0,0 +1,80 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// Collection aliases point the collections retrieval and ingestion name, CodeCollection and
+// DocsCollection, at the physical collections holding their documents. A reindex builds a
+// new physical collection beside the active one and switches the alias once it is complete,
+// so searches never see a partially built collection.
+var collectionAliases = struct {
+	mu      sync.RWMutex
+	targets map[string]string
+}{targets: make(map[string]string)}
+
+// physicalNamePattern matches the names of collections built by a reindex.
+var physicalNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{2,62}$`)
+
+// ActiveCollection returns the physical collection the collection currently resolves to. Names
+// without an alias resolve to themselves.
+func ActiveCollection(collection string) string {
+	collectionAliases.mu.RLock()
+	defer collectionAliases.mu.RUnlock()
+	if target, ok := collectionAliases.targets[collection]; ok {
+		return target
+	}
+	return collection
+}
+
+// SetCollectionAlias points the collection at target. Pointing it at itself removes the alias.
+func SetCollectionAlias(collection, target string) error {
+	if collection != CodeCollection && collection != DocsCollection {
+		return fmt.Errorf("unknown collection %q", collection)
+	}
+	if !physicalNamePattern.MatchString(target) {
+		return fmt.Errorf("invalid collection name %q", target)
+	}
+
+	collectionAliases.mu.Lock()
+	defer collectionAliases.mu.Unlock()
+	if target == collection {
+		delete(collectionAliases.targets, collection)
+	} else {
+		collectionAliases.targets[collection] = target
+	}
+	return nil
+}
+
+// aliasedStore resolves collection aliases before every call to the wrapped store except
+// Drop, which always names a physical collection.
+type aliasedStore struct {
+	VectorStore
+}
+
+func (s aliasedStore) Query(ctx context.Context, collection string, embedding []float32, nResults int, repos []string) ([]Match, error) {
+	return s.VectorStore.Query(ctx, ActiveCollection(collection), embedding, nResults, repos)
+}
+
+func (s aliasedStore) Upsert(ctx context.Context, collection string, docs []Document) error {
+	return s.VectorStore.Upsert(ctx, ActiveCollection(collection), docs)
+}
+
+func (s aliasedStore) Scan(ctx context.Context, collection string, filter MetadataFilter, fn func([]Match) error) error {
+	return s.VectorStore.Scan(ctx, ActiveCollection(collection), filter, fn)
+}
+
+func (s aliasedStore) ScanContent(ctx context.Context, collection string, fn func([]Match) error) error {
+	return s.VectorStore.ScanContent(ctx, ActiveCollection(collection), fn)
+}
+
+func (s aliasedStore) Delete(ctx context.Context, collection string, filter MetadataFilter) (int, error) {
+	return s.VectorStore.Delete(ctx, ActiveCollection(collection), filter)
+}
+
+func (s aliasedStore) Describe(ctx context.Context, collection string, samples int) (CollectionInfo, error) {
+	return s.VectorStore.Describe(ctx, ActiveCollection(collection), samples)
+}
@@ -0,0 +1,528 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultChromaURL      = "http://localhost:8000"
+	defaultChromaTenant   = "default_tenant"
+	defaultChromaDatabase = "default_database"
+	defaultChromaMaxConns = 16
+)
+
+// ChromaConfig configures the native ChromaDB HTTP client.
+type ChromaConfig struct {
+	URL      string
+	Tenant   string
+	Database string
+	// APIVersion selects the server REST API ("v2" for Chroma 0.6+/1.x, "v1" for older servers).
+	APIVersion string
+	AuthToken  string
+	Timeout    time.Duration
+	// MaxConns bounds the pooled connections kept open to the server.
+	MaxConns int
+}
+
+// ChromaConfigFromEnv loads the ChromaDB client configuration from environment variables.
+func ChromaConfigFromEnv() ChromaConfig {
+	cfg := ChromaConfig{
+		URL:        os.Getenv("CHROMA_URL"),
+		Tenant:     os.Getenv("CHROMA_TENANT"),
+		Database:   os.Getenv("CHROMA_DATABASE"),
+		APIVersion: strings.ToLower(os.Getenv("CHROMA_API_VERSION")),
+		AuthToken:  os.Getenv("CHROMA_AUTH_TOKEN"),
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("CHROMA_TIMEOUT")); err == nil && timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	if conns, err := strconv.Atoi(os.Getenv("CHROMA_MAX_CONNS")); err == nil && conns > 0 {
+		cfg.MaxConns = conns
+	}
+	return cfg
+}
+
+// ChromaClient is a VectorStore backed by a ChromaDB server, queried directly over HTTP
+// instead of spawning Python.
+type ChromaClient struct {
+	cfg    ChromaConfig
+	client *http.Client
+
+	mu            sync.RWMutex
+	collectionIDs map[string]string
+}
+
+// NewChromaClient creates a client with a pooled HTTP transport.
+func NewChromaClient(cfg ChromaConfig, httpClient *http.Client) (*ChromaClient, error) {
+	if cfg.URL == "" {
+		cfg.URL = defaultChromaURL
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	if cfg.Tenant == "" {
+		cfg.Tenant = defaultChromaTenant
+	}
+	if cfg.Database == "" {
+		cfg.Database = defaultChromaDatabase
+	}
+	switch cfg.APIVersion {
+	case "":
+		cfg.APIVersion = "v2"
+	case "v1", "v2":
+	default:
+		return nil, fmt.Errorf("unsupported ChromaDB API version %q", cfg.APIVersion)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultStoreTimeout
+	}
+	if cfg.MaxConns <= 0 {
+		cfg.MaxConns = defaultChromaMaxConns
+	}
+	if httpClient == nil {
+		httpClient = NewPooledHTTPClient(cfg.MaxConns)
+	}
+
+	return &ChromaClient{
+		cfg:           cfg,
+		client:        httpClient,
+		collectionIDs: make(map[string]string),
+	}, nil
+}
+
+// NewPooledHTTPClient returns an HTTP client that keeps up to maxConns idle connections per host.
+func NewPooledHTTPClient(maxConns int) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxConns
+	transport.MaxIdleConnsPerHost = maxConns
+	transport.MaxConnsPerHost = maxConns
+	transport.IdleConnTimeout = 90 * time.Second
+	return &http.Client{Transport: transport}
+}
+
+// HealthCheck verifies the ChromaDB server is reachable.
+func (cc *ChromaClient) HealthCheck(ctx context.Context) error {
+	_, err := cc.do(ctx, http.MethodGet, "/api/"+cc.cfg.APIVersion+"/heartbeat", nil)
+	return err
+}
+
+// Name identifies the store in logs and errors.
+func (cc *ChromaClient) Name() string {
+	return BackendChroma
+}
+
+// Query returns the documents of the named collection nearest to the embedding.
+func (cc *ChromaClient) Query(ctx context.Context, name string, embedding []float32, nResults int, repos []string) ([]Match, error) {
+	// Collections are recreated by re-ingestion, so a stale cached id is retried once.
+	for attempt := 0; attempt < 2; attempt++ {
+		id, err := cc.collectionID(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		matches, err := cc.query(ctx, id, embedding, nResults, repos)
+		if errors.Is(err, errCollectionNotFound) {
+			cc.forgetCollection(name)
+			continue
+		}
+		return matches, err
+	}
+	return nil, errCollectionNotFound
+}
+
+func (cc *ChromaClient) query(ctx context.Context, collectionID string, embedding []float32, nResults int, repos []string) ([]Match, error) {
+	payload := map[string]any{
+		"query_embeddings": [][]float32{embedding},
+		"n_results":        nResults,
+		"include":          []string{"documents", "metadatas", "distances"},
+	}
+	if len(repos) > 0 {
+		payload["where"] = map[string]any{MetadataRepo: map[string]any{"$in": repos}}
+	}
+
+	data, err := cc.do(ctx, http.MethodPost, cc.collectionsPath()+"/"+url.PathEscape(collectionID)+"/query", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		IDs       [][]string         `json:"ids"`
+		Documents [][]*string        `json:"documents"`
+		Metadatas [][]map[string]any `json:"metadatas"`
+		Distances [][]*float64       `json:"distances"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("parse ChromaDB query response: %w", err)
+	}
+
+	matches := make([]Match, 0, nResults)
+	if len(result.Documents) == 0 {
+		return matches, nil
+	}
+	for i, doc := range result.Documents[0] {
+		if doc == nil {
+			continue
+		}
+		match := Match{Content: *doc}
+		if len(result.IDs) > 0 && i < len(result.IDs[0]) {
+			match.ID = result.IDs[0][i]
+		}
+		if len(result.Distances) > 0 && i < len(result.Distances[0]) && result.Distances[0][i] != nil {
+			match.Distance = *result.Distances[0][i]
+		}
+		if len(result.Metadatas) > 0 && i < len(result.Metadatas[0]) {
+			match.Metadata = result.Metadatas[0][i]
+		}
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+// Upsert writes documents into the named collection, creating it when it does not exist.
+func (cc *ChromaClient) Upsert(ctx context.Context, name string, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cc.cfg.Timeout)
+	defer cancel()
+
+	ids := make([]string, len(docs))
+	documents := make([]string, len(docs))
+	embeddings := make([][]float32, len(docs))
+	metadatas := make([]map[string]any, len(docs))
+	for i, doc := range docs {
+		ids[i], documents[i], embeddings[i] = doc.ID, doc.Content, doc.Embedding
+		// Chroma rejects empty metadata objects but accepts null.
+		if len(doc.Metadata) > 0 {
+			metadatas[i] = doc.Metadata
+		}
+	}
+	payload := map[string]any{
+		"ids":        ids,
+		"documents":  documents,
+		"embeddings": embeddings,
+		"metadatas":  metadatas,
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		id, err := cc.createCollection(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		_, err = cc.do(ctx, http.MethodPost, cc.collectionsPath()+"/"+url.PathEscape(id)+"/upsert", payload)
+		if errors.Is(err, errCollectionNotFound) {
+			cc.forgetCollection(name)
+			continue
+		}
+		return err
+	}
+	return errCollectionNotFound
+}
+
+// Scan pages through the ids and metadata of the named collection's documents matching filter.
+func (cc *ChromaClient) Scan(ctx context.Context, name string, filter MetadataFilter, fn func([]Match) error) error {
+	return cc.scan(ctx, name, filter, false, fn)
+}
+
+// ScanContent pages through every document of the named collection with its content.
+func (cc *ChromaClient) ScanContent(ctx context.Context, name string, fn func([]Match) error) error {
+	return cc.scan(ctx, name, MetadataFilter{}, true, fn)
+}
+
+func (cc *ChromaClient) scan(ctx context.Context, name string, filter MetadataFilter, withContent bool, fn func([]Match) error) error {
+	include := []string{"metadatas"}
+	if withContent {
+		include = append(include, "documents")
+	}
+
+	id, err := cc.collectionID(ctx, name)
+	if errors.Is(err, errCollectionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for offset := 0; ; offset += scanPageSize {
+		payload := map[string]any{
+			"limit":   scanPageSize,
+			"offset":  offset,
+			"include": include,
+		}
+		if filter.Key != "" {
+			payload["where"] = map[string]any{filter.Key: filter.Value}
+		}
+
+		data, err := cc.do(ctx, http.MethodPost, cc.collectionsPath()+"/"+url.PathEscape(id)+"/get", payload)
+		if errors.Is(err, errCollectionNotFound) {
+			cc.forgetCollection(name)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var result struct {
+			IDs       []string         `json:"ids"`
+			Documents []string         `json:"documents"`
+			Metadatas []map[string]any `json:"metadatas"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("parse ChromaDB get response: %w", err)
+		}
+
+		page := make([]Match, len(result.IDs))
+		for i, docID := range result.IDs {
+			page[i].ID = docID
+			if i < len(result.Documents) {
+				page[i].Content = result.Documents[i]
+			}
+			if i < len(result.Metadatas) {
+				page[i].Metadata = result.Metadatas[i]
+			}
+		}
+		if len(page) > 0 {
+			if err := fn(page); err != nil {
+				return err
+			}
+		}
+		if len(result.IDs) < scanPageSize {
+			return nil
+		}
+	}
+}
+
+// Delete removes the named collection's documents matching filter. The ids are collected
+// first so the count is exact on servers whose delete endpoint does not report it.
+func (cc *ChromaClient) Delete(ctx context.Context, name string, filter MetadataFilter) (int, error) {
+	if filter.Key == "" {
+		return 0, errEmptyDeleteFilter
+	}
+
+	var ids []string
+	err := cc.Scan(ctx, name, filter, func(page []Match) error {
+		for _, match := range page {
+			ids = append(ids, match.ID)
+		}
+		return nil
+	})
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	id, err := cc.collectionID(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	for start := 0; start < len(ids); start += scanPageSize {
+		batch := ids[start:min(start+scanPageSize, len(ids))]
+		if _, err := cc.do(ctx, http.MethodPost, cc.collectionsPath()+"/"+url.PathEscape(id)+"/delete", map[string]any{"ids": batch}); err != nil {
+			return start, err
+		}
+	}
+	return len(ids), nil
+}
+
+// Drop deletes the named collection.
+func (cc *ChromaClient) Drop(ctx context.Context, name string) error {
+	cc.forgetCollection(name)
+	_, err := cc.do(ctx, http.MethodDelete, cc.collectionsPath()+"/"+url.PathEscape(name), nil)
+	if errors.Is(err, errCollectionNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Describe counts the named collection's documents and reads the first ones, whose
+// embeddings give the collection's dimension.
+func (cc *ChromaClient) Describe(ctx context.Context, name string, samples int) (CollectionInfo, error) {
+	info := CollectionInfo{Name: name}
+	id, err := cc.collectionID(ctx, name)
+	if errors.Is(err, errCollectionNotFound) {
+		return info, nil
+	}
+	if err != nil {
+		return info, err
+	}
+
+	path := cc.collectionsPath() + "/" + url.PathEscape(id)
+	data, err := cc.do(ctx, http.MethodGet, path+"/count", nil)
+	if errors.Is(err, errCollectionNotFound) {
+		cc.forgetCollection(name)
+		return info, nil
+	}
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info.Documents); err != nil {
+		return info, fmt.Errorf("parse ChromaDB count response: %w", err)
+	}
+	info.Exists = true
+	if info.Documents == 0 {
+		return info, nil
+	}
+
+	data, err = cc.do(ctx, http.MethodPost, path+"/get", map[string]any{
+		"limit":   max(samples, 1),
+		"include": []string{"documents", "metadatas", "embeddings"},
+	})
+	if err != nil {
+		return info, err
+	}
+	var result struct {
+		IDs        []string         `json:"ids"`
+		Documents  []string         `json:"documents"`
+		Metadatas  []map[string]any `json:"metadatas"`
+		Embeddings [][]float32      `json:"embeddings"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return info, fmt.Errorf("parse ChromaDB get response: %w", err)
+	}
+	if len(result.Embeddings) > 0 {
+		info.Dimension = len(result.Embeddings[0])
+	}
+	for i := 0; i < len(result.IDs) && i < samples; i++ {
+		sample := SampleDocument{ID: result.IDs[i]}
+		if i < len(result.Documents) {
+			sample.Content = result.Documents[i]
+		}
+		if i < len(result.Metadatas) {
+			sample.Metadata = result.Metadatas[i]
+		}
+		info.Samples = append(info.Samples, sample)
+	}
+	return info, nil
+}
+
+// createCollection returns the id of the named collection, creating it when needed.
+func (cc *ChromaClient) createCollection(ctx context.Context, name string) (string, error) {
+	id, err := cc.collectionID(ctx, name)
+	if !errors.Is(err, errCollectionNotFound) {
+		return id, err
+	}
+
+	data, err := cc.do(ctx, http.MethodPost, cc.collectionsPath(), map[string]any{
+		"name":          name,
+		"get_or_create": true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var collection struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return "", fmt.Errorf("parse ChromaDB collection: %w", err)
+	}
+
+	cc.mu.Lock()
+	cc.collectionIDs[name] = collection.ID
+	cc.mu.Unlock()
+	return collection.ID, nil
+}
+
+func (cc *ChromaClient) collectionID(ctx context.Context, name string) (string, error) {
+	cc.mu.RLock()
+	id, ok := cc.collectionIDs[name]
+	cc.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	data, err := cc.do(ctx, http.MethodGet, cc.collectionsPath()+"/"+url.PathEscape(name), nil)
+	if err != nil {
+		return "", err
+	}
+
+	var collection struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return "", fmt.Errorf("parse ChromaDB collection: %w", err)
+	}
+	if collection.ID == "" {
+		return "", errCollectionNotFound
+	}
+
+	cc.mu.Lock()
+	cc.collectionIDs[name] = collection.ID
+	cc.mu.Unlock()
+	return collection.ID, nil
+}
+
+func (cc *ChromaClient) forgetCollection(name string) {
+	cc.mu.Lock()
+	delete(cc.collectionIDs, name)
+	cc.mu.Unlock()
+}
+
+func (cc *ChromaClient) collectionsPath() string {
+	if cc.cfg.APIVersion == "v1" {
+		return "/api/v1/collections"
+	}
+	return fmt.Sprintf("/api/v2/tenants/%s/databases/%s/collections",
+		url.PathEscape(cc.cfg.Tenant), url.PathEscape(cc.cfg.Database))
+}
+
+func (cc *ChromaClient) do(ctx context.Context, method, path string, payload any) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("marshal ChromaDB request: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, cc.cfg.URL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("build ChromaDB request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cc.cfg.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cc.cfg.AuthToken)
+	}
+
+	resp, err := cc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ChromaDB request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read ChromaDB response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound || isCollectionMissing(resp.StatusCode, data) {
+		return nil, errCollectionNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("ChromaDB returned %d: %s", resp.StatusCode, truncate(string(data), 500))
+	}
+	return data, nil
+}
+
+// isCollectionMissing detects older servers that report missing collections with a 500/400.
+func isCollectionMissing(status int, body []byte) bool {
+	if status < 400 {
+		return false
+	}
+	text := strings.ToLower(string(body))
+	return strings.Contains(text, "does not exist") || strings.Contains(text, "not found")
+}
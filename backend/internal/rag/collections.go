@@ -0,0 +1,153 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// maxCollectionSamples bounds the sample documents returned by Describe.
+	maxCollectionSamples = 20
+	// sampleContentChars bounds the content of a sample document.
+	sampleContentChars = 500
+)
+
+// Collections lists the collections written by ingestion, in the order they are searched.
+var Collections = []string{CodeCollection, DocsCollection}
+
+// CollectionName resolves a collection by its full name or its filter alias, "code" or
+// "docs". It reports false for unknown collections.
+func CollectionName(name string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case CodeCollection, FilterCollectionCode:
+		return CodeCollection, true
+	case DocsCollection, FilterCollectionDocs:
+		return DocsCollection, true
+	default:
+		return "", false
+	}
+}
+
+// CollectionInfo describes a vector store collection.
+type CollectionInfo struct {
+	Name string `json:"name"`
+	// Exists is false for collections nothing has been ingested into yet.
+	Exists    bool `json:"exists"`
+	Documents int  `json:"documents"`
+	// Dimension is the length of the stored embeddings, zero when the collection is empty.
+	Dimension int              `json:"dimension,omitempty"`
+	Samples   []SampleDocument `json:"samples,omitempty"`
+}
+
+// SampleDocument is a stored document shown as an example of a collection's contents.
+// Content is truncated.
+type SampleDocument struct {
+	ID       string         `json:"id"`
+	Content  string         `json:"content"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// CollectionStats breaks a collection's documents down by their ingestion metadata.
+type CollectionStats struct {
+	CollectionInfo
+	// Repos counts documents per repo metadata; documents ingested before it was recorded
+	// are counted under "".
+	Repos     map[string]int `json:"repos"`
+	FileTypes map[string]int `json:"file_types"`
+	Files     int            `json:"files"`
+	// Contracts and Functions count the distinct Clarity contracts and the chunks that
+	// start with a public or read-only function.
+	Contracts int `json:"contracts"`
+	Functions int `json:"functions"`
+}
+
+// Describe returns the document count, embedding dimension and up to samples documents of
+// the collection.
+func (ix *Indexer) Describe(ctx context.Context, collection string, samples int) (CollectionInfo, error) {
+	samples = min(max(samples, 0), maxCollectionSamples)
+	info, err := ix.store.Describe(ctx, collection, samples)
+	if err != nil {
+		return info, fmt.Errorf("describe %s in %s: %w", collection, ix.store.Name(), err)
+	}
+	info.Name = collection
+	for i := range info.Samples {
+		info.Samples[i].Content = truncate(info.Samples[i].Content, sampleContentChars)
+	}
+	return info, nil
+}
+
+// Stats describes the collection and counts its documents by repository, file type, file
+// and Clarity contract.
+func (ix *Indexer) Stats(ctx context.Context, collection string, samples int) (CollectionStats, error) {
+	info, err := ix.Describe(ctx, collection, samples)
+	if err != nil {
+		return CollectionStats{}, err
+	}
+
+	stats := CollectionStats{
+		CollectionInfo: info,
+		Repos:          make(map[string]int),
+		FileTypes:      make(map[string]int),
+	}
+	files := make(map[string]bool)
+	contracts := make(map[string]bool)
+	err = ix.store.Scan(ctx, collection, MetadataFilter{}, func(page []Match) error {
+		for _, match := range page {
+			source := SourceFromMetadata(match.Metadata)
+			stats.Repos[metadataString(match.Metadata, MetadataRepo)]++
+			if fileType := metadataString(match.Metadata, "file_type"); fileType != "" {
+				stats.FileTypes[fileType]++
+			}
+			if source.FilePath != "" {
+				files[source.FilePath] = true
+			}
+			if source.Contract != "" {
+				contracts[source.Repo+"\x00"+source.FilePath] = true
+			}
+			if source.Function != "" {
+				stats.Functions++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return CollectionStats{}, fmt.Errorf("scan %s in %s: %w", collection, ix.store.Name(), err)
+	}
+	stats.Files = len(files)
+	stats.Contracts = len(contracts)
+	return stats, nil
+}
+
+// Copy embeds every document of the from collection again and stores it in the to
+// collection, calling onProgress with the running count after each page. It returns the
+// number of documents copied.
+func (ix *Indexer) Copy(ctx context.Context, from, to string, onProgress func(copied int)) (int, error) {
+	copied := 0
+	err := ix.store.ScanContent(ctx, from, func(page []Match) error {
+		docs := make([]Document, 0, len(page))
+		for _, match := range page {
+			docs = append(docs, Document{ID: match.ID, Content: match.Content, Metadata: match.Metadata})
+		}
+		if err := ix.Index(ctx, to, docs); err != nil {
+			return err
+		}
+		copied += len(docs)
+		if onProgress != nil {
+			onProgress(copied)
+		}
+		return nil
+	})
+	if err != nil {
+		return copied, fmt.Errorf("copy %s to %s in %s: %w", from, to, ix.store.Name(), err)
+	}
+	return copied, nil
+}
+
+// Drop removes the physical collection, ignoring aliases.
+func (ix *Indexer) Drop(ctx context.Context, collection string) error {
+	if err := ix.store.Drop(ctx, collection); err != nil {
+		return fmt.Errorf("drop %s in %s: %w", collection, ix.store.Name(), err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Embedding request formats supported by HTTPEmbedder.
+const (
+	// EmbeddingFormatTEI is the Hugging Face text-embeddings-inference /embed format.
+	EmbeddingFormatTEI = "tei"
+	// EmbeddingFormatOpenAI is the OpenAI-compatible /v1/embeddings format.
+	EmbeddingFormatOpenAI = "openai"
+)
+
+// Embedder turns query text into vectors. It must use the same model the collections
+// were ingested with (all-MiniLM-L6-v2 for the bundled ingestion scripts).
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// HTTPEmbedder calls an embedding server over HTTP.
+type HTTPEmbedder struct {
+	url    string
+	format string
+	model  string
+	apiKey string
+	client *http.Client
+}
+
+// NewHTTPEmbedder returns an embedder for the given endpoint and request format.
+func NewHTTPEmbedder(url, format, model, apiKey string, client *http.Client) *HTTPEmbedder {
+	if format == "" {
+		format = EmbeddingFormatTEI
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPEmbedder{url: url, format: format, model: model, apiKey: apiKey, client: client}
+}
+
+// NewHTTPEmbedderFromEnv loads the embedder configuration from environment variables.
+func NewHTTPEmbedderFromEnv(client *http.Client) (*HTTPEmbedder, error) {
+	url := os.Getenv("RAG_EMBEDDING_URL")
+	if url == "" {
+		return nil, fmt.Errorf("RAG_EMBEDDING_URL environment variable not set")
+	}
+
+	format := strings.ToLower(strings.TrimSpace(os.Getenv("RAG_EMBEDDING_FORMAT")))
+	switch format {
+	case "", EmbeddingFormatTEI, EmbeddingFormatOpenAI:
+	default:
+		return nil, fmt.Errorf("unsupported RAG_EMBEDDING_FORMAT %q", format)
+	}
+
+	model := os.Getenv("RAG_EMBEDDING_MODEL")
+	if model == "" {
+		model = "all-MiniLM-L6-v2"
+	}
+
+	return NewHTTPEmbedder(url, format, model, os.Getenv("RAG_EMBEDDING_API_KEY"), client), nil
+}
+
+// Model returns the embedding model the server is asked for (RAG_EMBEDDING_MODEL).
+func (e *HTTPEmbedder) Model() string {
+	return e.model
+}
+
+// Embed returns one vector per input text.
+func (e *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var payload any
+	if e.format == EmbeddingFormatOpenAI {
+		payload = map[string]any{"input": texts, "model": e.model}
+	} else {
+		payload = map[string]any{"inputs": texts}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal embedding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build embedding request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read embedding response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding server returned %d: %s", resp.StatusCode, truncate(string(data), 500))
+	}
+
+	var vectors [][]float32
+	if e.format == EmbeddingFormatOpenAI {
+		var parsed struct {
+			Data []struct {
+				Embedding []float32 `json:"embedding"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			return nil, fmt.Errorf("parse embedding response: %w", err)
+		}
+		for _, item := range parsed.Data {
+			vectors = append(vectors, item.Embedding)
+		}
+	} else if err := json.Unmarshal(data, &vectors); err != nil {
+		return nil, fmt.Errorf("parse embedding response: %w", err)
+	}
+
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("embedding server returned %d vectors for %d inputs", len(vectors), len(texts))
+	}
+	return vectors, nil
+}
@@ -0,0 +1,171 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultEmbeddingModel is the sentence-transformers model the ingestion scripts embed with.
+const DefaultEmbeddingModel = "all-MiniLM-L6-v2"
+
+// MaxEmbeddingInputs bounds the number of texts embedded in a single request.
+const MaxEmbeddingInputs = 256
+
+// ErrNoEmbeddingInput is returned when there is nothing to embed.
+var ErrNoEmbeddingInput = errors.New("input must contain at least one non-empty string")
+
+// EmbeddingResult holds one vector per input and the number of tokens consumed.
+type EmbeddingResult struct {
+	Vectors      [][]float32
+	PromptTokens int
+}
+
+// usageEmbedder is implemented by embedders that report exact token usage.
+type usageEmbedder interface {
+	EmbedWithUsage(ctx context.Context, texts []string) (*EmbeddingResult, error)
+}
+
+// EmbeddingService embeds arbitrary text with the model used by the RAG pipeline.
+type EmbeddingService struct {
+	embedder Embedder
+	model    string
+}
+
+// NewEmbeddingService wraps an embedder that produces vectors for the given model.
+func NewEmbeddingService(embedder Embedder, model string) *EmbeddingService {
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+	return &EmbeddingService{embedder: embedder, model: model}
+}
+
+// NewEmbeddingServiceFromEnv uses the HTTP embedding server when RAG_EMBEDDING_URL is set,
+// and otherwise runs the Python embedding script (PYTHON_EMBED_SCRIPT).
+func NewEmbeddingServiceFromEnv() (*EmbeddingService, error) {
+	if os.Getenv("RAG_EMBEDDING_URL") != "" {
+		embedder, err := NewHTTPEmbedderFromEnv(nil)
+		if err != nil {
+			return nil, err
+		}
+		return NewEmbeddingService(embedder, embedder.model), nil
+	}
+
+	scriptPath := os.Getenv("PYTHON_EMBED_SCRIPT")
+	if scriptPath == "" {
+		scriptPath = "./scripts/embed.py"
+	}
+	return NewEmbeddingService(NewPythonEmbedder(scriptPath, 60*time.Second), DefaultEmbeddingModel), nil
+}
+
+// Model returns the name of the embedding model.
+func (s *EmbeddingService) Model() string {
+	return s.model
+}
+
+// Embed returns one vector per text, in input order.
+func (s *EmbeddingService) Embed(ctx context.Context, texts []string) (*EmbeddingResult, error) {
+	if len(texts) == 0 {
+		return nil, ErrNoEmbeddingInput
+	}
+	if len(texts) > MaxEmbeddingInputs {
+		return nil, fmt.Errorf("input must contain at most %d items", MaxEmbeddingInputs)
+	}
+	for _, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			return nil, ErrNoEmbeddingInput
+		}
+	}
+
+	if e, ok := s.embedder.(usageEmbedder); ok {
+		return e.EmbedWithUsage(ctx, texts)
+	}
+
+	vectors, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The embedding server does not report usage, so approximate it.
+	tokens := 0
+	for _, text := range texts {
+		tokens += (len(text) + 3) / 4
+	}
+	return &EmbeddingResult{Vectors: vectors, PromptTokens: tokens}, nil
+}
+
+// PythonEmbedder embeds text by running the bundled sentence-transformers script.
+type PythonEmbedder struct {
+	scriptPath string
+	timeout    time.Duration
+}
+
+// NewPythonEmbedder creates an embedder backed by the Python embedding script.
+func NewPythonEmbedder(scriptPath string, timeout time.Duration) *PythonEmbedder {
+	if timeout == 0 {
+		timeout = 60 * time.Second
+	}
+	return &PythonEmbedder{scriptPath: scriptPath, timeout: timeout}
+}
+
+// Embed returns one vector per input text.
+func (pe *PythonEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	result, err := pe.EmbedWithUsage(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	return result.Vectors, nil
+}
+
+// EmbedWithUsage returns one vector per input text along with the tokenizer's token count.
+func (pe *PythonEmbedder) EmbedWithUsage(ctx context.Context, texts []string) (*EmbeddingResult, error) {
+	requestJSON, err := json.Marshal(map[string]any{"texts": texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	execCtx, cancel := context.WithTimeout(ctx, pe.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(execCtx, pythonExecutable(), pe.scriptPath)
+	cmd.Stdin = bytes.NewReader(requestJSON)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = os.Environ()
+
+	runErr := cmd.Run()
+
+	var response struct {
+		Embeddings  [][]float32 `json:"embeddings"`
+		TokenCounts []int       `json:"token_counts"`
+		Error       string      `json:"error"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("python embedding script error: %s (stderr: %s)", runErr, truncate(stderr.String(), 500))
+		}
+		return nil, fmt.Errorf("failed to parse python response: %w", err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("python embedding script returned error: %s", response.Error)
+	}
+	if runErr != nil {
+		return nil, fmt.Errorf("python embedding script error: %w", runErr)
+	}
+	if len(response.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedding script returned %d vectors for %d inputs", len(response.Embeddings), len(texts))
+	}
+
+	tokens := 0
+	for _, count := range response.TokenCounts {
+		tokens += count
+	}
+	return &EmbeddingResult{Vectors: response.Embeddings, PromptTokens: tokens}, nil
+}
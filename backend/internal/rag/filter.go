@@ -0,0 +1,163 @@
+package rag
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Collection filters accepted by Filter.Collection.
+const (
+	FilterCollectionAll  = "all"
+	FilterCollectionCode = "code"
+	FilterCollectionDocs = "docs"
+)
+
+// Search modes accepted by Filter.SearchMode.
+const (
+	// SearchModeVector ranks chunks by embedding distance.
+	SearchModeVector = "vector"
+	// SearchModeKeyword ranks chunks by BM25 over their text, so exact identifiers match.
+	SearchModeKeyword = "keyword"
+	// SearchModeHybrid fuses the vector and keyword rankings.
+	SearchModeHybrid = "hybrid"
+)
+
+// Metadata keys written by the ingestion scripts and read back as chunk sources.
+const (
+	MetadataRepo       = "repo"
+	MetadataRelPath    = "rel_path"
+	MetadataSourceFile = "source_file"
+	MetadataDocURL     = "doc_url"
+	// MetadataSourceURL and MetadataBranch record where repository ingestion cloned a chunk from.
+	MetadataSourceURL = "source_url"
+	MetadataBranch    = "branch"
+	// MetadataContract and MetadataFunction name the Clarity contract a code chunk belongs
+	// to and the public or read-only function it starts with.
+	MetadataContract = "contract_name"
+	MetadataFunction = "function_name"
+)
+
+// maxFilterRepos bounds the repositories a single retrieval may filter on.
+const maxFilterRepos = 20
+
+// Filter restricts retrieval to one collection and to chunks from specific repositories,
+// and selects how chunks are ranked. The zero value searches every collection and repository
+// with the service's default search mode.
+type Filter struct {
+	// Collection is "code", "docs" or "all" (the default).
+	Collection string `json:"collection,omitempty"`
+	// Repos keeps only chunks ingested from these repositories, matched by name.
+	Repos []string `json:"repos,omitempty"`
+	// SearchMode is "vector", "keyword" or "hybrid"; empty uses the service default.
+	SearchMode string `json:"search_mode,omitempty"`
+}
+
+// Normalize lowercases the collection and search mode, trims repository names and drops
+// duplicates.
+func (f Filter) Normalize() Filter {
+	normalized := Filter{
+		Collection: strings.ToLower(strings.TrimSpace(f.Collection)),
+		SearchMode: strings.ToLower(strings.TrimSpace(f.SearchMode)),
+	}
+	if normalized.Collection == FilterCollectionAll {
+		normalized.Collection = ""
+	}
+	for _, repo := range f.Repos {
+		repo = strings.TrimSpace(repo)
+		if repo != "" && !slices.Contains(normalized.Repos, repo) {
+			normalized.Repos = append(normalized.Repos, repo)
+		}
+	}
+	return normalized
+}
+
+// Validate reports an unknown collection or search mode, or too many repositories.
+func (f Filter) Validate() error {
+	switch strings.ToLower(strings.TrimSpace(f.Collection)) {
+	case "", FilterCollectionAll, FilterCollectionCode, FilterCollectionDocs:
+	default:
+		return fmt.Errorf("collection must be one of %q, %q or %q", FilterCollectionAll, FilterCollectionCode, FilterCollectionDocs)
+	}
+	if err := validateSearchMode(f.SearchMode); err != nil {
+		return err
+	}
+	if len(f.Repos) > maxFilterRepos {
+		return fmt.Errorf("at most %d repos can be filtered on", maxFilterRepos)
+	}
+	return nil
+}
+
+func validateSearchMode(mode string) error {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", SearchModeVector, SearchModeKeyword, SearchModeHybrid:
+		return nil
+	default:
+		return fmt.Errorf("search_mode must be one of %q, %q or %q", SearchModeVector, SearchModeKeyword, SearchModeHybrid)
+	}
+}
+
+// IncludesCode reports whether the code sample collection is searched.
+func (f Filter) IncludesCode() bool {
+	return f.Collection != FilterCollectionDocs
+}
+
+// IncludesDocs reports whether the documentation collection is searched.
+func (f Filter) IncludesDocs() bool {
+	return f.Collection != FilterCollectionCode
+}
+
+// Source locates the origin of a retrieved chunk.
+type Source struct {
+	// ID is the chunk's document id in its collection.
+	ID       string `json:"id,omitempty"`
+	Repo     string `json:"repo,omitempty"`
+	FilePath string `json:"file_path,omitempty"`
+	DocURL   string `json:"doc_url,omitempty"`
+	Contract string `json:"contract,omitempty"`
+	Function string `json:"function,omitempty"`
+	// Metadata holds every key stored with the chunk, including those above.
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// SourceFromMetadata builds a chunk source from its stored metadata. Code samples ingested
+// before the repo key existed fall back to the first directory of their relative path.
+func SourceFromMetadata(metadata map[string]any) Source {
+	source := Source{
+		Repo:     metadataString(metadata, MetadataRepo),
+		FilePath: metadataString(metadata, MetadataRelPath),
+		DocURL:   metadataString(metadata, MetadataDocURL),
+		Contract: metadataString(metadata, MetadataContract),
+		Function: metadataString(metadata, MetadataFunction),
+		Metadata: metadata,
+	}
+	if source.FilePath == "" {
+		source.FilePath = metadataString(metadata, MetadataSourceFile)
+	}
+	if source.Repo == "" && metadataString(metadata, MetadataRelPath) != "" {
+		if first, _, ok := strings.Cut(path.Clean(strings.ReplaceAll(source.FilePath, "\\", "/")), "/"); ok {
+			source.Repo = first
+		}
+	}
+	return source
+}
+
+func metadataString(metadata map[string]any, key string) string {
+	value, _ := metadata[key].(string)
+	return value
+}
+
+// sourcesFromMetadata converts per-chunk ids and metadata into sources, one per chunk.
+func sourcesFromMetadata(ids []string, metadatas []map[string]any) []Source {
+	sources := make([]Source, max(len(ids), len(metadatas)))
+	for i := range sources {
+		if i < len(metadatas) {
+			sources[i] = SourceFromMetadata(metadatas[i])
+		}
+		if i < len(ids) {
+			sources[i].ID = ids[i]
+		}
+	}
+	return sources
+}
@@ -0,0 +1,303 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHybridKeywordWeight = 0.3
+	defaultKeywordIndexTTL     = 10 * time.Minute
+	// hybridCandidateFactor is how many candidates each hybrid search fetches per requested result.
+	hybridCandidateFactor = 2
+	// rrfK damps the reciprocal rank fusion so the first few ranks do not dominate.
+	rrfK = 60
+)
+
+// SearchConfig selects the default search mode and tunes keyword and hybrid search.
+type SearchConfig struct {
+	// Mode is the search mode of requests that do not choose one.
+	Mode string
+	// KeywordWeight is the keyword share (0-1) of hybrid fusion; the rest goes to vector search.
+	KeywordWeight float64
+	// IndexTTL is how long a collection's keyword index is used before it is rebuilt, so
+	// ingestion shows up in keyword results within IndexTTL.
+	IndexTTL time.Duration
+}
+
+// SearchConfigFromEnv reads RAG_SEARCH_MODE, RAG_HYBRID_KEYWORD_WEIGHT and RAG_KEYWORD_INDEX_TTL.
+func SearchConfigFromEnv() SearchConfig {
+	cfg := SearchConfig{
+		Mode:          strings.ToLower(strings.TrimSpace(os.Getenv("RAG_SEARCH_MODE"))),
+		KeywordWeight: defaultHybridKeywordWeight,
+		IndexTTL:      defaultKeywordIndexTTL,
+	}
+	if weight, err := strconv.ParseFloat(os.Getenv("RAG_HYBRID_KEYWORD_WEIGHT"), 64); err == nil && weight >= 0 && weight <= 1 {
+		cfg.KeywordWeight = weight
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("RAG_KEYWORD_INDEX_TTL")); err == nil && ttl > 0 {
+		cfg.IndexTTL = ttl
+	}
+	return cfg
+}
+
+// SearchScore reports how a keyword or hybrid search ranked a context.
+type SearchScore struct {
+	Rank int `json:"rank"`
+	// VectorRank and KeywordRank are the context's positions in the vector and keyword
+	// searches; zero when that search did not return it.
+	VectorRank  int `json:"vector_rank,omitempty"`
+	KeywordRank int `json:"keyword_rank,omitempty"`
+	// VectorDistance is the embedding distance, when the vector search returned the context.
+	VectorDistance *float64 `json:"vector_distance,omitempty"`
+	// KeywordScore is the BM25 score, when the keyword search returned the context.
+	KeywordScore float64 `json:"keyword_score,omitempty"`
+	// Score is the fused score in hybrid mode and the BM25 score in keyword mode.
+	Score float64 `json:"score"`
+}
+
+// SearchMetadata describes a keyword or hybrid search.
+type SearchMetadata struct {
+	Mode string `json:"mode"`
+	// KeywordWeight is the keyword share of the hybrid fusion.
+	KeywordWeight float64       `json:"keyword_weight,omitempty"`
+	Code          []SearchScore `json:"code"`
+	Docs          []SearchScore `json:"docs"`
+}
+
+// keywordDocument is a chunk held by a keyword index.
+type keywordDocument struct {
+	match  Match
+	repo   string
+	length int
+}
+
+type posting struct {
+	doc  int
+	freq int
+}
+
+// keywordIndex is an in-memory Okapi BM25 index over the documents of one collection.
+type keywordIndex struct {
+	docs      []keywordDocument
+	postings  map[string][]posting
+	avgLength float64
+	builtAt   time.Time
+}
+
+// buildKeywordIndex reads every document of the collection from store and indexes its
+// terms. A missing collection yields an empty index.
+func buildKeywordIndex(ctx context.Context, store VectorStore, collection string) (*keywordIndex, error) {
+	index := &keywordIndex{postings: make(map[string][]posting), builtAt: time.Now()}
+	totalLength := 0
+	err := store.ScanContent(ctx, collection, func(page []Match) error {
+		for _, match := range page {
+			terms := lexicalTerms(match.Content)
+			counts := make(map[string]int, len(terms))
+			for _, term := range terms {
+				counts[term]++
+			}
+			doc := len(index.docs)
+			for term, freq := range counts {
+				index.postings[term] = append(index.postings[term], posting{doc: doc, freq: freq})
+			}
+			index.docs = append(index.docs, keywordDocument{
+				match:  match,
+				repo:   SourceFromMetadata(match.Metadata).Repo,
+				length: len(terms),
+			})
+			totalLength += len(terms)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index %s for keyword search: %w", collection, err)
+	}
+	if len(index.docs) > 0 {
+		index.avgLength = float64(totalLength) / float64(len(index.docs))
+	}
+	return index, nil
+}
+
+// search returns up to n documents matching the query's terms with their BM25 scores,
+// best first. When repos is set only documents from those repositories are returned.
+// Distances are 1 minus the score relative to the best match, so the best match is at 0.
+func (ix *keywordIndex) search(query string, n int, repos []string) ([]Match, []float64) {
+	const k1, b = 1.2, 0.75
+
+	allowed := func(doc int) bool {
+		if len(repos) == 0 {
+			return true
+		}
+		for _, repo := range repos {
+			if ix.docs[doc].repo == repo {
+				return true
+			}
+		}
+		return false
+	}
+
+	total := float64(len(ix.docs))
+	avgLength := max(ix.avgLength, 1)
+	scores := make(map[int]float64)
+	for _, term := range uniqueTerms(lexicalTerms(query)) {
+		postings := ix.postings[term]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (total-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			if !allowed(p.doc) {
+				continue
+			}
+			tf := float64(p.freq)
+			length := float64(ix.docs[p.doc].length)
+			scores[p.doc] += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*length/avgLength))
+		}
+	}
+
+	ranked := make([]int, 0, len(scores))
+	for doc := range scores {
+		ranked = append(ranked, doc)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] != scores[ranked[j]] {
+			return scores[ranked[i]] > scores[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+
+	matches := make([]Match, len(ranked))
+	bm25 := make([]float64, len(ranked))
+	for i, doc := range ranked {
+		matches[i] = ix.docs[doc].match
+		bm25[i] = scores[doc]
+		matches[i].Distance = 1 - bm25[i]/scores[ranked[0]]
+	}
+	return matches, bm25
+}
+
+// keywordIndexes caches a keyword index per collection and rebuilds it once it is older
+// than ttl. A failed rebuild keeps serving the previous index.
+type keywordIndexes struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]*keywordEntry
+}
+
+type keywordEntry struct {
+	mu    sync.Mutex
+	index *keywordIndex
+}
+
+func newKeywordIndexes(ttl time.Duration) *keywordIndexes {
+	if ttl <= 0 {
+		ttl = defaultKeywordIndexTTL
+	}
+	return &keywordIndexes{ttl: ttl, entries: make(map[string]*keywordEntry)}
+}
+
+// get returns the collection's index, building it on first use. Concurrent callers wait
+// for a single build. Indexes are kept per physical collection, so switching an alias
+// after a reindex builds a fresh one.
+func (k *keywordIndexes) get(ctx context.Context, store VectorStore, collection string) (*keywordIndex, error) {
+	collection = ActiveCollection(collection)
+	k.mu.Lock()
+	entry, ok := k.entries[collection]
+	if !ok {
+		entry = &keywordEntry{}
+		k.entries[collection] = entry
+	}
+	ttl := k.ttl
+	k.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.index != nil && time.Since(entry.index.builtAt) < ttl {
+		return entry.index, nil
+	}
+
+	index, err := buildKeywordIndex(ctx, store, collection)
+	if err != nil {
+		if entry.index != nil {
+			log.Printf("Warning: keeping the previous keyword index: %v", err)
+			return entry.index, nil
+		}
+		return nil, err
+	}
+	entry.index = index
+	return index, nil
+}
+
+// fuseRankings merges vector and keyword results by weighted reciprocal rank fusion and
+// keeps the top n. Each context scores (1-keywordWeight)/(60+vector rank) plus
+// keywordWeight/(60+keyword rank), counting only the searches that returned it. Distances
+// are 1 minus the score relative to the best possible one, a first place in both searches.
+func fuseRankings(vector []Match, keyword []Match, keywordScores []float64, keywordWeight float64, n int) ([]Match, []SearchScore) {
+	type fused struct {
+		match Match
+		score SearchScore
+	}
+	byID := make(map[string]*fused, len(vector)+len(keyword))
+	order := make([]*fused, 0, len(vector)+len(keyword))
+	entry := func(match Match) *fused {
+		if f, ok := byID[match.ID]; ok {
+			return f
+		}
+		f := &fused{match: match}
+		byID[match.ID] = f
+		order = append(order, f)
+		return f
+	}
+
+	for i, match := range vector {
+		f := entry(match)
+		distance := match.Distance
+		f.score.VectorRank = i + 1
+		f.score.VectorDistance = &distance
+		f.score.Score += (1 - keywordWeight) / float64(rrfK+i+1)
+	}
+	for i, match := range keyword {
+		f := entry(match)
+		f.score.KeywordRank = i + 1
+		f.score.KeywordScore = keywordScores[i]
+		f.score.Score += keywordWeight / float64(rrfK+i+1)
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return order[i].score.Score > order[j].score.Score })
+	if len(order) > n {
+		order = order[:n]
+	}
+
+	best := 1.0 / float64(rrfK+1)
+	matches := make([]Match, len(order))
+	scores := make([]SearchScore, len(order))
+	for rank, f := range order {
+		f.score.Rank = rank + 1
+		matches[rank] = f.match
+		matches[rank].Distance = 1 - f.score.Score/best
+		scores[rank] = f.score
+	}
+	return matches, scores
+}
+
+// keywordSearchScores describes a keyword search's results.
+func keywordSearchScores(bm25 []float64) []SearchScore {
+	scores := make([]SearchScore, len(bm25))
+	for i, score := range bm25 {
+		scores[i] = SearchScore{Rank: i + 1, KeywordRank: i + 1, KeywordScore: score, Score: score}
+	}
+	return scores
+}
@@ -0,0 +1,180 @@
+package rag
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRecentFailures = 50
+
+// Failure categories derived from subprocess errors and stderr output.
+const (
+	FailureTimeout        = "timeout"
+	FailureModuleNotFound = "module_not_found"
+	FailureChromaDB       = "chromadb"
+	FailureInvalidOutput  = "invalid_output"
+	FailureScriptError    = "script_error"
+	FailureSpawn          = "spawn"
+	FailureOther          = "other"
+)
+
+// BridgeFailure records a single failed invocation of the Python bridge.
+type BridgeFailure struct {
+	Time      time.Time `json:"time"`
+	Category  string    `json:"category"`
+	Error     string    `json:"error"`
+	Stderr    string    `json:"stderr,omitempty"`
+	LatencyMs int64     `json:"latency_ms"`
+}
+
+// BridgeMetricsSnapshot is a point-in-time view of the Python bridge metrics.
+type BridgeMetricsSnapshot struct {
+	Spawns            int64            `json:"spawns"`
+	Successes         int64            `json:"successes"`
+	Failures          int64            `json:"failures"`
+	InFlight          int64            `json:"in_flight"`
+	FailuresByPattern map[string]int64 `json:"failures_by_pattern"`
+	AvgLatencyMs      float64          `json:"avg_latency_ms"`
+	MaxLatencyMs      int64            `json:"max_latency_ms"`
+	LastSuccessAt     *time.Time       `json:"last_success_at,omitempty"`
+	LastFailureAt     *time.Time       `json:"last_failure_at,omitempty"`
+	RecentFailures    []BridgeFailure  `json:"recent_failures"`
+}
+
+// BridgeMetrics tracks subprocess activity for the Python RAG client.
+type BridgeMetrics struct {
+	mu                sync.Mutex
+	spawns            int64
+	successes         int64
+	failures          int64
+	inFlight          int64
+	totalLatencyMs    int64
+	maxLatencyMs      int64
+	failuresByPattern map[string]int64
+	lastSuccessAt     time.Time
+	lastFailureAt     time.Time
+	recent            []BridgeFailure
+}
+
+// NewBridgeMetrics returns an empty metrics collector.
+func NewBridgeMetrics() *BridgeMetrics {
+	return &BridgeMetrics{
+		failuresByPattern: make(map[string]int64),
+	}
+}
+
+func (m *BridgeMetrics) recordSpawn() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.spawns++
+	m.inFlight++
+}
+
+func (m *BridgeMetrics) recordSuccess(latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight--
+	m.successes++
+	m.lastSuccessAt = time.Now().UTC()
+	m.observeLatency(latency)
+}
+
+func (m *BridgeMetrics) recordFailure(latency time.Duration, category string, err error, stderr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight--
+	m.failures++
+	m.failuresByPattern[category]++
+	m.lastFailureAt = time.Now().UTC()
+	m.observeLatency(latency)
+
+	failure := BridgeFailure{
+		Time:      m.lastFailureAt,
+		Category:  category,
+		Stderr:    truncate(stderr, 2000),
+		LatencyMs: latency.Milliseconds(),
+	}
+	if err != nil {
+		failure.Error = err.Error()
+	}
+
+	m.recent = append(m.recent, failure)
+	if len(m.recent) > maxRecentFailures {
+		m.recent = m.recent[len(m.recent)-maxRecentFailures:]
+	}
+}
+
+func (m *BridgeMetrics) observeLatency(latency time.Duration) {
+	ms := latency.Milliseconds()
+	m.totalLatencyMs += ms
+	if ms > m.maxLatencyMs {
+		m.maxLatencyMs = ms
+	}
+}
+
+// Snapshot returns a copy of the current metrics with the most recent failures first.
+func (m *BridgeMetrics) Snapshot() BridgeMetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := BridgeMetricsSnapshot{
+		Spawns:            m.spawns,
+		Successes:         m.successes,
+		Failures:          m.failures,
+		InFlight:          m.inFlight,
+		FailuresByPattern: make(map[string]int64, len(m.failuresByPattern)),
+		MaxLatencyMs:      m.maxLatencyMs,
+		RecentFailures:    make([]BridgeFailure, 0, len(m.recent)),
+	}
+
+	for k, v := range m.failuresByPattern {
+		snapshot.FailuresByPattern[k] = v
+	}
+	if completed := m.successes + m.failures; completed > 0 {
+		snapshot.AvgLatencyMs = float64(m.totalLatencyMs) / float64(completed)
+	}
+	if !m.lastSuccessAt.IsZero() {
+		t := m.lastSuccessAt
+		snapshot.LastSuccessAt = &t
+	}
+	if !m.lastFailureAt.IsZero() {
+		t := m.lastFailureAt
+		snapshot.LastFailureAt = &t
+	}
+	for i := len(m.recent) - 1; i >= 0; i-- {
+		snapshot.RecentFailures = append(snapshot.RecentFailures, m.recent[i])
+	}
+
+	return snapshot
+}
+
+// classifyFailure maps an execution error and its stderr output to a failure category.
+func classifyFailure(err error, stderr string) string {
+	text := strings.ToLower(stderr)
+	if err != nil {
+		text += " " + strings.ToLower(err.Error())
+	}
+
+	switch {
+	case strings.Contains(text, "deadline exceeded") || strings.Contains(text, "signal: killed"):
+		return FailureTimeout
+	case strings.Contains(text, "modulenotfounderror") || strings.Contains(text, "no module named"):
+		return FailureModuleNotFound
+	case strings.Contains(text, "chromadb") || strings.Contains(text, "collection"):
+		return FailureChromaDB
+	case strings.Contains(text, "executable file not found") || strings.Contains(text, "no such file or directory"):
+		return FailureSpawn
+	case strings.Contains(text, "traceback"):
+		return FailureScriptError
+	default:
+		return FailureOther
+	}
+}
+
+func truncate(val string, maxLen int) string {
+	if len(val) <= maxLen {
+		return val
+	}
+	return val[:maxLen]
+}
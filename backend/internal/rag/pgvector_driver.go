@@ -0,0 +1,7 @@
+//go:build pgvector
+
+package rag
+
+// The pgvector store talks to PostgreSQL through database/sql. The driver is only compiled
+// in with -tags pgvector so default builds do not link it.
+import _ "github.com/jackc/pgx/v5/stdlib"
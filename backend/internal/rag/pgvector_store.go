@@ -0,0 +1,407 @@
+package rag
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPgvectorDriver = "pgx"
+	defaultPgvectorTable  = "rag_documents"
+)
+
+var pgIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// PgvectorConfig configures the PostgreSQL + pgvector store.
+type PgvectorConfig struct {
+	DSN string
+	// Driver is the database/sql driver name. The binary must register it; build with
+	// -tags pgvector to include the pgx driver.
+	Driver string
+	// Table holds every collection, keyed by a collection column.
+	Table   string
+	Timeout time.Duration
+}
+
+// PgvectorConfigFromEnv reads PGVECTOR_DSN, PGVECTOR_DRIVER, PGVECTOR_TABLE and PGVECTOR_TIMEOUT.
+func PgvectorConfigFromEnv() PgvectorConfig {
+	cfg := PgvectorConfig{
+		DSN:    os.Getenv("PGVECTOR_DSN"),
+		Driver: os.Getenv("PGVECTOR_DRIVER"),
+		Table:  os.Getenv("PGVECTOR_TABLE"),
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("PGVECTOR_TIMEOUT")); err == nil && timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	return cfg
+}
+
+// PgvectorStore is a VectorStore backed by a PostgreSQL table with a pgvector column.
+// Distances are cosine distances.
+type PgvectorStore struct {
+	db      *sql.DB
+	table   string
+	timeout time.Duration
+
+	schemaOnce sync.Once
+	schemaErr  error
+}
+
+// NewPgvectorStoreFromConfig opens the database and returns a store for the configured table.
+func NewPgvectorStoreFromConfig(cfg PgvectorConfig) (*PgvectorStore, error) {
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("PGVECTOR_DSN environment variable not set")
+	}
+	if cfg.Driver == "" {
+		cfg.Driver = defaultPgvectorDriver
+	}
+
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("open pgvector database (is the %q driver compiled in? build with -tags pgvector): %w", cfg.Driver, err)
+	}
+	return NewPgvectorStore(db, cfg.Table, cfg.Timeout)
+}
+
+// NewPgvectorStore returns a store using an open PostgreSQL handle.
+func NewPgvectorStore(db *sql.DB, table string, timeout time.Duration) (*PgvectorStore, error) {
+	if table == "" {
+		table = defaultPgvectorTable
+	}
+	if !pgIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("invalid pgvector table name %q", table)
+	}
+	if timeout <= 0 {
+		timeout = defaultStoreTimeout
+	}
+	return &PgvectorStore{db: db, table: table, timeout: timeout}, nil
+}
+
+// Name identifies the store in logs and errors.
+func (ps *PgvectorStore) Name() string {
+	return BackendPgvector
+}
+
+// Query returns the documents of the collection nearest to the embedding by cosine distance.
+func (ps *PgvectorStore) Query(ctx context.Context, collection string, embedding []float32, nResults int, repos []string) ([]Match, error) {
+	args := []any{vectorLiteral(embedding), collection, nResults}
+	repoClause := ""
+	if len(repos) > 0 {
+		placeholders := make([]string, len(repos))
+		for i, repo := range repos {
+			args = append(args, repo)
+			placeholders[i] = "$" + strconv.Itoa(len(args))
+		}
+		repoClause = "AND metadata->>'" + MetadataRepo + "' IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	rows, err := ps.db.QueryContext(ctx, `
+		SELECT id, content, metadata::text, embedding <=> $1::vector AS distance
+		FROM `+ps.table+`
+		WHERE collection = $2 `+repoClause+`
+		ORDER BY distance
+		LIMIT $3
+	`, args...)
+	if err != nil {
+		if isUndefinedTable(err) {
+			return nil, errCollectionNotFound
+		}
+		return nil, fmt.Errorf("query pgvector: %w", err)
+	}
+	defer rows.Close()
+
+	matches := make([]Match, 0, nResults)
+	for rows.Next() {
+		var (
+			match    Match
+			metadata string
+		)
+		if err := rows.Scan(&match.ID, &match.Content, &metadata, &match.Distance); err != nil {
+			return nil, fmt.Errorf("scan pgvector row: %w", err)
+		}
+		if err := json.Unmarshal([]byte(metadata), &match.Metadata); err != nil {
+			return nil, fmt.Errorf("decode pgvector metadata: %w", err)
+		}
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate pgvector rows: %w", err)
+	}
+
+	// An empty result is indistinguishable from a collection that was never ingested.
+	if len(matches) == 0 {
+		var exists bool
+		err := ps.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+ps.table+` WHERE collection = $1)`, collection).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("check pgvector collection: %w", err)
+		}
+		if !exists {
+			return nil, errCollectionNotFound
+		}
+	}
+	return matches, nil
+}
+
+// Upsert writes documents into the collection, creating the extension and table on first use.
+func (ps *PgvectorStore) Upsert(ctx context.Context, collection string, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ps.timeout)
+	defer cancel()
+
+	if err := ps.ensureSchema(ctx); err != nil {
+		return err
+	}
+
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin pgvector upsert: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO `+ps.table+` (collection, id, content, metadata, embedding)
+		VALUES ($1, $2, $3, $4::jsonb, $5::vector)
+		ON CONFLICT (collection, id) DO UPDATE
+		SET content = EXCLUDED.content, metadata = EXCLUDED.metadata, embedding = EXCLUDED.embedding
+	`)
+	if err != nil {
+		return fmt.Errorf("prepare pgvector upsert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, doc := range docs {
+		metadata := []byte("{}")
+		if len(doc.Metadata) > 0 {
+			if metadata, err = json.Marshal(doc.Metadata); err != nil {
+				return fmt.Errorf("encode metadata of %s: %w", doc.ID, err)
+			}
+		}
+		if _, err := stmt.ExecContext(ctx, collection, doc.ID, doc.Content, string(metadata), vectorLiteral(doc.Embedding)); err != nil {
+			return fmt.Errorf("upsert %s: %w", doc.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit pgvector upsert: %w", err)
+	}
+	return nil
+}
+
+// Scan pages through the ids and metadata of the collection's documents matching filter,
+// in id order.
+func (ps *PgvectorStore) Scan(ctx context.Context, collection string, filter MetadataFilter, fn func([]Match) error) error {
+	return ps.scan(ctx, collection, filter, false, fn)
+}
+
+// ScanContent pages through every document of the collection with its content, in id order.
+func (ps *PgvectorStore) ScanContent(ctx context.Context, collection string, fn func([]Match) error) error {
+	return ps.scan(ctx, collection, MetadataFilter{}, true, fn)
+}
+
+func (ps *PgvectorStore) scan(ctx context.Context, collection string, filter MetadataFilter, withContent bool, fn func([]Match) error) error {
+	columns := "id, metadata::text"
+	if withContent {
+		columns += ", content"
+	}
+	args := []any{collection, ""}
+	filterClause := ""
+	if filter.Key != "" {
+		args = append(args, filter.Key, filter.Value)
+		filterClause = "AND metadata->>$3 = $4"
+	}
+
+	for {
+		page, err := ps.scanPage(ctx, `
+			SELECT `+columns+`
+			FROM `+ps.table+`
+			WHERE collection = $1 AND id > $2 `+filterClause+`
+			ORDER BY id
+			LIMIT `+strconv.Itoa(scanPageSize), args, withContent)
+		if err != nil || len(page) == 0 {
+			return err
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if len(page) < scanPageSize {
+			return nil
+		}
+		args[1] = page[len(page)-1].ID
+	}
+}
+
+func (ps *PgvectorStore) scanPage(ctx context.Context, query string, args []any, withContent bool) ([]Match, error) {
+	rows, err := ps.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		if isUndefinedTable(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("scan pgvector: %w", err)
+	}
+	defer rows.Close()
+
+	page := make([]Match, 0, scanPageSize)
+	for rows.Next() {
+		var (
+			match    Match
+			metadata string
+		)
+		dest := []any{&match.ID, &metadata}
+		if withContent {
+			dest = append(dest, &match.Content)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scan pgvector row: %w", err)
+		}
+		if err := json.Unmarshal([]byte(metadata), &match.Metadata); err != nil {
+			return nil, fmt.Errorf("decode pgvector metadata: %w", err)
+		}
+		page = append(page, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate pgvector rows: %w", err)
+	}
+	return page, nil
+}
+
+// Delete removes the collection's documents matching filter.
+func (ps *PgvectorStore) Delete(ctx context.Context, collection string, filter MetadataFilter) (int, error) {
+	if filter.Key == "" {
+		return 0, errEmptyDeleteFilter
+	}
+
+	res, err := ps.db.ExecContext(ctx, `
+		DELETE FROM `+ps.table+`
+		WHERE collection = $1 AND metadata->>$2 = $3
+	`, collection, filter.Key, filter.Value)
+	if err != nil {
+		if isUndefinedTable(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("delete pgvector documents: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("rows affected: %w", err)
+	}
+	return int(n), nil
+}
+
+// Drop removes the collection's rows.
+func (ps *PgvectorStore) Drop(ctx context.Context, collection string) error {
+	_, err := ps.db.ExecContext(ctx, `DELETE FROM `+ps.table+` WHERE collection = $1`, collection)
+	if err != nil && !isUndefinedTable(err) {
+		return fmt.Errorf("drop pgvector collection: %w", err)
+	}
+	return nil
+}
+
+// Describe counts the collection's rows and reads the first ones in id order. Collections
+// share one table, so a collection exists once it has a row.
+func (ps *PgvectorStore) Describe(ctx context.Context, collection string, samples int) (CollectionInfo, error) {
+	info := CollectionInfo{Name: collection}
+	err := ps.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(MAX(vector_dims(embedding)), 0)
+		FROM `+ps.table+`
+		WHERE collection = $1
+	`, collection).Scan(&info.Documents, &info.Dimension)
+	if err != nil {
+		if isUndefinedTable(err) {
+			return info, nil
+		}
+		return info, fmt.Errorf("describe pgvector collection: %w", err)
+	}
+	info.Exists = info.Documents > 0
+	if samples == 0 || info.Documents == 0 {
+		return info, nil
+	}
+
+	rows, err := ps.db.QueryContext(ctx, `
+		SELECT id, content, metadata::text
+		FROM `+ps.table+`
+		WHERE collection = $1
+		ORDER BY id
+		LIMIT $2
+	`, collection, samples)
+	if err != nil {
+		return info, fmt.Errorf("sample pgvector documents: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			sample   SampleDocument
+			metadata string
+		)
+		if err := rows.Scan(&sample.ID, &sample.Content, &metadata); err != nil {
+			return info, fmt.Errorf("scan pgvector row: %w", err)
+		}
+		if err := json.Unmarshal([]byte(metadata), &sample.Metadata); err != nil {
+			return info, fmt.Errorf("decode pgvector metadata: %w", err)
+		}
+		info.Samples = append(info.Samples, sample)
+	}
+	if err := rows.Err(); err != nil {
+		return info, fmt.Errorf("iterate pgvector rows: %w", err)
+	}
+	return info, nil
+}
+
+// HealthCheck verifies the database is reachable.
+func (ps *PgvectorStore) HealthCheck(ctx context.Context) error {
+	return ps.db.PingContext(ctx)
+}
+
+func (ps *PgvectorStore) ensureSchema(ctx context.Context) error {
+	ps.schemaOnce.Do(func() {
+		statements := []string{
+			`CREATE EXTENSION IF NOT EXISTS vector`,
+			`CREATE TABLE IF NOT EXISTS ` + ps.table + ` (
+				collection TEXT NOT NULL,
+				id TEXT NOT NULL,
+				content TEXT NOT NULL,
+				metadata JSONB NOT NULL DEFAULT '{}',
+				embedding vector NOT NULL,
+				PRIMARY KEY (collection, id)
+			)`,
+		}
+		for _, statement := range statements {
+			if _, err := ps.db.ExecContext(ctx, statement); err != nil {
+				ps.schemaErr = fmt.Errorf("create pgvector schema: %w", err)
+				return
+			}
+		}
+	})
+	return ps.schemaErr
+}
+
+// vectorLiteral formats an embedding in pgvector's text representation, e.g. "[0.1,0.2]".
+func vectorLiteral(embedding []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, v := range embedding {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// isUndefinedTable detects PostgreSQL's undefined_table error (SQLSTATE 42P01) without
+// depending on a specific driver's error type.
+func isUndefinedTable(err error) bool {
+	text := err.Error()
+	return strings.Contains(text, "42P01") || strings.Contains(text, "does not exist")
+}
@@ -0,0 +1,59 @@
+//go:build pgvector
+
+package rag_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testutil"
+)
+
+func TestPgvectorStoreCRUD(t *testing.T) {
+	store, err := rag.NewPgvectorStoreFromConfig(rag.PgvectorConfig{DSN: testutil.PostgresDSN(t), Table: "rag_documents_test"})
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	ctx := context.Background()
+	t.Cleanup(func() { store.Drop(context.Background(), "samples") })
+
+	docs := []rag.Document{
+		{ID: "counter", Content: "(define-data-var count uint u0)", Metadata: map[string]any{"repo": "counter"}, Embedding: []float32{1, 0, 0}},
+		{ID: "token", Content: "(define-fungible-token ft)", Metadata: map[string]any{"repo": "token"}, Embedding: []float32{0, 1, 0}},
+	}
+	if err := store.Upsert(ctx, "samples", docs); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+
+	matches, err := store.Query(ctx, "samples", []float32{0.9, 0.1, 0}, 2, nil)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(matches) != 2 || matches[0].ID != "counter" {
+		t.Fatalf("Query = %+v, want counter first", matches)
+	}
+
+	matches, err = store.Query(ctx, "samples", []float32{0.9, 0.1, 0}, 2, []string{"token"})
+	if err != nil {
+		t.Fatalf("Query with repos: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != "token" {
+		t.Fatalf("Query with repos = %+v, want only token", matches)
+	}
+
+	deleted, err := store.Delete(ctx, "samples", rag.MetadataFilter{Key: "repo", Value: "counter"})
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("Delete removed %d documents, want 1", deleted)
+	}
+	info, err := store.Describe(ctx, "samples", 0)
+	if err != nil {
+		t.Fatalf("Describe: %v", err)
+	}
+	if !info.Exists || info.Documents != 1 {
+		t.Fatalf("Describe = %+v, want one document left", info)
+	}
+}
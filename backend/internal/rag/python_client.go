@@ -14,6 +14,7 @@ import (
 type PythonClient struct {
 	scriptPath string
 	timeout    time.Duration
+	metrics    *BridgeMetrics
 }
 
 // RAGRequest represents the input to the Python script
@@ -21,17 +22,44 @@ type RAGRequest struct {
 	Query       string `json:"query"`
 	NResults    int    `json:"n_results"`
 	DocsResults int    `json:"docs_results"`
+	// Collection and Repos restrict the search; see Filter.
+	Collection string   `json:"collection,omitempty"`
+	Repos      []string `json:"repos,omitempty"`
 }
 
 // RAGResponse represents the output from the Python script
 type RAGResponse struct {
-	CodeContexts     []string  `json:"code_contexts"`
-	CodeDistances    []float64 `json:"code_distances"`
-	DocsContexts     []string  `json:"docs_contexts"`
-	DocsDistances    []float64 `json:"docs_distances"`
-	FormattedContext string    `json:"formatted_context,omitempty"`
-	Warning          string    `json:"warning,omitempty"`
-	Error            string    `json:"error,omitempty"`
+	CodeContexts  []string  `json:"code_contexts"`
+	CodeDistances []float64 `json:"code_distances"`
+	DocsContexts  []string  `json:"docs_contexts"`
+	DocsDistances []float64 `json:"docs_distances"`
+	// CodeSources and DocsSources locate each context, index-aligned with the contexts.
+	CodeSources      []Source `json:"code_sources,omitempty"`
+	DocsSources      []Source `json:"docs_sources,omitempty"`
+	FormattedContext string   `json:"formatted_context,omitempty"`
+	Warning          string   `json:"warning,omitempty"`
+	Error            string   `json:"error,omitempty"`
+	// Rerank is set when a reranker reordered the contexts.
+	Rerank *RerankMetadata `json:"rerank,omitempty"`
+	// Search is set for keyword and hybrid searches.
+	Search *SearchMetadata `json:"search,omitempty"`
+	// Timings reports how long retrieval took.
+	Timings *RetrievalTimings `json:"timings,omitempty"`
+	// EmbeddingDimensions is the length of the query embedding. The Python bridge does not
+	// report it.
+	EmbeddingDimensions int `json:"embedding_dimensions,omitempty"`
+}
+
+// RetrievalTimings breaks down the latency of a retrieval. The native vector stores embed the
+// query, then search both collections concurrently, so TotalMs is close to EmbedMs plus the
+// slower of CodeMs and DocsMs. The Python bridge only reports TotalMs.
+type RetrievalTimings struct {
+	EmbedMs int64 `json:"embed_ms,omitempty"`
+	CodeMs  int64 `json:"code_ms,omitempty"`
+	DocsMs  int64 `json:"docs_ms,omitempty"`
+	// RerankMs is set when a reranker reordered the contexts.
+	RerankMs int64 `json:"rerank_ms,omitempty"`
+	TotalMs  int64 `json:"total_ms"`
 }
 
 // NewPythonClient creates a new Python client for RAG operations
@@ -46,24 +74,26 @@ func NewPythonClient(scriptPath string, timeout time.Duration) *PythonClient {
 	return &PythonClient{
 		scriptPath: scriptPath,
 		timeout:    timeout,
+		metrics:    NewBridgeMetrics(),
 	}
 }
 
-// Retrieve calls the Python script to retrieve relevant contexts from ChromaDB
-func (pc *PythonClient) Retrieve(ctx context.Context, query string, nResults int) (*RAGResponse, error) {
+// Retrieve calls the Python script to retrieve relevant contexts from ChromaDB. The script
+// searches the code and documentation collections one after the other.
+func (pc *PythonClient) Retrieve(ctx context.Context, query string, limits Limits, filter Filter) (*RAGResponse, error) {
 	// Validate inputs
 	if query == "" {
 		return nil, fmt.Errorf("query cannot be empty")
 	}
-	if nResults < 1 || nResults > 10 {
-		nResults = 10
-	}
+	limits = limits.clamp()
 
 	// Create request
 	request := RAGRequest{
 		Query:       query,
-		NResults:    nResults,
-		DocsResults: nResults,
+		NResults:    limits.Code,
+		DocsResults: limits.Docs,
+		Collection:  filter.Collection,
+		Repos:       filter.Repos,
 	}
 
 	requestJSON, err := json.Marshal(request)
@@ -91,11 +121,19 @@ func (pc *PythonClient) Retrieve(ctx context.Context, query string, nResults int
 	cmd.Env = os.Environ()
 
 	// Execute command
+	pc.metrics.recordSpawn()
+	start := time.Now()
 	err = cmd.Run()
+	latency := time.Since(start)
 
 	// Check for errors
 	if err != nil {
 		stderrStr := stderr.String()
+		category := classifyFailure(err, stderrStr)
+		if execCtx.Err() == context.DeadlineExceeded {
+			category = FailureTimeout
+		}
+		pc.metrics.recordFailure(latency, category, err, stderrStr)
 		if stderrStr != "" {
 			return nil, fmt.Errorf("python script error: %s (stderr: %s)", err, stderrStr)
 		}
@@ -104,20 +142,48 @@ func (pc *PythonClient) Retrieve(ctx context.Context, query string, nResults int
 
 	// Parse response
 	var response RAGResponse
+	var metadata struct {
+		CodeIDs      []string         `json:"code_ids"`
+		CodeMetadata []map[string]any `json:"code_metadata"`
+		DocsIDs      []string         `json:"docs_ids"`
+		DocsMetadata []map[string]any `json:"docs_metadata"`
+	}
 	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		pc.metrics.recordFailure(latency, FailureInvalidOutput, err, stderr.String())
 		return nil, fmt.Errorf("failed to parse python response: %w (output: %s)", err, stdout.String())
 	}
+	if err := json.Unmarshal(stdout.Bytes(), &metadata); err == nil {
+		response.CodeSources = sourcesFromMetadata(metadata.CodeIDs, metadata.CodeMetadata)
+		response.DocsSources = sourcesFromMetadata(metadata.DocsIDs, metadata.DocsMetadata)
+	}
 
 	// Check for errors in response
 	if response.Error != "" {
-		return nil, fmt.Errorf("python script returned error: %s", response.Error)
+		scriptErr := fmt.Errorf("python script returned error: %s", response.Error)
+		category := classifyFailure(nil, response.Error)
+		if category == FailureOther {
+			category = FailureScriptError
+		}
+		pc.metrics.recordFailure(latency, category, scriptErr, stderr.String())
+		return nil, scriptErr
 	}
 
+	pc.metrics.recordSuccess(latency)
 	return &response, nil
 }
 
+// Metrics returns the subprocess metrics collected by this client.
+func (pc *PythonClient) Metrics() *BridgeMetrics {
+	return pc.metrics
+}
+
 // findPythonExecutable finds the Python executable to use
 func (pc *PythonClient) findPythonExecutable() string {
+	return pythonExecutable()
+}
+
+// pythonExecutable resolves PYTHON_EXECUTABLE or the first Python found on PATH
+func pythonExecutable() string {
 	// Check for PYTHON_EXECUTABLE environment variable
 	if pythonExec := os.Getenv("PYTHON_EXECUTABLE"); pythonExec != "" {
 		return pythonExec
@@ -144,7 +210,7 @@ func (pc *PythonClient) HealthCheck(ctx context.Context) error {
 	}
 
 	// Try a simple query to verify it works
-	_, err := pc.Retrieve(ctx, "test query", 1)
+	_, err := pc.Retrieve(ctx, "test query", Limits{Code: 1, Docs: 1}, Filter{})
 	if err != nil {
 		return fmt.Errorf("python script health check failed: %w", err)
 	}
@@ -0,0 +1,417 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultQdrantURL = "http://localhost:6333"
+
+	// qdrantContentKey and qdrantIDKey hold the document text and its original id in the
+	// point payload; Qdrant point ids must be integers or UUIDs.
+	qdrantContentKey = "document"
+	qdrantIDKey      = "doc_id"
+)
+
+// qdrantNamespace derives stable point UUIDs from document ids so re-ingestion overwrites points.
+var qdrantNamespace = uuid.MustParse("6f1d5b2e-7a0c-4c55-9b1e-3f6c2d8a4e17")
+
+// QdrantConfig configures the Qdrant vector store.
+type QdrantConfig struct {
+	URL     string
+	APIKey  string
+	Timeout time.Duration
+}
+
+// QdrantConfigFromEnv reads QDRANT_URL, QDRANT_API_KEY and QDRANT_TIMEOUT.
+func QdrantConfigFromEnv() QdrantConfig {
+	cfg := QdrantConfig{
+		URL:    os.Getenv("QDRANT_URL"),
+		APIKey: os.Getenv("QDRANT_API_KEY"),
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("QDRANT_TIMEOUT")); err == nil && timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	return cfg
+}
+
+// QdrantStore is a VectorStore backed by a Qdrant server's REST API. Collections use cosine
+// distance, so returned distances are 1 - similarity.
+type QdrantStore struct {
+	cfg    QdrantConfig
+	client *http.Client
+
+	mu      sync.Mutex
+	created map[string]bool
+}
+
+// NewQdrantStore returns a store for the configured server.
+func NewQdrantStore(cfg QdrantConfig, httpClient *http.Client) (*QdrantStore, error) {
+	if cfg.URL == "" {
+		cfg.URL = defaultQdrantURL
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultStoreTimeout
+	}
+	if httpClient == nil {
+		httpClient = NewPooledHTTPClient(defaultChromaMaxConns)
+	}
+	return &QdrantStore{cfg: cfg, client: httpClient, created: make(map[string]bool)}, nil
+}
+
+// Name identifies the store in logs and errors.
+func (qs *QdrantStore) Name() string {
+	return BackendQdrant
+}
+
+// Query returns the documents of the collection nearest to the embedding.
+func (qs *QdrantStore) Query(ctx context.Context, collection string, embedding []float32, nResults int, repos []string) ([]Match, error) {
+	request := map[string]any{
+		"vector":       embedding,
+		"limit":        nResults,
+		"with_payload": true,
+	}
+	if len(repos) > 0 {
+		request["filter"] = map[string]any{
+			"must": []map[string]any{
+				{"key": MetadataRepo, "match": map[string]any{"any": repos}},
+			},
+		}
+	}
+
+	data, err := qs.do(ctx, http.MethodPost, "/collections/"+url.PathEscape(collection)+"/points/search", request)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Result []struct {
+			Score   float64        `json:"score"`
+			Payload map[string]any `json:"payload"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("parse Qdrant search response: %w", err)
+	}
+
+	matches := make([]Match, 0, len(result.Result))
+	for _, point := range result.Result {
+		content, ok := point.Payload[qdrantContentKey].(string)
+		if !ok {
+			continue
+		}
+		id, _ := point.Payload[qdrantIDKey].(string)
+		delete(point.Payload, qdrantContentKey)
+		delete(point.Payload, qdrantIDKey)
+		matches = append(matches, Match{ID: id, Content: content, Distance: 1 - point.Score, Metadata: point.Payload})
+	}
+	return matches, nil
+}
+
+// Upsert writes documents into the collection, creating it sized to the embeddings when missing.
+func (qs *QdrantStore) Upsert(ctx context.Context, collection string, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, qs.cfg.Timeout)
+	defer cancel()
+
+	if err := qs.ensureCollection(ctx, collection, len(docs[0].Embedding)); err != nil {
+		return err
+	}
+
+	points := make([]map[string]any, len(docs))
+	for i, doc := range docs {
+		payload := make(map[string]any, len(doc.Metadata)+2)
+		for key, value := range doc.Metadata {
+			payload[key] = value
+		}
+		payload[qdrantContentKey] = doc.Content
+		payload[qdrantIDKey] = doc.ID
+
+		points[i] = map[string]any{
+			"id":      uuid.NewSHA1(qdrantNamespace, []byte(collection+"/"+doc.ID)).String(),
+			"vector":  doc.Embedding,
+			"payload": payload,
+		}
+	}
+
+	_, err := qs.do(ctx, http.MethodPut, "/collections/"+url.PathEscape(collection)+"/points?wait=true", map[string]any{
+		"points": points,
+	})
+	return err
+}
+
+// Scan scrolls through the ids and metadata of the collection's documents matching filter.
+func (qs *QdrantStore) Scan(ctx context.Context, collection string, filter MetadataFilter, fn func([]Match) error) error {
+	return qs.scan(ctx, collection, filter, false, fn)
+}
+
+// ScanContent scrolls through every document of the collection with its content.
+func (qs *QdrantStore) ScanContent(ctx context.Context, collection string, fn func([]Match) error) error {
+	return qs.scan(ctx, collection, MetadataFilter{}, true, fn)
+}
+
+func (qs *QdrantStore) scan(ctx context.Context, collection string, filter MetadataFilter, withContent bool, fn func([]Match) error) error {
+	var offset any
+	for {
+		request := map[string]any{
+			"limit":        scanPageSize,
+			"with_payload": true,
+			"with_vector":  false,
+		}
+		if filter.Key != "" {
+			request["filter"] = qdrantMatchFilter(filter)
+		}
+		if offset != nil {
+			request["offset"] = offset
+		}
+
+		data, err := qs.do(ctx, http.MethodPost, "/collections/"+url.PathEscape(collection)+"/points/scroll", request)
+		if errors.Is(err, errCollectionNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var result struct {
+			Result struct {
+				Points []struct {
+					Payload map[string]any `json:"payload"`
+				} `json:"points"`
+				NextPageOffset any `json:"next_page_offset"`
+			} `json:"result"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			return fmt.Errorf("parse Qdrant scroll response: %w", err)
+		}
+
+		page := make([]Match, 0, len(result.Result.Points))
+		for _, point := range result.Result.Points {
+			id, _ := point.Payload[qdrantIDKey].(string)
+			match := Match{ID: id, Metadata: point.Payload}
+			if withContent {
+				match.Content, _ = point.Payload[qdrantContentKey].(string)
+			}
+			delete(point.Payload, qdrantContentKey)
+			delete(point.Payload, qdrantIDKey)
+			page = append(page, match)
+		}
+		if len(page) > 0 {
+			if err := fn(page); err != nil {
+				return err
+			}
+		}
+		if result.Result.NextPageOffset == nil {
+			return nil
+		}
+		offset = result.Result.NextPageOffset
+	}
+}
+
+// Delete removes the collection's documents matching filter.
+func (qs *QdrantStore) Delete(ctx context.Context, collection string, filter MetadataFilter) (int, error) {
+	if filter.Key == "" {
+		return 0, errEmptyDeleteFilter
+	}
+
+	path := "/collections/" + url.PathEscape(collection) + "/points"
+	data, err := qs.do(ctx, http.MethodPost, path+"/count", map[string]any{
+		"filter": qdrantMatchFilter(filter),
+		"exact":  true,
+	})
+	if errors.Is(err, errCollectionNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Result struct {
+			Count int `json:"count"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return 0, fmt.Errorf("parse Qdrant count response: %w", err)
+	}
+	if result.Result.Count == 0 {
+		return 0, nil
+	}
+
+	if _, err := qs.do(ctx, http.MethodPost, path+"/delete?wait=true", map[string]any{
+		"filter": qdrantMatchFilter(filter),
+	}); err != nil {
+		return 0, err
+	}
+	return result.Result.Count, nil
+}
+
+// Drop deletes the collection.
+func (qs *QdrantStore) Drop(ctx context.Context, collection string) error {
+	qs.mu.Lock()
+	delete(qs.created, collection)
+	qs.mu.Unlock()
+	_, err := qs.do(ctx, http.MethodDelete, "/collections/"+url.PathEscape(collection), nil)
+	if errors.Is(err, errCollectionNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Describe reads the collection's point count and vector size and scrolls through its
+// first points.
+func (qs *QdrantStore) Describe(ctx context.Context, collection string, samples int) (CollectionInfo, error) {
+	info := CollectionInfo{Name: collection}
+	path := "/collections/" + url.PathEscape(collection)
+	data, err := qs.do(ctx, http.MethodGet, path, nil)
+	if errors.Is(err, errCollectionNotFound) {
+		return info, nil
+	}
+	if err != nil {
+		return info, err
+	}
+
+	var result struct {
+		Result struct {
+			PointsCount int `json:"points_count"`
+			Config      struct {
+				Params struct {
+					// Vectors is {"size": n, ...} for collections with a single unnamed
+					// vector, which is how Upsert creates them.
+					Vectors struct {
+						Size int `json:"size"`
+					} `json:"vectors"`
+				} `json:"params"`
+			} `json:"config"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return info, fmt.Errorf("parse Qdrant collection response: %w", err)
+	}
+	info.Exists = true
+	info.Documents = result.Result.PointsCount
+	info.Dimension = result.Result.Config.Params.Vectors.Size
+	if samples == 0 || info.Documents == 0 {
+		return info, nil
+	}
+
+	data, err = qs.do(ctx, http.MethodPost, path+"/points/scroll", map[string]any{
+		"limit":        samples,
+		"with_payload": true,
+		"with_vector":  false,
+	})
+	if err != nil {
+		return info, err
+	}
+	var scroll struct {
+		Result struct {
+			Points []struct {
+				Payload map[string]any `json:"payload"`
+			} `json:"points"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &scroll); err != nil {
+		return info, fmt.Errorf("parse Qdrant scroll response: %w", err)
+	}
+	for _, point := range scroll.Result.Points {
+		id, _ := point.Payload[qdrantIDKey].(string)
+		content, _ := point.Payload[qdrantContentKey].(string)
+		delete(point.Payload, qdrantContentKey)
+		delete(point.Payload, qdrantIDKey)
+		info.Samples = append(info.Samples, SampleDocument{ID: id, Content: content, Metadata: point.Payload})
+	}
+	return info, nil
+}
+
+func qdrantMatchFilter(filter MetadataFilter) map[string]any {
+	return map[string]any{
+		"must": []map[string]any{
+			{"key": filter.Key, "match": map[string]any{"value": filter.Value}},
+		},
+	}
+}
+
+// HealthCheck verifies the Qdrant server is ready to serve requests.
+func (qs *QdrantStore) HealthCheck(ctx context.Context) error {
+	_, err := qs.do(ctx, http.MethodGet, "/readyz", nil)
+	return err
+}
+
+func (qs *QdrantStore) ensureCollection(ctx context.Context, collection string, size int) error {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	if qs.created[collection] {
+		return nil
+	}
+
+	path := "/collections/" + url.PathEscape(collection)
+	_, err := qs.do(ctx, http.MethodGet, path, nil)
+	if errors.Is(err, errCollectionNotFound) {
+		_, err = qs.do(ctx, http.MethodPut, path, map[string]any{
+			"vectors": map[string]any{"size": size, "distance": "Cosine"},
+		})
+	}
+	if err != nil {
+		return err
+	}
+	qs.created[collection] = true
+	return nil
+}
+
+func (qs *QdrantStore) do(ctx context.Context, method, path string, payload any) ([]byte, error) {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("marshal Qdrant request: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, qs.cfg.URL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("build Qdrant request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if qs.cfg.APIKey != "" {
+		req.Header.Set("api-key", qs.cfg.APIKey)
+	}
+
+	resp, err := qs.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Qdrant request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read Qdrant response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errCollectionNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("Qdrant returned %d: %s", resp.StatusCode, truncate(string(data), 500))
+	}
+	return data, nil
+}
@@ -0,0 +1,370 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Rerankers selectable with RAG_RERANKER.
+const (
+	RerankerNone = "none"
+	// RerankerBM25 blends a BM25 score over the candidates with their vector similarity.
+	RerankerBM25 = "bm25"
+	// RerankerAPI scores candidates with a cross-encoder behind a Cohere/Jina-compatible /rerank endpoint.
+	RerankerAPI = "api"
+
+	defaultRerankFactor        = 3
+	defaultRerankLexicalWeight = 0.5
+	// maxRerankCandidates matches the largest n_results the retrieval backends accept.
+	maxRerankCandidates = 20
+)
+
+// RerankConfig configures the reranking stage.
+type RerankConfig struct {
+	Method string
+	// Factor is how many candidates to retrieve per requested result.
+	Factor int
+	// LexicalWeight is the BM25 share of the hybrid score (0-1); the rest is vector similarity.
+	LexicalWeight float64
+	URL           string
+	Model         string
+	APIKey        string
+	Timeout       time.Duration
+}
+
+// RerankConfigFromEnv loads the reranker configuration from environment variables.
+func RerankConfigFromEnv() RerankConfig {
+	cfg := RerankConfig{
+		Method:        strings.ToLower(strings.TrimSpace(os.Getenv("RAG_RERANKER"))),
+		Factor:        defaultRerankFactor,
+		LexicalWeight: defaultRerankLexicalWeight,
+		URL:           os.Getenv("RAG_RERANK_URL"),
+		Model:         os.Getenv("RAG_RERANK_MODEL"),
+		APIKey:        os.Getenv("RAG_RERANK_API_KEY"),
+		Timeout:       10 * time.Second,
+	}
+	if factor, err := strconv.Atoi(os.Getenv("RAG_RERANK_FACTOR")); err == nil && factor > 0 {
+		cfg.Factor = factor
+	}
+	if weight, err := strconv.ParseFloat(os.Getenv("RAG_RERANK_LEXICAL_WEIGHT"), 64); err == nil && weight >= 0 && weight <= 1 {
+		cfg.LexicalWeight = weight
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("RAG_RERANK_TIMEOUT")); err == nil && timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	return cfg
+}
+
+// Reranker scores retrieved candidates against the query. Higher scores rank first.
+type Reranker interface {
+	Name() string
+	Score(ctx context.Context, query string, documents []string, distances []float64) ([]float64, error)
+}
+
+// NewReranker builds the reranker described by cfg. It returns nil when reranking is disabled.
+func NewReranker(cfg RerankConfig) (Reranker, error) {
+	switch cfg.Method {
+	case "", RerankerNone:
+		return nil, nil
+	case RerankerBM25:
+		return NewBM25Reranker(cfg.LexicalWeight), nil
+	case RerankerAPI:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("RAG_RERANK_URL is required for the api reranker")
+		}
+		return NewAPIReranker(cfg.URL, cfg.Model, cfg.APIKey, &http.Client{Timeout: cfg.Timeout}), nil
+	default:
+		return nil, fmt.Errorf("unsupported RAG_RERANKER %q", cfg.Method)
+	}
+}
+
+// ChunkScore reports where a returned context came from and how it was scored.
+type ChunkScore struct {
+	Rank         int     `json:"rank"`
+	OriginalRank int     `json:"original_rank"`
+	Distance     float64 `json:"distance"`
+	Score        float64 `json:"score"`
+}
+
+// RerankMetadata describes the reranking applied to a retrieval.
+type RerankMetadata struct {
+	Method     string       `json:"method"`
+	Candidates int          `json:"candidates"`
+	Code       []ChunkScore `json:"code"`
+	Docs       []ChunkScore `json:"docs"`
+}
+
+// rerankContexts reorders contexts by reranker score and keeps the top n.
+func rerankContexts(ctx context.Context, reranker Reranker, query string, contexts []string, distances []float64, n int) ([]string, []float64, []ChunkScore, error) {
+	if len(contexts) == 0 {
+		return contexts, distances, []ChunkScore{}, nil
+	}
+
+	scores, err := reranker.Score(ctx, query, contexts, distances)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(scores) != len(contexts) {
+		return nil, nil, nil, fmt.Errorf("reranker returned %d scores for %d candidates", len(scores), len(contexts))
+	}
+
+	order := make([]int, len(contexts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+	if len(order) > n {
+		order = order[:n]
+	}
+
+	rankedContexts := make([]string, len(order))
+	rankedDistances := make([]float64, len(order))
+	chunks := make([]ChunkScore, len(order))
+	for rank, i := range order {
+		rankedContexts[rank] = contexts[i]
+		if i < len(distances) {
+			rankedDistances[rank] = distances[i]
+		}
+		chunks[rank] = ChunkScore{
+			Rank:         rank + 1,
+			OriginalRank: i + 1,
+			Distance:     rankedDistances[rank],
+			Score:        scores[i],
+		}
+	}
+	return rankedContexts, rankedDistances, chunks, nil
+}
+
+// BM25Reranker blends Okapi BM25, computed over the candidate set, with vector similarity.
+type BM25Reranker struct {
+	lexicalWeight float64
+	k1            float64
+	b             float64
+}
+
+// NewBM25Reranker returns a hybrid reranker giving lexicalWeight to BM25 and the rest to vector similarity.
+func NewBM25Reranker(lexicalWeight float64) *BM25Reranker {
+	return &BM25Reranker{lexicalWeight: lexicalWeight, k1: 1.2, b: 0.75}
+}
+
+// Name identifies the reranker in response metadata.
+func (r *BM25Reranker) Name() string {
+	return RerankerBM25
+}
+
+// Score returns a hybrid score in [0, 1] per document.
+func (r *BM25Reranker) Score(_ context.Context, query string, documents []string, distances []float64) ([]float64, error) {
+	queryTerms := uniqueTerms(lexicalTerms(query))
+
+	docTerms := make([]map[string]int, len(documents))
+	docLengths := make([]int, len(documents))
+	docFreq := make(map[string]int)
+	totalLength := 0
+	for i, doc := range documents {
+		terms := lexicalTerms(doc)
+		counts := make(map[string]int, len(terms))
+		for _, term := range terms {
+			counts[term]++
+		}
+		for term := range counts {
+			docFreq[term]++
+		}
+		docTerms[i] = counts
+		docLengths[i] = len(terms)
+		totalLength += len(terms)
+	}
+	avgLength := float64(totalLength) / float64(len(documents))
+	if avgLength == 0 {
+		avgLength = 1
+	}
+
+	n := float64(len(documents))
+	lexical := make([]float64, len(documents))
+	maxLexical := 0.0
+	for i, counts := range docTerms {
+		for _, term := range queryTerms {
+			tf := float64(counts[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			lexical[i] += idf * tf * (r.k1 + 1) / (tf + r.k1*(1-r.b+r.b*float64(docLengths[i])/avgLength))
+		}
+		maxLexical = math.Max(maxLexical, lexical[i])
+	}
+
+	similarity := vectorSimilarity(distances, len(documents))
+	scores := make([]float64, len(documents))
+	for i := range documents {
+		if maxLexical > 0 {
+			lexical[i] /= maxLexical
+		}
+		scores[i] = r.lexicalWeight*lexical[i] + (1-r.lexicalWeight)*similarity[i]
+	}
+	return scores, nil
+}
+
+// vectorSimilarity rescales distances to [0, 1], nearest first. Without usable distances
+// it falls back to the retrieval order.
+func vectorSimilarity(distances []float64, n int) []float64 {
+	similarity := make([]float64, n)
+	if len(distances) != n {
+		for i := range similarity {
+			similarity[i] = 1 - float64(i)/float64(n)
+		}
+		return similarity
+	}
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, d := range distances {
+		lo, hi = math.Min(lo, d), math.Max(hi, d)
+	}
+	for i, d := range distances {
+		if hi == lo {
+			similarity[i] = 1
+			continue
+		}
+		similarity[i] = (hi - d) / (hi - lo)
+	}
+	return similarity
+}
+
+// lexicalTerms lowercases text and splits it into letter/digit runs, so Clarity
+// identifiers like stx-transfer? match both as a whole and by their parts.
+func lexicalTerms(text string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '-'
+	}) {
+		word = strings.Trim(word, "-")
+		if word == "" {
+			continue
+		}
+		terms = append(terms, word)
+		if strings.Contains(word, "-") {
+			for _, part := range strings.Split(word, "-") {
+				if part != "" {
+					terms = append(terms, part)
+				}
+			}
+		}
+	}
+	return terms
+}
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	unique := terms[:0:0]
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	return unique
+}
+
+// APIReranker calls a cross-encoder served behind a Cohere/Jina-compatible rerank endpoint.
+type APIReranker struct {
+	url    string
+	model  string
+	apiKey string
+	client *http.Client
+}
+
+// NewAPIReranker returns a reranker that posts candidates to url.
+func NewAPIReranker(url, model, apiKey string, client *http.Client) *APIReranker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &APIReranker{url: url, model: model, apiKey: apiKey, client: client}
+}
+
+// Name identifies the reranker in response metadata.
+func (r *APIReranker) Name() string {
+	return RerankerAPI
+}
+
+// Score returns the cross-encoder relevance score per document.
+func (r *APIReranker) Score(ctx context.Context, query string, documents []string, _ []float64) ([]float64, error) {
+	payload := map[string]any{
+		"query":     query,
+		"documents": documents,
+		"top_n":     len(documents),
+	}
+	if r.model != "" {
+		payload["model"] = r.model
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshal rerank request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("build rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("rerank request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read rerank response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rerank server returned %d: %s", resp.StatusCode, truncate(string(data), 500))
+	}
+
+	type result struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	}
+	// Cohere and Jina return "results"; Voyage returns "data".
+	var parsed struct {
+		Results []result `json:"results"`
+		Data    []result `json:"data"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("parse rerank response: %w", err)
+	}
+	results := parsed.Results
+	if len(results) == 0 {
+		results = parsed.Data
+	}
+
+	// Candidates the server left out rank below any relevance score.
+	scores := make([]float64, len(documents))
+	for i := range scores {
+		scores[i] = -1
+	}
+	for _, res := range results {
+		if res.Index < 0 || res.Index >= len(documents) {
+			return nil, fmt.Errorf("rerank server returned out-of-range index %d", res.Index)
+		}
+		scores[res.Index] = res.RelevanceScore
+	}
+	return scores, nil
+}
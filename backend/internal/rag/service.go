@@ -3,24 +3,170 @@ package rag
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Retrieval backends selectable with RAG_BACKEND.
+const (
+	BackendPython   = "python"
+	BackendChroma   = "chroma"
+	BackendQdrant   = "qdrant"
+	BackendPgvector = "pgvector"
+)
+
+// Retriever retrieves code and documentation contexts for a query.
+type Retriever interface {
+	RetrieveContext(ctx context.Context, query string, nResults int, filter Filter) (*RAGResponse, error)
+}
+
+// backend fetches raw contexts from the vector store.
+type backend interface {
+	Retrieve(ctx context.Context, query string, limits Limits, filter Filter) (*RAGResponse, error)
+}
+
+const maxResultsPerCollection = 20
+
+// Limits is how many contexts to retrieve from the code and documentation collections.
+type Limits struct {
+	Code int
+	Docs int
+}
+
+// clamp keeps both limits within 1-20.
+func (l Limits) clamp() Limits {
+	if l.Code < 1 || l.Code > maxResultsPerCollection {
+		l.Code = maxResultsPerCollection
+	}
+	if l.Docs < 1 || l.Docs > maxResultsPerCollection {
+		l.Docs = maxResultsPerCollection
+	}
+	return l
+}
+
+// RetrievalConfig splits retrieval between the code and documentation collections.
+type RetrievalConfig struct {
+	// CodeResults and DocsResults fix how many contexts each collection returns; zero follows
+	// the request's n_results.
+	CodeResults int
+	DocsResults int
+}
+
+// RetrievalConfigFromEnv reads RAG_CODE_RESULTS and RAG_DOCS_RESULTS. Values outside 1-20
+// are ignored.
+func RetrievalConfigFromEnv() RetrievalConfig {
+	var cfg RetrievalConfig
+	if n, err := strconv.Atoi(os.Getenv("RAG_CODE_RESULTS")); err == nil && n >= 1 && n <= maxResultsPerCollection {
+		cfg.CodeResults = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("RAG_DOCS_RESULTS")); err == nil && n >= 1 && n <= maxResultsPerCollection {
+		cfg.DocsResults = n
+	}
+	return cfg
+}
+
 // Service provides RAG retrieval operations from ChromaDB
 type Service struct {
+	backend      backend
 	pythonClient *PythonClient
+	reranker     Reranker
+	rerankFactor int
+	retrieval    RetrievalConfig
+	searchMode   string
+	info         Info
+}
+
+// Info describes how a service retrieves, so retrieval parameters can be tuned against it.
+type Info struct {
+	// Backend is the RAG_BACKEND in use.
+	Backend string `json:"backend"`
+	// EmbeddingModel embeds queries; it must match the model the collections were ingested with.
+	EmbeddingModel string `json:"embedding_model"`
+	// CodeResults and DocsResults are the fixed per-collection limits; zero follows n_results.
+	CodeResults int `json:"code_results,omitempty"`
+	DocsResults int `json:"docs_results,omitempty"`
+	// Reranker names the reranking stage, which scores RerankFactor times the limit of candidates.
+	Reranker     string `json:"reranker,omitempty"`
+	RerankFactor int    `json:"rerank_factor,omitempty"`
+	// SearchMode is the default search mode; KeywordWeight is the keyword share of hybrid search.
+	SearchMode    string  `json:"search_mode"`
+	KeywordWeight float64 `json:"keyword_weight,omitempty"`
 }
 
-// NewService creates a new RAG service
+// NewService creates a new RAG service backed by the Python bridge
 func NewService(pythonClient *PythonClient) *Service {
 	return &Service{
+		backend:      pythonClient,
 		pythonClient: pythonClient,
+		searchMode:   SearchModeVector,
+		info:         Info{Backend: BackendPython, EmbeddingModel: DefaultEmbeddingModel},
+	}
+}
+
+// NewVectorStoreService creates a RAG service that embeds queries with embedder and searches
+// store directly. A zero timeout uses the default of one minute per retrieval.
+func NewVectorStoreService(store VectorStore, embedder Embedder, timeout time.Duration) *Service {
+	if timeout <= 0 {
+		timeout = defaultStoreTimeout
+	}
+	info := Info{Backend: store.Name()}
+	if named, ok := embedder.(interface{ Model() string }); ok {
+		info.EmbeddingModel = named.Model()
+	}
+	backend := &storeBackend{
+		store:         store,
+		embedder:      embedder,
+		timeout:       timeout,
+		keyword:       newKeywordIndexes(defaultKeywordIndexTTL),
+		keywordWeight: defaultHybridKeywordWeight,
 	}
+	return &Service{backend: backend, searchMode: SearchModeVector, info: info}
 }
 
-// NewServiceFromEnv creates a new RAG service using environment variables
+// NewServiceFromEnv creates a new RAG service using environment variables.
+// RAG_BACKEND selects "python" (default), "chroma", "qdrant" or "pgvector"; RAG_RERANKER
+// enables a reranking stage; RAG_CODE_RESULTS and RAG_DOCS_RESULTS set per-collection limits;
+// RAG_SEARCH_MODE selects the default search mode.
 func NewServiceFromEnv() (*Service, error) {
+	rerankCfg := RerankConfigFromEnv()
+	reranker, err := NewReranker(rerankCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	service, err := newBackendServiceFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	service.SetReranker(reranker, rerankCfg.Factor)
+	service.SetRetrievalConfig(RetrievalConfigFromEnv())
+	if err := service.SetSearchConfig(SearchConfigFromEnv()); err != nil {
+		return nil, err
+	}
+	return service, nil
+}
+
+// backendFromEnv returns the normalised RAG_BACKEND, defaulting to the python bridge.
+func backendFromEnv() string {
+	backendName := strings.ToLower(strings.TrimSpace(os.Getenv("RAG_BACKEND")))
+	if backendName == "" {
+		return BackendPython
+	}
+	return backendName
+}
+
+func newBackendServiceFromEnv() (*Service, error) {
+	if backendName := backendFromEnv(); backendName != BackendPython {
+		store, embedder, timeout, err := vectorStoreFromEnv(backendName)
+		if err != nil {
+			return nil, err
+		}
+		return NewVectorStoreService(store, embedder, timeout), nil
+	}
+
 	scriptPath := os.Getenv("PYTHON_SCRIPT_PATH")
 	if scriptPath == "" {
 		scriptPath = "./scripts/rag_retriever.py"
@@ -31,8 +177,9 @@ func NewServiceFromEnv() (*Service, error) {
 	return NewService(pythonClient), nil
 }
 
-// RetrieveContext retrieves relevant Clarity code context from ChromaDB
-func (s *Service) RetrieveContext(ctx context.Context, query string, nResults int) (*RAGResponse, error) {
+// RetrieveContext retrieves relevant Clarity code context from ChromaDB, restricted by filter
+// and ranked by its search mode.
+func (s *Service) RetrieveContext(ctx context.Context, query string, nResults int, filter Filter) (*RAGResponse, error) {
 	if nResults == 0 {
 		nResults = 5
 	}
@@ -40,6 +187,205 @@ func (s *Service) RetrieveContext(ctx context.Context, query string, nResults in
 	if nResults < 1 || nResults > 20 {
 		return nil, fmt.Errorf("n_results must be between 1 and 20")
 	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	filter = filter.Normalize()
+	if filter.SearchMode == "" {
+		filter.SearchMode = s.searchMode
+	}
+	if filter.SearchMode != SearchModeVector && s.pythonClient != nil {
+		return nil, fmt.Errorf("search_mode %q requires RAG_BACKEND chroma, qdrant or pgvector", filter.SearchMode)
+	}
+	limits := s.limits(nResults)
 
-	return s.pythonClient.Retrieve(ctx, query, nResults)
+	start := time.Now()
+	var (
+		response *RAGResponse
+		err      error
+	)
+	if s.reranker == nil {
+		response, err = s.backend.Retrieve(ctx, query, limits, filter)
+	} else {
+		response, err = s.retrieveReranked(ctx, query, limits, filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if response.Timings == nil {
+		response.Timings = &RetrievalTimings{}
+	}
+	response.Timings.TotalMs = time.Since(start).Milliseconds()
+	return response, nil
+}
+
+// Info describes the backend, embedding model, limits and reranker the service retrieves with.
+func (s *Service) Info() Info {
+	info := s.info
+	info.CodeResults = s.retrieval.CodeResults
+	info.DocsResults = s.retrieval.DocsResults
+	if s.reranker != nil {
+		info.Reranker = s.reranker.Name()
+		info.RerankFactor = s.rerankFactor
+	}
+	info.SearchMode = s.searchMode
+	if backend, ok := s.backend.(*storeBackend); ok {
+		info.KeywordWeight = backend.keywordWeight
+	}
+	return info
+}
+
+// SetRetrievalConfig sets the per-collection result limits.
+func (s *Service) SetRetrievalConfig(cfg RetrievalConfig) {
+	s.retrieval = cfg
+}
+
+// SetSearchConfig sets the default search mode, the hybrid keyword weight and how often
+// keyword indexes are rebuilt. Only the vector store backends support keyword and hybrid search.
+func (s *Service) SetSearchConfig(cfg SearchConfig) error {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = SearchModeVector
+	}
+	if err := validateSearchMode(mode); err != nil {
+		return fmt.Errorf("unsupported RAG_SEARCH_MODE %q", cfg.Mode)
+	}
+
+	backend, ok := s.backend.(*storeBackend)
+	if !ok {
+		if mode != SearchModeVector {
+			return fmt.Errorf("RAG_SEARCH_MODE %s requires RAG_BACKEND chroma, qdrant or pgvector", mode)
+		}
+		return nil
+	}
+	s.searchMode = mode
+	backend.keywordWeight = cfg.KeywordWeight
+	backend.keyword = newKeywordIndexes(cfg.IndexTTL)
+	return nil
+}
+
+// limits returns the per-collection limits for a request asking for nResults contexts.
+func (s *Service) limits(nResults int) Limits {
+	limits := Limits{Code: nResults, Docs: nResults}
+	if s.retrieval.CodeResults > 0 {
+		limits.Code = s.retrieval.CodeResults
+	}
+	if s.retrieval.DocsResults > 0 {
+		limits.Docs = s.retrieval.DocsResults
+	}
+	return limits
+}
+
+// SetReranker enables reranking of factor x nResults candidates. A nil reranker disables it.
+func (s *Service) SetReranker(reranker Reranker, factor int) {
+	if factor < 1 {
+		factor = defaultRerankFactor
+	}
+	s.reranker = reranker
+	s.rerankFactor = factor
+}
+
+// retrieveReranked over-fetches candidates and keeps the contexts the reranker scores highest,
+// up to each collection's limit. If the reranker fails, the vector order is kept so retrieval
+// still succeeds.
+func (s *Service) retrieveReranked(ctx context.Context, query string, limits Limits, filter Filter) (*RAGResponse, error) {
+	candidates := Limits{
+		Code: min(limits.Code*s.rerankFactor, maxRerankCandidates),
+		Docs: min(limits.Docs*s.rerankFactor, maxRerankCandidates),
+	}
+	response, err := s.backend.Retrieve(ctx, query, candidates, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if err := s.rerank(ctx, query, response, limits, max(candidates.Code, candidates.Docs)); err != nil {
+		log.Printf("Warning: %s reranking failed, keeping vector order: %v", s.reranker.Name(), err)
+		response.CodeContexts, response.CodeDistances = truncateResults(response.CodeContexts, response.CodeDistances, limits.Code)
+		response.DocsContexts, response.DocsDistances = truncateResults(response.DocsContexts, response.DocsDistances, limits.Docs)
+		response.CodeSources = response.CodeSources[:min(len(response.CodeSources), limits.Code)]
+		response.DocsSources = response.DocsSources[:min(len(response.DocsSources), limits.Docs)]
+		if response.Search != nil {
+			response.Search.Code = response.Search.Code[:min(len(response.Search.Code), limits.Code)]
+			response.Search.Docs = response.Search.Docs[:min(len(response.Search.Docs), limits.Docs)]
+		}
+	}
+	if response.Timings == nil {
+		response.Timings = &RetrievalTimings{}
+	}
+	response.Timings.RerankMs = time.Since(start).Milliseconds()
+	return response, nil
+}
+
+// rerank reorders the code and documentation contexts of response in place.
+func (s *Service) rerank(ctx context.Context, query string, response *RAGResponse, limits Limits, candidates int) error {
+	codeContexts, codeDistances, codeScores, err := rerankContexts(ctx, s.reranker, query, response.CodeContexts, response.CodeDistances, limits.Code)
+	if err != nil {
+		return err
+	}
+	docsContexts, docsDistances, docsScores, err := rerankContexts(ctx, s.reranker, query, response.DocsContexts, response.DocsDistances, limits.Docs)
+	if err != nil {
+		return err
+	}
+
+	response.CodeContexts, response.CodeDistances = codeContexts, codeDistances
+	response.DocsContexts, response.DocsDistances = docsContexts, docsDistances
+	response.CodeSources = rerankAligned(response.CodeSources, codeScores)
+	response.DocsSources = rerankAligned(response.DocsSources, docsScores)
+	if response.Search != nil {
+		response.Search.Code = rerankAligned(response.Search.Code, codeScores)
+		response.Search.Docs = rerankAligned(response.Search.Docs, docsScores)
+	}
+	response.Rerank = &RerankMetadata{
+		Method:     s.reranker.Name(),
+		Candidates: candidates,
+		Code:       codeScores,
+		Docs:       docsScores,
+	}
+	return nil
+}
+
+// rerankAligned reorders sources or search scores to follow the reranked contexts they describe.
+func rerankAligned[T any](items []T, chunks []ChunkScore) []T {
+	if len(items) == 0 {
+		return items
+	}
+	ranked := make([]T, len(chunks))
+	for rank, chunk := range chunks {
+		if i := chunk.OriginalRank - 1; i < len(items) {
+			ranked[rank] = items[i]
+		}
+	}
+	return ranked
+}
+
+func truncateResults(contexts []string, distances []float64, n int) ([]string, []float64) {
+	if len(contexts) > n {
+		contexts = contexts[:n]
+	}
+	if len(distances) > n {
+		distances = distances[:n]
+	}
+	return contexts, distances
+}
+
+// HealthCheck probes the retrieval backend: a test retrieval through the Python bridge,
+// or the vector store's own health check.
+func (s *Service) HealthCheck(ctx context.Context) error {
+	if s.pythonClient != nil {
+		return s.pythonClient.HealthCheck(ctx)
+	}
+	if checker, ok := s.backend.(interface{ HealthCheck(context.Context) error }); ok {
+		return checker.HealthCheck(ctx)
+	}
+	return nil
+}
+
+// BridgeMetrics returns a snapshot of the Python bridge health metrics.
+// It reports false when the service does not use the Python bridge.
+func (s *Service) BridgeMetrics() (BridgeMetricsSnapshot, bool) {
+	if s.pythonClient == nil {
+		return BridgeMetricsSnapshot{}, false
+	}
+	return s.pythonClient.Metrics().Snapshot(), true
 }
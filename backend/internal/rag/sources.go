@@ -0,0 +1,147 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Source kinds a SourceSelector can match.
+const (
+	SourceKindRepo   = "repo"
+	SourceKindFile   = "file"
+	SourceKindDocURL = "doc_url"
+)
+
+// SourceSelector picks the chunks ingested from one repository, file or documentation page.
+// Files are named by their path including the repository, e.g. "clarity-examples/contracts/nft.clar".
+type SourceSelector struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Validate reports an unknown kind or an empty value.
+func (s SourceSelector) Validate() error {
+	switch s.Kind {
+	case SourceKindRepo, SourceKindFile, SourceKindDocURL:
+	default:
+		return fmt.Errorf("source kind must be %q, %q or %q", SourceKindRepo, SourceKindFile, SourceKindDocURL)
+	}
+	if strings.TrimSpace(s.Value) == "" {
+		return fmt.Errorf("%s must not be empty", s.Kind)
+	}
+	return nil
+}
+
+// filters returns the metadata filters matching the selector. Code sample files are stored
+// under rel_path and documentation files under source_file, so files match either.
+func (s SourceSelector) filters() []MetadataFilter {
+	switch s.Kind {
+	case SourceKindRepo:
+		return []MetadataFilter{{Key: MetadataRepo, Value: s.Value}}
+	case SourceKindFile:
+		return []MetadataFilter{{Key: MetadataRelPath, Value: s.Value}, {Key: MetadataSourceFile, Value: s.Value}}
+	case SourceKindDocURL:
+		return []MetadataFilter{{Key: MetadataDocURL, Value: s.Value}}
+	default:
+		return nil
+	}
+}
+
+// IndexedSource summarises the chunks of a collection ingested from one repository, or from
+// one file when a repository's files are listed.
+type IndexedSource struct {
+	Collection string `json:"collection"`
+	Repo       string `json:"repo"`
+	FilePath   string `json:"file_path,omitempty"`
+	DocURL     string `json:"doc_url,omitempty"`
+	// SourceURL and Branch are recorded for repositories ingested through the API.
+	SourceURL string `json:"source_url,omitempty"`
+	Branch    string `json:"branch,omitempty"`
+	Files     int    `json:"files,omitempty"`
+	Chunks    int    `json:"chunks"`
+}
+
+// Sources lists the repositories indexed in the collection with their file and chunk counts.
+// When repo is set, that repository's files are listed instead. Chunks are grouped by their
+// repo metadata; chunks ingested before it was recorded are listed under an empty repo.
+func (ix *Indexer) Sources(ctx context.Context, collection, repo string) ([]IndexedSource, error) {
+	var filter MetadataFilter
+	if repo != "" {
+		filter = MetadataFilter{Key: MetadataRepo, Value: repo}
+	}
+
+	groups := make(map[string]*IndexedSource)
+	files := make(map[string]map[string]bool)
+	err := ix.store.Scan(ctx, collection, filter, func(page []Match) error {
+		for _, match := range page {
+			source := SourceFromMetadata(match.Metadata)
+			repoName := metadataString(match.Metadata, MetadataRepo)
+
+			key := repoName
+			if repo != "" {
+				key = source.FilePath + "\x00" + source.DocURL
+			}
+			group, ok := groups[key]
+			if !ok {
+				group = &IndexedSource{
+					Collection: collection,
+					Repo:       repoName,
+					SourceURL:  metadataString(match.Metadata, MetadataSourceURL),
+					Branch:     metadataString(match.Metadata, MetadataBranch),
+				}
+				if repo != "" {
+					group.FilePath, group.DocURL = source.FilePath, source.DocURL
+				} else {
+					files[key] = make(map[string]bool)
+				}
+				groups[key] = group
+			}
+			group.Chunks++
+			if repo == "" && source.FilePath != "" {
+				files[key][source.FilePath] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan %s in %s: %w", collection, ix.store.Name(), err)
+	}
+
+	sources := make([]IndexedSource, 0, len(groups))
+	for key, group := range groups {
+		if repo == "" {
+			group.Files = len(files[key])
+		}
+		sources = append(sources, *group)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Repo != sources[j].Repo {
+			return sources[i].Repo < sources[j].Repo
+		}
+		if sources[i].FilePath != sources[j].FilePath {
+			return sources[i].FilePath < sources[j].FilePath
+		}
+		return sources[i].DocURL < sources[j].DocURL
+	})
+	return sources, nil
+}
+
+// DeleteSource removes the collection's chunks matching the selector and returns how many
+// were removed.
+func (ix *Indexer) DeleteSource(ctx context.Context, collection string, selector SourceSelector) (int, error) {
+	if err := selector.Validate(); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, filter := range selector.filters() {
+		n, err := ix.store.Delete(ctx, collection, filter)
+		deleted += n
+		if err != nil {
+			return deleted, fmt.Errorf("delete from %s in %s: %w", collection, ix.store.Name(), err)
+		}
+	}
+	return deleted, nil
+}
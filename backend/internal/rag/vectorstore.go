@@ -0,0 +1,345 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Collections written by the ingestion pipeline and searched by retrieval.
+const (
+	CodeCollection = "clarity_code_samples"
+	DocsCollection = "clarity_docs"
+)
+
+const (
+	defaultStoreTimeout   = 60 * time.Second
+	defaultIndexBatchSize = 32
+	// scanPageSize is the number of documents a store returns per page when scanning.
+	scanPageSize = 500
+)
+
+// errCollectionNotFound is returned by vector stores when a collection does not exist.
+var errCollectionNotFound = errors.New("collection not found")
+
+// Document is a chunk of text stored in a vector store collection.
+type Document struct {
+	ID        string
+	Content   string
+	Metadata  map[string]any
+	Embedding []float32
+}
+
+// MetadataFilter matches documents whose metadata Key equals Value. The zero value matches
+// every document.
+type MetadataFilter struct {
+	Key   string
+	Value string
+}
+
+// errEmptyDeleteFilter guards against wiping a collection with a zero filter.
+var errEmptyDeleteFilter = errors.New("delete requires a metadata filter")
+
+// Match is a document returned by a vector store query.
+type Match struct {
+	ID      string
+	Content string
+	// Distance is lower for closer documents.
+	Distance float64
+	Metadata map[string]any
+}
+
+// VectorStore is a vector database holding the code sample and documentation collections.
+type VectorStore interface {
+	// Name identifies the store in logs and errors.
+	Name() string
+	// Query returns up to nResults documents of the collection nearest to the embedding,
+	// closest first. When repos is set only documents whose repo metadata matches are searched.
+	// It returns errCollectionNotFound for missing collections.
+	Query(ctx context.Context, collection string, embedding []float32, nResults int, repos []string) ([]Match, error)
+	// Upsert writes documents with their embeddings, creating the collection when needed.
+	Upsert(ctx context.Context, collection string, docs []Document) error
+	// Scan passes the ids and metadata of the collection's documents matching filter to fn,
+	// a page at a time. Missing collections have no documents.
+	Scan(ctx context.Context, collection string, filter MetadataFilter, fn func([]Match) error) error
+	// ScanContent is Scan over every document of the collection, including its content.
+	ScanContent(ctx context.Context, collection string, fn func([]Match) error) error
+	// Delete removes the collection's documents matching filter, which must not be zero,
+	// and returns how many were removed.
+	Delete(ctx context.Context, collection string, filter MetadataFilter) (int, error)
+	// Drop removes the collection and all its documents. Missing collections are ignored.
+	Drop(ctx context.Context, collection string) error
+	// Describe returns the collection's document count, embedding dimension and up to
+	// samples documents with their content. Missing collections are reported with Exists false.
+	Describe(ctx context.Context, collection string, samples int) (CollectionInfo, error)
+	// HealthCheck verifies the store is reachable.
+	HealthCheck(ctx context.Context) error
+}
+
+// storeBackend retrieves contexts by embedding the query and searching a vector store, by
+// keyword search over in-memory indexes of its collections, or by fusing both.
+type storeBackend struct {
+	store    VectorStore
+	embedder Embedder
+	timeout  time.Duration
+	keyword  *keywordIndexes
+	// keywordWeight is the keyword share of hybrid fusion.
+	keywordWeight float64
+}
+
+// Retrieve searches the code and documentation collections concurrently for the chunks
+// matching the filter, ranked by filter.SearchMode. Vector and hybrid searches embed the
+// query once for both collections. A failed search cancels the other.
+func (b *storeBackend) Retrieve(ctx context.Context, query string, limits Limits, filter Filter) (*RAGResponse, error) {
+	if query == "" {
+		return nil, fmt.Errorf("query cannot be empty")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	timings := &RetrievalTimings{}
+	response := &RAGResponse{
+		CodeContexts:  []string{},
+		CodeDistances: []float64{},
+		DocsContexts:  []string{},
+		DocsDistances: []float64{},
+		Timings:       timings,
+	}
+
+	var embedding []float32
+	if filter.SearchMode != SearchModeKeyword {
+		start := time.Now()
+		vectors, err := b.embedder.Embed(ctx, []string{query})
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed query: %w", err)
+		}
+		embedding = vectors[0]
+		timings.EmbedMs = time.Since(start).Milliseconds()
+		response.EmbeddingDimensions = len(embedding)
+	}
+	if filter.SearchMode == SearchModeKeyword || filter.SearchMode == SearchModeHybrid {
+		response.Search = &SearchMetadata{Mode: filter.SearchMode, Code: []SearchScore{}, Docs: []SearchScore{}}
+		if filter.SearchMode == SearchModeHybrid {
+			response.Search.KeywordWeight = b.keywordWeight
+		}
+	}
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	if filter.IncludesCode() {
+		group.Go(func() error {
+			start := time.Now()
+			matches, scores, err := b.search(groupCtx, CodeCollection, query, embedding, limits.Code, filter)
+			timings.CodeMs = time.Since(start).Milliseconds()
+			if errors.Is(err, errCollectionNotFound) {
+				return fmt.Errorf("collection '%s' not found, please run code ingestion first", CodeCollection)
+			}
+			if err != nil {
+				return err
+			}
+			response.CodeContexts, response.CodeDistances, response.CodeSources = splitMatches(matches)
+			if response.Search != nil {
+				response.Search.Code = scores
+			}
+			return nil
+		})
+	}
+
+	if filter.IncludesDocs() {
+		group.Go(func() error {
+			start := time.Now()
+			matches, scores, err := b.search(groupCtx, DocsCollection, query, embedding, limits.Docs, filter)
+			timings.DocsMs = time.Since(start).Milliseconds()
+			switch {
+			case errors.Is(err, errCollectionNotFound) && !filter.IncludesCode():
+				return fmt.Errorf("collection '%s' not found, please run docs ingestion first", DocsCollection)
+			case errors.Is(err, errCollectionNotFound):
+				response.Warning = fmt.Sprintf("Collection '%s' not found. Documentation results will be empty.", DocsCollection)
+			case err != nil:
+				return err
+			default:
+				response.DocsContexts, response.DocsDistances, response.DocsSources = splitMatches(matches)
+				if response.Search != nil {
+					response.Search.Docs = scores
+				}
+			}
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// search returns up to limit chunks of one collection in the filter's search mode, with
+// their keyword and hybrid scores.
+func (b *storeBackend) search(ctx context.Context, collection, query string, embedding []float32, limit int, filter Filter) ([]Match, []SearchScore, error) {
+	switch filter.SearchMode {
+	case SearchModeKeyword:
+		index, err := b.keyword.get(ctx, b.store, collection)
+		if err != nil {
+			return nil, nil, err
+		}
+		matches, bm25 := index.search(query, limit, filter.Repos)
+		return matches, keywordSearchScores(bm25), nil
+
+	case SearchModeHybrid:
+		candidates := limit * hybridCandidateFactor
+		var (
+			vector, keyword []Match
+			bm25            []float64
+		)
+		group, groupCtx := errgroup.WithContext(ctx)
+		group.Go(func() error {
+			var err error
+			vector, err = b.store.Query(groupCtx, collection, embedding, candidates, filter.Repos)
+			return err
+		})
+		group.Go(func() error {
+			index, err := b.keyword.get(groupCtx, b.store, collection)
+			if err != nil {
+				return err
+			}
+			keyword, bm25 = index.search(query, candidates, filter.Repos)
+			return nil
+		})
+		if err := group.Wait(); err != nil {
+			return nil, nil, err
+		}
+		matches, scores := fuseRankings(vector, keyword, bm25, b.keywordWeight, limit)
+		return matches, scores, nil
+
+	default:
+		matches, err := b.store.Query(ctx, collection, embedding, limit, filter.Repos)
+		return matches, nil, err
+	}
+}
+
+// splitMatches separates matches into index-aligned contexts, distances and sources.
+func splitMatches(matches []Match) ([]string, []float64, []Source) {
+	contexts := make([]string, len(matches))
+	distances := make([]float64, len(matches))
+	sources := make([]Source, len(matches))
+	for i, match := range matches {
+		contexts[i] = match.Content
+		distances[i] = match.Distance
+		sources[i] = SourceFromMetadata(match.Metadata)
+		sources[i].ID = match.ID
+	}
+	return contexts, distances, sources
+}
+
+// HealthCheck verifies the vector store is reachable.
+func (b *storeBackend) HealthCheck(ctx context.Context) error {
+	return b.store.HealthCheck(ctx)
+}
+
+// Indexer embeds documents and writes them to a vector store.
+type Indexer struct {
+	store     VectorStore
+	embedder  Embedder
+	batchSize int
+}
+
+// NewIndexer returns an indexer that embeds with embedder and writes to store.
+func NewIndexer(store VectorStore, embedder Embedder) *Indexer {
+	return &Indexer{store: store, embedder: embedder, batchSize: defaultIndexBatchSize}
+}
+
+// NewIndexerFromEnv returns an indexer for the vector store selected by RAG_BACKEND.
+// It returns nil for the python backend, whose ingestion scripts write to ChromaDB themselves.
+func NewIndexerFromEnv() (*Indexer, error) {
+	backendName := backendFromEnv()
+	if backendName == BackendPython {
+		return nil, nil
+	}
+
+	store, embedder, _, err := vectorStoreFromEnv(backendName)
+	if err != nil {
+		return nil, err
+	}
+	return NewIndexer(store, embedder), nil
+}
+
+// Store returns the vector store the indexer writes to.
+func (ix *Indexer) Store() VectorStore {
+	return ix.store
+}
+
+// Index embeds documents without an embedding and upserts them into the collection in batches.
+func (ix *Indexer) Index(ctx context.Context, collection string, docs []Document) error {
+	for start := 0; start < len(docs); start += ix.batchSize {
+		batch := docs[start:min(start+ix.batchSize, len(docs))]
+
+		var texts []string
+		var missing []int
+		for i, doc := range batch {
+			if len(doc.Embedding) == 0 {
+				texts = append(texts, doc.Content)
+				missing = append(missing, i)
+			}
+		}
+		if len(texts) > 0 {
+			vectors, err := ix.embedder.Embed(ctx, texts)
+			if err != nil {
+				return fmt.Errorf("embed documents: %w", err)
+			}
+			for j, i := range missing {
+				batch[i].Embedding = vectors[j]
+			}
+		}
+
+		if err := ix.store.Upsert(ctx, collection, batch); err != nil {
+			return fmt.Errorf("store documents in %s: %w", ix.store.Name(), err)
+		}
+	}
+	return nil
+}
+
+// vectorStoreFromEnv builds the vector store named by backendName, resolving collection
+// aliases, along with the query embedder and the retrieval timeout.
+func vectorStoreFromEnv(backendName string) (VectorStore, Embedder, time.Duration, error) {
+	var (
+		store      VectorStore
+		timeout    time.Duration
+		httpClient *http.Client
+		err        error
+	)
+	switch backendName {
+	case BackendChroma:
+		cfg := ChromaConfigFromEnv()
+		httpClient = NewPooledHTTPClient(max(cfg.MaxConns, defaultChromaMaxConns))
+		store, err = NewChromaClient(cfg, httpClient)
+		timeout = cfg.Timeout
+	case BackendQdrant:
+		cfg := QdrantConfigFromEnv()
+		httpClient = NewPooledHTTPClient(defaultChromaMaxConns)
+		store, err = NewQdrantStore(cfg, httpClient)
+		timeout = cfg.Timeout
+	case BackendPgvector:
+		cfg := PgvectorConfigFromEnv()
+		httpClient = NewPooledHTTPClient(defaultChromaMaxConns)
+		store, err = NewPgvectorStoreFromConfig(cfg)
+		timeout = cfg.Timeout
+	default:
+		return nil, nil, 0, fmt.Errorf("unsupported RAG_BACKEND %q", backendName)
+	}
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	embedder, err := NewHTTPEmbedderFromEnv(httpClient)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if timeout <= 0 {
+		timeout = defaultStoreTimeout
+	}
+	return aliasedStore{store}, embedder, timeout, nil
+}
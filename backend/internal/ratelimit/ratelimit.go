@@ -0,0 +1,189 @@
+// Package ratelimit counts requests per client in fixed windows. Counters live in process
+// memory, or in Redis when REDIS_URL is set so every replica enforces one shared limit.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/redis"
+)
+
+const (
+	defaultWindow        = time.Minute
+	defaultTrialRequests = 10
+	defaultKeyPrefix     = "stacks-builder:ratelimit:"
+	// pruneEvery is how many increments the memory store handles between sweeps of expired
+	// windows.
+	pruneEvery = 1024
+)
+
+// Config controls how many requests a client may make per window.
+type Config struct {
+	// Requests is the limit per window. Zero disables rate limiting.
+	Requests int
+	Window   time.Duration
+	// RedisURL, when set, keeps the counters in Redis.
+	RedisURL string
+	// KeyPrefix namespaces the Redis counters.
+	KeyPrefix string
+}
+
+// ConfigFromEnv loads RATE_LIMIT_REQUESTS, RATE_LIMIT_WINDOW, RATE_LIMIT_KEY_PREFIX and
+// REDIS_URL.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Window:    defaultWindow,
+		RedisURL:  strings.TrimSpace(os.Getenv("REDIS_URL")),
+		KeyPrefix: os.Getenv("RATE_LIMIT_KEY_PREFIX"),
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("RATE_LIMIT_REQUESTS"))); err == nil && n > 0 {
+		cfg.Requests = n
+	}
+	if window, err := time.ParseDuration(os.Getenv("RATE_LIMIT_WINDOW")); err == nil && window > 0 {
+		cfg.Window = window
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = defaultKeyPrefix
+	}
+	return cfg
+}
+
+// TrialConfigFromEnv loads the stricter limit applied to anonymous trial tokens from
+// TRIAL_RATE_LIMIT_REQUESTS (default 10) and TRIAL_RATE_LIMIT_WINDOW (default 1m). The
+// counters share REDIS_URL and the RATE_LIMIT_KEY_PREFIX namespace.
+func TrialConfigFromEnv() Config {
+	cfg := ConfigFromEnv()
+	cfg.Requests = defaultTrialRequests
+	cfg.Window = defaultWindow
+	cfg.KeyPrefix += "trial:"
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("TRIAL_RATE_LIMIT_REQUESTS"))); err == nil && n > 0 {
+		cfg.Requests = n
+	}
+	if window, err := time.ParseDuration(os.Getenv("TRIAL_RATE_LIMIT_WINDOW")); err == nil && window > 0 {
+		cfg.Window = window
+	}
+	return cfg
+}
+
+// Store increments per-window counters.
+type Store interface {
+	// IncrWindow increments the counter under key, which expires window after its first
+	// increment, and returns the new count.
+	IncrWindow(ctx context.Context, key string, window time.Duration) (int64, error)
+}
+
+// Result is the outcome of counting one request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// Limiter enforces Config.Requests per Config.Window. A nil *Limiter allows everything.
+type Limiter struct {
+	store Store
+	cfg   Config
+	now   func() time.Time
+}
+
+// New returns a limiter counting in Redis when RedisURL is set and in memory otherwise.
+// An invalid RedisURL is logged and counts are kept in memory. It returns nil when rate
+// limiting is disabled.
+func New(cfg Config) *Limiter {
+	if cfg.Requests <= 0 {
+		return nil
+	}
+	if cfg.RedisURL != "" {
+		client, err := redis.New(cfg.RedisURL)
+		if err == nil {
+			return NewWithStore(client, cfg)
+		}
+		log.Printf("ratelimit: counting requests in memory: %v", err)
+	}
+	return NewWithStore(NewMemoryStore(), cfg)
+}
+
+// NewWithStore returns a limiter counting in store, or nil when rate limiting is disabled.
+func NewWithStore(store Store, cfg Config) *Limiter {
+	if cfg.Requests <= 0 {
+		return nil
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaultWindow
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = defaultKeyPrefix
+	}
+	return &Limiter{store: store, cfg: cfg, now: time.Now}
+}
+
+// Allow counts a request from the client identified by key. Errors come from the store;
+// callers decide whether to fail open.
+func (l *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	if l == nil {
+		return Result{Allowed: true}, nil
+	}
+
+	now := l.now()
+	start := now.Truncate(l.cfg.Window)
+	result := Result{Limit: l.cfg.Requests, ResetAt: start.Add(l.cfg.Window)}
+
+	count, err := l.store.IncrWindow(ctx, fmt.Sprintf("%s%s:%d", l.cfg.KeyPrefix, key, start.Unix()), l.cfg.Window)
+	if err != nil {
+		result.Allowed = true
+		return result, err
+	}
+	result.Allowed = count <= int64(l.cfg.Requests)
+	result.Remaining = max(l.cfg.Requests-int(count), 0)
+	return result, nil
+}
+
+// MemoryStore keeps counters in process memory.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]*memoryCounter
+	calls    int
+}
+
+type memoryCounter struct {
+	count     int64
+	expiresAt time.Time
+}
+
+// NewMemoryStore returns an empty in-process store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]*memoryCounter)}
+}
+
+// IncrWindow increments the counter under key.
+func (s *MemoryStore) IncrWindow(_ context.Context, key string, window time.Duration) (int64, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.calls%pruneEvery == 0 {
+		for k, counter := range s.counters {
+			if !now.Before(counter.expiresAt) {
+				delete(s.counters, k)
+			}
+		}
+	}
+
+	counter, ok := s.counters[key]
+	if !ok || !now.Before(counter.expiresAt) {
+		counter = &memoryCounter{expiresAt: now.Add(window)}
+		s.counters[key] = counter
+	}
+	counter.count++
+	return counter.count, nil
+}
@@ -0,0 +1,285 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+)
+
+const (
+	defaultSampleSize  = 50
+	maxSampleSize      = 500
+	defaultConcurrency = 4
+	maxConcurrency     = 32
+	defaultTimeout     = 120 * time.Second
+	maxErrorSamples    = 10
+)
+
+// Options configures a replay run.
+type Options struct {
+	// TargetURL is the base URL of the server (or shadow deployment) receiving replayed requests.
+	TargetURL string
+	// APIKey is sent as x-api-key on every replayed request.
+	APIKey string
+	// Endpoint restricts sampling to one of querylog.ReplayableEndpoints. Empty means any of
+	// them.
+	Endpoint    string
+	SampleSize  int
+	Concurrency int
+	Timeout     time.Duration
+}
+
+// LatencyStats summarises request latencies in milliseconds.
+type LatencyStats struct {
+	Min  int64   `json:"min"`
+	Max  int64   `json:"max"`
+	Mean float64 `json:"mean"`
+	P50  int64   `json:"p50"`
+	P90  int64   `json:"p90"`
+	P99  int64   `json:"p99"`
+}
+
+// Report describes the outcome of a replay run.
+type Report struct {
+	TargetURL       string                  `json:"target_url"`
+	Endpoint        string                  `json:"endpoint,omitempty"`
+	Concurrency     int                     `json:"concurrency"`
+	Total           int                     `json:"total"`
+	SuccessCount    int                     `json:"success_count"`
+	ErrorCount      int                     `json:"error_count"`
+	StatusCodes     map[int]int             `json:"status_codes"`
+	ByEndpoint      map[string]int          `json:"by_endpoint"`
+	Latency         LatencyStats            `json:"latency_ms"`
+	ErrorSamples    []string                `json:"error_samples,omitempty"`
+	DurationMs      int64                   `json:"duration_ms"`
+	RequestsPerSec  float64                 `json:"requests_per_sec"`
+	StartedAt       time.Time               `json:"started_at"`
+	CompletedAt     time.Time               `json:"completed_at"`
+	EndpointLatency map[string]LatencyStats `json:"endpoint_latency_ms"`
+}
+
+// Runner replays historical query logs against a target server.
+type Runner struct {
+	repo   *querylog.Repository
+	client *http.Client
+}
+
+// NewRunner returns a Runner that samples from the supplied query log repository.
+func NewRunner(repo *querylog.Repository) *Runner {
+	return &Runner{
+		repo:   repo,
+		client: &http.Client{},
+	}
+}
+
+type result struct {
+	endpoint  string
+	status    int
+	latencyMs int64
+	err       error
+}
+
+// Run samples query logs and replays them with bounded concurrency.
+func (r *Runner) Run(ctx context.Context, opts Options) (*Report, error) {
+	opts, err := normaliseOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := r.repo.SampleReplayable(opts.Endpoint, opts.SampleSize)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		TargetURL:   opts.TargetURL,
+		Endpoint:    opts.Endpoint,
+		Concurrency: opts.Concurrency,
+		StatusCodes: make(map[int]int),
+		ByEndpoint:  make(map[string]int),
+		StartedAt:   time.Now().UTC(),
+	}
+
+	jobs := make(chan querylog.QueryLog)
+	results := make(chan result, len(logs))
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for entry := range jobs {
+				results <- r.replayOne(ctx, opts, entry)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, entry := range logs {
+			select {
+			case jobs <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	wg.Wait()
+	close(results)
+
+	var (
+		all        []int64
+		byEndpoint = make(map[string][]int64)
+	)
+	for res := range results {
+		report.Total++
+		report.ByEndpoint[res.endpoint]++
+		if res.err != nil {
+			report.ErrorCount++
+			if len(report.ErrorSamples) < maxErrorSamples {
+				report.ErrorSamples = append(report.ErrorSamples, fmt.Sprintf("%s: %v", res.endpoint, res.err))
+			}
+			continue
+		}
+
+		report.StatusCodes[res.status]++
+		if res.status >= 200 && res.status < 400 {
+			report.SuccessCount++
+		} else {
+			report.ErrorCount++
+		}
+		all = append(all, res.latencyMs)
+		byEndpoint[res.endpoint] = append(byEndpoint[res.endpoint], res.latencyMs)
+	}
+
+	report.CompletedAt = time.Now().UTC()
+	report.DurationMs = report.CompletedAt.Sub(report.StartedAt).Milliseconds()
+	if report.DurationMs > 0 {
+		report.RequestsPerSec = float64(report.Total) / (float64(report.DurationMs) / 1000)
+	}
+	report.Latency = summarise(all)
+	report.EndpointLatency = make(map[string]LatencyStats, len(byEndpoint))
+	for endpoint, latencies := range byEndpoint {
+		report.EndpointLatency[endpoint] = summarise(latencies)
+	}
+
+	return report, nil
+}
+
+func (r *Runner) replayOne(ctx context.Context, opts Options, entry querylog.QueryLog) result {
+	res := result{endpoint: entry.Endpoint}
+
+	reqCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, opts.TargetURL+entry.Endpoint, bytes.NewBufferString(entry.Query))
+	if err != nil {
+		res.err = err
+		return res
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", opts.APIKey)
+
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer resp.Body.Close()
+
+	// Drain the body so latency covers the full response.
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	res.latencyMs = time.Since(start).Milliseconds()
+	res.status = resp.StatusCode
+	return res
+}
+
+// DefaultTargetURL resolves the replay target from REPLAY_TARGET_URL, falling back to the local server.
+func DefaultTargetURL() string {
+	if target := os.Getenv("REPLAY_TARGET_URL"); target != "" {
+		return target
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return "http://localhost:" + port
+}
+
+func normaliseOptions(opts Options) (Options, error) {
+	opts.TargetURL = strings.TrimRight(strings.TrimSpace(opts.TargetURL), "/")
+	if opts.TargetURL == "" {
+		return opts, errors.New("target_url is required")
+	}
+	if opts.APIKey == "" {
+		return opts, errors.New("api_key is required")
+	}
+	if opts.Endpoint != "" && !slices.Contains(querylog.ReplayableEndpoints, opts.Endpoint) {
+		return opts, fmt.Errorf("endpoint %s cannot be replayed; use one of %s", opts.Endpoint, strings.Join(querylog.ReplayableEndpoints, ", "))
+	}
+
+	if opts.SampleSize <= 0 {
+		opts.SampleSize = defaultSampleSize
+	}
+	if opts.SampleSize > maxSampleSize {
+		opts.SampleSize = maxSampleSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.Concurrency > maxConcurrency {
+		opts.Concurrency = maxConcurrency
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	return opts, nil
+}
+
+func summarise(latencies []int64) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := append([]int64(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum int64
+	for _, v := range sorted {
+		sum += v
+	}
+
+	return LatencyStats{
+		Min:  sorted[0],
+		Max:  sorted[len(sorted)-1],
+		Mean: float64(sum) / float64(len(sorted)),
+		P50:  percentile(sorted, 50),
+		P90:  percentile(sorted, 90),
+		P99:  percentile(sorted, 99),
+	}
+}
+
+// percentile returns the nearest-rank percentile of an ascending slice.
+func percentile(sorted []int64, p int) int64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
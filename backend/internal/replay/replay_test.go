@@ -0,0 +1,58 @@
+package replay_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/replay"
+	"github.com/Quantum3-Labs/stacks-builder/backend/testutil"
+)
+
+func TestRunReplaysOnlyCompletePayloads(t *testing.T) {
+	db := testutil.NewSQLite(t)
+	userID := testutil.CreateUser(t, db, "")
+	logged := func(endpoint, query string) {
+		testutil.CreateQueryLog(t, db, userID, func(log *querylog.QueryLog) {
+			log.Endpoint = endpoint
+			log.Query = query
+		})
+	}
+	logged("/api/v1/rag/generate", `{"query":"write a counter"}`)
+	logged("/api/v1/rag/generate", `{"query":"write a tok`)
+	logged("/api/v1/rag/generate", `{"query":"write a token","api_key":"[REDACTED]"}`)
+	logged("/api/v1/rag/generate", `{"query":"write a long…[truncated]"}`)
+	logged("/v1/chat/completions", `{"conversation_id":4,"messages":[{"role":"user","content":"make it pausable"}]}`)
+	logged("/api/v1/rag/templates/:name/instantiate", `{"customization":"rename it"}`)
+
+	var mu sync.Mutex
+	var received []string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, r.URL.Path+" "+string(body))
+		mu.Unlock()
+	}))
+	defer target.Close()
+
+	runner := replay.NewRunner(querylog.NewRepository(db))
+	report, err := runner.Run(context.Background(), replay.Options{TargetURL: target.URL, APIKey: "sk-replay"})
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if report.Total != 1 || report.SuccessCount != 1 {
+		t.Fatalf("report = %+v, want one successful request", report)
+	}
+	if len(received) != 1 || received[0] != `/api/v1/rag/generate {"query":"write a counter"}` {
+		t.Fatalf("target received %q, want only the complete generate payload", received)
+	}
+
+	_, err = runner.Run(context.Background(), replay.Options{TargetURL: target.URL, APIKey: "sk-replay", Endpoint: "/api/v1/rag/templates/:name/instantiate"})
+	if err == nil {
+		t.Fatal("replaying a route pattern was accepted")
+	}
+}
@@ -0,0 +1,133 @@
+// Package requestlimit bounds the size of API requests before they reach retrieval or an
+// LLM: the raw body, the number and length of chat messages, and n_results.
+package requestlimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"unicode/utf8"
+)
+
+const (
+	defaultMaxBodyBytes    = 2 << 20
+	defaultMaxMessages     = 500
+	defaultMaxMessageChars = 100000
+	// maxNResults is the most results the retrieval backends accept.
+	maxNResults = 20
+)
+
+// Config holds the limits. Zero disables a limit.
+type Config struct {
+	// MaxBodyBytes caps the request body.
+	MaxBodyBytes int64
+	// MaxMessages caps the messages of a chat request.
+	MaxMessages int
+	// MaxMessageChars caps the characters of a single message's content.
+	MaxMessageChars int
+	// MaxNResults caps n_results on retrieval and generation requests.
+	MaxNResults int
+}
+
+// ConfigFromEnv reads REQUEST_MAX_BODY_BYTES, REQUEST_MAX_MESSAGES, REQUEST_MAX_MESSAGE_CHARS
+// and REQUEST_MAX_N_RESULTS. Invalid values are ignored, and n_results is never allowed above
+// what retrieval accepts.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		MaxBodyBytes:    defaultMaxBodyBytes,
+		MaxMessages:     defaultMaxMessages,
+		MaxMessageChars: defaultMaxMessageChars,
+		MaxNResults:     maxNResults,
+	}
+	if n, err := strconv.ParseInt(os.Getenv("REQUEST_MAX_BODY_BYTES"), 10, 64); err == nil && n >= 0 {
+		cfg.MaxBodyBytes = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("REQUEST_MAX_MESSAGES")); err == nil && n >= 0 {
+		cfg.MaxMessages = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("REQUEST_MAX_MESSAGE_CHARS")); err == nil && n >= 0 {
+		cfg.MaxMessageChars = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("REQUEST_MAX_N_RESULTS")); err == nil && n > 0 {
+		cfg.MaxNResults = min(n, maxNResults)
+	}
+	return cfg
+}
+
+// FieldError describes one field that breaks a limit.
+type FieldError struct {
+	// Field is the JSON path of the field, e.g. "messages[3].content".
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// limitedFields are the top-level request fields the limits apply to.
+type limitedFields struct {
+	Messages []json.RawMessage `json:"messages"`
+	NResults *json.Number      `json:"n_results"`
+}
+
+// Check returns the fields of a JSON request body that break the message and n_results
+// limits. Bodies that are not JSON objects pass; handlers report malformed requests.
+func (cfg Config) Check(body []byte) []FieldError {
+	var fields limitedFields
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil
+	}
+
+	var errs []FieldError
+	if cfg.MaxMessages > 0 && len(fields.Messages) > cfg.MaxMessages {
+		errs = append(errs, FieldError{
+			Field:   "messages",
+			Message: fmt.Sprintf("at most %d messages are allowed, got %d", cfg.MaxMessages, len(fields.Messages)),
+		})
+	}
+	if cfg.MaxMessageChars > 0 {
+		for i, raw := range fields.Messages {
+			if chars := contentChars(raw); chars > cfg.MaxMessageChars {
+				errs = append(errs, FieldError{
+					Field:   fmt.Sprintf("messages[%d].content", i),
+					Message: fmt.Sprintf("content must be at most %d characters, got %d", cfg.MaxMessageChars, chars),
+				})
+			}
+		}
+	}
+	if cfg.MaxNResults > 0 && fields.NResults != nil {
+		// Zero picks the default; fractions and negatives are left to the handlers.
+		if n, err := fields.NResults.Int64(); err == nil && n > int64(cfg.MaxNResults) {
+			errs = append(errs, FieldError{
+				Field:   "n_results",
+				Message: fmt.Sprintf("n_results must be at most %d", cfg.MaxNResults),
+			})
+		}
+	}
+	return errs
+}
+
+// contentChars counts the characters of a message's content, which is a string or an array
+// of text parts.
+func contentChars(raw json.RawMessage) int {
+	var message struct {
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &message); err != nil || len(message.Content) == 0 {
+		return 0
+	}
+
+	var text string
+	if err := json.Unmarshal(message.Content, &text); err == nil {
+		return utf8.RuneCountInString(text)
+	}
+	var parts []struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(message.Content, &parts); err != nil {
+		return 0
+	}
+	chars := 0
+	for _, part := range parts {
+		chars += utf8.RuneCountInString(part.Text)
+	}
+	return chars
+}
@@ -0,0 +1,85 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+)
+
+// ErrInvalidSettings is returned for settings with an unknown provider or model, a
+// temperature or max_tokens out of range, or an unusable response language.
+var ErrInvalidSettings = errors.New("invalid settings")
+
+const maxTemperature = 2
+
+// Settings are a user's defaults for generation requests. Zero values are unset: requests
+// then fall back to the server defaults, as if the user had no settings.
+type Settings struct {
+	// Provider selects that provider's configured model when Model is unset.
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	// Temperature and MaxTokens are used by requests that leave them at zero.
+	Temperature float64 `json:"temperature,omitempty"`
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+	// ResponseLanguage is the language explanations and code comments are written in, e.g.
+	// "Spanish" or "zh-CN", for requests that do not set language.
+	ResponseLanguage string     `json:"response_language,omitempty"`
+	UpdatedAt        *time.Time `json:"updated_at,omitempty"`
+}
+
+// Normalize trims the settings and lowercases the provider.
+func (s *Settings) Normalize() {
+	s.Provider = strings.ToLower(strings.TrimSpace(s.Provider))
+	s.Model = strings.TrimSpace(s.Model)
+	s.ResponseLanguage = strings.Join(strings.Fields(s.ResponseLanguage), " ")
+}
+
+// Validate checks that the provider and model can serve requests, that the model is served
+// by the provider when both are set, and that the temperature, max_tokens and response
+// language are usable.
+func (s Settings) Validate() error {
+	if s.Provider != "" && !knownProvider(s.Provider) {
+		return fmt.Errorf("%w: unknown provider %q", ErrInvalidSettings, s.Provider)
+	}
+	selection, err := s.Selection()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	if s.Provider != "" && selection.Provider != s.Provider {
+		return fmt.Errorf("%w: model %s is served by %s, not %s", ErrInvalidSettings, selection.Model, selection.Provider, s.Provider)
+	}
+
+	if s.Temperature < 0 || s.Temperature > maxTemperature {
+		return fmt.Errorf("%w: temperature must be between 0 and %d", ErrInvalidSettings, maxTemperature)
+	}
+	if err := codegen.ValidateModelMaxTokens(selection.Model, s.MaxTokens); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+
+	if _, err := codegen.NormalizeResponseLanguage(s.ResponseLanguage); err != nil {
+		return fmt.Errorf("%w: response_language: %v", ErrInvalidSettings, err)
+	}
+	return nil
+}
+
+// Selection resolves the model the settings ask for: Model when set, otherwise Provider's
+// active model, otherwise the server default. It fails when the model is not on the
+// allowlist, which may happen after the allowlist changes.
+func (s Settings) Selection() (codegen.ModelSelection, error) {
+	if s.Model != "" {
+		return codegen.SelectModel(s.Model)
+	}
+	return codegen.SelectModel(s.Provider)
+}
+
+func knownProvider(provider string) bool {
+	switch provider {
+	case codegen.ProviderGemini, codegen.ProviderOpenAI, codegen.ProviderClaude, codegen.ProviderLocal:
+		return true
+	default:
+		return false
+	}
+}
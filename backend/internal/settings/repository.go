@@ -0,0 +1,69 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+)
+
+// Repository persists user settings. Writes go through the database's shared writer.
+type Repository struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+// NewRepository returns a repository backed by the supplied sql.DB handle.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db, writer: database.WriterFor(db)}
+}
+
+// Get returns the user's settings, which are empty when the user never saved any.
+func (r *Repository) Get(ctx context.Context, userID int) (Settings, error) {
+	var (
+		s         Settings
+		updatedAt time.Time
+	)
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(provider, ''), COALESCE(model, ''), COALESCE(temperature, 0),
+			COALESCE(max_tokens, 0), COALESCE(response_language, ''), updated_at
+		FROM user_settings WHERE user_id = ?
+	`, userID).Scan(&s.Provider, &s.Model, &s.Temperature, &s.MaxTokens, &s.ResponseLanguage, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Settings{}, nil
+	}
+	if err != nil {
+		return Settings{}, fmt.Errorf("get settings: %w", err)
+	}
+	s.UpdatedAt = &updatedAt
+	return s, nil
+}
+
+// Put normalizes, validates and stores the user's settings, replacing all earlier values.
+func (r *Repository) Put(ctx context.Context, userID int, s *Settings) error {
+	s.Normalize()
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	_, err := r.writer.Exec(ctx, `
+		INSERT INTO user_settings (user_id, provider, model, temperature, max_tokens, response_language, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			provider = excluded.provider,
+			model = excluded.model,
+			temperature = excluded.temperature,
+			max_tokens = excluded.max_tokens,
+			response_language = excluded.response_language,
+			updated_at = excluded.updated_at
+	`, userID, s.Provider, s.Model, s.Temperature, s.MaxTokens, s.ResponseLanguage, now)
+	if err != nil {
+		return fmt.Errorf("save settings: %w", err)
+	}
+	s.UpdatedAt = &now
+	return nil
+}
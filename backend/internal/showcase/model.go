@@ -0,0 +1,51 @@
+package showcase
+
+import "time"
+
+// Moderation states for showcase entries.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// Entry is a generation a user has submitted to the public showcase.
+type Entry struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Title       string     `json:"title"`
+	Prompt      string     `json:"prompt"`
+	Code        string     `json:"code"`
+	Explanation string     `json:"explanation,omitempty"`
+	Status      string     `json:"status"`
+	ReviewNote  string     `json:"review_note,omitempty"`
+	ReviewedBy  *int64     `json:"reviewed_by,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// PublicEntry is the anonymised view of an approved entry served without authentication.
+type PublicEntry struct {
+	ID          int64     `json:"id"`
+	Title       string    `json:"title"`
+	Prompt      string    `json:"prompt"`
+	Code        string    `json:"code"`
+	Explanation string    `json:"explanation,omitempty"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Public returns the anonymised view of the entry.
+func (e Entry) Public() PublicEntry {
+	published := e.CreatedAt
+	if e.ReviewedAt != nil {
+		published = *e.ReviewedAt
+	}
+	return PublicEntry{
+		ID:          e.ID,
+		Title:       e.Title,
+		Prompt:      e.Prompt,
+		Code:        e.Code,
+		Explanation: e.Explanation,
+		PublishedAt: published,
+	}
+}
@@ -0,0 +1,196 @@
+package showcase
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned when a showcase entry cannot be located.
+var ErrNotFound = errors.New("showcase entry not found")
+
+// Repository persists showcase entries.
+type Repository struct {
+	db *sql.DB
+}
+
+// NewRepository returns a repository backed by the supplied sql.DB handle.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db}
+}
+
+const selectColumns = `
+	id, user_id, title, prompt, code, COALESCE(explanation, ''), status,
+	COALESCE(review_note, ''), reviewed_by, reviewed_at, created_at
+`
+
+// Submit scrubs personal data from the entry and stores it in the moderation queue.
+func (r *Repository) Submit(ctx context.Context, entry *Entry) error {
+	entry.Title = Scrub(entry.Title)
+	entry.Prompt = Scrub(entry.Prompt)
+	entry.Code = Scrub(entry.Code)
+	entry.Explanation = Scrub(entry.Explanation)
+	entry.Status = StatusPending
+	entry.CreatedAt = time.Now().UTC()
+
+	res, err := r.db.ExecContext(ctx, `
+		INSERT INTO showcase_entries (user_id, title, prompt, code, explanation, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, entry.UserID, entry.Title, entry.Prompt, entry.Code, entry.Explanation, entry.Status, entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert showcase entry: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("fetch showcase entry id: %w", err)
+	}
+	entry.ID = id
+	return nil
+}
+
+// Get returns an entry by ID regardless of status.
+func (r *Repository) Get(ctx context.Context, id int64) (*Entry, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+selectColumns+` FROM showcase_entries WHERE id = ?`, id)
+	entry, err := scanEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return entry, err
+}
+
+// List returns entries with the given status, newest first, and the total count.
+// An empty status lists every entry.
+func (r *Repository) List(ctx context.Context, status string, page, limit int) ([]Entry, int64, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if page <= 0 {
+		page = 1
+	}
+	offset := (page - 1) * limit
+
+	whereClause := ""
+	args := make([]any, 0, 3)
+	if status != "" {
+		whereClause = "WHERE status = ?"
+		args = append(args, status)
+	}
+
+	var total int64
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM showcase_entries `+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count showcase entries: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+selectColumns+`
+		FROM showcase_entries
+		`+whereClause+`
+		ORDER BY COALESCE(reviewed_at, created_at) DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("list showcase entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]Entry, 0)
+	for rows.Next() {
+		entry, err := scanEntry(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, *entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("iterate showcase entries: %w", err)
+	}
+
+	return entries, total, nil
+}
+
+// Review records a moderation decision for a pending or previously reviewed entry.
+func (r *Repository) Review(ctx context.Context, id int64, status string, reviewerID int64, note string) error {
+	if status != StatusApproved && status != StatusRejected {
+		return fmt.Errorf("invalid review status %q", status)
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE showcase_entries
+		SET status = ?, review_note = ?, reviewed_by = ?, reviewed_at = ?
+		WHERE id = ?
+	`, status, note, reviewerID, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("review showcase entry: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes an entry owned by the user, e.g. when they withdraw consent.
+func (r *Repository) Delete(ctx context.Context, id, userID int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM showcase_entries WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("delete showcase entry: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanEntry(row rowScanner) (*Entry, error) {
+	var (
+		entry      Entry
+		reviewedBy sql.NullInt64
+		reviewedAt sql.NullTime
+	)
+	err := row.Scan(
+		&entry.ID,
+		&entry.UserID,
+		&entry.Title,
+		&entry.Prompt,
+		&entry.Code,
+		&entry.Explanation,
+		&entry.Status,
+		&entry.ReviewNote,
+		&reviewedBy,
+		&reviewedAt,
+		&entry.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan showcase entry: %w", err)
+	}
+
+	if reviewedBy.Valid {
+		entry.ReviewedBy = &reviewedBy.Int64
+	}
+	if reviewedAt.Valid {
+		entry.ReviewedAt = &reviewedAt.Time
+	}
+	return &entry, nil
+}
@@ -0,0 +1,21 @@
+package showcase
+
+import "regexp"
+
+// placeholderPrincipal replaces real addresses so published code still parses.
+const placeholderPrincipal = "ST000000000000000000002AMW42H"
+
+var (
+	emailPattern  = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	apiKeyPattern = regexp.MustCompile(`\bmk_[A-Za-z0-9]{8,}\b`)
+	// Standard and contract principals (SP/ST/SM/SN mainnet and testnet addresses).
+	principalPattern = regexp.MustCompile(`\bS[PMTN][0-9A-Z]{28,40}\b`)
+)
+
+// Scrub removes personal data such as e-mail addresses, API keys, and Stacks principals from text.
+func Scrub(text string) string {
+	text = emailPattern.ReplaceAllString(text, "[email]")
+	text = apiKeyPattern.ReplaceAllString(text, "[api-key]")
+	text = principalPattern.ReplaceAllString(text, placeholderPrincipal)
+	return text
+}
@@ -0,0 +1,83 @@
+package spend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/mail"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/webhook"
+)
+
+// Notifier delivers budget alerts.
+type Notifier interface {
+	NotifyBudgetAlert(ctx context.Context, alert Alert) error
+}
+
+// Notifiers delivers each alert to every notifier in turn.
+type Notifiers []Notifier
+
+// NotifyBudgetAlert calls every notifier and joins their errors.
+func (n Notifiers) NotifyBudgetAlert(ctx context.Context, alert Alert) error {
+	var errs []error
+	for _, notifier := range n {
+		if err := notifier.NotifyBudgetAlert(ctx, alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LogNotifier writes budget alerts to the server log.
+type LogNotifier struct{}
+
+// NotifyBudgetAlert logs the alert.
+func (LogNotifier) NotifyBudgetAlert(_ context.Context, alert Alert) error {
+	log.Printf("spend: %s", alert.Summary())
+	return nil
+}
+
+// WebhookNotifier publishes budget alerts as budget.alert webhook events.
+type WebhookNotifier struct {
+	Events webhook.Publisher
+}
+
+// NotifyBudgetAlert queues the alert for delivery to subscribed webhooks.
+func (n WebhookNotifier) NotifyBudgetAlert(_ context.Context, alert Alert) error {
+	n.Events.Publish(webhook.EventBudgetAlert, alert)
+	return nil
+}
+
+// EmailNotifier mails budget alerts to a fixed list of recipients.
+type EmailNotifier struct {
+	Sender *mail.Sender
+	To     []string
+}
+
+// NotifyBudgetAlert sends the alert by email.
+func (n EmailNotifier) NotifyBudgetAlert(ctx context.Context, alert Alert) error {
+	subject := "[Stacks Builder] " + alert.Summary()
+	body := fmt.Sprintf(
+		"Estimated LLM spend has reached %.0f%% of the %s budget.\n\n"+
+			"Budget:       $%.2f\nSpent:        $%.2f\nPeriod start: %s\n\n"+
+			"See GET /api/v1/admin/spend for a breakdown by day, provider and model.\n",
+		alert.Threshold*100, alert.scope(), alert.BudgetUSD, alert.SpentUSD, alert.PeriodStart.Format("2006-01-02"))
+	if err := n.Sender.Send(ctx, n.To, subject, body); err != nil {
+		return fmt.Errorf("email budget alert: %w", err)
+	}
+	return nil
+}
+
+// Summary describes the alert in one line, e.g.
+// "daily openai budget 80% used ($8.12 of $10.00)".
+func (a Alert) Summary() string {
+	return fmt.Sprintf("%s budget %.0f%% used ($%.2f of $%.2f)", a.scope(), a.Threshold*100, a.SpentUSD, a.BudgetUSD)
+}
+
+func (a Alert) scope() string {
+	if a.Provider == "" {
+		return a.Period
+	}
+	return a.Period + " " + a.Provider
+}
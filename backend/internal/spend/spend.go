@@ -0,0 +1,446 @@
+// Package spend reports estimated LLM spend from query logs and alerts admins when daily or
+// monthly budgets are approached or exceeded.
+package spend
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/usage"
+)
+
+// Budget periods.
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+const defaultCheckInterval = 5 * time.Minute
+
+// defaultThresholds alert at 80% of a budget and again when it is used up.
+var defaultThresholds = []float64{0.8, 1}
+
+// Budget is a spending limit in USD per day and per calendar month. Zero means no limit.
+type Budget struct {
+	DailyUSD   float64 `json:"daily_usd"`
+	MonthlyUSD float64 `json:"monthly_usd"`
+}
+
+// Config controls budgets and how often spend is checked against them.
+type Config struct {
+	// Total limits the spend of all providers together.
+	Total Budget
+	// Providers limits the spend of individual providers, keyed by provider name.
+	Providers map[string]Budget
+	// Thresholds are the fractions of a budget that raise an alert, in ascending order.
+	Thresholds []float64
+	// Interval is how often budgets are checked.
+	Interval time.Duration
+	// AlertEmails receive budget alerts when SMTP is configured.
+	AlertEmails []string
+}
+
+// Enabled reports whether any budget is configured.
+func (c Config) Enabled() bool {
+	if c.Total.DailyUSD > 0 || c.Total.MonthlyUSD > 0 {
+		return true
+	}
+	for _, b := range c.Providers {
+		if b.DailyUSD > 0 || b.MonthlyUSD > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigFromEnv reads SPEND_DAILY_BUDGET_USD, SPEND_MONTHLY_BUDGET_USD,
+// SPEND_PROVIDER_BUDGETS ("<provider>=<daily>/<monthly>", comma-separated),
+// SPEND_ALERT_THRESHOLDS (comma-separated percentages), SPEND_CHECK_INTERVAL and
+// SPEND_ALERT_EMAILS. Invalid entries are logged and skipped.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Providers:  make(map[string]Budget),
+		Thresholds: defaultThresholds,
+		Interval:   defaultCheckInterval,
+	}
+	cfg.Total.DailyUSD = parseUSD("SPEND_DAILY_BUDGET_USD", os.Getenv("SPEND_DAILY_BUDGET_USD"))
+	cfg.Total.MonthlyUSD = parseUSD("SPEND_MONTHLY_BUDGET_USD", os.Getenv("SPEND_MONTHLY_BUDGET_USD"))
+
+	for _, entry := range splitList(os.Getenv("SPEND_PROVIDER_BUDGETS")) {
+		provider, value, ok := strings.Cut(entry, "=")
+		daily, monthly, _ := strings.Cut(value, "/")
+		provider = strings.ToLower(strings.TrimSpace(provider))
+		if !ok || provider == "" {
+			log.Printf("spend: ignoring SPEND_PROVIDER_BUDGETS entry %q; expected <provider>=<daily>/<monthly>", entry)
+			continue
+		}
+		cfg.Providers[provider] = Budget{
+			DailyUSD:   parseUSD("SPEND_PROVIDER_BUDGETS", daily),
+			MonthlyUSD: parseUSD("SPEND_PROVIDER_BUDGETS", monthly),
+		}
+	}
+
+	if entries := splitList(os.Getenv("SPEND_ALERT_THRESHOLDS")); len(entries) > 0 {
+		thresholds := make([]float64, 0, len(entries))
+		for _, entry := range entries {
+			pct, err := strconv.ParseFloat(strings.TrimSuffix(entry, "%"), 64)
+			if err != nil || pct <= 0 {
+				log.Printf("spend: ignoring SPEND_ALERT_THRESHOLDS entry %q", entry)
+				continue
+			}
+			thresholds = append(thresholds, pct/100)
+		}
+		if len(thresholds) > 0 {
+			sort.Float64s(thresholds)
+			cfg.Thresholds = thresholds
+		}
+	}
+
+	if d, err := time.ParseDuration(os.Getenv("SPEND_CHECK_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	cfg.AlertEmails = splitList(os.Getenv("SPEND_ALERT_EMAILS"))
+	return cfg
+}
+
+func splitList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func parseUSD(name, value string) float64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	usd, err := strconv.ParseFloat(value, 64)
+	if err != nil || usd < 0 {
+		log.Printf("spend: ignoring invalid %s value %q", name, value)
+		return 0
+	}
+	return usd
+}
+
+// DailySpend is the spend of one model on one UTC day.
+type DailySpend struct {
+	Date         string  `json:"date"`
+	Provider     string  `json:"provider"`
+	Model        string  `json:"model"`
+	Requests     int64   `json:"requests"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+// BudgetStatus compares the spend of the current day or month against its budget.
+type BudgetStatus struct {
+	Period string `json:"period"`
+	// Provider is empty for the budget covering all providers.
+	Provider    string    `json:"provider,omitempty"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	BudgetUSD   float64   `json:"budget_usd"`
+	SpentUSD    float64   `json:"spent_usd"`
+	// UsedFraction is SpentUSD divided by BudgetUSD.
+	UsedFraction float64 `json:"used_fraction"`
+	Exceeded     bool    `json:"exceeded"`
+}
+
+// Report summarizes spend over a date range and the current budget status.
+type Report struct {
+	StartDate    time.Time          `json:"start_date"`
+	EndDate      time.Time          `json:"end_date"`
+	TotalCostUSD float64            `json:"total_cost_usd"`
+	ByProvider   map[string]float64 `json:"cost_by_provider"`
+	Daily        []DailySpend       `json:"daily"`
+	Budgets      []BudgetStatus     `json:"budgets"`
+}
+
+// Alert records that spend crossed a threshold of a budget. Each threshold alerts at most
+// once per budget period.
+type Alert struct {
+	ID          int64     `json:"id"`
+	Period      string    `json:"period"`
+	Provider    string    `json:"provider,omitempty"`
+	PeriodStart time.Time `json:"period_start"`
+	Threshold   float64   `json:"threshold"`
+	BudgetUSD   float64   `json:"budget_usd"`
+	SpentUSD    float64   `json:"spent_usd"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Service aggregates spend and raises budget alerts.
+type Service struct {
+	db       *sql.DB
+	cfg      Config
+	notifier Notifier
+}
+
+// NewService returns a spend service. A nil notifier falls back to LogNotifier.
+func NewService(db *sql.DB, cfg Config, notifier Notifier) *Service {
+	if notifier == nil {
+		notifier = LogNotifier{}
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultCheckInterval
+	}
+	if len(cfg.Thresholds) == 0 {
+		cfg.Thresholds = defaultThresholds
+	}
+	return &Service{db: db, cfg: cfg, notifier: notifier}
+}
+
+// Config returns the service's budgets.
+func (s *Service) Config() Config {
+	return s.cfg
+}
+
+// Start checks budgets in the background until the context is cancelled. It does nothing
+// when no budget is configured.
+func (s *Service) Start(ctx context.Context) {
+	if !s.cfg.Enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(s.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			if alerts, err := s.Check(ctx, time.Now()); err != nil {
+				log.Printf("spend: budget check failed: %v", err)
+			} else if len(alerts) > 0 {
+				log.Printf("spend: raised %d budget alerts", len(alerts))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// DayPeriod returns the UTC day containing now.
+func DayPeriod(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// Report aggregates spend per day, provider and model for query logs created in
+// [start, end) and adds the budget status at now. A non-empty provider narrows the report.
+// Requests served with users' own provider keys cost the server nothing and are left out.
+func (s *Service) Report(ctx context.Context, start, end time.Time, provider string, now time.Time) (*Report, error) {
+	where := "created_at >= ? AND created_at < ? AND user_key = 0"
+	args := []any{start, end}
+	if provider != "" {
+		where += " AND model_provider = ?"
+		args = append(args, provider)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT strftime('%Y-%m-%d', created_at) AS day, COALESCE(model_provider, ''), COALESCE(model, ''),
+			COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0), COALESCE(SUM(cost_usd), 0)
+		FROM query_logs
+		WHERE `+where+`
+		GROUP BY day, model_provider, model
+		ORDER BY day, model_provider, model
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate spend: %w", err)
+	}
+	defer rows.Close()
+
+	report := &Report{
+		StartDate:  start,
+		EndDate:    end,
+		ByProvider: make(map[string]float64),
+		Daily:      make([]DailySpend, 0),
+	}
+	for rows.Next() {
+		var day DailySpend
+		if err := rows.Scan(&day.Date, &day.Provider, &day.Model, &day.Requests, &day.InputTokens, &day.OutputTokens, &day.CostUSD); err != nil {
+			return nil, fmt.Errorf("scan spend: %w", err)
+		}
+		report.Daily = append(report.Daily, day)
+		report.ByProvider[day.Provider] += day.CostUSD
+		report.TotalCostUSD += day.CostUSD
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate spend: %w", err)
+	}
+
+	if report.Budgets, err = s.Status(ctx, now); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Status compares the spend of the day and month containing now against every configured
+// budget: the total budget first, then providers by name.
+func (s *Service) Status(ctx context.Context, now time.Time) ([]BudgetStatus, error) {
+	providers := make([]string, 0, len(s.cfg.Providers))
+	for provider := range s.cfg.Providers {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	statuses := make([]BudgetStatus, 0)
+	for _, period := range []string{PeriodDaily, PeriodMonthly} {
+		start, end := DayPeriod(now)
+		if period == PeriodMonthly {
+			start, end = usage.Period(now)
+		}
+
+		for _, provider := range append([]string{""}, providers...) {
+			budget := s.cfg.Total
+			if provider != "" {
+				budget = s.cfg.Providers[provider]
+			}
+			limit := budget.usd(period)
+			if limit <= 0 {
+				continue
+			}
+			spent, err := s.spent(ctx, provider, start, end)
+			if err != nil {
+				return nil, err
+			}
+			statuses = append(statuses, BudgetStatus{
+				Period:       period,
+				Provider:     provider,
+				PeriodStart:  start,
+				PeriodEnd:    end,
+				BudgetUSD:    limit,
+				SpentUSD:     spent,
+				UsedFraction: spent / limit,
+				Exceeded:     spent >= limit,
+			})
+		}
+	}
+	return statuses, nil
+}
+
+func (b Budget) usd(period string) float64 {
+	if period == PeriodMonthly {
+		return b.MonthlyUSD
+	}
+	return b.DailyUSD
+}
+
+// spent sums the cost of query logs in [start, end), for one provider or all of them, leaving
+// out requests served with users' own provider keys.
+func (s *Service) spent(ctx context.Context, provider string, start, end time.Time) (float64, error) {
+	query := `SELECT COALESCE(SUM(cost_usd), 0) FROM query_logs WHERE created_at >= ? AND created_at < ? AND user_key = 0`
+	args := []any{start, end}
+	if provider != "" {
+		query += ` AND model_provider = ?`
+		args = append(args, provider)
+	}
+	var spent float64
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&spent); err != nil {
+		return 0, fmt.Errorf("sum spend: %w", err)
+	}
+	return spent, nil
+}
+
+// Check records an alert for every threshold the current spend has crossed for the first
+// time this period, and notifies about the highest of them per budget. It returns the new
+// alerts.
+func (s *Service) Check(ctx context.Context, now time.Time) ([]Alert, error) {
+	statuses, err := s.Status(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var raised []Alert
+	for _, status := range statuses {
+		var highest *Alert
+		for _, threshold := range s.cfg.Thresholds {
+			if status.UsedFraction < threshold {
+				break
+			}
+			alert, created, err := s.record(ctx, status, threshold, now)
+			if err != nil {
+				return raised, err
+			}
+			if created {
+				raised = append(raised, *alert)
+				highest = alert
+			}
+		}
+		if highest == nil {
+			continue
+		}
+		if err := s.notifier.NotifyBudgetAlert(ctx, *highest); err != nil {
+			log.Printf("spend: failed to deliver %s budget alert: %v", highest.Period, err)
+		}
+	}
+	return raised, nil
+}
+
+// record stores an alert unless one already exists for the threshold in this period.
+func (s *Service) record(ctx context.Context, status BudgetStatus, threshold float64, now time.Time) (*Alert, bool, error) {
+	alert := &Alert{
+		Period:      status.Period,
+		Provider:    status.Provider,
+		PeriodStart: status.PeriodStart,
+		Threshold:   threshold,
+		BudgetUSD:   status.BudgetUSD,
+		SpentUSD:    status.SpentUSD,
+		CreatedAt:   now.UTC(),
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO spend_alerts (period, provider, period_start, threshold, budget_usd, spent_usd, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, alert.Period, alert.Provider, alert.PeriodStart, alert.Threshold, alert.BudgetUSD, alert.SpentUSD, alert.CreatedAt)
+	if err != nil {
+		return nil, false, fmt.Errorf("record budget alert: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return nil, false, err
+	}
+	if alert.ID, err = result.LastInsertId(); err != nil {
+		return nil, false, err
+	}
+	return alert, true, nil
+}
+
+// Alerts returns the most recent budget alerts, newest first.
+func (s *Service) Alerts(ctx context.Context, limit int) ([]Alert, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, period, provider, period_start, threshold, budget_usd, spent_usd, created_at
+		FROM spend_alerts
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list budget alerts: %w", err)
+	}
+	defer rows.Close()
+
+	alerts := make([]Alert, 0)
+	for rows.Next() {
+		var alert Alert
+		if err := rows.Scan(&alert.ID, &alert.Period, &alert.Provider, &alert.PeriodStart, &alert.Threshold, &alert.BudgetUSD, &alert.SpentUSD, &alert.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan budget alert: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
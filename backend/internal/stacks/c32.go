@@ -0,0 +1,112 @@
+package stacks
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// c32Alphabet is Crockford's base32 alphabet used by Stacks addresses.
+const c32Alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Address versions of standard principals.
+const (
+	VersionMainnetSingleSig = 22 // SP
+	VersionMainnetMultiSig  = 20 // SM
+	VersionTestnetSingleSig = 26 // ST
+	VersionTestnetMultiSig  = 21 // SN
+)
+
+var errInvalidAddress = errors.New("invalid Stacks address")
+
+// DecodeAddress parses a c32check address such as "SP2J6ZY48GV1EZ5V2V5RB9MP66SW86PYKKNRV9EJ7"
+// into its version and 20-byte hash160, verifying the checksum.
+func DecodeAddress(address string) (byte, [20]byte, error) {
+	var hash [20]byte
+	address = strings.ToUpper(strings.TrimSpace(address))
+	if len(address) < 3 || address[0] != 'S' {
+		return 0, hash, fmt.Errorf("%w %q: must start with S", errInvalidAddress, address)
+	}
+
+	version := strings.IndexByte(c32Alphabet, address[1])
+	if version < 0 {
+		return 0, hash, fmt.Errorf("%w %q: bad version character", errInvalidAddress, address)
+	}
+	data, err := c32Decode(address[2:])
+	if err != nil || len(data) != 24 {
+		return 0, hash, fmt.Errorf("%w %q", errInvalidAddress, address)
+	}
+
+	payload, checksum := data[:20], data[20:]
+	if !bytes.Equal(checksum, c32Checksum(byte(version), payload)) {
+		return 0, hash, fmt.Errorf("%w %q: checksum mismatch", errInvalidAddress, address)
+	}
+	copy(hash[:], payload)
+	return byte(version), hash, nil
+}
+
+// EncodeAddress renders a version and hash160 as a c32check address.
+func EncodeAddress(version byte, hash [20]byte) string {
+	data := append(hash[:], c32Checksum(version, hash[:])...)
+	return "S" + string(c32Alphabet[version&31]) + c32Encode(data)
+}
+
+// IsMainnet reports whether an address version belongs to mainnet.
+func IsMainnet(version byte) bool {
+	return version == VersionMainnetSingleSig || version == VersionMainnetMultiSig
+}
+
+func c32Checksum(version byte, payload []byte) []byte {
+	first := sha256.Sum256(append([]byte{version}, payload...))
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+// c32Encode encodes data as a base32 number, with one leading '0' per leading zero byte.
+func c32Encode(data []byte) string {
+	zeros := 0
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+
+	n := new(big.Int).SetBytes(data)
+	base := big.NewInt(32)
+	mod := new(big.Int)
+	var digits []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		digits = append(digits, c32Alphabet[mod.Int64()])
+	}
+	for i := 0; i < zeros; i++ {
+		digits = append(digits, '0')
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits)
+}
+
+// c32Decode reverses c32Encode. O, L and I are read as 0, 1 and 1.
+func c32Decode(s string) ([]byte, error) {
+	s = strings.NewReplacer("O", "0", "L", "1", "I", "1").Replace(strings.ToUpper(s))
+
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '0' {
+		zeros++
+	}
+
+	n := new(big.Int)
+	base := big.NewInt(32)
+	for i := zeros; i < len(s); i++ {
+		digit := strings.IndexByte(c32Alphabet, s[i])
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid c32 character %q", s[i])
+		}
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
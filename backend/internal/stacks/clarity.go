@@ -0,0 +1,351 @@
+package stacks
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Type prefixes of serialized Clarity values (SIP-005).
+const (
+	typeInt               byte = 0x00
+	typeUInt              byte = 0x01
+	typeBuffer            byte = 0x02
+	typeTrue              byte = 0x03
+	typeFalse             byte = 0x04
+	typeStandardPrincipal byte = 0x05
+	typeContractPrincipal byte = 0x06
+	typeResponseOK        byte = 0x07
+	typeResponseErr       byte = 0x08
+	typeNone              byte = 0x09
+	typeSome              byte = 0x0a
+	typeList              byte = 0x0b
+	typeTuple             byte = 0x0c
+	typeStringASCII       byte = 0x0d
+	typeStringUTF8        byte = 0x0e
+)
+
+const (
+	// maxValueDepth bounds nesting when decoding, as Clarity does.
+	maxValueDepth = 32
+	maxNameLength = 128
+	// maxValueBytes bounds a single buffer, string, list or tuple read from the wire.
+	maxValueBytes = 1 << 20
+)
+
+var (
+	// ErrInvalidValue is returned for arguments that are not valid Clarity values.
+	ErrInvalidValue = errors.New("invalid Clarity value")
+
+	namePattern = regexp.MustCompile(`^[a-zA-Z]([a-zA-Z0-9]|[-_!?+<>=/*])*$|^[-+=/*]$|^[<>]=?$`)
+	// contractNamePattern is the stricter form Clarity accepts for contract names.
+	contractNamePattern = regexp.MustCompile(`^[a-zA-Z]([a-zA-Z0-9]|[-_])*$`)
+
+	minInt  = new(big.Int).Neg(new(big.Int).Lsh(big.NewInt(1), 127))
+	maxInt  = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 127), big.NewInt(1))
+	maxUInt = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+	two128  = new(big.Int).Lsh(big.NewInt(1), 128)
+)
+
+// Value is a Clarity value. String renders it as a Clarity literal, and its JSON form is the
+// {"type": ..., "value": ...} object ParseValue accepts.
+type Value interface {
+	String() string
+	json.Marshaler
+	appendTo(buf []byte) []byte
+}
+
+// Concrete Clarity values.
+type (
+	// Int is a signed 128-bit integer.
+	Int struct{ *big.Int }
+	// UInt is an unsigned 128-bit integer.
+	UInt struct{ *big.Int }
+	// Bool is true or false.
+	Bool bool
+	// Buffer is a byte buffer.
+	Buffer []byte
+	// StringASCII is a string-ascii.
+	StringASCII string
+	// StringUTF8 is a string-utf8.
+	StringUTF8 string
+	// Principal is a standard principal, or a contract principal when Contract is set.
+	Principal struct {
+		Version  byte
+		Hash160  [20]byte
+		Contract string
+	}
+	// Optional is (some Value), or none when Value is nil.
+	Optional struct{ Value Value }
+	// Response is (ok Value) or (err Value).
+	Response struct {
+		OK    bool
+		Value Value
+	}
+	// List is a list of values.
+	List []Value
+	// Tuple maps names to values.
+	Tuple map[string]Value
+)
+
+// Serialize encodes a value in the consensus wire format.
+func Serialize(v Value) []byte {
+	return v.appendTo(nil)
+}
+
+// SerializeHex encodes a value as 0x-prefixed hex, as the Stacks node API expects.
+func SerializeHex(v Value) string {
+	return "0x" + hex.EncodeToString(Serialize(v))
+}
+
+func (v Int) appendTo(buf []byte) []byte {
+	n := v.Int
+	if n.Sign() < 0 {
+		n = new(big.Int).Add(n, two128)
+	}
+	return append(append(buf, typeInt), uint128Bytes(n)...)
+}
+
+func (v UInt) appendTo(buf []byte) []byte {
+	return append(append(buf, typeUInt), uint128Bytes(v.Int)...)
+}
+
+func (v Bool) appendTo(buf []byte) []byte {
+	if v {
+		return append(buf, typeTrue)
+	}
+	return append(buf, typeFalse)
+}
+
+func (v Buffer) appendTo(buf []byte) []byte {
+	return append(appendLength(append(buf, typeBuffer), len(v)), v...)
+}
+
+func (v StringASCII) appendTo(buf []byte) []byte {
+	return append(appendLength(append(buf, typeStringASCII), len(v)), v...)
+}
+
+func (v StringUTF8) appendTo(buf []byte) []byte {
+	return append(appendLength(append(buf, typeStringUTF8), len(v)), v...)
+}
+
+func (v Principal) appendTo(buf []byte) []byte {
+	if v.Contract == "" {
+		return append(append(buf, typeStandardPrincipal, v.Version), v.Hash160[:]...)
+	}
+	buf = append(append(buf, typeContractPrincipal, v.Version), v.Hash160[:]...)
+	return append(append(buf, byte(len(v.Contract))), v.Contract...)
+}
+
+func (v Optional) appendTo(buf []byte) []byte {
+	if v.Value == nil {
+		return append(buf, typeNone)
+	}
+	return v.Value.appendTo(append(buf, typeSome))
+}
+
+func (v Response) appendTo(buf []byte) []byte {
+	if v.OK {
+		return v.Value.appendTo(append(buf, typeResponseOK))
+	}
+	return v.Value.appendTo(append(buf, typeResponseErr))
+}
+
+func (v List) appendTo(buf []byte) []byte {
+	buf = appendLength(append(buf, typeList), len(v))
+	for _, item := range v {
+		buf = item.appendTo(buf)
+	}
+	return buf
+}
+
+// appendTo writes the fields sorted by name, as Clarity requires.
+func (v Tuple) appendTo(buf []byte) []byte {
+	buf = appendLength(append(buf, typeTuple), len(v))
+	for _, name := range v.names() {
+		buf = append(append(buf, byte(len(name))), name...)
+		buf = v[name].appendTo(buf)
+	}
+	return buf
+}
+
+func (v Tuple) names() []string {
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func appendLength(buf []byte, n int) []byte {
+	return binary.BigEndian.AppendUint32(buf, uint32(n))
+}
+
+func uint128Bytes(n *big.Int) []byte {
+	out := make([]byte, 16)
+	return n.FillBytes(out)
+}
+
+func (v Int) String() string  { return v.Int.String() }
+func (v UInt) String() string { return "u" + v.Int.String() }
+func (v Bool) String() string { return strconv.FormatBool(bool(v)) }
+
+func (v Buffer) String() string { return "0x" + hex.EncodeToString(v) }
+
+func (v StringASCII) String() string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(string(v)) + `"`
+}
+
+func (v StringUTF8) String() string {
+	var b strings.Builder
+	b.WriteString(`u"`)
+	for _, r := range string(v) {
+		switch {
+		case r == '\\' || r == '"':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r > 0x7e:
+			fmt.Fprintf(&b, `\u{%x}`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Address returns the principal in c32check form, with the contract name when set.
+func (v Principal) Address() string {
+	address := EncodeAddress(v.Version, v.Hash160)
+	if v.Contract != "" {
+		address += "." + v.Contract
+	}
+	return address
+}
+
+func (v Principal) String() string { return "'" + v.Address() }
+
+func (v Optional) String() string {
+	if v.Value == nil {
+		return "none"
+	}
+	return "(some " + v.Value.String() + ")"
+}
+
+func (v Response) String() string {
+	if v.OK {
+		return "(ok " + v.Value.String() + ")"
+	}
+	return "(err " + v.Value.String() + ")"
+}
+
+func (v List) String() string {
+	parts := make([]string, len(v))
+	for i, item := range v {
+		parts[i] = item.String()
+	}
+	if len(parts) == 0 {
+		return "(list)"
+	}
+	return "(list " + strings.Join(parts, " ") + ")"
+}
+
+func (v Tuple) String() string {
+	names := v.names()
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + ": " + v[name].String()
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+type typedJSON struct {
+	Type  string `json:"type"`
+	Value any    `json:"value,omitempty"`
+}
+
+func (v Int) MarshalJSON() ([]byte, error) {
+	return json.Marshal(typedJSON{Type: "int", Value: v.Int.String()})
+}
+
+func (v UInt) MarshalJSON() ([]byte, error) {
+	return json.Marshal(typedJSON{Type: "uint", Value: v.Int.String()})
+}
+
+func (v Bool) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string `json:"type"`
+		Value bool   `json:"value"`
+	}{Type: "bool", Value: bool(v)})
+}
+
+func (v Buffer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}{Type: "buffer", Value: v.String()})
+}
+
+func (v StringASCII) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}{Type: "string-ascii", Value: string(v)})
+}
+
+func (v StringUTF8) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}{Type: "string-utf8", Value: string(v)})
+}
+
+func (v Principal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(typedJSON{Type: "principal", Value: v.Address()})
+}
+
+func (v Optional) MarshalJSON() ([]byte, error) {
+	if v.Value == nil {
+		return json.Marshal(typedJSON{Type: "none"})
+	}
+	return json.Marshal(typedJSON{Type: "some", Value: v.Value})
+}
+
+func (v Response) MarshalJSON() ([]byte, error) {
+	if v.OK {
+		return json.Marshal(typedJSON{Type: "ok", Value: v.Value})
+	}
+	return json.Marshal(typedJSON{Type: "err", Value: v.Value})
+}
+
+func (v List) MarshalJSON() ([]byte, error) {
+	items := []Value(v)
+	if items == nil {
+		items = []Value{}
+	}
+	return json.Marshal(struct {
+		Type  string  `json:"type"`
+		Value []Value `json:"value"`
+	}{Type: "list", Value: items})
+}
+
+func (v Tuple) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string           `json:"type"`
+		Value map[string]Value `json:"value"`
+	}{Type: "tuple", Value: v})
+}
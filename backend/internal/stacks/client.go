@@ -0,0 +1,207 @@
+// Package stacks calls a Stacks node's read-only contract API and encodes Clarity values in
+// the consensus wire format it expects.
+package stacks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMainnetURL = "https://api.mainnet.hiro.so"
+	defaultTestnetURL = "https://api.testnet.hiro.so"
+	defaultTimeout    = 15 * time.Second
+
+	// maxResponseBytes bounds the node response read into memory.
+	maxResponseBytes = 4 << 20
+)
+
+// Networks a call can target.
+const (
+	NetworkMainnet = "mainnet"
+	NetworkTestnet = "testnet"
+)
+
+var (
+	// ErrContractNotFound is returned when the node does not know the contract or function.
+	ErrContractNotFound = errors.New("contract or function not found")
+	// ErrNode is returned when the node rejects the call or cannot be reached.
+	ErrNode = errors.New("stacks node request failed")
+)
+
+// Config points the client at a node, or an API gateway such as Hiro's, for each network.
+type Config struct {
+	MainnetURL string
+	TestnetURL string
+	// APIKey is sent as x-api-key, which Hiro's API uses for higher rate limits.
+	APIKey  string
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads STACKS_API_URL, STACKS_TESTNET_API_URL, STACKS_API_KEY and
+// STACKS_API_TIMEOUT.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		MainnetURL: os.Getenv("STACKS_API_URL"),
+		TestnetURL: os.Getenv("STACKS_TESTNET_API_URL"),
+		APIKey:     os.Getenv("STACKS_API_KEY"),
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("STACKS_API_TIMEOUT")); err == nil && timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	return cfg
+}
+
+// Client calls read-only contract functions through a Stacks node's RPC API.
+type Client struct {
+	cfg  Config
+	http *http.Client
+}
+
+// NewClient returns a client for the configured nodes, defaulting to Hiro's public API.
+func NewClient(cfg Config) *Client {
+	if cfg.MainnetURL == "" {
+		cfg.MainnetURL = defaultMainnetURL
+	}
+	if cfg.TestnetURL == "" {
+		cfg.TestnetURL = defaultTestnetURL
+	}
+	cfg.MainnetURL = strings.TrimRight(cfg.MainnetURL, "/")
+	cfg.TestnetURL = strings.TrimRight(cfg.TestnetURL, "/")
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return &Client{cfg: cfg, http: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// ReadOnlyCall names a read-only function and the arguments to call it with.
+type ReadOnlyCall struct {
+	// Contract is the contract principal, e.g. "SP000000000000000000002Q6VF78.pox-4".
+	Contract Principal
+	Function string
+	// Sender is the tx-sender the function sees. It defaults to the contract's deployer.
+	Sender    *Principal
+	Arguments []Value
+	// Network is "mainnet" or "testnet". It defaults to the contract address's network.
+	Network string
+}
+
+// ReadOnlyResult is the node's answer. Okay is false when the function could not be
+// evaluated, with the node's explanation in Cause.
+type ReadOnlyResult struct {
+	Network string
+	Okay    bool
+	Result  Value
+	Hex     string
+	Cause   string
+}
+
+// CallReadOnly evaluates a read-only function on the node at the chain tip.
+func (c *Client) CallReadOnly(ctx context.Context, call ReadOnlyCall) (*ReadOnlyResult, error) {
+	if call.Contract.Contract == "" {
+		return nil, fmt.Errorf("%w: contract must be a contract principal", ErrInvalidValue)
+	}
+	if !validName(call.Function) {
+		return nil, fmt.Errorf("%w: invalid function name %q", ErrInvalidValue, call.Function)
+	}
+
+	network := call.Network
+	if network == "" {
+		network = NetworkTestnet
+		if IsMainnet(call.Contract.Version) {
+			network = NetworkMainnet
+		}
+	}
+	baseURL := c.cfg.MainnetURL
+	switch network {
+	case NetworkMainnet:
+	case NetworkTestnet:
+		baseURL = c.cfg.TestnetURL
+	default:
+		return nil, fmt.Errorf("%w: network must be %q or %q", ErrInvalidValue, NetworkMainnet, NetworkTestnet)
+	}
+
+	sender := Principal{Version: call.Contract.Version, Hash160: call.Contract.Hash160}
+	if call.Sender != nil {
+		sender = *call.Sender
+	}
+	arguments := make([]string, len(call.Arguments))
+	for i, argument := range call.Arguments {
+		arguments[i] = SerializeHex(argument)
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"sender":    sender.Address(),
+		"arguments": arguments,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := fmt.Sprintf("%s/v2/contracts/call-read/%s/%s/%s", baseURL,
+		EncodeAddress(call.Contract.Version, call.Contract.Hash160),
+		url.PathEscape(call.Contract.Contract),
+		url.PathEscape(call.Function))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.APIKey != "" {
+		req.Header.Set("x-api-key", c.cfg.APIKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNode, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("%w: read response: %v", ErrNode, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrContractNotFound, nodeMessage(data))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d: %s", ErrNode, resp.StatusCode, nodeMessage(data))
+	}
+
+	var decoded struct {
+		Okay   bool   `json:"okay"`
+		Result string `json:"result"`
+		Cause  string `json:"cause"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("%w: decode response: %v", ErrNode, err)
+	}
+
+	result := &ReadOnlyResult{Network: network, Okay: decoded.Okay, Cause: decoded.Cause}
+	if decoded.Okay {
+		value, err := DeserializeHex(decoded.Result)
+		if err != nil {
+			return nil, fmt.Errorf("%w: decode result: %v", ErrNode, err)
+		}
+		result.Result, result.Hex = value, decoded.Result
+	}
+	return result, nil
+}
+
+// nodeMessage shortens a node error body for inclusion in an error.
+func nodeMessage(body []byte) string {
+	message := strings.TrimSpace(string(body))
+	if len(message) > 300 {
+		message = message[:300] + "..."
+	}
+	return message
+}
@@ -0,0 +1,380 @@
+package stacks
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseValue reads a function argument. It accepts a 0x-prefixed hex string holding an
+// already serialized value, or a typed object such as {"type": "uint", "value": "10"},
+// {"type": "principal", "value": "SP....my-contract"} or
+// {"type": "tuple", "value": {"id": {"type": "uint", "value": 1}}}. Types are int, uint,
+// bool, buffer (hex), string-ascii, string-utf8, principal, none, some, ok, err, list
+// and tuple.
+func ParseValue(raw json.RawMessage) (Value, error) {
+	return parseValue(raw, 0)
+}
+
+func parseValue(raw json.RawMessage, depth int) (Value, error) {
+	if depth > maxValueDepth {
+		return nil, fmt.Errorf("%w: nested more than %d levels deep", ErrInvalidValue, maxValueDepth)
+	}
+
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		data, err := decodeHex(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: string arguments must be 0x-prefixed serialized values", ErrInvalidValue)
+		}
+		return Deserialize(data)
+	}
+
+	var typed struct {
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &typed); err != nil || typed.Type == "" {
+		return nil, fmt.Errorf("%w: expected a hex string or an object with a type", ErrInvalidValue)
+	}
+
+	switch strings.ToLower(typed.Type) {
+	case "int":
+		n, err := parseInteger(typed.Value)
+		if err != nil || n.Cmp(minInt) < 0 || n.Cmp(maxInt) > 0 {
+			return nil, fmt.Errorf("%w: int must be a 128-bit signed integer", ErrInvalidValue)
+		}
+		return Int{n}, nil
+	case "uint":
+		n, err := parseInteger(typed.Value)
+		if err != nil || n.Sign() < 0 || n.Cmp(maxUInt) > 0 {
+			return nil, fmt.Errorf("%w: uint must be a 128-bit unsigned integer", ErrInvalidValue)
+		}
+		return UInt{n}, nil
+	case "bool":
+		var b bool
+		if err := json.Unmarshal(typed.Value, &b); err != nil {
+			return nil, fmt.Errorf("%w: bool must be true or false", ErrInvalidValue)
+		}
+		return Bool(b), nil
+	case "buffer":
+		var s string
+		if err := json.Unmarshal(typed.Value, &s); err != nil {
+			return nil, fmt.Errorf("%w: buffer must be a hex string", ErrInvalidValue)
+		}
+		data, err := decodeHex(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: buffer must be a hex string", ErrInvalidValue)
+		}
+		return Buffer(data), nil
+	case "string-ascii":
+		var s string
+		if err := json.Unmarshal(typed.Value, &s); err != nil || !validASCII(s) {
+			return nil, fmt.Errorf("%w: string-ascii must hold printable ASCII", ErrInvalidValue)
+		}
+		return StringASCII(s), nil
+	case "string-utf8":
+		var s string
+		if err := json.Unmarshal(typed.Value, &s); err != nil {
+			return nil, fmt.Errorf("%w: string-utf8 must be a string", ErrInvalidValue)
+		}
+		return StringUTF8(s), nil
+	case "principal":
+		var s string
+		if err := json.Unmarshal(typed.Value, &s); err != nil {
+			return nil, fmt.Errorf("%w: principal must be a string", ErrInvalidValue)
+		}
+		return ParsePrincipal(s)
+	case "none":
+		return Optional{}, nil
+	case "some", "ok", "err":
+		if len(typed.Value) == 0 {
+			return nil, fmt.Errorf("%w: %s needs a value", ErrInvalidValue, typed.Type)
+		}
+		inner, err := parseValue(typed.Value, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(typed.Type) {
+		case "some":
+			return Optional{Value: inner}, nil
+		case "ok":
+			return Response{OK: true, Value: inner}, nil
+		default:
+			return Response{Value: inner}, nil
+		}
+	case "list":
+		var items []json.RawMessage
+		if err := json.Unmarshal(typed.Value, &items); err != nil {
+			return nil, fmt.Errorf("%w: list value must be an array", ErrInvalidValue)
+		}
+		list := make(List, 0, len(items))
+		for _, item := range items {
+			value, err := parseValue(item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case "tuple":
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(typed.Value, &fields); err != nil || len(fields) == 0 {
+			return nil, fmt.Errorf("%w: tuple value must be a non-empty object", ErrInvalidValue)
+		}
+		tuple := make(Tuple, len(fields))
+		for name, field := range fields {
+			if !validName(name) {
+				return nil, fmt.Errorf("%w: invalid tuple key %q", ErrInvalidValue, name)
+			}
+			value, err := parseValue(field, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			tuple[name] = value
+		}
+		return tuple, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidValue, typed.Type)
+	}
+}
+
+// ParsePrincipal parses "SP..." or "SP....contract-name", with or without a leading quote.
+func ParsePrincipal(s string) (Principal, error) {
+	address, contract, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(s), "'"), ".")
+	version, hash, err := DecodeAddress(address)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidValue, err)
+	}
+	if contract != "" && !validContractName(contract) {
+		return Principal{}, fmt.Errorf("%w: invalid contract name %q", ErrInvalidValue, contract)
+	}
+	return Principal{Version: version, Hash160: hash, Contract: contract}, nil
+}
+
+// parseInteger accepts a JSON number or a decimal string, so values beyond 2^53 survive.
+func parseInteger(raw json.RawMessage) (*big.Int, error) {
+	text := strings.TrimSpace(string(raw))
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		text = strings.TrimSpace(s)
+	}
+	n, ok := new(big.Int).SetString(text, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid integer %q", text)
+	}
+	return n, nil
+}
+
+func decodeHex(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return nil, fmt.Errorf("missing 0x prefix")
+	}
+	return hex.DecodeString(s[2:])
+}
+
+func validName(name string) bool {
+	return len(name) <= maxNameLength && namePattern.MatchString(name)
+}
+
+func validContractName(name string) bool {
+	return len(name) <= maxNameLength && contractNamePattern.MatchString(name)
+}
+
+func validASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < 0x20 || c > 0x7e) && c != '\n' && c != '\t' && c != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// DeserializeHex decodes a 0x-prefixed serialized value, such as a call-read result.
+func DeserializeHex(s string) (Value, error) {
+	data, err := decodeHex(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidValue, err)
+	}
+	return Deserialize(data)
+}
+
+// Deserialize decodes a value in the consensus wire format. Trailing bytes are an error.
+func Deserialize(data []byte) (Value, error) {
+	r := &valueReader{data: data}
+	value, err := r.value(0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidValue, err)
+	}
+	if r.pos != len(data) {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrInvalidValue, len(data)-r.pos)
+	}
+	return value, nil
+}
+
+type valueReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *valueReader) take(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data)-r.pos {
+		return nil, fmt.Errorf("unexpected end of value at byte %d", r.pos)
+	}
+	out := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return out, nil
+}
+
+func (r *valueReader) byte() (byte, error) {
+	b, err := r.take(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// length reads a u32 length, rejecting lengths the remaining bytes cannot hold.
+func (r *valueReader) length() (int, error) {
+	b, err := r.take(4)
+	if err != nil {
+		return 0, err
+	}
+	n := binary.BigEndian.Uint32(b)
+	if n > maxValueBytes || int(n) > len(r.data)-r.pos {
+		return 0, fmt.Errorf("length %d exceeds the value at byte %d", n, r.pos-4)
+	}
+	return int(n), nil
+}
+
+func (r *valueReader) name() (string, error) {
+	n, err := r.byte()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.take(int(n))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (r *valueReader) value(depth int) (Value, error) {
+	if depth > maxValueDepth {
+		return nil, fmt.Errorf("nested more than %d levels deep", maxValueDepth)
+	}
+
+	prefix, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch prefix {
+	case typeInt, typeUInt:
+		b, err := r.take(16)
+		if err != nil {
+			return nil, err
+		}
+		n := new(big.Int).SetBytes(b)
+		if prefix == typeUInt {
+			return UInt{n}, nil
+		}
+		if b[0]&0x80 != 0 {
+			n.Sub(n, two128)
+		}
+		return Int{n}, nil
+	case typeTrue:
+		return Bool(true), nil
+	case typeFalse:
+		return Bool(false), nil
+	case typeBuffer, typeStringASCII, typeStringUTF8:
+		n, err := r.length()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.take(n)
+		if err != nil {
+			return nil, err
+		}
+		switch prefix {
+		case typeBuffer:
+			return Buffer(bytes.Clone(b)), nil
+		case typeStringASCII:
+			if !validASCII(string(b)) {
+				return nil, fmt.Errorf("string-ascii holds non-ASCII bytes")
+			}
+			return StringASCII(b), nil
+		default:
+			if !utf8.Valid(b) {
+				return nil, fmt.Errorf("string-utf8 holds invalid UTF-8")
+			}
+			return StringUTF8(b), nil
+		}
+	case typeStandardPrincipal, typeContractPrincipal:
+		b, err := r.take(21)
+		if err != nil {
+			return nil, err
+		}
+		principal := Principal{Version: b[0]}
+		copy(principal.Hash160[:], b[1:])
+		if prefix == typeContractPrincipal {
+			if principal.Contract, err = r.name(); err != nil {
+				return nil, err
+			}
+		}
+		return principal, nil
+	case typeResponseOK, typeResponseErr:
+		inner, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Response{OK: prefix == typeResponseOK, Value: inner}, nil
+	case typeNone:
+		return Optional{}, nil
+	case typeSome:
+		inner, err := r.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Optional{Value: inner}, nil
+	case typeList:
+		n, err := r.length()
+		if err != nil {
+			return nil, err
+		}
+		list := make(List, 0, n)
+		for i := 0; i < n; i++ {
+			item, err := r.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, nil
+	case typeTuple:
+		n, err := r.length()
+		if err != nil {
+			return nil, err
+		}
+		tuple := make(Tuple, n)
+		for i := 0; i < n; i++ {
+			name, err := r.name()
+			if err != nil {
+				return nil, err
+			}
+			if tuple[name], err = r.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return tuple, nil
+	default:
+		return nil, fmt.Errorf("unknown type prefix 0x%02x at byte %d", prefix, r.pos-1)
+	}
+}
@@ -0,0 +1,138 @@
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Totals sums the requests, tokens and estimated LLM cost of a set of query logs.
+type Totals struct {
+	Requests         int64   `json:"requests"`
+	InputTokens      int64   `json:"input_tokens"`
+	OutputTokens     int64   `json:"output_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+}
+
+// DayUsage is a user's usage on one UTC day.
+type DayUsage struct {
+	Date string `json:"date"`
+	Totals
+}
+
+// KeyUsage is a user's usage through one API key. Requests made with a session have no key.
+type KeyUsage struct {
+	APIKeyID *int64 `json:"api_key_id"`
+	Name     string `json:"name,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+	// OrgID is set for organization keys, whose tokens count against the organization's quota.
+	OrgID *int64 `json:"org_id,omitempty"`
+	Totals
+}
+
+// Report breaks a user's usage down by day and by API key over [StartDate, EndDate].
+type Report struct {
+	UserID    int64      `json:"user_id"`
+	StartDate time.Time  `json:"start_date"`
+	EndDate   time.Time  `json:"end_date"`
+	Total     Totals     `json:"total"`
+	ByDay     []DayUsage `json:"by_day"`
+	ByAPIKey  []KeyUsage `json:"by_api_key"`
+}
+
+// Report aggregates the user's query logs between start and end, including requests made
+// with organization keys. Days without requests are reported with zeros.
+func (s *Service) Report(ctx context.Context, userID int64, start, end time.Time) (*Report, error) {
+	start, end = start.UTC(), end.UTC()
+	report := &Report{
+		UserID:    userID,
+		StartDate: start,
+		EndDate:   end,
+		ByDay:     make([]DayUsage, 0),
+		ByAPIKey:  make([]KeyUsage, 0),
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT strftime('%Y-%m-%d', created_at) AS day, COUNT(*),
+			COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0), COALESCE(SUM(cost_usd), 0)
+		FROM query_logs
+		WHERE user_id = ? AND created_at >= ? AND created_at <= ?
+		GROUP BY day
+		ORDER BY day
+	`, userID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate daily usage: %w", err)
+	}
+	byDay := make(map[string]Totals)
+	for rows.Next() {
+		var (
+			day    string
+			totals Totals
+		)
+		if err := rows.Scan(&day, &totals.Requests, &totals.InputTokens, &totals.OutputTokens, &totals.EstimatedCostUSD); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan daily usage: %w", err)
+		}
+		totals.TotalTokens = totals.InputTokens + totals.OutputTokens
+		byDay[day] = totals
+		report.Total.add(totals)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate daily usage: %w", err)
+	}
+	first := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	for day := first; !day.After(end); day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		report.ByDay = append(report.ByDay, DayUsage{Date: date, Totals: byDay[date]})
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT q.api_key_id, COALESCE(k.name, ''), COALESCE(k.api_key_prefix, ''), k.org_id, COUNT(*),
+			COALESCE(SUM(q.input_tokens), 0), COALESCE(SUM(q.output_tokens), 0), COALESCE(SUM(q.cost_usd), 0)
+		FROM query_logs q
+		LEFT JOIN api_keys k ON k.id = q.api_key_id
+		WHERE q.user_id = ? AND q.created_at >= ? AND q.created_at <= ?
+		GROUP BY q.api_key_id
+		ORDER BY SUM(q.input_tokens) + SUM(q.output_tokens) DESC, q.api_key_id
+	`, userID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate usage by api key: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			key          KeyUsage
+			apiKeyID     sql.NullInt64
+			orgID        sql.NullInt64
+			name, prefix string
+		)
+		if err := rows.Scan(&apiKeyID, &name, &prefix, &orgID, &key.Requests, &key.InputTokens, &key.OutputTokens, &key.EstimatedCostUSD); err != nil {
+			return nil, fmt.Errorf("scan usage by api key: %w", err)
+		}
+		if apiKeyID.Valid {
+			key.APIKeyID = &apiKeyID.Int64
+		}
+		if orgID.Valid {
+			key.OrgID = &orgID.Int64
+		}
+		key.Name, key.Prefix = name, prefix
+		key.TotalTokens = key.InputTokens + key.OutputTokens
+		report.ByAPIKey = append(report.ByAPIKey, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate usage by api key: %w", err)
+	}
+
+	return report, nil
+}
+
+func (t *Totals) add(other Totals) {
+	t.Requests += other.Requests
+	t.InputTokens += other.InputTokens
+	t.OutputTokens += other.OutputTokens
+	t.TotalTokens += other.TotalTokens
+	t.EstimatedCostUSD += other.EstimatedCostUSD
+}
@@ -0,0 +1,268 @@
+// Package usage meters monthly token consumption from query logs and enforces per-user and
+// per-organization quotas.
+package usage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrUserNotFound is returned when quota lookups reference an unknown user.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrOrgNotFound is returned when quota lookups reference an unknown organization.
+	ErrOrgNotFound = errors.New("organization not found")
+)
+
+// Config holds the default monthly token quota for each role. Zero means unlimited.
+type Config struct {
+	RoleLimits map[string]int64
+}
+
+// defaultTrialTokens is the token allowance of an anonymous trial unless TRIAL_MAX_TOKENS is set.
+const defaultTrialTokens = 20000
+
+// ConfigFromEnv loads USAGE_QUOTA_USER_TOKENS, USAGE_QUOTA_ADMIN_TOKENS and TRIAL_MAX_TOKENS,
+// the quota of anonymous trial identities. Trials are always limited.
+func ConfigFromEnv() Config {
+	cfg := Config{RoleLimits: map[string]int64{"trial": defaultTrialTokens}}
+	for role, key := range map[string]string{
+		"user":  "USAGE_QUOTA_USER_TOKENS",
+		"admin": "USAGE_QUOTA_ADMIN_TOKENS",
+		"trial": "TRIAL_MAX_TOKENS",
+	} {
+		if limit, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil && limit > 0 {
+			cfg.RoleLimits[role] = limit
+		}
+	}
+	return cfg
+}
+
+// Summary reports a user's or an organization's token consumption for the current billing period.
+type Summary struct {
+	UserID       int64            `json:"user_id,omitempty"`
+	OrgID        int64            `json:"org_id,omitempty"`
+	PeriodStart  time.Time        `json:"period_start"`
+	PeriodEnd    time.Time        `json:"period_end"`
+	Requests     int64            `json:"requests"`
+	InputTokens  int64            `json:"input_tokens"`
+	OutputTokens int64            `json:"output_tokens"`
+	TotalTokens  int64            `json:"total_tokens"`
+	ByEndpoint   map[string]int64 `json:"tokens_by_endpoint"`
+	// Limit is the monthly token quota; nil means unlimited.
+	Limit     *int64 `json:"limit"`
+	Remaining *int64 `json:"remaining"`
+	// LimitSource is "user" for a per-user override, "role" for the role default, "org" for
+	// an organization's pooled quota, or "none".
+	LimitSource string `json:"limit_source"`
+}
+
+// Exceeded reports whether the summary's quota has been used up.
+func (s Summary) Exceeded() bool {
+	return s.Limit != nil && s.TotalTokens >= *s.Limit
+}
+
+// Service computes usage and resolves quotas.
+type Service struct {
+	db  *sql.DB
+	cfg Config
+}
+
+// NewService returns a usage service backed by the supplied sql.DB handle.
+func NewService(db *sql.DB, cfg Config) *Service {
+	if cfg.RoleLimits == nil {
+		cfg.RoleLimits = make(map[string]int64)
+	}
+	return &Service{db: db, cfg: cfg}
+}
+
+// Period returns the calendar month (UTC) containing now.
+func Period(now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// Summary aggregates the user's token usage for the current month from query logs. Requests
+// made with organization keys count against the organization instead.
+func (s *Service) Summary(ctx context.Context, userID int64) (*Summary, error) {
+	summary, err := s.aggregate(ctx, `
+		user_id = ? AND (api_key_id IS NULL OR api_key_id NOT IN (SELECT id FROM api_keys WHERE org_id IS NOT NULL))
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	summary.UserID = userID
+
+	limit, source, err := s.Limit(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	summary.applyLimit(limit, source)
+	return summary, nil
+}
+
+// OrgSummary aggregates the token usage of all the organization's keys for the current month
+// and reports it against the organization's pooled quota.
+func (s *Service) OrgSummary(ctx context.Context, orgID int64) (*Summary, error) {
+	var limit sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT monthly_token_limit FROM organizations WHERE id = ?`, orgID).Scan(&limit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrOrgNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query organization quota: %w", err)
+	}
+
+	summary, err := s.aggregate(ctx, `api_key_id IN (SELECT id FROM api_keys WHERE org_id = ?)`, orgID)
+	if err != nil {
+		return nil, err
+	}
+	summary.OrgID = orgID
+
+	if limit.Valid && limit.Int64 > 0 {
+		summary.applyLimit(&limit.Int64, "org")
+	} else {
+		summary.applyLimit(nil, "none")
+	}
+	return summary, nil
+}
+
+// aggregate sums the current month's query logs matching the where clause. Requests served
+// with the caller's own provider keys do not count toward quotas and are left out.
+func (s *Service) aggregate(ctx context.Context, where string, args ...any) (*Summary, error) {
+	start, end := Period(time.Now())
+
+	summary := &Summary{
+		PeriodStart: start,
+		PeriodEnd:   end,
+		ByEndpoint:  make(map[string]int64),
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT endpoint, COUNT(*), COALESCE(SUM(input_tokens), 0), COALESCE(SUM(output_tokens), 0)
+		FROM query_logs
+		WHERE `+where+` AND created_at >= ? AND created_at < ? AND user_key = 0
+		GROUP BY endpoint
+	`, append(args, start, end)...)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate usage: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			endpoint       string
+			count, in, out int64
+		)
+		if err := rows.Scan(&endpoint, &count, &in, &out); err != nil {
+			return nil, fmt.Errorf("scan usage: %w", err)
+		}
+		summary.Requests += count
+		summary.InputTokens += in
+		summary.OutputTokens += out
+		summary.ByEndpoint[endpoint] = in + out
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate usage: %w", err)
+	}
+	summary.TotalTokens = summary.InputTokens + summary.OutputTokens
+
+	return summary, nil
+}
+
+func (s *Summary) applyLimit(limit *int64, source string) {
+	s.LimitSource = source
+	if limit != nil {
+		remaining := *limit - s.TotalTokens
+		if remaining < 0 {
+			remaining = 0
+		}
+		s.Limit = limit
+		s.Remaining = &remaining
+	}
+}
+
+// Limit resolves the user's monthly token quota: a per-user override takes precedence over
+// the role default. A nil limit means unlimited.
+func (s *Service) Limit(ctx context.Context, userID int64) (*int64, string, error) {
+	var (
+		role     string
+		override sql.NullInt64
+	)
+	err := s.db.QueryRowContext(ctx, `
+		SELECT u.role, q.monthly_token_limit
+		FROM users u
+		LEFT JOIN user_quotas q ON q.user_id = u.id
+		WHERE u.id = ?
+	`, userID).Scan(&role, &override)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", ErrUserNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("query quota: %w", err)
+	}
+
+	if override.Valid {
+		if override.Int64 <= 0 {
+			return nil, "user", nil
+		}
+		return &override.Int64, "user", nil
+	}
+	if limit, ok := s.cfg.RoleLimits[role]; ok {
+		return &limit, "role", nil
+	}
+	return nil, "none", nil
+}
+
+// SetUserLimit stores a per-user quota override. A nil limit removes the override so the role
+// default applies again; zero grants unlimited usage.
+func (s *Service) SetUserLimit(ctx context.Context, userID int64, limit *int64) error {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, userID).Scan(&exists); err != nil {
+		return fmt.Errorf("query user: %w", err)
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	if limit == nil {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM user_quotas WHERE user_id = ?`, userID); err != nil {
+			return fmt.Errorf("delete quota: %w", err)
+		}
+		return nil
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_quotas (user_id, monthly_token_limit, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			monthly_token_limit = excluded.monthly_token_limit,
+			updated_at = excluded.updated_at
+	`, userID, *limit, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("upsert quota: %w", err)
+	}
+	return nil
+}
+
+// SetOrgLimit sets the organization's pooled monthly quota. A nil or zero limit means unlimited.
+func (s *Service) SetOrgLimit(ctx context.Context, orgID int64, limit *int64) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE organizations SET monthly_token_limit = ? WHERE id = ?`, limit, orgID)
+	if err != nil {
+		return fmt.Errorf("update organization quota: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrOrgNotFound
+	}
+	return nil
+}
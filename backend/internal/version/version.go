@@ -0,0 +1,15 @@
+package version
+
+import "os"
+
+// Version is the server build version, overridable at build time with
+// -ldflags "-X github.com/Quantum3-Labs/stacks-builder/backend/internal/version.Version=<tag>".
+var Version = "dev"
+
+// Get returns the server version, preferring SERVER_VERSION when set.
+func Get() string {
+	if v := os.Getenv("SERVER_VERSION"); v != "" {
+		return v
+	}
+	return Version
+}
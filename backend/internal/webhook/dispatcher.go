@@ -0,0 +1,264 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultWorkers      = 2
+	defaultQueueSize    = 256
+	defaultMaxAttempts  = 5
+	defaultTimeout      = 10 * time.Second
+	defaultRetryBackoff = 2 * time.Second
+	// maxRetryBackoff caps the doubling delay between attempts.
+	maxRetryBackoff = time.Minute
+	// maxErrorBodyBytes bounds how much of a failed response is kept in the delivery log.
+	maxErrorBodyBytes = 512
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Config controls how events are queued and delivered.
+type Config struct {
+	// Workers is the number of deliveries sent at once.
+	Workers int
+	// QueueSize bounds the events waiting for a worker; later events are dropped and logged.
+	QueueSize int
+	// MaxAttempts is the number of tries per delivery, including the first.
+	MaxAttempts int
+	// Timeout bounds each attempt.
+	Timeout time.Duration
+	// RetryBackoff is the delay before the first retry; it doubles for each later one.
+	RetryBackoff time.Duration
+}
+
+// ConfigFromEnv reads WEBHOOK_WORKERS, WEBHOOK_QUEUE_SIZE, WEBHOOK_MAX_ATTEMPTS,
+// WEBHOOK_TIMEOUT and WEBHOOK_RETRY_BACKOFF.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Workers:      defaultWorkers,
+		QueueSize:    defaultQueueSize,
+		MaxAttempts:  defaultMaxAttempts,
+		Timeout:      defaultTimeout,
+		RetryBackoff: defaultRetryBackoff,
+	}
+	if n, err := strconv.Atoi(os.Getenv("WEBHOOK_WORKERS")); err == nil && n > 0 {
+		cfg.Workers = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("WEBHOOK_QUEUE_SIZE")); err == nil && n > 0 {
+		cfg.QueueSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && n > 0 {
+		cfg.MaxAttempts = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("WEBHOOK_TIMEOUT")); err == nil && d > 0 {
+		cfg.Timeout = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("WEBHOOK_RETRY_BACKOFF")); err == nil && d >= 0 {
+		cfg.RetryBackoff = d
+	}
+	return cfg
+}
+
+// Dispatcher fans events out to subscribed webhooks on background workers.
+type Dispatcher struct {
+	repo   *Repository
+	cfg    Config
+	client *http.Client
+	queue  chan Event
+}
+
+// NewDispatcher constructs a dispatcher. Events are only delivered after Start is called.
+func NewDispatcher(repo *Repository, cfg Config) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return &Dispatcher{
+		repo:   repo,
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		queue:  make(chan Event, cfg.QueueSize),
+	}
+}
+
+// Repository returns the webhook repository used by the dispatcher.
+func (d *Dispatcher) Repository() *Repository {
+	return d.repo
+}
+
+// Start launches the delivery workers, which stop when ctx is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) {
+	for i := 0; i < d.cfg.Workers; i++ {
+		go d.work(ctx)
+	}
+}
+
+// Publish queues an event for every webhook subscribed to eventType. It never blocks; when
+// the queue is full the event is dropped.
+func (d *Dispatcher) Publish(eventType string, data any) {
+	event := newEvent(eventType, data)
+	select {
+	case d.queue <- event:
+	default:
+		log.Printf("webhook: queue full, dropped %s event %s", eventType, event.ID)
+	}
+}
+
+// Test sends a webhook.test event to w once, without retries, and returns the recorded
+// delivery.
+func (d *Dispatcher) Test(ctx context.Context, w Webhook) (*Delivery, error) {
+	event := newEvent(EventTest, map[string]any{"webhook_id": w.ID})
+	return d.deliver(ctx, w, event, 1)
+}
+
+func newEvent(eventType string, data any) Event {
+	return Event{
+		ID:        "evt_" + uuid.NewString(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	}
+}
+
+func (d *Dispatcher) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-d.queue:
+			d.dispatch(ctx, event)
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, event Event) {
+	webhooks, err := d.repo.Subscribers(ctx, event.Type)
+	if err != nil {
+		log.Printf("webhook: failed to load subscribers of %s: %v", event.Type, err)
+		return
+	}
+	for _, w := range webhooks {
+		if _, err := d.deliver(ctx, w, event, d.cfg.MaxAttempts); err != nil {
+			log.Printf("webhook: %v", err)
+		}
+	}
+}
+
+// deliver sends event to w in up to maxAttempts tries, retrying network errors, 429s and
+// 5xx responses with exponential backoff, and records the outcome.
+func (d *Dispatcher) deliver(ctx context.Context, w Webhook, event Event, maxAttempts int) (*Delivery, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s event %s: %w", event.Type, event.ID, err)
+	}
+
+	delivery := &Delivery{
+		WebhookID: w.ID,
+		EventID:   event.ID,
+		EventType: event.Type,
+		Payload:   string(payload),
+		Status:    DeliveryFailed,
+		CreatedAt: time.Now().UTC(),
+	}
+	start := time.Now()
+	backoff := d.cfg.RetryBackoff
+attempts:
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		delivery.Attempts = attempt
+		status, retry, err := d.send(ctx, w, event, payload)
+		delivery.ResponseStatus = status
+		if err == nil {
+			now := time.Now().UTC()
+			delivery.Status, delivery.ErrorMessage, delivery.DeliveredAt = DeliverySucceeded, "", &now
+			break
+		}
+		delivery.ErrorMessage = err.Error()
+		if !retry || attempt == maxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			break attempts
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+	delivery.DurationMs = time.Since(start).Milliseconds()
+
+	if err := d.repo.RecordDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		return delivery, err
+	}
+	if delivery.Status != DeliverySucceeded {
+		log.Printf("webhook: %s event %s to webhook %d failed after %d attempts: %s",
+			event.Type, event.ID, w.ID, delivery.Attempts, delivery.ErrorMessage)
+	}
+	return delivery, nil
+}
+
+// send makes one delivery attempt. It returns the response status, whether a failure is
+// worth retrying, and the failure.
+func (d *Dispatcher) send(ctx context.Context, w Webhook, event Event, payload []byte) (int, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "stacks-builder-webhooks/1")
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderDelivery, event.ID)
+	req.Header.Set(HeaderSignature, Sign(w.Secret, time.Now(), payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return resp.StatusCode, retry, fmt.Errorf("endpoint responded %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+}
+
+// Sign returns the X-Webhook-Signature value for payload sent at ts:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<payload>" keyed with the secret>".
+// Receivers recompute the HMAC and reject stale timestamps to prevent replays.
+func Sign(secret string, ts time.Time, payload []byte) string {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,104 @@
+// Package webhook delivers signed event notifications, such as finished ingestion and
+// batch jobs, to callback URLs registered by admins, retrying failures and recording every
+// delivery.
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Event types a webhook can subscribe to.
+const (
+	EventIngestionCompleted = "ingestion.completed"
+	EventBatchCompleted     = "batch.completed"
+	EventQuotaExceeded      = "quota.exceeded"
+	EventBudgetAlert        = "budget.alert"
+	// EventTest is sent by the test endpoint regardless of subscriptions.
+	EventTest = "webhook.test"
+)
+
+// Events lists the event types webhooks can subscribe to.
+var Events = []string{EventIngestionCompleted, EventBatchCompleted, EventQuotaExceeded, EventBudgetAlert}
+
+// Delivery outcomes stored in webhook_deliveries.status.
+const (
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+var (
+	// ErrNotFound is returned when no webhook has the requested id.
+	ErrNotFound = errors.New("webhook not found")
+	// ErrInvalid wraps validation failures of a webhook's URL or events.
+	ErrInvalid = errors.New("invalid webhook")
+)
+
+// Publisher notifies subscribed webhooks of an event.
+type Publisher interface {
+	Publish(eventType string, data any)
+}
+
+// Webhook is a registered callback URL and the events it receives. The secret signs every
+// delivery and is only returned when the webhook is created.
+type Webhook struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description,omitempty"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	Secret      string    `json:"secret,omitempty"`
+	CreatedBy   *int64    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate checks that the URL is absolute http(s) and that every event is known.
+func (w Webhook) Validate() error {
+	parsed, err := url.Parse(w.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalid)
+	}
+	if len(w.Events) == 0 {
+		return fmt.Errorf("%w: subscribe to at least one of %s", ErrInvalid, strings.Join(Events, ", "))
+	}
+	for _, event := range w.Events {
+		if !slices.Contains(Events, event) {
+			return fmt.Errorf("%w: unknown event %q; must be one of %s", ErrInvalid, event, strings.Join(Events, ", "))
+		}
+	}
+	return nil
+}
+
+// Subscribed reports whether the webhook receives eventType.
+func (w Webhook) Subscribed(eventType string) bool {
+	return w.Active && slices.Contains(w.Events, eventType)
+}
+
+// Event is the JSON body POSTed to webhooks.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// Delivery records the outcome of sending one event to one webhook, after all retries.
+type Delivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      int64      `json:"webhook_id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	ErrorMessage   string     `json:"error_message,omitempty"`
+	DurationMs     int64      `json:"duration_ms"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
@@ -0,0 +1,238 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+)
+
+// secretPrefix marks generated signing secrets.
+const secretPrefix = "whsec_"
+
+// Repository persists webhooks and their delivery log. Writes go through the database's
+// shared writer.
+type Repository struct {
+	db     *sql.DB
+	writer *database.Writer
+}
+
+// NewRepository returns a repository backed by the supplied sql.DB handle.
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db: db, writer: database.WriterFor(db)}
+}
+
+const selectColumns = `id, url, COALESCE(description, ''), events, active, secret, created_by, created_at, updated_at`
+
+// Create validates and stores w, generating a signing secret when none is set.
+func (r *Repository) Create(ctx context.Context, w *Webhook) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	if w.Secret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			return err
+		}
+		w.Secret = secret
+	}
+
+	now := time.Now().UTC()
+	res, err := r.writer.Exec(ctx, `
+		INSERT INTO webhooks (url, description, events, active, secret, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.URL, w.Description, strings.Join(w.Events, ","), w.Active, w.Secret, w.CreatedBy, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("create webhook: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create webhook: %w", err)
+	}
+	w.ID, w.CreatedAt, w.UpdatedAt = id, now, now
+	return nil
+}
+
+// Get returns the webhook with its secret.
+func (r *Repository) Get(ctx context.Context, id int64) (*Webhook, error) {
+	w, err := scanWebhook(r.db.QueryRowContext(ctx, `SELECT `+selectColumns+` FROM webhooks WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return w, err
+}
+
+// List returns every webhook with its secret, oldest first.
+func (r *Repository) List(ctx context.Context) ([]Webhook, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+selectColumns+` FROM webhooks ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := make([]Webhook, 0)
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhooks: %w", err)
+	}
+	return webhooks, nil
+}
+
+// Subscribers returns the active webhooks subscribed to eventType.
+func (r *Repository) Subscribers(ctx context.Context, eventType string) ([]Webhook, error) {
+	webhooks, err := r.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subscribed := webhooks[:0]
+	for _, w := range webhooks {
+		if w.Subscribed(eventType) {
+			subscribed = append(subscribed, w)
+		}
+	}
+	return subscribed, nil
+}
+
+// Update validates and stores the URL, description, events and active flag of w.
+func (r *Repository) Update(ctx context.Context, w *Webhook) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	res, err := r.writer.Exec(ctx, `
+		UPDATE webhooks SET url = ?, description = ?, events = ?, active = ?, updated_at = ?
+		WHERE id = ?`,
+		w.URL, w.Description, strings.Join(w.Events, ","), w.Active, now, w.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update webhook: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	w.UpdatedAt = now
+	return nil
+}
+
+// Delete removes the webhook and its delivery log.
+func (r *Repository) Delete(ctx context.Context, id int64) error {
+	return r.writer.Do(ctx, func(db *sql.DB) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("delete webhook: %w", err)
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+			return fmt.Errorf("delete webhook deliveries: %w", err)
+		}
+		res, err := tx.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
+		if err != nil {
+			return fmt.Errorf("delete webhook: %w", err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrNotFound
+		}
+		return tx.Commit()
+	})
+}
+
+// RecordDelivery appends d to the delivery log.
+func (r *Repository) RecordDelivery(ctx context.Context, d *Delivery) error {
+	res, err := r.writer.Exec(ctx, `
+		INSERT INTO webhook_deliveries
+			(webhook_id, event_id, event_type, payload, status, attempts, response_status,
+			 error_message, duration_ms, created_at, delivered_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.WebhookID, d.EventID, d.EventType, d.Payload, d.Status, d.Attempts, d.ResponseStatus,
+		d.ErrorMessage, d.DurationMs, d.CreatedAt, d.DeliveredAt,
+	)
+	if err != nil {
+		return fmt.Errorf("record webhook delivery: %w", err)
+	}
+	if id, err := res.LastInsertId(); err == nil {
+		d.ID = id
+	}
+	return nil
+}
+
+// ListDeliveries returns the most recent deliveries to a webhook, newest first.
+func (r *Repository) ListDeliveries(ctx context.Context, webhookID int64, limit int) ([]Delivery, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, webhook_id, event_id, event_type, payload, status, attempts,
+		       COALESCE(response_status, 0), COALESCE(error_message, ''), duration_ms,
+		       created_at, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT ?`, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]Delivery, 0)
+	for rows.Next() {
+		var (
+			d           Delivery
+			deliveredAt sql.NullTime
+		)
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.ResponseStatus, &d.ErrorMessage, &d.DurationMs, &d.CreatedAt, &deliveredAt); err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	var (
+		w         Webhook
+		events    string
+		createdBy sql.NullInt64
+	)
+	if err := row.Scan(&w.ID, &w.URL, &w.Description, &events, &w.Active, &w.Secret, &createdBy, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("scan webhook: %w", err)
+	}
+	w.Events = strings.Split(events, ",")
+	if createdBy.Valid {
+		w.CreatedBy = &createdBy.Int64
+	}
+	return &w, nil
+}
+
+func generateSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return secretPrefix + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,85 @@
+#!/usr/bin/env python3
+"""
+Embedding Script for Go Backend
+
+This script embeds text with the same sentence-transformers model used by the
+ingestion scripts, so callers get vectors comparable to the ChromaDB collections.
+It reads JSON input from stdin and outputs JSON results to stdout.
+
+Input format:
+{
+  "texts": ["(define-public (hello) (ok true))", "..."]
+}
+
+Output format:
+{
+  "model": "all-MiniLM-L6-v2",
+  "embeddings": [[0.012, -0.034, ...], ...],
+  "token_counts": [12, ...]
+}
+"""
+
+import sys
+import json
+import os
+
+# Disable ChromaDB telemetry to avoid version compatibility issues
+os.environ["ANONYMIZED_TELEMETRY"] = "False"
+
+try:
+    from sentence_transformers import SentenceTransformer
+except ImportError as e:
+    error_msg = {
+        "error": f"Missing required Python packages: {str(e)}. Please install sentence-transformers."
+    }
+    print(json.dumps(error_msg), file=sys.stderr)
+    sys.exit(1)
+
+
+MODEL_NAME = "all-MiniLM-L6-v2"
+
+
+def embed(texts):
+    """Embed each text and count the tokens the model saw for it."""
+    model = SentenceTransformer(MODEL_NAME)
+    embeddings = model.encode(texts, batch_size=32, show_progress_bar=False)
+
+    token_counts = []
+    tokenizer = getattr(model, "tokenizer", None)
+    for text in texts:
+        if tokenizer is None:
+            token_counts.append(max(1, len(text) // 4))
+            continue
+        token_counts.append(len(tokenizer.encode(text, truncation=True)))
+
+    return {
+        "model": MODEL_NAME,
+        "embeddings": [vector.tolist() for vector in embeddings],
+        "token_counts": token_counts,
+    }
+
+
+def main():
+    """Main entry point - reads from stdin, writes to stdout"""
+    try:
+        request = json.loads(sys.stdin.read() or "{}")
+    except json.JSONDecodeError as e:
+        print(json.dumps({"error": f"Invalid JSON input: {str(e)}"}))
+        sys.exit(1)
+
+    texts = request.get("texts")
+    if not isinstance(texts, list) or not texts or not all(isinstance(t, str) for t in texts):
+        print(json.dumps({"error": "texts must be a non-empty list of strings"}))
+        sys.exit(1)
+
+    try:
+        result = embed(texts)
+    except Exception as e:
+        print(json.dumps({"error": f"Error during embedding: {str(e)}"}))
+        sys.exit(1)
+
+    print(json.dumps(result))
+
+
+if __name__ == "__main__":
+    main()
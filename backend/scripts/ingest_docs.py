@@ -16,18 +16,26 @@ from typing import List, Dict, Tuple
 # Disable ChromaDB telemetry to avoid version compatibility issues
 os.environ["ANONYMIZED_TELEMETRY"] = "False"
 
-try:
-    from sentence_transformers import SentenceTransformer
-    import chromadb
-except ImportError as e:
-    error_msg = {"type": "error", "message": f"Missing packages: {str(e)}"}
-    print(json.dumps(error_msg), file=sys.stderr)
-    sys.exit(1)
+# With INGEST_SINK=stdout the backend embeds and stores the documents in its configured
+# vector store, so they are written to stdout as "document" events instead of ChromaDB.
+EMIT_DOCUMENTS = os.getenv("INGEST_SINK") == "stdout"
+
+if not EMIT_DOCUMENTS:
+    try:
+        from sentence_transformers import SentenceTransformer
+        import chromadb
+    except ImportError as e:
+        error_msg = {"type": "error", "message": f"Missing packages: {str(e)}"}
+        print(json.dumps(error_msg), file=sys.stderr)
+        sys.exit(1)
 
 
 # Get paths
 BACKEND_DIR = Path(__file__).parent.parent
 DOCS_DIR = BACKEND_DIR / "data" / "clarity_official_docs"
+# Repository the docs are cloned from (see clone_docs.py) and where its mdBook is published
+DOCS_REPO = "book"
+DOCS_BASE_URL = os.getenv("DOCS_BASE_URL", "https://book.clarity-lang.org").rstrip("/")
 
 
 def get_chromadb_path():
@@ -43,6 +51,16 @@ def get_embedding(model, text: str) -> list:
     return model.encode(text).tolist()
 
 
+def emit_document(doc_id: str, content: str, metadata: dict):
+    """Write a document for the backend to embed and store"""
+    print(json.dumps({
+        "type": "document",
+        "id": doc_id,
+        "content": content,
+        "metadata": metadata
+    }), flush=True)
+
+
 def extract_frontmatter(content: str) -> Tuple[Dict, str]:
     """Extract YAML frontmatter and return metadata and content."""
     frontmatter = {}
@@ -258,13 +276,21 @@ def chunk_content(content: str, headers: List[Dict], file_path: str, frontmatter
     return chunks
 
 
+def get_doc_url(rel_path: str) -> str:
+    """Map a markdown source path to its page in the published book."""
+    page = Path(rel_path).with_suffix(".html").as_posix()
+    return f"{DOCS_BASE_URL}/{page}"
+
+
 def get_file_metadata(file_path: str, base_dir: Path, frontmatter: Dict) -> Dict:
     """Extract metadata from file path and frontmatter."""
     rel_path = os.path.relpath(file_path, base_dir)
     parts = Path(rel_path).parts
 
     metadata = {
+        "repo": DOCS_REPO,
         "source_file": rel_path,
+        "doc_url": get_doc_url(rel_path),
         "filename": os.path.basename(file_path),
         "directory": "/".join(parts[:-1]) if len(parts) > 1 else "",
         "file_type": "documentation",
@@ -309,23 +335,25 @@ def ingest_docs():
         }), file=sys.stderr)
         sys.exit(1)
 
-    # Initialize ChromaDB
-    chromadb_path = get_chromadb_path()
-    os.makedirs(chromadb_path, exist_ok=True)
+    collection, model = None, None
+    if not EMIT_DOCUMENTS:
+        # Initialize ChromaDB
+        chromadb_path = get_chromadb_path()
+        os.makedirs(chromadb_path, exist_ok=True)
 
-    try:
-        chroma_client = chromadb.PersistentClient(path=chromadb_path)
-        collection = chroma_client.get_or_create_collection("clarity_docs")
-    except Exception as e:
-        print(json.dumps({
-            "type": "error",
-            "message": f"Failed to initialize ChromaDB: {str(e)}"
-        }), file=sys.stderr)
-        sys.exit(1)
+        try:
+            chroma_client = chromadb.PersistentClient(path=chromadb_path)
+            collection = chroma_client.get_or_create_collection("clarity_docs")
+        except Exception as e:
+            print(json.dumps({
+                "type": "error",
+                "message": f"Failed to initialize ChromaDB: {str(e)}"
+            }), file=sys.stderr)
+            sys.exit(1)
 
-    # Load embedding model
-    print(json.dumps({"type": "info", "message": "Loading embedding model..."}), flush=True)
-    model = SentenceTransformer('all-MiniLM-L6-v2')
+        # Load embedding model
+        print(json.dumps({"type": "info", "message": "Loading embedding model..."}), flush=True)
+        model = SentenceTransformer('all-MiniLM-L6-v2')
 
     # Find documentation files
     doc_files = find_doc_files(DOCS_DIR)
@@ -386,12 +414,15 @@ def ingest_docs():
                     elif not isinstance(value, (str, int, float, bool)) or value is None:
                         metadata[key] = str(value) if value is not None else ""
 
-                embedding = get_embedding(model, chunk['content'])
+                if EMIT_DOCUMENTS:
+                    emit_document(f"clarity_docs_{chunk_id}", chunk['content'], metadata)
+                else:
+                    embedding = get_embedding(model, chunk['content'])
 
-                docs.append(chunk['content'])
-                embeddings.append(embedding)
-                metadatas.append(metadata)
-                ids.append(f"clarity_docs_{chunk_id}")
+                    docs.append(chunk['content'])
+                    embeddings.append(embedding)
+                    metadatas.append(metadata)
+                    ids.append(f"clarity_docs_{chunk_id}")
                 chunk_id += 1
 
             # Report progress every 5 files
@@ -433,7 +464,7 @@ def ingest_docs():
     # Report completion
     print(json.dumps({
         "type": "complete",
-        "total_processed": len(docs),
+        "total_processed": chunk_id,
         "files_processed": len(doc_files)
     }), flush=True)
 
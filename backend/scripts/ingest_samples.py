@@ -14,13 +14,18 @@ from pathlib import Path
 # Disable ChromaDB telemetry to avoid version compatibility issues
 os.environ["ANONYMIZED_TELEMETRY"] = "False"
 
-try:
-    from sentence_transformers import SentenceTransformer
-    import chromadb
-except ImportError as e:
-    error_msg = {"type": "error", "message": f"Missing packages: {str(e)}"}
-    print(json.dumps(error_msg), file=sys.stderr)
-    sys.exit(1)
+# With INGEST_SINK=stdout the backend chunks, embeds and stores the documents in its
+# configured vector store, so they are written to stdout as "document" events instead of ChromaDB.
+EMIT_DOCUMENTS = os.getenv("INGEST_SINK") == "stdout"
+
+if not EMIT_DOCUMENTS:
+    try:
+        from sentence_transformers import SentenceTransformer
+        import chromadb
+    except ImportError as e:
+        error_msg = {"type": "error", "message": f"Missing packages: {str(e)}"}
+        print(json.dumps(error_msg), file=sys.stderr)
+        sys.exit(1)
 
 
 # Get paths
@@ -43,6 +48,16 @@ def get_embedding(model, text: str) -> list:
     return model.encode(text).tolist()
 
 
+def emit_document(doc_id: str, content: str, metadata: dict):
+    """Write a document for the backend to embed and store"""
+    print(json.dumps({
+        "type": "document",
+        "id": doc_id,
+        "content": content,
+        "metadata": metadata
+    }), flush=True)
+
+
 def get_metadata(file_path, base_dir, has_toml=False):
     """Extract metadata from file path"""
     rel_path = os.path.relpath(file_path, base_dir)
@@ -51,6 +66,8 @@ def get_metadata(file_path, base_dir, has_toml=False):
     filename = parts[-1]
 
     metadata = {
+        # Each repository is cloned into its own top-level directory
+        "repo": parts[0] if len(parts) > 1 else "",
         "folders": "/".join(folders),
         "filename": filename,
         "rel_path": rel_path,
@@ -107,23 +124,25 @@ def ingest_samples():
         }), file=sys.stderr)
         sys.exit(1)
 
-    # Initialize ChromaDB
-    chromadb_path = get_chromadb_path()
-    os.makedirs(chromadb_path, exist_ok=True)
+    collection, model = None, None
+    if not EMIT_DOCUMENTS:
+        # Initialize ChromaDB
+        chromadb_path = get_chromadb_path()
+        os.makedirs(chromadb_path, exist_ok=True)
 
-    try:
-        chroma_client = chromadb.PersistentClient(path=chromadb_path)
-        collection = chroma_client.get_or_create_collection("clarity_code_samples")
-    except Exception as e:
-        print(json.dumps({
-            "type": "error",
-            "message": f"Failed to initialize ChromaDB: {str(e)}"
-        }), file=sys.stderr)
-        sys.exit(1)
+        try:
+            chroma_client = chromadb.PersistentClient(path=chromadb_path)
+            collection = chroma_client.get_or_create_collection("clarity_code_samples")
+        except Exception as e:
+            print(json.dumps({
+                "type": "error",
+                "message": f"Failed to initialize ChromaDB: {str(e)}"
+            }), file=sys.stderr)
+            sys.exit(1)
 
-    # Load embedding model
-    print(json.dumps({"type": "info", "message": "Loading embedding model..."}), flush=True)
-    model = SentenceTransformer('all-MiniLM-L6-v2')
+        # Load embedding model
+        print(json.dumps({"type": "info", "message": "Loading embedding model..."}), flush=True)
+        model = SentenceTransformer('all-MiniLM-L6-v2')
 
     # Find files
     clar_files, clarinet_toml_files, project_toml_map = find_project_files(SAMPLES_DIR)
@@ -141,6 +160,7 @@ def ingest_samples():
 
     docs, embeddings, metadatas, ids = [], [], [], []
     current = 0
+    emitted = 0
 
     # Process .clar files first
     print(json.dumps({"type": "info", "message": "Processing .clar files..."}), flush=True)
@@ -164,12 +184,16 @@ def ingest_samples():
                 continue
 
             meta = get_metadata(file_path, SAMPLES_DIR, has_toml)
-            emb = get_embedding(model, code)
+            if EMIT_DOCUMENTS:
+                emit_document(f"clarity_sample_{current}", code, meta)
+                emitted += 1
+            else:
+                emb = get_embedding(model, code)
 
-            docs.append(code)
-            embeddings.append(emb)
-            metadatas.append(meta)
-            ids.append(f"clarity_sample_{current}")
+                docs.append(code)
+                embeddings.append(emb)
+                metadatas.append(meta)
+                ids.append(f"clarity_sample_{current}")
 
             # Report progress every 10 files
             if current % 10 == 0 or current == 1:
@@ -203,12 +227,16 @@ def ingest_samples():
                 continue
 
             meta = get_metadata(file_path, SAMPLES_DIR, has_toml=True)
-            emb = get_embedding(model, toml_content)
+            if EMIT_DOCUMENTS:
+                emit_document(f"toml_sample_{current}", toml_content, meta)
+                emitted += 1
+            else:
+                emb = get_embedding(model, toml_content)
 
-            docs.append(toml_content)
-            embeddings.append(emb)
-            metadatas.append(meta)
-            ids.append(f"toml_sample_{current}")
+                docs.append(toml_content)
+                embeddings.append(emb)
+                metadatas.append(meta)
+                ids.append(f"toml_sample_{current}")
 
             if current % 10 == 0:
                 print(json.dumps({
@@ -248,7 +276,7 @@ def ingest_samples():
     # Report completion
     print(json.dumps({
         "type": "complete",
-        "total_processed": len(docs)
+        "total_processed": emitted if EMIT_DOCUMENTS else len(docs)
     }), flush=True)
 
 
@@ -10,16 +10,23 @@ Input format:
 {
   "query": "How to create an actor in Clarity?",
   "n_results": 5,
-  "docs_results": 8
+  "docs_results": 8,
+  "collection": "all",
+  "repos": ["clarity-examples"]
 }
 
+"collection" is "code", "docs" or "all" (default); "repos" keeps only chunks whose
+"repo" metadata matches one of the names.
+
 Output format:
 {
   "code_contexts": ["actor MyActor { ... }", "..."],
-  "code_metadata": [{"filename": "hello.clar", "rel_path": "hello_world/hello.clar"}, ...],
+  "code_ids": ["clarity_sample_1", ...],
+  "code_metadata": [{"filename": "hello.clar", "rel_path": "clarity-examples/hello_world/hello.clar", "repo": "clarity-examples"}, ...],
   "code_distances": [0.12, ...],
   "docs_contexts": ["Actors are the fundamental unit...", "..."],
-  "docs_metadata": [{"source_file": "fundamentals/actors.md", "chunk_title": "Actors overview"}, ...],
+  "docs_ids": ["clarity_docs_1", ...],
+  "docs_metadata": [{"source_file": "ch01-00-introduction.md", "chunk_title": "Introduction", "repo": "book", "doc_url": "https://book.clarity-lang.org/ch01-00-introduction.html"}, ...],
   "docs_distances": [0.21, ...]
 }
 """
@@ -70,24 +77,35 @@ def query_collection(
     collection: Any,
     query_embedding: List[float],
     limit: int,
-) -> Tuple[List[str], List[Dict[str, object]], List[float]]:
+    repos: Optional[List[str]] = None,
+) -> Tuple[List[str], List[str], List[Dict[str, object]], List[float]]:
     """Query a ChromaDB collection and normalise the response."""
-    results = collection.query(query_embeddings=[query_embedding], n_results=limit)
+    where = {"repo": {"$in": repos}} if repos else None
+    results = collection.query(query_embeddings=[query_embedding], n_results=limit, where=where)
 
+    ids = results.get("ids", [[]])[0] if results else []
     documents = results.get("documents", [[]])[0] if results else []
     metadatas = results.get("metadatas", [[]])[0] if results else []
     distances = results.get("distances", [[]])[0] if results else []
 
-    return documents, metadatas, distances
+    return ids, documents, metadatas, distances
 
 
-def retrieve_context(query: str, n_results: int = 5, docs_results: Optional[int] = None):
+def retrieve_context(
+    query: str,
+    n_results: int = 5,
+    docs_results: Optional[int] = None,
+    collection: str = "all",
+    repos: Optional[List[str]] = None,
+):
     """
     Retrieve relevant Clarity code context from ChromaDB
 
     Args:
         query: The user's query string
         n_results: Number of results to return
+        collection: "code", "docs" or "all"
+        repos: Repository names to restrict results to
 
     Returns:
         Dictionary with contexts and metadata
@@ -102,39 +120,56 @@ def retrieve_context(query: str, n_results: int = 5, docs_results: Optional[int]
             }
 
         client = chromadb.PersistentClient(path=chromadb_path)
-
-        try:
-            code_collection = client.get_collection(name="clarity_code_samples")
-        except Exception:
-            return {
-                "error": "Collection 'clarity_code_samples' not found. Please run code ingestion first."
-            }
+        include_code = collection != "docs"
+        include_docs = collection != "code"
+
+        code_collection = None
+        if include_code:
+            try:
+                code_collection = client.get_collection(name="clarity_code_samples")
+            except Exception:
+                return {
+                    "error": "Collection 'clarity_code_samples' not found. Please run code ingestion first."
+                }
 
         docs_collection = None
         docs_warning = None
-        try:
-            docs_collection = client.get_collection(name="clarity_docs")
-        except Exception:
-            docs_warning = "Collection 'clarity_docs' not found. Documentation results will be empty."
+        if include_docs:
+            try:
+                docs_collection = client.get_collection(name="clarity_docs")
+            except Exception:
+                if not include_code:
+                    return {
+                        "error": "Collection 'clarity_docs' not found. Please run docs ingestion first."
+                    }
+                docs_warning = "Collection 'clarity_docs' not found. Documentation results will be empty."
 
         model = get_sentence_transformer()
         query_embedding = model.encode(query).tolist()
 
-        code_docs, code_metas, code_distances = query_collection(code_collection, query_embedding, n_results)
+        code_ids: List[str] = []
+        code_docs: List[str] = []
+        code_metas: List[Dict[str, object]] = []
+        code_distances: List[float] = []
+        if code_collection is not None:
+            code_ids, code_docs, code_metas, code_distances = query_collection(code_collection, query_embedding, n_results, repos)
 
         docs_limit = docs_results if isinstance(docs_results, int) and docs_results > 0 else n_results
+        doc_ids: List[str] = []
         doc_docs: List[str] = []
         doc_metas: List[Dict[str, object]] = []
         doc_distances: List[float] = []
 
         if docs_collection is not None:
-            doc_docs, doc_metas, doc_distances = query_collection(docs_collection, query_embedding, docs_limit)
+            doc_ids, doc_docs, doc_metas, doc_distances = query_collection(docs_collection, query_embedding, docs_limit, repos)
 
         response: Dict[str, object] = {
             "code_contexts": code_docs,
+            "code_ids": code_ids,
             "code_metadata": code_metas,
             "code_distances": code_distances,
             "docs_contexts": doc_docs,
+            "docs_ids": doc_ids,
             "docs_metadata": doc_metas,
             "docs_distances": doc_distances,
         }
@@ -178,6 +213,8 @@ def main():
         query = request["query"]
         n_results = request.get("n_results", 5)
         docs_results = request.get("docs_results")
+        collection = request.get("collection") or "all"
+        repos = request.get("repos") or None
 
         # Validate n_results
         if not isinstance(n_results, int) or n_results < 1 or n_results > 20:
@@ -191,8 +228,18 @@ def main():
                 print(json.dumps(error_response))
                 sys.exit(1)
 
+        if collection not in ("all", "code", "docs"):
+            error_response = {"error": "collection must be one of all, code or docs"}
+            print(json.dumps(error_response))
+            sys.exit(1)
+
+        if repos is not None and (not isinstance(repos, list) or not all(isinstance(r, str) for r in repos)):
+            error_response = {"error": "repos must be a list of repository names"}
+            print(json.dumps(error_response))
+            sys.exit(1)
+
         # Retrieve context
-        result = retrieve_context(query, n_results, docs_results)
+        result = retrieve_context(query, n_results, docs_results, collection, repos)
 
         # Output result as JSON
         print(json.dumps(result))
@@ -0,0 +1,251 @@
+package testharness
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/rag"
+)
+
+// CodegenCall records the arguments of a single FakeCodegen invocation.
+type CodegenCall struct {
+	Query        string
+	CodeContexts []string
+	DocContexts  []string
+	Temperature  float64
+	MaxTokens    int
+	// Tools holds the tools offered and tool rounds replayed, if any.
+	Tools codegen.ToolRequest
+}
+
+// FakeCodegen is a deterministic codegen.Service that returns canned responses.
+type FakeCodegen struct {
+	mu sync.Mutex
+
+	// Model is reported on every response.
+	Model string
+	// Responses maps a substring of the query to a canned response. The longest matching key wins.
+	// A response's ToolCalls are only returned while tools are offered and no tool results
+	// have been sent back yet, so a tool loop ends with the response's text.
+	Responses map[string]codegen.CodeGenerationResponse
+	// Default is returned when no entry in Responses matches.
+	Default codegen.CodeGenerationResponse
+	// Err, when set, is returned instead of a response.
+	Err error
+
+	calls []CodegenCall
+}
+
+// NewFakeCodegen returns a FakeCodegen with a simple default Clarity response.
+func NewFakeCodegen() *FakeCodegen {
+	return &FakeCodegen{
+		Model:     "fake-model",
+		Responses: make(map[string]codegen.CodeGenerationResponse),
+		Default: codegen.CodeGenerationResponse{
+			Code:        "(define-read-only (hello) (ok \"hello\"))",
+			Explanation: "A read-only function that returns a greeting.",
+		},
+	}
+}
+
+// GenerateCode returns the canned response matching the query.
+func (f *FakeCodegen) GenerateCode(ctx context.Context, query string, codeContexts []string, docContexts []string, temperature float64, maxTokens int) (*codegen.CodeGenerationResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, CodegenCall{
+		Query:        query,
+		CodeContexts: append([]string(nil), codeContexts...),
+		DocContexts:  append([]string(nil), docContexts...),
+		Temperature:  temperature,
+		MaxTokens:    maxTokens,
+	})
+	tools, _ := codegen.ToolsFromContext(ctx)
+	f.calls[len(f.calls)-1].Tools = tools
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	resp := f.Default
+	bestLen := -1
+	for key, candidate := range f.Responses {
+		if strings.Contains(query, key) && len(key) > bestLen {
+			resp = candidate
+			bestLen = len(key)
+		}
+	}
+
+	if len(tools.Tools) == 0 || len(tools.Turns) > 0 {
+		resp.ToolCalls = nil
+	}
+	if resp.Model == "" {
+		resp.Model = f.Model
+	}
+	if resp.InputTokens == 0 {
+		resp.InputTokens = len(strings.Fields(query))
+	}
+	if resp.OutputTokens == 0 {
+		resp.OutputTokens = len(strings.Fields(resp.Code)) + len(strings.Fields(resp.Explanation))
+	}
+	if resp.Text == "" {
+		resp.Text = resp.Explanation
+		if resp.Code != "" {
+			resp.Text += "\n\n```clarity\n" + resp.Code + "\n```"
+		}
+	}
+
+	return &resp, nil
+}
+
+// GenerateCodeStream returns the same response as GenerateCode, emitting its text word by word.
+func (f *FakeCodegen) GenerateCodeStream(ctx context.Context, query string, codeContexts []string, docContexts []string, temperature float64, maxTokens int, onDelta codegen.DeltaFunc) (*codegen.CodeGenerationResponse, error) {
+	resp, err := f.GenerateCode(ctx, query, codeContexts, docContexts, temperature, maxTokens)
+	if err != nil {
+		return nil, err
+	}
+	if onDelta != nil {
+		for _, part := range strings.SplitAfter(resp.Text, " ") {
+			if part != "" {
+				onDelta(part)
+			}
+		}
+	}
+	return resp, nil
+}
+
+// Calls returns a copy of the recorded invocations.
+func (f *FakeCodegen) Calls() []CodegenCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]CodegenCall(nil), f.calls...)
+}
+
+// Document is an entry in the FakeVectorStore.
+type Document struct {
+	ID      string
+	Content string
+	// Docs marks the document as documentation rather than a code sample.
+	Docs bool
+	// Source is reported with the document and Source.Repo is matched by repo filters.
+	Source rag.Source
+}
+
+// source returns the document's Source, defaulting its ID to the document ID.
+func (d Document) source() rag.Source {
+	source := d.Source
+	if source.ID == "" {
+		source.ID = d.ID
+	}
+	return source
+}
+
+// FakeVectorStore is an in-memory rag.Retriever that ranks documents by keyword overlap.
+type FakeVectorStore struct {
+	mu   sync.RWMutex
+	docs []Document
+	// Err, when set, is returned instead of results.
+	Err error
+}
+
+// NewFakeVectorStore returns a store seeded with the supplied documents.
+func NewFakeVectorStore(docs ...Document) *FakeVectorStore {
+	return &FakeVectorStore{docs: append([]Document(nil), docs...)}
+}
+
+// Add inserts documents into the store.
+func (s *FakeVectorStore) Add(docs ...Document) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs = append(s.docs, docs...)
+}
+
+// RetrieveContext returns up to nResults code and docs contexts matching the filter, ordered
+// by keyword overlap. Distances are 1 - overlap ratio, so identical wording scores 0.
+func (s *FakeVectorStore) RetrieveContext(_ context.Context, query string, nResults int, filter rag.Filter) (*rag.RAGResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	if nResults <= 0 {
+		nResults = 5
+	}
+
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	filter = filter.Normalize()
+	terms := tokenize(query)
+
+	type scored struct {
+		doc      Document
+		distance float64
+	}
+	var code, docs []scored
+	for _, doc := range s.docs {
+		if len(filter.Repos) > 0 && !slices.Contains(filter.Repos, doc.Source.Repo) {
+			continue
+		}
+		entry := scored{doc: doc, distance: 1 - overlap(terms, tokenize(doc.Content))}
+		switch {
+		case doc.Docs && filter.IncludesDocs():
+			docs = append(docs, entry)
+		case !doc.Docs && filter.IncludesCode():
+			code = append(code, entry)
+		}
+	}
+
+	byDistance := func(items []scored) {
+		sort.SliceStable(items, func(i, j int) bool { return items[i].distance < items[j].distance })
+	}
+	byDistance(code)
+	byDistance(docs)
+
+	resp := &rag.RAGResponse{
+		CodeContexts:  make([]string, 0),
+		CodeDistances: make([]float64, 0),
+		DocsContexts:  make([]string, 0),
+		DocsDistances: make([]float64, 0),
+	}
+	for i := 0; i < len(code) && i < nResults; i++ {
+		resp.CodeContexts = append(resp.CodeContexts, code[i].doc.Content)
+		resp.CodeDistances = append(resp.CodeDistances, code[i].distance)
+		resp.CodeSources = append(resp.CodeSources, code[i].doc.source())
+	}
+	for i := 0; i < len(docs) && i < nResults; i++ {
+		resp.DocsContexts = append(resp.DocsContexts, docs[i].doc.Content)
+		resp.DocsDistances = append(resp.DocsDistances, docs[i].distance)
+		resp.DocsSources = append(resp.DocsSources, docs[i].doc.source())
+	}
+
+	return resp, nil
+}
+
+func tokenize(text string) map[string]bool {
+	terms := make(map[string]bool)
+	for _, field := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-')
+	}) {
+		terms[field] = true
+	}
+	return terms
+}
+
+func overlap(query, doc map[string]bool) float64 {
+	if len(query) == 0 {
+		return 0
+	}
+	matches := 0
+	for term := range query {
+		if doc[term] {
+			matches++
+		}
+	}
+	return float64(matches) / float64(len(query))
+}
@@ -0,0 +1,199 @@
+// Package testharness wires the HTTP API to an in-memory SQLite database and fake
+// providers so handlers can be exercised without network access or Python.
+package testharness
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/handlers"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/api/middleware"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/artifact"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/backup"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/batch"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/cachewarm"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/codegen"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/eval"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/ingestion"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/requestlimit"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/spend"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/webhook"
+)
+
+// Harness bundles an in-memory database, a fully routed gin engine, and the fakes behind it.
+//
+// Each Harness routes to its own service registry, so harnesses can run side by side. The
+// runtime codegen override is process-wide, and Close clears it.
+type Harness struct {
+	DB          *sql.DB
+	Router      *gin.Engine
+	Codegen     *FakeCodegen
+	VectorStore *FakeVectorStore
+	QueryLogs   *querylog.Repository
+	// Services holds the fakes; override individual services on it between scenarios.
+	Services *handlers.ServiceRegistry
+
+	archiveDir string
+}
+
+// New builds a Harness with fresh fakes and a migrated in-memory database.
+func New() (*Harness, error) {
+	db, err := database.OpenInMemory()
+	if err != nil {
+		return nil, err
+	}
+
+	gin.SetMode(gin.TestMode)
+	middleware.SetMaintenanceMode(false)
+
+	qlRepo := querylog.NewRepository(db)
+	qlService := querylog.NewService(qlRepo, querylog.ServiceConfig{})
+
+	staleKeyCfg := auth.StaleKeyConfig{}
+	keySweeper := auth.NewStaleKeySweeper(db, staleKeyCfg, nil)
+
+	// Webhook workers are not started, so published events are never delivered; the test
+	// endpoint still sends synchronously.
+	webhooks := webhook.NewDispatcher(webhook.NewRepository(db), webhook.Config{})
+
+	// Workers are not started, so ingestion jobs stay queued instead of running scripts.
+	ingestManager := ingestion.NewManager(db, ingestion.Config{}, webhooks)
+	batchManager := batch.NewManager(db, batch.Config{}, qlService, webhooks)
+	// Trials are enabled so tests can exercise the trial tier; cleanup is not started.
+	trials := auth.NewTrialService(db, auth.TrialConfig{Enabled: true, TTL: time.Hour})
+
+	// No budgets are configured and checks are not started; the spend report still works.
+	spendService := spend.NewService(db, spend.Config{}, nil)
+
+	// No backup directory is configured, so the backup endpoints answer 501.
+	backups := backup.NewService(db, backup.Config{})
+
+	// Expired artifacts are not cleaned up; links are signed with a fixed secret.
+	artifacts := artifact.NewStore(db, artifact.Config{Secret: []byte("testharness")})
+
+	codegenFake := NewFakeCodegen()
+	vectorStore := NewFakeVectorStore()
+	services := handlers.NewServiceRegistry()
+	services.SetRAG(vectorStore)
+	for _, provider := range []string{codegen.ProviderGemini, codegen.ProviderOpenAI, codegen.ProviderClaude, codegen.ProviderLocal} {
+		services.SetCodegen(provider, codegenFake)
+	}
+	// Fakes are reprogrammed between scenarios, so cached responses would go stale.
+	services.SetResponseCache(nil)
+
+	// Runs are not scheduled; triggered runs generate with the fake codegen.
+	evals := handlers.NewEvalService(db, services, eval.Config{})
+
+	// Archives go to a temporary directory and are only written on demand.
+	archiveDir, err := os.MkdirTemp("", "querylog-archives-")
+	if err != nil {
+		database.Close(db)
+		return nil, err
+	}
+	archiver := querylog.NewArchiver(db, querylog.ArchiveConfig{Dir: archiveDir, AfterDays: 32})
+
+	router := gin.New()
+	if err := middleware.ConfigureClientIP(router); err != nil {
+		database.Close(db)
+		os.RemoveAll(archiveDir)
+		return nil, err
+	}
+	router.Use(middleware.OpenAIErrorMiddleware([]string{"/v1/"}))
+	router.Use(middleware.MaintenanceModeMiddleware(middleware.MaintenanceConfigFromEnv()))
+	router.Use(middleware.RequestLimitsMiddleware(requestlimit.ConfigFromEnv()))
+	api.SetupRoutes(router, db, qlRepo, qlService, keySweeper, staleKeyCfg, ingestManager, batchManager, handlers.NewCacheWarmer(services, qlRepo, cachewarm.Config{}), trials, services, webhooks, spendService, backups, artifacts, evals, archiver)
+
+	h := &Harness{
+		DB:          db,
+		Router:      router,
+		Codegen:     codegenFake,
+		VectorStore: vectorStore,
+		QueryLogs:   qlRepo,
+		Services:    services,
+		archiveDir:  archiveDir,
+	}
+
+	return h, nil
+}
+
+// Close releases the database, clears any runtime codegen override and removes archived
+// query logs.
+func (h *Harness) Close() error {
+	_ = codegen.SetRuntimeConfig(codegen.RuntimeConfig{})
+	os.RemoveAll(h.archiveDir)
+	return database.Close(h.DB)
+}
+
+// CreateUser inserts a user and returns its ID.
+func (h *Harness) CreateUser(username, password, role string) (int, error) {
+	return auth.NewUserRepository(h.DB).Create(context.Background(), auth.NewUser{Username: username, Password: password, Role: role})
+}
+
+// CreateAPIKey issues an API key for the user and returns the plain-text key.
+func (h *Harness) CreateAPIKey(userID int) (string, error) {
+	resp, err := auth.CreateAPIKey(h.DB, userID, "", nil)
+	if err != nil {
+		return "", err
+	}
+	return resp.APIKey, nil
+}
+
+// Do sends a request through the router. A non-nil body is JSON encoded unless it is already a []byte or string.
+func (h *Harness) Do(method, path string, body any, headers map[string]string) (*httptest.ResponseRecorder, error) {
+	var reader io.Reader
+	switch v := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(v)
+	case string:
+		reader = bytes.NewBufferString(v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Router.ServeHTTP(rec, req)
+	return rec, nil
+}
+
+// BasicAuth returns request headers carrying HTTP basic credentials.
+func BasicAuth(username, password string) map[string]string {
+	token := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	return map[string]string{"Authorization": "Basic " + token}
+}
+
+// APIKey returns request headers carrying an API key.
+func APIKey(key string) map[string]string {
+	return map[string]string{"x-api-key": key}
+}
+
+// StatusOK reports whether the recorder holds a 2xx response.
+func StatusOK(rec *httptest.ResponseRecorder) bool {
+	return rec.Code >= http.StatusOK && rec.Code < http.StatusMultipleChoices
+}
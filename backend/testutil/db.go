@@ -0,0 +1,42 @@
+// Package testutil provides databases and fixtures for repository-level tests: a migrated
+// SQLite database in a temporary directory, an optional PostgreSQL container, and helpers
+// that insert users, API keys, query logs and conversations.
+//
+// Helpers take a testing.TB, fail the test on error and release their resources with
+// tb.Cleanup.
+package testutil
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/database"
+)
+
+// NewSQLite returns a migrated SQLite database stored in a temporary directory. Unlike
+// database.OpenInMemory the file supports concurrent connections, so repositories run
+// against the same pool configuration as production.
+func NewSQLite(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	path := filepath.Join(tb.TempDir(), "test.db")
+	db, err := database.Open(path)
+	if err != nil {
+		tb.Fatalf("open sqlite database: %v", err)
+	}
+	tb.Cleanup(func() { database.Close(db) })
+	return db
+}
+
+// NewInMemorySQLite returns a migrated private in-memory database for fast tests.
+func NewInMemorySQLite(tb testing.TB) *sql.DB {
+	tb.Helper()
+
+	db, err := database.OpenInMemory()
+	if err != nil {
+		tb.Fatalf("open in-memory database: %v", err)
+	}
+	tb.Cleanup(func() { database.Close(db) })
+	return db
+}
@@ -0,0 +1,94 @@
+package testutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/auth"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/conversation"
+	"github.com/Quantum3-Labs/stacks-builder/backend/internal/querylog"
+)
+
+// FixturePassword is the password of every user created by CreateUser.
+const FixturePassword = "fixture-password"
+
+var fixtureSeq atomic.Int64
+
+// UniqueName returns prefix followed by a number unique within the test binary.
+func UniqueName(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, fixtureSeq.Add(1))
+}
+
+// CreateUser inserts a user with a unique username and FixturePassword, and returns its ID.
+// An empty role creates a regular user.
+func CreateUser(tb testing.TB, db *sql.DB, role string) int {
+	tb.Helper()
+
+	userID, err := auth.NewUserRepository(db).Create(context.Background(), auth.NewUser{
+		Username: UniqueName("user"),
+		Password: FixturePassword,
+		Role:     role,
+	})
+	if err != nil {
+		tb.Fatalf("create user: %v", err)
+	}
+	return userID
+}
+
+// CreateAPIKey issues a non-expiring API key for the user.
+func CreateAPIKey(tb testing.TB, db *sql.DB, userID int) *auth.APIKeyResponse {
+	tb.Helper()
+
+	resp, err := auth.CreateAPIKey(db, userID, UniqueName("key"), nil)
+	if err != nil {
+		tb.Fatalf("create api key: %v", err)
+	}
+	return resp
+}
+
+// CreateQueryLog inserts a successful query log for the user. mutate, when set, adjusts the
+// log before it is stored.
+func CreateQueryLog(tb testing.TB, db *sql.DB, userID int, mutate func(*querylog.QueryLog)) *querylog.QueryLog {
+	tb.Helper()
+
+	log := &querylog.QueryLog{
+		UserID:        int64(userID),
+		Endpoint:      "/api/v1/rag/generate",
+		Query:         UniqueName("query"),
+		Response:      `{"code":"(define-public (hello) (ok true))"}`,
+		ModelProvider: "gemini",
+		InputTokens:   100,
+		OutputTokens:  50,
+		LatencyMs:     250,
+		Status:        "success",
+	}
+	if mutate != nil {
+		mutate(log)
+	}
+	if err := querylog.NewRepository(db).Create(log); err != nil {
+		tb.Fatalf("create query log: %v", err)
+	}
+	return log
+}
+
+// CreateConversation saves a conversation for the user whose history alternates user and
+// assistant turns, starting with the user.
+func CreateConversation(tb testing.TB, db *sql.DB, userID int, turns ...string) *conversation.Conversation {
+	tb.Helper()
+
+	convo := conversation.New(userID)
+	for i, content := range turns {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		convo.AddTurn(role, content)
+	}
+	if err := conversation.NewRepository(db).Save(context.Background(), convo); err != nil {
+		tb.Fatalf("create conversation: %v", err)
+	}
+	return convo
+}
@@ -0,0 +1,95 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	defaultPostgresImage = "pgvector/pgvector:pg16"
+	postgresPassword     = "testutil"
+	postgresStartTimeout = 60 * time.Second
+)
+
+// PostgresDSN returns the DSN of a PostgreSQL database with the pgvector extension
+// available. TEST_POSTGRES_DSN points tests at an existing server; otherwise a throwaway
+// container is started with the docker CLI (image TEST_POSTGRES_IMAGE, default
+// pgvector/pgvector:pg16) and removed on cleanup. The test is skipped when neither is
+// available.
+//
+// Opening the DSN needs a registered driver, so tests using it build with -tags pgvector.
+func PostgresDSN(tb testing.TB) string {
+	tb.Helper()
+
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		return dsn
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		tb.Skip("PostgreSQL tests need TEST_POSTGRES_DSN or a docker CLI")
+	}
+
+	image := os.Getenv("TEST_POSTGRES_IMAGE")
+	if image == "" {
+		image = defaultPostgresImage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresStartTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "docker", "run", "-d", "--rm",
+		"-e", "POSTGRES_PASSWORD="+postgresPassword,
+		"-p", "127.0.0.1::5432",
+		image,
+	).Output()
+	if err != nil {
+		tb.Fatalf("start postgres container: %v", commandError(err))
+	}
+	containerID := strings.TrimSpace(string(out))
+	tb.Cleanup(func() {
+		if err := exec.Command("docker", "rm", "-f", containerID).Run(); err != nil {
+			tb.Logf("remove postgres container %s: %v", containerID, err)
+		}
+	})
+
+	out, err = exec.CommandContext(ctx, "docker", "port", containerID, "5432/tcp").Output()
+	if err != nil {
+		tb.Fatalf("inspect postgres container port: %v", commandError(err))
+	}
+	addr := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	if err := waitForPostgres(ctx, containerID); err != nil {
+		tb.Fatalf("wait for postgres: %v", err)
+	}
+	return fmt.Sprintf("postgres://postgres:%s@%s/postgres?sslmode=disable", postgresPassword, addr)
+}
+
+// waitForPostgres polls until the server accepts TCP connections. The image's init phase
+// runs a temporary server on the Unix socket only, so a TCP check waits for the final one.
+func waitForPostgres(ctx context.Context, containerID string) error {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		if exec.CommandContext(ctx, "docker", "exec", containerID, "pg_isready", "-h", "127.0.0.1", "-U", "postgres").Run() == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func commandError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}